@@ -0,0 +1,139 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"syscall"
+
+	"github.com/atomicdeploy/patris-export/pkg/filecopy"
+	"github.com/atomicdeploy/patris-export/pkg/paradox"
+	"github.com/fatih/color"
+)
+
+// Exit codes, so scripts can tell failures apart without reading messages
+const (
+	// exitFailure is any failure without a code of its own
+	exitFailure = 1
+	// exitUsage is an invalid command line, flag value or settings file
+	exitUsage = 2
+	// exitNotFound is a file that does not exist
+	exitNotFound = 3
+	// exitParse is a table or input file that cannot be read or parsed
+	exitParse = 4
+	// exitConvert is a failure to convert records or write an export
+	exitConvert = 5
+	// exitLocked is a file another process holds locked
+	exitLocked = 6
+	// exitPartial is a command on several inputs that failed on some
+	exitPartial = 7
+	// exitDiffers is diff --exit-code finding differences, which is no
+	// failure of the command
+	exitDiffers = 8
+)
+
+// exitKinds name the exit codes in JSON errors
+var exitKinds = map[int]string{
+	exitFailure:  "failure",
+	exitUsage:    "usage",
+	exitNotFound: "not_found",
+	exitParse:    "parse",
+	exitConvert:  "conversion",
+	exitLocked:   "locked",
+	exitPartial:  "partial",
+	exitDiffers:  "differences",
+}
+
+// Formats of --error-format
+const (
+	errorText = "text"
+	errorJSON = "json"
+)
+
+// errorFormat is how the error ending a command is reported (--error-format)
+var errorFormat = errorText
+
+// exitError is an error ending a command with an exit code
+type exitError struct {
+	code    int
+	message string
+	// cause is the underlying error, if any, which may give a more specific
+	// code
+	cause error
+}
+
+func (e *exitError) Error() string { return e.message }
+func (e *exitError) Unwrap() error { return e.cause }
+
+// exitCode returns the exit code of an error. A missing, locked or invalid
+// file is reported as such even where a command gives a general code or
+// reading code; other codes are kept.
+func exitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	code := exitFailure
+	var exitErr *exitError
+	if errors.As(err, &exitErr) {
+		code = exitErr.code
+	}
+	if code != exitFailure && code != exitParse {
+		return code
+	}
+
+	var locked *filecopy.LockedError
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return exitNotFound
+	case errors.As(err, &locked), errors.Is(err, syscall.EBUSY), errors.Is(err, syscall.EAGAIN):
+		return exitLocked
+	case errors.Is(err, paradox.ErrNotTable), errors.Is(err, paradox.ErrUnsupportedVersion):
+		return exitParse
+	}
+	return code
+}
+
+// fail prints an error message and exits with code, or the more specific
+// code of the first error among a
+func fail(code int, format string, a ...interface{}) {
+	exit(reportError(color.Output, code, format, a...))
+}
+
+// failTo is fail printing the message to w
+func failTo(w io.Writer, code int, format string, a ...interface{}) {
+	exit(reportError(w, code, format, a...))
+}
+
+// reportError prints an error message to w and returns it as an error with
+// code, caused by the first error among a
+func reportError(w io.Writer, code int, format string, a ...interface{}) error {
+	err := &exitError{code: code, message: fmt.Sprintf(format, a...)}
+	for _, arg := range a {
+		if cause, ok := arg.(error); ok {
+			err.cause = cause
+			break
+		}
+	}
+	errorColor.Fprintf(w, "❌ %s\n", err.message)
+	return err
+}
+
+// exit ends the command with the exit code of err, whose message has been
+// printed; with --error-format json the error is also written to standard
+// error as a line of {"error", "code", "kind"}. Table copies kept for reuse
+// are deleted first.
+func exit(err error) {
+	filecopy.Purge()
+	code := exitCode(err)
+	if errorFormat == errorJSON {
+		json.NewEncoder(os.Stderr).Encode(struct {
+			Error string `json:"error"`
+			Code  int    `json:"code"`
+			Kind  string `json:"kind"`
+		}{err.Error(), code, exitKinds[code]})
+	}
+	os.Exit(code)
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"unicode"
+
+	"github.com/fatih/color"
+)
+
+// Log formats of --log-format
+const (
+	logConsole = "console"
+	logJSON    = "json"
+	logText    = "text"
+)
+
+var (
+	// quietMode prints only errors (--quiet)
+	quietMode bool
+
+	// messageLogger receives the messages instead of the console with
+	// --log-format json or text
+	messageLogger *slog.Logger
+
+	// Message printers, by level
+	successColor = &printer{color: color.New(color.FgGreen, color.Bold), level: slog.LevelInfo}
+	errorColor   = &printer{color: color.New(color.FgRed, color.Bold), level: slog.LevelError}
+	infoColor    = &printer{color: color.New(color.FgCyan), level: slog.LevelInfo}
+	warningColor = &printer{color: color.New(color.FgYellow), level: slog.LevelWarn}
+)
+
+// printer prints the messages of one level: in color on the console, as
+// records of messageLogger, or not at all below errors with --quiet
+type printer struct {
+	color *color.Color
+	level slog.Level
+}
+
+// Printf prints a formatted message
+func (p *printer) Printf(format string, a ...interface{}) {
+	printMessage(color.Output, p.color, p.level, fmt.Sprintf(format, a...))
+}
+
+// Println prints its operands as a message
+func (p *printer) Println(a ...interface{}) {
+	printMessage(color.Output, p.color, p.level, fmt.Sprintln(a...))
+}
+
+// Fprintf prints a formatted message to w on the console
+func (p *printer) Fprintf(w io.Writer, format string, a ...interface{}) {
+	printMessage(w, p.color, p.level, fmt.Sprintf(format, a...))
+}
+
+// setupMessages selects how messages are printed; a structured format also
+// applies to the messages the packages print through the log package
+func setupMessages(format string, quiet bool) error {
+	quietMode = quiet
+	opts := &slog.HandlerOptions{Level: slog.LevelInfo}
+	if quiet {
+		opts.Level = slog.LevelError
+	}
+
+	switch format {
+	case logConsole:
+		messageLogger = nil
+	case logJSON:
+		messageLogger = slog.New(slog.NewJSONHandler(color.Output, opts))
+	case logText:
+		messageLogger = slog.New(slog.NewTextHandler(color.Output, opts))
+	default:
+		return fmt.Errorf("invalid log format %q: use console, json or text", format)
+	}
+	return nil
+}
+
+// printMessage prints a message of a level
+func printMessage(w io.Writer, c *color.Color, level slog.Level, text string) {
+	if messageLogger != nil {
+		messageLogger.Log(context.Background(), level, messageText(text))
+		return
+	}
+	if quietMode && level < slog.LevelError {
+		return
+	}
+	if c != nil {
+		c.Fprint(w, text)
+	} else {
+		io.WriteString(w, text)
+	}
+}
+
+// messageText returns a message without its leading emoji and the blank
+// lines around it
+func messageText(text string) string {
+	text = strings.TrimLeftFunc(text, func(r rune) bool {
+		return unicode.IsSpace(r) || r > unicode.MaxLatin1 && !unicode.Is(unicode.Arabic, r)
+	})
+	return strings.TrimSpace(text)
+}
+
+// messageWriter prints the lines of the log package as messages, at the
+// level their emoji gives
+type messageWriter struct{}
+
+// Write prints a log line
+func (messageWriter) Write(p []byte) (int, error) {
+	text := string(p)
+	level := slog.LevelInfo
+	switch {
+	case strings.HasPrefix(text, "❌"):
+		level = slog.LevelError
+	case strings.HasPrefix(text, "⚠️"):
+		level = slog.LevelWarn
+	}
+	printMessage(color.Output, nil, level, text)
+	return len(p), nil
+}
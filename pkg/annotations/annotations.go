@@ -0,0 +1,227 @@
+package annotations
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	// MaxNoteLength is the maximum length of a note, in characters
+	MaxNoteLength = 2000
+	// MaxTags is the maximum number of tags of an annotation
+	MaxTags = 20
+	// MaxTagLength is the maximum length of a tag, in characters
+	MaxTagLength = 50
+)
+
+// ErrInvalid is returned for annotations that cannot be stored
+var ErrInvalid = errors.New("invalid annotation")
+
+// Annotation is a user note and tags attached to a record
+type Annotation struct {
+	Note      string    `json:"note,omitempty"`
+	Tags      []string  `json:"tags,omitempty"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// file is the on-disk form of a store
+type file struct {
+	Annotations map[string]Annotation `json:"annotations"`
+}
+
+// Store keeps the annotations of one table in a JSON file, keyed by record
+// code. The table itself is never written.
+type Store struct {
+	mu       sync.RWMutex
+	path     string
+	items    map[string]Annotation
+	modified time.Time
+}
+
+// Open loads the annotations stored at path; a missing file gives an empty
+// store, created on the first change
+func Open(path string) (*Store, error) {
+	s := &Store{path: path, items: make(map[string]Annotation)}
+
+	info, err := os.Stat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat annotations: %w", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read annotations: %w", err)
+	}
+	var f file
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("failed to parse annotations: %w", err)
+	}
+	if f.Annotations != nil {
+		s.items = f.Annotations
+	}
+	s.modified = info.ModTime()
+
+	return s, nil
+}
+
+// Path returns the file of the store
+func (s *Store) Path() string {
+	return s.path
+}
+
+// Get returns the annotation of a record
+func (s *Store) Get(code string) (Annotation, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	a, ok := s.items[code]
+	return a, ok
+}
+
+// All returns a copy of the annotations, keyed by record code
+func (s *Store) All() map[string]Annotation {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	all := make(map[string]Annotation, len(s.items))
+	for code, a := range s.items {
+		all[code] = a
+	}
+	return all
+}
+
+// Len returns the number of annotated records
+func (s *Store) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.items)
+}
+
+// Modified returns when the annotations last changed
+func (s *Store) Modified() time.Time {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.modified
+}
+
+// Set validates an annotation and stores it for a record, replacing the
+// previous one. It returns the annotation as stored.
+func (s *Store) Set(code string, a Annotation) (Annotation, error) {
+	if code == "" {
+		return Annotation{}, fmt.Errorf("%w: empty record code", ErrInvalid)
+	}
+	a, err := normalize(a)
+	if err != nil {
+		return Annotation{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	previous, existed := s.items[code]
+	a.UpdatedAt = time.Now().UTC()
+	s.items[code] = a
+	if err := s.save(); err != nil {
+		if existed {
+			s.items[code] = previous
+		} else {
+			delete(s.items, code)
+		}
+		return Annotation{}, err
+	}
+	s.modified = a.UpdatedAt
+
+	return a, nil
+}
+
+// Delete removes the annotation of a record. It reports whether there was one.
+func (s *Store) Delete(code string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	previous, ok := s.items[code]
+	if !ok {
+		return false, nil
+	}
+	delete(s.items, code)
+	if err := s.save(); err != nil {
+		s.items[code] = previous
+		return false, err
+	}
+	s.modified = time.Now().UTC()
+
+	return true, nil
+}
+
+// save writes the annotations to a temporary file and renames it over the
+// store's file, so readers never see a partial file. The caller holds mu.
+func (s *Store) save() error {
+	data, err := json.MarshalIndent(file{Annotations: s.items}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode annotations: %w", err)
+	}
+
+	dir := filepath.Dir(s.path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create annotations directory: %w", err)
+	}
+	tmp, err := os.CreateTemp(dir, filepath.Base(s.path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create annotations file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write annotations: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write annotations: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return fmt.Errorf("failed to replace annotations: %w", err)
+	}
+
+	return nil
+}
+
+// normalize trims the note and tags, drops empty and repeated tags, and
+// checks the limits. An annotation needs a note or a tag.
+func normalize(a Annotation) (Annotation, error) {
+	note := strings.TrimSpace(a.Note)
+	if utf8.RuneCountInString(note) > MaxNoteLength {
+		return Annotation{}, fmt.Errorf("%w: note is longer than %d characters", ErrInvalid, MaxNoteLength)
+	}
+
+	var tags []string
+	seen := make(map[string]bool)
+	for _, tag := range a.Tags {
+		tag = strings.TrimSpace(tag)
+		if tag == "" || seen[tag] {
+			continue
+		}
+		if utf8.RuneCountInString(tag) > MaxTagLength {
+			return Annotation{}, fmt.Errorf("%w: tag %q is longer than %d characters", ErrInvalid, tag, MaxTagLength)
+		}
+		seen[tag] = true
+		tags = append(tags, tag)
+	}
+	if len(tags) > MaxTags {
+		return Annotation{}, fmt.Errorf("%w: more than %d tags", ErrInvalid, MaxTags)
+	}
+
+	if note == "" && len(tags) == 0 {
+		return Annotation{}, fmt.Errorf("%w: a note or a tag is required", ErrInvalid)
+	}
+
+	return Annotation{Note: note, Tags: tags}, nil
+}
@@ -0,0 +1,158 @@
+package annotations
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestOpenMissingFile(t *testing.T) {
+	s, err := Open(filepath.Join(t.TempDir(), "kala.annotations.json"))
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	if s.Len() != 0 {
+		t.Errorf("Expected an empty store, got %d annotations", s.Len())
+	}
+	if !s.Modified().IsZero() {
+		t.Errorf("Expected no modification time, got %v", s.Modified())
+	}
+}
+
+func TestSetPersists(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "notes", "kala.annotations.json")
+
+	s, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	stored, err := s.Set("1001", Annotation{Note: "  needs recount ", Tags: []string{"recount", " recount", "", "shelf-3"}})
+	if err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if stored.Note != "needs recount" {
+		t.Errorf("Expected the note to be trimmed, got %q", stored.Note)
+	}
+	if strings.Join(stored.Tags, ",") != "recount,shelf-3" {
+		t.Errorf("Expected tags recount,shelf-3, got %v", stored.Tags)
+	}
+	if stored.UpdatedAt.IsZero() {
+		t.Error("Expected an update time")
+	}
+
+	reopened, err := Open(path)
+	if err != nil {
+		t.Fatalf("Reopen failed: %v", err)
+	}
+	got, ok := reopened.Get("1001")
+	if !ok {
+		t.Fatal("Expected the annotation to be persisted")
+	}
+	if got.Note != stored.Note || !got.UpdatedAt.Equal(stored.UpdatedAt) {
+		t.Errorf("Expected %+v, got %+v", stored, got)
+	}
+
+	// No temporary files are left behind
+	entries, err := os.ReadDir(filepath.Dir(path))
+	if err != nil {
+		t.Fatalf("Failed to read dir: %v", err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("Expected only the annotations file, got %d entries", len(entries))
+	}
+}
+
+func TestSetReplaces(t *testing.T) {
+	s, err := Open(filepath.Join(t.TempDir(), "kala.annotations.json"))
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	if _, err := s.Set("1001", Annotation{Note: "first", Tags: []string{"recount"}}); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if _, err := s.Set("1001", Annotation{Note: "second"}); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+
+	got, _ := s.Get("1001")
+	if got.Note != "second" || len(got.Tags) != 0 {
+		t.Errorf("Expected the annotation to be replaced, got %+v", got)
+	}
+}
+
+func TestSetInvalid(t *testing.T) {
+	s, err := Open(filepath.Join(t.TempDir(), "kala.annotations.json"))
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+
+	tooManyTags := make([]string, MaxTags+1)
+	for i := range tooManyTags {
+		tooManyTags[i] = strings.Repeat("t", i+1)
+	}
+
+	tests := []struct {
+		name string
+		code string
+		a    Annotation
+	}{
+		{"empty", "1001", Annotation{Note: "  ", Tags: []string{" "}}},
+		{"no code", "", Annotation{Note: "note"}},
+		{"long note", "1001", Annotation{Note: strings.Repeat("ن", MaxNoteLength+1)}},
+		{"long tag", "1001", Annotation{Tags: []string{strings.Repeat("t", MaxTagLength+1)}}},
+		{"too many tags", "1001", Annotation{Tags: tooManyTags}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := s.Set(tt.code, tt.a); !errors.Is(err, ErrInvalid) {
+				t.Errorf("Expected ErrInvalid, got %v", err)
+			}
+		})
+	}
+	if s.Len() != 0 {
+		t.Errorf("Expected nothing to be stored, got %d annotations", s.Len())
+	}
+}
+
+func TestDelete(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "kala.annotations.json")
+	s, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	if _, err := s.Set("1001", Annotation{Tags: []string{"recount"}}); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	before := s.Modified()
+
+	deleted, err := s.Delete("1001")
+	if err != nil || !deleted {
+		t.Fatalf("Expected the annotation to be deleted, got %v, %v", deleted, err)
+	}
+	if s.Modified().Before(before) {
+		t.Error("Expected the modification time to advance")
+	}
+	if deleted, err := s.Delete("1001"); err != nil || deleted {
+		t.Errorf("Expected nothing to delete, got %v, %v", deleted, err)
+	}
+
+	reopened, err := Open(path)
+	if err != nil {
+		t.Fatalf("Reopen failed: %v", err)
+	}
+	if reopened.Len() != 0 {
+		t.Errorf("Expected the deletion to be persisted, got %d annotations", reopened.Len())
+	}
+}
+
+func TestOpenInvalidFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "kala.annotations.json")
+	if err := os.WriteFile(path, []byte("not json"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	if _, err := Open(path); err == nil {
+		t.Error("Expected an error for an invalid file")
+	}
+}
@@ -0,0 +1,175 @@
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Log appends entries as JSON lines to a file that is only ever appended
+// to. Once the file reaches the size limit it is renamed with the time of
+// the rotation (kala.audit-20251213T234519Z.jsonl) and a new file started.
+type Log struct {
+	mu         sync.Mutex
+	path       string
+	maxSize    int64
+	maxBackups int
+	file       *os.File
+	size       int64
+}
+
+// Open opens the log at path, appending to an existing file. maxSize is the
+// size in bytes at which the file is rotated, or 0 to never rotate;
+// maxBackups is the number of rotated files kept, or 0 to keep all.
+func Open(path string, maxSize int64, maxBackups int) (*Log, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create audit log directory: %w", err)
+	}
+	l := &Log{path: path, maxSize: maxSize, maxBackups: maxBackups}
+	if err := l.open(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// open opens the file for appending and reads its size
+func (l *Log) open() error {
+	file, err := os.OpenFile(l.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open audit log: %w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("failed to stat audit log: %w", err)
+	}
+	l.file = file
+	l.size = info.Size()
+	return nil
+}
+
+// Write appends an entry as one JSON line, rotating the file first if the
+// line would take it past the size limit
+func (l *Log) Write(entry interface{}) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to encode audit entry: %w", err)
+	}
+	line = append(line, '\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.file == nil {
+		return fmt.Errorf("audit log is closed")
+	}
+	if l.maxSize > 0 && l.size > 0 && l.size+int64(len(line)) > l.maxSize {
+		if err := l.rotate(); err != nil {
+			return err
+		}
+	}
+
+	n, err := l.file.Write(line)
+	l.size += int64(n)
+	if err != nil {
+		return fmt.Errorf("failed to write audit log: %w", err)
+	}
+	return nil
+}
+
+// rotate renames the file with the current time, starts a new one and
+// removes the oldest rotated files beyond maxBackups. The caller holds mu.
+func (l *Log) rotate() error {
+	if err := l.file.Close(); err != nil {
+		return fmt.Errorf("failed to close audit log: %w", err)
+	}
+	l.file = nil
+
+	rotated := l.rotatedName(time.Now().UTC())
+	if err := os.Rename(l.path, rotated); err != nil {
+		// Keep appending to the current file rather than losing entries
+		if openErr := l.open(); openErr != nil {
+			return openErr
+		}
+		return fmt.Errorf("failed to rotate audit log: %w", err)
+	}
+	if err := l.open(); err != nil {
+		return err
+	}
+	return l.prune()
+}
+
+// rotatedName returns the name for the file rotated at t. A name not
+// after the newest rotated file's (several rotations in one second, or a
+// clock set back) moves on to the next second, so the names keep sorting in
+// rotation order.
+func (l *Log) rotatedName(t time.Time) string {
+	ext := filepath.Ext(l.path)
+	base := strings.TrimSuffix(l.path, ext)
+
+	newest := ""
+	if rotated, err := l.Rotated(); err == nil && len(rotated) > 0 {
+		newest = rotated[len(rotated)-1]
+	}
+	for {
+		name := fmt.Sprintf("%s-%s%s", base, t.Format("20060102T150405Z"), ext)
+		if name > newest {
+			return name
+		}
+		t = t.Add(time.Second)
+	}
+}
+
+// Rotated returns the paths of the rotated files, oldest first
+func (l *Log) Rotated() ([]string, error) {
+	ext := filepath.Ext(l.path)
+	matches, err := filepath.Glob(strings.TrimSuffix(l.path, ext) + "-*" + ext)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list rotated audit logs: %w", err)
+	}
+	// The timestamps sort chronologically
+	sort.Strings(matches)
+	return matches, nil
+}
+
+// prune removes the oldest rotated files beyond maxBackups. The caller
+// holds mu.
+func (l *Log) prune() error {
+	if l.maxBackups <= 0 {
+		return nil
+	}
+	rotated, err := l.Rotated()
+	if err != nil {
+		return err
+	}
+	for len(rotated) > l.maxBackups {
+		if err := os.Remove(rotated[0]); err != nil {
+			return fmt.Errorf("failed to remove old audit log: %w", err)
+		}
+		rotated = rotated[1:]
+	}
+	return nil
+}
+
+// Path returns the path of the current file
+func (l *Log) Path() string {
+	return l.path
+}
+
+// Close closes the file; later writes fail
+func (l *Log) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.file == nil {
+		return nil
+	}
+	err := l.file.Close()
+	l.file = nil
+	return err
+}
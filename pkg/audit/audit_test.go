@@ -0,0 +1,103 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// readLines decodes the JSON lines of a file
+func readLines(t *testing.T, path string) []map[string]interface{} {
+	t.Helper()
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("Failed to open %s: %v", path, err)
+	}
+	defer file.Close()
+
+	var lines []map[string]interface{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var line map[string]interface{}
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			t.Fatalf("Invalid JSON line %q: %v", scanner.Text(), err)
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+func TestWriteAppends(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit", "kala.audit.jsonl")
+
+	l, err := Open(path, 0, 0)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	if err := l.Write(map[string]interface{}{"seq": 1}); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	l.Close()
+
+	// Reopening appends to the existing file
+	l, err = Open(path, 0, 0)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	if err := l.Write(map[string]interface{}{"seq": 2}); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	l.Close()
+
+	lines := readLines(t, path)
+	if len(lines) != 2 || lines[0]["seq"] != 1.0 || lines[1]["seq"] != 2.0 {
+		t.Errorf("Expected seq 1 and 2, got %v", lines)
+	}
+	if err := l.Write(map[string]interface{}{"seq": 3}); err == nil {
+		t.Error("Expected an error writing to a closed log")
+	}
+}
+
+func TestRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "kala.audit.jsonl")
+
+	// Each entry is 10 bytes, so a file holds two
+	l, err := Open(path, 25, 2)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer l.Close()
+
+	for seq := 1; seq <= 9; seq++ {
+		if err := l.Write(map[string]int{"seq": seq}); err != nil {
+			t.Fatalf("Write failed: %v", err)
+		}
+	}
+
+	rotated, err := l.Rotated()
+	if err != nil {
+		t.Fatalf("Rotated failed: %v", err)
+	}
+	if len(rotated) != 2 {
+		t.Fatalf("Expected 2 rotated files kept, got %v", rotated)
+	}
+
+	// The oldest files were removed; the others hold the entries in order
+	var seqs []float64
+	for _, file := range append(rotated, path) {
+		for _, line := range readLines(t, file) {
+			seqs = append(seqs, line["seq"].(float64))
+		}
+	}
+	if len(seqs) != 5 || seqs[0] != 5 || seqs[4] != 9 {
+		t.Errorf("Expected entries 5 to 9, got %v", seqs)
+	}
+	for i := 1; i < len(seqs); i++ {
+		if seqs[i] != seqs[i-1]+1 {
+			t.Errorf("Entries out of order: %v", seqs)
+			break
+		}
+	}
+}
@@ -0,0 +1,260 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Realm is the realm announced in WWW-Authenticate challenges
+const Realm = "patris-export"
+
+// Leeway is the clock skew tolerated when checking token expiry
+const Leeway = time.Minute
+
+var (
+	// ErrMissingCredentials is returned when a request carries no API key or token
+	ErrMissingCredentials = errors.New("missing credentials")
+	// ErrInvalidAPIKey is returned when an API key is not accepted
+	ErrInvalidAPIKey = errors.New("invalid API key")
+	// ErrInvalidToken is returned when a JWT is malformed, has a bad signature
+	// or fails a claim check
+	ErrInvalidToken = errors.New("invalid token")
+)
+
+// Config configures an Authenticator. A request is accepted if it carries one
+// of the API keys or a JWT signed with the secret (HS256) or the public key
+// (EdDSA).
+type Config struct {
+	APIKeys []string
+	// JWTSecret validates HS256 tokens
+	JWTSecret []byte
+	// JWTPublicKey validates EdDSA (ed25519) tokens
+	JWTPublicKey ed25519.PublicKey
+	// Issuer and Audience, if set, must match the token's iss and aud claims
+	Issuer   string
+	Audience string
+}
+
+// Authenticator checks the credentials of HTTP requests
+type Authenticator struct {
+	config Config
+	now    func() time.Time
+}
+
+// Claims are the registered JWT claims checked by the Authenticator
+type Claims struct {
+	Subject   string   `json:"sub,omitempty"`
+	Issuer    string   `json:"iss,omitempty"`
+	Audience  audience `json:"aud,omitempty"`
+	ExpiresAt int64    `json:"exp,omitempty"`
+	NotBefore int64    `json:"nbf,omitempty"`
+}
+
+// audience is the aud claim, which is a string or a list of strings
+type audience []string
+
+// UnmarshalJSON accepts a single audience or a list
+func (a *audience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = audience{single}
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return fmt.Errorf("aud must be a string or a list of strings")
+	}
+	*a = list
+	return nil
+}
+
+// New creates an Authenticator; at least one API key, secret or public key
+// must be configured
+func New(config Config) (*Authenticator, error) {
+	keys := config.APIKeys[:0:0]
+	for _, key := range config.APIKeys {
+		if key = strings.TrimSpace(key); key != "" {
+			keys = append(keys, key)
+		}
+	}
+	config.APIKeys = keys
+
+	if len(config.APIKeys) == 0 && len(config.JWTSecret) == 0 && config.JWTPublicKey == nil {
+		return nil, fmt.Errorf("no API keys or JWT keys configured")
+	}
+
+	return &Authenticator{config: config, now: time.Now}, nil
+}
+
+// Authenticate checks a request's credentials. They are read from the
+// Authorization header (Bearer), the X-API-Key header, or the api_key and
+// access_token query parameters, which browsers need for WebSocket
+// connections. A bearer value with three dot-separated parts is validated
+// as a JWT, anything else as an API key.
+func (a *Authenticator) Authenticate(r *http.Request) error {
+	return a.AuthenticateCredential(credentials(r))
+}
+
+// AuthenticateCredential checks an API key or JWT taken from elsewhere than
+// an HTTP request, such as gRPC metadata
+func (a *Authenticator) AuthenticateCredential(credential string) error {
+	if credential == "" {
+		return ErrMissingCredentials
+	}
+
+	if strings.Count(credential, ".") == 2 && (len(a.config.JWTSecret) > 0 || a.config.JWTPublicKey != nil) {
+		_, err := a.ValidateToken(credential)
+		return err
+	}
+
+	if !a.validKey(credential) {
+		return ErrInvalidAPIKey
+	}
+	return nil
+}
+
+// credentials extracts the API key or token of a request
+func credentials(r *http.Request) string {
+	if header := r.Header.Get("Authorization"); header != "" {
+		scheme, value, _ := strings.Cut(header, " ")
+		if strings.EqualFold(scheme, "Bearer") {
+			return strings.TrimSpace(value)
+		}
+	}
+	if key := r.Header.Get("X-API-Key"); key != "" {
+		return strings.TrimSpace(key)
+	}
+
+	query := r.URL.Query()
+	if key := query.Get("api_key"); key != "" {
+		return key
+	}
+	return query.Get("access_token")
+}
+
+// validKey compares a key with every configured key in constant time
+func (a *Authenticator) validKey(key string) bool {
+	valid := 0
+	for _, candidate := range a.config.APIKeys {
+		valid |= subtle.ConstantTimeCompare([]byte(key), []byte(candidate))
+	}
+	return valid == 1
+}
+
+// ValidateToken checks a JWT's signature and its exp, nbf, iss and aud
+// claims, and returns its claims. Only HS256 and EdDSA tokens are accepted.
+func (a *Authenticator) ValidateToken(token string) (*Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("%w: malformed token", ErrInvalidToken)
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("%w: bad header: %v", ErrInvalidToken, err)
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("%w: bad signature encoding", ErrInvalidToken)
+	}
+	signed := []byte(parts[0] + "." + parts[1])
+
+	switch header.Alg {
+	case "HS256":
+		if len(a.config.JWTSecret) == 0 {
+			return nil, fmt.Errorf("%w: HS256 tokens are not accepted", ErrInvalidToken)
+		}
+		mac := hmac.New(sha256.New, a.config.JWTSecret)
+		mac.Write(signed)
+		if !hmac.Equal(signature, mac.Sum(nil)) {
+			return nil, fmt.Errorf("%w: signature mismatch", ErrInvalidToken)
+		}
+	case "EdDSA":
+		if a.config.JWTPublicKey == nil {
+			return nil, fmt.Errorf("%w: EdDSA tokens are not accepted", ErrInvalidToken)
+		}
+		if !ed25519.Verify(a.config.JWTPublicKey, signed, signature) {
+			return nil, fmt.Errorf("%w: signature mismatch", ErrInvalidToken)
+		}
+	default:
+		return nil, fmt.Errorf("%w: unsupported algorithm %q", ErrInvalidToken, header.Alg)
+	}
+
+	var claims Claims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("%w: bad claims: %v", ErrInvalidToken, err)
+	}
+	if err := a.checkClaims(&claims); err != nil {
+		return nil, err
+	}
+
+	return &claims, nil
+}
+
+// checkClaims checks the time and identity claims of a validly signed token
+func (a *Authenticator) checkClaims(claims *Claims) error {
+	now := a.now()
+	if claims.ExpiresAt != 0 && now.After(time.Unix(claims.ExpiresAt, 0).Add(Leeway)) {
+		return fmt.Errorf("%w: token expired", ErrInvalidToken)
+	}
+	if claims.NotBefore != 0 && now.Add(Leeway).Before(time.Unix(claims.NotBefore, 0)) {
+		return fmt.Errorf("%w: token not valid yet", ErrInvalidToken)
+	}
+	if a.config.Issuer != "" && claims.Issuer != a.config.Issuer {
+		return fmt.Errorf("%w: unexpected issuer %q", ErrInvalidToken, claims.Issuer)
+	}
+	if a.config.Audience != "" {
+		for _, aud := range claims.Audience {
+			if aud == a.config.Audience {
+				return nil
+			}
+		}
+		return fmt.Errorf("%w: token is not for audience %q", ErrInvalidToken, a.config.Audience)
+	}
+	return nil
+}
+
+// decodeSegment decodes a base64url JSON segment of a token
+func decodeSegment(segment string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// Middleware rejects requests without valid credentials with 401
+// Unauthorized. Paths listed in public are served without credentials.
+func (a *Authenticator) Middleware(public ...string) func(http.Handler) http.Handler {
+	open := make(map[string]bool, len(public))
+	for _, path := range public {
+		open[path] = true
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if open[r.URL.Path] || r.Method == http.MethodOptions {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if err := a.Authenticate(r); err != nil {
+				w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm=%q`, Realm))
+				http.Error(w, fmt.Sprintf("Unauthorized: %v", err), http.StatusUnauthorized)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
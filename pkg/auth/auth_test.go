@@ -0,0 +1,207 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+var testSecret = []byte("shop-secret")
+
+// makeToken builds a JWT with the given algorithm and claims
+func makeToken(t *testing.T, alg string, claims map[string]interface{}, sign func([]byte) []byte) string {
+	t.Helper()
+
+	header, _ := json.Marshal(map[string]string{"alg": alg, "typ": "JWT"})
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatalf("Failed to encode claims: %v", err)
+	}
+
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sign([]byte(signed)))
+}
+
+func hs256(data []byte) []byte {
+	mac := hmac.New(sha256.New, testSecret)
+	mac.Write(data)
+	return mac.Sum(nil)
+}
+
+func request(header, value, query string) *http.Request {
+	r := httptest.NewRequest("GET", "/api/records"+query, nil)
+	if header != "" {
+		r.Header.Set(header, value)
+	}
+	return r
+}
+
+func TestNew_RequiresCredentials(t *testing.T) {
+	if _, err := New(Config{APIKeys: []string{"", "  "}}); err == nil {
+		t.Error("Expected error without API keys or JWT keys")
+	}
+}
+
+func TestAuthenticate_APIKey(t *testing.T) {
+	a, err := New(Config{APIKeys: []string{"key-1", "key-2"}})
+	if err != nil {
+		t.Fatalf("Failed to create authenticator: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		r    *http.Request
+		want error
+	}{
+		{"bearer", request("Authorization", "Bearer key-2", ""), nil},
+		{"header", request("X-API-Key", "key-1", ""), nil},
+		{"query", request("", "", "?api_key=key-1"), nil},
+		{"wrong key", request("X-API-Key", "key-3", ""), ErrInvalidAPIKey},
+		{"basic scheme", request("Authorization", "Basic a2V5LTE=", ""), ErrMissingCredentials},
+		{"missing", request("", "", ""), ErrMissingCredentials},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := a.Authenticate(tt.r)
+			if !errors.Is(err, tt.want) {
+				t.Errorf("Authenticate() = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestAuthenticateCredential(t *testing.T) {
+	a, err := New(Config{APIKeys: []string{"key-1"}, JWTSecret: []byte("secret")})
+	if err != nil {
+		t.Fatalf("Failed to create authenticator: %v", err)
+	}
+
+	if err := a.AuthenticateCredential("key-1"); err != nil {
+		t.Errorf("AuthenticateCredential(key) = %v, want nil", err)
+	}
+	if err := a.AuthenticateCredential(""); !errors.Is(err, ErrMissingCredentials) {
+		t.Errorf("AuthenticateCredential(\"\") = %v, want %v", err, ErrMissingCredentials)
+	}
+	if err := a.AuthenticateCredential("a.b.c"); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("AuthenticateCredential(bad token) = %v, want %v", err, ErrInvalidToken)
+	}
+}
+
+func TestValidateToken_HS256(t *testing.T) {
+	a, err := New(Config{JWTSecret: testSecret, Issuer: "pos", Audience: "patris-export"})
+	if err != nil {
+		t.Fatalf("Failed to create authenticator: %v", err)
+	}
+	now := time.Unix(1700000000, 0)
+	a.now = func() time.Time { return now }
+
+	valid := map[string]interface{}{"sub": "till-1", "iss": "pos", "aud": "patris-export", "exp": now.Add(time.Hour).Unix()}
+	claims, err := a.ValidateToken(makeToken(t, "HS256", valid, hs256))
+	if err != nil {
+		t.Fatalf("Expected valid token, got: %v", err)
+	}
+	if claims.Subject != "till-1" {
+		t.Errorf("Expected subject till-1, got %q", claims.Subject)
+	}
+
+	tests := []struct {
+		name   string
+		claims map[string]interface{}
+		alg    string
+		sign   func([]byte) []byte
+	}{
+		{"expired", map[string]interface{}{"iss": "pos", "aud": "patris-export", "exp": now.Add(-2 * Leeway).Unix()}, "HS256", hs256},
+		{"not yet valid", map[string]interface{}{"iss": "pos", "aud": "patris-export", "nbf": now.Add(2 * Leeway).Unix()}, "HS256", hs256},
+		{"wrong issuer", map[string]interface{}{"iss": "other", "aud": "patris-export"}, "HS256", hs256},
+		{"wrong audience", map[string]interface{}{"iss": "pos", "aud": []string{"other"}}, "HS256", hs256},
+		{"bad signature", valid, "HS256", func([]byte) []byte { return []byte("forged") }},
+		{"alg none", valid, "none", func([]byte) []byte { return nil }},
+		{"eddsa not configured", valid, "EdDSA", hs256},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := a.ValidateToken(makeToken(t, tt.alg, tt.claims, tt.sign))
+			if !errors.Is(err, ErrInvalidToken) {
+				t.Errorf("Expected ErrInvalidToken, got %v", err)
+			}
+		})
+	}
+
+	// Expiry within the leeway is tolerated
+	skewed := map[string]interface{}{"iss": "pos", "aud": []string{"x", "patris-export"}, "exp": now.Add(-Leeway / 2).Unix()}
+	if _, err := a.ValidateToken(makeToken(t, "HS256", skewed, hs256)); err != nil {
+		t.Errorf("Expected token within leeway to be valid, got: %v", err)
+	}
+}
+
+func TestValidateToken_EdDSA(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+
+	a, err := New(Config{JWTPublicKey: pub})
+	if err != nil {
+		t.Fatalf("Failed to create authenticator: %v", err)
+	}
+
+	sign := func(data []byte) []byte { return ed25519.Sign(priv, data) }
+	token := makeToken(t, "EdDSA", map[string]interface{}{"sub": "dashboard"}, sign)
+
+	r := request("Authorization", "Bearer "+token, "")
+	if err := a.Authenticate(r); err != nil {
+		t.Errorf("Expected valid EdDSA token, got: %v", err)
+	}
+
+	// An HS256 token is rejected when no secret is configured
+	if _, err := a.ValidateToken(makeToken(t, "HS256", map[string]interface{}{}, hs256)); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Expected ErrInvalidToken for HS256 token, got %v", err)
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	a, err := New(Config{APIKeys: []string{"key-1"}, JWTSecret: testSecret})
+	if err != nil {
+		t.Fatalf("Failed to create authenticator: %v", err)
+	}
+
+	handler := a.Middleware("/")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	token := makeToken(t, "HS256", map[string]interface{}{"sub": "ws"}, hs256)
+	tests := []struct {
+		name string
+		r    *http.Request
+		want int
+	}{
+		{"public path", httptest.NewRequest("GET", "/", nil), http.StatusOK},
+		{"no credentials", httptest.NewRequest("GET", "/api/records", nil), http.StatusUnauthorized},
+		{"api key", request("X-API-Key", "key-1", ""), http.StatusOK},
+		{"token in query", httptest.NewRequest("GET", "/ws?access_token="+token, nil), http.StatusOK},
+		{"bad token", request("Authorization", "Bearer a.b.c", ""), http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, tt.r)
+			if rec.Code != tt.want {
+				t.Errorf("Expected status %d, got %d", tt.want, rec.Code)
+			}
+			if rec.Code == http.StatusUnauthorized && rec.Header().Get("WWW-Authenticate") == "" {
+				t.Error("Expected WWW-Authenticate challenge")
+			}
+		})
+	}
+}
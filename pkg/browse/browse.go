@@ -0,0 +1,285 @@
+package browse
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+)
+
+// Options configure a browser
+type Options struct {
+	// Title names the table in the status bar
+	Title string
+	// Key is the column identifying records: the selection stays on the
+	// same record when the rows are replaced
+	Key string
+	// TerminalBidi leaves right-to-left text to a terminal that reorders it
+	// itself (e.g. Konsole, mlterm) instead of drawing it in visual order
+	TerminalBidi bool
+	// Reload, when set, is called in its own goroutine when r is pressed
+	Reload func()
+}
+
+// Browser is a terminal UI showing the records of a table: a search box
+// filtering them, a table of the matching records and the fields of the
+// selected record
+type Browser struct {
+	opts   Options
+	app    *tview.Application
+	search *tview.InputField
+	table  *tview.Table
+	detail *tview.TextView
+	status *tview.TextView
+
+	// The fields below are used on the UI goroutine only, once Run started
+	columns []string
+	rows    [][]string
+	// visible are the indexes of the rows matching the search
+	visible []int
+	query   string
+	updated time.Time
+	err     error
+
+	// mu guards the rows given before Run
+	mu      sync.Mutex
+	running bool
+}
+
+// New creates a browser; its rows are given by SetRows
+func New(opts Options) *Browser {
+	b := &Browser{
+		opts:   opts,
+		app:    tview.NewApplication(),
+		search: tview.NewInputField(),
+		table:  tview.NewTable(),
+		detail: tview.NewTextView(),
+		status: tview.NewTextView(),
+	}
+
+	b.search.SetLabel("🔎 ").
+		SetPlaceholder("Search all fields (/ to focus, Esc to clear)").
+		SetFieldBackgroundColor(tcell.ColorDefault).
+		SetChangedFunc(func(text string) {
+			b.query = fold(strings.TrimSpace(text))
+			b.render(b.selectedKey())
+		}).
+		SetDoneFunc(func(key tcell.Key) {
+			if key == tcell.KeyEscape {
+				b.search.SetText("")
+			}
+			b.app.SetFocus(b.table)
+		})
+
+	b.table.SetFixed(1, 0).
+		SetSelectable(true, false).
+		SetSelectionChangedFunc(func(row, column int) { b.showDetail() })
+	b.table.SetBorder(true)
+
+	b.detail.SetWrap(true).SetTitle(" Record ").SetBorder(true)
+	b.status.SetTextColor(tcell.ColorYellow)
+
+	body := tview.NewFlex().
+		AddItem(b.table, 0, 2, true).
+		AddItem(b.detail, 0, 1, false)
+	root := tview.NewFlex().SetDirection(tview.FlexRow).
+		AddItem(b.search, 1, 0, false).
+		AddItem(body, 0, 1, true).
+		AddItem(b.status, 1, 0, false)
+	b.app.SetRoot(root, true).SetFocus(b.table)
+	b.app.SetInputCapture(b.handleKey)
+	return b
+}
+
+// handleKey handles the keys of the browser outside the search box: / to
+// search, Tab to switch between the records and the record, r to reload
+// and q to quit
+func (b *Browser) handleKey(event *tcell.EventKey) *tcell.EventKey {
+	if b.app.GetFocus() == b.search {
+		return event
+	}
+	switch {
+	case event.Key() == tcell.KeyRune && event.Rune() == '/':
+		b.app.SetFocus(b.search)
+		return nil
+	case event.Key() == tcell.KeyRune && event.Rune() == 'q':
+		b.app.Stop()
+		return nil
+	case event.Key() == tcell.KeyRune && event.Rune() == 'r' && b.opts.Reload != nil:
+		go b.opts.Reload()
+		return nil
+	case event.Key() == tcell.KeyTab:
+		if b.app.GetFocus() == b.detail {
+			b.app.SetFocus(b.table)
+		} else {
+			b.app.SetFocus(b.detail)
+		}
+		return nil
+	}
+	return event
+}
+
+// SetRows replaces the records shown; it may be called from any goroutine
+func (b *Browser) SetRows(columns []string, rows [][]string) {
+	b.update(func() {
+		selected := b.selectedKey()
+		b.columns, b.rows, b.err = columns, rows, nil
+		b.updated = time.Now()
+		b.render(selected)
+	})
+}
+
+// SetError shows an error, such as a failed reload, keeping the records
+// shown; it may be called from any goroutine
+func (b *Browser) SetError(err error) {
+	b.update(func() {
+		b.err = err
+		b.showStatus()
+	})
+}
+
+// update runs f on the UI goroutine, or at once before Run
+func (b *Browser) update(f func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.running {
+		f()
+		return
+	}
+	b.app.QueueUpdateDraw(f)
+}
+
+// Run shows the browser until q or Ctrl+C is pressed or Stop is called
+func (b *Browser) Run() error {
+	b.mu.Lock()
+	b.running = true
+	b.mu.Unlock()
+	return b.app.Run()
+}
+
+// Stop closes the browser
+func (b *Browser) Stop() {
+	b.app.Stop()
+}
+
+// text returns a value as drawn: in visual order unless the terminal
+// reorders it
+func (b *Browser) text(value string) string {
+	if !b.opts.TerminalBidi {
+		value = Visual(value)
+	}
+	return tview.Escape(value)
+}
+
+// render fills the table with the rows matching the search, selecting the
+// record with the key selected
+func (b *Browser) render(selected string) {
+	b.visible = b.visible[:0]
+	for i, row := range b.rows {
+		if matches(row, b.query) {
+			b.visible = append(b.visible, i)
+		}
+	}
+
+	b.table.Clear()
+	for column, name := range b.columns {
+		b.table.SetCell(0, column, tview.NewTableCell(tview.Escape(name)).
+			SetSelectable(false).
+			SetAttributes(tcell.AttrBold).
+			SetTextColor(tcell.ColorAqua))
+	}
+	selectRow := 1
+	for i, index := range b.visible {
+		row := b.rows[index]
+		for column := range b.columns {
+			value := ""
+			if column < len(row) {
+				value = row[column]
+			}
+			cell := tview.NewTableCell(b.text(value)).SetMaxWidth(40)
+			if RTL(value) {
+				cell.SetAlign(tview.AlignRight)
+			}
+			b.table.SetCell(i+1, column, cell)
+		}
+		if selected != "" && b.key(row) == selected {
+			selectRow = i + 1
+		}
+	}
+	b.table.Select(selectRow, 0)
+	b.showDetail()
+	b.showStatus()
+}
+
+// keyColumn returns the index of the key column, or -1
+func (b *Browser) keyColumn() int {
+	for i, column := range b.columns {
+		if column == b.opts.Key {
+			return i
+		}
+	}
+	return -1
+}
+
+// key returns the key of a row, or the whole row without a key column
+func (b *Browser) key(row []string) string {
+	if column := b.keyColumn(); column >= 0 && column < len(row) {
+		return row[column]
+	}
+	return strings.Join(row, "\x00")
+}
+
+// selected returns the selected row, or nil
+func (b *Browser) selected() []string {
+	row, _ := b.table.GetSelection()
+	if row < 1 || row > len(b.visible) {
+		return nil
+	}
+	return b.rows[b.visible[row-1]]
+}
+
+// selectedKey returns the key of the selected row, or ""
+func (b *Browser) selectedKey() string {
+	if row := b.selected(); row != nil {
+		return b.key(row)
+	}
+	return ""
+}
+
+// showDetail shows the fields of the selected record
+func (b *Browser) showDetail() {
+	row := b.selected()
+	if row == nil {
+		b.detail.SetText("")
+		return
+	}
+	var text strings.Builder
+	for i, column := range b.columns {
+		value := ""
+		if i < len(row) {
+			value = row[i]
+		}
+		fmt.Fprintf(&text, "[::b]%s[::-]\n%s\n\n", tview.Escape(column), b.text(value))
+	}
+	b.detail.SetDynamicColors(true).SetText(text.String()).ScrollToBeginning()
+}
+
+// showStatus shows the table, the number of records matching the search,
+// the last update and the last error
+func (b *Browser) showStatus() {
+	status := fmt.Sprintf(" %s: %d of %d records", b.opts.Title, len(b.visible), len(b.rows))
+	if !b.updated.IsZero() {
+		status += " · updated " + b.updated.Format("15:04:05")
+	}
+	if b.err != nil {
+		status += " · ⚠ " + b.err.Error()
+	}
+	status += " · / search · Tab record · q quit"
+	if b.opts.Reload != nil {
+		status += " · r reload"
+	}
+	b.status.SetText(tview.Escape(status))
+}
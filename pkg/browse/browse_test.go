@@ -0,0 +1,75 @@
+package browse
+
+import "testing"
+
+func TestVisual(t *testing.T) {
+	for text, expected := range map[string]string{
+		"Resistor 10k":     "Resistor 10k",
+		"کالا":             "الاک",
+		"کالا 12":          "12 الاک",
+		"قیمت 1,500 ریال":  "لایر 1,500 تمیق",
+		"آی سی (LM317)":    "(LM317) یس یآ",
+		"تاریخ 1403/01/15": "1403/01/15 خیرات",
+		"Code: کد":         "Code: دک",
+		"IC آی سی":         "IC یس یآ",
+		"":                 "",
+	} {
+		if got := Visual(text); got != expected {
+			t.Errorf("Visual(%q) = %q, want %q", text, got, expected)
+		}
+	}
+}
+
+func TestRTL(t *testing.T) {
+	for text, expected := range map[string]bool{
+		"کالا":     true,
+		"12 کالا":  true,
+		"LM317 آی": false,
+		"1500":     false,
+	} {
+		if got := RTL(text); got != expected {
+			t.Errorf("RTL(%q) = %v, want %v", text, got, expected)
+		}
+	}
+}
+
+func TestMatches(t *testing.T) {
+	row := []string{"101", "كيبورد", "۱۵۰۰"}
+	for query, expected := range map[string]bool{
+		"":        true,
+		"101":     true,
+		"کیبورد":  true,
+		"1500":    true,
+		"mouse":   false,
+		"کی‌بورد": true,
+	} {
+		if got := matches(row, fold(query)); got != expected {
+			t.Errorf("matches(%q) = %v, want %v", query, got, expected)
+		}
+	}
+}
+
+func TestBrowserRows(t *testing.T) {
+	b := New(Options{Title: "kala.db", Key: "Code"})
+	columns := []string{"Code", "Name"}
+	b.SetRows(columns, [][]string{{"101", "آی سی"}, {"102", "سنسور"}, {"103", "Resistor"}})
+	if len(b.visible) != 3 {
+		t.Fatalf("Expected all rows visible, got %v", b.visible)
+	}
+
+	b.search.SetText("سنسور")
+	if len(b.visible) != 1 || b.selectedKey() != "102" {
+		t.Errorf("Expected only 102 found and selected, got %v, %q", b.visible, b.selectedKey())
+	}
+	b.search.SetText("")
+	b.table.Select(2, 0)
+
+	// The selection stays on its record when the rows are replaced
+	b.SetRows(columns, [][]string{{"100", "خازن"}, {"101", "آی سی"}, {"102", "سنسور"}})
+	if key := b.selectedKey(); key != "102" {
+		t.Errorf("Expected 102 still selected, got %q", key)
+	}
+	if text := b.status.GetText(true); text == "" || b.err != nil {
+		t.Errorf("Unexpected status %q, %v", text, b.err)
+	}
+}
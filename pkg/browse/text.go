@@ -0,0 +1,209 @@
+package browse
+
+import (
+	"strings"
+	"unicode"
+)
+
+// class is the direction of a character as Visual resolves it
+type class int
+
+const (
+	neutral class = iota
+	ltr
+	rtl
+	number
+)
+
+// classify returns the direction class of a character: Arabic and Hebrew
+// letters and marks are right-to-left, digits of any script are numbers
+func classify(r rune) class {
+	switch {
+	case unicode.IsDigit(r):
+		return number
+	case unicode.In(r, unicode.Arabic, unicode.Hebrew) && (unicode.IsLetter(r) || unicode.IsMark(r)):
+		return rtl
+	case unicode.IsLetter(r):
+		return ltr
+	}
+	return neutral
+}
+
+// numberSeparators join the digits on both of their sides into one number
+// (1,500, 12.5, 1403/01/15); numberSuffixes belong to a number next to them
+const (
+	numberSeparators = ",.:/-+٫٬"
+	numberSuffixes   = "%٪"
+)
+
+// mirrors are the brackets drawn mirrored in right-to-left text
+var mirrors = map[rune]rune{'(': ')', ')': '(', '[': ']', ']': '[', '{': '}', '}': '{', '<': '>', '>': '<', '«': '»', '»': '«'}
+
+// RTL reports whether text is right-to-left: whether its first letter is
+// Arabic or Hebrew
+func RTL(text string) bool {
+	for _, r := range text {
+		switch classify(r) {
+		case rtl:
+			return true
+		case ltr:
+			return false
+		}
+	}
+	return false
+}
+
+// Visual returns a line of text in the order a terminal without
+// bidirectional support must draw it from left to right to read correctly:
+// right-to-left runs are reversed, keeping numbers and Latin words inside
+// them in order, and their brackets are mirrored. It follows the Unicode
+// bidirectional algorithm for the text of Patris tables, without explicit
+// embeddings.
+func Visual(text string) string {
+	runes := []rune(text)
+	classes := make([]class, len(runes))
+	hasRTL := false
+	for i, r := range runes {
+		classes[i] = classify(r)
+		hasRTL = hasRTL || classes[i] == rtl
+	}
+	if !hasRTL {
+		return text
+	}
+
+	// Separators between digits and suffixes next to them are part of the
+	// number
+	for i, r := range runes {
+		if classes[i] != neutral {
+			continue
+		}
+		between := i > 0 && i < len(runes)-1 && classes[i-1] == number && classes[i+1] == number
+		if between && strings.ContainsRune(numberSeparators, r) ||
+			strings.ContainsRune(numberSuffixes, r) && (i > 0 && classes[i-1] == number || i < len(runes)-1 && classes[i+1] == number) {
+			classes[i] = number
+		}
+	}
+
+	base := 0
+	if RTL(text) {
+		base = 1
+	}
+	levels := make([]int, len(runes))
+	// direction of the last strong character, numbers counting as
+	// right-to-left
+	previous := class(ltr)
+	if base == 1 {
+		previous = rtl
+	}
+	for i := 0; i < len(runes); i++ {
+		switch classes[i] {
+		case rtl:
+			levels[i] = 1
+			previous = rtl
+		case ltr:
+			levels[i] = 2 * base
+			previous = ltr
+		case number:
+			// Numbers read left to right; after Latin text in left-to-right
+			// text they are part of it
+			if base == 0 && previous == ltr {
+				levels[i] = 0
+			} else {
+				levels[i] = 2
+				previous = rtl
+			}
+		default:
+			// Neutrals between characters of the same direction take it,
+			// others the direction of the text
+			end := i
+			for end < len(runes) && classes[end] == neutral {
+				end++
+			}
+			next := class(ltr)
+			if base == 1 {
+				next = rtl
+			}
+			if end < len(runes) {
+				next = classes[end]
+				if next == number {
+					next = rtl
+					if base == 0 && previous == ltr {
+						next = ltr
+					}
+				}
+			}
+			level := base
+			if previous == next {
+				level = 0
+				if next == rtl {
+					level = 1
+				} else if base == 1 {
+					level = 2
+				}
+			}
+			for ; i < end; i++ {
+				levels[i] = level
+			}
+			i--
+		}
+	}
+
+	// Reverse the runs at each level, from the highest to the lowest odd
+	// one
+	highest := 0
+	for _, level := range levels {
+		if level > highest {
+			highest = level
+		}
+	}
+	for level := highest; level >= 1; level-- {
+		for i := 0; i < len(runes); {
+			if levels[i] < level {
+				i++
+				continue
+			}
+			end := i
+			for end < len(runes) && levels[end] >= level {
+				end++
+			}
+			for a, b := i, end-1; a < b; a, b = a+1, b-1 {
+				runes[a], runes[b] = runes[b], runes[a]
+				levels[a], levels[b] = levels[b], levels[a]
+			}
+			i = end
+		}
+	}
+	for i, r := range runes {
+		if mirrored, ok := mirrors[r]; ok && levels[i]%2 == 1 {
+			runes[i] = mirrored
+		}
+	}
+	return string(runes)
+}
+
+// foldReplacer folds the Arabic forms of Persian letters and the Persian
+// and Arabic digits a search may be typed with
+var foldReplacer = strings.NewReplacer(
+	"ي", "ی", "ى", "ی", "ك", "ک", "‌", "",
+	"۰", "0", "۱", "1", "۲", "2", "۳", "3", "۴", "4", "۵", "5", "۶", "6", "۷", "7", "۸", "8", "۹", "9",
+	"٠", "0", "١", "1", "٢", "2", "٣", "3", "٤", "4", "٥", "5", "٦", "6", "٧", "7", "٨", "8", "٩", "9",
+)
+
+// fold returns text as searches compare it: lower case, with Arabic yeh
+// and kaf as the Persian letters, without half-spaces and with Latin digits
+func fold(text string) string {
+	return foldReplacer.Replace(strings.ToLower(text))
+}
+
+// matches reports whether any value of a row contains a folded query
+func matches(row []string, query string) bool {
+	if query == "" {
+		return true
+	}
+	for _, value := range row {
+		if strings.Contains(fold(value), query) {
+			return true
+		}
+	}
+	return false
+}
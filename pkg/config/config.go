@@ -0,0 +1,160 @@
+package config
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/atomicdeploy/patris-export/pkg/resilient"
+	"gopkg.in/yaml.v3"
+)
+
+// EnvPrefix starts the names of the environment variables overriding flags
+const EnvPrefix = "PATRIS_"
+
+// File is a settings file giving the flags of patris-export's commands, so
+// a deployment keeps them in one file instead of on its command line. Keys
+// at the top level are flags of any command; a table named after a command
+// gives flags of that command only, taking precedence:
+//
+//	charmap: farsi_chars.txt
+//	output: C:\exports
+//	serve:
+//	  addr: ":8080"
+//	  watch: true
+//
+// Values are strings, numbers, booleans or lists of them for repeatable
+// flags; durations are given as strings ("500ms").
+type File struct {
+	// Path is the file the settings were read from
+	Path string
+
+	flags    map[string][]string
+	commands map[string]map[string][]string
+}
+
+// Load reads a YAML (.yaml, .yml or .json) or TOML (.toml) settings file
+func Load(path string) (*File, error) {
+	data, err := resilient.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config: %w", err)
+	}
+
+	var raw map[string]interface{}
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml", ".json":
+		err = yaml.Unmarshal(data, &raw)
+	case ".toml":
+		err = toml.Unmarshal(data, &raw)
+	default:
+		return nil, fmt.Errorf("unsupported config format %q (use .yaml, .yml, .json or .toml)", ext)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse config %s: %w", path, err)
+	}
+
+	f := &File{
+		Path:     path,
+		flags:    make(map[string][]string),
+		commands: make(map[string]map[string][]string),
+	}
+	for key, value := range raw {
+		if section, ok := value.(map[string]interface{}); ok {
+			flags := make(map[string][]string, len(section))
+			for name, value := range section {
+				values, err := flagValues(value)
+				if err != nil {
+					return nil, fmt.Errorf("config %s: %s.%s: %w", path, key, name, err)
+				}
+				flags[name] = values
+			}
+			f.commands[key] = flags
+			continue
+		}
+		values, err := flagValues(value)
+		if err != nil {
+			return nil, fmt.Errorf("config %s: %s: %w", path, key, err)
+		}
+		f.flags[key] = values
+	}
+	return f, nil
+}
+
+// flagValues converts a value of the file to the values of a flag
+func flagValues(value interface{}) ([]string, error) {
+	list, ok := value.([]interface{})
+	if !ok {
+		list = []interface{}{value}
+	}
+
+	values := make([]string, 0, len(list))
+	for _, item := range list {
+		switch v := item.(type) {
+		case string:
+			values = append(values, v)
+		case bool:
+			values = append(values, strconv.FormatBool(v))
+		case int:
+			values = append(values, strconv.Itoa(v))
+		case int64:
+			values = append(values, strconv.FormatInt(v, 10))
+		case float64:
+			values = append(values, strconv.FormatFloat(v, 'f', -1, 64))
+		case time.Duration:
+			values = append(values, v.String())
+		case nil:
+			values = append(values, "")
+		default:
+			return nil, fmt.Errorf("unsupported value %v", item)
+		}
+	}
+	return values, nil
+}
+
+// Values returns the flag values the file gives a command: its table's
+// values over the top-level ones
+func (f *File) Values(command string) map[string][]string {
+	values := make(map[string][]string, len(f.flags))
+	for name, value := range f.flags {
+		values[name] = value
+	}
+	for name, value := range f.commands[command] {
+		values[name] = value
+	}
+	return values
+}
+
+// Commands returns the names of the command tables in sorted order
+func (f *File) Commands() []string {
+	names := make([]string, 0, len(f.commands))
+	for name := range f.commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Flags returns the names of the flags in a command's table, or at the top
+// level for an empty command, in sorted order
+func (f *File) Flags(command string) []string {
+	flags := f.flags
+	if command != "" {
+		flags = f.commands[command]
+	}
+	names := make([]string, 0, len(flags))
+	for name := range flags {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// EnvName returns the environment variable overriding a flag: the flag
+// name in upper case with '-' as '_' after EnvPrefix (PATRIS_IO_RETRIES)
+func EnvName(flag string) string {
+	return EnvPrefix + strings.ToUpper(strings.ReplaceAll(flag, "-", "_"))
+}
@@ -0,0 +1,99 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"settings.yaml": "charmap: farsi_chars.txt\n" +
+			"io-retries: 5\n" +
+			"encrypt-fields: [KHARYD, FOROSH]\n" +
+			"serve:\n" +
+			"  addr: \":9090\"\n" +
+			"  watch: false\n" +
+			"  diff-tolerance: 0.005\n" +
+			"  charmap: serve_chars.txt\n",
+		"settings.toml": "charmap = \"farsi_chars.txt\"\n" +
+			"io-retries = 5\n" +
+			"encrypt-fields = [\"KHARYD\", \"FOROSH\"]\n" +
+			"\n" +
+			"[serve]\n" +
+			"addr = \":9090\"\n" +
+			"watch = false\n" +
+			"diff-tolerance = 0.005\n" +
+			"charmap = \"serve_chars.txt\"\n",
+	}
+
+	for name, data := range files {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+
+		f, err := Load(path)
+		if err != nil {
+			t.Fatalf("Load %s failed: %v", name, err)
+		}
+		if commands := f.Commands(); !reflect.DeepEqual(commands, []string{"serve"}) {
+			t.Errorf("%s: expected the serve table, got %v", name, commands)
+		}
+		if flags := f.Flags(""); !reflect.DeepEqual(flags, []string{"charmap", "encrypt-fields", "io-retries"}) {
+			t.Errorf("%s: expected three top-level flags, got %v", name, flags)
+		}
+
+		expected := map[string][]string{
+			"charmap":        {"serve_chars.txt"},
+			"io-retries":     {"5"},
+			"encrypt-fields": {"KHARYD", "FOROSH"},
+			"addr":           {":9090"},
+			"watch":          {"false"},
+			"diff-tolerance": {"0.005"},
+		}
+		if values := f.Values("serve"); !reflect.DeepEqual(values, expected) {
+			t.Errorf("%s: expected serve values %v, got %v", name, expected, values)
+		}
+		if values := f.Values("convert"); values["charmap"][0] != "farsi_chars.txt" || values["addr"] != nil {
+			t.Errorf("%s: expected only the top-level values for convert, got %v", name, values)
+		}
+	}
+}
+
+func TestLoadInvalid(t *testing.T) {
+	dir := t.TempDir()
+	for name, data := range map[string]string{
+		"settings.ini":  "charmap=farsi_chars.txt\n",
+		"broken.yaml":   "charmap: [\n",
+		"nested.yaml":   "serve:\n  tls:\n    cert: a.pem\n",
+		"list.toml":     "group = [[\"KHARID\"]]\n",
+		"settings.json": "[1, 2]",
+	} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+		if _, err := Load(path); err == nil {
+			t.Errorf("Expected an error loading %s", name)
+		}
+	}
+
+	if _, err := Load(filepath.Join(dir, "missing.yaml")); err == nil {
+		t.Error("Expected an error for a missing file")
+	}
+}
+
+func TestEnvName(t *testing.T) {
+	for flag, expected := range map[string]string{
+		"addr":       "PATRIS_ADDR",
+		"io-retries": "PATRIS_IO_RETRIES",
+		"jwt-secret": "PATRIS_JWT_SECRET",
+	} {
+		if got := EnvName(flag); got != expected {
+			t.Errorf("EnvName(%q): expected %s, got %s", flag, expected, got)
+		}
+	}
+}
@@ -0,0 +1,220 @@
+package control
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Request is a single command sent over the control socket
+type Request struct {
+	Command string   `json:"command"`
+	Args    []string `json:"args,omitempty"`
+}
+
+// Response is the reply to a Request
+type Response struct {
+	OK     bool        `json:"ok"`
+	Result interface{} `json:"result,omitempty"`
+	Error  string      `json:"error,omitempty"`
+}
+
+// HandlerFunc executes a control command
+type HandlerFunc func(args []string) (interface{}, error)
+
+// DefaultSocketPath returns the control socket path used when none is configured
+func DefaultSocketPath() string {
+	return filepath.Join(os.TempDir(), "patris-export.sock")
+}
+
+// Server accepts control commands on a local Unix domain socket.
+// Unix sockets are also available on Windows 10 and later.
+type Server struct {
+	path     string
+	listener net.Listener
+	mu       sync.RWMutex
+	handlers map[string]HandlerFunc
+	conns    map[net.Conn]struct{}
+	wg       sync.WaitGroup
+}
+
+// NewServer creates a control server listening on path
+func NewServer(path string) *Server {
+	s := &Server{
+		path:     path,
+		handlers: make(map[string]HandlerFunc),
+		conns:    make(map[net.Conn]struct{}),
+	}
+
+	s.Handle("help", func(args []string) (interface{}, error) {
+		return s.Commands(), nil
+	})
+
+	return s
+}
+
+// Handle registers a handler for a command
+func (s *Server) Handle(command string, handler HandlerFunc) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.handlers[command] = handler
+}
+
+// Commands returns the registered command names
+func (s *Server) Commands() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	commands := make([]string, 0, len(s.handlers))
+	for command := range s.handlers {
+		commands = append(commands, command)
+	}
+	sort.Strings(commands)
+	return commands
+}
+
+// Start begins accepting connections
+func (s *Server) Start() error {
+	// A socket left behind by a crashed process blocks Listen; remove it
+	// only if nobody answers on it
+	if _, err := os.Stat(s.path); err == nil {
+		if conn, err := net.DialTimeout("unix", s.path, time.Second); err == nil {
+			conn.Close()
+			return fmt.Errorf("control socket %s is already in use by another process", s.path)
+		}
+		os.Remove(s.path)
+	}
+
+	listener, err := net.Listen("unix", s.path)
+	if err != nil {
+		return fmt.Errorf("failed to listen on control socket: %w", err)
+	}
+
+	// Only the owning user may control the daemon
+	if err := os.Chmod(s.path, 0600); err != nil {
+		listener.Close()
+		return fmt.Errorf("failed to restrict control socket permissions: %w", err)
+	}
+
+	s.listener = listener
+
+	s.wg.Add(1)
+	go s.acceptLoop()
+
+	return nil
+}
+
+// acceptLoop serves connections until the listener is closed
+func (s *Server) acceptLoop() {
+	defer s.wg.Done()
+
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				log.Printf("⚠️  Control socket error: %v", err)
+			}
+			return
+		}
+
+		s.mu.Lock()
+		s.conns[conn] = struct{}{}
+		s.mu.Unlock()
+
+		s.wg.Add(1)
+		go s.serveConn(conn)
+	}
+}
+
+// serveConn handles newline-delimited JSON requests on one connection
+func (s *Server) serveConn(conn net.Conn) {
+	defer s.wg.Done()
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+		conn.Close()
+	}()
+
+	scanner := bufio.NewScanner(conn)
+	encoder := json.NewEncoder(conn)
+
+	for scanner.Scan() {
+		var req Request
+		if err := json.Unmarshal(scanner.Bytes(), &req); err != nil {
+			encoder.Encode(Response{Error: fmt.Sprintf("invalid request: %v", err)})
+			continue
+		}
+
+		encoder.Encode(s.dispatch(req))
+	}
+}
+
+// dispatch runs the handler for a request
+func (s *Server) dispatch(req Request) Response {
+	s.mu.RLock()
+	handler, ok := s.handlers[req.Command]
+	s.mu.RUnlock()
+
+	if !ok {
+		return Response{Error: fmt.Sprintf("unknown command %q (available: %v)", req.Command, s.Commands())}
+	}
+
+	log.Printf("🎛️  Control command: %s", req.Command)
+
+	result, err := handler(req.Args)
+	if err != nil {
+		return Response{Error: err.Error()}
+	}
+	return Response{OK: true, Result: result}
+}
+
+// Close stops accepting commands and removes the socket file
+func (s *Server) Close() error {
+	if s.listener == nil {
+		return nil
+	}
+
+	err := s.listener.Close()
+
+	// Idle clients would otherwise keep their connection goroutines alive
+	s.mu.Lock()
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mu.Unlock()
+
+	s.wg.Wait()
+	os.Remove(s.path)
+	return err
+}
+
+// Send connects to a control socket, sends one command and returns the response
+func Send(path, command string, args ...string) (*Response, error) {
+	conn, err := net.DialTimeout("unix", path, 5*time.Second)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to control socket %s (is the server running?): %w", path, err)
+	}
+	defer conn.Close()
+
+	conn.SetDeadline(time.Now().Add(30 * time.Second))
+
+	if err := json.NewEncoder(conn).Encode(Request{Command: command, Args: args}); err != nil {
+		return nil, fmt.Errorf("failed to send command: %w", err)
+	}
+
+	var resp Response
+	if err := json.NewDecoder(conn).Decode(&resp); err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	return &resp, nil
+}
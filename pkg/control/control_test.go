@@ -0,0 +1,94 @@
+package control
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func startTestServer(t *testing.T) (*Server, string) {
+	t.Helper()
+
+	dir, err := os.MkdirTemp("", "ctl")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	path := filepath.Join(dir, "ctl.sock")
+	srv := NewServer(path)
+	srv.Handle("status", func(args []string) (interface{}, error) {
+		return map[string]interface{}{"paused": false, "args": len(args)}, nil
+	})
+	srv.Handle("fail", func(args []string) (interface{}, error) {
+		return nil, errors.New("boom")
+	})
+
+	if err := srv.Start(); err != nil {
+		t.Fatalf("Failed to start control server: %v", err)
+	}
+	t.Cleanup(func() { srv.Close() })
+
+	return srv, path
+}
+
+func TestSendCommand(t *testing.T) {
+	_, path := startTestServer(t)
+
+	resp, err := Send(path, "status", "a", "b")
+	if err != nil {
+		t.Fatalf("Failed to send command: %v", err)
+	}
+
+	if !resp.OK {
+		t.Fatalf("Expected OK response, got error: %s", resp.Error)
+	}
+
+	result, ok := resp.Result.(map[string]interface{})
+	if !ok || result["args"] != float64(2) {
+		t.Errorf("Unexpected result: %v", resp.Result)
+	}
+}
+
+func TestCommandErrors(t *testing.T) {
+	_, path := startTestServer(t)
+
+	resp, err := Send(path, "fail")
+	if err != nil {
+		t.Fatalf("Failed to send command: %v", err)
+	}
+	if resp.OK || resp.Error != "boom" {
+		t.Errorf("Expected handler error, got %+v", resp)
+	}
+
+	resp, err = Send(path, "nope")
+	if err != nil {
+		t.Fatalf("Failed to send command: %v", err)
+	}
+	if resp.OK {
+		t.Error("Expected unknown command to fail")
+	}
+}
+
+func TestRefusesSocketInUse(t *testing.T) {
+	_, path := startTestServer(t)
+
+	second := NewServer(path)
+	if err := second.Start(); err == nil {
+		second.Close()
+		t.Error("Expected second server on the same socket to fail")
+	}
+}
+
+func TestCloseRemovesSocket(t *testing.T) {
+	srv, path := startTestServer(t)
+
+	if err := srv.Close(); err != nil {
+		t.Fatalf("Failed to close: %v", err)
+	}
+
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Error("Expected socket file to be removed")
+	}
+}
@@ -0,0 +1,72 @@
+package converter
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/atomicdeploy/patris-export/pkg/paradox"
+)
+
+// Bundle is a single JSON document holding company metadata and the
+// transformed records of several tables, keyed by table name
+type Bundle struct {
+	Company     *paradox.CompanyInfo              `json:"company,omitempty"`
+	GeneratedAt time.Time                         `json:"generated_at"`
+	Tables      map[string]map[string]interface{} `json:"tables"`
+
+	// arrayFields are the grouped array fields written inline
+	arrayFields map[string]bool
+}
+
+// NewBundle creates an empty bundle; company may be nil
+func NewBundle(company *paradox.CompanyInfo) *Bundle {
+	return &Bundle{
+		Company:     company,
+		GeneratedAt: time.Now().UTC(),
+		Tables:      make(map[string]map[string]interface{}),
+		arrayFields: make(map[string]bool),
+	}
+}
+
+// AddTable converts, encrypts and transforms records with the exporter and
+// stores them under name, exactly as they would appear in a JSON export
+func (b *Bundle) AddTable(name string, exp *Exporter, records []paradox.Record) error {
+	if _, ok := b.Tables[name]; ok {
+		return fmt.Errorf("table %s is already in the bundle", name)
+	}
+
+	// Convert string fields, run transformers, filter, sort and encrypt
+	records, err := exp.prepareRecords(records)
+	if err != nil {
+		return err
+	}
+
+	b.Tables[name] = exp.TransformRecords(records)
+	for _, field := range exp.Profile().ArrayFields() {
+		b.arrayFields[field] = true
+	}
+	return nil
+}
+
+// WriteJSON writes the bundle as a JSON document
+func (b *Bundle) WriteJSON(outputPath string) error {
+	data, err := json.MarshalIndent(b, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode bundle: %w", err)
+	}
+
+	// Post-process to make ANBAR (and other grouped) arrays inline
+	fields := make([]string, 0, len(b.arrayFields))
+	for field := range b.arrayFields {
+		fields = append(fields, field)
+	}
+	output := makeArraysInline(string(data), fields...)
+
+	if err := os.WriteFile(outputPath, []byte(output), 0644); err != nil {
+		return fmt.Errorf("failed to write bundle: %w", err)
+	}
+
+	return nil
+}
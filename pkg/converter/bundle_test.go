@@ -0,0 +1,55 @@
+package converter
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/atomicdeploy/patris-export/pkg/paradox"
+)
+
+func TestBundle(t *testing.T) {
+	bundle := NewBundle(&paradox.CompanyInfo{Name: "Test Co", StartDate: "1402/01/01"})
+
+	items := []paradox.Record{{"Code": 1, "Name": "Item", "ANBAR1": 2, "ANBAR2": 3}}
+	customers := []paradox.Record{{"Code": 7, "Name": "Customer", "Sort": "x"}}
+
+	if err := bundle.AddTable("kala", NewExporter(nil), items); err != nil {
+		t.Fatalf("Failed to add kala: %v", err)
+	}
+	if err := bundle.AddTable("moshtari", NewExporter(nil), customers); err != nil {
+		t.Fatalf("Failed to add moshtari: %v", err)
+	}
+	if err := bundle.AddTable("kala", NewExporter(nil), items); err == nil {
+		t.Error("Expected error when adding a table twice")
+	}
+
+	outputPath := filepath.Join(t.TempDir(), "bundle.json")
+	if err := bundle.WriteJSON(outputPath); err != nil {
+		t.Fatalf("Failed to write bundle: %v", err)
+	}
+
+	data, err := os.ReadFile(outputPath)
+	if err != nil {
+		t.Fatalf("Failed to read bundle: %v", err)
+	}
+
+	var decoded struct {
+		Company map[string]interface{}                       `json:"company"`
+		Tables  map[string]map[string]map[string]interface{} `json:"tables"`
+	}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Bundle is not valid JSON: %v\n%s", err, data)
+	}
+
+	if decoded.Company["name"] != "Test Co" {
+		t.Errorf("Unexpected company: %v", decoded.Company)
+	}
+	if decoded.Tables["kala"]["1"]["Name"] != "Item" {
+		t.Errorf("Unexpected kala table: %v", decoded.Tables["kala"])
+	}
+	if _, ok := decoded.Tables["moshtari"]["7"]["Sort"]; ok {
+		t.Error("Sort fields should be removed from bundled tables")
+	}
+}
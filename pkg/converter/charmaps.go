@@ -0,0 +1,136 @@
+package converter
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync/atomic"
+
+	"golang.org/x/text/encoding/charmap"
+)
+
+// Built-in character map names
+const (
+	// CharMapPatris81 is the Patris81 encoding (default)
+	CharMapPatris81 = "patris81"
+	// CharMapCP1256 is Windows-1256 (Arabic), used by tables written by
+	// Windows programs
+	CharMapCP1256 = "cp1256"
+)
+
+// CharMap is a named character mapping
+type CharMap struct {
+	Name        string
+	Description string
+	Mapping     CharMapping
+	// Logical is set for encodings storing text in reading order. Patris
+	// encodings store Persian text in visual order, which is reversed.
+	Logical bool
+}
+
+// charMaps holds the registered character maps by name
+var charMaps = map[string]*CharMap{}
+
+// defaultCharMap is the character map used by Patris2Fa; it is replaced
+// atomically so that a reload never races with a conversion
+var defaultCharMap atomic.Pointer[CharMap]
+
+func init() {
+	RegisterCharMap(&CharMap{
+		Name:        CharMapPatris81,
+		Description: "Patris81 (visual order)",
+		Mapping:     embeddedCharMap,
+	})
+	RegisterCharMap(&CharMap{
+		Name:        CharMapCP1256,
+		Description: "Windows-1256 Arabic/Persian (logical order)",
+		Mapping:     cp1256Mapping(),
+		Logical:     true,
+	})
+
+	// The embedded Patris81 mapping is the default, so the application
+	// works even without the -c flag
+	SetDefaultCharMap(charMaps[CharMapPatris81])
+}
+
+// cp1256Mapping builds the mapping of the upper half of Windows-1256
+func cp1256Mapping() CharMapping {
+	mapping := make(CharMapping)
+	for b := 0x80; b <= 0xff; b++ {
+		mapping[byte(b)] = string(charmap.Windows1256.DecodeByte(byte(b)))
+	}
+	return mapping
+}
+
+// RegisterCharMap adds a character map, replacing one with the same name
+func RegisterCharMap(c *CharMap) {
+	charMaps[strings.ToLower(c.Name)] = c
+}
+
+// LookupCharMap returns a registered character map by name
+func LookupCharMap(name string) (*CharMap, error) {
+	if c, ok := charMaps[strings.ToLower(strings.TrimSpace(name))]; ok {
+		return c, nil
+	}
+
+	names := make([]string, 0, len(charMaps))
+	for _, c := range CharMaps() {
+		names = append(names, c.Name)
+	}
+	return nil, fmt.Errorf("unknown character map %q (use %s)", name, strings.Join(names, ", "))
+}
+
+// CharMaps returns the registered character maps sorted by name
+func CharMaps() []*CharMap {
+	list := make([]*CharMap, 0, len(charMaps))
+	for _, c := range charMaps {
+		list = append(list, c)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// SetDefaultCharMap sets the character map used by Patris2Fa and Fa2Patris
+func SetDefaultCharMap(c *CharMap) {
+	defaultCharMap.Store(c)
+}
+
+// DefaultCharMap returns the character map used by Patris2Fa
+func DefaultCharMap() *CharMap {
+	return defaultCharMap.Load()
+}
+
+// ReloadCharMapping loads a mapping file and makes it the default. A file
+// that cannot be read or has no entries (e.g. while an editor is saving it)
+// leaves the current mapping in place.
+func ReloadCharMapping(filename string) error {
+	mapping, err := LoadCharMapping(filename)
+	if err != nil {
+		return err
+	}
+	if len(mapping) == 0 {
+		return fmt.Errorf("character mapping file %s has no entries", filename)
+	}
+
+	SetDefaultMapping(mapping)
+	return nil
+}
+
+// Convert converts text in the character map's encoding to Persian/Farsi
+func (c *CharMap) Convert(value string) string {
+	if !c.Logical {
+		return Patris2FaWithMapping(value, c.Mapping)
+	}
+
+	var output strings.Builder
+	for _, b := range []byte(value) {
+		if mapped, ok := c.Mapping[b]; ok {
+			output.WriteString(mapped)
+		} else {
+			// Unmapped bytes are converted as ISO-8859-1 to Unicode
+			output.WriteRune(rune(b))
+		}
+	}
+
+	return cleanText(output.String())
+}
@@ -0,0 +1,76 @@
+package converter
+
+import (
+	"testing"
+
+	"github.com/atomicdeploy/patris-export/pkg/paradox"
+)
+
+func TestLookupCharMap(t *testing.T) {
+	for _, name := range []string{"patris81", "CP1256", " cp1256 "} {
+		if _, err := LookupCharMap(name); err != nil {
+			t.Errorf("Expected built-in character map %q, got: %v", name, err)
+		}
+	}
+	if _, err := LookupCharMap("patris77"); err == nil {
+		t.Error("Expected error for unknown character map")
+	}
+
+	if DefaultCharMap().Name != CharMapPatris81 {
+		t.Errorf("Expected patris81 as the default, got %s", DefaultCharMap().Name)
+	}
+}
+
+func TestCP1256Convert(t *testing.T) {
+	c, err := LookupCharMap(CharMapCP1256)
+	if err != nil {
+		t.Fatalf("Failed to look up cp1256: %v", err)
+	}
+
+	// Logical order: سلام is stored as is, mixed with ASCII
+	if got := c.Convert("\xd3\xe1\xc7\xe3  GY-31"); got != "سلام GY-31" {
+		t.Errorf("Expected 'سلام GY-31', got %q", got)
+	}
+}
+
+func TestProfileFieldCharMaps(t *testing.T) {
+	field, name, err := ParseFieldCharMap("Sharh1=CP1256")
+	if err != nil {
+		t.Fatalf("Failed to parse field character map: %v", err)
+	}
+	if field != "Sharh1" || name != CharMapCP1256 {
+		t.Errorf("Unexpected field character map %s=%s", field, name)
+	}
+	for _, spec := range []string{"Sharh1", "=cp1256", "Sharh1=", "Sharh1=unknown"} {
+		if _, _, err := ParseFieldCharMap(spec); err == nil {
+			t.Errorf("Expected error for %q", spec)
+		}
+	}
+
+	profile := DefaultProfile.WithCharMaps(map[string]string{"Sharh1": CharMapCP1256})
+	if len(DefaultProfile.CharMaps) != 0 {
+		t.Error("WithCharMaps should not modify the original profile")
+	}
+	if err := profile.Validate(); err != nil {
+		t.Fatalf("Expected valid profile, got: %v", err)
+	}
+
+	exp := NewExporter(Patris2Fa)
+	exp.SetProfile(profile)
+	records := exp.convertRecords([]paradox.Record{{
+		"Code":   1,
+		"Name":   Fa2Patris("پیچ"),
+		"Sharh1": "\xd3\xe1\xc7\xe3",
+	}})
+	if records[0]["Name"] != "پیچ" {
+		t.Errorf("Expected Name converted with the default map, got %q", records[0]["Name"])
+	}
+	if records[0]["Sharh1"] != "سلام" {
+		t.Errorf("Expected Sharh1 converted with cp1256, got %q", records[0]["Sharh1"])
+	}
+
+	invalid := DefaultProfile.WithCharMaps(map[string]string{"Sharh1": "unknown"})
+	if err := invalid.Validate(); err == nil {
+		t.Error("Expected error for unknown character map in profile")
+	}
+}
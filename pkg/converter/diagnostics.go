@@ -0,0 +1,237 @@
+package converter
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/atomicdeploy/patris-export/pkg/paradox"
+)
+
+// maxReportValues caps the values listed in a conversion report; counts
+// keep covering all records
+const maxReportValues = 1000
+
+// unknownGlyph is the mapping of bytes whose glyph is not known
+const unknownGlyph = "[?]"
+
+// UnmappedValue is a field value containing bytes the character map does not
+// convert
+type UnmappedValue struct {
+	// Record is the value of the record's key field
+	Record string `json:"record"`
+	Field  string `json:"field"`
+	// Hex is the raw value as space-separated hex bytes
+	Hex string `json:"hex"`
+	// Unmapped lists the distinct unmapped bytes (e.g. 0xEA)
+	Unmapped []string `json:"unmapped"`
+	// Converted is the value as it appears in the export
+	Converted string `json:"converted,omitempty"`
+}
+
+// ConversionReport lists the records and fields whose text contains bytes
+// the character map does not convert, which end up as mojibake in exports
+type ConversionReport struct {
+	Source          string    `json:"source"`
+	GeneratedAt     time.Time `json:"generated_at"`
+	RecordsScanned  int       `json:"records_scanned"`
+	RecordsAffected int       `json:"records_affected"`
+	ValuesAffected  int       `json:"values_affected"`
+	// Bytes counts the occurrences of each unmapped byte
+	Bytes map[string]int `json:"unmapped_bytes"`
+	// Fields counts the affected values of each field
+	Fields map[string]int `json:"fields"`
+	// Values lists the affected values, up to a limit
+	Values    []UnmappedValue `json:"values"`
+	Truncated bool            `json:"truncated,omitempty"`
+
+	profile  *Profile
+	steps    pipeline
+	charMaps map[string]*CharMap
+	redacted map[string]bool
+}
+
+// NewConversionReport creates an empty report for a source table. Fields
+// dropped by the profile are skipped, and the others are checked with the
+// profile's character maps or the default one.
+func NewConversionReport(source string, profile *Profile) *ConversionReport {
+	if profile == nil {
+		profile = DefaultProfile
+	}
+	// An invalid pipeline fails the export itself; check every field then
+	steps, _ := compilePipeline(profile.Steps())
+
+	charMaps := make(map[string]*CharMap, len(profile.CharMaps))
+	for field, name := range profile.CharMaps {
+		if c, err := LookupCharMap(name); err == nil {
+			charMaps[field] = c
+		}
+	}
+
+	return &ConversionReport{
+		Source:      source,
+		GeneratedAt: time.Now().UTC(),
+		Bytes:       make(map[string]int),
+		Fields:      make(map[string]int),
+		Values:      []UnmappedValue{},
+		profile:     profile,
+		steps:       steps,
+		charMaps:    charMaps,
+		redacted:    make(map[string]bool),
+	}
+}
+
+// Redact counts the given fields without listing their values (e.g. fields
+// that are encrypted in the export)
+func (r *ConversionReport) Redact(fields ...string) {
+	for _, field := range fields {
+		r.redacted[field] = true
+	}
+}
+
+// Check scans the raw text fields of a record
+func (r *ConversionReport) Check(record paradox.Record) {
+	r.RecordsScanned++
+
+	// Fields in name order, so listed values are stable
+	fields := make([]string, 0, len(record))
+	for field, value := range record {
+		if _, ok := value.(string); !ok {
+			continue
+		}
+		if _, ok := r.steps.outputName(field); ok {
+			fields = append(fields, field)
+		}
+	}
+	sort.Strings(fields)
+
+	affected := false
+	for _, field := range fields {
+		value := record[field].(string)
+		c, ok := r.charMaps[field]
+		if !ok {
+			c = DefaultCharMap()
+		}
+
+		unmapped := c.UnmappedBytes(value)
+		if len(unmapped) == 0 {
+			continue
+		}
+		affected = true
+		r.ValuesAffected++
+		r.Fields[field]++
+
+		distinct := make(map[byte]bool)
+		var names []string
+		for _, b := range unmapped {
+			r.Bytes[byteName(b)]++
+			if !distinct[b] {
+				distinct[b] = true
+				names = append(names, byteName(b))
+			}
+		}
+
+		if len(r.Values) >= maxReportValues {
+			r.Truncated = true
+			continue
+		}
+		entry := UnmappedValue{
+			Record:   fmt.Sprintf("%v", record[r.profile.KeyField]),
+			Field:    field,
+			Unmapped: names,
+		}
+		if !r.redacted[field] {
+			entry.Hex = fmt.Sprintf("% x", value)
+			entry.Converted = c.Convert(value)
+		}
+		r.Values = append(r.Values, entry)
+	}
+
+	if affected {
+		r.RecordsAffected++
+	}
+}
+
+// Watch returns an iterator that checks each record read through it, for
+// reports on streaming exports
+func (r *ConversionReport) Watch(it paradox.RecordIterator) paradox.RecordIterator {
+	return &reportIterator{RecordIterator: it, report: r}
+}
+
+// reportIterator checks records as they are read
+type reportIterator struct {
+	paradox.RecordIterator
+	report *ConversionReport
+}
+
+// Next advances the iterator and checks the record
+func (it *reportIterator) Next() bool {
+	if !it.RecordIterator.Next() {
+		return false
+	}
+	it.report.Check(it.Record())
+	return true
+}
+
+// Clean reports whether no unmapped bytes were found
+func (r *ConversionReport) Clean() bool {
+	return r.ValuesAffected == 0
+}
+
+// Summary describes the unmapped bytes by frequency (e.g. "0xEA ×8, 0xEB ×4")
+func (r *ConversionReport) Summary() string {
+	names := make([]string, 0, len(r.Bytes))
+	for name := range r.Bytes {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if r.Bytes[names[i]] != r.Bytes[names[j]] {
+			return r.Bytes[names[i]] > r.Bytes[names[j]]
+		}
+		return names[i] < names[j]
+	})
+
+	parts := make([]string, len(names))
+	for i, name := range names {
+		parts[i] = fmt.Sprintf("%s ×%d", name, r.Bytes[name])
+	}
+	return strings.Join(parts, ", ")
+}
+
+// WriteJSON writes the report as a JSON document
+func (r *ConversionReport) WriteJSON(outputPath string) error {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode conversion report: %w", err)
+	}
+
+	if err := os.WriteFile(outputPath, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write conversion report: %w", err)
+	}
+
+	return nil
+}
+
+// UnmappedBytes returns the bytes of value the character map does not
+// convert: non-ASCII bytes without a mapping or mapped to the unknown glyph
+func (c *CharMap) UnmappedBytes(value string) []byte {
+	var unmapped []byte
+	for i := 0; i < len(value); i++ {
+		b := value[i]
+		if b < 0x80 {
+			continue
+		}
+		if mapped, ok := c.Mapping[b]; !ok || mapped == unknownGlyph {
+			unmapped = append(unmapped, b)
+		}
+	}
+	return unmapped
+}
+
+// byteName formats a byte for reports (0xEA)
+func byteName(b byte) string {
+	return fmt.Sprintf("0x%02X", b)
+}
@@ -0,0 +1,101 @@
+package converter
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/atomicdeploy/patris-export/pkg/paradox"
+)
+
+func diagnosticsRecords() []paradox.Record {
+	return []paradox.Record{
+		{"Code": 1, "Name": "\xa5\xea\xeb", "Sharh1": "ok", "Sort": "\xffABC"},
+		{"Code": 2, "Name": Fa2Patris("پیچ"), "Sharh1": "\x90x", "Sort": "\xffDEF"},
+		{"Code": 3, "Name": "GY-31", "Sharh1": "\xea", "FOROSH": 10},
+	}
+}
+
+func TestConversionReport(t *testing.T) {
+	report := NewConversionReport("kala.db", ProfileForFile("kala.db"))
+	for _, record := range diagnosticsRecords() {
+		report.Check(record)
+	}
+
+	if report.RecordsScanned != 3 || report.RecordsAffected != 3 || report.ValuesAffected != 3 {
+		t.Errorf("Unexpected counts: %d scanned, %d records, %d values", report.RecordsScanned, report.RecordsAffected, report.ValuesAffected)
+	}
+	if report.Bytes["0xEA"] != 2 || report.Bytes["0xEB"] != 1 || report.Bytes["0x90"] != 1 {
+		t.Errorf("Unexpected byte counts: %v", report.Bytes)
+	}
+	if _, ok := report.Bytes["0xFF"]; ok {
+		t.Error("Sort fields are dropped by the profile and should not be reported")
+	}
+	if report.Fields["Name"] != 1 || report.Fields["Sharh1"] != 2 {
+		t.Errorf("Unexpected field counts: %v", report.Fields)
+	}
+	if got := report.Summary(); got != "0xEA ×2, 0x90 ×1, 0xEB ×1" {
+		t.Errorf("Unexpected summary: %s", got)
+	}
+
+	first := report.Values[0]
+	if first.Record != "1" || first.Field != "Name" || first.Hex != "a5 ea eb" {
+		t.Errorf("Unexpected first value: %+v", first)
+	}
+	if len(first.Unmapped) != 2 || first.Unmapped[0] != "0xEA" || first.Unmapped[1] != "0xEB" {
+		t.Errorf("Expected distinct unmapped bytes 0xEA, 0xEB, got %v", first.Unmapped)
+	}
+}
+
+func TestConversionReportRedactAndWatch(t *testing.T) {
+	report := NewConversionReport("kala.db", DefaultProfile)
+	report.Redact("Sharh1")
+
+	it := report.Watch(paradox.NewSliceIterator(diagnosticsRecords()))
+	count := 0
+	for it.Next() {
+		count++
+	}
+	if count != 3 || report.RecordsScanned != 3 {
+		t.Fatalf("Expected 3 records read and scanned, got %d and %d", count, report.RecordsScanned)
+	}
+
+	for _, value := range report.Values {
+		if value.Field == "Sharh1" && (value.Hex != "" || value.Converted != "") {
+			t.Errorf("Expected redacted Sharh1 value, got %+v", value)
+		}
+	}
+
+	outputPath := filepath.Join(t.TempDir(), "kala.report.json")
+	if err := report.WriteJSON(outputPath); err != nil {
+		t.Fatalf("Failed to write report: %v", err)
+	}
+	data, err := os.ReadFile(outputPath)
+	if err != nil {
+		t.Fatalf("Failed to read report: %v", err)
+	}
+	var decoded ConversionReport
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Report is not valid JSON: %v", err)
+	}
+	if decoded.ValuesAffected != report.ValuesAffected {
+		t.Errorf("Expected %d affected values, got %d", report.ValuesAffected, decoded.ValuesAffected)
+	}
+}
+
+func TestConversionReportFieldCharMap(t *testing.T) {
+	// cp1256 maps every byte, so Sharh1 is clean with it
+	profile := DefaultProfile.WithCharMaps(map[string]string{"Sharh1": CharMapCP1256})
+	report := NewConversionReport("kala.db", profile)
+	for _, record := range diagnosticsRecords() {
+		report.Check(record)
+	}
+
+	if report.Fields["Sharh1"] != 0 {
+		t.Errorf("Expected Sharh1 to be clean with cp1256, got %d values", report.Fields["Sharh1"])
+	}
+	if report.Clean() {
+		t.Error("Expected Name to still be reported")
+	}
+}
@@ -0,0 +1,57 @@
+package converter
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/atomicdeploy/patris-export/pkg/diff"
+)
+
+// ChangeSet describes the differences between two sets of transformed records
+type ChangeSet = diff.ChangeSet
+
+// DiffRecords compares two record maps keyed by Code, as returned by
+// TransformRecords or read from a JSON export, comparing values exactly.
+// Modified holds the new version of each changed record. See diff.Records
+// for comparison with a numeric tolerance.
+func DiffRecords(before, after map[string]interface{}) *ChangeSet {
+	return diff.Records(before, after, diff.Options{})
+}
+
+// ReadJSONExport reads a JSON export keyed by Code (optionally wrapped in a
+// metadata envelope) for comparison with DiffRecords
+func ReadJSONExport(path string) (map[string]interface{}, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read JSON export: %w", err)
+	}
+
+	var records map[string]interface{}
+	if err := json.Unmarshal(data, &records); err != nil {
+		return nil, fmt.Errorf("%s is not a JSON export keyed by code: %w", filepath.Base(path), err)
+	}
+
+	// Unwrap an --envelope export
+	if _, ok := records["metadata"]; ok {
+		if wrapped, ok := records["records"].(map[string]interface{}); ok {
+			return wrapped, nil
+		}
+		if _, ok := records["records"].([]interface{}); ok {
+			return nil, fmt.Errorf("%s is an array export; compare exports keyed by code", filepath.Base(path))
+		}
+	}
+
+	return records, nil
+}
+
+// EncodeChangeSet encodes a change set as indented JSON with the given array
+// fields (e.g. ANBAR) on one line, like a JSON export
+func EncodeChangeSet(changes *ChangeSet, arrayFields ...string) ([]byte, error) {
+	data, err := json.MarshalIndent(changes, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode change set: %w", err)
+	}
+	return []byte(makeArraysInline(string(data), arrayFields...) + "\n"), nil
+}
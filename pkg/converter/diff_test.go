@@ -0,0 +1,62 @@
+package converter
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestDiffRecords(t *testing.T) {
+	before := map[string]interface{}{
+		"1": map[string]interface{}{"Code": 1, "Name": "A", "ANBAR": []interface{}{1, 0}},
+		"2": map[string]interface{}{"Code": 2, "Name": "B"},
+		"3": map[string]interface{}{"Code": 3, "Name": "C"},
+	}
+	// Decoded from JSON: numbers are float64 but equal to the ints above
+	after := map[string]interface{}{
+		"1": map[string]interface{}{"Code": 1.0, "Name": "A", "ANBAR": []interface{}{1.0, 0.0}},
+		"2": map[string]interface{}{"Code": 2.0, "Name": "B2"},
+		"4": map[string]interface{}{"Code": 4.0, "Name": "D"},
+	}
+
+	changes := DiffRecords(before, after)
+
+	if len(changes.Added) != 1 || changes.Added["4"] == nil {
+		t.Errorf("Expected record 4 added, got %v", changes.Added)
+	}
+	if len(changes.Modified) != 1 || !reflect.DeepEqual(changes.Modified["2"], after["2"]) {
+		t.Errorf("Expected record 2 modified, got %v", changes.Modified)
+	}
+	if !reflect.DeepEqual(changes.Deleted, []string{"3"}) {
+		t.Errorf("Expected record 3 deleted, got %v", changes.Deleted)
+	}
+	if changes.Empty() || !DiffRecords(before, before).Empty() {
+		t.Error("Unexpected Empty result")
+	}
+}
+
+func TestReadJSONExport(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+		return path
+	}
+
+	keyed := write("keyed.json", `{"1": {"Code": 1}}`)
+	envelope := write("envelope.json", `{"metadata": {"record_count": 1}, "records": {"1": {"Code": 1}}}`)
+	array := write("array.json", `{"metadata": {}, "records": [{"Code": 1}]}`)
+
+	for _, path := range []string{keyed, envelope} {
+		records, err := ReadJSONExport(path)
+		if err != nil || len(records) != 1 || records["1"] == nil {
+			t.Errorf("ReadJSONExport(%s) = %v, %v", filepath.Base(path), records, err)
+		}
+	}
+	if _, err := ReadJSONExport(array); err == nil {
+		t.Error("Expected an error for an array export")
+	}
+}
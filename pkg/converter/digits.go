@@ -0,0 +1,143 @@
+package converter
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// DigitStyle selects which numerals appear in exported text values
+type DigitStyle string
+
+const (
+	// DigitsDefault uses the package-wide style set with SetDefaultDigitStyle
+	DigitsDefault DigitStyle = ""
+	// DigitsAsIs leaves digits exactly as decoded
+	DigitsAsIs DigitStyle = "as-is"
+	// DigitsLatin renders all digits as 0-9
+	DigitsLatin DigitStyle = "latin"
+	// DigitsPersian renders all digits as ۰-۹
+	DigitsPersian DigitStyle = "persian"
+)
+
+var (
+	digitStyleMu      sync.RWMutex
+	defaultDigitStyle = DigitsAsIs
+)
+
+// ParseDigitStyle parses a digit style name
+func ParseDigitStyle(name string) (DigitStyle, error) {
+	switch style := DigitStyle(strings.ToLower(strings.TrimSpace(name))); style {
+	case DigitsDefault, DigitsAsIs, DigitsLatin, DigitsPersian:
+		return style, nil
+	default:
+		return "", fmt.Errorf("unknown digit style %q (use as-is, latin or persian)", name)
+	}
+}
+
+// DigitStyles is a default digit style with per-format overrides, parsed
+// from specs such as "persian" or "latin,csv=persian,web=persian"
+type DigitStyles struct {
+	Default DigitStyle
+	Formats map[string]DigitStyle
+}
+
+// digitStyleFormats are the output formats a digit style can be set for;
+// "web" is the server's API and WebSocket output
+var digitStyleFormats = []string{
+	string(FormatJSON), string(FormatCSV), string(FormatYAML), string(FormatXLSX), string(FormatSQLite), string(FormatTemplate), "web",
+}
+
+// ParseDigitStyles parses a comma-separated list of a default style and
+// format=style overrides
+func ParseDigitStyles(spec string) (DigitStyles, error) {
+	styles := DigitStyles{Default: DigitsDefault, Formats: make(map[string]DigitStyle)}
+
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		format, name, ok := strings.Cut(part, "=")
+		if !ok {
+			style, err := ParseDigitStyle(part)
+			if err != nil {
+				return styles, err
+			}
+			styles.Default = style
+			continue
+		}
+
+		format = strings.ToLower(strings.TrimSpace(format))
+		known := false
+		for _, f := range digitStyleFormats {
+			known = known || f == format
+		}
+		if !known {
+			return styles, fmt.Errorf("unknown format %q for digit style (use %s)", format, strings.Join(digitStyleFormats, ", "))
+		}
+
+		style, err := ParseDigitStyle(name)
+		if err != nil {
+			return styles, err
+		}
+		styles.Formats[format] = style
+	}
+
+	return styles, nil
+}
+
+// For returns the digit style for a format: its override if set, otherwise the default
+func (d DigitStyles) For(format string) DigitStyle {
+	if style, ok := d.Formats[format]; ok {
+		return style
+	}
+	return d.Default
+}
+
+// SetDefaultDigitStyle sets the digit style used by exporters without their own style
+func SetDefaultDigitStyle(style DigitStyle) {
+	digitStyleMu.Lock()
+	defer digitStyleMu.Unlock()
+	if style == DigitsDefault {
+		style = DigitsAsIs
+	}
+	defaultDigitStyle = style
+}
+
+// GetDefaultDigitStyle returns the package-wide digit style
+func GetDefaultDigitStyle() DigitStyle {
+	digitStyleMu.RLock()
+	defer digitStyleMu.RUnlock()
+	return defaultDigitStyle
+}
+
+// ConvertDigits rewrites Latin, Persian and Arabic-Indic digits in s to the given style
+func ConvertDigits(s string, style DigitStyle) string {
+	if style == DigitsDefault {
+		style = GetDefaultDigitStyle()
+	}
+
+	var base rune
+	switch style {
+	case DigitsLatin:
+		base = '0'
+	case DigitsPersian:
+		base = '۰'
+	default:
+		return s
+	}
+
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= '0' && r <= '9':
+			return base + (r - '0')
+		case r >= '۰' && r <= '۹':
+			return base + (r - '۰')
+		case r >= '٠' && r <= '٩':
+			return base + (r - '٠')
+		}
+		return r
+	}, s)
+}
@@ -0,0 +1,106 @@
+package converter
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/atomicdeploy/patris-export/pkg/paradox"
+)
+
+func TestConvertDigits(t *testing.T) {
+	tests := []struct {
+		input    string
+		style    DigitStyle
+		expected string
+	}{
+		{"کد ۱۲۳-45", DigitsLatin, "کد 123-45"},
+		{"کد ۱۲۳-45", DigitsPersian, "کد ۱۲۳-۴۵"},
+		{"٣٤5", DigitsLatin, "345"},
+		{"کد ۱۲۳-45", DigitsAsIs, "کد ۱۲۳-45"},
+	}
+
+	for _, tt := range tests {
+		if got := ConvertDigits(tt.input, tt.style); got != tt.expected {
+			t.Errorf("ConvertDigits(%q, %s) = %q, want %q", tt.input, tt.style, got, tt.expected)
+		}
+	}
+}
+
+func TestExporterDigitStyle(t *testing.T) {
+	records := []paradox.Record{
+		{"Code": "1001", "Name": "Item 7", "ANBAR1": 5},
+	}
+
+	exp := NewExporter(nil)
+	exp.SetDigitStyle(DigitsPersian)
+	transformed := exp.ConvertAndTransformRecords(records)
+
+	record, ok := transformed["۱۰۰۱"].(map[string]interface{})
+	if !ok {
+		t.Fatalf("Expected record keyed by Persian code, got %v", transformed)
+	}
+	if record["Name"] != "Item ۷" {
+		t.Errorf("Expected Persian digits in Name, got %v", record["Name"])
+	}
+	if anbar, ok := record["ANBAR"].([]interface{}); !ok || anbar[0] != 5 {
+		t.Errorf("Numeric fields must stay numbers, got %v", record["ANBAR"])
+	}
+
+	// The package default applies to exporters without their own style
+	SetDefaultDigitStyle(DigitsLatin)
+	defer SetDefaultDigitStyle(DigitsAsIs)
+
+	transformed = NewExporter(nil).ConvertAndTransformRecords([]paradox.Record{{"Code": "۴۲"}})
+	if _, ok := transformed["42"]; !ok {
+		t.Errorf("Expected default Latin digits, got %v", transformed)
+	}
+}
+
+func TestParseDigitStyles(t *testing.T) {
+	styles, err := ParseDigitStyles("latin, csv=persian,web=Persian")
+	if err != nil {
+		t.Fatalf("Failed to parse digit styles: %v", err)
+	}
+	if styles.For("csv") != DigitsPersian || styles.For("web") != DigitsPersian {
+		t.Errorf("Unexpected overrides: %+v", styles)
+	}
+	if styles.For("json") != DigitsLatin {
+		t.Errorf("Expected the default for json, got %s", styles.For("json"))
+	}
+
+	// Without a default, formats without an override use the package default
+	styles, err = ParseDigitStyles("xlsx=persian")
+	if err != nil {
+		t.Fatalf("Failed to parse digit styles: %v", err)
+	}
+	if styles.For("json") != DigitsDefault {
+		t.Errorf("Expected DigitsDefault for json, got %s", styles.For("json"))
+	}
+
+	for _, spec := range []string{"arabic", "pdf=persian", "csv=roman"} {
+		if _, err := ParseDigitStyles(spec); err == nil {
+			t.Errorf("Expected an error for %q", spec)
+		}
+	}
+}
+
+func TestCSVNumbersFollowDigitStyle(t *testing.T) {
+	records := []paradox.Record{{"Code": "12", "FOROSH": 1500.5, "ANBAR1": 30}}
+	fields := []paradox.Field{{Name: "Code"}, {Name: "FOROSH"}, {Name: "ANBAR1"}}
+	outputPath := filepath.Join(t.TempDir(), "kala.csv")
+
+	exp := NewExporter(nil)
+	exp.SetDigitStyle(DigitsPersian)
+	if err := exp.ExportToCSV(records, fields, outputPath); err != nil {
+		t.Fatalf("Failed to export: %v", err)
+	}
+
+	data, err := os.ReadFile(outputPath)
+	if err != nil {
+		t.Fatalf("Failed to read export: %v", err)
+	}
+	if want := "Code,FOROSH,ANBAR1\n۱۲,۱۵۰۰.۵,۳۰\n"; string(data) != want {
+		t.Errorf("Unexpected CSV:\n%s\nwant:\n%s", data, want)
+	}
+}
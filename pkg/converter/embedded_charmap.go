@@ -82,9 +82,3 @@ var embeddedCharMap = map[byte]string{
 	0xfb: "8",
 	0xfc: "9",
 }
-
-func init() {
-	// Set the embedded mapping as default on package initialization
-	// This ensures the application works even without -c flag
-	SetDefaultMapping(embeddedCharMap)
-}
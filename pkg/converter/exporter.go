@@ -2,13 +2,14 @@ package converter
 
 import (
 	"encoding/csv"
-	"encoding/json"
 	"fmt"
-	"os"
+	"log"
 	"regexp"
 	"strings"
 
+	"github.com/atomicdeploy/patris-export/pkg/encryption"
 	"github.com/atomicdeploy/patris-export/pkg/paradox"
+	"gopkg.in/yaml.v3"
 )
 
 // ExportFormat represents the export format type
@@ -17,14 +18,22 @@ type ExportFormat string
 const (
 	FormatJSON ExportFormat = "json"
 	FormatCSV  ExportFormat = "csv"
+	FormatYAML ExportFormat = "yaml"
 )
 
-// Regular expression to match numbered ANBAR fields (ANBAR1, ANBAR2, etc.)
-var anbarFieldRegex = regexp.MustCompile(`^ANBAR\d+$`)
-
 // Exporter handles exporting Paradox database records
 type Exporter struct {
 	converter func(string) string
+	encryptor *encryption.FieldEncryptor
+	digits    DigitStyle
+	profile   *Profile
+	filter    *Filter
+	sortField string
+	sortDesc  bool
+
+	compression Compression
+	jsonOptions JSONOptions
+	numbers     *NumberFormat
 }
 
 // NewExporter creates a new exporter with optional converter function
@@ -34,93 +43,207 @@ func NewExporter(converter func(string) string) *Exporter {
 	}
 }
 
+// SetFieldEncryptor enables encryption of selected fields in file exports
+func (e *Exporter) SetFieldEncryptor(encryptor *encryption.FieldEncryptor) {
+	e.encryptor = encryptor
+}
+
+// SetDigitStyle overrides the package-wide digit style for text values
+func (e *Exporter) SetDigitStyle(style DigitStyle) {
+	e.digits = style
+}
+
+// digitStyle returns the effective digit style
+func (e *Exporter) digitStyle() DigitStyle {
+	if e.digits == DigitsDefault {
+		return GetDefaultDigitStyle()
+	}
+	return e.digits
+}
+
+// SetProfile sets the table profile used by TransformRecords
+func (e *Exporter) SetProfile(profile *Profile) {
+	e.profile = profile
+}
+
+// Profile returns the table profile used by TransformRecords
+func (e *Exporter) Profile() *Profile {
+	if e.profile == nil {
+		return DefaultProfile
+	}
+	return e.profile
+}
+
 // ExportToJSON exports records to JSON format with Patris81-specific formatting
 func (e *Exporter) ExportToJSON(records []paradox.Record, outputPath string) error {
-	// Convert string fields if converter is set
-	if e.converter != nil {
-		records = e.convertRecords(records)
+	// Convert string fields, run transformers, filter, sort and encrypt
+	records, err := e.prepareRecords(records)
+	if err != nil {
+		return err
+	}
+
+	// Transform records (keyed by Code unless the JSON options say otherwise)
+	// and keep ANBAR inline
+	output, err := e.encodeJSON(records)
+	if err != nil {
+		return err
+	}
+
+	file, err := createOutput(outputPath, e.compression)
+	if err != nil {
+		return fmt.Errorf("failed to create output file: %w", err)
+	}
+	defer file.Abort()
+
+	if _, err := file.Write(output); err != nil {
+		return fmt.Errorf("failed to write JSON: %w", err)
+	}
+
+	return file.Commit()
+}
+
+// ExportToYAML exports records to YAML with the same structure as the JSON export:
+// records keyed by Code, with ANBAR arrays written as inline flow sequences
+func (e *Exporter) ExportToYAML(records []paradox.Record, outputPath string) error {
+	// Convert string fields, run transformers, filter, sort and encrypt
+	records, err := e.prepareRecords(records)
+	if err != nil {
+		return err
 	}
 
 	// Transform records to use Code as key and optimize structure
 	transformed := e.TransformRecords(records)
 
-	file, err := os.Create(outputPath)
+	var doc yaml.Node
+	if err := doc.Encode(transformed); err != nil {
+		return fmt.Errorf("failed to encode YAML: %w", err)
+	}
+	setFlowStyle(&doc, e.Profile().ArrayFields()...)
+
+	file, err := createOutput(outputPath, e.compression)
 	if err != nil {
 		return fmt.Errorf("failed to create output file: %w", err)
 	}
-	defer file.Close()
+	defer file.Abort()
 
-	// Use custom JSON formatting to keep ANBAR inline
-	data, err := json.MarshalIndent(transformed, "", "  ")
-	if err != nil {
-		return fmt.Errorf("failed to encode JSON: %w", err)
+	encoder := yaml.NewEncoder(file)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(&doc); err != nil {
+		return fmt.Errorf("failed to write YAML: %w", err)
+	}
+	if err := encoder.Close(); err != nil {
+		return fmt.Errorf("failed to write YAML: %w", err)
 	}
 
-	// Post-process to make ANBAR arrays inline
-	output := makeArraysInline(string(data), "ANBAR")
+	return file.Commit()
+}
 
-	if _, err := file.WriteString(output); err != nil {
-		return fmt.Errorf("failed to write JSON: %w", err)
+// setFlowStyle marks sequences under the given mapping keys as inline flow sequences
+func setFlowStyle(node *yaml.Node, keys ...string) {
+	if node.Kind == yaml.MappingNode {
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			for _, k := range keys {
+				if key.Value == k && value.Kind == yaml.SequenceNode {
+					value.Style = yaml.FlowStyle
+				}
+			}
+		}
 	}
 
-	return nil
+	for _, child := range node.Content {
+		setFlowStyle(child, keys...)
+	}
 }
 
 // ExportToCSV exports records to CSV format
 func (e *Exporter) ExportToCSV(records []paradox.Record, fields []paradox.Field, outputPath string) error {
-	// Convert string fields if converter is set
-	if e.converter != nil {
-		records = e.convertRecords(records)
+	// Convert string fields, run transformers, filter, sort and encrypt
+	records, err := e.prepareRecords(records)
+	if err != nil {
+		return err
 	}
 
-	file, err := os.Create(outputPath)
+	file, err := createOutput(outputPath, e.compression)
 	if err != nil {
 		return fmt.Errorf("failed to create output file: %w", err)
 	}
-	defer file.Close()
+	defer file.Abort()
 
 	writer := csv.NewWriter(file)
-	defer writer.Flush()
 
 	// Write header
-	header := make([]string, len(fields))
-	for i, field := range fields {
-		header[i] = field.Name
-	}
-	if err := writer.Write(header); err != nil {
+	if err := writer.Write(csvHeader(fields)); err != nil {
 		return fmt.Errorf("failed to write CSV header: %w", err)
 	}
 
 	// Write records
 	for _, record := range records {
-		row := make([]string, len(fields))
-		for i, field := range fields {
-			if val, ok := record[field.Name]; ok {
-				row[i] = fmt.Sprintf("%v", val)
-			}
-		}
-		if err := writer.Write(row); err != nil {
+		if err := writer.Write(e.csvRow(record, fields)); err != nil {
 			return fmt.Errorf("failed to write CSV row: %w", err)
 		}
 	}
 
-	return nil
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return fmt.Errorf("failed to write CSV: %w", err)
+	}
+
+	return file.Commit()
+}
+
+// csvHeader returns the CSV header row
+func csvHeader(fields []paradox.Field) []string {
+	header := make([]string, len(fields))
+	for i, field := range fields {
+		header[i] = field.Name
+	}
+	return header
+}
+
+// csvRow formats a record as a CSV row
+func (e *Exporter) csvRow(record paradox.Record, fields []paradox.Field) []string {
+	row := make([]string, len(fields))
+	for i, field := range fields {
+		if val, ok := record[field.Name]; ok {
+			row[i] = fmt.Sprintf("%v", val)
+			// CSV is all text, so numbers follow the digit style too
+			if _, isString := val.(string); !isString {
+				row[i] = ConvertDigits(row[i], e.digitStyle())
+			}
+		}
+	}
+	return row
 }
 
 // convertRecords converts string fields in records using the converter function
+// and renders their digits in the configured style
 func (e *Exporter) convertRecords(records []paradox.Record) []paradox.Record {
+	digits := e.digitStyle()
+	fieldConverters := e.Profile().fieldConverters()
+	formatNumber := e.numberFormatter()
+	if e.converter == nil && fieldConverters == nil && formatNumber == nil && digits == DigitsAsIs {
+		return records
+	}
+
 	converted := make([]paradox.Record, len(records))
 	
 	for i, record := range records {
 		convertedRecord := make(paradox.Record)
 		for key, value := range record {
 			if strVal, ok := value.(string); ok {
-				// Only convert non-empty strings
-				if strings.TrimSpace(strVal) != "" {
-					convertedRecord[key] = e.converter(strVal)
-				} else {
-					convertedRecord[key] = strVal
+				// Only convert non-empty strings, with the field's own
+				// character map if the profile sets one
+				converter := e.converter
+				if fieldConverter, ok := fieldConverters[key]; ok {
+					converter = fieldConverter
 				}
+				if converter != nil && strings.TrimSpace(strVal) != "" {
+					strVal = converter(strVal)
+				}
+				convertedRecord[key] = ConvertDigits(strVal, digits)
+			} else if floatVal, ok := value.(float64); ok && formatNumber != nil {
+				convertedRecord[key] = formatNumber(key, floatVal)
 			} else {
 				convertedRecord[key] = value
 			}
@@ -131,151 +254,197 @@ func (e *Exporter) convertRecords(records []paradox.Record) []paradox.Record {
 	return converted
 }
 
-// ExportRecordsToString exports records to a JSON string
-func (e *Exporter) ExportRecordsToString(records []paradox.Record) (string, error) {
-	// Convert string fields if converter is set
-	if e.converter != nil {
-		records = e.convertRecords(records)
+// encryptRecords returns copies of the records with the configured fields encrypted
+func (e *Exporter) encryptRecords(records []paradox.Record) ([]paradox.Record, error) {
+	if e.encryptor == nil {
+		return records, nil
 	}
 
-	// Transform records to use Code as key and optimize structure
-	transformed := e.TransformRecords(records)
+	encrypted := make([]paradox.Record, len(records))
+	for i, record := range records {
+		copied := make(paradox.Record, len(record))
+		for key, value := range record {
+			copied[key] = value
+		}
+		if err := e.encryptor.EncryptRecord(copied); err != nil {
+			return nil, err
+		}
+		encrypted[i] = copied
+	}
+
+	return encrypted, nil
+}
+
+// prepareRecords converts string fields, runs the registered transformers,
+// drops records not matching the filter, sorts them and encrypts the
+// configured fields
+func (e *Exporter) prepareRecords(records []paradox.Record) ([]paradox.Record, error) {
+	records, err := applyTransformers(e.convertRecords(records))
+	if err != nil {
+		return nil, err
+	}
+
+	records, err = e.filterRecords(records)
+	if err != nil {
+		return nil, err
+	}
+
+	return e.encryptRecords(e.sortRecords(records))
+}
+
+// PrepareRecords returns the records as the exports write them, in row
+// order: converted, transformed, filtered, sorted and encrypted as
+// configured
+func (e *Exporter) PrepareRecords(records []paradox.Record) ([]paradox.Record, error) {
+	return e.prepareRecords(records)
+}
 
-	data, err := json.MarshalIndent(transformed, "", "  ")
+// ExportRecordsToString exports records to a JSON string
+func (e *Exporter) ExportRecordsToString(records []paradox.Record) (string, error) {
+	// Convert string fields, run transformers, filter, sort and encrypt
+	records, err := e.prepareRecords(records)
 	if err != nil {
-		return "", fmt.Errorf("failed to marshal JSON: %w", err)
+		return "", err
 	}
 
-	// Post-process to make ANBAR arrays inline
-	output := makeArraysInline(string(data), "ANBAR")
+	// Transform records (keyed by Code unless the JSON options say otherwise)
+	// and keep ANBAR inline
+	output, err := e.encodeJSON(records)
+	if err != nil {
+		return "", err
+	}
 
-	return output, nil
+	return string(output), nil
 }
 
 // ConvertAndTransformRecords converts string fields and transforms records for Patris81-specific output.
 // This combines the conversion and transformation steps into a single method for use by the web server.
 func (e *Exporter) ConvertAndTransformRecords(records []paradox.Record) map[string]interface{} {
-	// Convert string fields if converter is set
-	if e.converter != nil {
-		records = e.convertRecords(records)
-	}
+	// Convert string fields and apply the digit style
+	records = e.convertRecords(records)
+
+	// Run the registered transformers
+	records = applyTransformersOrLog(records)
 	
 	// Transform records to use Code as key and optimize structure
 	return e.TransformRecords(records)
 }
 
-// TransformRecords transforms records for Patris81-specific output format:
-// - Use Code field as the key
-// - Ignore fields starting with "Sort"
-// - Combine ANBAR fields into an array
+// ConvertFilterAndTransformRecords is like ConvertAndTransformRecords but only
+// keeps the records matching the exporter's filter
+func (e *Exporter) ConvertFilterAndTransformRecords(records []paradox.Record) (map[string]interface{}, error) {
+	records, err := applyTransformers(e.convertRecords(records))
+	if err != nil {
+		return nil, err
+	}
+
+	records, err = e.filterRecords(records)
+	if err != nil {
+		return nil, err
+	}
+
+	return e.TransformRecords(records), nil
+}
+
+// TransformRecords transforms records for Patris81-specific output format
+// by running the transform pipeline of the exporter's profile (DefaultProfile
+// unless set). For the built-in profiles this means:
+// - Use the key field (Code) as the key
+// - Ignore fields starting with the drop prefixes ("Sort")
+// - Combine numbered fields (ANBAR1, ANBAR2, ...) into arrays
+// - Apply the profile's type coercions
 // This method is used by both the file exporter and the web server to ensure consistent output.
 func (e *Exporter) TransformRecords(records []paradox.Record) map[string]interface{} {
+	profile := e.Profile()
 	result := make(map[string]interface{})
-	
+
+	steps, err := compilePipeline(profile.Steps())
+	if err != nil {
+		log.Printf("⚠️  Invalid transform pipeline in profile %s: %v", profile.Name, err)
+		return result
+	}
+
 	for _, record := range records {
-		// Extract Code as the key
-		codeKey := ""
-		if code, ok := record["Code"]; ok {
-			codeKey = fmt.Sprintf("%v", code)
-		} else {
-			// Skip records without Code
-			continue
-		}
-		
-		// Build optimized record
-		optimized := make(map[string]interface{})
-		anbarFields := make(map[int]interface{})
-		
-		for key, value := range record {
-			// Skip Sort fields
-			if strings.HasPrefix(key, "Sort") {
-				continue
-			}
-			
-			// Keep ALLANBAR as-is (check first to avoid confusion with ANBAR pattern)
-			if key == "ALLANBAR" {
-				optimized[key] = value
-				continue
-			}
-			
-			// Collect numbered ANBAR fields into map (ANBAR1, ANBAR2, etc.)
-			if anbarFieldRegex.MatchString(key) {
-				// Extract the number from ANBAR field name (e.g., "ANBAR1" -> 1)
-				var num int
-				if n, _ := fmt.Sscanf(key, "ANBAR%d", &num); n == 1 && num > 0 {
-					anbarFields[num] = value
-				}
-				continue
-			}
-			
-			// Add all other fields
-			optimized[key] = value
-		}
-		
-		// Add ANBAR array if we collected any, sorted by field number
-		if len(anbarFields) > 0 {
-			// Find the maximum ANBAR number to determine array size
-			maxNum := 0
-			for num := range anbarFields {
-				if num > maxNum {
-					maxNum = num
-				}
-			}
-			
-			// Build array with correct ordering (1-indexed fields -> 0-indexed array)
-			anbarValues := make([]interface{}, maxNum)
-			for i := 1; i <= maxNum; i++ {
-				if val, ok := anbarFields[i]; ok {
-					anbarValues[i-1] = val
-				} else {
-					anbarValues[i-1] = 0
-				}
-			}
-			optimized["ANBAR"] = anbarValues
+		if code, optimized, ok := transformRecord(steps, profile.KeyField, record); ok {
+			result[code] = optimized
 		}
-		
-		result[codeKey] = optimized
 	}
-	
+
 	return result
 }
 
+// transformRecord runs the pipeline on a copy of the record and returns it
+// with its key. Records without the key field are skipped.
+func transformRecord(steps pipeline, keyField string, record paradox.Record) (string, map[string]interface{}, bool) {
+	code, ok := record[keyField]
+	if !ok {
+		return "", nil, false
+	}
+
+	optimized := make(map[string]interface{}, len(record))
+	for key, value := range record {
+		optimized[key] = value
+	}
+	steps.apply(optimized)
+
+	return fmt.Sprintf("%v", code), optimized, true
+}
+
 // makeArraysInline converts multi-line numeric arrays to single-line format
 // Specifically optimized for ANBAR arrays but works for any numeric array
 func makeArraysInline(jsonStr string, fieldNames ...string) string {
+	re := arrayInlinePattern(fieldNames)
+	if re == nil {
+		return jsonStr
+	}
+	return inlineArrays(re, jsonStr)
+}
+
+var (
+	inlineFieldRe = regexp.MustCompile(`"([^"]+)":`)
+	inlineValueRe = regexp.MustCompile(`\d+`)
+)
+
+// arrayInlinePattern compiles the pattern matching multi-line numeric arrays
+// of the given fields, or returns nil if there are no fields
+func arrayInlinePattern(fieldNames []string) *regexp.Regexp {
 	// Build pattern to match specified field names
-	fieldPattern := strings.Join(fieldNames, "|")
+	quoted := make([]string, len(fieldNames))
+	for i, name := range fieldNames {
+		quoted[i] = regexp.QuoteMeta(name)
+	}
+	fieldPattern := strings.Join(quoted, "|")
 	if fieldPattern == "" {
-		return jsonStr
+		return nil
 	}
-	
+
 	// Pattern to match multi-line arrays with numeric values
 	// Matches: "ANBAR": [\n      1,\n      2,\n    ]
-	pattern := fmt.Sprintf(`("(?:%s)":\s*)\[\s*((?:\d+,?\s*)+)\]`, fieldPattern)
-	re := regexp.MustCompile(pattern)
-	
+	return regexp.MustCompile(fmt.Sprintf(`("(?:%s)":\s*)\[\s*((?:\d+,?\s*)+)\]`, fieldPattern))
+}
+
+// inlineArrays rewrites the arrays matched by re on a single line
+func inlineArrays(re *regexp.Regexp, jsonStr string) string {
 	return re.ReplaceAllStringFunc(jsonStr, func(match string) string {
 		// Extract field name
-		fieldRe := regexp.MustCompile(`"([^"]+)":`)
-		fieldMatch := fieldRe.FindStringSubmatch(match)
+		fieldMatch := inlineFieldRe.FindStringSubmatch(match)
 		if len(fieldMatch) < 2 {
 			return match
 		}
 		fieldName := fieldMatch[1]
-		
-		// Extract the numeric values
-		valueRe := regexp.MustCompile(`\d+`)
-		values := valueRe.FindAllString(match, -1)
-		
+
+		// Extract the numeric values (after the field name, which may contain digits)
+		values := inlineValueRe.FindAllString(match[strings.Index(match, "["):], -1)
+
 		// Check if match ends with comma (not last property)
 		hasComma := strings.HasSuffix(strings.TrimSpace(match), ",")
-		
+
 		// Rebuild as inline with proper spacing
 		result := fmt.Sprintf(`"%s": [%s]`, fieldName, strings.Join(values, ", "))
 		if hasComma {
 			result += ","
 		}
-		
+
 		return result
 	})
 }
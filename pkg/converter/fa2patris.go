@@ -0,0 +1,172 @@
+package converter
+
+import (
+	"sort"
+	"strings"
+)
+
+// patrisForms holds the Patris81 bytes of one letter's glyphs. Final and
+// Isolated are the word-ending glyphs (mapped with a [zwnj] marker), Medial
+// and Initial the glyphs connected to the following letter. Letters that do
+// not connect to the following letter (ا, د, ر, و, ...) only use Medial
+// (after a connecting letter) and Initial.
+type patrisForms struct {
+	Initial, Medial, Final, Isolated byte
+}
+
+// nonJoiningLetters never connect to the following letter
+const nonJoiningLetters = "اآدذرزژو"
+
+// arabicVariants maps Arabic code points to the Persian letters Patris81 encodes
+var arabicVariants = map[rune]rune{
+	'ي': 'ی',
+	'ى': 'ی',
+	'ك': 'ک',
+	'ة': 'ه',
+	'ۀ': 'ه',
+	'أ': 'ا',
+	'إ': 'ا',
+	'ؤ': 'و',
+}
+
+// Fa2Patris converts Persian text to Patris81-encoded text using the default mapping
+func Fa2Patris(value string) string {
+	return Fa2PatrisWithMapping(value, DefaultCharMap().Mapping)
+}
+
+// Fa2PatrisWithMapping converts Persian/Farsi text to Patris81 encoding,
+// reversing Patris2FaWithMapping:
+//  1. Choose each letter's glyph from whether the previous letter connects to
+//     it and whether it connects to the next letter
+//  2. Map Persian digits to the Patris digit bytes; Latin digits stay ASCII
+//     (convert them with ConvertDigits first to get Patris digits)
+//  3. Reverse Persian letter segments into visual byte order
+//
+// Characters without a Patris81 byte are written as '?'. Zero-width
+// non-joiners end a word; they survive a round trip when Patris2Fa runs
+// in ZWNJChar mode.
+func Fa2PatrisWithMapping(value string, mapping CharMapping) string {
+	if mapping == nil {
+		mapping = DefaultCharMap().Mapping
+	}
+	forms := reverseMapping(mapping)
+
+	runes := []rune(value)
+	for i, r := range runes {
+		if variant, ok := arabicVariants[r]; ok {
+			runes[i] = variant
+		}
+	}
+
+	// isLetter reports whether the rune at i is encoded in the Patris letter range
+	isLetter := func(i int) bool {
+		if i < 0 || i >= len(runes) {
+			return false
+		}
+		f, ok := forms[runes[i]]
+		return ok && isPatrisByte(f.Initial)
+	}
+	// joinsNext reports whether the letter at i connects to the following letter
+	joinsNext := func(i int) bool {
+		return isLetter(i) && !strings.ContainsRune(nonJoiningLetters, runes[i]) && isLetter(i+1)
+	}
+
+	output := make([]byte, 0, len(runes))
+	for i, r := range runes {
+		if r == '\u200c' {
+			continue
+		}
+
+		// Persian and Arabic-Indic digits use the Patris digit bytes
+		var f patrisForms
+		ok := false
+		if d := persianDigitValue(r); d >= 0 {
+			f, ok = forms['0'+rune(d)]
+		} else if r >= 0x80 {
+			f, ok = forms[r]
+		}
+		if !ok {
+			switch {
+			case r < 0x80:
+				output = append(output, byte(r))
+			case r <= 0xff && mapping[byte(r)] == "":
+				// Patris2Fa reads unmapped bytes as ISO-8859-1
+				output = append(output, byte(r))
+			default:
+				output = append(output, '?')
+			}
+			continue
+		}
+
+		joined := joinsNext(i - 1)
+		nonJoining := strings.ContainsRune(nonJoiningLetters, r)
+		switch {
+		case (joinsNext(i) || nonJoining) && joined:
+			output = append(output, f.Medial)
+		case joinsNext(i) || nonJoining:
+			output = append(output, f.Initial)
+		case joined:
+			output = append(output, f.Final)
+		default:
+			output = append(output, f.Isolated)
+		}
+	}
+
+	// Segment reversal is its own inverse
+	return string(reversePatrisSegments(output))
+}
+
+// reverseMapping builds the glyph forms of every single-character mapping value.
+// Patris81 orders the bytes of a letter as isolated, final, medial, initial
+// (e.g. ع is 0xc3-0xc6); letters with fewer bytes share them between forms.
+func reverseMapping(mapping CharMapping) map[rune]patrisForms {
+	bytes := make([]int, 0, len(mapping))
+	for b := range mapping {
+		bytes = append(bytes, int(b))
+	}
+	sort.Ints(bytes)
+
+	ending := make(map[rune][]byte)
+	connected := make(map[rune][]byte)
+	for _, b := range bytes {
+		value := mapping[byte(b)]
+		letter := strings.TrimSuffix(value, "[zwnj]")
+		runes := []rune(letter)
+		if len(runes) != 1 {
+			continue
+		}
+		if letter != value {
+			ending[runes[0]] = append(ending[runes[0]], byte(b))
+		} else {
+			connected[runes[0]] = append(connected[runes[0]], byte(b))
+		}
+	}
+
+	forms := make(map[rune]patrisForms)
+	for r, b := range connected {
+		f := patrisForms{Medial: b[0], Initial: b[len(b)-1]}
+		f.Final, f.Isolated = f.Medial, f.Initial
+		forms[r] = f
+	}
+	for r, b := range ending {
+		f, ok := forms[r]
+		if !ok {
+			f.Medial, f.Initial = b[len(b)-1], b[0]
+		}
+		f.Isolated, f.Final = b[0], b[len(b)-1]
+		forms[r] = f
+	}
+
+	return forms
+}
+
+// persianDigitValue returns the value of a Persian or Arabic-Indic digit, or -1
+func persianDigitValue(r rune) int {
+	switch {
+	case r >= '۰' && r <= '۹':
+		return int(r - '۰')
+	case r >= '٠' && r <= '٩':
+		return int(r - '٠')
+	}
+	return -1
+}
@@ -0,0 +1,64 @@
+package converter
+
+import (
+	"testing"
+)
+
+func TestFa2PatrisRoundTrip(t *testing.T) {
+	tests := []string{
+		"سلام",
+		"سلام دنیا",
+		"ARDUINO با",
+		"پیچ و مهره M8",
+		"کد ۱۲۳ عدد",
+		"آی سی",
+		"شیر آب 1/2",
+		"غذا و عطر",
+	}
+
+	for _, text := range tests {
+		t.Run(text, func(t *testing.T) {
+			encoded := Fa2PatrisWithMapping(text, embeddedCharMap)
+			if got := Patris2FaWithMapping(encoded, embeddedCharMap); got != ConvertDigits(text, DigitsLatin) {
+				t.Errorf("Round trip of %q = %q (encoded % x)", text, got, encoded)
+			}
+		})
+	}
+}
+
+func TestFa2PatrisGlyphForms(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		// Visual order: the last letter comes first; ب joins the following
+		// ا (0xa5), the final ب uses its word-ending form (0xa4)
+		{"joining and final forms", "باب", "\xa4\xa1\xa5"},
+		{"non-joining letters have one form", "در", "\xb6\xb4"},
+		{"English is not reversed", "AB با", "AB \xa1\xa5"},
+		{"initial and isolated forms", "عدد", "\xb4\xb4\xc6"},
+		{"medial and final forms", "معمعه", "\xdb\xc5\xd6\xc5\xd6"},
+		{"digits", "۱۲ 34", "\xf4\xf5 34"},
+		{"Arabic variants", "كي", "\xdf\xd0"},
+		{"unknown characters", "€", "?"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Fa2PatrisWithMapping(tt.input, embeddedCharMap); got != tt.expected {
+				t.Errorf("Fa2PatrisWithMapping(%q) = % x, want % x", tt.input, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestFa2PatrisZWNJRoundTrip(t *testing.T) {
+	SetZWNJMode(ZWNJChar)
+	defer SetZWNJMode(ZWNJSpace)
+
+	text := "می\u200cشود"
+	if got := Patris2FaWithMapping(Fa2PatrisWithMapping(text, embeddedCharMap), embeddedCharMap); got != text {
+		t.Errorf("Round trip of %q = %q", text, got)
+	}
+}
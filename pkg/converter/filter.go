@@ -0,0 +1,134 @@
+package converter
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Knetic/govaluate"
+	"github.com/atomicdeploy/patris-export/pkg/paradox"
+)
+
+// Filter selects records with a boolean expression over their fields, e.g.
+// "FOROSH > 0 && ANBAR1 > 0" or "Name =~ 'پیچ'". Expressions are evaluated
+// on the raw field names (before ANBAR fields are combined into arrays) and
+// on converted text, so string comparisons use Persian text.
+type Filter struct {
+	source string
+	expr   *govaluate.EvaluableExpression
+	// zero holds the value used for null fields, by field name
+	zero map[string]interface{}
+}
+
+// ParseFilter compiles a filter expression
+func ParseFilter(expression string) (*Filter, error) {
+	expression = strings.TrimSpace(expression)
+	if expression == "" {
+		return nil, fmt.Errorf("filter expression is empty")
+	}
+
+	expr, err := govaluate.NewEvaluableExpression(expression)
+	if err != nil {
+		return nil, fmt.Errorf("invalid filter %q: %w", expression, err)
+	}
+
+	return &Filter{source: expression, expr: expr}, nil
+}
+
+// String returns the filter expression
+func (f *Filter) String() string {
+	return f.source
+}
+
+// Bind checks the fields referenced by the filter against the table fields
+// and the fields added by registered transformers. Once bound, null values
+// evaluate as the zero value of their field type (0, "" or false) instead of
+// failing comparisons.
+func (f *Filter) Bind(fields []paradox.Field) error {
+	zero := make(map[string]interface{}, len(fields))
+	for _, field := range fields {
+		zero[field.Name] = zeroValue(field.Type)
+	}
+
+	added := make(map[string]bool)
+	for _, name := range addedFields() {
+		added[name] = true
+	}
+
+	for _, name := range f.expr.Vars() {
+		if _, ok := zero[name]; !ok && !added[name] {
+			return fmt.Errorf("filter %q: unknown field %s", f.source, name)
+		}
+	}
+
+	f.zero = zero
+	return nil
+}
+
+// Match reports whether a record satisfies the filter
+func (f *Filter) Match(record paradox.Record) (bool, error) {
+	result, err := f.expr.Eval(filterParameters{record: record, zero: f.zero})
+	if err != nil {
+		return false, fmt.Errorf("filter %q: %w", f.source, err)
+	}
+
+	matched, ok := result.(bool)
+	if !ok {
+		return false, fmt.Errorf("filter %q: result %v is not a boolean", f.source, result)
+	}
+
+	return matched, nil
+}
+
+// filterParameters exposes a record's fields to the expression
+type filterParameters struct {
+	record paradox.Record
+	zero   map[string]interface{}
+}
+
+// Get returns a field value; null fields of bound filters are zero values
+func (p filterParameters) Get(name string) (interface{}, error) {
+	if value, ok := p.record[name]; ok {
+		return value, nil
+	}
+	if value, ok := p.zero[name]; ok {
+		return value, nil
+	}
+	return nil, fmt.Errorf("no field %s", name)
+}
+
+// zeroValue returns the value a null field of the given Paradox type compares as
+func zeroValue(fieldType string) interface{} {
+	switch fieldType {
+	case "alpha", "bytes", "memo", "fmtmemo", "blob", "ole", "graphic":
+		return ""
+	case "logical":
+		return false
+	default:
+		return 0.0
+	}
+}
+
+// SetFilter exports only the records matching the filter (nil exports all)
+func (e *Exporter) SetFilter(filter *Filter) {
+	e.filter = filter
+}
+
+// filterRecords returns the records matching the exporter's filter
+func (e *Exporter) filterRecords(records []paradox.Record) ([]paradox.Record, error) {
+	if e.filter == nil {
+		return records, nil
+	}
+
+	matched := make([]paradox.Record, 0, len(records))
+	for _, record := range records {
+		ok, err := e.filter.Match(record)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			matched = append(matched, record)
+		}
+	}
+
+	return matched, nil
+}
@@ -0,0 +1,117 @@
+package converter
+
+import (
+	"testing"
+
+	"github.com/atomicdeploy/patris-export/pkg/paradox"
+)
+
+var filterFields = []paradox.Field{
+	{Name: "Code", Type: "alpha", Size: 10},
+	{Name: "Name", Type: "alpha", Size: 40},
+	{Name: "FOROSH", Type: "number", Size: 8},
+	{Name: "ANBAR1", Type: "long", Size: 4},
+}
+
+func TestFilterMatch(t *testing.T) {
+	record := paradox.Record{"Code": "1", "Name": "پیچ", "FOROSH": 1500.0, "ANBAR1": 3}
+
+	tests := []struct {
+		expr string
+		want bool
+	}{
+		{"FOROSH > 0 && ANBAR1 > 0", true},
+		{"ANBAR1 >= 4", false},
+		{"FOROSH > 1000 || ANBAR1 == 0", true},
+		{"Name == 'پیچ'", true},
+		{"Name =~ '^پ'", true},
+		{"Code != '1'", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			filter, err := ParseFilter(tt.expr)
+			if err != nil {
+				t.Fatalf("Failed to parse filter: %v", err)
+			}
+			got, err := filter.Match(record)
+			if err != nil {
+				t.Fatalf("Failed to match: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Match() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFilterBind(t *testing.T) {
+	filter, err := ParseFilter("ANBAR1 > 0 || Name == ''")
+	if err != nil {
+		t.Fatalf("Failed to parse filter: %v", err)
+	}
+
+	// Unbound filters cannot evaluate null fields
+	if _, err := filter.Match(paradox.Record{"Code": "1"}); err == nil {
+		t.Error("Expected an error for a missing field in an unbound filter")
+	}
+
+	if err := filter.Bind(filterFields); err != nil {
+		t.Fatalf("Failed to bind filter: %v", err)
+	}
+
+	// Null fields compare as zero values once bound
+	got, err := filter.Match(paradox.Record{"Code": "1"})
+	if err != nil {
+		t.Fatalf("Failed to match: %v", err)
+	}
+	if !got {
+		t.Error("Expected a record with a null Name to match Name == ''")
+	}
+
+	typo, _ := ParseFilter("ANBAR11 > 0")
+	if err := typo.Bind(filterFields); err == nil {
+		t.Error("Expected an error for an unknown field")
+	}
+}
+
+func TestParseFilterInvalid(t *testing.T) {
+	for _, expr := range []string{"", "FOROSH >", "(ANBAR1 > 0"} {
+		if _, err := ParseFilter(expr); err == nil {
+			t.Errorf("Expected an error for %q", expr)
+		}
+	}
+}
+
+func TestExportWithFilter(t *testing.T) {
+	records := []paradox.Record{
+		{"Code": "1", "FOROSH": 100.0, "ANBAR1": 5},
+		{"Code": "2", "FOROSH": 100.0, "ANBAR1": 0},
+		{"Code": "3", "FOROSH": 0.0, "ANBAR1": 2},
+	}
+
+	filter, err := ParseFilter("FOROSH > 0 && ANBAR1 > 0")
+	if err != nil {
+		t.Fatalf("Failed to parse filter: %v", err)
+	}
+	if err := filter.Bind(filterFields); err != nil {
+		t.Fatalf("Failed to bind filter: %v", err)
+	}
+
+	exp := NewExporter(nil)
+	exp.SetFilter(filter)
+
+	transformed, err := exp.ConvertFilterAndTransformRecords(records)
+	if err != nil {
+		t.Fatalf("Failed to filter records: %v", err)
+	}
+	if len(transformed) != 1 || transformed["1"] == nil {
+		t.Errorf("Expected only record 1, got %v", transformed)
+	}
+
+	// Records are filtered on raw field names, before ANBAR1 becomes ANBAR[0]
+	anbar := transformed["1"].(map[string]interface{})["ANBAR"].([]interface{})
+	if anbar[0] != 5 {
+		t.Errorf("Expected ANBAR[0] = 5, got %v", anbar[0])
+	}
+}
@@ -0,0 +1,274 @@
+package converter
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/atomicdeploy/patris-export/pkg/paradox"
+)
+
+// JSON export shapes
+const (
+	// JSONShapeKeyed writes an object of records keyed by the key field
+	JSONShapeKeyed = "keyed"
+	// JSONShapeArray writes an array of records in table (or sort) order
+	JSONShapeArray = "array"
+)
+
+// JSONOptions controls the shape of JSON exports. The zero value writes
+// pretty-printed records keyed by the key field with sorted keys.
+type JSONOptions struct {
+	// Shape is JSONShapeKeyed (default) or JSONShapeArray
+	Shape string
+	// Compact writes the JSON without indentation
+	Compact bool
+	// FieldOrder, if set, writes record fields in this column order (grouped
+	// arrays where their first field is, other fields last) and keyed
+	// records in table order, instead of sorting both by name
+	FieldOrder []paradox.Field
+	// Envelope wraps the records in {"metadata": ..., "records": ...}
+	Envelope bool
+	// Source is the source file described in the envelope's metadata
+	Source string
+}
+
+// ParseJSONShape validates a JSON shape name
+func ParseJSONShape(name string) (string, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "", JSONShapeKeyed:
+		return JSONShapeKeyed, nil
+	case JSONShapeArray:
+		return JSONShapeArray, nil
+	}
+	return "", fmt.Errorf("unknown JSON shape %q (use keyed or array)", name)
+}
+
+// ExportMetadata describes an export in the JSON metadata envelope
+type ExportMetadata struct {
+	Source      string    `json:"source,omitempty"`
+	SHA256      string    `json:"sha256,omitempty"`
+	ExportedAt  time.Time `json:"exported_at"`
+	RecordCount int       `json:"record_count"`
+}
+
+// jsonEnvelope is the document written with JSONOptions.Envelope
+type jsonEnvelope struct {
+	Metadata *ExportMetadata `json:"metadata"`
+	Records  interface{}     `json:"records"`
+}
+
+// SetJSONOptions sets the shape of JSON exports
+func (e *Exporter) SetJSONOptions(opts JSONOptions) {
+	e.jsonOptions = opts
+}
+
+// JSONOptions returns the shape of JSON exports
+func (e *Exporter) JSONOptions() JSONOptions {
+	return e.jsonOptions
+}
+
+// encodeJSON encodes prepared records according to the JSON options
+func (e *Exporter) encodeJSON(records []paradox.Record) ([]byte, error) {
+	doc, count, err := e.jsonDocument(records)
+	if err != nil {
+		return nil, err
+	}
+
+	if e.jsonOptions.Envelope {
+		metadata, err := e.exportMetadata(count)
+		if err != nil {
+			return nil, err
+		}
+		doc = jsonEnvelope{Metadata: metadata, Records: doc}
+	}
+
+	if e.jsonOptions.Compact {
+		data, err := json.Marshal(doc)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode JSON: %w", err)
+		}
+		return data, nil
+	}
+
+	data, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode JSON: %w", err)
+	}
+
+	// Post-process to make ANBAR (and other grouped) arrays inline
+	return []byte(makeArraysInline(string(data), e.Profile().ArrayFields()...)), nil
+}
+
+// jsonDocument transforms records into the configured shape and returns it
+// with the number of records it holds
+func (e *Exporter) jsonDocument(records []paradox.Record) (interface{}, int, error) {
+	opts := e.jsonOptions
+	if opts.Shape == JSONShapeKeyed || opts.Shape == "" {
+		if opts.FieldOrder == nil {
+			keyed := e.TransformRecords(records)
+			return keyed, len(keyed), nil
+		}
+	}
+
+	profile := e.Profile()
+	steps, err := compilePipeline(profile.Steps())
+	if err != nil {
+		return nil, 0, fmt.Errorf("invalid transform pipeline in profile %s: %w", profile.Name, err)
+	}
+	order := fieldOrder(steps, opts.FieldOrder)
+
+	if opts.Shape == JSONShapeArray {
+		list := make([]interface{}, 0, len(records))
+		for _, record := range records {
+			list = append(list, e.jsonRecord(steps, order, record))
+		}
+		return list, len(list), nil
+	}
+
+	keyed := &orderedObject{values: make(map[string]interface{})}
+	for _, record := range records {
+		if code, optimized, ok := transformRecord(steps, profile.KeyField, record); ok {
+			keyed.set(code, orderRecord(optimized, order))
+		}
+	}
+	return keyed, len(keyed.keys), nil
+}
+
+// jsonRecord transforms one record for the array shape; records without the
+// key field are kept
+func (e *Exporter) jsonRecord(steps pipeline, order []string, record paradox.Record) interface{} {
+	optimized := make(map[string]interface{}, len(record))
+	for key, value := range record {
+		optimized[key] = value
+	}
+	steps.apply(optimized)
+	return orderRecord(optimized, order)
+}
+
+// exportMetadata describes the export for the envelope, hashing the source file
+func (e *Exporter) exportMetadata(count int) (*ExportMetadata, error) {
+	metadata := &ExportMetadata{
+		ExportedAt:  time.Now().UTC(),
+		RecordCount: count,
+	}
+
+	if source := e.jsonOptions.Source; source != "" {
+		metadata.Source = filepath.Base(source)
+
+		file, err := os.Open(source)
+		if err != nil {
+			return nil, fmt.Errorf("failed to hash source file: %w", err)
+		}
+		defer file.Close()
+
+		hash := sha256.New()
+		if _, err := io.Copy(hash, file); err != nil {
+			return nil, fmt.Errorf("failed to hash source file: %w", err)
+		}
+		metadata.SHA256 = hex.EncodeToString(hash.Sum(nil))
+	}
+
+	return metadata, nil
+}
+
+// fieldOrder returns the output field names in column order, or nil to sort
+// fields by name
+func fieldOrder(steps pipeline, fields []paradox.Field) []string {
+	if fields == nil {
+		return nil
+	}
+
+	seen := make(map[string]bool)
+	order := make([]string, 0, len(fields))
+	for _, field := range fields {
+		if name, ok := steps.outputName(field.Name); ok && !seen[name] {
+			seen[name] = true
+			order = append(order, name)
+		}
+	}
+	return order
+}
+
+// orderRecord returns the record with its fields in the given order, followed
+// by any other fields sorted by name; a nil order keeps the map (sorted by
+// encoding/json)
+func orderRecord(record map[string]interface{}, order []string) interface{} {
+	if order == nil {
+		return record
+	}
+
+	ordered := &orderedObject{values: record}
+	for _, name := range order {
+		if _, ok := record[name]; ok {
+			ordered.keys = append(ordered.keys, name)
+		}
+	}
+
+	var rest []string
+	for name := range record {
+		if !ordered.has(name) {
+			rest = append(rest, name)
+		}
+	}
+	sort.Strings(rest)
+	ordered.keys = append(ordered.keys, rest...)
+
+	return ordered
+}
+
+// orderedObject is a JSON object that keeps its keys in insertion order
+type orderedObject struct {
+	keys   []string
+	values map[string]interface{}
+}
+
+// set sets a value, keeping the position of an existing key
+func (o *orderedObject) set(key string, value interface{}) {
+	if _, ok := o.values[key]; !ok {
+		o.keys = append(o.keys, key)
+	}
+	o.values[key] = value
+}
+
+// has reports whether the key is already in the key order
+func (o *orderedObject) has(key string) bool {
+	for _, k := range o.keys {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
+
+// MarshalJSON encodes the object with its keys in order
+func (o *orderedObject) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, key := range o.keys {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		name, err := json.Marshal(key)
+		if err != nil {
+			return nil, err
+		}
+		value, err := json.Marshal(o.values[key])
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(name)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,129 @@
+package converter
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/atomicdeploy/patris-export/pkg/paradox"
+)
+
+func jsonShapeRecords() []paradox.Record {
+	return []paradox.Record{
+		{"Code": 10, "Name": "B", "ANBAR1": 1, "ANBAR2": 2},
+		{"Code": 9, "Name": "A"},
+	}
+}
+
+func jsonShapeFields() []paradox.Field {
+	return []paradox.Field{{Name: "Code"}, {Name: "Name"}, {Name: "ANBAR1"}, {Name: "ANBAR2"}, {Name: "Sort"}}
+}
+
+func TestJSONShapes(t *testing.T) {
+	kala, _ := LookupProfile("kala")
+	tests := []struct {
+		name     string
+		opts     JSONOptions
+		expected string
+	}{
+		{
+			"compact keyed",
+			JSONOptions{Compact: true},
+			`{"10":{"ANBAR":[1,2,0,0,0,0,0,0,0,0],"Code":10,"Name":"B"},"9":{"Code":9,"Name":"A"}}`,
+		},
+		{
+			"compact array",
+			JSONOptions{Shape: JSONShapeArray, Compact: true},
+			`[{"ANBAR":[1,2,0,0,0,0,0,0,0,0],"Code":10,"Name":"B"},{"Code":9,"Name":"A"}]`,
+		},
+		{
+			"keyed in table order",
+			JSONOptions{Compact: true, FieldOrder: jsonShapeFields()},
+			`{"10":{"Code":10,"Name":"B","ANBAR":[1,2,0,0,0,0,0,0,0,0]},"9":{"Code":9,"Name":"A"}}`,
+		},
+		{
+			"pretty array in table order",
+			JSONOptions{Shape: JSONShapeArray, FieldOrder: jsonShapeFields()},
+			"[\n  {\n    \"Code\": 10,\n    \"Name\": \"B\",\n    \"ANBAR\": [1, 2, 0, 0, 0, 0, 0, 0, 0, 0]\n  },\n" +
+				"  {\n    \"Code\": 9,\n    \"Name\": \"A\"\n  }\n]",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			exp := NewExporter(nil)
+			exp.SetProfile(kala)
+			exp.SetJSONOptions(tt.opts)
+
+			got, err := exp.ExportRecordsToString(jsonShapeRecords())
+			if err != nil {
+				t.Fatalf("Failed to export: %v", err)
+			}
+			if got != tt.expected {
+				t.Errorf("Unexpected JSON:\n%s\nwant:\n%s", got, tt.expected)
+			}
+
+			// Streaming writes the same document
+			var buf bytes.Buffer
+			if err := exp.ExportToJSONWriter(&buf, paradox.NewSliceIterator(jsonShapeRecords())); err != nil {
+				t.Fatalf("Failed to stream: %v", err)
+			}
+			if buf.String() != tt.expected {
+				t.Errorf("Unexpected streamed JSON:\n%s\nwant:\n%s", buf.String(), tt.expected)
+			}
+		})
+	}
+}
+
+func TestJSONEnvelope(t *testing.T) {
+	source := filepath.Join(t.TempDir(), "kala.db")
+	if err := os.WriteFile(source, []byte("table"), 0644); err != nil {
+		t.Fatalf("Failed to write source: %v", err)
+	}
+	sum := sha256.Sum256([]byte("table"))
+
+	exp := NewExporter(nil)
+	exp.SetJSONOptions(JSONOptions{Shape: JSONShapeArray, Envelope: true, Source: source})
+
+	check := func(t *testing.T, data []byte) {
+		var doc struct {
+			Metadata ExportMetadata   `json:"metadata"`
+			Records  []map[string]any `json:"records"`
+		}
+		if err := json.Unmarshal(data, &doc); err != nil {
+			t.Fatalf("Invalid JSON: %v\n%s", err, data)
+		}
+		m := doc.Metadata
+		if m.Source != "kala.db" || m.SHA256 != hex.EncodeToString(sum[:]) || m.RecordCount != 2 || m.ExportedAt.IsZero() {
+			t.Errorf("Unexpected metadata: %+v", m)
+		}
+		if len(doc.Records) != 2 {
+			t.Errorf("Expected 2 records, got %d", len(doc.Records))
+		}
+	}
+
+	output, err := exp.ExportRecordsToString(jsonShapeRecords())
+	if err != nil {
+		t.Fatalf("Failed to export: %v", err)
+	}
+	check(t, []byte(output))
+
+	var buf bytes.Buffer
+	if err := exp.ExportToJSONWriter(&buf, paradox.NewSliceIterator(jsonShapeRecords())); err != nil {
+		t.Fatalf("Failed to stream: %v", err)
+	}
+	check(t, buf.Bytes())
+}
+
+func TestParseJSONShape(t *testing.T) {
+	if shape, err := ParseJSONShape("Array"); err != nil || shape != JSONShapeArray {
+		t.Errorf("ParseJSONShape(Array) = %q, %v", shape, err)
+	}
+	if _, err := ParseJSONShape("table"); err == nil {
+		t.Error("Expected error for unknown shape")
+	}
+}
@@ -0,0 +1,232 @@
+package converter
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/atomicdeploy/patris-export/pkg/paradox"
+)
+
+// Link joins two tables of a merged export: Field of each From record holds
+// the key of a To record
+type Link struct {
+	From  string
+	Field string
+	To    string
+	// As names the nested value (default: the name of the linked table).
+	// A From record holds its To record under this name, and a To record
+	// holds the list of From records linking to it.
+	As string
+}
+
+// ParseLink parses a link given on the command line: TABLE.FIELD=TARGET or
+// TABLE.FIELD=TARGET:NAME (e.g. kala.GroupCode=groups:Group)
+func ParseLink(spec string) (Link, error) {
+	source, target, ok := strings.Cut(strings.TrimSpace(spec), "=")
+	if !ok {
+		return Link{}, fmt.Errorf("invalid link %q (use TABLE.FIELD=TARGET[:NAME])", spec)
+	}
+
+	var link Link
+	link.From, link.Field, ok = strings.Cut(source, ".")
+	if !ok {
+		return Link{}, fmt.Errorf("invalid link %q: missing foreign key field (use TABLE.FIELD=TARGET[:NAME])", spec)
+	}
+	link.To, link.As, _ = strings.Cut(target, ":")
+
+	link.From = strings.ToLower(strings.TrimSpace(link.From))
+	link.To = strings.ToLower(strings.TrimSpace(link.To))
+	link.Field = strings.TrimSpace(link.Field)
+	link.As = strings.TrimSpace(link.As)
+	if link.From == "" || link.Field == "" || link.To == "" {
+		return Link{}, fmt.Errorf("invalid link %q (use TABLE.FIELD=TARGET[:NAME])", spec)
+	}
+
+	return link, nil
+}
+
+// name returns the name of the value nested in records of table
+func (l Link) name(table string) string {
+	if l.As != "" {
+		return l.As
+	}
+	if table == l.From {
+		return l.To
+	}
+	return l.From
+}
+
+// MergedExport is a single JSON document holding the records of a root table
+// with the records of linked tables nested inside them
+type MergedExport struct {
+	Company     *paradox.CompanyInfo   `json:"company,omitempty"`
+	GeneratedAt time.Time              `json:"generated_at"`
+	Root        string                 `json:"root"`
+	Records     map[string]interface{} `json:"records"`
+
+	// arrayFields are the grouped array fields written inline
+	arrayFields []string
+}
+
+// Merge nests the bundle's tables into the records of the root table by
+// following links in both directions: a record referencing another table
+// holds the referenced record, and a referenced record holds the list of
+// records referencing it. Each table is nested at most once along a path, so
+// cyclic links terminate. Unresolved foreign keys are written as null.
+func (b *Bundle) Merge(root string, links []Link) (*MergedExport, error) {
+	if _, ok := b.Tables[root]; !ok {
+		return nil, fmt.Errorf("root table %s is not in the bundle", root)
+	}
+	for _, link := range links {
+		for _, table := range []string{link.From, link.To} {
+			if _, ok := b.Tables[table]; !ok {
+				return nil, fmt.Errorf("link %s.%s=%s: table %s is not in the bundle", link.From, link.Field, link.To, table)
+			}
+		}
+	}
+
+	m := &merger{bundle: b, links: links, keys: make(map[string]map[string]string), refs: make(map[int]map[string][]string)}
+	for i, link := range links {
+		if _, ok := m.keys[link.To]; !ok {
+			m.keys[link.To] = indexKeys(b.Tables[link.To])
+		}
+		m.refs[i] = indexReferences(b.Tables[link.From], link.Field)
+	}
+
+	merged := &MergedExport{
+		Company:     b.Company,
+		GeneratedAt: b.GeneratedAt,
+		Root:        root,
+		Records:     make(map[string]interface{}, len(b.Tables[root])),
+	}
+	for key := range b.Tables[root] {
+		merged.Records[key] = m.expand(root, key, map[string]bool{root: true})
+	}
+
+	for field := range b.arrayFields {
+		merged.arrayFields = append(merged.arrayFields, field)
+	}
+
+	return merged, nil
+}
+
+// merger resolves links between the tables of a bundle
+type merger struct {
+	bundle *Bundle
+	links  []Link
+	// keys maps normalized keys to record keys for each linked-to table
+	keys map[string]map[string]string
+	// refs maps normalized foreign keys to the referencing record keys for
+	// each link
+	refs map[int]map[string][]string
+}
+
+// expand returns a copy of the record of table with the given key with its
+// linked records nested; tables on the path are not nested again
+func (m *merger) expand(table, key string, path map[string]bool) interface{} {
+	value := m.bundle.Tables[table][key]
+	record, ok := value.(map[string]interface{})
+	if !ok {
+		return value
+	}
+
+	expanded := make(map[string]interface{}, len(record))
+	for field, v := range record {
+		expanded[field] = v
+	}
+
+	for i, link := range m.links {
+		switch {
+		case link.From == table && !path[link.To]:
+			fk, ok := record[link.Field]
+			if !ok || fk == nil {
+				continue
+			}
+			var nested interface{}
+			if target, ok := m.keys[link.To][normalizeKey(fk)]; ok {
+				nested = m.expand(link.To, target, withTable(path, link.To))
+			}
+			expanded[link.name(table)] = nested
+
+		case link.To == table && !path[link.From]:
+			children := m.refs[i][normalizeKey(key)]
+			list := make([]interface{}, 0, len(children))
+			for _, child := range children {
+				list = append(list, m.expand(link.From, child, withTable(path, link.From)))
+			}
+			expanded[link.name(table)] = list
+		}
+	}
+
+	return expanded
+}
+
+// withTable returns a copy of path with table added
+func withTable(path map[string]bool, table string) map[string]bool {
+	copied := make(map[string]bool, len(path)+1)
+	for t := range path {
+		copied[t] = true
+	}
+	copied[table] = true
+	return copied
+}
+
+// indexKeys maps the normalized keys of a keyed table to its record keys
+func indexKeys(records map[string]interface{}) map[string]string {
+	index := make(map[string]string, len(records))
+	for key := range records {
+		index[normalizeKey(key)] = key
+	}
+	return index
+}
+
+// indexReferences maps normalized foreign key values to the keys of the
+// records holding them, in key order
+func indexReferences(records map[string]interface{}, field string) map[string][]string {
+	index := make(map[string][]string)
+	for key, value := range records {
+		record, ok := value.(map[string]interface{})
+		if !ok || record[field] == nil {
+			continue
+		}
+		fk := normalizeKey(record[field])
+		index[fk] = append(index[fk], key)
+	}
+	for _, keys := range index {
+		sort.Slice(keys, func(i, j int) bool {
+			return compareValues(keys[i], keys[j]) < 0
+		})
+	}
+	return index
+}
+
+// normalizeKey formats a key so that numbers match numeric text (1001,
+// 1001.0, "1001" and "۱۰۰۱" are the same key)
+func normalizeKey(value interface{}) string {
+	if n, ok := numericValue(value); ok {
+		return strconv.FormatFloat(n, 'f', -1, 64)
+	}
+	return strings.TrimSpace(fmt.Sprintf("%v", value))
+}
+
+// WriteJSON writes the merged export as a JSON document
+func (m *MergedExport) WriteJSON(outputPath string) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode merged export: %w", err)
+	}
+
+	// Post-process to make ANBAR (and other grouped) arrays inline
+	output := makeArraysInline(string(data), m.arrayFields...)
+
+	if err := os.WriteFile(outputPath, []byte(output), 0644); err != nil {
+		return fmt.Errorf("failed to write merged export: %w", err)
+	}
+
+	return nil
+}
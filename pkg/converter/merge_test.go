@@ -0,0 +1,146 @@
+package converter
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/atomicdeploy/patris-export/pkg/paradox"
+)
+
+func TestParseLink(t *testing.T) {
+	link, err := ParseLink("Kala.GroupCode=Groups:Group")
+	if err != nil {
+		t.Fatalf("Failed to parse link: %v", err)
+	}
+	want := Link{From: "kala", Field: "GroupCode", To: "groups", As: "Group"}
+	if link != want {
+		t.Errorf("Expected %+v, got %+v", want, link)
+	}
+
+	for _, spec := range []string{"", "kala=groups", "kala.GroupCode", ".GroupCode=groups", "kala.=groups", "kala.GroupCode="} {
+		if _, err := ParseLink(spec); err == nil {
+			t.Errorf("Expected error for link %q", spec)
+		}
+	}
+}
+
+// mergeBundle builds a bundle of items, their groups and their stock rows
+func mergeBundle(t *testing.T) *Bundle {
+	t.Helper()
+
+	bundle := NewBundle(nil)
+	tables := map[string][]paradox.Record{
+		"kala": {
+			{"Code": 1, "Name": "Bolt", "GroupCode": 10},
+			{"Code": 2, "Name": "Nut", "GroupCode": "۱۰"},
+			{"Code": 3, "Name": "Loose", "GroupCode": 99},
+		},
+		"groups": {
+			{"Code": 10, "Name": "Hardware"},
+		},
+		"anbar": {
+			{"Code": 101, "KalaCode": 1, "Qty": 5},
+			{"Code": 100, "KalaCode": 1, "Qty": 7},
+			{"Code": 102, "KalaCode": 2, "Qty": 1},
+		},
+	}
+	for name, records := range tables {
+		if err := bundle.AddTable(name, NewExporter(nil), records); err != nil {
+			t.Fatalf("Failed to add %s: %v", name, err)
+		}
+	}
+	return bundle
+}
+
+func TestMerge(t *testing.T) {
+	links := []Link{
+		{From: "kala", Field: "GroupCode", To: "groups", As: "Group"},
+		{From: "anbar", Field: "KalaCode", To: "kala"},
+	}
+	merged, err := mergeBundle(t).Merge("kala", links)
+	if err != nil {
+		t.Fatalf("Failed to merge: %v", err)
+	}
+
+	bolt := merged.Records["1"].(map[string]interface{})
+	group, ok := bolt["Group"].(map[string]interface{})
+	if !ok || group["Name"] != "Hardware" {
+		t.Errorf("Expected Hardware group nested in item 1, got %v", bolt["Group"])
+	}
+	stock, ok := bolt["anbar"].([]interface{})
+	if !ok || len(stock) != 2 {
+		t.Fatalf("Expected 2 stock rows nested in item 1, got %v", bolt["anbar"])
+	}
+	if first := stock[0].(map[string]interface{}); first["Code"] != 100 {
+		t.Errorf("Expected stock rows in key order, got %v", stock)
+	}
+	if _, ok := stock[0].(map[string]interface{})["kala"]; ok {
+		t.Error("Stock rows nested in an item should not nest the item again")
+	}
+
+	// Persian digits in the foreign key still match
+	nut := merged.Records["2"].(map[string]interface{})
+	if group, ok := nut["Group"].(map[string]interface{}); !ok || group["Name"] != "Hardware" {
+		t.Errorf("Expected Hardware group nested in item 2, got %v", nut["Group"])
+	}
+
+	// Unresolved foreign keys are null, items without stock have an empty list
+	loose := merged.Records["3"].(map[string]interface{})
+	if value, ok := loose["Group"]; !ok || value != nil {
+		t.Errorf("Expected null group for item 3, got %v", value)
+	}
+	if stock, ok := loose["anbar"].([]interface{}); !ok || len(stock) != 0 {
+		t.Errorf("Expected empty stock list for item 3, got %v", loose["anbar"])
+	}
+
+	outputPath := filepath.Join(t.TempDir(), "merged.json")
+	if err := merged.WriteJSON(outputPath); err != nil {
+		t.Fatalf("Failed to write merged export: %v", err)
+	}
+	data, err := os.ReadFile(outputPath)
+	if err != nil {
+		t.Fatalf("Failed to read merged export: %v", err)
+	}
+	var decoded struct {
+		Root    string                            `json:"root"`
+		Records map[string]map[string]interface{} `json:"records"`
+	}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Merged export is not valid JSON: %v\n%s", err, data)
+	}
+	if decoded.Root != "kala" || len(decoded.Records) != 3 {
+		t.Errorf("Unexpected merged export: %s", data)
+	}
+}
+
+func TestMergeFromChildTable(t *testing.T) {
+	links := []Link{
+		{From: "kala", Field: "GroupCode", To: "groups"},
+		{From: "anbar", Field: "KalaCode", To: "kala"},
+	}
+	merged, err := mergeBundle(t).Merge("anbar", links)
+	if err != nil {
+		t.Fatalf("Failed to merge: %v", err)
+	}
+
+	row := merged.Records["102"].(map[string]interface{})
+	item, ok := row["kala"].(map[string]interface{})
+	if !ok || item["Name"] != "Nut" {
+		t.Fatalf("Expected item 2 nested in stock row 102, got %v", row["kala"])
+	}
+	if group, ok := item["groups"].(map[string]interface{}); !ok || group["Name"] != "Hardware" {
+		t.Errorf("Expected group nested in the nested item, got %v", item["groups"])
+	}
+}
+
+func TestMergeUnknownTable(t *testing.T) {
+	bundle := mergeBundle(t)
+	if _, err := bundle.Merge("moshtari", nil); err == nil {
+		t.Error("Expected error for unknown root table")
+	}
+	if _, err := bundle.Merge("kala", []Link{{From: "kala", Field: "GroupCode", To: "missing"}}); err == nil {
+		t.Error("Expected error for link to unknown table")
+	}
+}
@@ -0,0 +1,119 @@
+package converter
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Normalization selects Unicode normalizations applied to converted text so
+// that search and deduplication do not depend on the character map details
+type Normalization uint8
+
+const (
+	// NormalizeYeh replaces Arabic Yeh (ي) and Alef Maksura (ى) with Persian Yeh (ی)
+	NormalizeYeh Normalization = 1 << iota
+	// NormalizeKaf replaces Arabic Kaf (ك) with Persian Kaf (ک)
+	NormalizeKaf
+	// NormalizeNFC composes characters into Unicode normalization form C
+	NormalizeNFC
+
+	NormalizeNone Normalization = 0
+	NormalizeAll                = NormalizeYeh | NormalizeKaf | NormalizeNFC
+)
+
+// normalizationNames lists the normalizations in the order they are applied
+var normalizationNames = []struct {
+	name string
+	n    Normalization
+}{
+	{"yeh", NormalizeYeh},
+	{"kaf", NormalizeKaf},
+	{"nfc", NormalizeNFC},
+}
+
+var (
+	normalizationMu      sync.RWMutex
+	defaultNormalization = NormalizeNone
+)
+
+// ParseNormalization parses "none", "all" or a comma-separated list of yeh, kaf and nfc
+func ParseNormalization(spec string) (Normalization, error) {
+	var n Normalization
+
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.ToLower(strings.TrimSpace(part))
+		switch part {
+		case "", "none":
+			continue
+		case "all":
+			n |= NormalizeAll
+			continue
+		}
+
+		found := false
+		for _, known := range normalizationNames {
+			if part == known.name {
+				n |= known.n
+				found = true
+			}
+		}
+		if !found {
+			return NormalizeNone, fmt.Errorf("unknown normalization %q (use yeh, kaf, nfc, all or none)", part)
+		}
+	}
+
+	return n, nil
+}
+
+// String returns the normalizations as a comma-separated list
+func (n Normalization) String() string {
+	if n == NormalizeNone {
+		return "none"
+	}
+
+	var names []string
+	for _, known := range normalizationNames {
+		if n&known.n != 0 {
+			names = append(names, known.name)
+		}
+	}
+	return strings.Join(names, ",")
+}
+
+// SetNormalization sets the normalizations applied by Patris2Fa
+func SetNormalization(n Normalization) {
+	normalizationMu.Lock()
+	defer normalizationMu.Unlock()
+	defaultNormalization = n
+}
+
+// GetNormalization returns the normalizations applied by Patris2Fa
+func GetNormalization() Normalization {
+	normalizationMu.RLock()
+	defer normalizationMu.RUnlock()
+	return defaultNormalization
+}
+
+// Normalize applies the given normalizations to s
+func Normalize(s string, n Normalization) string {
+	if n&(NormalizeYeh|NormalizeKaf) != 0 {
+		s = strings.Map(func(r rune) rune {
+			switch {
+			case n&NormalizeYeh != 0 && (r == 'ي' || r == 'ى'):
+				return 'ی'
+			case n&NormalizeKaf != 0 && r == 'ك':
+				return 'ک'
+			}
+			return r
+		}, s)
+	}
+
+	if n&NormalizeNFC != 0 {
+		s = norm.NFC.String(s)
+	}
+
+	return s
+}
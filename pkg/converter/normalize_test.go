@@ -0,0 +1,66 @@
+package converter
+
+import (
+	"testing"
+)
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		input    string
+		n        Normalization
+		expected string
+	}{
+		{"كيك", NormalizeYeh, "كیك"},
+		{"كيك", NormalizeKaf, "کيک"},
+		{"كيك", NormalizeAll, "کیک"},
+		{"موسى", NormalizeYeh, "موسی"},
+		// Alef followed by a combining hamza above composes into أ
+		{"\u0627\u0654", NormalizeNFC, "\u0623"},
+		{"كيك", NormalizeNone, "كيك"},
+	}
+
+	for _, tt := range tests {
+		if got := Normalize(tt.input, tt.n); got != tt.expected {
+			t.Errorf("Normalize(%q, %s) = %q, want %q", tt.input, tt.n, got, tt.expected)
+		}
+	}
+}
+
+func TestParseNormalization(t *testing.T) {
+	tests := []struct {
+		spec     string
+		expected Normalization
+	}{
+		{"", NormalizeNone},
+		{"none", NormalizeNone},
+		{"all", NormalizeAll},
+		{"yeh, KAF", NormalizeYeh | NormalizeKaf},
+		{"nfc", NormalizeNFC},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseNormalization(tt.spec)
+		if err != nil {
+			t.Fatalf("ParseNormalization(%q) failed: %v", tt.spec, err)
+		}
+		if got != tt.expected {
+			t.Errorf("ParseNormalization(%q) = %s, want %s", tt.spec, got, tt.expected)
+		}
+	}
+
+	if _, err := ParseNormalization("yeh,nfd"); err == nil {
+		t.Error("Expected an error for an unknown normalization")
+	}
+}
+
+func TestPatris2FaNormalization(t *testing.T) {
+	// A character map using the Arabic Yeh and Kaf code points
+	mapping := CharMapping{0xd0: "ك", 0xe0: "ي"}
+
+	SetNormalization(NormalizeYeh | NormalizeKaf)
+	defer SetNormalization(NormalizeNone)
+
+	if got := Patris2FaWithMapping("\xe0\xd0", mapping); got != "کی" {
+		t.Errorf("Expected Persian Kaf and Yeh, got %q", got)
+	}
+}
@@ -0,0 +1,167 @@
+package converter
+
+import (
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Compression selects how text exports are compressed
+type Compression string
+
+const (
+	CompressNone Compression = ""
+	CompressGzip Compression = "gzip"
+	CompressZstd Compression = "zstd"
+)
+
+// ParseCompression parses a compression name (none, gzip/gz or zstd/zst)
+func ParseCompression(name string) (Compression, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "", "none":
+		return CompressNone, nil
+	case "gzip", "gz":
+		return CompressGzip, nil
+	case "zstd", "zst":
+		return CompressZstd, nil
+	default:
+		return "", fmt.Errorf("unknown compression %q (use gzip or zstd)", name)
+	}
+}
+
+// Ext returns the file extension appended for the compression (e.g. ".gz")
+func (c Compression) Ext() string {
+	switch c {
+	case CompressGzip:
+		return ".gz"
+	case CompressZstd:
+		return ".zst"
+	default:
+		return ""
+	}
+}
+
+// Stdout is the output path writing an export to standard output instead of
+// a file, as in convert -o -
+const Stdout = "-"
+
+// stdout receives the exports written to Stdout
+var stdout io.Writer = os.Stdout
+
+// SetCompression compresses JSON, CSV and YAML exports while they are written
+func (e *Exporter) SetCompression(c Compression) {
+	e.compression = c
+}
+
+// outputFile streams an export into a temporary file next to the target,
+// optionally compressing it, and renames it into place on Commit so readers
+// never see a partial file. An export to Stdout is written through as it is
+// produced.
+type outputFile struct {
+	file       *os.File
+	path       string
+	buf        *bufio.Writer
+	compressor io.WriteCloser
+	done       bool
+}
+
+// createOutput starts writing an export to path
+func createOutput(path string, c Compression) (*outputFile, error) {
+	out := &outputFile{path: path}
+	target := stdout
+	if path != Stdout {
+		file, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp*")
+		if err != nil {
+			return nil, err
+		}
+		out.file = file
+		target = file
+	}
+
+	var err error
+	switch c {
+	case CompressGzip:
+		out.compressor = gzip.NewWriter(target)
+	case CompressZstd:
+		out.compressor, err = zstd.NewWriter(target)
+		if err != nil {
+			if out.file != nil {
+				out.file.Close()
+				os.Remove(out.file.Name())
+			}
+			return nil, fmt.Errorf("failed to start zstd compression: %w", err)
+		}
+	}
+
+	if out.compressor != nil {
+		out.buf = bufio.NewWriter(out.compressor)
+	} else {
+		out.buf = bufio.NewWriter(target)
+	}
+
+	return out, nil
+}
+
+// Write writes export data
+func (o *outputFile) Write(p []byte) (int, error) {
+	return o.buf.Write(p)
+}
+
+// Commit finishes compression and moves the export into place
+func (o *outputFile) Commit() error {
+	if o.done {
+		return nil
+	}
+	o.done = true
+
+	err := o.buf.Flush()
+	if o.compressor != nil {
+		if cerr := o.compressor.Close(); err == nil {
+			err = cerr
+		}
+	}
+	if o.file == nil {
+		if err != nil {
+			return fmt.Errorf("failed to write to standard output: %w", err)
+		}
+		return nil
+	}
+	if cerr := o.file.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		// CreateTemp uses 0600; exports are regular files
+		err = os.Chmod(o.file.Name(), 0644)
+	}
+	if err == nil {
+		err = os.Rename(o.file.Name(), o.path)
+	}
+	if err != nil {
+		os.Remove(o.file.Name())
+		return fmt.Errorf("failed to finish output file: %w", err)
+	}
+
+	return nil
+}
+
+// Abort discards the export unless it was committed
+func (o *outputFile) Abort() {
+	if o.done {
+		return
+	}
+	o.done = true
+
+	if o.compressor != nil {
+		o.compressor.Close()
+	}
+	if o.file != nil {
+		o.file.Close()
+		os.Remove(o.file.Name())
+	}
+}
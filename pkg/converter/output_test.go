@@ -0,0 +1,109 @@
+package converter
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/atomicdeploy/patris-export/pkg/paradox"
+	"github.com/klauspost/compress/zstd"
+)
+
+func TestCompressedExport(t *testing.T) {
+	records := []paradox.Record{
+		{"Code": "1", "Name": "Item", "ANBAR1": 5},
+	}
+
+	tests := []struct {
+		compression Compression
+		open        func(io.Reader) (io.Reader, error)
+	}{
+		{CompressGzip, func(r io.Reader) (io.Reader, error) { return gzip.NewReader(r) }},
+		{CompressZstd, func(r io.Reader) (io.Reader, error) { return zstd.NewReader(r) }},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.compression), func(t *testing.T) {
+			dir := t.TempDir()
+			outputPath := filepath.Join(dir, "kala.json"+tt.compression.Ext())
+
+			exp := NewExporter(nil)
+			exp.SetCompression(tt.compression)
+			if err := exp.ExportToJSON(records, outputPath); err != nil {
+				t.Fatalf("Failed to export: %v", err)
+			}
+
+			file, err := os.Open(outputPath)
+			if err != nil {
+				t.Fatalf("Failed to open export: %v", err)
+			}
+			defer file.Close()
+
+			reader, err := tt.open(file)
+			if err != nil {
+				t.Fatalf("Export is not %s compressed: %v", tt.compression, err)
+			}
+
+			var decoded map[string]map[string]interface{}
+			if err := json.NewDecoder(reader).Decode(&decoded); err != nil {
+				t.Fatalf("Failed to decode export: %v", err)
+			}
+			if decoded["1"]["Name"] != "Item" {
+				t.Errorf("Unexpected export: %v", decoded)
+			}
+
+			// Only the final file remains; the temporary file was renamed
+			entries, _ := os.ReadDir(dir)
+			if len(entries) != 1 {
+				t.Errorf("Expected only the export in the output directory, got %d entries", len(entries))
+			}
+		})
+	}
+}
+
+func TestStdoutExport(t *testing.T) {
+	var buf bytes.Buffer
+	stdout = &buf
+	defer func() { stdout = os.Stdout }()
+
+	records := []paradox.Record{
+		{"Code": "1", "Name": "Item", "ANBAR1": 5},
+	}
+	exp := NewExporter(nil)
+	exp.SetCompression(CompressGzip)
+	if err := exp.ExportToJSON(records, Stdout); err != nil {
+		t.Fatalf("Failed to export: %v", err)
+	}
+
+	reader, err := gzip.NewReader(&buf)
+	if err != nil {
+		t.Fatalf("Output is not gzip compressed: %v", err)
+	}
+	var decoded map[string]map[string]interface{}
+	if err := json.NewDecoder(reader).Decode(&decoded); err != nil {
+		t.Fatalf("Failed to decode output: %v", err)
+	}
+	if decoded["1"]["Name"] != "Item" {
+		t.Errorf("Unexpected output: %v", decoded)
+	}
+
+	// Nothing is written to a file named -
+	if _, err := os.Stat(Stdout); !os.IsNotExist(err) {
+		t.Errorf("Expected no file named %s, got %v", Stdout, err)
+	}
+}
+
+func TestParseCompression(t *testing.T) {
+	for name, expected := range map[string]Compression{"": CompressNone, "gz": CompressGzip, "zstd": CompressZstd} {
+		if c, err := ParseCompression(name); err != nil || c != expected {
+			t.Errorf("ParseCompression(%q) = %q, %v", name, c, err)
+		}
+	}
+	if _, err := ParseCompression("bzip2"); err == nil {
+		t.Error("Expected error for unsupported compression")
+	}
+}
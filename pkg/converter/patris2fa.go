@@ -4,22 +4,40 @@ import (
 	"bufio"
 	"encoding/hex"
 	"fmt"
-	"os"
 	"regexp"
 	"strings"
+
+	"github.com/atomicdeploy/patris-export/pkg/resilient"
 )
 
 // CharMapping holds the Patris to Farsi character mappings
 type CharMapping map[byte]string
 
+// ZWNJMode selects how [zwnj] markers of word-ending glyphs are rendered
+type ZWNJMode string
+
+const (
+	// ZWNJSpace renders every marker as a space (می شود)
+	ZWNJSpace ZWNJMode = "space"
+	// ZWNJChar keeps real spaces but renders a marker directly followed by a
+	// letter as U+200C ZERO WIDTH NON-JOINER (می‌شود)
+	ZWNJChar ZWNJMode = "zwnj"
+)
+
 var (
-	defaultMapping CharMapping
 	dashFixEnabled = true
+	zwnjMode       = ZWNJSpace
+
+	zwnjSpaceRegex  = regexp.MustCompile(`\[zwnj\]\s*`)
+	zwnjBreakRegex  = regexp.MustCompile(`\[zwnj\]\s+`)
+	zwnjLetterRegex = regexp.MustCompile(`\[zwnj\](\p{Arabic})`)
+	zwnjMarkerRegex = regexp.MustCompile(`\[zwnj\]`)
+	whitespaceRegex = regexp.MustCompile(`\s+`)
 )
 
 // LoadCharMapping loads the character mapping from a file
 func LoadCharMapping(filename string) (CharMapping, error) {
-	file, err := os.Open(filename)
+	file, err := resilient.Open(filename)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open character mapping file: %w", err)
 	}
@@ -61,14 +79,15 @@ func LoadCharMapping(filename string) (CharMapping, error) {
 	return mapping, nil
 }
 
-// SetDefaultMapping sets the default character mapping
+// SetDefaultMapping sets a custom Patris character mapping as the default
 func SetDefaultMapping(mapping CharMapping) {
-	defaultMapping = mapping
+	SetDefaultCharMap(&CharMap{Name: "custom", Description: "Custom mapping file", Mapping: mapping})
 }
 
-// Patris2Fa converts Patris-encoded text to Farsi/Persian
+// Patris2Fa converts text in the default character map's encoding (Patris81
+// unless changed with SetDefaultCharMap) to Farsi/Persian
 func Patris2Fa(value string) string {
-	return Patris2FaWithMapping(value, defaultMapping)
+	return DefaultCharMap().Convert(value)
 }
 
 // Patris2FaWithMapping converts Patris81-encoded text to Persian/Farsi
@@ -86,9 +105,10 @@ func Patris2Fa(value string) string {
 // 3. Map Patris bytes to UTF-8 Persian characters
 // 4. Re-reverse digit sequences to restore correct number order
 // 5. Clean up spacing and zero-width non-joiners
+// 6. Apply the configured Unicode normalizations (SetNormalization)
 func Patris2FaWithMapping(value string, mapping CharMapping) string {
 	if mapping == nil {
-		mapping = defaultMapping
+		mapping = DefaultCharMap().Mapping
 	}
 
 	valueBytes := []byte(value)
@@ -121,15 +141,22 @@ func Patris2FaWithMapping(value string, mapping CharMapping) string {
 	// Step 4: No digit re-reversal needed
 	// Since Persian digit bytes (0xF3-0xFC) are not reversed in step 2,
 	// they map directly to the correct digit order
-	result := output.String()
+	return cleanText(output.String())
+}
 
+// cleanText renders [zwnj] markers, collapses whitespace and applies the
+// configured Unicode normalizations (steps 5 and 6 of Patris2FaWithMapping)
+func cleanText(result string) string {
 	// Step 5: Clean up formatting
-	// Replace [zwnj] markers with spaces for proper Persian word spacing
-	result = regexp.MustCompile(`\[zwnj\]\s*`).ReplaceAllString(result, " ")
+	// Replace [zwnj] markers for proper Persian word spacing
+	result = replaceZWNJMarkers(result, zwnjMode)
 	// Normalize whitespace
-	result = regexp.MustCompile(`\s+`).ReplaceAllString(result, " ")
+	result = whitespaceRegex.ReplaceAllString(result, " ")
 	result = strings.TrimSpace(result)
 
+	// Step 6: Apply the configured Unicode normalizations
+	result = Normalize(result, GetNormalization())
+
 	return result
 }
 
@@ -223,6 +250,36 @@ func reverseString(s string) string {
 	return string(bytes)
 }
 
+// replaceZWNJMarkers renders the [zwnj] markers of word-ending glyphs
+func replaceZWNJMarkers(s string, mode ZWNJMode) string {
+	if mode != ZWNJChar {
+		return zwnjSpaceRegex.ReplaceAllString(s, " ")
+	}
+
+	// Markers before whitespace end a word, markers inside a word become
+	// U+200C, and the rest (before punctuation or at the end) are dropped
+	s = zwnjBreakRegex.ReplaceAllString(s, " ")
+	s = zwnjLetterRegex.ReplaceAllString(s, "\u200c$1")
+	return zwnjMarkerRegex.ReplaceAllString(s, "")
+}
+
+// ParseZWNJMode parses a ZWNJ mode name (space or zwnj)
+func ParseZWNJMode(name string) (ZWNJMode, error) {
+	switch mode := ZWNJMode(strings.ToLower(strings.TrimSpace(name))); mode {
+	case ZWNJSpace, ZWNJChar:
+		return mode, nil
+	case "":
+		return ZWNJSpace, nil
+	default:
+		return "", fmt.Errorf("unknown ZWNJ mode %q (use space or zwnj)", name)
+	}
+}
+
+// SetZWNJMode selects how Patris2Fa renders zero-width non-joiner markers
+func SetZWNJMode(mode ZWNJMode) {
+	zwnjMode = mode
+}
+
 // SetDashFix enables or disables dash fix
 func SetDashFix(enabled bool) {
 	dashFixEnabled = enabled
@@ -131,3 +131,45 @@ func TestSetDashFix(t *testing.T) {
 		t.Error("Dash fix should be enabled")
 	}
 }
+
+func TestZWNJMode(t *testing.T) {
+	mapping := CharMapping{
+		0xd6: "م",
+		0xdf: "ی[zwnj]",
+		0xbc: "ش",
+		0xd9: "و",
+		0xb4: "د",
+	}
+
+	// Inputs are in Patris visual byte order
+	tests := []struct {
+		name  string
+		input string
+		space string
+		zwnj  string
+	}{
+		{"inside a word", "\xb4\xd9\xbc\xdf\xd6!", "می شود!", "می\u200cشود!"},
+		{"before a space", "\xb4\xd9\xbc \xdf\xd6", "می شود", "می شود"},
+		{"at the end", "\xdf\xd6", "می", "می"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer SetZWNJMode(ZWNJSpace)
+
+			SetZWNJMode(ZWNJSpace)
+			if got := Patris2FaWithMapping(tt.input, mapping); got != tt.space {
+				t.Errorf("space mode: got %q, want %q", got, tt.space)
+			}
+
+			SetZWNJMode(ZWNJChar)
+			if got := Patris2FaWithMapping(tt.input, mapping); got != tt.zwnj {
+				t.Errorf("zwnj mode: got %q, want %q", got, tt.zwnj)
+			}
+		})
+	}
+
+	if _, err := ParseZWNJMode("nbsp"); err == nil {
+		t.Error("Expected an error for an unknown ZWNJ mode")
+	}
+}
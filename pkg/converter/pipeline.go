@@ -0,0 +1,244 @@
+package converter
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+
+	"github.com/Knetic/govaluate"
+)
+
+// Transform pipeline operations
+const (
+	OpDrop    = "drop"
+	OpRename  = "rename"
+	OpGroup   = "group"
+	OpCompute = "compute"
+	OpCoerce  = "coerce"
+)
+
+// TransformStep is one step of a profile's transform pipeline. Op selects what
+// the step does; the other fields are its parameters:
+//   - drop: removes Fields and every field matching Pattern
+//   - rename: renames Field to To
+//   - group: collects the fields matching Pattern, whose first capture group is
+//     a 1-based index, into the array Into (padded with 0 to at least Count)
+//   - compute: sets Field to the result of Expr, an expression over the
+//     record's fields such as "FOROSH * ALLANBAR"
+//   - coerce: converts Field, or every element of an array, to To (int,
+//     float, string or bool)
+type TransformStep struct {
+	Op      string   `yaml:"op" json:"op"`
+	Field   string   `yaml:"field,omitempty" json:"field,omitempty"`
+	Fields  []string `yaml:"fields,omitempty" json:"fields,omitempty"`
+	Pattern string   `yaml:"pattern,omitempty" json:"pattern,omitempty"`
+	To      string   `yaml:"to,omitempty" json:"to,omitempty"`
+	Into    string   `yaml:"into,omitempty" json:"into,omitempty"`
+	Count   int      `yaml:"count,omitempty" json:"count,omitempty"`
+	Expr    string   `yaml:"expr,omitempty" json:"expr,omitempty"`
+}
+
+// pipeline is a compiled transform pipeline
+type pipeline []compiledStep
+
+// compiledStep is a transform step with its pattern and expression compiled
+type compiledStep struct {
+	TransformStep
+	pattern *regexp.Regexp
+	expr    *govaluate.EvaluableExpression
+	drop    map[string]bool
+}
+
+// compilePipeline validates and compiles transform steps
+func compilePipeline(steps []TransformStep) (pipeline, error) {
+	compiled := make(pipeline, len(steps))
+
+	for i, step := range steps {
+		c := compiledStep{TransformStep: step}
+
+		if step.Pattern != "" {
+			pattern, err := regexp.Compile(step.Pattern)
+			if err != nil {
+				return nil, fmt.Errorf("step %d (%s): invalid pattern: %w", i+1, step.Op, err)
+			}
+			c.pattern = pattern
+		}
+
+		switch step.Op {
+		case OpDrop:
+			if len(step.Fields) == 0 && c.pattern == nil {
+				return nil, fmt.Errorf("step %d (drop): fields or pattern is required", i+1)
+			}
+			c.drop = make(map[string]bool, len(step.Fields))
+			for _, field := range step.Fields {
+				c.drop[field] = true
+			}
+		case OpRename:
+			if step.Field == "" || step.To == "" {
+				return nil, fmt.Errorf("step %d (rename): field and to are required", i+1)
+			}
+		case OpGroup:
+			if c.pattern == nil || step.Into == "" {
+				return nil, fmt.Errorf("step %d (group): pattern and into are required", i+1)
+			}
+			if c.pattern.NumSubexp() < 1 {
+				return nil, fmt.Errorf("step %d (group): pattern needs a capture group for the index", i+1)
+			}
+		case OpCompute:
+			if step.Field == "" || step.Expr == "" {
+				return nil, fmt.Errorf("step %d (compute): field and expr are required", i+1)
+			}
+			expr, err := govaluate.NewEvaluableExpression(step.Expr)
+			if err != nil {
+				return nil, fmt.Errorf("step %d (compute): invalid expression: %w", i+1, err)
+			}
+			c.expr = expr
+		case OpCoerce:
+			switch step.To {
+			case "int", "float", "string", "bool":
+			default:
+				return nil, fmt.Errorf("step %d (coerce): unknown type %q (use int, float, string or bool)", i+1, step.To)
+			}
+			if step.Field == "" {
+				return nil, fmt.Errorf("step %d (coerce): field is required", i+1)
+			}
+		default:
+			return nil, fmt.Errorf("step %d: unknown op %q (use drop, rename, group, compute or coerce)", i+1, step.Op)
+		}
+
+		compiled[i] = c
+	}
+
+	return compiled, nil
+}
+
+// apply runs the pipeline on a record in place
+func (p pipeline) apply(record map[string]interface{}) {
+	for _, step := range p {
+		switch step.Op {
+		case OpDrop:
+			for key := range record {
+				if step.drop[key] || (step.pattern != nil && step.pattern.MatchString(key)) {
+					delete(record, key)
+				}
+			}
+
+		case OpRename:
+			if value, ok := record[step.Field]; ok {
+				delete(record, step.Field)
+				record[step.To] = value
+			}
+
+		case OpGroup:
+			step.group(record)
+
+		case OpCompute:
+			// Fields the expression cannot be evaluated for are left unset
+			if value, err := step.expr.Eval(filterParameters{record: record}); err == nil {
+				record[step.Field] = value
+			}
+
+		case OpCoerce:
+			value, ok := record[step.Field]
+			if !ok {
+				continue
+			}
+			if array, ok := value.([]interface{}); ok {
+				for i, element := range array {
+					array[i] = coerceValue(element, step.To)
+				}
+			} else {
+				record[step.Field] = coerceValue(value, step.To)
+			}
+		}
+	}
+}
+
+// outputName returns the name a source field has after the pipeline, or
+// false if the field is dropped. Grouped fields take the array's name.
+func (p pipeline) outputName(field string) (string, bool) {
+	for _, step := range p {
+		switch step.Op {
+		case OpDrop:
+			if step.drop[field] || (step.pattern != nil && step.pattern.MatchString(field)) {
+				return "", false
+			}
+		case OpRename:
+			if field == step.Field {
+				field = step.To
+			}
+		case OpGroup:
+			if step.pattern.MatchString(field) {
+				field = step.Into
+			}
+		}
+	}
+	return field, true
+}
+
+// group replaces the numbered fields matched by the step with an array sorted
+// by field number (1-indexed fields -> 0-indexed array)
+func (s compiledStep) group(record map[string]interface{}) {
+	values := make(map[int]interface{})
+	maxNum := 0
+
+	for key, value := range record {
+		m := s.pattern.FindStringSubmatch(key)
+		if m == nil {
+			continue
+		}
+		delete(record, key)
+
+		if num, err := strconv.Atoi(m[1]); err == nil && num > 0 {
+			values[num] = value
+			if num > maxNum {
+				maxNum = num
+			}
+		}
+	}
+
+	if len(values) == 0 {
+		return
+	}
+	if s.Count > maxNum {
+		maxNum = s.Count
+	}
+
+	array := make([]interface{}, maxNum)
+	for n := 1; n <= maxNum; n++ {
+		if value, ok := values[n]; ok {
+			array[n-1] = value
+		} else {
+			array[n-1] = 0
+		}
+	}
+	record[s.Into] = array
+}
+
+// Steps returns the profile's transform pipeline. Profiles without an explicit
+// pipeline get the steps equivalent to their drop prefixes, arrays and coercions.
+func (p *Profile) Steps() []TransformStep {
+	if len(p.Pipeline) > 0 {
+		return p.Pipeline
+	}
+
+	var steps []TransformStep
+	for _, prefix := range p.DropPrefixes {
+		steps = append(steps, TransformStep{Op: OpDrop, Pattern: `^` + regexp.QuoteMeta(prefix)})
+	}
+	for _, group := range p.Arrays {
+		steps = append(steps, group.step())
+	}
+
+	fields := make([]string, 0, len(p.Coercions))
+	for field := range p.Coercions {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	for _, field := range fields {
+		steps = append(steps, TransformStep{Op: OpCoerce, Field: field, To: p.Coercions[field]})
+	}
+
+	return steps
+}
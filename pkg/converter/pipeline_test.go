@@ -0,0 +1,133 @@
+package converter
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/atomicdeploy/patris-export/pkg/paradox"
+)
+
+func TestPipelineSteps(t *testing.T) {
+	profile := &Profile{
+		Name:     "custom",
+		KeyField: "Code",
+		Pipeline: []TransformStep{
+			{Op: OpDrop, Fields: []string{"Tmp"}, Pattern: `^Sort`},
+			{Op: OpRename, Field: "Name", To: "Title"},
+			{Op: OpGroup, Pattern: `^Q(\d+)$`, Into: "Qty", Count: 3},
+			{Op: OpCompute, Field: "Value", Expr: "Price * Total"},
+			{Op: OpCoerce, Field: "Qty", To: "string"},
+		},
+	}
+	if err := profile.Validate(); err != nil {
+		t.Fatalf("Profile should be valid: %v", err)
+	}
+
+	exp := NewExporter(nil)
+	exp.SetProfile(profile)
+	result := exp.TransformRecords([]paradox.Record{{
+		"Code": "7", "Name": "پیچ", "Tmp": 1, "Sort1": 2,
+		"Q1": 4, "Q2": 5, "Price": 2.5, "Total": 4,
+	}})
+
+	want := map[string]interface{}{
+		"Code":  "7",
+		"Title": "پیچ",
+		"Qty":   []interface{}{"4", "5", "0"},
+		"Price": 2.5,
+		"Total": 4,
+		"Value": 10.0,
+	}
+	if got := result["7"]; !reflect.DeepEqual(got, want) {
+		t.Errorf("Unexpected record:\n got %#v\nwant %#v", got, want)
+	}
+}
+
+func TestPipelineComputeMissingField(t *testing.T) {
+	profile := &Profile{
+		Name:     "custom",
+		KeyField: "Code",
+		Pipeline: []TransformStep{{Op: OpCompute, Field: "Value", Expr: "Price * Total"}},
+	}
+
+	exp := NewExporter(nil)
+	exp.SetProfile(profile)
+	record := exp.TransformRecords([]paradox.Record{{"Code": "1", "Price": 2.0}})["1"].(map[string]interface{})
+	if _, ok := record["Value"]; ok {
+		t.Errorf("Value should not be set when Total is missing, got %v", record["Value"])
+	}
+}
+
+func TestInvalidPipeline(t *testing.T) {
+	tests := []TransformStep{
+		{Op: "explode"},
+		{Op: OpDrop},
+		{Op: OpRename, Field: "Name"},
+		{Op: OpGroup, Pattern: `^Q\d+$`, Into: "Qty"},
+		{Op: OpGroup, Pattern: `^Q(\d+`, Into: "Qty"},
+		{Op: OpCompute, Field: "Value", Expr: "Price *"},
+		{Op: OpCoerce, Field: "Code", To: "date"},
+	}
+
+	for _, step := range tests {
+		profile := &Profile{Name: "bad", KeyField: "Code", Pipeline: []TransformStep{step}}
+		if err := profile.Validate(); err == nil {
+			t.Errorf("Expected an error for step %+v", step)
+		}
+	}
+}
+
+func TestDerivedSteps(t *testing.T) {
+	kala, _ := LookupProfile("kala")
+	steps := kala.Steps()
+
+	if steps[0].Op != OpDrop || steps[1].Op != OpGroup || steps[1].Into != "ANBAR" || steps[1].Count != 10 {
+		t.Errorf("Unexpected derived steps: %+v", steps)
+	}
+	for _, step := range steps[2:] {
+		if step.Op != OpCoerce {
+			t.Errorf("Expected coercions after the array groups, got %+v", step)
+		}
+	}
+}
+
+func TestLoadPipelineProfile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "stock.yaml")
+	content := `key_field: Code
+pipeline:
+  - op: drop
+    pattern: ^Sort
+  - op: group
+    pattern: ^ANBAR(\d+)$
+    into: stock
+  - op: compute
+    field: in_stock
+    expr: ALLANBAR > 0
+`
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write profile: %v", err)
+	}
+
+	profile, err := LoadProfile(path)
+	if err != nil {
+		t.Fatalf("Failed to load profile: %v", err)
+	}
+
+	exp := NewExporter(nil)
+	exp.SetProfile(profile)
+	record := exp.TransformRecords([]paradox.Record{
+		{"Code": "1", "Sort": 1, "ANBAR1": 2, "ANBAR2": 3, "ALLANBAR": 5},
+	})["1"].(map[string]interface{})
+
+	if !reflect.DeepEqual(record["stock"], []interface{}{2, 3}) {
+		t.Errorf("Unexpected stock array: %v", record["stock"])
+	}
+	if record["in_stock"] != true {
+		t.Errorf("Expected in_stock = true, got %v", record["in_stock"])
+	}
+	if _, ok := record["Sort"]; ok {
+		t.Error("Sort should be dropped")
+	}
+}
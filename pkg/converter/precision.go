@@ -0,0 +1,153 @@
+package converter
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// RoundingMode selects how numbers are rounded to a number of decimal places
+type RoundingMode string
+
+const (
+	// RoundHalfUp rounds halves away from zero (2.345 -> 2.35, -2.345 -> -2.35)
+	RoundHalfUp RoundingMode = "half-up"
+	// RoundHalfEven rounds halves to the nearest even digit, also known as
+	// banker's rounding (2.345 -> 2.34, 2.355 -> 2.36)
+	RoundHalfEven RoundingMode = "half-even"
+)
+
+// ParseRoundingMode parses a rounding mode name (half-up, half-even or bankers)
+func ParseRoundingMode(name string) (RoundingMode, error) {
+	switch mode := RoundingMode(strings.ToLower(strings.TrimSpace(name))); mode {
+	case "", RoundHalfUp:
+		return RoundHalfUp, nil
+	case RoundHalfEven, "bankers":
+		return RoundHalfEven, nil
+	default:
+		return "", fmt.Errorf("unknown rounding mode %q (use half-up or half-even)", name)
+	}
+}
+
+// NumberFormat controls how number and currency values are exported
+type NumberFormat struct {
+	// Places rounds values to this many decimal places; negative keeps the
+	// stored precision
+	Places int
+	// Rounding selects how halves are rounded (default: half-up)
+	Rounding RoundingMode
+	// AsString writes values as decimal strings with exactly Places decimals
+	// (e.g. "1999.90") instead of numbers
+	AsString bool
+}
+
+// SetNumberFormat sets how float values (number and currency fields) are
+// exported; the profile's decimals override the places per field
+func (e *Exporter) SetNumberFormat(format NumberFormat) {
+	e.numbers = &format
+}
+
+// numberFormatter returns the function formatting the float values of a
+// field, or nil if floats are kept as stored
+func (e *Exporter) numberFormatter() func(field string, value float64) interface{} {
+	profile := e.Profile()
+	if e.numbers == nil && len(profile.Decimals) == 0 {
+		return nil
+	}
+
+	format := NumberFormat{Places: -1}
+	if e.numbers != nil {
+		format = *e.numbers
+	}
+
+	return func(field string, value float64) interface{} {
+		f := format
+		if places, ok := profile.Decimals[field]; ok {
+			f.Places = places
+		}
+		return f.Format(value)
+	}
+}
+
+// Format rounds a value and returns it as a float64, or as a string with
+// AsString
+func (f NumberFormat) Format(value float64) interface{} {
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		return value
+	}
+
+	var s string
+	if f.Places < 0 {
+		if !f.AsString {
+			return value
+		}
+		s = strconv.FormatFloat(value, 'f', -1, 64)
+	} else {
+		s = roundDecimal(value, f.Places, f.Rounding)
+	}
+
+	if f.AsString {
+		return s
+	}
+	rounded, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return value
+	}
+	return rounded
+}
+
+// roundDecimal rounds a value to places decimals and formats it with exactly
+// that many decimals. It rounds the shortest decimal representation of the
+// value, so 2.675 is rounded as written rather than as 2.67499999...
+func roundDecimal(value float64, places int, mode RoundingMode) string {
+	digits := strconv.FormatFloat(math.Abs(value), 'f', -1, 64)
+	intPart, frac, _ := strings.Cut(digits, ".")
+
+	if len(frac) <= places {
+		frac += strings.Repeat("0", places-len(frac))
+		return withSign(value < 0, intPart, frac)
+	}
+
+	kept := []byte(intPart + frac[:places])
+	next, rest := frac[places], strings.Trim(frac[places+1:], "0")
+
+	up := false
+	switch {
+	case next > '5':
+		up = true
+	case next == '5' && rest != "":
+		up = true
+	case next == '5' && mode == RoundHalfEven:
+		up = (kept[len(kept)-1]-'0')%2 == 1
+	case next == '5':
+		up = true
+	}
+
+	if up {
+		i := len(kept) - 1
+		for ; i >= 0 && kept[i] == '9'; i-- {
+			kept[i] = '0'
+		}
+		if i >= 0 {
+			kept[i]++
+		} else {
+			kept = append([]byte{'1'}, kept...)
+		}
+	}
+
+	split := len(kept) - places
+	return withSign(value < 0, string(kept[:split]), string(kept[split:]))
+}
+
+// withSign joins the parts of a decimal number, without a sign for zero
+func withSign(negative bool, intPart, frac string) string {
+	s := intPart
+	if frac != "" {
+		s += "." + frac
+	}
+	if negative && strings.Trim(intPart+frac, "0") != "" {
+		s = "-" + s
+	}
+	return s
+}
@@ -0,0 +1,100 @@
+package converter
+
+import (
+	"testing"
+
+	"github.com/atomicdeploy/patris-export/pkg/paradox"
+)
+
+func TestRoundDecimal(t *testing.T) {
+	tests := []struct {
+		value  float64
+		places int
+		mode   RoundingMode
+		want   string
+	}{
+		{1999.9999999, 2, RoundHalfUp, "2000.00"},
+		{2.675, 2, RoundHalfUp, "2.68"},
+		{2.345, 2, RoundHalfUp, "2.35"},
+		{2.345, 2, RoundHalfEven, "2.34"},
+		{2.355, 2, RoundHalfEven, "2.36"},
+		{2.3451, 2, RoundHalfEven, "2.35"},
+		{-2.345, 2, RoundHalfUp, "-2.35"},
+		{-0.001, 2, RoundHalfUp, "0.00"},
+		{0.5, 0, RoundHalfEven, "0"},
+		{1.5, 0, RoundHalfEven, "2"},
+		{99.95, 1, RoundHalfUp, "100.0"},
+		{12, 3, RoundHalfUp, "12.000"},
+		{1e21, 2, RoundHalfUp, "1000000000000000000000.00"},
+	}
+
+	for _, tt := range tests {
+		if got := roundDecimal(tt.value, tt.places, tt.mode); got != tt.want {
+			t.Errorf("roundDecimal(%v, %d, %s) = %s, want %s", tt.value, tt.places, tt.mode, got, tt.want)
+		}
+	}
+}
+
+func TestParseRoundingMode(t *testing.T) {
+	for name, want := range map[string]RoundingMode{"": RoundHalfUp, "half-up": RoundHalfUp, "Half-Even": RoundHalfEven, "bankers": RoundHalfEven} {
+		got, err := ParseRoundingMode(name)
+		if err != nil || got != want {
+			t.Errorf("ParseRoundingMode(%q) = %s, %v; want %s", name, got, err, want)
+		}
+	}
+	if _, err := ParseRoundingMode("down"); err == nil {
+		t.Error("Expected error for unknown rounding mode")
+	}
+}
+
+func TestNumberFormat(t *testing.T) {
+	if got := (NumberFormat{Places: 2}).Format(1999.9999999); got != 2000.0 {
+		t.Errorf("Expected 2000, got %v", got)
+	}
+	if got := (NumberFormat{Places: 2, AsString: true}).Format(1999.9); got != "1999.90" {
+		t.Errorf("Expected \"1999.90\", got %v", got)
+	}
+	if got := (NumberFormat{Places: -1, AsString: true}).Format(0.1); got != "0.1" {
+		t.Errorf("Expected \"0.1\", got %v", got)
+	}
+	if got := (NumberFormat{Places: -1}).Format(0.30000000000000004); got != 0.30000000000000004 {
+		t.Errorf("Expected the stored value, got %v", got)
+	}
+}
+
+func TestExporterNumberFormat(t *testing.T) {
+	records := []paradox.Record{{"Code": 1, "FOROSH": 1999.9999999, "KHARYD": 12.345, "ANBAR1": 3.0}}
+
+	// Without options, values are kept as stored
+	exp := NewExporter(nil)
+	if got := exp.convertRecords(records)[0]["FOROSH"]; got != 1999.9999999 {
+		t.Errorf("Expected the stored value, got %v", got)
+	}
+
+	profile := *DefaultProfile
+	profile.Decimals = map[string]int{"KHARYD": 1}
+	exp.SetProfile(&profile)
+	exp.SetNumberFormat(NumberFormat{Places: 2, Rounding: RoundHalfEven})
+
+	converted := exp.convertRecords(records)[0]
+	if converted["FOROSH"] != 2000.0 {
+		t.Errorf("Expected FOROSH 2000, got %v", converted["FOROSH"])
+	}
+	if converted["KHARYD"] != 12.3 {
+		t.Errorf("Expected KHARYD rounded to the profile's 1 decimal, got %v", converted["KHARYD"])
+	}
+	if converted["Code"] != 1 {
+		t.Errorf("Expected integer fields unchanged, got %v", converted["Code"])
+	}
+
+	// Profile coercions still turn whole decimal strings into integers
+	exp.SetNumberFormat(NumberFormat{Places: 2, AsString: true})
+	exp.SetProfile(ProfileForFile("kala.db"))
+	transformed := exp.ConvertAndTransformRecords(records)["1"].(map[string]interface{})
+	if transformed["FOROSH"] != "2000.00" {
+		t.Errorf("Expected FOROSH as \"2000.00\", got %#v", transformed["FOROSH"])
+	}
+	if anbar := transformed["ANBAR"].([]interface{}); anbar[0] != int64(3) {
+		t.Errorf("Expected ANBAR coerced to int, got %#v", anbar[0])
+	}
+}
@@ -0,0 +1,374 @@
+package converter
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/atomicdeploy/patris-export/pkg/resilient"
+	"gopkg.in/yaml.v3"
+)
+
+// ArrayGroup combines numbered fields (e.g. ANBAR1..ANBAR10) into one array field
+type ArrayGroup struct {
+	// Name is the output field holding the array
+	Name string `yaml:"name" json:"name"`
+	// Prefix matches the numbered source fields (Prefix followed by digits)
+	Prefix string `yaml:"prefix,omitempty" json:"prefix,omitempty"`
+	// Pattern is a regular expression used instead of Prefix; its first
+	// capture group is the 1-based element number (e.g. ^KHARID_(\d+)$)
+	Pattern string `yaml:"pattern,omitempty" json:"pattern,omitempty"`
+	// Count pads the array to at least this many elements (0 uses the highest number found)
+	Count int `yaml:"count,omitempty" json:"count,omitempty"`
+}
+
+// Profile describes how records of a Patris table are transformed for output
+type Profile struct {
+	Name        string `yaml:"name" json:"name"`
+	Description string `yaml:"description,omitempty" json:"description,omitempty"`
+	// Files lists the table file names (without extension) the profile is selected for
+	Files []string `yaml:"files,omitempty" json:"files,omitempty"`
+	// KeyField is the field whose value keys the exported records
+	KeyField string `yaml:"key_field" json:"key_field"`
+	// DropPrefixes removes fields whose name starts with any of these prefixes
+	DropPrefixes []string `yaml:"drop_prefixes,omitempty" json:"drop_prefixes,omitempty"`
+	// Arrays combines numbered fields into arrays
+	Arrays []ArrayGroup `yaml:"arrays,omitempty" json:"arrays,omitempty"`
+	// Coercions converts field values to int, float, string or bool. Keys are
+	// field names or array group names (applied to every element).
+	Coercions map[string]string `yaml:"coercions,omitempty" json:"coercions,omitempty"`
+	// Pipeline lists transform steps applied in order. When set, it replaces
+	// DropPrefixes, Arrays and Coercions.
+	Pipeline []TransformStep `yaml:"pipeline,omitempty" json:"pipeline,omitempty"`
+	// CharMaps converts the text of these fields (table field names, e.g.
+	// Sharh1) with a named character map instead of the default one
+	CharMaps map[string]string `yaml:"charmaps,omitempty" json:"charmaps,omitempty"`
+	// Decimals rounds the number and currency values of these fields (table
+	// field names) to a number of decimal places, overriding --decimals
+	Decimals map[string]int `yaml:"decimals,omitempty" json:"decimals,omitempty"`
+}
+
+// DefaultProfile is used for tables without a built-in profile
+var DefaultProfile = &Profile{
+	Name:         "default",
+	Description:  "Generic Patris table keyed by Code",
+	KeyField:     "Code",
+	DropPrefixes: []string{"Sort"},
+	Arrays:       []ArrayGroup{{Name: "ANBAR", Prefix: "ANBAR"}},
+}
+
+// builtinProfiles holds the conventions of the standard Patris81 tables
+var builtinProfiles = map[string]*Profile{
+	"kala": {
+		Name:         "kala",
+		Description:  "Items: stock per warehouse in ANBAR1-ANBAR10, total in ALLANBAR",
+		Files:        []string{"kala"},
+		KeyField:     "Code",
+		DropPrefixes: []string{"Sort"},
+		Arrays:       []ArrayGroup{{Name: "ANBAR", Prefix: "ANBAR", Count: 10}},
+		Coercions: map[string]string{
+			"ANBAR":    "int",
+			"ALLANBAR": "int",
+			"Sefaresh": "int",
+			"Serial":   "string",
+			"Serial2":  "string",
+			"Dates":    "string",
+		},
+	},
+	"moshtari": {
+		Name:         "moshtari",
+		Description:  "Customers and suppliers",
+		Files:        []string{"moshtari", "moshtary"},
+		KeyField:     "Code",
+		DropPrefixes: []string{"Sort"},
+	},
+	"factor": {
+		Name:         "factor",
+		Description:  "Sales and purchase invoices",
+		Files:        []string{"factor", "faktor"},
+		KeyField:     "Code",
+		DropPrefixes: []string{"Sort"},
+	},
+	"anbar": {
+		Name:         "anbar",
+		Description:  "Warehouses referenced by the ANBAR columns of kala",
+		Files:        []string{"anbar"},
+		KeyField:     "Code",
+		DropPrefixes: []string{"Sort"},
+	},
+}
+
+// Profiles returns the built-in profiles sorted by name
+func Profiles() []*Profile {
+	profiles := make([]*Profile, 0, len(builtinProfiles))
+	for _, p := range builtinProfiles {
+		profiles = append(profiles, p)
+	}
+	sort.Slice(profiles, func(i, j int) bool { return profiles[i].Name < profiles[j].Name })
+	return profiles
+}
+
+// LookupProfile returns a built-in profile by name
+func LookupProfile(name string) (*Profile, bool) {
+	p, ok := builtinProfiles[strings.ToLower(name)]
+	return p, ok
+}
+
+// ProfileForFile selects the built-in profile matching a table file name,
+// falling back to DefaultProfile
+func ProfileForFile(path string) *Profile {
+	base := strings.ToLower(strings.TrimSuffix(filepath.Base(path), filepath.Ext(path)))
+	for _, p := range builtinProfiles {
+		for _, file := range p.Files {
+			if base == file {
+				return p
+			}
+		}
+	}
+	return DefaultProfile
+}
+
+// LoadProfile loads a profile from a YAML (or JSON) file
+func LoadProfile(path string) (*Profile, error) {
+	data, err := resilient.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read profile: %w", err)
+	}
+
+	p := &Profile{}
+	if err := yaml.Unmarshal(data, p); err != nil {
+		return nil, fmt.Errorf("failed to parse profile %s: %w", path, err)
+	}
+
+	if p.Name == "" {
+		p.Name = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	}
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
+
+// ResolveProfile selects the profile for a table: a built-in profile name or a
+// profile file when override is set, otherwise the built-in matching the file name
+func ResolveProfile(override, tablePath string) (*Profile, error) {
+	if override == "" {
+		return ProfileForFile(tablePath), nil
+	}
+	if p, ok := LookupProfile(override); ok {
+		return p, nil
+	}
+	if override == DefaultProfile.Name {
+		return DefaultProfile, nil
+	}
+	if _, err := os.Stat(override); err == nil {
+		return LoadProfile(override)
+	}
+	return nil, fmt.Errorf("unknown profile %q (not a built-in profile or a profile file)", override)
+}
+
+// Validate checks that the profile can be applied
+func (p *Profile) Validate() error {
+	if p.KeyField == "" {
+		return fmt.Errorf("profile %s: key_field is required", p.Name)
+	}
+	for _, group := range p.Arrays {
+		if group.Name == "" || (group.Prefix == "" && group.Pattern == "") {
+			return fmt.Errorf("profile %s: array groups need a name and a prefix or pattern", p.Name)
+		}
+	}
+	for field, kind := range p.Coercions {
+		switch kind {
+		case "int", "float", "string", "bool":
+		default:
+			return fmt.Errorf("profile %s: unknown coercion %q for %s (use int, float, string or bool)", p.Name, kind, field)
+		}
+	}
+	if _, err := compilePipeline(p.Steps()); err != nil {
+		return fmt.Errorf("profile %s: %w", p.Name, err)
+	}
+	for field, name := range p.CharMaps {
+		if _, err := LookupCharMap(name); err != nil {
+			return fmt.Errorf("profile %s: field %s: %w", p.Name, field, err)
+		}
+	}
+	for field, places := range p.Decimals {
+		if places < 0 {
+			return fmt.Errorf("profile %s: negative decimals for %s", p.Name, field)
+		}
+	}
+	return nil
+}
+
+// ArrayFields returns the names of the array fields the profile produces
+func (p *Profile) ArrayFields() []string {
+	var names []string
+	for _, step := range p.Steps() {
+		if step.Op == OpGroup {
+			names = append(names, step.Into)
+		}
+	}
+	return names
+}
+
+// WithArrays returns a copy of the profile that also groups the given arrays
+func (p *Profile) WithArrays(groups ...ArrayGroup) *Profile {
+	copied := *p
+	if len(p.Pipeline) > 0 {
+		copied.Pipeline = append([]TransformStep(nil), p.Pipeline...)
+		for _, group := range groups {
+			copied.Pipeline = append(copied.Pipeline, group.step())
+		}
+	} else {
+		copied.Arrays = append(append([]ArrayGroup(nil), p.Arrays...), groups...)
+	}
+	return &copied
+}
+
+// WithKeyField returns a copy of the profile that keys records by field
+func (p *Profile) WithKeyField(field string) *Profile {
+	copied := *p
+	copied.KeyField = field
+	return &copied
+}
+
+// WithCharMaps returns a copy of the profile that also converts the given
+// fields with the named character maps
+func (p *Profile) WithCharMaps(charMaps map[string]string) *Profile {
+	copied := *p
+	copied.CharMaps = make(map[string]string, len(p.CharMaps)+len(charMaps))
+	for field, name := range p.CharMaps {
+		copied.CharMaps[field] = name
+	}
+	for field, name := range charMaps {
+		copied.CharMaps[field] = name
+	}
+	return &copied
+}
+
+// fieldConverters returns the converters of fields with their own character
+// map, or nil if there are none
+func (p *Profile) fieldConverters() map[string]func(string) string {
+	if len(p.CharMaps) == 0 {
+		return nil
+	}
+
+	converters := make(map[string]func(string) string, len(p.CharMaps))
+	for field, name := range p.CharMaps {
+		if c, err := LookupCharMap(name); err == nil {
+			converters[field] = c.Convert
+		}
+	}
+	return converters
+}
+
+// ParseFieldCharMap parses a per-field character map given on the command
+// line: FIELD=NAME (e.g. Sharh1=cp1256)
+func ParseFieldCharMap(spec string) (string, string, error) {
+	field, name, ok := strings.Cut(spec, "=")
+	field, name = strings.TrimSpace(field), strings.TrimSpace(name)
+	if !ok || field == "" || name == "" {
+		return "", "", fmt.Errorf("invalid field character map %q (use FIELD=NAME)", spec)
+	}
+	c, err := LookupCharMap(name)
+	if err != nil {
+		return "", "", err
+	}
+	return field, c.Name, nil
+}
+
+// ParseArrayGroup parses an array group given on the command line: a field
+// prefix ("KHARID" groups KHARID1..N into KHARID) or NAME=PATTERN, where the
+// pattern's first capture group is the element number
+func ParseArrayGroup(spec string) (ArrayGroup, error) {
+	spec = strings.TrimSpace(spec)
+
+	name, pattern, ok := strings.Cut(spec, "=")
+	if !ok {
+		if spec == "" {
+			return ArrayGroup{}, fmt.Errorf("array group is empty")
+		}
+		return ArrayGroup{Name: spec, Prefix: spec}, nil
+	}
+
+	group := ArrayGroup{Name: strings.TrimSpace(name), Pattern: strings.TrimSpace(pattern)}
+	if group.Name == "" || group.Pattern == "" {
+		return ArrayGroup{}, fmt.Errorf("invalid array group %q (use PREFIX or NAME=PATTERN)", spec)
+	}
+	if _, err := compilePipeline([]TransformStep{group.step()}); err != nil {
+		return ArrayGroup{}, fmt.Errorf("invalid array group %q: %w", spec, err)
+	}
+
+	return group, nil
+}
+
+// step returns the pipeline step grouping the array
+func (g ArrayGroup) step() TransformStep {
+	pattern := g.Pattern
+	if pattern == "" {
+		pattern = `^` + regexp.QuoteMeta(g.Prefix) + `(\d+)$`
+	}
+	return TransformStep{Op: OpGroup, Pattern: pattern, Into: g.Name, Count: g.Count}
+}
+
+// coerceValue converts a value to the given kind. Values that cannot be
+// converted without losing information are returned unchanged.
+func coerceValue(value interface{}, kind string) interface{} {
+	if value == nil {
+		return nil
+	}
+
+	switch kind {
+	case "int":
+		switch v := value.(type) {
+		case float64:
+			if v == math.Trunc(v) && math.Abs(v) < 1<<53 {
+				return int64(v)
+			}
+		case string:
+			if n, err := strconv.ParseInt(strings.TrimSpace(v), 10, 64); err == nil {
+				return n
+			}
+			// Whole decimal strings such as "2.00" (--numbers-as-strings)
+			if f, err := strconv.ParseFloat(strings.TrimSpace(v), 64); err == nil && f == math.Trunc(f) && math.Abs(f) < 1<<53 {
+				return int64(f)
+			}
+		}
+	case "float":
+		switch v := value.(type) {
+		case int:
+			return float64(v)
+		case int64:
+			return float64(v)
+		case string:
+			if f, err := strconv.ParseFloat(strings.TrimSpace(v), 64); err == nil {
+				return f
+			}
+		}
+	case "string":
+		if _, ok := value.(string); !ok {
+			return fmt.Sprintf("%v", value)
+		}
+	case "bool":
+		switch v := value.(type) {
+		case int:
+			return v != 0
+		case int64:
+			return v != 0
+		case float64:
+			return v != 0
+		case string:
+			if b, err := strconv.ParseBool(strings.TrimSpace(v)); err == nil {
+				return b
+			}
+		}
+	}
+
+	return value
+}
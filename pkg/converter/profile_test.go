@@ -0,0 +1,171 @@
+package converter
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/atomicdeploy/patris-export/pkg/paradox"
+)
+
+func TestProfileForFile(t *testing.T) {
+	tests := map[string]string{
+		"testdata/kala.db":  "kala",
+		"data/KALA.DB":      "kala",
+		"moshtari.db":       "moshtari",
+		"factor.db":         "factor",
+		"anbar.db":          "anbar",
+		"something-else.db": "default",
+	}
+
+	for path, expected := range tests {
+		if got := ProfileForFile(filepath.FromSlash(path)).Name; got != expected {
+			t.Errorf("ProfileForFile(%q) = %s, want %s", path, got, expected)
+		}
+	}
+}
+
+func TestKalaProfileTransform(t *testing.T) {
+	kala, ok := LookupProfile("kala")
+	if !ok {
+		t.Fatal("Expected built-in kala profile")
+	}
+
+	records := []paradox.Record{
+		{"Code": 7, "Name": "Item", "ANBAR1": 3.0, "ANBAR3": 2.5, "ALLANBAR": 5.0, "Serial": nil, "Sort": "x"},
+	}
+
+	exp := NewExporter(nil)
+	exp.SetProfile(kala)
+	record := exp.TransformRecords(records)["7"].(map[string]interface{})
+
+	expected := []interface{}{int64(3), 0, 2.5, 0, 0, 0, 0, 0, 0, 0}
+	if !reflect.DeepEqual(record["ANBAR"], expected) {
+		t.Errorf("ANBAR = %#v, want %#v", record["ANBAR"], expected)
+	}
+	if record["ALLANBAR"] != int64(5) {
+		t.Errorf("Expected ALLANBAR coerced to int, got %#v", record["ALLANBAR"])
+	}
+	if _, ok := record["Sort"]; ok {
+		t.Error("Sort field should be dropped")
+	}
+}
+
+func TestLoadProfile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "custom.yaml")
+	content := `key_field: Shomare
+drop_prefixes: [Tmp]
+arrays:
+  - name: Qty
+    prefix: Q
+coercions:
+  Shomare: string
+`
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write profile: %v", err)
+	}
+
+	profile, err := ResolveProfile(path, "kala.db")
+	if err != nil {
+		t.Fatalf("Failed to load profile: %v", err)
+	}
+	if profile.Name != "custom" || profile.KeyField != "Shomare" {
+		t.Errorf("Unexpected profile: %+v", profile)
+	}
+
+	exp := NewExporter(nil)
+	exp.SetProfile(profile)
+	result := exp.TransformRecords([]paradox.Record{{"Shomare": 12, "Q1": 1, "Q2": 2, "TmpX": 1}})
+
+	record, ok := result["12"].(map[string]interface{})
+	if !ok {
+		t.Fatalf("Expected record keyed by Shomare, got %v", result)
+	}
+	if record["Shomare"] != "12" {
+		t.Errorf("Expected Shomare coerced to string, got %#v", record["Shomare"])
+	}
+	if !reflect.DeepEqual(record["Qty"], []interface{}{1, 2}) {
+		t.Errorf("Unexpected Qty array: %v", record["Qty"])
+	}
+	if _, ok := record["TmpX"]; ok {
+		t.Error("TmpX should be dropped")
+	}
+
+	if _, err := ResolveProfile("no-such-profile", "kala.db"); err == nil {
+		t.Error("Expected error for unknown profile")
+	}
+}
+
+func TestParseArrayGroup(t *testing.T) {
+	group, err := ParseArrayGroup("KHARID")
+	if err != nil || group.Name != "KHARID" || group.Prefix != "KHARID" {
+		t.Errorf("ParseArrayGroup(KHARID) = %+v, %v", group, err)
+	}
+
+	group, err = ParseArrayGroup(`Prices=^Price_(\d+)$`)
+	if err != nil || group.Name != "Prices" || group.Pattern != `^Price_(\d+)$` {
+		t.Errorf("ParseArrayGroup(Prices=...) = %+v, %v", group, err)
+	}
+
+	for _, spec := range []string{"", "=^A(\\d+)$", "A=", "A=^A\\d+$", "A=("} {
+		if _, err := ParseArrayGroup(spec); err == nil {
+			t.Errorf("Expected error for %q", spec)
+		}
+	}
+}
+
+func TestWithArrays(t *testing.T) {
+	kala, _ := LookupProfile("kala")
+	group, _ := ParseArrayGroup(`Prices=^Price_(\d+)$`)
+	profile := kala.WithArrays(ArrayGroup{Name: "KHARID", Prefix: "KHARID"}, group)
+
+	if got := profile.ArrayFields(); !reflect.DeepEqual(got, []string{"ANBAR", "KHARID", "Prices"}) {
+		t.Errorf("ArrayFields() = %v", got)
+	}
+	if len(kala.Arrays) != 1 {
+		t.Errorf("WithArrays modified the original profile: %+v", kala.Arrays)
+	}
+
+	exp := NewExporter(nil)
+	exp.SetProfile(profile)
+	output, err := exp.ExportRecordsToString([]paradox.Record{
+		{"Code": 1, "KHARID1": 4, "KHARID2": 5, "Price_2": 9},
+	})
+	if err != nil {
+		t.Fatalf("Failed to export: %v", err)
+	}
+
+	for _, expected := range []string{`"KHARID": [4, 5]`, `"Prices": [0, 9]`} {
+		if !strings.Contains(output, expected) {
+			t.Errorf("Expected %s in output:\n%s", expected, output)
+		}
+	}
+}
+
+func TestWithKeyField(t *testing.T) {
+	kala, _ := LookupProfile("kala")
+	profile := kala.WithKeyField("Serial")
+
+	if kala.KeyField != "Code" {
+		t.Errorf("WithKeyField modified the original profile: %s", kala.KeyField)
+	}
+
+	exp := NewExporter(nil)
+	exp.SetProfile(profile)
+	records := exp.TransformRecords([]paradox.Record{
+		{"Code": 1, "Serial": "A-1"},
+		{"Code": 2, "Serial": "A-2"},
+		{"Code": 3},
+	})
+
+	if len(records) != 2 {
+		t.Fatalf("Expected 2 records keyed by Serial, got %d: %v", len(records), records)
+	}
+	for _, key := range []string{"A-1", "A-2"} {
+		if _, ok := records[key]; !ok {
+			t.Errorf("Expected a record keyed %s, got %v", key, records)
+		}
+	}
+}
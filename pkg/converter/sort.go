@@ -0,0 +1,89 @@
+package converter
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/atomicdeploy/patris-export/pkg/paradox"
+)
+
+// SetSort orders exported rows by a field (empty keeps the table order).
+// Row order applies to CSV, XLSX and SQLite exports; JSON and YAML exports are
+// keyed by the key field and always list keys in sorted order.
+func (e *Exporter) SetSort(field string, desc bool) {
+	e.sortField = field
+	e.sortDesc = desc
+}
+
+// sortRecords returns the records ordered by the exporter's sort field
+func (e *Exporter) sortRecords(records []paradox.Record) []paradox.Record {
+	if e.sortField == "" {
+		return records
+	}
+
+	sorted := make([]paradox.Record, len(records))
+	copy(sorted, records)
+
+	// Stable so that records with equal values keep their table order
+	sort.SliceStable(sorted, func(i, j int) bool {
+		c := compareValues(sorted[i][e.sortField], sorted[j][e.sortField])
+		if e.sortDesc {
+			return c > 0
+		}
+		return c < 0
+	})
+
+	return sorted
+}
+
+// compareValues orders two field values: nulls first, then numbers (including
+// numeric text such as codes, in Latin or Persian digits) by value, then text
+func compareValues(a, b interface{}) int {
+	if a == nil || b == nil {
+		switch {
+		case a == nil && b == nil:
+			return 0
+		case a == nil:
+			return -1
+		default:
+			return 1
+		}
+	}
+
+	na, aNum := numericValue(a)
+	nb, bNum := numericValue(b)
+	switch {
+	case aNum && bNum:
+		switch {
+		case na < nb:
+			return -1
+		case na > nb:
+			return 1
+		}
+		return 0
+	case aNum:
+		return -1
+	case bNum:
+		return 1
+	}
+
+	return strings.Compare(fmt.Sprintf("%v", a), fmt.Sprintf("%v", b))
+}
+
+// numericValue returns the value of numbers and numeric text
+func numericValue(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case float64:
+		return v, true
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(ConvertDigits(v, DigitsLatin)), 64)
+		return f, err == nil
+	}
+	return 0, false
+}
@@ -0,0 +1,100 @@
+package converter
+
+import (
+	"encoding/csv"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/atomicdeploy/patris-export/pkg/paradox"
+)
+
+func TestCompareValues(t *testing.T) {
+	tests := []struct {
+		a, b interface{}
+		want int
+	}{
+		{"2", "10", -1},
+		{"۲", "10", -1},
+		{3, 2.5, 1},
+		{"abc", "abd", -1},
+		{nil, "1", -1},
+		{"1", "x", -1},
+		{5, 5.0, 0},
+	}
+
+	for _, tt := range tests {
+		if got := compareValues(tt.a, tt.b); got != tt.want {
+			t.Errorf("compareValues(%v, %v) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestExportToCSVSorted(t *testing.T) {
+	records := []paradox.Record{
+		{"Code": "10", "Name": "C"},
+		{"Code": "2", "Name": "A"},
+		{"Code": "2", "Name": "B"},
+		{"Code": "1", "Name": "D"},
+	}
+	fields := []paradox.Field{{Name: "Code"}, {Name: "Name"}}
+
+	tests := []struct {
+		desc bool
+		want []string
+	}{
+		{false, []string{"D", "A", "B", "C"}},
+		// Equal codes keep their table order in both directions
+		{true, []string{"C", "A", "B", "D"}},
+	}
+
+	for _, tt := range tests {
+		outputPath := filepath.Join(t.TempDir(), "kala.csv")
+
+		exp := NewExporter(nil)
+		exp.SetSort("Code", tt.desc)
+		if err := exp.ExportToCSV(records, fields, outputPath); err != nil {
+			t.Fatalf("Failed to export: %v", err)
+		}
+
+		file, err := os.Open(outputPath)
+		if err != nil {
+			t.Fatalf("Failed to open export: %v", err)
+		}
+		rows, err := csv.NewReader(file).ReadAll()
+		file.Close()
+		if err != nil {
+			t.Fatalf("Failed to read export: %v", err)
+		}
+
+		for i, name := range tt.want {
+			if rows[i+1][1] != name {
+				t.Errorf("desc=%v: row %d is %v, want Name %s", tt.desc, i+1, rows[i+1], name)
+			}
+		}
+	}
+}
+
+func TestPrepareRecords(t *testing.T) {
+	records := []paradox.Record{
+		{"Code": 3, "Name": "C", "FOROSH": 1500.0},
+		{"Code": 1, "Name": "A", "FOROSH": 200.0},
+		{"Code": 2, "Name": "B", "FOROSH": 2500.0},
+	}
+
+	filter, err := ParseFilter("FOROSH > 1000")
+	if err != nil {
+		t.Fatalf("ParseFilter failed: %v", err)
+	}
+	exp := NewExporter(nil)
+	exp.SetFilter(filter)
+	exp.SetSort("FOROSH", true)
+
+	prepared, err := exp.PrepareRecords(records)
+	if err != nil {
+		t.Fatalf("PrepareRecords failed: %v", err)
+	}
+	if len(prepared) != 2 || prepared[0]["Name"] != "B" || prepared[1]["Name"] != "C" {
+		t.Errorf("Expected B and C, got %v", prepared)
+	}
+}
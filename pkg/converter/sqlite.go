@@ -0,0 +1,139 @@
+package converter
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/atomicdeploy/patris-export/pkg/paradox"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// FormatSQLite exports a SQLite database
+const FormatSQLite ExportFormat = "sqlite"
+
+// ExportToSQLite exports records to a SQLite database with one table whose
+// columns match the Paradox schema. The Code field, when present, is the
+// primary key. All rows are inserted in a single transaction.
+func (e *Exporter) ExportToSQLite(records []paradox.Record, fields []paradox.Field, outputPath string) error {
+	// Convert string fields, run transformers, filter, sort and encrypt
+	records, err := e.prepareRecords(records)
+	if err != nil {
+		return err
+	}
+
+	// Always start from an empty database
+	if err := os.Remove(outputPath); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove existing output file: %w", err)
+	}
+
+	db, err := sql.Open("sqlite3", outputPath)
+	if err != nil {
+		return fmt.Errorf("failed to create SQLite database: %w", err)
+	}
+	defer db.Close()
+
+	table := strings.TrimSuffix(filepath.Base(outputPath), filepath.Ext(outputPath))
+	if _, err := db.Exec(sqliteCreateTable(table, fields)); err != nil {
+		return fmt.Errorf("failed to create table: %w", err)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	columns := make([]string, len(fields))
+	placeholders := make([]string, len(fields))
+	for i, field := range fields {
+		columns[i] = sqliteQuote(field.Name)
+		placeholders[i] = "?"
+	}
+
+	// Duplicate codes keep the last record, like the JSON export
+	stmt, err := tx.Prepare(fmt.Sprintf("INSERT OR REPLACE INTO %s (%s) VALUES (%s)",
+		sqliteQuote(table), strings.Join(columns, ", "), strings.Join(placeholders, ", ")))
+	if err != nil {
+		return fmt.Errorf("failed to prepare insert: %w", err)
+	}
+	defer stmt.Close()
+
+	values := make([]interface{}, len(fields))
+	for _, record := range records {
+		for i, field := range fields {
+			values[i] = record[field.Name]
+		}
+		if _, err := stmt.Exec(values...); err != nil {
+			return fmt.Errorf("failed to insert record: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit records: %w", err)
+	}
+
+	return nil
+}
+
+// ExportToSQLiteWriter writes the database of ExportToSQLite to w, with a
+// table named table. SQLite needs a file, so the database is built in a
+// temporary directory first.
+func (e *Exporter) ExportToSQLiteWriter(w io.Writer, records []paradox.Record, fields []paradox.Field, table string) error {
+	dir, err := os.MkdirTemp("", "patris-export-sqlite-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary directory: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, filepath.Base(table)+".sqlite")
+	if err := e.ExportToSQLite(records, fields, path); err != nil {
+		return err
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open SQLite database: %w", err)
+	}
+	defer file.Close()
+	if _, err := io.Copy(w, file); err != nil {
+		return fmt.Errorf("failed to write SQLite: %w", err)
+	}
+	return nil
+}
+
+// sqliteCreateTable builds the CREATE TABLE statement for the Paradox fields
+func sqliteCreateTable(table string, fields []paradox.Field) string {
+	columns := make([]string, 0, len(fields))
+	for _, field := range fields {
+		column := sqliteQuote(field.Name) + " " + sqliteColumnType(field.Type)
+		if field.Name == "Code" {
+			column += " PRIMARY KEY"
+		}
+		columns = append(columns, column)
+	}
+
+	return fmt.Sprintf("CREATE TABLE %s (\n  %s\n)", sqliteQuote(table), strings.Join(columns, ",\n  "))
+}
+
+// sqliteColumnType maps a Paradox field type to a SQLite column type
+func sqliteColumnType(fieldType string) string {
+	switch fieldType {
+	case "short", "long", "autoinc", "date", "time", "logical":
+		return "INTEGER"
+	case "number", "currency", "bcd", "timestamp":
+		return "REAL"
+	case "blob", "bytes", "ole", "graphic":
+		return "BLOB"
+	default:
+		return "TEXT"
+	}
+}
+
+// sqliteQuote quotes an identifier
+func sqliteQuote(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
@@ -0,0 +1,108 @@
+package converter
+
+import (
+	"bytes"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/atomicdeploy/patris-export/pkg/paradox"
+)
+
+func TestExportToSQLite(t *testing.T) {
+	fields := []paradox.Field{
+		{Name: "Code", Type: "alpha", Size: 10},
+		{Name: "Name", Type: "alpha", Size: 40},
+		{Name: "Price", Type: "currency", Size: 8},
+		{Name: "ANBAR1", Type: "long", Size: 4},
+	}
+	records := []paradox.Record{
+		{"Code": "00123", "Name": "Test Product", "Price": 1250.5, "ANBAR1": 7},
+		{"Code": "00124", "Name": nil, "Price": 0.0, "ANBAR1": 0},
+	}
+
+	outputPath := filepath.Join(t.TempDir(), "kala.sqlite")
+	exp := NewExporter(nil)
+	if err := exp.ExportToSQLite(records, fields, outputPath); err != nil {
+		t.Fatalf("Failed to export SQLite: %v", err)
+	}
+
+	// Exporting again must replace the previous database
+	if err := exp.ExportToSQLite(records, fields, outputPath); err != nil {
+		t.Fatalf("Failed to re-export SQLite: %v", err)
+	}
+
+	db, err := sql.Open("sqlite3", outputPath)
+	if err != nil {
+		t.Fatalf("Failed to open SQLite: %v", err)
+	}
+	defer db.Close()
+
+	var count int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM kala`).Scan(&count); err != nil {
+		t.Fatalf("Failed to count rows: %v", err)
+	}
+	if count != 2 {
+		t.Errorf("Expected 2 rows, got %d", count)
+	}
+
+	var name string
+	var price float64
+	var stock int
+	if err := db.QueryRow(`SELECT Name, Price, ANBAR1 FROM kala WHERE Code = ?`, "00123").Scan(&name, &price, &stock); err != nil {
+		t.Fatalf("Failed to query record: %v", err)
+	}
+	if name != "Test Product" || price != 1250.5 || stock != 7 {
+		t.Errorf("Unexpected record: %q %v %d", name, price, stock)
+	}
+
+	var priceType string
+	if err := db.QueryRow(`SELECT typeof(Price) FROM kala WHERE Code = ?`, "00123").Scan(&priceType); err != nil {
+		t.Fatalf("Failed to query column type: %v", err)
+	}
+	if priceType != "real" {
+		t.Errorf("Expected REAL price column, got %s", priceType)
+	}
+
+	var pk int
+	if err := db.QueryRow(`SELECT pk FROM pragma_table_info('kala') WHERE name = 'Code'`).Scan(&pk); err != nil {
+		t.Fatalf("Failed to read table info: %v", err)
+	}
+	if pk != 1 {
+		t.Error("Expected Code to be the primary key")
+	}
+}
+
+func TestExportToSQLiteWriter(t *testing.T) {
+	fields := []paradox.Field{
+		{Name: "Code", Type: "alpha", Size: 10},
+		{Name: "ANBAR1", Type: "long", Size: 4},
+	}
+	records := []paradox.Record{
+		{"Code": "00123", "ANBAR1": 7},
+	}
+
+	var buf bytes.Buffer
+	if err := NewExporter(nil).ExportToSQLiteWriter(&buf, records, fields, "kala"); err != nil {
+		t.Fatalf("Failed to export SQLite: %v", err)
+	}
+
+	outputPath := filepath.Join(t.TempDir(), "copy.sqlite")
+	if err := os.WriteFile(outputPath, buf.Bytes(), 0644); err != nil {
+		t.Fatalf("Failed to write SQLite: %v", err)
+	}
+	db, err := sql.Open("sqlite3", outputPath)
+	if err != nil {
+		t.Fatalf("Failed to open SQLite: %v", err)
+	}
+	defer db.Close()
+
+	var stock int
+	if err := db.QueryRow(`SELECT ANBAR1 FROM kala WHERE Code = ?`, "00123").Scan(&stock); err != nil {
+		t.Fatalf("Failed to query record: %v", err)
+	}
+	if stock != 7 {
+		t.Errorf("Expected 7, got %d", stock)
+	}
+}
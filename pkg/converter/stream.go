@@ -0,0 +1,254 @@
+package converter
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+
+	"github.com/atomicdeploy/patris-export/pkg/paradox"
+)
+
+// errStreamSort is returned when a streaming export is asked to sort
+var errStreamSort = errors.New("sorting needs all records in memory and is not supported by streaming exports")
+
+// ExportToJSONWriter writes the records read from an iterator as JSON,
+// encoding one record at a time so that memory use does not grow with the
+// table size. The structure is the same as ExportToJSON, but keyed records
+// are written in table order instead of sorted by key, and the metadata of an
+// envelope comes after the records since the count is only known at the end.
+func (e *Exporter) ExportToJSONWriter(w io.Writer, it paradox.RecordIterator) error {
+	if e.sortField != "" {
+		return errStreamSort
+	}
+
+	opts := e.jsonOptions
+	profile := e.Profile()
+	steps, err := compilePipeline(profile.Steps())
+	if err != nil {
+		return fmt.Errorf("invalid transform pipeline in profile %s: %w", profile.Name, err)
+	}
+	order := fieldOrder(steps, opts.FieldOrder)
+
+	var inline *regexp.Regexp
+	if !opts.Compact {
+		inline = arrayInlinePattern(profile.ArrayFields())
+	}
+
+	// Records are indented one more level inside an envelope
+	indent := ""
+	bw := bufio.NewWriter(w)
+	if opts.Envelope {
+		if opts.Compact {
+			bw.WriteString(`{"records":`)
+		} else {
+			indent = "  "
+			bw.WriteString("{\n  \"records\": ")
+		}
+	}
+
+	begin, end := "{", "}"
+	if opts.Shape == JSONShapeArray {
+		begin, end = "[", "]"
+	}
+
+	written := 0
+	for it.Next() {
+		record, ok, err := e.prepareRecord(it.Record())
+		if err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+
+		var key []byte
+		var value interface{}
+		if opts.Shape == JSONShapeArray {
+			value = e.jsonRecord(steps, order, record)
+		} else {
+			code, optimized, ok := transformRecord(steps, profile.KeyField, record)
+			if !ok {
+				continue
+			}
+			if key, err = json.Marshal(code); err != nil {
+				return fmt.Errorf("failed to encode JSON: %w", err)
+			}
+			value = orderRecord(optimized, order)
+		}
+
+		var data []byte
+		if opts.Compact {
+			data, err = json.Marshal(value)
+		} else {
+			data, err = json.MarshalIndent(value, indent+"  ", "  ")
+		}
+		if err != nil {
+			return fmt.Errorf("failed to encode JSON: %w", err)
+		}
+
+		// Same layout as encoding the whole document at once
+		switch {
+		case written == 0 && opts.Compact:
+			bw.WriteString(begin)
+		case written == 0:
+			bw.WriteString(begin + "\n" + indent + "  ")
+		case opts.Compact:
+			bw.WriteString(",")
+		default:
+			bw.WriteString(",\n" + indent + "  ")
+		}
+		if key != nil {
+			bw.Write(key)
+			if opts.Compact {
+				bw.WriteString(":")
+			} else {
+				bw.WriteString(": ")
+			}
+		}
+		if inline != nil {
+			bw.WriteString(inlineArrays(inline, string(data)))
+		} else {
+			bw.Write(data)
+		}
+		written++
+	}
+	if err := it.Err(); err != nil {
+		return fmt.Errorf("failed to read records: %w", err)
+	}
+
+	switch {
+	case written == 0:
+		bw.WriteString(begin + end)
+	case opts.Compact:
+		bw.WriteString(end)
+	default:
+		bw.WriteString("\n" + indent + end)
+	}
+
+	if opts.Envelope {
+		metadata, err := e.exportMetadata(written)
+		if err != nil {
+			return err
+		}
+		var data []byte
+		if opts.Compact {
+			data, err = json.Marshal(metadata)
+			bw.WriteString(`,"metadata":`)
+		} else {
+			data, err = json.MarshalIndent(metadata, "  ", "  ")
+			bw.WriteString(",\n  \"metadata\": ")
+		}
+		if err != nil {
+			return fmt.Errorf("failed to encode JSON: %w", err)
+		}
+		bw.Write(data)
+		if opts.Compact {
+			bw.WriteString("}")
+		} else {
+			bw.WriteString("\n}")
+		}
+	}
+
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("failed to write JSON: %w", err)
+	}
+	return nil
+}
+
+// ExportToCSVWriter writes the records read from an iterator as CSV, one row
+// at a time. The output is the same as ExportToCSV without sorting.
+func (e *Exporter) ExportToCSVWriter(w io.Writer, fields []paradox.Field, it paradox.RecordIterator) error {
+	if e.sortField != "" {
+		return errStreamSort
+	}
+
+	writer := csv.NewWriter(w)
+
+	if err := writer.Write(csvHeader(fields)); err != nil {
+		return fmt.Errorf("failed to write CSV header: %w", err)
+	}
+
+	for it.Next() {
+		record, ok, err := e.prepareRecord(it.Record())
+		if err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+
+		if err := writer.Write(e.csvRow(record, fields)); err != nil {
+			return fmt.Errorf("failed to write CSV row: %w", err)
+		}
+	}
+	if err := it.Err(); err != nil {
+		return fmt.Errorf("failed to read records: %w", err)
+	}
+
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return fmt.Errorf("failed to write CSV: %w", err)
+	}
+	return nil
+}
+
+// StreamToJSON exports the records read from an iterator to a JSON file with
+// ExportToJSONWriter
+func (e *Exporter) StreamToJSON(it paradox.RecordIterator, outputPath string) error {
+	file, err := createOutput(outputPath, e.compression)
+	if err != nil {
+		return fmt.Errorf("failed to create output file: %w", err)
+	}
+	defer file.Abort()
+
+	if err := e.ExportToJSONWriter(file, it); err != nil {
+		return err
+	}
+	return file.Commit()
+}
+
+// StreamToCSV exports the records read from an iterator to a CSV file with
+// ExportToCSVWriter
+func (e *Exporter) StreamToCSV(it paradox.RecordIterator, fields []paradox.Field, outputPath string) error {
+	file, err := createOutput(outputPath, e.compression)
+	if err != nil {
+		return fmt.Errorf("failed to create output file: %w", err)
+	}
+	defer file.Abort()
+
+	if err := e.ExportToCSVWriter(file, fields, it); err != nil {
+		return err
+	}
+	return file.Commit()
+}
+
+// prepareRecord is prepareRecords for a single record, without sorting. It
+// returns false for records not matching the filter.
+func (e *Exporter) prepareRecord(record paradox.Record) (paradox.Record, bool, error) {
+	records, err := applyTransformers(e.convertRecords([]paradox.Record{record}))
+	if err != nil {
+		return nil, false, err
+	}
+	record = records[0]
+
+	if e.filter != nil {
+		ok, err := e.filter.Match(record)
+		if err != nil || !ok {
+			return nil, false, err
+		}
+	}
+
+	if e.encryptor != nil {
+		encrypted, err := e.encryptRecords(records)
+		if err != nil {
+			return nil, false, err
+		}
+		record = encrypted[0]
+	}
+
+	return record, true, nil
+}
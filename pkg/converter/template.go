@@ -0,0 +1,166 @@
+package converter
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"unicode/utf8"
+
+	"github.com/atomicdeploy/patris-export/pkg/paradox"
+)
+
+// FormatTemplate renders records through a user-supplied text/template
+const FormatTemplate ExportFormat = "template"
+
+// Templates that render one record at a time; see ExportToTemplate
+const (
+	templateHeader = "header"
+	templateRecord = "record"
+	templateFooter = "footer"
+)
+
+// TemplateData is the data passed to templates rendering the whole set
+// (and to the header and footer templates)
+type TemplateData struct {
+	// Table is the output file name without extensions (e.g. kala)
+	Table string
+	// Fields are the table's fields in column order
+	Fields []paradox.Field
+	// Records are the converted records in table (or --sort-by) order with
+	// their raw field names (ANBAR1, not ANBAR)
+	Records []paradox.Record
+	// Keyed holds the records transformed by the table profile and keyed
+	// by the key field, like the JSON export
+	Keyed map[string]interface{}
+}
+
+// templateFuncs are the functions available to output templates
+var templateFuncs = template.FuncMap{
+	// pad left-aligns a value in a fixed-width column, truncating if needed
+	"pad": func(width int, value interface{}) string {
+		s := truncate(width, fmt.Sprint(value))
+		return s + strings.Repeat(" ", max(width-utf8.RuneCountInString(s), 0))
+	},
+	// padLeft right-aligns a value in a fixed-width column
+	"padLeft": func(width int, value interface{}) string {
+		s := truncate(width, fmt.Sprint(value))
+		return strings.Repeat(" ", max(width-utf8.RuneCountInString(s), 0)) + s
+	},
+	"trunc": func(width int, value interface{}) string {
+		return truncate(width, fmt.Sprint(value))
+	},
+	"xml": func(value interface{}) (string, error) {
+		var buf bytes.Buffer
+		if err := xml.EscapeText(&buf, []byte(fmt.Sprint(value))); err != nil {
+			return "", err
+		}
+		return buf.String(), nil
+	},
+	"json": func(value interface{}) (string, error) {
+		data, err := json.Marshal(value)
+		return string(data), err
+	},
+	"default": func(fallback, value interface{}) interface{} {
+		if value == nil || value == "" {
+			return fallback
+		}
+		return value
+	},
+	"trim":  func(s string) string { return strings.TrimSpace(s) },
+	"upper": strings.ToUpper,
+	"lower": strings.ToLower,
+	"join":  strings.Join,
+}
+
+// truncate shortens s to at most width runes
+func truncate(width int, s string) string {
+	if width < 0 {
+		width = 0
+	}
+	runes := []rune(s)
+	if len(runes) > width {
+		return string(runes[:width])
+	}
+	return s
+}
+
+// ParseTemplateFile parses an output template with the template functions
+// (pad, padLeft, trunc, xml, json, default, trim, upper, lower, join)
+func ParseTemplateFile(path string) (*template.Template, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read template: %w", err)
+	}
+
+	tmpl, err := template.New(filepath.Base(path)).Funcs(templateFuncs).Parse(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse template: %w", err)
+	}
+
+	return tmpl, nil
+}
+
+// TemplateOutputExt returns the output file extension for a template file:
+// report.xml.tmpl writes .xml files, other templates .txt files
+func TemplateOutputExt(templatePath string) string {
+	name := filepath.Base(templatePath)
+	if ext := filepath.Ext(strings.TrimSuffix(name, filepath.Ext(name))); ext != "" {
+		return ext
+	}
+	return ".txt"
+}
+
+// ExportToTemplate renders records through a template. If the template
+// defines a "record" template, it is executed once per record with the
+// record as data, between the optional "header" and "footer" templates;
+// otherwise the template is executed once with TemplateData.
+func (e *Exporter) ExportToTemplate(records []paradox.Record, fields []paradox.Field, tmpl *template.Template, outputPath string) error {
+	// Convert string fields, run transformers, filter, sort and encrypt
+	records, err := e.prepareRecords(records)
+	if err != nil {
+		return err
+	}
+
+	data := TemplateData{
+		Table:   strings.SplitN(filepath.Base(outputPath), ".", 2)[0],
+		Fields:  fields,
+		Records: records,
+		Keyed:   e.TransformRecords(records),
+	}
+
+	file, err := createOutput(outputPath, e.compression)
+	if err != nil {
+		return fmt.Errorf("failed to create output file: %w", err)
+	}
+	defer file.Abort()
+
+	if tmpl.Lookup(templateRecord) == nil {
+		if err := tmpl.Execute(file, data); err != nil {
+			return fmt.Errorf("failed to render template: %w", err)
+		}
+		return file.Commit()
+	}
+
+	if tmpl.Lookup(templateHeader) != nil {
+		if err := tmpl.ExecuteTemplate(file, templateHeader, data); err != nil {
+			return fmt.Errorf("failed to render template header: %w", err)
+		}
+	}
+	for i, record := range records {
+		if err := tmpl.ExecuteTemplate(file, templateRecord, record); err != nil {
+			return fmt.Errorf("failed to render record %d: %w", i+1, err)
+		}
+	}
+	if tmpl.Lookup(templateFooter) != nil {
+		if err := tmpl.ExecuteTemplate(file, templateFooter, data); err != nil {
+			return fmt.Errorf("failed to render template footer: %w", err)
+		}
+	}
+
+	return file.Commit()
+}
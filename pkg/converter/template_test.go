@@ -0,0 +1,92 @@
+package converter
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/atomicdeploy/patris-export/pkg/paradox"
+)
+
+func renderTemplate(t *testing.T, exp *Exporter, name, text string, records []paradox.Record) string {
+	t.Helper()
+	dir := t.TempDir()
+
+	tmplPath := filepath.Join(dir, name)
+	if err := os.WriteFile(tmplPath, []byte(text), 0644); err != nil {
+		t.Fatalf("Failed to write template: %v", err)
+	}
+	tmpl, err := ParseTemplateFile(tmplPath)
+	if err != nil {
+		t.Fatalf("Failed to parse template: %v", err)
+	}
+
+	outputPath := filepath.Join(dir, "kala"+TemplateOutputExt(tmplPath))
+	fields := []paradox.Field{{Name: "Code", Type: "long"}, {Name: "Name", Type: "alpha"}}
+	if err := exp.ExportToTemplate(records, fields, tmpl, outputPath); err != nil {
+		t.Fatalf("Failed to export: %v", err)
+	}
+
+	data, err := os.ReadFile(outputPath)
+	if err != nil {
+		t.Fatalf("Failed to read output: %v", err)
+	}
+	return string(data)
+}
+
+func TestExportToTemplateRecords(t *testing.T) {
+	records := []paradox.Record{
+		{"Code": 12, "Name": "Resistor"},
+		{"Code": 3, "Name": "A very long item name"},
+		{"Code": 7},
+	}
+
+	text := `{{define "header"}}{{range .Fields}}{{pad 6 .Name}}{{end}}
+{{end}}{{define "record"}}{{padLeft 6 .Code}}{{pad 6 (default "-" .Name)}}
+{{end}}{{define "footer"}}{{len .Records}} records
+{{end}}`
+
+	exp := NewExporter(nil)
+	exp.SetSort("Code", false)
+	got := renderTemplate(t, exp, "fixed.tmpl", text, records)
+
+	expected := "Code  Name  \n" +
+		"     3A very\n" +
+		"     7-     \n" +
+		"    12Resist\n" +
+		"3 records\n"
+	if got != expected {
+		t.Errorf("Unexpected output:\n%q\nwant:\n%q", got, expected)
+	}
+}
+
+func TestExportToTemplateWholeSet(t *testing.T) {
+	records := []paradox.Record{
+		{"Code": 1, "Name": "R & C", "ANBAR1": 2},
+	}
+
+	text := `<{{.Table}}>{{range $code, $r := .Keyed}}<item code="{{$code}}" stock="{{json $r.ANBAR}}">{{xml $r.Name}}</item>{{end}}</{{.Table}}>`
+
+	exp := NewExporter(nil)
+	kala, _ := LookupProfile("kala")
+	exp.SetProfile(kala)
+	got := renderTemplate(t, exp, "items.xml.tmpl", text, records)
+
+	expected := `<kala><item code="1" stock="[2,0,0,0,0,0,0,0,0,0]">R &amp; C</item></kala>`
+	if got != expected {
+		t.Errorf("Unexpected output:\n%s\nwant:\n%s", got, expected)
+	}
+}
+
+func TestTemplateOutputExt(t *testing.T) {
+	tests := map[string]string{
+		"report.xml.tmpl": ".xml",
+		"dir/edi.x12.tpl": ".x12",
+		"fixed.tmpl":      ".txt",
+	}
+	for path, expected := range tests {
+		if got := TemplateOutputExt(path); got != expected {
+			t.Errorf("TemplateOutputExt(%q) = %q, want %q", path, got, expected)
+		}
+	}
+}
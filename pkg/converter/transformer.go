@@ -0,0 +1,133 @@
+package converter
+
+import (
+	"fmt"
+	"log"
+	"sync"
+
+	"github.com/atomicdeploy/patris-export/pkg/paradox"
+)
+
+// Transformer modifies records before they are exported or sent to web
+// clients. Applications embedding the converter register transformers to
+// compute extra fields (e.g. total stock) or enrich records (e.g. category
+// names). Records have their raw field names (ANBAR1, not ANBAR) and
+// converted text; Transform may modify the record in place.
+type Transformer interface {
+	Name() string
+	Transform(record paradox.Record) error
+}
+
+// FieldAdder is implemented by transformers that add fields, so that filter
+// expressions may refer to them
+type FieldAdder interface {
+	AddedFields() []string
+}
+
+// TransformerFunc adapts a function to the Transformer interface
+type TransformerFunc struct {
+	TransformerName string
+	Func            func(record paradox.Record) error
+	// Fields lists the fields the function adds
+	Fields []string
+}
+
+// Name returns the transformer name
+func (f TransformerFunc) Name() string {
+	return f.TransformerName
+}
+
+// AddedFields returns the fields the function adds
+func (f TransformerFunc) AddedFields() []string {
+	return f.Fields
+}
+
+// Transform calls the function
+func (f TransformerFunc) Transform(record paradox.Record) error {
+	return f.Func(record)
+}
+
+var (
+	transformersMu sync.RWMutex
+	transformers   []Transformer
+)
+
+// RegisterTransformer adds a transformer; transformers run in registration order
+func RegisterTransformer(t Transformer) error {
+	transformersMu.Lock()
+	defer transformersMu.Unlock()
+
+	for _, existing := range transformers {
+		if existing.Name() == t.Name() {
+			return fmt.Errorf("transformer %s is already registered", t.Name())
+		}
+	}
+	transformers = append(transformers, t)
+	return nil
+}
+
+// UnregisterTransformer removes a transformer by name
+func UnregisterTransformer(name string) {
+	transformersMu.Lock()
+	defer transformersMu.Unlock()
+
+	for i, t := range transformers {
+		if t.Name() == name {
+			transformers = append(transformers[:i:i], transformers[i+1:]...)
+			return
+		}
+	}
+}
+
+// Transformers returns the registered transformers in registration order
+func Transformers() []Transformer {
+	transformersMu.RLock()
+	defer transformersMu.RUnlock()
+	return append([]Transformer(nil), transformers...)
+}
+
+// addedFields returns the fields added by the registered transformers
+func addedFields() []string {
+	var fields []string
+	for _, t := range Transformers() {
+		if adder, ok := t.(FieldAdder); ok {
+			fields = append(fields, adder.AddedFields()...)
+		}
+	}
+	return fields
+}
+
+// applyTransformers runs the registered transformers on copies of the records
+func applyTransformers(records []paradox.Record) ([]paradox.Record, error) {
+	registered := Transformers()
+	if len(registered) == 0 {
+		return records, nil
+	}
+
+	transformed := make([]paradox.Record, len(records))
+	for i, record := range records {
+		copied := make(paradox.Record, len(record))
+		for key, value := range record {
+			copied[key] = value
+		}
+		for _, t := range registered {
+			if err := t.Transform(copied); err != nil {
+				return nil, fmt.Errorf("transformer %s failed: %w", t.Name(), err)
+			}
+		}
+		transformed[i] = copied
+	}
+
+	return transformed, nil
+}
+
+// applyTransformersOrLog is applyTransformers for callers that cannot fail;
+// on error the records are returned untransformed
+func applyTransformersOrLog(records []paradox.Record) []paradox.Record {
+	transformed, err := applyTransformers(records)
+	if err != nil {
+		log.Printf("⚠️  %v", err)
+		return records
+	}
+	return transformed
+}
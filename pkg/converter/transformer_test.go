@@ -0,0 +1,90 @@
+package converter
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/atomicdeploy/patris-export/pkg/paradox"
+)
+
+// totalStock sums the ANBAR fields into TOTAL
+var totalStock = TransformerFunc{
+	TransformerName: "total-stock",
+	Fields:          []string{"TOTAL"},
+	Func: func(record paradox.Record) error {
+		total := 0
+		for _, key := range []string{"ANBAR1", "ANBAR2"} {
+			if n, ok := record[key].(int); ok {
+				total += n
+			}
+		}
+		record["TOTAL"] = total
+		return nil
+	},
+}
+
+func TestRegisterTransformer(t *testing.T) {
+	if err := RegisterTransformer(totalStock); err != nil {
+		t.Fatalf("Failed to register transformer: %v", err)
+	}
+	t.Cleanup(func() { UnregisterTransformer(totalStock.Name()) })
+
+	if err := RegisterTransformer(totalStock); err == nil {
+		t.Error("Expected an error for a duplicate transformer name")
+	}
+
+	records := []paradox.Record{
+		{"Code": "1", "ANBAR1": 2, "ANBAR2": 3},
+		{"Code": "2", "ANBAR1": 0},
+	}
+
+	exp := NewExporter(nil)
+	result := exp.ConvertAndTransformRecords(records)
+	if got := result["1"].(map[string]interface{})["TOTAL"]; got != 5 {
+		t.Errorf("Expected TOTAL = 5, got %v", got)
+	}
+
+	// The caller's records are not modified
+	if _, ok := records[0]["TOTAL"]; ok {
+		t.Error("Transformer modified the input records")
+	}
+
+	// Filters can refer to fields added by transformers
+	filter, err := ParseFilter("TOTAL > 0")
+	if err != nil {
+		t.Fatalf("Failed to parse filter: %v", err)
+	}
+	if err := filter.Bind([]paradox.Field{{Name: "Code", Type: "alpha"}, {Name: "ANBAR1", Type: "long"}}); err != nil {
+		t.Fatalf("Failed to bind filter: %v", err)
+	}
+	exp.SetFilter(filter)
+
+	filtered, err := exp.ConvertFilterAndTransformRecords(records)
+	if err != nil {
+		t.Fatalf("Failed to filter records: %v", err)
+	}
+	if len(filtered) != 1 || filtered["1"] == nil {
+		t.Errorf("Expected only record 1, got %v", filtered)
+	}
+
+	UnregisterTransformer(totalStock.Name())
+	if len(Transformers()) != 0 {
+		t.Errorf("Expected no transformers, got %v", Transformers())
+	}
+}
+
+func TestTransformerError(t *testing.T) {
+	failing := TransformerFunc{
+		TransformerName: "failing",
+		Func:            func(paradox.Record) error { return errors.New("lookup failed") },
+	}
+	if err := RegisterTransformer(failing); err != nil {
+		t.Fatalf("Failed to register transformer: %v", err)
+	}
+	t.Cleanup(func() { UnregisterTransformer(failing.Name()) })
+
+	exp := NewExporter(nil)
+	if _, err := exp.ExportRecordsToString([]paradox.Record{{"Code": "1"}}); err == nil {
+		t.Error("Expected the transformer error to fail the export")
+	}
+}
@@ -0,0 +1,212 @@
+package converter
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"unicode"
+
+	"github.com/atomicdeploy/patris-export/pkg/paradox"
+	"github.com/xuri/excelize/v2"
+)
+
+// FormatXLSX exports an Excel workbook
+const FormatXLSX ExportFormat = "xlsx"
+
+// Excel limits sheet names to 31 characters
+const maxSheetNameLen = 31
+
+// ExportToXLSX exports records to an Excel workbook with one column per field.
+// Numeric and logical fields are written as typed cells, the header row is
+// frozen, and the sheet is laid out right-to-left when it contains Persian text.
+func (e *Exporter) ExportToXLSX(records []paradox.Record, fields []paradox.Field, outputPath string) error {
+	f, err := e.buildXLSX(records, fields, sheetName(outputPath))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err := f.SaveAs(outputPath); err != nil {
+		return fmt.Errorf("failed to save XLSX: %w", err)
+	}
+
+	return nil
+}
+
+// ExportToXLSXWriter writes the workbook of ExportToXLSX to w, with a sheet
+// named sheet
+func (e *Exporter) ExportToXLSXWriter(w io.Writer, records []paradox.Record, fields []paradox.Field, sheet string) error {
+	f, err := e.buildXLSX(records, fields, cleanSheetName(sheet))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err := f.Write(w); err != nil {
+		return fmt.Errorf("failed to write XLSX: %w", err)
+	}
+
+	return nil
+}
+
+// buildXLSX creates the workbook of an XLSX export
+func (e *Exporter) buildXLSX(records []paradox.Record, fields []paradox.Field, sheet string) (*excelize.File, error) {
+	// Convert string fields, run transformers, filter, sort and encrypt
+	records, err := e.prepareRecords(records)
+	if err != nil {
+		return nil, err
+	}
+
+	f := excelize.NewFile()
+	built := false
+	defer func() {
+		if !built {
+			f.Close()
+		}
+	}()
+
+	if err := f.SetSheetName(f.GetSheetName(0), sheet); err != nil {
+		return nil, fmt.Errorf("failed to name sheet: %w", err)
+	}
+
+	rtl := hasRTLText(records)
+	if err := f.SetSheetView(sheet, -1, &excelize.ViewOptions{RightToLeft: &rtl}); err != nil {
+		return nil, fmt.Errorf("failed to set sheet direction: %w", err)
+	}
+
+	headerStyle, err := f.NewStyle(&excelize.Style{
+		Font:      &excelize.Font{Bold: true},
+		Fill:      excelize.Fill{Type: "pattern", Pattern: 1, Color: []string{"#D9E1F2"}},
+		Alignment: &excelize.Alignment{Horizontal: "center"},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create header style: %w", err)
+	}
+
+	columnStyles := make([]int, len(fields))
+	for i, field := range fields {
+		columnStyles[i], err = f.NewStyle(xlsxFieldStyle(field.Type))
+		if err != nil {
+			return nil, fmt.Errorf("failed to create style for %s: %w", field.Name, err)
+		}
+	}
+
+	sw, err := f.NewStreamWriter(sheet)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create sheet writer: %w", err)
+	}
+
+	if err := sw.SetPanes(&excelize.Panes{
+		Freeze:      true,
+		YSplit:      1,
+		TopLeftCell: "A2",
+		ActivePane:  "bottomLeft",
+	}); err != nil {
+		return nil, fmt.Errorf("failed to freeze header row: %w", err)
+	}
+
+	for i, field := range fields {
+		if err := sw.SetColWidth(i+1, i+1, xlsxColumnWidth(field)); err != nil {
+			return nil, fmt.Errorf("failed to set column width: %w", err)
+		}
+	}
+
+	// Write header
+	header := make([]interface{}, len(fields))
+	for i, field := range fields {
+		header[i] = excelize.Cell{StyleID: headerStyle, Value: field.Name}
+	}
+	if err := sw.SetRow("A1", header); err != nil {
+		return nil, fmt.Errorf("failed to write XLSX header: %w", err)
+	}
+
+	// Write records
+	for r, record := range records {
+		row := make([]interface{}, len(fields))
+		for i, field := range fields {
+			row[i] = excelize.Cell{StyleID: columnStyles[i], Value: record[field.Name]}
+		}
+
+		cell, err := excelize.CoordinatesToCellName(1, r+2)
+		if err != nil {
+			return nil, fmt.Errorf("failed to address row %d: %w", r+2, err)
+		}
+		if err := sw.SetRow(cell, row); err != nil {
+			return nil, fmt.Errorf("failed to write XLSX row: %w", err)
+		}
+	}
+
+	if err := sw.Flush(); err != nil {
+		return nil, fmt.Errorf("failed to write XLSX sheet: %w", err)
+	}
+
+	built = true
+	return f, nil
+}
+
+// xlsxFieldStyle returns the cell style for a Paradox field type
+func xlsxFieldStyle(fieldType string) *excelize.Style {
+	switch fieldType {
+	case "short", "long", "autoinc", "date":
+		return &excelize.Style{NumFmt: 1} // 0
+	case "currency":
+		return &excelize.Style{NumFmt: 4} // #,##0.00
+	case "number", "bcd":
+		format := "0.##########"
+		return &excelize.Style{CustomNumFmt: &format}
+	default:
+		return &excelize.Style{NumFmt: 49} // @ (text), keeps codes like 00123 intact
+	}
+}
+
+// xlsxColumnWidth picks a column width from the field size
+func xlsxColumnWidth(field paradox.Field) float64 {
+	width := float64(len(field.Name) + 2)
+	if field.Type == "alpha" && float64(field.Size) > width {
+		width = float64(field.Size)
+	}
+	return min(max(width, 8), 50)
+}
+
+// sheetName derives a valid sheet name from the output file name
+func sheetName(outputPath string) string {
+	return cleanSheetName(strings.TrimSuffix(filepath.Base(outputPath), filepath.Ext(outputPath)))
+}
+
+// cleanSheetName replaces the characters Excel does not allow in sheet names
+// and shortens the name to the allowed length
+func cleanSheetName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`:\/?*[]`, r) {
+			return '_'
+		}
+		return r
+	}, name)
+
+	if runes := []rune(name); len(runes) > maxSheetNameLen {
+		name = string(runes[:maxSheetNameLen])
+	}
+	if name == "" {
+		name = "Sheet1"
+	}
+	return name
+}
+
+// hasRTLText reports whether any string value contains Arabic-script text
+func hasRTLText(records []paradox.Record) bool {
+	for _, record := range records {
+		for _, value := range record {
+			s, ok := value.(string)
+			if !ok {
+				continue
+			}
+			for _, r := range s {
+				if unicode.Is(unicode.Arabic, r) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
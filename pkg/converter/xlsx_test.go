@@ -0,0 +1,111 @@
+package converter
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+
+	"github.com/atomicdeploy/patris-export/pkg/paradox"
+	"github.com/xuri/excelize/v2"
+)
+
+func TestExportToXLSX(t *testing.T) {
+	fields := []paradox.Field{
+		{Name: "Code", Type: "alpha", Size: 10},
+		{Name: "Name", Type: "alpha", Size: 40},
+		{Name: "Price", Type: "currency", Size: 8},
+		{Name: "ANBAR1", Type: "long", Size: 4},
+	}
+	records := []paradox.Record{
+		{"Code": "00123", "Name": "کالای آزمایشی", "Price": 1250.5, "ANBAR1": 7},
+		{"Code": "00124", "Name": nil, "Price": 0.0, "ANBAR1": 0},
+	}
+
+	outputPath := filepath.Join(t.TempDir(), "kala.xlsx")
+	exp := NewExporter(nil)
+	if err := exp.ExportToXLSX(records, fields, outputPath); err != nil {
+		t.Fatalf("Failed to export XLSX: %v", err)
+	}
+
+	f, err := excelize.OpenFile(outputPath)
+	if err != nil {
+		t.Fatalf("Failed to open XLSX: %v", err)
+	}
+	defer f.Close()
+
+	if name := f.GetSheetName(0); name != "kala" {
+		t.Errorf("Expected sheet 'kala', got %q", name)
+	}
+
+	rows, err := f.GetRows("kala")
+	if err != nil {
+		t.Fatalf("Failed to read rows: %v", err)
+	}
+	if len(rows) != 3 {
+		t.Fatalf("Expected header + 2 rows, got %d", len(rows))
+	}
+	if rows[0][0] != "Code" || rows[0][3] != "ANBAR1" {
+		t.Errorf("Unexpected header: %v", rows[0])
+	}
+	if rows[1][0] != "00123" {
+		t.Errorf("Expected leading zeros to be kept, got %q", rows[1][0])
+	}
+
+	// Numeric fields must be stored as numbers, not text
+	cellType, err := f.GetCellType("kala", "D2")
+	if err != nil {
+		t.Fatalf("Failed to get cell type: %v", err)
+	}
+	if cellType == excelize.CellTypeSharedString || cellType == excelize.CellTypeInlineString {
+		t.Errorf("Expected ANBAR1 to be numeric, got type %v", cellType)
+	}
+
+	panes, err := f.GetPanes("kala")
+	if err != nil {
+		t.Fatalf("Failed to read panes: %v", err)
+	}
+	if !panes.Freeze || panes.YSplit != 1 {
+		t.Errorf("Expected frozen header row, got %+v", panes)
+	}
+
+	view, err := f.GetSheetView("kala", -1)
+	if err != nil {
+		t.Fatalf("Failed to read sheet view: %v", err)
+	}
+	if view.RightToLeft == nil || !*view.RightToLeft {
+		t.Error("Expected right-to-left sheet for Persian text")
+	}
+}
+
+func TestExportToXLSXWriter(t *testing.T) {
+	fields := []paradox.Field{
+		{Name: "Code", Type: "alpha", Size: 10},
+		{Name: "ANBAR1", Type: "long", Size: 4},
+	}
+	records := []paradox.Record{
+		{"Code": "00123", "ANBAR1": 7},
+	}
+
+	var buf bytes.Buffer
+	exp := NewExporter(nil)
+	if err := exp.ExportToXLSXWriter(&buf, records, fields, "kala/2025"); err != nil {
+		t.Fatalf("Failed to export XLSX: %v", err)
+	}
+
+	f, err := excelize.OpenReader(&buf)
+	if err != nil {
+		t.Fatalf("Failed to open XLSX: %v", err)
+	}
+	defer f.Close()
+
+	if name := f.GetSheetName(0); name != "kala_2025" {
+		t.Errorf("Expected sheet 'kala_2025', got %q", name)
+	}
+	rows, err := f.GetRows(f.GetSheetName(0))
+	if err != nil {
+		t.Fatalf("Failed to read rows: %v", err)
+	}
+	if len(rows) != 2 || rows[1][0] != "00123" {
+		t.Errorf("Unexpected rows: %v", rows)
+	}
+}
@@ -0,0 +1,58 @@
+package converter
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/atomicdeploy/patris-export/pkg/paradox"
+	"gopkg.in/yaml.v3"
+)
+
+func TestExportToYAML(t *testing.T) {
+	records := []paradox.Record{
+		{
+			"Code":   "12345",
+			"Name":   "Test Product",
+			"ANBAR1": 10,
+			"ANBAR2": 20,
+			"ANBAR3": 30,
+			"Sort1":  "Removed",
+		},
+	}
+
+	outputPath := filepath.Join(t.TempDir(), "kala.yaml")
+	exp := NewExporter(nil)
+	if err := exp.ExportToYAML(records, outputPath); err != nil {
+		t.Fatalf("Failed to export YAML: %v", err)
+	}
+
+	data, err := os.ReadFile(outputPath)
+	if err != nil {
+		t.Fatalf("Failed to read YAML: %v", err)
+	}
+	output := string(data)
+
+	if !strings.Contains(output, "ANBAR: [10, 20, 30]") {
+		t.Errorf("Expected inline ANBAR sequence, got:\n%s", output)
+	}
+
+	if strings.Contains(output, "Sort1") {
+		t.Errorf("Sort fields should be removed, got:\n%s", output)
+	}
+
+	// The document must mirror the transformed JSON structure
+	var decoded map[string]map[string]interface{}
+	if err := yaml.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Exported YAML is invalid: %v", err)
+	}
+
+	record, ok := decoded["12345"]
+	if !ok {
+		t.Fatalf("Expected record keyed by Code, got %v", decoded)
+	}
+	if record["Name"] != "Test Product" {
+		t.Errorf("Expected Name 'Test Product', got %v", record["Name"])
+	}
+}
@@ -0,0 +1,240 @@
+package datasource
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/atomicdeploy/patris-export/pkg/paradox"
+	"github.com/atomicdeploy/patris-export/pkg/resilient"
+)
+
+// Cached is a table whose fields and records are kept between reads, so a
+// server or a long-running pipeline does not parse the file on every read.
+// The table is opened again (see NewDataSource) only when its content
+// changed: the SHA-256 of the file, hashed again only when its size or
+// modification time changed, or the version a remote table or a directory
+// reports. With a
+// TTL the source is checked at most once per TTL; reads within it return
+// the cached records without looking at the source.
+type Cached struct {
+	path string
+	opts Options
+	ttl  time.Duration
+
+	mu       sync.Mutex
+	loaded   bool
+	checked  time.Time
+	size     int64
+	modTime  time.Time
+	version  string
+	modified time.Time
+	fields   []paradox.Field
+	records  []paradox.Record
+	encoded  bool
+	hits     int
+	misses   int
+}
+
+// NewCached creates a cached table at path, opened with opts when read
+func NewCached(path string, opts Options, ttl time.Duration) *Cached {
+	return &Cached{path: path, opts: opts, ttl: ttl}
+}
+
+// Refresh reads the table again if its content changed since the last read
+// and the TTL has passed
+func (c *Cached) Refresh() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.refresh()
+}
+
+// refresh is Refresh with c.mu held
+func (c *Cached) refresh() error {
+	if c.loaded && c.ttl > 0 && time.Since(c.checked) < c.ttl {
+		c.hits++
+		return nil
+	}
+
+	if IsRemote(c.path) {
+		// Fetching the version fetches the records too
+		return c.load("")
+	}
+
+	info, err := os.Stat(c.path)
+	if err != nil {
+		return fmt.Errorf("failed to stat database: %w", err)
+	}
+	if info.IsDir() {
+		// A directory's modification time does not follow its tables'
+		// content; opening it hashes them
+		return c.load("")
+	}
+	if c.loaded && info.Size() == c.size && info.ModTime().Equal(c.modTime) {
+		c.checked = time.Now()
+		c.hits++
+		return nil
+	}
+
+	version, err := hashFile(c.path)
+	if err != nil {
+		return err
+	}
+	if c.loaded && version == c.version {
+		// Touched without a change of content
+		c.checked = time.Now()
+		c.hits++
+	} else if err := c.load(version); err != nil {
+		return err
+	}
+	c.size, c.modTime = info.Size(), info.ModTime()
+	c.modified = info.ModTime()
+	return nil
+}
+
+// load reads the fields and records of the table; version is the content's
+// hash, or empty for a source reporting its own version
+func (c *Cached) load(version string) error {
+	source, err := NewDataSource(c.path, c.opts)
+	if err != nil {
+		return fmt.Errorf("failed to open database: %w", err)
+	}
+	defer source.Close()
+
+	if versioned, ok := source.(Versioned); ok {
+		version = versioned.Version()
+		if c.loaded && version == c.version {
+			c.checked = time.Now()
+			c.hits++
+			return nil
+		}
+		c.modified = versioned.Modified()
+	}
+
+	fields, err := source.GetFields()
+	if err != nil {
+		return fmt.Errorf("failed to read fields: %w", err)
+	}
+	records, err := source.GetRecords()
+	if err != nil {
+		return fmt.Errorf("failed to read records: %w", err)
+	}
+
+	c.loaded = true
+	c.checked = time.Now()
+	c.version = version
+	c.fields = fields
+	c.records = records
+	c.encoded = source.Encoded()
+	c.misses++
+	return nil
+}
+
+// hashFile returns the SHA-256 of a file, retrying transient read failures
+func hashFile(path string) (string, error) {
+	hash, err := resilient.HashFile(path, sha256.New)
+	if err != nil {
+		return "", fmt.Errorf("failed to hash database: %w", err)
+	}
+	return hash, nil
+}
+
+// Invalidate makes the next read check the source even within the TTL,
+// hashing the file again, as after a change reported by a watcher
+func (c *Cached) Invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.checked = time.Time{}
+	c.size = -1
+}
+
+// GetFields returns the table's fields, reading it if it changed
+func (c *Cached) GetFields() ([]paradox.Field, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.refresh(); err != nil {
+		return nil, err
+	}
+
+	fields := make([]paradox.Field, len(c.fields))
+	copy(fields, c.fields)
+	return fields, nil
+}
+
+// GetRecords returns copies of the table's records, reading it if it
+// changed
+func (c *Cached) GetRecords() ([]paradox.Record, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.refresh(); err != nil {
+		return nil, err
+	}
+
+	return copyRecords(c.records), nil
+}
+
+// snapshot returns the table's content, reading it if it changed. The
+// snapshot shares the cached fields and records, which a later read
+// replaces but never modifies.
+func (c *Cached) snapshot() (*Snapshot, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.refresh(); err != nil {
+		return nil, err
+	}
+	return &Snapshot{
+		Version:  c.version,
+		Modified: c.modified,
+		Fields:   c.fields,
+		Records:  c.records,
+		Encoded:  c.encoded,
+	}, nil
+}
+
+// Encoded reports whether the table holds Patris-encoded text, reading it
+// if it has not been read yet. A table that cannot be read is taken to be
+// a Paradox table.
+func (c *Cached) Encoded() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.loaded && c.refresh() != nil {
+		return true
+	}
+	return c.encoded
+}
+
+// Version returns the SHA-256 of the table last read, or the version a
+// remote table reported
+func (c *Cached) Version() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.version
+}
+
+// Modified returns the modification time of the table last read
+func (c *Cached) Modified() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.modified
+}
+
+// Stats returns how often reads were answered from the cache (hits) and
+// how often the table was read (misses)
+func (c *Cached) Stats() (hits, misses int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.hits, c.misses
+}
+
+// Close drops the cached records; the next read reads the table again
+func (c *Cached) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.loaded = false
+	c.version = ""
+	c.fields = nil
+	c.records = nil
+	return nil
+}
@@ -0,0 +1,96 @@
+package datasource
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"path/filepath"
+	"strings"
+)
+
+// Composite is several tables, each a data source known by its name, as
+// served together or merged into one export
+type Composite struct {
+	names   []string
+	sources map[string]DataSource
+}
+
+// NewComposite creates an empty composite
+func NewComposite() *Composite {
+	return &Composite{sources: make(map[string]DataSource)}
+}
+
+// OpenComposite opens the tables at paths (see NewDataSource), each named
+// after its path (see TableName). The tables opened are closed again if
+// one fails to open.
+func OpenComposite(paths []string, opts Options) (*Composite, error) {
+	c := NewComposite()
+	for _, path := range paths {
+		source, err := NewDataSource(path, opts)
+		if err != nil {
+			c.Close()
+			return nil, fmt.Errorf("failed to open %s: %w", path, err)
+		}
+		if err := c.Add(TableName(path), source); err != nil {
+			source.Close()
+			c.Close()
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// TableName returns the name of the table at path: the file name without
+// extension (kala.db is kala), or the first label of a remote table's host
+// (https://shop1.example.com/api/records is shop1; an address such as
+// 10.0.0.5 is 10-0-0-5)
+func TableName(path string) string {
+	if IsRemote(path) {
+		if u, err := url.Parse(path); err == nil && u.Hostname() != "" {
+			if net.ParseIP(u.Hostname()) != nil {
+				return strings.NewReplacer(".", "-", ":", "-").Replace(strings.ToLower(u.Hostname()))
+			}
+			host, _, _ := strings.Cut(u.Hostname(), ".")
+			return strings.ToLower(host)
+		}
+	}
+	return strings.ToLower(strings.TrimSuffix(filepath.Base(path), filepath.Ext(path)))
+}
+
+// Add adds a table under name; the composite closes it on Close
+func (c *Composite) Add(name string, source DataSource) error {
+	if _, ok := c.sources[name]; ok {
+		return fmt.Errorf("table %s is given twice", name)
+	}
+	c.names = append(c.names, name)
+	c.sources[name] = source
+	return nil
+}
+
+// Names returns the names of the tables in the order they were added
+func (c *Composite) Names() []string {
+	names := make([]string, len(c.names))
+	copy(names, c.names)
+	return names
+}
+
+// Table returns the table named name
+func (c *Composite) Table(name string) (DataSource, bool) {
+	source, ok := c.sources[name]
+	return source, ok
+}
+
+// Len returns the number of tables
+func (c *Composite) Len() int {
+	return len(c.names)
+}
+
+// Close closes all tables
+func (c *Composite) Close() error {
+	var errs []error
+	for _, name := range c.names {
+		errs = append(errs, c.sources[name].Close())
+	}
+	return errors.Join(errs...)
+}
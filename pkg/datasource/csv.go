@@ -0,0 +1,181 @@
+package datasource
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/atomicdeploy/patris-export/pkg/converter"
+	"github.com/atomicdeploy/patris-export/pkg/paradox"
+	"github.com/atomicdeploy/patris-export/pkg/resilient"
+)
+
+// CSV is a CSV dump of a table, as convert --format csv writes it: a header
+// row naming the fields, then one row per record. A column of numbers
+// (Latin or Persian digits, without leading zeros) is a long field when all
+// are whole and a number field otherwise; other columns are alpha fields.
+// A code column in any case is named Code, the key of the records.
+type CSV struct {
+	fields  []paradox.Field
+	records []paradox.Record
+}
+
+// OpenCSV reads a CSV dump
+func OpenCSV(path string) (*CSV, error) {
+	data, err := resilient.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CSV file: %w", err)
+	}
+	// Spreadsheet programs start UTF-8 files with a byte order mark
+	data = bytes.TrimPrefix(data, []byte("\ufeff"))
+
+	rows, err := csv.NewReader(bytes.NewReader(data)).ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse CSV file: %w", err)
+	}
+	return parseRows("CSV", rows)
+}
+
+// parseRows reads a header row and the rows under it as fields and
+// records (see CSV); kind names the file format in errors
+func parseRows(kind string, rows [][]string) (*CSV, error) {
+	if len(rows) == 0 {
+		return nil, fmt.Errorf("%s file has no header row", kind)
+	}
+	header, rows := rows[0], rows[1:]
+
+	fields := make([]paradox.Field, len(header))
+	seen := make(map[string]bool, len(header))
+	for i, name := range header {
+		name = strings.TrimSpace(name)
+		if strings.EqualFold(name, "Code") {
+			name = "Code"
+		}
+		if name == "" || seen[name] {
+			return nil, fmt.Errorf("%s column %d has an empty or duplicate name %q", kind, i+1, name)
+		}
+		seen[name] = true
+		fields[i] = columnField(name, rows, i)
+	}
+
+	records := make([]paradox.Record, len(rows))
+	for r, row := range rows {
+		record := make(paradox.Record, len(fields))
+		for i, field := range fields {
+			if value := parseValue(field.Type, row[i]); value != nil {
+				record[field.Name] = value
+			}
+		}
+		records[r] = record
+	}
+
+	return &CSV{fields: fields, records: records}, nil
+}
+
+// columnField infers the field of a column from its values
+func columnField(name string, rows [][]string, column int) paradox.Field {
+	numeric, whole := false, true
+	for _, row := range rows {
+		value := strings.TrimSpace(row[column])
+		if value == "" {
+			continue
+		}
+		if !isNumber(value) {
+			numeric = false
+			break
+		}
+		numeric = true
+		if _, err := strconv.ParseInt(latin(value), 10, 64); err != nil {
+			whole = false
+		}
+	}
+
+	switch {
+	case !numeric:
+		return paradox.Field{Name: name, Type: "alpha", Size: maxWidth(rows, column)}
+	case whole:
+		return paradox.Field{Name: name, Type: "long", Size: 4}
+	default:
+		return paradox.Field{Name: name, Type: "number", Size: 8}
+	}
+}
+
+// maxWidth returns the longest value of a column in characters
+func maxWidth(rows [][]string, column int) int {
+	width := 0
+	for _, row := range rows {
+		if n := utf8.RuneCountInString(strings.TrimSpace(row[column])); n > width {
+			width = n
+		}
+	}
+	return width
+}
+
+// isNumber reports whether a value is a decimal number that does not lose
+// anything as one: codes with leading zeros such as 007 stay text
+func isNumber(value string) bool {
+	value = strings.TrimPrefix(latin(value), "-")
+	if value == "" || len(value) > 1 && value[0] == '0' && value[1] != '.' {
+		return false
+	}
+	point := false
+	for i := 0; i < len(value); i++ {
+		switch {
+		case value[i] >= '0' && value[i] <= '9':
+		case value[i] == '.' && !point:
+			point = true
+		default:
+			return false
+		}
+	}
+	return value != "."
+}
+
+// latin returns a value with Latin digits
+func latin(value string) string {
+	return converter.ConvertDigits(value, converter.DigitsLatin)
+}
+
+// parseValue converts a cell to the value of its field's type. Empty cells
+// are null and left out of the record, as the Paradox reader leaves out
+// empty fields.
+func parseValue(fieldType, cell string) interface{} {
+	if strings.TrimSpace(cell) == "" {
+		return nil
+	}
+	if fieldType == "alpha" {
+		return cell
+	}
+	value := latin(strings.TrimSpace(cell))
+	if fieldType == "long" {
+		n, _ := strconv.Atoi(value)
+		return n
+	}
+	f, _ := strconv.ParseFloat(value, 64)
+	return f
+}
+
+// GetFields returns the columns as fields
+func (c *CSV) GetFields() ([]paradox.Field, error) {
+	fields := make([]paradox.Field, len(c.fields))
+	copy(fields, c.fields)
+	return fields, nil
+}
+
+// GetRecords returns copies of the rows as records
+func (c *CSV) GetRecords() ([]paradox.Record, error) {
+	return copyRecords(c.records), nil
+}
+
+// Encoded reports that CSV dumps hold Unicode text
+func (c *CSV) Encoded() bool {
+	return false
+}
+
+// Close does nothing; the file is read when opened
+func (c *CSV) Close() error {
+	return nil
+}
@@ -0,0 +1,131 @@
+package datasource
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/atomicdeploy/patris-export/pkg/paradox"
+)
+
+// DataSource is a table that serve, diff and the viewer read records from:
+// a Paradox table, a dump of one in another format, or another server's
+// records
+type DataSource interface {
+	// GetFields returns the table's fields in column order
+	GetFields() ([]paradox.Field, error)
+	// GetRecords returns the table's records
+	GetRecords() ([]paradox.Record, error)
+	// Encoded reports whether text is stored in Patris's legacy encoding and
+	// must be converted with a character map. Dumps written by convert hold
+	// Unicode text already.
+	Encoded() bool
+	// Close releases the source
+	Close() error
+}
+
+// Options configures how a data source is opened
+type Options struct {
+	// Shadow reads a Paradox table from a temporary copy (see
+	// paradox.OpenShadow)
+	Shadow bool
+	// Header is sent with the requests for a remote table (e.g. X-API-Key)
+	Header http.Header
+	// MaxAge is how long a remote table's records are reused without a
+	// request
+	MaxAge time.Duration
+}
+
+// Versioned is a data source that is not a local file, which reports the
+// version of its content itself
+type Versioned interface {
+	// Version identifies the content; it changes when the records change
+	Version() string
+	// Modified returns when the content last changed
+	Modified() time.Time
+}
+
+// NewDataSource opens the table at path: http and https URLs are fetched
+// as remote tables, directories are read as their .db tables together (see
+// Directory), files are opened by the factory registered for their
+// extension (see RegisterDataSource; .csv, .json, .sqlite and .xlsx files
+// are built in), and anything else is read as a Paradox table
+func NewDataSource(path string, opts Options) (DataSource, error) {
+	if IsRemote(path) {
+		return remoteOpener(path, opts)
+	}
+	if isDir(path) {
+		return directoryOpener(path, opts)
+	}
+	if factory, ok := lookupFactory(filepath.Ext(path)); ok {
+		return factory(path, opts)
+	}
+	return paradoxOpener(path, opts)
+}
+
+// remoteOpener opens a remote table (see OpenRemote)
+func remoteOpener(url string, opts Options) (DataSource, error) {
+	remote, err := OpenRemote(url, opts.Header, opts.MaxAge)
+	if err != nil {
+		return nil, err
+	}
+	return remote, nil
+}
+
+// directoryOpener opens the tables of a directory (see OpenDirectory)
+func directoryOpener(dir string, opts Options) (DataSource, error) {
+	directory, err := OpenDirectory(dir, opts)
+	if err != nil {
+		return nil, err
+	}
+	return directory, nil
+}
+
+// isDir reports whether path is a directory
+func isDir(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
+
+// paradoxOpener opens a Paradox table (see OpenParadox)
+func paradoxOpener(path string, opts Options) (DataSource, error) {
+	table, err := OpenParadox(path, opts.Shadow)
+	if err != nil {
+		return nil, err
+	}
+	return table, nil
+}
+
+// Paradox is a Paradox table
+type Paradox struct {
+	*paradox.Database
+}
+
+// OpenParadox opens a Paradox table, through a temporary copy if shadow is
+// set
+func OpenParadox(path string, shadow bool) (*Paradox, error) {
+	db, err := paradox.OpenTable(path, shadow)
+	if err != nil {
+		return nil, err
+	}
+	return &Paradox{Database: db}, nil
+}
+
+// Encoded reports that Paradox tables hold Patris-encoded text
+func (p *Paradox) Encoded() bool {
+	return true
+}
+
+// copyRecords returns copies of records, so callers cannot modify the
+// records a source holds
+func copyRecords(records []paradox.Record) []paradox.Record {
+	copies := make([]paradox.Record, len(records))
+	for i, record := range records {
+		copies[i] = make(paradox.Record, len(record))
+		for name, value := range record {
+			copies[i][name] = value
+		}
+	}
+	return copies
+}
@@ -0,0 +1,613 @@
+package datasource
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/atomicdeploy/patris-export/pkg/converter"
+	"github.com/atomicdeploy/patris-export/pkg/paradox"
+	"github.com/atomicdeploy/patris-export/pkg/watcher"
+)
+
+func TestCSV(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "kala.csv")
+	data := "\ufeffcode,Name,Serial,FOROSH,ANBAR1\n" +
+		"101,آی سی,007,1500.5,۱۲\n" +
+		"102,سنسور,102,,3\n"
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatalf("Failed to write CSV: %v", err)
+	}
+
+	source, err := NewDataSource(path, Options{})
+	if err != nil {
+		t.Fatalf("NewDataSource failed: %v", err)
+	}
+	defer source.Close()
+	if source.Encoded() {
+		t.Error("Expected CSV text not to need a character map")
+	}
+
+	fields, err := source.GetFields()
+	if err != nil {
+		t.Fatalf("GetFields failed: %v", err)
+	}
+	expected := []paradox.Field{
+		{Name: "Code", Type: "long", Size: 4},
+		{Name: "Name", Type: "alpha", Size: 5},
+		{Name: "Serial", Type: "alpha", Size: 3},
+		{Name: "FOROSH", Type: "number", Size: 8},
+		{Name: "ANBAR1", Type: "long", Size: 4},
+	}
+	if !reflect.DeepEqual(fields, expected) {
+		t.Errorf("Expected fields %v, got %v", expected, fields)
+	}
+
+	records, err := source.GetRecords()
+	if err != nil {
+		t.Fatalf("GetRecords failed: %v", err)
+	}
+	want := []paradox.Record{
+		{"Code": 101, "Name": "آی سی", "Serial": "007", "FOROSH": 1500.5, "ANBAR1": 12},
+		{"Code": 102, "Name": "سنسور", "Serial": "102", "ANBAR1": 3},
+	}
+	if !reflect.DeepEqual(records, want) {
+		t.Errorf("Expected records %v, got %v", want, records)
+	}
+
+	// Callers get copies of the records
+	records[0]["Name"] = "changed"
+	if again, _ := source.GetRecords(); again[0]["Name"] != "آی سی" {
+		t.Error("Records were modified through a returned record")
+	}
+}
+
+func TestCSVInvalid(t *testing.T) {
+	dir := t.TempDir()
+	for name, data := range map[string]string{
+		"empty.csv":     "",
+		"duplicate.csv": "Code,Name,name2,Name\n1,a,b,c\n",
+		"ragged.csv":    "Code,Name\n1\n",
+	} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+		if _, err := OpenCSV(path); err == nil {
+			t.Errorf("Expected an error reading %s", name)
+		}
+	}
+}
+
+func TestRemote(t *testing.T) {
+	requests, notModified := 0, 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-API-Key") != "secret" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		requests++
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			notModified++
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		w.Write([]byte(`{"success": true, "records": {
+			"1000000": {"Code": 1000000, "Name": "آی سی", "FOROSH": 1500.5, "KHARID": [10, 20]},
+			"102": {"Code": 102, "Name": "سنسور", "FOROSH": 3}
+		}}`))
+	}))
+	defer ts.Close()
+
+	if _, err := NewDataSource(ts.URL+"/api/records", Options{}); err == nil {
+		t.Error("Expected an error without the API key")
+	}
+
+	header := http.Header{"X-API-Key": {"secret"}}
+	source, err := NewDataSource(ts.URL+"/api/records", Options{Header: header})
+	if err != nil {
+		t.Fatalf("NewDataSource failed: %v", err)
+	}
+	defer source.Close()
+	if source.Encoded() {
+		t.Error("Expected remote text not to need a character map")
+	}
+
+	records, err := source.GetRecords()
+	if err != nil {
+		t.Fatalf("GetRecords failed: %v", err)
+	}
+	want := []paradox.Record{
+		{"Code": 1000000, "Name": "آی سی", "FOROSH": 1500.5, "KHARID": []interface{}{10, 20}},
+		{"Code": 102, "Name": "سنسور", "FOROSH": 3},
+	}
+	if !reflect.DeepEqual(records, want) {
+		t.Errorf("Expected records %v, got %v", want, records)
+	}
+
+	fields, err := source.GetFields()
+	if err != nil {
+		t.Fatalf("GetFields failed: %v", err)
+	}
+	expected := []paradox.Field{
+		{Name: "Code", Type: "long", Size: 4},
+		{Name: "FOROSH", Type: "number", Size: 8},
+		{Name: "KHARID", Type: "alpha"},
+		{Name: "Name", Type: "alpha", Size: 5},
+	}
+	if !reflect.DeepEqual(fields, expected) {
+		t.Errorf("Expected fields %v, got %v", expected, fields)
+	}
+
+	// A second request is answered with 304 and the same version
+	again, err := OpenRemote(ts.URL+"/api/records", header, 0)
+	if err != nil {
+		t.Fatalf("OpenRemote failed: %v", err)
+	}
+	if notModified != 1 {
+		t.Errorf("Expected a conditional request answered with 304, got %d", notModified)
+	}
+	if again.Version() != source.(Versioned).Version() {
+		t.Error("Expected the version to stay the same when not modified")
+	}
+
+	// Within the maximum age no request is made
+	if _, err := OpenRemote(ts.URL+"/api/records", header, time.Minute); err != nil {
+		t.Fatalf("OpenRemote failed: %v", err)
+	}
+	if requests != 2 {
+		t.Errorf("Expected 2 requests, got %d", requests)
+	}
+}
+
+func TestComposite(t *testing.T) {
+	dir := t.TempDir()
+	kala := filepath.Join(dir, "Kala.csv")
+	moshtari := filepath.Join(dir, "moshtari.csv")
+	if err := os.WriteFile(kala, []byte("Code,Name\n1,a\n2,b\n"), 0644); err != nil {
+		t.Fatalf("Failed to write CSV: %v", err)
+	}
+	if err := os.WriteFile(moshtari, []byte("Code,Name\n7,c\n"), 0644); err != nil {
+		t.Fatalf("Failed to write CSV: %v", err)
+	}
+
+	tables, err := OpenComposite([]string{moshtari, kala}, Options{})
+	if err != nil {
+		t.Fatalf("OpenComposite failed: %v", err)
+	}
+	defer tables.Close()
+
+	if names := tables.Names(); !reflect.DeepEqual(names, []string{"moshtari", "kala"}) {
+		t.Errorf("Expected tables in the order given, got %v", names)
+	}
+	source, ok := tables.Table("kala")
+	if !ok {
+		t.Fatal("Expected table kala")
+	}
+	if records, _ := source.GetRecords(); len(records) != 2 {
+		t.Errorf("Expected 2 kala records, got %d", len(records))
+	}
+	if _, ok := tables.Table("missing"); ok {
+		t.Error("Expected no table named missing")
+	}
+
+	if _, err := OpenComposite([]string{kala, kala}, Options{}); err == nil {
+		t.Error("Expected an error for a table given twice")
+	}
+	if _, err := OpenComposite([]string{kala, filepath.Join(dir, "missing.csv")}, Options{}); err == nil {
+		t.Error("Expected an error for a missing table")
+	}
+}
+
+func TestTableName(t *testing.T) {
+	for path, want := range map[string]string{
+		"data/KALA.db":                          "kala",
+		"kala.csv":                              "kala",
+		"https://Shop1.example.com/api/records": "shop1",
+		"http://10.0.0.5:8080/api/records":      "10-0-0-5",
+	} {
+		if got := TableName(path); got != want {
+			t.Errorf("TableName(%q) = %q, want %q", path, got, want)
+		}
+	}
+}
+
+func TestCached(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "kala.csv")
+	write := func(data string, modified time.Time) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatalf("Failed to write CSV: %v", err)
+		}
+		if err := os.Chtimes(path, modified, modified); err != nil {
+			t.Fatalf("Failed to set modification time: %v", err)
+		}
+	}
+	start := time.Now().Add(-time.Hour)
+	write("Code,Name\n1,a\n", start)
+
+	cached := NewCached(path, Options{}, 0)
+	defer cached.Close()
+	name := func() interface{} {
+		t.Helper()
+		records, err := cached.GetRecords()
+		if err != nil {
+			t.Fatalf("GetRecords failed: %v", err)
+		}
+		return records[0]["Name"]
+	}
+
+	if got := name(); got != "a" {
+		t.Errorf("Expected a, got %v", got)
+	}
+	version := cached.Version()
+	name()
+	if hits, misses := cached.Stats(); hits != 1 || misses != 1 {
+		t.Errorf("Expected 1 hit and 1 miss, got %d and %d", hits, misses)
+	}
+
+	// Touching the file without changing it hashes it but does not read it
+	write("Code,Name\n1,a\n", start.Add(time.Minute))
+	name()
+	if _, misses := cached.Stats(); misses != 1 {
+		t.Errorf("Expected the unchanged file not to be read again, got %d reads", misses)
+	}
+	if cached.Version() != version {
+		t.Error("Expected the version to stay the same")
+	}
+
+	write("Code,Name\n1,b\n", start.Add(2*time.Minute))
+	if got := name(); got != "b" {
+		t.Errorf("Expected the changed record b, got %v", got)
+	}
+	if cached.Version() == version {
+		t.Error("Expected the version to change with the content")
+	}
+
+	// Within the TTL changes are seen only after Invalidate
+	ttl := NewCached(path, Options{}, time.Hour)
+	defer ttl.Close()
+	ttl.GetRecords()
+	write("Code,Name\n1,c\n", start.Add(3*time.Minute))
+	if records, _ := ttl.GetRecords(); records[0]["Name"] != "b" {
+		t.Errorf("Expected the cached record b within the TTL, got %v", records[0]["Name"])
+	}
+	ttl.Invalidate()
+	if records, _ := ttl.GetRecords(); records[0]["Name"] != "c" {
+		t.Errorf("Expected the changed record c after Invalidate, got %v", records[0]["Name"])
+	}
+}
+
+func TestJSON(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "kala.json")
+	data := `{"metadata": {"source": "kala.db"}, "records": {
+		"101": {"Code": 101, "Name": "آی سی", "FOROSH": 1500.5, "ANBAR": [12, 0]},
+		"102": {"Code": 102, "Name": "سنسور", "FOROSH": 3}
+	}}`
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatalf("Failed to write JSON: %v", err)
+	}
+
+	source, err := NewDataSource(path, Options{})
+	if err != nil {
+		t.Fatalf("NewDataSource failed: %v", err)
+	}
+	defer source.Close()
+	if source.Encoded() {
+		t.Error("Expected JSON text not to need a character map")
+	}
+
+	fields, err := source.GetFields()
+	if err != nil {
+		t.Fatalf("GetFields failed: %v", err)
+	}
+	expected := []paradox.Field{
+		{Name: "Code", Type: "long", Size: 4},
+		{Name: "ANBAR", Type: "alpha"},
+		{Name: "FOROSH", Type: "number", Size: 8},
+		{Name: "Name", Type: "alpha", Size: 5},
+	}
+	if !reflect.DeepEqual(fields, expected) {
+		t.Errorf("Expected fields %v, got %v", expected, fields)
+	}
+
+	records, err := source.GetRecords()
+	if err != nil {
+		t.Fatalf("GetRecords failed: %v", err)
+	}
+	if len(records) != 2 || records[0]["Name"] != "آی سی" || records[1]["FOROSH"] != 3 {
+		t.Errorf("Unexpected records %v", records)
+	}
+
+	array := filepath.Join(t.TempDir(), "array.json")
+	if err := os.WriteFile(array, []byte(`{"metadata": {}, "records": [{"Code": 1}]}`), 0644); err != nil {
+		t.Fatalf("Failed to write JSON: %v", err)
+	}
+	if _, err := OpenJSON(array); err == nil {
+		t.Error("Expected an error reading an array export")
+	}
+}
+
+func TestSQLite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "kala.sqlite")
+	fields := []paradox.Field{
+		{Name: "Code", Type: "long", Size: 4},
+		{Name: "Name", Type: "alpha", Size: 40},
+		{Name: "FOROSH", Type: "number", Size: 8},
+	}
+	records := []paradox.Record{
+		{"Code": 101, "Name": "آی سی", "FOROSH": 1500.5},
+		{"Code": 102, "Name": "سنسور"},
+	}
+	if err := converter.NewExporter(nil).ExportToSQLite(records, fields, path); err != nil {
+		t.Fatalf("ExportToSQLite failed: %v", err)
+	}
+
+	source, err := NewDataSource(path, Options{})
+	if err != nil {
+		t.Fatalf("NewDataSource failed: %v", err)
+	}
+	defer source.Close()
+
+	got, err := source.GetFields()
+	if err != nil {
+		t.Fatalf("GetFields failed: %v", err)
+	}
+	expected := []paradox.Field{
+		{Name: "Code", Type: "long", Size: 4},
+		{Name: "Name", Type: "alpha", Size: 5},
+		{Name: "FOROSH", Type: "number", Size: 8},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected fields %v, got %v", expected, got)
+	}
+
+	read, err := source.GetRecords()
+	if err != nil {
+		t.Fatalf("GetRecords failed: %v", err)
+	}
+	if !reflect.DeepEqual(read, records) {
+		t.Errorf("Expected records %v, got %v", records, read)
+	}
+
+	if _, err := OpenSQLite(filepath.Join(t.TempDir(), "missing.sqlite")); err == nil {
+		t.Error("Expected an error for a missing database")
+	}
+}
+
+func TestXLSX(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "kala.xlsx")
+	fields := []paradox.Field{
+		{Name: "Code", Type: "long", Size: 4},
+		{Name: "Name", Type: "alpha", Size: 40},
+		{Name: "FOROSH", Type: "number", Size: 8},
+	}
+	records := []paradox.Record{
+		{"Code": 101, "Name": "آی سی", "FOROSH": 1500.5},
+		{"Code": 102, "Name": "سنسور"},
+	}
+	if err := converter.NewExporter(nil).ExportToXLSX(records, fields, path); err != nil {
+		t.Fatalf("ExportToXLSX failed: %v", err)
+	}
+
+	source, err := NewDataSource(path, Options{})
+	if err != nil {
+		t.Fatalf("NewDataSource failed: %v", err)
+	}
+	defer source.Close()
+
+	got, err := source.GetFields()
+	if err != nil {
+		t.Fatalf("GetFields failed: %v", err)
+	}
+	expected := []paradox.Field{
+		{Name: "Code", Type: "long", Size: 4},
+		{Name: "Name", Type: "alpha", Size: 5},
+		{Name: "FOROSH", Type: "number", Size: 8},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected fields %v, got %v", expected, got)
+	}
+
+	read, err := source.GetRecords()
+	if err != nil {
+		t.Fatalf("GetRecords failed: %v", err)
+	}
+	if !reflect.DeepEqual(read, records) {
+		t.Errorf("Expected records %v, got %v", records, read)
+	}
+	if source.Encoded() {
+		t.Error("Expected XLSX text not to be encoded")
+	}
+
+	if _, err := OpenXLSX(filepath.Join(t.TempDir(), "missing.xlsx")); err == nil {
+		t.Error("Expected an error for a missing workbook")
+	}
+}
+
+func TestDirectory(t *testing.T) {
+	data, err := os.ReadFile("../../testdata/kala.db")
+	if err != nil {
+		t.Fatalf("Failed to read test table: %v", err)
+	}
+	dir := t.TempDir()
+	for _, name := range []string{"kala.db", "Anbar.DB", "notes.txt"} {
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+
+	source, err := NewDataSource(dir, Options{})
+	if err != nil {
+		t.Fatalf("NewDataSource failed: %v", err)
+	}
+	defer source.Close()
+	directory, ok := source.(*Directory)
+	if !ok {
+		t.Fatalf("Expected a directory, got %T", source)
+	}
+	if names := directory.Tables().Names(); !reflect.DeepEqual(names, []string{"anbar", "kala"}) {
+		t.Errorf("Expected tables anbar and kala, got %v", names)
+	}
+
+	fields, err := source.GetFields()
+	if err != nil {
+		t.Fatalf("GetFields failed: %v", err)
+	}
+	table, _ := directory.Tables().Table("kala")
+	tableFields, _ := table.GetFields()
+	if len(fields) != len(tableFields)+1 || fields[0].Name != TableField {
+		t.Errorf("Expected %s and the %d fields of the tables, got %v", TableField, len(tableFields), fields)
+	}
+
+	records, err := source.GetRecords()
+	if err != nil {
+		t.Fatalf("GetRecords failed: %v", err)
+	}
+	tableRecords, _ := table.GetRecords()
+	if len(records) != 2*len(tableRecords) {
+		t.Fatalf("Expected %d records, got %d", 2*len(tableRecords), len(records))
+	}
+	if records[0][TableField] != "anbar" || records[len(records)-1][TableField] != "kala" {
+		t.Errorf("Expected records tagged anbar then kala, got %v and %v", records[0][TableField], records[len(records)-1][TableField])
+	}
+	if !source.Encoded() {
+		t.Error("Expected the tables' text to be encoded")
+	}
+
+	// Cached reads a directory again when a table is removed
+	cached := NewCached(dir, Options{}, 0)
+	defer cached.Close()
+	cached.GetRecords()
+	version := cached.Version()
+	if err := os.Remove(filepath.Join(dir, "Anbar.DB")); err != nil {
+		t.Fatalf("Failed to remove table: %v", err)
+	}
+	if records, _ := cached.GetRecords(); len(records) != len(tableRecords) {
+		t.Errorf("Expected %d records after removing a table, got %d", len(tableRecords), len(records))
+	}
+	if cached.Version() == version {
+		t.Error("Expected the version to change with the tables")
+	}
+
+	if _, err := OpenDirectory(t.TempDir(), Options{}); err == nil {
+		t.Error("Expected an error for a directory without tables")
+	}
+}
+
+// staticSource is a data source of fixed records
+type staticSource struct {
+	records []paradox.Record
+}
+
+func (s *staticSource) GetFields() ([]paradox.Field, error) {
+	return inferFields(s.records), nil
+}
+
+func (s *staticSource) GetRecords() ([]paradox.Record, error) {
+	return copyRecords(s.records), nil
+}
+
+func (s *staticSource) Encoded() bool { return false }
+
+func (s *staticSource) Close() error { return nil }
+
+func TestRegisterDataSource(t *testing.T) {
+	var opened string
+	RegisterDataSource("TXT", func(path string, opts Options) (DataSource, error) {
+		opened = path
+		return &staticSource{records: []paradox.Record{{"Code": 1, "Name": "a"}}}, nil
+	})
+	defer UnregisterDataSource(".txt")
+
+	found := false
+	for _, ext := range Extensions() {
+		found = found || ext == ".txt"
+	}
+	if !found {
+		t.Errorf("Expected .txt among the extensions %v", Extensions())
+	}
+
+	source, err := NewDataSource("KALA.TXT", Options{})
+	if err != nil {
+		t.Fatalf("NewDataSource failed: %v", err)
+	}
+	if opened != "KALA.TXT" {
+		t.Errorf("Expected the registered factory to open KALA.TXT, got %q", opened)
+	}
+	if records, _ := source.GetRecords(); len(records) != 1 || records[0]["Name"] != "a" {
+		t.Errorf("Unexpected records %v", records)
+	}
+
+	// A failed open returns no source rather than a nil pointer in one
+	source, err = NewDataSource(filepath.Join(t.TempDir(), "missing.csv"), Options{})
+	if err == nil || source != nil {
+		t.Errorf("Expected an error and no source, got %v and %v", source, err)
+	}
+}
+
+func TestLive(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "kala.csv")
+	if err := os.WriteFile(path, []byte("Code,Name\n1,a\n"), 0644); err != nil {
+		t.Fatalf("Failed to write CSV: %v", err)
+	}
+
+	live, err := OpenLive(path, Options{}, LiveOptions{
+		Watch: watcher.Options{Mode: watcher.ModePoll, PollInterval: 20 * time.Millisecond},
+	})
+	if err != nil {
+		t.Fatalf("OpenLive failed: %v", err)
+	}
+	defer live.Close()
+
+	first := live.Snapshot()
+	if len(first.Records) != 1 || first.Records[0]["Name"] != "a" {
+		t.Fatalf("Unexpected first snapshot %v", first.Records)
+	}
+
+	changes := make(chan [2]*Snapshot, 4)
+	cancel := live.Subscribe(func(previous, current *Snapshot) {
+		changes <- [2]*Snapshot{previous, current}
+	})
+	defer cancel()
+
+	if err := os.WriteFile(path, []byte("Code,Name\n1,b\n2,c\n"), 0644); err != nil {
+		t.Fatalf("Failed to write CSV: %v", err)
+	}
+	select {
+	case change := <-changes:
+		if change[0] != first {
+			t.Error("Expected the first snapshot as the previous one")
+		}
+		if len(change[1].Records) != 2 || change[1].Records[0]["Name"] != "b" {
+			t.Errorf("Unexpected new snapshot %v", change[1].Records)
+		}
+		if change[1].Version == first.Version {
+			t.Error("Expected a new version")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for the change")
+	}
+	if records, _ := live.GetRecords(); len(records) != 2 {
+		t.Errorf("Expected the records of the new snapshot, got %v", records)
+	}
+
+	// A refresh without a change of content publishes nothing
+	if err := live.Refresh(); err != nil {
+		t.Fatalf("Refresh failed: %v", err)
+	}
+	select {
+	case change := <-changes:
+		t.Errorf("Expected no change, got %v", change[1].Records)
+	default:
+	}
+
+	if _, err := OpenLive("https://shop1.example.com/api/records", Options{}, LiveOptions{}); err == nil {
+		t.Error("Expected an error watching a remote table")
+	}
+}
@@ -0,0 +1,173 @@
+package datasource
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/atomicdeploy/patris-export/pkg/paradox"
+)
+
+// TableField is the record field naming the table a directory's record was
+// read from. The underscore keeps it apart from the tables' own fields.
+const TableField = "_table"
+
+// Directory is the Paradox tables of a directory, the .db files a Patris
+// installation keeps side by side, read as one data source: its fields are
+// those of all tables and each record carries the name of its table (see
+// TableName) in TableField. Records of different tables may share a code.
+// The tables are also available one by one, as served by name.
+type Directory struct {
+	tables   *Composite
+	version  string
+	modified time.Time
+}
+
+// DirectoryTables returns the .db files of a directory in name order
+func DirectoryTables(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read directory: %w", err)
+	}
+
+	var paths []string
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.EqualFold(filepath.Ext(entry.Name()), ".db") {
+			paths = append(paths, filepath.Join(dir, entry.Name()))
+		}
+	}
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("no .db tables found in %s", dir)
+	}
+	return paths, nil
+}
+
+// OpenDirectory opens the .db files of a directory as Paradox tables
+func OpenDirectory(dir string, opts Options) (*Directory, error) {
+	paths, err := DirectoryTables(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	// Hashed before opening, so a table changing in between is read again
+	version, modified, err := hashTables(paths)
+	if err != nil {
+		return nil, err
+	}
+
+	tables := NewComposite()
+	for _, path := range paths {
+		table, err := paradoxOpener(path, opts)
+		if err != nil {
+			tables.Close()
+			return nil, fmt.Errorf("failed to open %s: %w", path, err)
+		}
+		if err := tables.Add(TableName(path), table); err != nil {
+			table.Close()
+			tables.Close()
+			return nil, err
+		}
+	}
+
+	return &Directory{tables: tables, version: version, modified: modified}, nil
+}
+
+// hashTables returns the SHA-256 of the names and contents of the tables
+// and the latest modification time among them
+func hashTables(paths []string) (string, time.Time, error) {
+	hash := sha256.New()
+	var modified time.Time
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return "", time.Time{}, fmt.Errorf("failed to stat database: %w", err)
+		}
+		if info.ModTime().After(modified) {
+			modified = info.ModTime()
+		}
+		sum, err := hashFile(path)
+		if err != nil {
+			return "", time.Time{}, err
+		}
+		fmt.Fprintf(hash, "%s\x00%s\n", filepath.Base(path), sum)
+	}
+	return hex.EncodeToString(hash.Sum(nil)), modified, nil
+}
+
+// Tables returns the directory's tables by name; they are closed with the
+// directory
+func (d *Directory) Tables() *Composite {
+	return d.tables
+}
+
+// GetFields returns TableField followed by the fields of the tables; a
+// field of several tables is listed once, as the first table has it
+func (d *Directory) GetFields() ([]paradox.Field, error) {
+	table := paradox.Field{Name: TableField, Type: "alpha"}
+	for _, name := range d.tables.Names() {
+		if n := utf8.RuneCountInString(name); n > table.Size {
+			table.Size = n
+		}
+	}
+
+	fields := []paradox.Field{table}
+	seen := map[string]bool{TableField: true}
+	for _, name := range d.tables.Names() {
+		source, _ := d.tables.Table(name)
+		tableFields, err := source.GetFields()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read fields of %s: %w", name, err)
+		}
+		for _, field := range tableFields {
+			if !seen[field.Name] {
+				seen[field.Name] = true
+				fields = append(fields, field)
+			}
+		}
+	}
+	return fields, nil
+}
+
+// GetRecords returns the records of all tables in table order, each with
+// its table's name in TableField
+func (d *Directory) GetRecords() ([]paradox.Record, error) {
+	var records []paradox.Record
+	for _, name := range d.tables.Names() {
+		source, _ := d.tables.Table(name)
+		tableRecords, err := source.GetRecords()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read records of %s: %w", name, err)
+		}
+		for _, record := range tableRecords {
+			record[TableField] = name
+			records = append(records, record)
+		}
+	}
+	return records, nil
+}
+
+// Encoded reports that Paradox tables hold Patris-encoded text
+func (d *Directory) Encoded() bool {
+	return true
+}
+
+// Version returns the SHA-256 of the names and contents of the tables when
+// they were opened
+func (d *Directory) Version() string {
+	return d.version
+}
+
+// Modified returns the latest modification time among the tables
+func (d *Directory) Modified() time.Time {
+	return d.modified
+}
+
+// Close closes the tables
+func (d *Directory) Close() error {
+	return d.tables.Close()
+}
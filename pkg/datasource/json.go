@@ -0,0 +1,184 @@
+package datasource
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"unicode/utf8"
+
+	"github.com/atomicdeploy/patris-export/pkg/paradox"
+	"github.com/atomicdeploy/patris-export/pkg/resilient"
+)
+
+// JSON is a JSON export of a table keyed by Code, as convert --format json
+// writes it, optionally in its --envelope metadata envelope. The records
+// are transformed already (e.g. numbered fields combined into arrays);
+// their values are Unicode text.
+type JSON struct {
+	records []paradox.Record
+}
+
+// OpenJSON reads a JSON export
+func OpenJSON(path string) (*JSON, error) {
+	data, err := resilient.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read JSON file: %w", err)
+	}
+	records, err := parseJSONRecords(data)
+	if err != nil {
+		return nil, err
+	}
+	return &JSON{records: records}, nil
+}
+
+// GetFields infers the fields from the records' values (see inferFields)
+func (j *JSON) GetFields() ([]paradox.Field, error) {
+	return inferFields(j.records), nil
+}
+
+// GetRecords returns copies of the records
+func (j *JSON) GetRecords() ([]paradox.Record, error) {
+	return copyRecords(j.records), nil
+}
+
+// Encoded reports that JSON exports hold Unicode text
+func (j *JSON) Encoded() bool {
+	return false
+}
+
+// Close does nothing; the file is read when opened
+func (j *JSON) Close() error {
+	return nil
+}
+
+// parseJSONRecords decodes the records of a JSON document: the server's
+// {"records": {...}} answer, an export in a metadata envelope, or an
+// export keyed by Code
+func parseJSONRecords(body []byte) ([]paradox.Record, error) {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	// Whole numbers stay integers, so code 1000000 is not keyed as 1e+06
+	decoder.UseNumber()
+
+	var document map[string]interface{}
+	if err := decoder.Decode(&document); err != nil {
+		return nil, fmt.Errorf("not a JSON export keyed by code: %w", err)
+	}
+
+	keyed := document
+	if wrapped, ok := document["records"]; ok {
+		if keyed, ok = wrapped.(map[string]interface{}); !ok {
+			return nil, fmt.Errorf("records are not keyed by code (array exports cannot be read)")
+		}
+	}
+
+	codes := make([]string, 0, len(keyed))
+	for code := range keyed {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+
+	records := make([]paradox.Record, 0, len(keyed))
+	for _, code := range codes {
+		values, ok := keyed[code].(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("record %s is not an object", code)
+		}
+		record := make(paradox.Record, len(values))
+		for name, value := range values {
+			if value = jsonValue(value); value != nil {
+				record[name] = value
+			}
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+// jsonValue converts the numbers of a decoded value to int when whole and
+// float64 otherwise, as the Paradox reader returns them
+func jsonValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			return int(n)
+		}
+		f, _ := v.Float64()
+		return f
+	case []interface{}:
+		for i := range v {
+			v[i] = jsonValue(v[i])
+		}
+	case map[string]interface{}:
+		for name := range v {
+			v[name] = jsonValue(v[name])
+		}
+	}
+	return value
+}
+
+// inferFields infers the fields of records from their values, Code first
+// and the others by name. Whole numbers are long fields, other numbers
+// number fields, booleans logical fields and anything else (text, arrays)
+// alpha fields.
+func inferFields(records []paradox.Record) []paradox.Field {
+	fields := make(map[string]*paradox.Field)
+	for _, record := range records {
+		for name, value := range record {
+			field := fields[name]
+			if field == nil {
+				field = &paradox.Field{Name: name, Type: valueType(value)}
+				fields[name] = field
+			} else if t := valueType(value); t != field.Type {
+				if field.Type == "long" && t == "number" {
+					field.Type = "number"
+				} else if !(field.Type == "number" && t == "long") {
+					field.Type = "alpha"
+				}
+			}
+			if text, ok := value.(string); ok && utf8.RuneCountInString(text) > field.Size {
+				field.Size = utf8.RuneCountInString(text)
+			}
+		}
+	}
+
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if (names[i] == "Code") != (names[j] == "Code") {
+			return names[i] == "Code"
+		}
+		return names[i] < names[j]
+	})
+
+	result := make([]paradox.Field, len(names))
+	for i, name := range names {
+		field := *fields[name]
+		switch field.Type {
+		case "long":
+			field.Size = 4
+		case "number":
+			field.Size = 8
+		case "logical":
+			field.Size = 1
+		}
+		result[i] = field
+	}
+	return result
+}
+
+// valueType returns the Paradox field type of a value
+func valueType(value interface{}) string {
+	switch value.(type) {
+	case int:
+		return "long"
+	case float64:
+		return "number"
+	case bool:
+		return "logical"
+	default:
+		return "alpha"
+	}
+}
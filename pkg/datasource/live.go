@@ -0,0 +1,190 @@
+package datasource
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/atomicdeploy/patris-export/pkg/paradox"
+	"github.com/atomicdeploy/patris-export/pkg/watcher"
+)
+
+// Snapshot is the content of a live table at one version. It is shared
+// between the table's readers and subscribers and must not be modified.
+type Snapshot struct {
+	// Version is the SHA-256 of the file the snapshot was read from
+	Version string
+	// Modified is the file's modification time
+	Modified time.Time
+	Fields   []paradox.Field
+	Records  []paradox.Record
+	// Encoded reports whether text must be converted with a character map
+	// (see DataSource)
+	Encoded bool
+}
+
+// LiveOptions configures how a live table watches its file
+type LiveOptions struct {
+	// Watch selects how changes are detected (see watcher.New)
+	Watch watcher.Options
+	// Debounce is how long changes must pause before the file is read
+	Debounce time.Duration
+}
+
+// Live is a table kept in memory and read again whenever its file changes,
+// so a server, its sinks and exporters all see one current snapshot instead
+// of each reading the file. Subscribers are called with each new snapshot.
+// A change that leaves the content as it was (e.g. only the modification
+// time) is not reported.
+type Live struct {
+	source *Cached
+	fw     *watcher.FileWatcher
+
+	mu       sync.RWMutex
+	snapshot *Snapshot
+
+	subMu       sync.Mutex
+	subscribers map[int]func(previous, current *Snapshot)
+	nextID      int
+}
+
+// OpenLive reads the table at path (see NewDataSource) and watches it until
+// Close. Remote tables cannot be watched.
+func OpenLive(path string, opts Options, live LiveOptions) (*Live, error) {
+	if IsRemote(path) {
+		return nil, fmt.Errorf("remote table %s cannot be watched", path)
+	}
+
+	l := &Live{
+		source:      NewCached(path, opts, 0),
+		subscribers: make(map[int]func(previous, current *Snapshot)),
+	}
+	if _, _, err := l.reload(); err != nil {
+		return nil, err
+	}
+
+	fw, err := watcher.New(live.Watch, path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create file watcher: %w", err)
+	}
+	if err := fw.WatchEvents(path, func(event watcher.Event) error {
+		if event.Size == 0 {
+			// Truncated by a writer that has not written the table yet
+			return nil
+		}
+		return l.Refresh()
+	}, live.Debounce); err != nil {
+		fw.Close()
+		return nil, fmt.Errorf("failed to watch file: %w", err)
+	}
+	l.fw = fw
+	fw.Start(context.Background())
+	return l, nil
+}
+
+// Refresh reads the table again and, if its content changed, publishes the
+// new snapshot to the subscribers. The watcher calls it on every change;
+// call it to pick up a change the watcher cannot see.
+func (l *Live) Refresh() error {
+	l.source.Invalidate()
+	previous, current, err := l.reload()
+	if err != nil || previous == nil {
+		return err
+	}
+
+	l.subMu.Lock()
+	subscribers := make([]func(previous, current *Snapshot), 0, len(l.subscribers))
+	for id := 0; id < l.nextID; id++ {
+		if fn, ok := l.subscribers[id]; ok {
+			subscribers = append(subscribers, fn)
+		}
+	}
+	l.subMu.Unlock()
+
+	for _, fn := range subscribers {
+		fn(previous, current)
+	}
+	return nil
+}
+
+// reload reads the table and replaces the snapshot if its version changed.
+// It returns the replaced and the new snapshot; previous is nil if the
+// content is unchanged or this is the first read.
+func (l *Live) reload() (previous, current *Snapshot, err error) {
+	current, err = l.source.snapshot()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	previous = l.snapshot
+	if previous != nil && previous.Version == current.Version {
+		return nil, previous, nil
+	}
+	l.snapshot = current
+	return previous, current, nil
+}
+
+// Subscribe calls fn with the previous and current snapshot after each
+// change of the table's content, in the watcher's goroutine, in the order
+// subscribers were added. The returned function ends the subscription.
+func (l *Live) Subscribe(fn func(previous, current *Snapshot)) (cancel func()) {
+	l.subMu.Lock()
+	defer l.subMu.Unlock()
+	id := l.nextID
+	l.nextID++
+	l.subscribers[id] = fn
+	return func() {
+		l.subMu.Lock()
+		defer l.subMu.Unlock()
+		delete(l.subscribers, id)
+	}
+}
+
+// Snapshot returns the current content of the table
+func (l *Live) Snapshot() *Snapshot {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.snapshot
+}
+
+// Polling reports whether the file is polled instead of watched through
+// notifications
+func (l *Live) Polling() bool {
+	return l.fw.Polling()
+}
+
+// GetFields returns the fields of the current snapshot
+func (l *Live) GetFields() ([]paradox.Field, error) {
+	snapshot := l.Snapshot()
+	fields := make([]paradox.Field, len(snapshot.Fields))
+	copy(fields, snapshot.Fields)
+	return fields, nil
+}
+
+// GetRecords returns copies of the records of the current snapshot
+func (l *Live) GetRecords() ([]paradox.Record, error) {
+	return copyRecords(l.Snapshot().Records), nil
+}
+
+// Encoded reports whether the current snapshot holds Patris-encoded text
+func (l *Live) Encoded() bool {
+	return l.Snapshot().Encoded
+}
+
+// Version returns the SHA-256 of the current snapshot's file
+func (l *Live) Version() string {
+	return l.Snapshot().Version
+}
+
+// Modified returns the modification time of the current snapshot's file
+func (l *Live) Modified() time.Time {
+	return l.Snapshot().Modified
+}
+
+// Close stops watching the file, waiting for a running refresh
+func (l *Live) Close() error {
+	return l.fw.Close()
+}
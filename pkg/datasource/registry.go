@@ -0,0 +1,85 @@
+package datasource
+
+import (
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Factory opens the table at path as a data source
+type Factory func(path string, opts Options) (DataSource, error)
+
+var (
+	factoriesMu sync.RWMutex
+	// factories maps file extensions (".csv") to the factories opening them
+	factories = make(map[string]Factory)
+)
+
+func init() {
+	RegisterDataSource(".csv", opener(OpenCSV))
+	RegisterDataSource(".json", opener(OpenJSON))
+	RegisterDataSource(".sqlite", opener(OpenSQLite))
+	RegisterDataSource(".sqlite3", opener(OpenSQLite))
+	RegisterDataSource(".xlsx", opener(OpenXLSX))
+}
+
+// opener adapts an Open function of a file format to a Factory. A failed
+// open returns a nil DataSource rather than a nil pointer in one.
+func opener[T DataSource](open func(path string) (T, error)) Factory {
+	return func(path string, _ Options) (DataSource, error) {
+		source, err := open(path)
+		if err != nil {
+			return nil, err
+		}
+		return source, nil
+	}
+}
+
+// RegisterDataSource makes NewDataSource open files with the extension ext
+// (e.g. ".xml"; matched in any case) with factory, replacing the built-in
+// or earlier registered factory of the extension. Programs embedding this
+// package register their own source types this way, typically from an init
+// function.
+func RegisterDataSource(ext string, factory Factory) {
+	factoriesMu.Lock()
+	defer factoriesMu.Unlock()
+	factories[normalizeExt(ext)] = factory
+}
+
+// UnregisterDataSource removes the factory of an extension; its files are
+// then opened as Paradox tables
+func UnregisterDataSource(ext string) {
+	factoriesMu.Lock()
+	defer factoriesMu.Unlock()
+	delete(factories, normalizeExt(ext))
+}
+
+// Extensions returns the registered extensions sorted
+func Extensions() []string {
+	factoriesMu.RLock()
+	defer factoriesMu.RUnlock()
+
+	exts := make([]string, 0, len(factories))
+	for ext := range factories {
+		exts = append(exts, ext)
+	}
+	sort.Strings(exts)
+	return exts
+}
+
+// lookupFactory returns the factory of an extension
+func lookupFactory(ext string) (Factory, bool) {
+	factoriesMu.RLock()
+	defer factoriesMu.RUnlock()
+	factory, ok := factories[normalizeExt(ext)]
+	return factory, ok
+}
+
+// normalizeExt lower-cases an extension and adds its leading dot
+func normalizeExt(ext string) string {
+	ext = strings.ToLower(strings.TrimSpace(ext))
+	if !strings.HasPrefix(ext, ".") {
+		ext = "." + ext
+	}
+	return ext
+}
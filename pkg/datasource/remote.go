@@ -0,0 +1,168 @@
+package datasource
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/atomicdeploy/patris-export/pkg/paradox"
+)
+
+// RemoteTimeout bounds a request for a remote table
+const RemoteTimeout = 30 * time.Second
+
+// DefaultRemoteMaxAge is how long a remote table's records are reused
+// without asking the server again
+const DefaultRemoteMaxAge = 5 * time.Second
+
+var remoteClient = &http.Client{Timeout: RemoteTimeout}
+
+// remoteResponse is the last response for a URL, reused when the server
+// answers a conditional request with 304 Not Modified
+type remoteResponse struct {
+	fetched  time.Time
+	etag     string
+	version  string
+	modified time.Time
+	records  []paradox.Record
+}
+
+var (
+	remoteMu sync.Mutex
+	// remoteResponses holds the last response of each URL
+	remoteResponses = make(map[string]*remoteResponse)
+)
+
+// Remote is a table fetched from another patris-export server's
+// /api/records endpoint, or any URL returning a JSON export keyed by Code
+// (optionally in a metadata envelope). The records are transformed
+// already; their values are Unicode text.
+type Remote struct {
+	url      string
+	version  string
+	modified time.Time
+	records  []paradox.Record
+}
+
+// IsRemote reports whether a table path is an http or https URL
+func IsRemote(path string) bool {
+	lower := strings.ToLower(path)
+	return strings.HasPrefix(lower, "http://") || strings.HasPrefix(lower, "https://")
+}
+
+// OpenRemote fetches the records at url, sending header with the request
+// (e.g. X-API-Key or Authorization). Records fetched less than maxAge ago
+// are reused without a request. Otherwise the response's ETag is sent back
+// with the next request for the same URL, and a 304 Not Modified answer
+// reuses the records fetched before.
+func OpenRemote(url string, header http.Header, maxAge time.Duration) (*Remote, error) {
+	remoteMu.Lock()
+	cached := remoteResponses[url]
+	fresh := cached != nil && time.Since(cached.fetched) < maxAge
+	remoteMu.Unlock()
+	if fresh {
+		return cached.remote(url), nil
+	}
+
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	for name, values := range header {
+		for _, value := range values {
+			req.Header.Add(name, value)
+		}
+	}
+	req.Header.Set("Accept", "application/json")
+	if cached != nil && cached.etag != "" {
+		req.Header.Set("If-None-Match", cached.etag)
+	}
+
+	resp, err := remoteClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch records: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified && cached != nil {
+		remoteMu.Lock()
+		cached.fetched = time.Now()
+		remoteMu.Unlock()
+		return cached.remote(url), nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("failed to fetch records: %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+	records, err := parseJSONRecords(body)
+	if err != nil {
+		return nil, err
+	}
+
+	sum := sha256.Sum256(body)
+	response := &remoteResponse{
+		fetched:  time.Now(),
+		etag:     resp.Header.Get("ETag"),
+		version:  hex.EncodeToString(sum[:]),
+		modified: time.Now(),
+		records:  records,
+	}
+	if cached != nil && cached.version == response.version {
+		response.modified = cached.modified
+	}
+	if modified, err := http.ParseTime(resp.Header.Get("Last-Modified")); err == nil {
+		response.modified = modified
+	}
+
+	remoteMu.Lock()
+	remoteResponses[url] = response
+	remoteMu.Unlock()
+
+	return response.remote(url), nil
+}
+
+// remote returns the table of a response
+func (r *remoteResponse) remote(url string) *Remote {
+	return &Remote{url: url, version: r.version, modified: r.modified, records: r.records}
+}
+
+// Version returns the SHA-256 of the response the records were read from
+func (r *Remote) Version() string {
+	return r.version
+}
+
+// Modified returns the response's Last-Modified time, or when its content
+// was first fetched
+func (r *Remote) Modified() time.Time {
+	return r.modified
+}
+
+// GetFields infers the fields from the records' values (see inferFields)
+func (r *Remote) GetFields() ([]paradox.Field, error) {
+	return inferFields(r.records), nil
+}
+
+// GetRecords returns copies of the records
+func (r *Remote) GetRecords() ([]paradox.Record, error) {
+	return copyRecords(r.records), nil
+}
+
+// Encoded reports that remote records hold Unicode text
+func (r *Remote) Encoded() bool {
+	return false
+}
+
+// Close does nothing; the records are fetched when opened
+func (r *Remote) Close() error {
+	return nil
+}
@@ -0,0 +1,176 @@
+package datasource
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/atomicdeploy/patris-export/pkg/paradox"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// SQLite is a SQLite export of a table, as convert --format sqlite writes
+// it: a table named after the file, or the only table of the database,
+// with a column per field. Columns are mapped back to Paradox field types
+// by their declared type; NULL values are left out of the records.
+type SQLite struct {
+	fields  []paradox.Field
+	records []paradox.Record
+}
+
+// OpenSQLite reads a SQLite export
+func OpenSQLite(path string) (*SQLite, error) {
+	// Opened read-only, so a missing file is an error and not a new database
+	if _, err := os.Stat(path); err != nil {
+		return nil, fmt.Errorf("failed to open SQLite database: %w", err)
+	}
+	db, err := sql.Open("sqlite3", "file:"+filepath.ToSlash(path)+"?mode=ro")
+	if err != nil {
+		return nil, fmt.Errorf("failed to open SQLite database: %w", err)
+	}
+	defer db.Close()
+
+	table, err := sqliteTable(db, strings.TrimSuffix(filepath.Base(path), filepath.Ext(path)))
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Query("SELECT * FROM " + sqliteQuote(table))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read table %s: %w", table, err)
+	}
+	defer rows.Close()
+
+	columns, err := rows.ColumnTypes()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read columns: %w", err)
+	}
+	fields := make([]paradox.Field, len(columns))
+	for i, column := range columns {
+		fields[i] = sqliteField(column.Name(), column.DatabaseTypeName())
+	}
+
+	var records []paradox.Record
+	values := make([]interface{}, len(columns))
+	pointers := make([]interface{}, len(columns))
+	for i := range values {
+		pointers[i] = &values[i]
+	}
+	for rows.Next() {
+		if err := rows.Scan(pointers...); err != nil {
+			return nil, fmt.Errorf("failed to read row: %w", err)
+		}
+		record := make(paradox.Record, len(columns))
+		for i, field := range fields {
+			value := sqliteValue(values[i])
+			if value == nil {
+				continue
+			}
+			record[field.Name] = value
+			if text, ok := value.(string); ok && field.Type == "alpha" {
+				if n := utf8.RuneCountInString(text); n > fields[i].Size {
+					fields[i].Size = n
+				}
+			}
+		}
+		records = append(records, record)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read rows: %w", err)
+	}
+
+	return &SQLite{fields: fields, records: records}, nil
+}
+
+// sqliteTable returns the table of an export: the one named name, or the
+// database's only table
+func sqliteTable(db *sql.DB, name string) (string, error) {
+	rows, err := db.Query("SELECT name FROM sqlite_master WHERE type = 'table' AND name NOT LIKE 'sqlite_%'")
+	if err != nil {
+		return "", fmt.Errorf("failed to list tables: %w", err)
+	}
+	defer rows.Close()
+
+	var tables []string
+	for rows.Next() {
+		var table string
+		if err := rows.Scan(&table); err != nil {
+			return "", fmt.Errorf("failed to list tables: %w", err)
+		}
+		if strings.EqualFold(table, name) {
+			return table, nil
+		}
+		tables = append(tables, table)
+	}
+	if err := rows.Err(); err != nil {
+		return "", fmt.Errorf("failed to list tables: %w", err)
+	}
+	if len(tables) == 0 {
+		return "", fmt.Errorf("SQLite database has no tables")
+	}
+	if len(tables) > 1 {
+		return "", fmt.Errorf("SQLite database has no table %s (tables: %s)", name, strings.Join(tables, ", "))
+	}
+	return tables[0], nil
+}
+
+// sqliteField maps a column to a Paradox field by its declared type, the
+// reverse of the export's mapping
+func sqliteField(name, columnType string) paradox.Field {
+	if strings.EqualFold(name, "Code") {
+		name = "Code"
+	}
+	switch strings.ToUpper(columnType) {
+	case "INTEGER", "INT", "BIGINT":
+		return paradox.Field{Name: name, Type: "long", Size: 4}
+	case "REAL", "FLOAT", "DOUBLE", "NUMERIC":
+		return paradox.Field{Name: name, Type: "number", Size: 8}
+	case "BLOB":
+		return paradox.Field{Name: name, Type: "bytes"}
+	default:
+		return paradox.Field{Name: name, Type: "alpha"}
+	}
+}
+
+// sqliteValue converts a scanned value to the type the Paradox reader
+// returns: int, float64, string or []byte
+func sqliteValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case int64:
+		return int(v)
+	case []byte:
+		return append([]byte(nil), v...)
+	default:
+		return v
+	}
+}
+
+// sqliteQuote quotes an identifier
+func sqliteQuote(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+// GetFields returns the columns as fields
+func (s *SQLite) GetFields() ([]paradox.Field, error) {
+	fields := make([]paradox.Field, len(s.fields))
+	copy(fields, s.fields)
+	return fields, nil
+}
+
+// GetRecords returns copies of the rows as records
+func (s *SQLite) GetRecords() ([]paradox.Record, error) {
+	return copyRecords(s.records), nil
+}
+
+// Encoded reports that SQLite exports hold Unicode text
+func (s *SQLite) Encoded() bool {
+	return false
+}
+
+// Close does nothing; the database is read when opened
+func (s *SQLite) Close() error {
+	return nil
+}
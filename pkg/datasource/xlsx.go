@@ -0,0 +1,70 @@
+package datasource
+
+import (
+	"fmt"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// XLSX is an Excel workbook of a table, such as an export written by
+// convert --format xlsx or a price list kept by hand: the first sheet's
+// first filled row names the fields and each further row is a record. Cells are
+// read as their raw values, so number formats do not matter, and columns
+// are typed as in a CSV dump (see CSV). Empty rows, such as those above
+// the header, are skipped.
+type XLSX struct {
+	CSV
+}
+
+// OpenXLSX reads the first sheet of a workbook
+func OpenXLSX(path string) (*XLSX, error) {
+	f, err := excelize.OpenFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open XLSX file: %w", err)
+	}
+	defer f.Close()
+
+	sheet := f.GetSheetName(0)
+	rows, err := f.GetRows(sheet, excelize.Options{RawCellValue: true})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read sheet %s: %w", sheet, err)
+	}
+
+	// Rows end at their last non-empty cell; pad them to the header's width
+	var padded [][]string
+	width := 0
+	for i, row := range rows {
+		if isEmptyRow(row) {
+			continue
+		}
+		if padded == nil {
+			width = len(row)
+		}
+		if len(row) > width {
+			if !isEmptyRow(row[width:]) {
+				return nil, fmt.Errorf("XLSX row %d has values beyond the header's %d columns", i+1, width)
+			}
+			row = row[:width]
+		}
+		for len(row) < width {
+			row = append(row, "")
+		}
+		padded = append(padded, row)
+	}
+
+	table, err := parseRows("XLSX", padded)
+	if err != nil {
+		return nil, err
+	}
+	return &XLSX{CSV: *table}, nil
+}
+
+// isEmptyRow reports whether a row has no values
+func isEmptyRow(row []string) bool {
+	for _, cell := range row {
+		if cell != "" {
+			return false
+		}
+	}
+	return true
+}
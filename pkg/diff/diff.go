@@ -0,0 +1,203 @@
+package diff
+
+import (
+	"encoding/json"
+	"math"
+	"reflect"
+	"sort"
+	"time"
+)
+
+// ChangeSet describes the differences between two sets of transformed records
+type ChangeSet struct {
+	Added    map[string]interface{} `json:"added"`
+	Modified map[string]interface{} `json:"modified"`
+	Deleted  []string               `json:"deleted"`
+}
+
+// Empty reports whether the change set contains no changes
+func (c *ChangeSet) Empty() bool {
+	return len(c.Added) == 0 && len(c.Modified) == 0 && len(c.Deleted) == 0
+}
+
+// Options tune how values are compared
+type Options struct {
+	// Tolerance is the largest difference between two numbers that are
+	// still equal (e.g. 0.005 to ignore rounding noise in prices). Zero
+	// compares numbers exactly.
+	Tolerance float64
+}
+
+// Records compares two record maps keyed by record key, as returned by
+// TransformRecords or read from a JSON export. Modified holds the new
+// version of each changed record.
+func Records(before, after map[string]interface{}, opts Options) *ChangeSet {
+	changes := &ChangeSet{
+		Added:    make(map[string]interface{}),
+		Modified: make(map[string]interface{}),
+		Deleted:  []string{},
+	}
+
+	for key, record := range after {
+		old, ok := before[key]
+		if !ok {
+			changes.Added[key] = record
+		} else if !Equal(old, record, opts) {
+			changes.Modified[key] = record
+		}
+	}
+
+	for key := range before {
+		if _, ok := after[key]; !ok {
+			changes.Deleted = append(changes.Deleted, key)
+		}
+	}
+	sort.Strings(changes.Deleted)
+
+	return changes
+}
+
+// Equal compares two values by type: numbers of any type by value (an int
+// and a float64 of the same value are equal, as in records decoded from
+// JSON), slices element by element, maps key by key, times by instant, and
+// other values exactly
+func Equal(a, b interface{}, opts Options) bool {
+	if x, ok := number(a); ok {
+		y, ok := number(b)
+		return ok && numbersEqual(x, y, opts.Tolerance)
+	}
+	if _, ok := number(b); ok {
+		return false
+	}
+
+	switch x := a.(type) {
+	case nil:
+		return b == nil
+	case string:
+		y, ok := b.(string)
+		return ok && x == y
+	case bool:
+		y, ok := b.(bool)
+		return ok && x == y
+	case time.Time:
+		y, ok := b.(time.Time)
+		return ok && x.Equal(y)
+	case map[string]interface{}:
+		y, ok := b.(map[string]interface{})
+		return ok && mapsEqual(x, y, opts)
+	}
+
+	va, vb := reflect.ValueOf(a), reflect.ValueOf(b)
+	if isList(va) && isList(vb) {
+		return listsEqual(va, vb, opts)
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// Fields returns the names of the fields two records differ in, sorted: the
+// fields whose values are not Equal and those only one record has. Records
+// that are not maps differ in no named field.
+func Fields(a, b interface{}, opts Options) []string {
+	x, ok := a.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	y, ok := b.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+
+	fields := []string{}
+	for key, value := range x {
+		other, ok := y[key]
+		if !ok || !Equal(value, other, opts) {
+			fields = append(fields, key)
+		}
+	}
+	for key := range y {
+		if _, ok := x[key]; !ok {
+			fields = append(fields, key)
+		}
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+// mapsEqual compares two maps key by key
+func mapsEqual(a, b map[string]interface{}, opts Options) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for key, x := range a {
+		y, ok := b[key]
+		if !ok || !Equal(x, y, opts) {
+			return false
+		}
+	}
+	return true
+}
+
+// isList reports whether a value is a slice or an array
+func isList(v reflect.Value) bool {
+	return v.Kind() == reflect.Slice || v.Kind() == reflect.Array
+}
+
+// listsEqual compares two slices or arrays element by element, so []int and
+// []interface{} holding float64s compare by value
+func listsEqual(a, b reflect.Value, opts Options) bool {
+	if a.Len() != b.Len() {
+		return false
+	}
+	for i := 0; i < a.Len(); i++ {
+		if !Equal(a.Index(i).Interface(), b.Index(i).Interface(), opts) {
+			return false
+		}
+	}
+	return true
+}
+
+// number returns the value of a number of any numeric type
+func number(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case float32:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	case int8:
+		return float64(n), true
+	case int16:
+		return float64(n), true
+	case int32:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case uint:
+		return float64(n), true
+	case uint8:
+		return float64(n), true
+	case uint16:
+		return float64(n), true
+	case uint32:
+		return float64(n), true
+	case uint64:
+		return float64(n), true
+	case json.Number:
+		f, err := n.Float64()
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// numbersEqual compares two numbers within a tolerance; NaN equals NaN, so
+// an unchanged NaN is not reported as a change
+func numbersEqual(a, b, tolerance float64) bool {
+	if math.IsNaN(a) || math.IsNaN(b) {
+		return math.IsNaN(a) && math.IsNaN(b)
+	}
+	if a == b {
+		return true
+	}
+	return math.Abs(a-b) <= tolerance
+}
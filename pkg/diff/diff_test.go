@@ -0,0 +1,109 @@
+package diff
+
+import (
+	"encoding/json"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRecords(t *testing.T) {
+	before := map[string]interface{}{
+		"1": map[string]interface{}{"Code": 1, "Name": "A", "ANBAR": []int{1, 0}},
+		"2": map[string]interface{}{"Code": 2, "Name": "B"},
+		"3": map[string]interface{}{"Code": 3, "Name": "C"},
+	}
+	// Decoded from JSON: numbers are float64 but equal to the ints above
+	after := map[string]interface{}{
+		"1": map[string]interface{}{"Code": 1.0, "Name": "A", "ANBAR": []interface{}{1.0, 0.0}},
+		"2": map[string]interface{}{"Code": 2.0, "Name": "B2"},
+		"4": map[string]interface{}{"Code": 4.0, "Name": "D"},
+	}
+
+	changes := Records(before, after, Options{})
+
+	if len(changes.Added) != 1 || changes.Added["4"] == nil {
+		t.Errorf("Expected record 4 added, got %v", changes.Added)
+	}
+	if len(changes.Modified) != 1 || !reflect.DeepEqual(changes.Modified["2"], after["2"]) {
+		t.Errorf("Expected record 2 modified, got %v", changes.Modified)
+	}
+	if !reflect.DeepEqual(changes.Deleted, []string{"3"}) {
+		t.Errorf("Expected record 3 deleted, got %v", changes.Deleted)
+	}
+	if changes.Empty() || !Records(before, before, Options{}).Empty() {
+		t.Error("Unexpected Empty result")
+	}
+}
+
+func TestFields(t *testing.T) {
+	a := map[string]interface{}{"Code": 1, "Name": "A", "FOROSH": 1500.0, "ANBAR": []int{1, 0}}
+	b := map[string]interface{}{"Code": 1.0, "Name": "B", "FOROSH": 1500.004, "ANBAR": []interface{}{1.0, 0.0}, "Vahed": "عدد"}
+
+	if fields := Fields(a, b, Options{}); !reflect.DeepEqual(fields, []string{"FOROSH", "Name", "Vahed"}) {
+		t.Errorf("Expected FOROSH, Name and Vahed to differ, got %v", fields)
+	}
+	if fields := Fields(a, b, Options{Tolerance: 0.005}); !reflect.DeepEqual(fields, []string{"Name", "Vahed"}) {
+		t.Errorf("Expected Name and Vahed to differ within the tolerance, got %v", fields)
+	}
+	if fields := Fields(a, a, Options{}); len(fields) != 0 {
+		t.Errorf("Expected no fields to differ, got %v", fields)
+	}
+}
+
+func TestRecordsTolerance(t *testing.T) {
+	before := map[string]interface{}{"1": map[string]interface{}{"FOROSH": 1999.90, "ANBAR": []float64{1, 2}}}
+	after := map[string]interface{}{"1": map[string]interface{}{"FOROSH": 1999.9000001, "ANBAR": []float64{1, 2.0000001}}}
+
+	if Records(before, after, Options{}).Empty() {
+		t.Error("Expected a change without tolerance")
+	}
+	if changes := Records(before, after, Options{Tolerance: 0.001}); !changes.Empty() {
+		t.Errorf("Expected no change within the tolerance, got %v", changes.Modified)
+	}
+
+	after["1"].(map[string]interface{})["ANBAR"] = []float64{1, 3}
+	if Records(before, after, Options{Tolerance: 0.001}).Empty() {
+		t.Error("Expected a change in an array element beyond the tolerance")
+	}
+}
+
+func TestEqual(t *testing.T) {
+	now := time.Now()
+
+	tests := []struct {
+		name string
+		a, b interface{}
+		want bool
+	}{
+		{"int and float", 5, 5.0, true},
+		{"int64 and json.Number", int64(7), json.Number("7"), true},
+		{"different numbers", 5, 6, false},
+		{"number and string", 5, "5", false},
+		{"string and number", "5", 5, false},
+		{"strings", "کالا", "کالا", true},
+		{"different strings", "a", "b", false},
+		{"bools", true, true, true},
+		{"nil and nil", nil, nil, true},
+		{"nil and zero", nil, 0, false},
+		{"NaN", math.NaN(), math.NaN(), true},
+		{"NaN and number", math.NaN(), 1.0, false},
+		{"times", now, now.UTC(), true},
+		{"typed and untyped slices", []int{1, 2, 3}, []interface{}{1.0, 2.0, 3.0}, true},
+		{"slices of different length", []int{1, 2}, []int{1, 2, 0}, false},
+		{"slice element changed", []interface{}{0, 0, 4}, []interface{}{0, 0, 5}, false},
+		{"slice and scalar", []int{1}, 1, false},
+		{"maps", map[string]interface{}{"a": 1, "b": []int{2}}, map[string]interface{}{"a": 1.0, "b": []float64{2}}, true},
+		{"maps with different keys", map[string]interface{}{"a": 1}, map[string]interface{}{"b": 1}, false},
+		{"map and nil", map[string]interface{}{}, nil, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Equal(tt.a, tt.b, Options{}); got != tt.want {
+				t.Errorf("Equal(%v, %v) = %v, want %v", tt.a, tt.b, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,484 @@
+package encryption
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// KeySize is the AES-256 key size in bytes
+const KeySize = 32
+
+// ValuePrefix marks an encrypted field value inside an export
+const ValuePrefix = "enc:v1:"
+
+// FileExt is the extension appended to whole-file encrypted exports
+const FileExt = ".enc"
+
+// fileMagic identifies a whole-file encrypted export; fileMagicV1 one
+// written before files had their own key, which is still decrypted
+var (
+	fileMagic   = []byte("PXENC2\n")
+	fileMagicV1 = []byte("PXENC1\n")
+)
+
+// saltSize is the size of the random salt each encrypted file's key is
+// derived with
+const saltSize = 32
+
+// fileKeyInfo binds derived keys to whole-file encryption
+const fileKeyInfo = "patris-export file encryption v2"
+
+// chunkSize is the plaintext size of each sealed chunk in encrypted files
+const chunkSize = 64 * 1024
+
+// ErrNotEncrypted is returned when a file does not carry the encrypted file header
+var ErrNotEncrypted = errors.New("file is not an encrypted export")
+
+// GenerateKey writes a new random AES-256 key as hex to path
+func GenerateKey(path string) error {
+	key := make([]byte, KeySize)
+	if _, err := rand.Read(key); err != nil {
+		return fmt.Errorf("failed to generate key: %w", err)
+	}
+
+	if err := os.WriteFile(path, []byte(hex.EncodeToString(key)+"\n"), 0600); err != nil {
+		return fmt.Errorf("failed to write key: %w", err)
+	}
+
+	return nil
+}
+
+// LoadKey reads an AES-256 key stored as hex or base64 text
+func LoadKey(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key file: %w", err)
+	}
+
+	text := strings.TrimSpace(string(data))
+	if key, err := hex.DecodeString(text); err == nil && len(key) == KeySize {
+		return key, nil
+	}
+	if key, err := base64.StdEncoding.DecodeString(text); err == nil && len(key) == KeySize {
+		return key, nil
+	}
+
+	return nil, fmt.Errorf("key file %s must contain a %d-byte key as hex or base64", path, KeySize)
+}
+
+// newAEAD creates an AES-GCM cipher for the key
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	if len(key) != KeySize {
+		return nil, fmt.Errorf("invalid key size %d, expected %d", len(key), KeySize)
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// FieldEncryptor encrypts and decrypts individual record values
+type FieldEncryptor struct {
+	aead   cipher.AEAD
+	fields map[string]bool
+}
+
+// NewFieldEncryptor creates an encryptor for the named fields
+func NewFieldEncryptor(key []byte, fields []string) (*FieldEncryptor, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+
+	f := &FieldEncryptor{
+		aead:   aead,
+		fields: make(map[string]bool),
+	}
+	for _, field := range fields {
+		if field = strings.TrimSpace(field); field != "" {
+			f.fields[field] = true
+		}
+	}
+
+	return f, nil
+}
+
+// EncryptRecord replaces the configured fields of a record with encrypted values in place
+func (f *FieldEncryptor) EncryptRecord(record map[string]interface{}) error {
+	for field := range f.fields {
+		value, ok := record[field]
+		if !ok || value == nil {
+			continue
+		}
+
+		encrypted, err := f.EncryptValue(value)
+		if err != nil {
+			return fmt.Errorf("failed to encrypt field %s: %w", field, err)
+		}
+		record[field] = encrypted
+	}
+
+	return nil
+}
+
+// EncryptValue encrypts a value. The JSON encoding of the value is sealed so
+// the original type is restored on decryption.
+func (f *FieldEncryptor) EncryptValue(value interface{}) (string, error) {
+	plaintext, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, f.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	sealed := f.aead.Seal(nonce, nonce, plaintext, nil)
+	return ValuePrefix + base64.RawURLEncoding.EncodeToString(sealed), nil
+}
+
+// DecryptValue decrypts a value produced by EncryptValue and returns its JSON encoding
+func (f *FieldEncryptor) DecryptValue(value string) (json.RawMessage, error) {
+	if !IsEncryptedValue(value) {
+		return nil, fmt.Errorf("value is not encrypted")
+	}
+
+	sealed, err := base64.RawURLEncoding.DecodeString(strings.TrimPrefix(value, ValuePrefix))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode encrypted value: %w", err)
+	}
+
+	nonceSize := f.aead.NonceSize()
+	if len(sealed) < nonceSize {
+		return nil, fmt.Errorf("encrypted value is too short")
+	}
+
+	plaintext, err := f.aead.Open(nil, sealed[:nonceSize], sealed[nonceSize:], nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt value (wrong key?): %w", err)
+	}
+
+	return json.RawMessage(plaintext), nil
+}
+
+// IsEncryptedValue reports whether a string is an encrypted field value
+func IsEncryptedValue(value string) bool {
+	return strings.HasPrefix(value, ValuePrefix)
+}
+
+// DecryptJSONFields replaces every quoted encrypted value in a JSON document
+// with its original JSON value, preserving the rest of the formatting.
+func (f *FieldEncryptor) DecryptJSONFields(data []byte) ([]byte, error) {
+	var out bytes.Buffer
+	token := []byte(`"` + ValuePrefix)
+
+	for {
+		idx := bytes.Index(data, token)
+		if idx < 0 {
+			out.Write(data)
+			return out.Bytes(), nil
+		}
+
+		end := bytes.IndexByte(data[idx+1:], '"')
+		if end < 0 {
+			return nil, fmt.Errorf("unterminated encrypted value at offset %d", idx)
+		}
+		end += idx + 1
+
+		plain, err := f.DecryptValue(string(data[idx+1 : end]))
+		if err != nil {
+			return nil, err
+		}
+
+		out.Write(data[:idx])
+		out.Write(plain)
+		data = data[end+1:]
+	}
+}
+
+// DecryptCSVFields decrypts encrypted cells of a CSV document.
+// Strings are written unquoted, other values as their JSON text.
+func (f *FieldEncryptor) DecryptCSVFields(data []byte) ([]byte, error) {
+	var out bytes.Buffer
+
+	for len(data) > 0 {
+		idx := bytes.Index(data, []byte(ValuePrefix))
+		if idx < 0 {
+			out.Write(data)
+			break
+		}
+
+		end := idx + len(ValuePrefix)
+		for end < len(data) && isBase64URLByte(data[end]) {
+			end++
+		}
+
+		plain, err := f.DecryptValue(string(data[idx:end]))
+		if err != nil {
+			return nil, err
+		}
+
+		out.Write(data[:idx])
+		out.WriteString(csvCell(plain))
+		data = data[end:]
+	}
+
+	return out.Bytes(), nil
+}
+
+// csvCell renders a decrypted JSON value the way the CSV exporter writes
+// values: strings as their text and other values as their JSON, quoted as
+// encoding/csv quotes cells, since arrays and objects contain commas too
+func csvCell(raw json.RawMessage) string {
+	cell := string(raw)
+	var value interface{}
+	if err := json.Unmarshal(raw, &value); err == nil {
+		if s, ok := value.(string); ok {
+			cell = s
+		}
+	}
+	if cell == "" {
+		return ""
+	}
+
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	w.Write([]string{cell})
+	w.Flush()
+	return strings.TrimSuffix(buf.String(), "\n")
+}
+
+// isBase64URLByte reports whether b belongs to the unpadded URL-safe base64 alphabet
+func isBase64URLByte(b byte) bool {
+	return b >= 'A' && b <= 'Z' || b >= 'a' && b <= 'z' || b >= '0' && b <= '9' || b == '-' || b == '_'
+}
+
+// EncryptFile encrypts src into dst using chunked AES-GCM.
+//
+// File layout: magic, a random 32-byte salt, then a sequence of sealed
+// chunks, each preceded by its 4-byte length. The chunks are sealed with a
+// key of the file's own, derived from key and the salt with HKDF-SHA256, so
+// that their nonces, the chunk counter, never repeat under a key however
+// many files are encrypted. The final chunk is authenticated with a
+// distinct additional-data tag so truncation at a chunk boundary is
+// detected.
+func EncryptFile(src, dst string, key []byte) error {
+	if len(key) != KeySize {
+		return fmt.Errorf("invalid key size %d, expected %d", len(key), KeySize)
+	}
+	salt := make([]byte, saltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return fmt.Errorf("failed to generate salt: %w", err)
+	}
+	aead, err := fileAEAD(key, salt)
+	if err != nil {
+		return err
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return fmt.Errorf("failed to open input file: %w", err)
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return fmt.Errorf("failed to create output file: %w", err)
+	}
+	defer out.Close()
+
+	w := bufio.NewWriter(out)
+	prefix := make([]byte, aead.NonceSize()-8)
+	w.Write(fileMagic)
+	w.Write(salt)
+
+	reader := bufio.NewReaderSize(in, chunkSize)
+	buf := make([]byte, chunkSize)
+	var counter uint64
+
+	for {
+		n, readErr := io.ReadFull(reader, buf)
+		if readErr != nil && readErr != io.EOF && readErr != io.ErrUnexpectedEOF {
+			return fmt.Errorf("failed to read input file: %w", readErr)
+		}
+
+		// A short read means this is the last chunk
+		last := readErr != nil
+		if !last {
+			if _, err := reader.Peek(1); err == io.EOF {
+				last = true
+			}
+		}
+
+		sealed := aead.Seal(nil, chunkNonce(prefix, counter), buf[:n], chunkAD(last))
+		var length [4]byte
+		binary.BigEndian.PutUint32(length[:], uint32(len(sealed)))
+		w.Write(length[:])
+		if _, err := w.Write(sealed); err != nil {
+			return fmt.Errorf("failed to write output file: %w", err)
+		}
+
+		if last {
+			break
+		}
+		counter++
+	}
+
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("failed to write output file: %w", err)
+	}
+
+	return out.Close()
+}
+
+// DecryptFile decrypts a file produced by EncryptFile, or by its earlier
+// version sealing every file with key and a random nonce prefix
+func DecryptFile(src, dst string, key []byte) error {
+	if len(key) != KeySize {
+		return fmt.Errorf("invalid key size %d, expected %d", len(key), KeySize)
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return fmt.Errorf("failed to open input file: %w", err)
+	}
+	defer in.Close()
+
+	reader := bufio.NewReader(in)
+	magic := make([]byte, len(fileMagic))
+	if _, err := io.ReadFull(reader, magic); err != nil {
+		return ErrNotEncrypted
+	}
+
+	var aead cipher.AEAD
+	var prefix []byte
+	switch {
+	case bytes.Equal(magic, fileMagic):
+		salt := make([]byte, saltSize)
+		if _, err := io.ReadFull(reader, salt); err != nil {
+			return fmt.Errorf("encrypted file header is truncated")
+		}
+		if aead, err = fileAEAD(key, salt); err != nil {
+			return err
+		}
+		prefix = make([]byte, aead.NonceSize()-8)
+	case bytes.Equal(magic, fileMagicV1):
+		if aead, err = newAEAD(key); err != nil {
+			return err
+		}
+		prefix = make([]byte, aead.NonceSize()-8)
+		if _, err := io.ReadFull(reader, prefix); err != nil {
+			return fmt.Errorf("encrypted file header is truncated")
+		}
+	default:
+		return ErrNotEncrypted
+	}
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return fmt.Errorf("failed to create output file: %w", err)
+	}
+	defer out.Close()
+
+	w := bufio.NewWriter(out)
+	var counter uint64
+
+	for {
+		var length [4]byte
+		if _, err := io.ReadFull(reader, length[:]); err != nil {
+			return fmt.Errorf("encrypted file is truncated (missing final chunk)")
+		}
+
+		// A chunk never exceeds chunkSize sealed; a larger length is a
+		// corrupt file and must not be allocated
+		size := binary.BigEndian.Uint32(length[:])
+		if size > uint32(chunkSize+aead.Overhead()) {
+			return fmt.Errorf("encrypted file is corrupt: chunk %d is %d bytes, more than %d", counter, size, chunkSize+aead.Overhead())
+		}
+		sealed := make([]byte, size)
+		if _, err := io.ReadFull(reader, sealed); err != nil {
+			return fmt.Errorf("encrypted file is truncated inside chunk %d", counter)
+		}
+
+		_, peekErr := reader.Peek(1)
+		last := peekErr == io.EOF
+
+		plaintext, err := aead.Open(nil, chunkNonce(prefix, counter), sealed, chunkAD(last))
+		if err != nil {
+			return fmt.Errorf("failed to decrypt chunk %d (wrong key, tampered or truncated file): %w", counter, err)
+		}
+
+		if _, err := w.Write(plaintext); err != nil {
+			return fmt.Errorf("failed to write output file: %w", err)
+		}
+
+		if last {
+			break
+		}
+		counter++
+	}
+
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("failed to write output file: %w", err)
+	}
+
+	return out.Close()
+}
+
+// IsEncryptedFile reports whether a file starts with the encrypted file header
+func IsEncryptedFile(path string) bool {
+	file, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+
+	magic := make([]byte, len(fileMagic))
+	if _, err := io.ReadFull(file, magic); err != nil {
+		return false
+	}
+	return bytes.Equal(magic, fileMagic) || bytes.Equal(magic, fileMagicV1)
+}
+
+// fileAEAD creates the AES-GCM cipher of an encrypted file from the key
+// derived from key and the file's salt
+func fileAEAD(key, salt []byte) (cipher.AEAD, error) {
+	fileKey, err := hkdf.Key(sha256.New, key, salt, fileKeyInfo, KeySize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive file key: %w", err)
+	}
+	return newAEAD(fileKey)
+}
+
+// chunkNonce builds the nonce for a chunk from the file prefix, all zero
+// but in files of the earlier version, and counter
+func chunkNonce(prefix []byte, counter uint64) []byte {
+	return binary.BigEndian.AppendUint64(append([]byte(nil), prefix...), counter)
+}
+
+// chunkAD returns the additional data marking intermediate vs final chunks
+func chunkAD(last bool) []byte {
+	if last {
+		return []byte("last")
+	}
+	return []byte("more")
+}
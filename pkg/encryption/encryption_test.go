@@ -0,0 +1,245 @@
+package encryption
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func testKey(t *testing.T) []byte {
+	t.Helper()
+
+	keyPath := filepath.Join(t.TempDir(), "export.key")
+	if err := GenerateKey(keyPath); err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+
+	key, err := LoadKey(keyPath)
+	if err != nil {
+		t.Fatalf("Failed to load key: %v", err)
+	}
+	return key
+}
+
+func TestEncryptRecordRoundTrip(t *testing.T) {
+	enc, err := NewFieldEncryptor(testKey(t), []string{"KHARYD", "Name"})
+	if err != nil {
+		t.Fatalf("Failed to create encryptor: %v", err)
+	}
+
+	record := map[string]interface{}{
+		"Code":   1001,
+		"Name":   "ماژول",
+		"KHARYD": 1999.5,
+	}
+	if err := enc.EncryptRecord(record); err != nil {
+		t.Fatalf("Failed to encrypt record: %v", err)
+	}
+
+	for _, field := range []string{"KHARYD", "Name"} {
+		s, ok := record[field].(string)
+		if !ok || !IsEncryptedValue(s) {
+			t.Errorf("Expected %s to be encrypted, got %v", field, record[field])
+		}
+	}
+	if record["Code"] != 1001 {
+		t.Errorf("Expected Code to stay in plaintext, got %v", record["Code"])
+	}
+
+	data, _ := json.Marshal(record)
+	plain, err := enc.DecryptJSONFields(data)
+	if err != nil {
+		t.Fatalf("Failed to decrypt JSON: %v", err)
+	}
+
+	var decoded map[string]interface{}
+	if err := json.Unmarshal(plain, &decoded); err != nil {
+		t.Fatalf("Decrypted JSON is invalid: %v (%s)", err, plain)
+	}
+	if decoded["KHARYD"] != 1999.5 || decoded["Name"] != "ماژول" {
+		t.Errorf("Unexpected decrypted values: %v", decoded)
+	}
+}
+
+func TestDecryptCSVFields(t *testing.T) {
+	enc, _ := NewFieldEncryptor(testKey(t), nil)
+
+	price, _ := enc.EncryptValue(1500)
+	name, _ := enc.EncryptValue("a, b")
+	stock, _ := enc.EncryptValue([]int{3, 0, 7})
+	csvData := "Code,Name,KHARYD,ANBAR\n1001," + name + "," + price + "," + stock + "\n"
+
+	plain, err := enc.DecryptCSVFields([]byte(csvData))
+	if err != nil {
+		t.Fatalf("Failed to decrypt CSV: %v", err)
+	}
+
+	// Arrays keep their commas inside one cell
+	expected := "Code,Name,KHARYD,ANBAR\n1001,\"a, b\",1500,\"[3,0,7]\"\n"
+	if string(plain) != expected {
+		t.Errorf("Expected %q, got %q", expected, plain)
+	}
+}
+
+func TestDecryptWithWrongKey(t *testing.T) {
+	enc, _ := NewFieldEncryptor(testKey(t), nil)
+	other, _ := NewFieldEncryptor(testKey(t), nil)
+
+	value, _ := enc.EncryptValue(42)
+	if _, err := other.DecryptValue(value); err == nil {
+		t.Error("Expected decryption with a different key to fail")
+	}
+}
+
+func TestEncryptFileRoundTrip(t *testing.T) {
+	key := testKey(t)
+	tmpDir := t.TempDir()
+
+	// Larger than one chunk so multiple chunks are exercised
+	content := make([]byte, chunkSize*2+123)
+	rand.Read(content)
+
+	src := filepath.Join(tmpDir, "kala.json")
+	encPath := src + FileExt
+	outPath := filepath.Join(tmpDir, "kala.out.json")
+	os.WriteFile(src, content, 0644)
+
+	if err := EncryptFile(src, encPath, key); err != nil {
+		t.Fatalf("Failed to encrypt file: %v", err)
+	}
+	if !IsEncryptedFile(encPath) {
+		t.Fatal("Expected encrypted file header")
+	}
+
+	if err := DecryptFile(encPath, outPath, key); err != nil {
+		t.Fatalf("Failed to decrypt file: %v", err)
+	}
+
+	decrypted, _ := os.ReadFile(outPath)
+	if !bytes.Equal(decrypted, content) {
+		t.Error("Decrypted content does not match original")
+	}
+}
+
+func TestDecryptFileDetectsTruncation(t *testing.T) {
+	key := testKey(t)
+	tmpDir := t.TempDir()
+
+	src := filepath.Join(tmpDir, "kala.json")
+	encPath := src + FileExt
+	os.WriteFile(src, bytes.Repeat([]byte("x"), chunkSize*2), 0644)
+
+	if err := EncryptFile(src, encPath, key); err != nil {
+		t.Fatalf("Failed to encrypt file: %v", err)
+	}
+
+	// Cut off the final chunk exactly at a chunk boundary
+	info, _ := os.Stat(encPath)
+	chunkOnDisk := int64(4 + chunkSize + 16)
+	if err := os.Truncate(encPath, info.Size()-chunkOnDisk); err != nil {
+		t.Fatalf("Failed to truncate: %v", err)
+	}
+
+	err := DecryptFile(encPath, filepath.Join(tmpDir, "out.json"), key)
+	if err == nil || !strings.Contains(err.Error(), "chunk") {
+		t.Errorf("Expected truncation to be detected, got: %v", err)
+	}
+}
+
+func TestDecryptFileRejectsOversizedChunk(t *testing.T) {
+	key := testKey(t)
+	tmpDir := t.TempDir()
+
+	src := filepath.Join(tmpDir, "kala.json")
+	encPath := src + FileExt
+	os.WriteFile(src, bytes.Repeat([]byte("x"), 1000), 0644)
+	if err := EncryptFile(src, encPath, key); err != nil {
+		t.Fatalf("Failed to encrypt file: %v", err)
+	}
+
+	data, _ := os.ReadFile(encPath)
+	lengthAt := len(fileMagic) + saltSize
+
+	// A huge length must be rejected before allocating it
+	oversized := append([]byte(nil), data...)
+	copy(oversized[lengthAt:], []byte{0xff, 0xff, 0xff, 0xff})
+	os.WriteFile(encPath, oversized, 0644)
+	err := DecryptFile(encPath, filepath.Join(tmpDir, "out.json"), key)
+	if err == nil || !strings.Contains(err.Error(), "corrupt") {
+		t.Errorf("Expected the oversized chunk to be rejected, got: %v", err)
+	}
+
+	// A valid length with the chunk cut short is truncation
+	os.WriteFile(encPath, data[:lengthAt+4+100], 0644)
+	err = DecryptFile(encPath, filepath.Join(tmpDir, "out.json"), key)
+	if err == nil || !strings.Contains(err.Error(), "truncated inside chunk") {
+		t.Errorf("Expected the truncated chunk to be detected, got: %v", err)
+	}
+}
+
+func TestEncryptFileKeyPerFile(t *testing.T) {
+	key := testKey(t)
+	tmpDir := t.TempDir()
+
+	src := filepath.Join(tmpDir, "kala.json")
+	content := bytes.Repeat([]byte("x"), chunkSize+10)
+	os.WriteFile(src, content, 0644)
+
+	// The same content under the same key is sealed with another key
+	var encrypted [][]byte
+	for i, name := range []string{"a.enc", "b.enc"} {
+		encPath := filepath.Join(tmpDir, name)
+		if err := EncryptFile(src, encPath, key); err != nil {
+			t.Fatalf("Failed to encrypt file: %v", err)
+		}
+		data, _ := os.ReadFile(encPath)
+		encrypted = append(encrypted, data)
+
+		outPath := filepath.Join(tmpDir, fmt.Sprintf("out%d.json", i))
+		if err := DecryptFile(encPath, outPath, key); err != nil {
+			t.Fatalf("Failed to decrypt file: %v", err)
+		}
+		if decrypted, _ := os.ReadFile(outPath); !bytes.Equal(decrypted, content) {
+			t.Error("Decrypted content does not match original")
+		}
+	}
+	header := len(fileMagic) + saltSize
+	if bytes.Equal(encrypted[0][header:], encrypted[1][header:]) {
+		t.Error("Expected the chunks of each file sealed with its own key")
+	}
+}
+
+func TestDecryptFileV1(t *testing.T) {
+	key := testKey(t)
+	tmpDir := t.TempDir()
+
+	// A file of the earlier version: the key itself and a nonce prefix
+	aead, err := newAEAD(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	prefix := []byte{1, 2, 3, 4}
+	data := append(append([]byte(nil), fileMagicV1...), prefix...)
+	sealed := aead.Seal(nil, chunkNonce(prefix, 0), []byte(`{"1001":{}}`), chunkAD(true))
+	data = binary.BigEndian.AppendUint32(data, uint32(len(sealed)))
+	data = append(data, sealed...)
+
+	encPath := filepath.Join(tmpDir, "kala.json.enc")
+	os.WriteFile(encPath, data, 0644)
+	if !IsEncryptedFile(encPath) {
+		t.Fatal("Expected the earlier header to be recognized")
+	}
+	outPath := filepath.Join(tmpDir, "kala.json")
+	if err := DecryptFile(encPath, outPath, key); err != nil {
+		t.Fatalf("Failed to decrypt file: %v", err)
+	}
+	if decrypted, _ := os.ReadFile(outPath); string(decrypted) != `{"1001":{}}` {
+		t.Errorf("Unexpected content %q", decrypted)
+	}
+}
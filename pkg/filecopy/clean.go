@@ -0,0 +1,78 @@
+package filecopy
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	tempDirMu sync.RWMutex
+	tempDir   string
+)
+
+// SetTempDir sets the directory the copies are made in, such as a RAM
+// disk, creating it if needed. Empty uses the system's temporary directory.
+func SetTempDir(dir string) error {
+	if dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return fmt.Errorf("failed to create shadow directory: %w", err)
+		}
+	}
+	tempDirMu.Lock()
+	defer tempDirMu.Unlock()
+	tempDir = dir
+	return nil
+}
+
+// TempDir returns the directory the copies are made in
+func TempDir() string {
+	tempDirMu.RLock()
+	defer tempDirMu.RUnlock()
+	if tempDir == "" {
+		return os.TempDir()
+	}
+	return tempDir
+}
+
+// CleanStale removes copies in the temporary directory that were made or
+// last reused more than maxAge ago, as left behind when a process crashed,
+// and returns how many it removed. Copies held by this process are kept.
+func CleanStale(maxAge time.Duration) (int, error) {
+	dir := TempDir()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read shadow directory: %w", err)
+	}
+
+	sharedMu.Lock()
+	inUse := make(map[string]bool, len(copies))
+	for _, s := range copies {
+		inUse[s.dir] = true
+	}
+	sharedMu.Unlock()
+
+	cutoff := time.Now().Add(-maxAge)
+	removed := 0
+	var errs []error
+	for _, entry := range entries {
+		path := filepath.Join(dir, entry.Name())
+		if !entry.IsDir() || !strings.HasPrefix(entry.Name(), TempPrefix) || inUse[path] {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil || info.ModTime().After(cutoff) {
+			continue
+		}
+		if err := os.RemoveAll(path); err != nil {
+			errs = append(errs, fmt.Errorf("failed to remove stale copy: %w", err))
+			continue
+		}
+		removed++
+	}
+	return removed, errors.Join(errs...)
+}
@@ -0,0 +1,133 @@
+package filecopy
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/atomicdeploy/patris-export/pkg/resilient"
+)
+
+// familyExts are the extensions of the files Paradox keeps next to a table
+// under its name: primary index, memos and blobs, validity checks, table
+// view and family list. Secondary indexes (.Xnn, .Ynn) are matched
+// separately.
+var familyExts = map[string]bool{
+	".px":  true,
+	".mb":  true,
+	".val": true,
+	".tv":  true,
+	".fam": true,
+}
+
+// isFamilyExt reports whether an extension is one of a table's companion
+// files
+func isFamilyExt(ext string) bool {
+	ext = strings.ToLower(ext)
+	if familyExts[ext] {
+		return true
+	}
+	return len(ext) == 4 && (ext[1] == 'x' || ext[1] == 'y') && isHex(ext[2]) && isHex(ext[3])
+}
+
+// isHex reports whether a byte is a lowercase hexadecimal digit
+func isHex(b byte) bool {
+	return b >= '0' && b <= '9' || b >= 'a' && b <= 'f'
+}
+
+// family describes a table followed by its companion files, found in the
+// table's directory under the same name (in any case), sorted by name
+func family(src string) ([]FileInfo, error) {
+	info, err := os.Stat(src)
+	if err != nil {
+		return nil, err
+	}
+	files := []FileInfo{{Path: src, Size: info.Size(), ModTime: info.ModTime()}}
+
+	dir, name := filepath.Split(src)
+	entries, err := os.ReadDir(filepath.Clean(dir))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read table directory: %w", err)
+	}
+	base := strings.TrimSuffix(name, filepath.Ext(name))
+	for _, entry := range entries {
+		sibling := entry.Name()
+		ext := filepath.Ext(sibling)
+		if sibling == name || !entry.Type().IsRegular() || !isFamilyExt(ext) || !strings.EqualFold(strings.TrimSuffix(sibling, ext), base) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, FileInfo{Path: filepath.Join(dir, sibling), Size: info.Size(), ModTime: info.ModTime()})
+	}
+	sort.Slice(files[1:], func(i, j int) bool { return files[i+1].Path < files[j+1].Path })
+	return files, nil
+}
+
+// sameFiles compares two descriptions of a family: the same files with the
+// same sizes, and whether their modification times are also the same
+func sameFiles(a, b []FileInfo) (sizes, times bool) {
+	if len(a) != len(b) {
+		return false, false
+	}
+	times = true
+	for i := range a {
+		if a[i].Path != b[i].Path || a[i].Size != b[i].Size {
+			return false, false
+		}
+		if !a[i].ModTime.Equal(b[i].ModTime) {
+			times = false
+		}
+	}
+	return true, times
+}
+
+// copyFile copies a file into dir under its name, adding its name and
+// contents to h
+func copyFile(src, dir string, h hash.Hash) error {
+	in, err := resilient.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(filepath.Join(dir, filepath.Base(src)), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to create copy: %w", err)
+	}
+	io.WriteString(h, strings.ToLower(filepath.Ext(src))+"\x00")
+	if _, err := io.Copy(io.MultiWriter(out, h), in); err != nil {
+		out.Close()
+		return fmt.Errorf("failed to copy %s: %w", src, err)
+	}
+	if err := out.Close(); err != nil {
+		return fmt.Errorf("failed to write copy: %w", err)
+	}
+	return nil
+}
+
+// hashFiles returns the hash of a family as copyTo computes it
+func hashFiles(files []FileInfo) (string, error) {
+	h := sha256.New()
+	for _, f := range files {
+		file, err := resilient.Open(f.Path)
+		if err != nil {
+			return "", err
+		}
+		io.WriteString(h, strings.ToLower(filepath.Ext(f.Path))+"\x00")
+		_, err = io.Copy(h, file)
+		file.Close()
+		if err != nil {
+			return "", err
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,215 @@
+package filecopy
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/atomicdeploy/patris-export/pkg/resilient"
+)
+
+// TempPrefix starts the names of the temporary directories holding copies
+const TempPrefix = "patris-export-"
+
+// errChanged is returned when the source changed while it was copied
+var errChanged = errors.New("source changed while copying")
+
+// FileInfo describes the source of a copy as it was copied
+type FileInfo struct {
+	Path    string    `json:"path"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+}
+
+// Copy is a temporary copy of a table, in a directory of its own under the
+// original's name. The table's companion files of the same name (.px, .mb,
+// .val, .tv, .fam and secondary indexes) are copied with it, so a reader
+// looking for them next to the table finds the copies, never the live
+// originals.
+type Copy struct {
+	// Path is the copy of the table
+	Path string
+	// Source describes the original table
+	Source FileInfo
+	// Family describes the companion files copied with it
+	Family []FileInfo
+	// Hash is the SHA-256 of the copied files' extensions and contents
+	Hash string
+
+	shared *shared
+}
+
+// DefaultPolicy retries a copy for about half a minute, long enough for BDE
+// to finish a write and release its lock
+var DefaultPolicy = resilient.Policy{
+	Retries:        6,
+	InitialBackoff: 500 * time.Millisecond,
+	MaxBackoff:     10 * time.Second,
+}
+
+var (
+	policyMu sync.RWMutex
+	policy   = DefaultPolicy
+
+	busyMu sync.Mutex
+	busy   = make(map[string]Busy)
+)
+
+// SetPolicy sets how CopyToTemp retries a source that is locked, changing
+// or otherwise cannot be copied. The policy's Timeout is not used.
+func SetPolicy(p resilient.Policy) {
+	policyMu.Lock()
+	defer policyMu.Unlock()
+	policy = p
+}
+
+// GetPolicy returns the policy used by CopyToTemp
+func GetPolicy() resilient.Policy {
+	policyMu.RLock()
+	defer policyMu.RUnlock()
+	return policy
+}
+
+// Busy describes a source that could not be copied and is being retried
+type Busy struct {
+	Path string `json:"path"`
+	// Attempt is the number of failed attempts so far
+	Attempt int       `json:"attempt"`
+	Since   time.Time `json:"since"`
+	// Locked reports whether the source is locked by another process
+	Locked bool `json:"locked"`
+	// Holders names the processes holding the lock, where known
+	Holders []string `json:"holders,omitempty"`
+	Error   string   `json:"error"`
+}
+
+// Retrying reports whether a copy of src is waiting to be retried, and why
+func Retrying(src string) (Busy, bool) {
+	busyMu.Lock()
+	defer busyMu.Unlock()
+	b, ok := busy[src]
+	return b, ok
+}
+
+// BusyFiles returns the sources waiting to be copied again, by path
+func BusyFiles() []Busy {
+	busyMu.Lock()
+	defer busyMu.Unlock()
+	files := make([]Busy, 0, len(busy))
+	for _, b := range busy {
+		files = append(files, b)
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Path < files[j].Path })
+	return files
+}
+
+// CopyToTemp copies a file into a new temporary directory, so a table can
+// be read without keeping the original open while a writer such as BDE
+// needs it. The previous copy of the source is reused while the source's
+// contents are unchanged. A source that is locked, changes while it is
+// copied or fails transiently is copied again with backoff according to the
+// policy (see SetPolicy), and is reported by Retrying meanwhile. Remove the
+// copy when done.
+func CopyToTemp(src string) (*Copy, error) {
+	if c, ok := reuse(src); ok {
+		return c, nil
+	}
+
+	p := GetPolicy()
+	backoff := p.InitialBackoff
+	since := time.Now()
+	defer func() {
+		busyMu.Lock()
+		delete(busy, src)
+		busyMu.Unlock()
+	}()
+
+	for attempt := 1; ; attempt++ {
+		c, err := copyToTemp(src)
+		if err == nil {
+			share(src, c)
+			return c, nil
+		}
+		locked := isLocked(err)
+		if locked {
+			err = newLockedError(err)
+		}
+		if attempt > p.Retries || !resilient.Retryable(err) {
+			return nil, err
+		}
+
+		b := Busy{Path: src, Attempt: attempt, Since: since, Locked: locked, Error: err.Error()}
+		var lockErr *LockedError
+		if errors.As(err, &lockErr) {
+			b.Holders = lockErr.Holders
+		}
+		busyMu.Lock()
+		busy[src] = b
+		busyMu.Unlock()
+
+		if locked {
+			log.Printf("🔒 File busy, retrying %s in %v (attempt %d/%d): %v", filepath.Base(src), backoff, attempt, p.Retries+1, err)
+		} else {
+			log.Printf("⚠️  Copying %s failed, retrying in %v (attempt %d/%d): %v", filepath.Base(src), backoff, attempt, p.Retries+1, err)
+		}
+		time.Sleep(backoff)
+
+		backoff *= 2
+		if p.MaxBackoff > 0 && backoff > p.MaxBackoff {
+			backoff = p.MaxBackoff
+		}
+	}
+}
+
+// copyToTemp makes one attempt at copying a file into a new temporary
+// directory
+func copyToTemp(src string) (*Copy, error) {
+	dir, err := os.MkdirTemp(TempDir(), TempPrefix+"*")
+	if err != nil {
+		return nil, resilient.Permanent(fmt.Errorf("failed to create temporary directory: %w", err))
+	}
+	c, err := copyTo(src, dir)
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+	return c, nil
+}
+
+// copyTo copies a table and its companion files (see Copy) into dir and
+// checks that none of them changed meanwhile
+func copyTo(src, dir string) (*Copy, error) {
+	before, err := family(src)
+	if err != nil {
+		return nil, err
+	}
+
+	h := sha256.New()
+	for _, f := range before {
+		if err := copyFile(f.Path, dir, h); err != nil {
+			return nil, err
+		}
+	}
+
+	after, err := family(src)
+	if err != nil {
+		return nil, err
+	}
+	if _, unchanged := sameFiles(before, after); !unchanged {
+		return nil, fmt.Errorf("failed to copy %s: %w", src, errChanged)
+	}
+
+	return &Copy{
+		Path:   filepath.Join(dir, filepath.Base(src)),
+		Source: before[0],
+		Family: before[1:],
+		Hash:   hex.EncodeToString(h.Sum(nil)),
+	}, nil
+}
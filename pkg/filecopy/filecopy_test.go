@@ -0,0 +1,314 @@
+package filecopy
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/atomicdeploy/patris-export/pkg/resilient"
+)
+
+func TestCopyToTemp(t *testing.T) {
+	src := filepath.Join(t.TempDir(), "kala.db")
+	if err := os.WriteFile(src, []byte("table contents"), 0644); err != nil {
+		t.Fatalf("Failed to write table: %v", err)
+	}
+	info, err := os.Stat(src)
+	if err != nil {
+		t.Fatalf("Failed to stat table: %v", err)
+	}
+
+	c, err := CopyToTemp(src)
+	if err != nil {
+		t.Fatalf("CopyToTemp failed: %v", err)
+	}
+
+	if filepath.Base(c.Path) != "kala.db" || !strings.HasPrefix(filepath.Base(filepath.Dir(c.Path)), TempPrefix) {
+		t.Errorf("Expected kala.db in a %s directory, got %s", TempPrefix, c.Path)
+	}
+	data, err := os.ReadFile(c.Path)
+	if err != nil || string(data) != "table contents" {
+		t.Errorf("Expected the table's contents in the copy, got %q (%v)", data, err)
+	}
+	if c.Source.Path != src || c.Source.Size != info.Size() || !c.Source.ModTime.Equal(info.ModTime()) {
+		t.Errorf("Expected the source's metadata, got %+v", c.Source)
+	}
+
+	// The original can be removed while the copy exists
+	if err := os.Remove(src); err != nil {
+		t.Errorf("Failed to remove the original: %v", err)
+	}
+
+	if err := c.Remove(); err != nil {
+		t.Fatalf("Remove failed: %v", err)
+	}
+	if err := Purge(); err != nil {
+		t.Fatalf("Purge failed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Dir(c.Path)); !os.IsNotExist(err) {
+		t.Errorf("Expected the temporary directory to be removed, got %v", err)
+	}
+}
+
+func TestCopyToTempMissing(t *testing.T) {
+	if _, err := CopyToTemp(filepath.Join(t.TempDir(), "missing.db")); err == nil {
+		t.Error("Expected an error copying a missing file")
+	}
+}
+
+func TestCopyToTempRetry(t *testing.T) {
+	defer Purge()
+	defer SetPolicy(GetPolicy())
+	SetPolicy(resilient.Policy{Retries: 20, InitialBackoff: 10 * time.Millisecond, MaxBackoff: 20 * time.Millisecond})
+
+	// The table is a link to a directory, which cannot be copied, until
+	// the link is replaced by one to a file
+	dir := t.TempDir()
+	src := filepath.Join(dir, "kala.db")
+	table := filepath.Join(dir, "table")
+	if err := os.WriteFile(table, []byte("table contents"), 0644); err != nil {
+		t.Fatalf("Failed to write table: %v", err)
+	}
+	if err := os.Symlink(dir, src); err != nil {
+		t.Skipf("Symbolic links are not supported: %v", err)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		c, err := CopyToTemp(src)
+		if err == nil {
+			err = c.Remove()
+		}
+		done <- err
+	}()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		if b, ok := Retrying(src); ok {
+			if b.Attempt < 1 || b.Error == "" || len(BusyFiles()) != 1 {
+				t.Errorf("Expected the failed attempt to be reported, got %+v", b)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the copy to be retrying")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	link := filepath.Join(dir, "link")
+	if err := os.Symlink(table, link); err != nil {
+		t.Fatalf("Failed to create link: %v", err)
+	}
+	if err := os.Rename(link, src); err != nil {
+		t.Fatalf("Failed to replace link: %v", err)
+	}
+	if err := <-done; err != nil {
+		t.Fatalf("Expected the copy to succeed once the table can be read, got %v", err)
+	}
+	if _, ok := Retrying(src); ok {
+		t.Error("Expected no retry reported after the copy succeeded")
+	}
+}
+
+func TestCopyToTempGivesUp(t *testing.T) {
+	defer SetPolicy(GetPolicy())
+	SetPolicy(resilient.Policy{Retries: 2, InitialBackoff: time.Millisecond})
+
+	src := t.TempDir()
+	if _, err := CopyToTemp(src); err == nil {
+		t.Error("Expected an error once the retries are used up")
+	}
+	if len(BusyFiles()) != 0 {
+		t.Errorf("Expected no busy files after giving up, got %v", BusyFiles())
+	}
+}
+
+func TestCopyToTempReuse(t *testing.T) {
+	defer Purge()
+
+	src := filepath.Join(t.TempDir(), "kala.db")
+	if err := os.WriteFile(src, []byte("table contents"), 0644); err != nil {
+		t.Fatalf("Failed to write table: %v", err)
+	}
+
+	first, err := CopyToTemp(src)
+	if err != nil {
+		t.Fatalf("CopyToTemp failed: %v", err)
+	}
+	first.Remove()
+
+	// Only the modification time changed, so the copy is reused
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(src, later, later); err != nil {
+		t.Fatalf("Failed to touch table: %v", err)
+	}
+	second, err := CopyToTemp(src)
+	if err != nil {
+		t.Fatalf("CopyToTemp failed: %v", err)
+	}
+	if second.Path != first.Path || second.Hash != first.Hash {
+		t.Errorf("Expected the copy to be reused, got %s after %s", second.Path, first.Path)
+	}
+	if !second.Source.ModTime.Equal(later) {
+		t.Errorf("Expected the source's new modification time, got %v", second.Source.ModTime)
+	}
+
+	// Changed contents are copied again; the previous copy is removed once
+	// released
+	if err := os.WriteFile(src, []byte("new table contents"), 0644); err != nil {
+		t.Fatalf("Failed to write table: %v", err)
+	}
+	third, err := CopyToTemp(src)
+	if err != nil {
+		t.Fatalf("CopyToTemp failed: %v", err)
+	}
+	defer third.Remove()
+	if third.Path == first.Path || third.Hash == first.Hash {
+		t.Fatal("Expected a new copy of the changed table")
+	}
+	if data, _ := os.ReadFile(third.Path); string(data) != "new table contents" {
+		t.Errorf("Expected the new contents, got %q", data)
+	}
+	if _, err := os.Stat(second.Path); err != nil {
+		t.Errorf("Expected the previous copy to stay while in use, got %v", err)
+	}
+	second.Remove()
+	if _, err := os.Stat(filepath.Dir(first.Path)); !os.IsNotExist(err) {
+		t.Errorf("Expected the previous copy to be removed once released, got %v", err)
+	}
+}
+
+func TestCleanStale(t *testing.T) {
+	defer SetTempDir("")
+	defer Purge()
+
+	dir := filepath.Join(t.TempDir(), "shadow")
+	if err := SetTempDir(dir); err != nil {
+		t.Fatalf("SetTempDir failed: %v", err)
+	}
+
+	src := filepath.Join(t.TempDir(), "kala.db")
+	if err := os.WriteFile(src, []byte("table contents"), 0644); err != nil {
+		t.Fatalf("Failed to write table: %v", err)
+	}
+	c, err := CopyToTemp(src)
+	if err != nil {
+		t.Fatalf("CopyToTemp failed: %v", err)
+	}
+	defer c.Remove()
+	if filepath.Dir(filepath.Dir(c.Path)) != dir {
+		t.Errorf("Expected the copy in %s, got %s", dir, c.Path)
+	}
+
+	// Copies left by an earlier run, and a directory of another program
+	old := time.Now().Add(-48 * time.Hour)
+	for _, name := range []string{TempPrefix + "1", TempPrefix + "2", "other"} {
+		path := filepath.Join(dir, name)
+		if err := os.Mkdir(path, 0700); err != nil {
+			t.Fatalf("Failed to create %s: %v", name, err)
+		}
+		if err := os.Chtimes(path, old, old); err != nil {
+			t.Fatalf("Failed to age %s: %v", name, err)
+		}
+	}
+	// A copy in use is kept however old it is
+	if err := os.Chtimes(filepath.Dir(c.Path), old, old); err != nil {
+		t.Fatalf("Failed to age copy: %v", err)
+	}
+
+	removed, err := CleanStale(24 * time.Hour)
+	if err != nil {
+		t.Fatalf("CleanStale failed: %v", err)
+	}
+	if removed != 2 {
+		t.Errorf("Expected 2 stale copies removed, got %d", removed)
+	}
+	for _, path := range []string{filepath.Join(dir, "other"), c.Path} {
+		if _, err := os.Stat(path); err != nil {
+			t.Errorf("Expected %s to be kept, got %v", path, err)
+		}
+	}
+}
+
+func TestCopyToTempFamily(t *testing.T) {
+	defer Purge()
+
+	dir := t.TempDir()
+	files := map[string]string{
+		"kala.db":  "table",
+		"KALA.PX":  "primary index",
+		"kala.mb":  "memos",
+		"kala.X02": "secondary index",
+		"kala.txt": "not a companion file",
+		"anbar.px": "another table's index",
+	}
+	for name, contents := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(contents), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+	src := filepath.Join(dir, "kala.db")
+
+	c, err := CopyToTemp(src)
+	if err != nil {
+		t.Fatalf("CopyToTemp failed: %v", err)
+	}
+	entries, err := os.ReadDir(filepath.Dir(c.Path))
+	if err != nil {
+		t.Fatalf("Failed to read copy directory: %v", err)
+	}
+	var copied []string
+	for _, entry := range entries {
+		copied = append(copied, entry.Name())
+	}
+	if strings.Join(copied, ",") != "KALA.PX,kala.X02,kala.db,kala.mb" {
+		t.Errorf("Expected the table and its companion files copied, got %v", copied)
+	}
+	if len(c.Family) != 3 || c.Source.Path != src {
+		t.Errorf("Expected the table and 3 companion files described, got %+v and %+v", c.Source, c.Family)
+	}
+	for _, name := range copied {
+		data, _ := os.ReadFile(filepath.Join(filepath.Dir(c.Path), name))
+		if string(data) != files[name] {
+			t.Errorf("Expected %s to hold %q, got %q", name, files[name], data)
+		}
+	}
+	c.Remove()
+
+	// A changed memo file is copied again even though the table is not
+	later := time.Now().Add(time.Minute)
+	if err := os.WriteFile(filepath.Join(dir, "kala.mb"), []byte("MEMOS"), 0644); err != nil {
+		t.Fatalf("Failed to write memos: %v", err)
+	}
+	os.Chtimes(filepath.Join(dir, "kala.mb"), later, later)
+	again, err := CopyToTemp(src)
+	if err != nil {
+		t.Fatalf("CopyToTemp failed: %v", err)
+	}
+	defer again.Remove()
+	if again.Path == c.Path {
+		t.Error("Expected a new copy after a companion file changed")
+	}
+	if data, _ := os.ReadFile(filepath.Join(filepath.Dir(again.Path), "kala.mb")); string(data) != "MEMOS" {
+		t.Errorf("Expected the changed memos in the copy, got %q", data)
+	}
+}
+
+func TestLockedError(t *testing.T) {
+	cause := &os.PathError{Op: "open", Path: `D:\Patris\KALA.DB`, Err: errors.New("sharing violation")}
+	err := error(&LockedError{Path: cause.Path, Holders: []string{"Patris.exe (pid 4120)"}, Err: cause})
+
+	if !strings.Contains(err.Error(), "locked by Patris.exe (pid 4120)") {
+		t.Errorf("Expected the lock holder in the message, got %q", err)
+	}
+	if !errors.Is(err, cause) {
+		t.Error("Expected the cause to be unwrapped")
+	}
+	if msg := (&LockedError{Path: cause.Path, Err: cause}).Error(); !strings.Contains(msg, "locked by another process") {
+		t.Errorf("Expected an unknown holder to be reported, got %q", msg)
+	}
+}
@@ -0,0 +1,19 @@
+//go:build !windows
+
+package filecopy
+
+import (
+	"errors"
+	"syscall"
+)
+
+// isLocked reports whether an error means another process holds the file,
+// as mandatory locks and some network file systems report
+func isLocked(err error) bool {
+	return errors.Is(err, syscall.EAGAIN) || errors.Is(err, syscall.EBUSY)
+}
+
+// lockHolders cannot tell which processes hold a file on this platform
+func lockHolders(path string) ([]string, error) {
+	return nil, nil
+}
@@ -0,0 +1,83 @@
+package filecopy
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// isLocked reports whether an error is a sharing or lock violation, as when
+// BDE holds the file open exclusively or has locked a range of it
+func isLocked(err error) bool {
+	return errors.Is(err, windows.ERROR_SHARING_VIOLATION) || errors.Is(err, windows.ERROR_LOCK_VIOLATION)
+}
+
+var (
+	rstrtmgr                = windows.NewLazySystemDLL("rstrtmgr.dll")
+	procRmStartSession      = rstrtmgr.NewProc("RmStartSession")
+	procRmRegisterResources = rstrtmgr.NewProc("RmRegisterResources")
+	procRmGetList           = rstrtmgr.NewProc("RmGetList")
+	procRmEndSession        = rstrtmgr.NewProc("RmEndSession")
+)
+
+// rmProcessInfo is the Restart Manager's RM_PROCESS_INFO
+type rmProcessInfo struct {
+	ProcessID        uint32
+	StartTime        windows.Filetime
+	AppName          [256]uint16
+	ServiceShortName [64]uint16
+	ApplicationType  uint32
+	AppStatus        uint32
+	TSSessionID      uint32
+	Restartable      int32
+}
+
+// lockHolders asks the Restart Manager which processes hold a file open
+func lockHolders(path string) ([]string, error) {
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	name, err := windows.UTF16PtrFromString(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := procRmStartSession.Find(); err != nil {
+		return nil, fmt.Errorf("restart manager is not available: %w", err)
+	}
+
+	var session uint32
+	var key [33]uint16
+	if r, _, _ := procRmStartSession.Call(uintptr(unsafe.Pointer(&session)), 0, uintptr(unsafe.Pointer(&key[0]))); r != 0 {
+		return nil, fmt.Errorf("failed to start restart manager session: %w", syscall.Errno(r))
+	}
+	defer procRmEndSession.Call(uintptr(session))
+
+	if r, _, _ := procRmRegisterResources.Call(uintptr(session), 1, uintptr(unsafe.Pointer(&name)), 0, 0, 0, 0); r != 0 {
+		return nil, fmt.Errorf("failed to register file with restart manager: %w", syscall.Errno(r))
+	}
+
+	infos := make([]rmProcessInfo, 4)
+	var needed, count, reasons uint32
+	for {
+		count = uint32(len(infos))
+		r, _, _ := procRmGetList.Call(uintptr(session), uintptr(unsafe.Pointer(&needed)), uintptr(unsafe.Pointer(&count)), uintptr(unsafe.Pointer(&infos[0])), uintptr(unsafe.Pointer(&reasons)))
+		if syscall.Errno(r) == windows.ERROR_MORE_DATA && needed > uint32(len(infos)) {
+			infos = make([]rmProcessInfo, needed)
+			continue
+		}
+		if r != 0 {
+			return nil, fmt.Errorf("failed to list processes holding the file: %w", syscall.Errno(r))
+		}
+		break
+	}
+
+	holders := make([]string, 0, count)
+	for _, info := range infos[:count] {
+		holders = append(holders, fmt.Sprintf("%s (pid %d)", windows.UTF16ToString(info.AppName[:]), info.ProcessID))
+	}
+	return holders, nil
+}
@@ -0,0 +1,42 @@
+package filecopy
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"strings"
+)
+
+// LockedError is returned when a file could not be copied because another
+// process holds it, naming that process where the platform can tell (the
+// Restart Manager on Windows), so BDE can be told apart from an antivirus
+// or backup agent
+type LockedError struct {
+	// Path is the locked file: the table or one of its companion files
+	Path string
+	// Holders names the processes holding the file, as "name (pid N)"
+	Holders []string
+	Err     error
+}
+
+func (e *LockedError) Error() string {
+	holders := "another process"
+	if len(e.Holders) > 0 {
+		holders = strings.Join(e.Holders, ", ")
+	}
+	return fmt.Sprintf("%s is locked by %s: %v", filepath.Base(e.Path), holders, e.Err)
+}
+
+func (e *LockedError) Unwrap() error { return e.Err }
+
+// newLockedError describes a lock violation with the processes holding
+// the file it occurred on
+func newLockedError(err error) error {
+	var pathErr *fs.PathError
+	if !errors.As(err, &pathErr) {
+		return &LockedError{Err: err}
+	}
+	holders, _ := lockHolders(pathErr.Path)
+	return &LockedError{Path: pathErr.Path, Holders: holders, Err: err}
+}
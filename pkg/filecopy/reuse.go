@@ -0,0 +1,153 @@
+package filecopy
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// shared is the latest copy of a source, handed out again while the
+// source's contents are unchanged. It is removed once it has been replaced
+// (or purged) and no Copy uses it.
+type shared struct {
+	dir  string
+	path string
+	// files describes the table and its companion files as last seen
+	files []FileInfo
+	hash  string
+	refs  int
+	stale bool
+}
+
+var (
+	sharedMu sync.Mutex
+	// copies holds the latest copy of each source by absolute path
+	copies = make(map[string]*shared)
+)
+
+// sourceKey identifies a source in copies
+func sourceKey(src string) string {
+	if abs, err := filepath.Abs(src); err == nil {
+		return abs
+	}
+	return src
+}
+
+// reuse returns the latest copy of src again if the table and its
+// companion files have not changed: the same files with the same sizes and
+// modification times, or only newer modification times and still the
+// copy's hash
+func reuse(src string) (*Copy, bool) {
+	key := sourceKey(src)
+
+	sharedMu.Lock()
+	s := copies[key]
+	sharedMu.Unlock()
+	if s == nil {
+		return nil, false
+	}
+
+	if _, err := os.Stat(s.path); err != nil {
+		return nil, false
+	}
+	files, err := family(src)
+	if err != nil {
+		return nil, false
+	}
+	sizes, times := sameFiles(files, s.files)
+	if !sizes {
+		return nil, false
+	}
+	if !times {
+		if hash, err := hashFiles(files); err != nil || hash != s.hash {
+			return nil, false
+		}
+	}
+
+	sharedMu.Lock()
+	defer sharedMu.Unlock()
+	if copies[key] != s {
+		return nil, false
+	}
+	s.refs++
+	s.files = files
+	// Keep a copy in long use from looking stale to CleanStale
+	now := time.Now()
+	os.Chtimes(s.dir, now, now)
+	return &Copy{Path: s.path, Source: files[0], Family: files[1:], Hash: s.hash, shared: s}, true
+}
+
+// share makes a new copy of src the one reused, replacing the previous copy
+func share(src string, c *Copy) {
+	files := append([]FileInfo{c.Source}, c.Family...)
+	s := &shared{dir: filepath.Dir(c.Path), path: c.Path, files: files, hash: c.Hash, refs: 1}
+	c.shared = s
+
+	sharedMu.Lock()
+	previous := copies[sourceKey(src)]
+	copies[sourceKey(src)] = s
+	unused := retire(previous)
+	sharedMu.Unlock()
+
+	if unused {
+		os.RemoveAll(previous.dir)
+	}
+}
+
+// retire marks a replaced copy stale and reports whether it is unused and
+// can be removed. The caller holds sharedMu.
+func retire(s *shared) bool {
+	if s == nil {
+		return false
+	}
+	s.stale = true
+	return s.refs == 0
+}
+
+// Remove releases the copy. Its file is kept for reuse while the source is
+// unchanged, and deleted once a newer copy replaces it or Purge is called.
+func (c *Copy) Remove() error {
+	s := c.shared
+	if s == nil {
+		return nil
+	}
+	c.shared = nil
+
+	sharedMu.Lock()
+	s.refs--
+	unused := s.refs == 0 && s.stale
+	sharedMu.Unlock()
+
+	if !unused {
+		return nil
+	}
+	if err := os.RemoveAll(s.dir); err != nil {
+		return fmt.Errorf("failed to remove copy: %w", err)
+	}
+	return nil
+}
+
+// Purge deletes the copies kept for reuse; copies still in use are deleted
+// when they are removed. Call it before exiting.
+func Purge() error {
+	sharedMu.Lock()
+	var dirs []string
+	for key, s := range copies {
+		if retire(s) {
+			dirs = append(dirs, s.dir)
+		}
+		delete(copies, key)
+	}
+	sharedMu.Unlock()
+
+	var errs []error
+	for _, dir := range dirs {
+		if err := os.RemoveAll(dir); err != nil {
+			errs = append(errs, fmt.Errorf("failed to remove copy: %w", err))
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,278 @@
+package manifest
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/atomicdeploy/patris-export/pkg/paradox"
+	"github.com/atomicdeploy/patris-export/pkg/signing"
+)
+
+// FileName is the name of the manifest written to an export directory
+const FileName = "manifest.json"
+
+var (
+	// ErrExportChanged is returned when an export file differs from the manifest
+	ErrExportChanged = errors.New("export file changed since it was written")
+	// ErrSourceChanged is returned when the source table changed since the export
+	ErrSourceChanged = errors.New("source table changed since the export")
+	// ErrSchemaChanged is returned when the source table's fields changed since the export
+	ErrSchemaChanged = errors.New("source table schema changed since the export")
+)
+
+// File describes one file: its path, size, SHA-256 digest and modification time
+type File struct {
+	Path     string    `json:"path"`
+	Size     int64     `json:"size"`
+	SHA256   string    `json:"sha256"`
+	Modified time.Time `json:"modified"`
+}
+
+// Entry describes one export and the source table it was made from
+type Entry struct {
+	// Source is the Paradox table; its path is absolute
+	Source File `json:"source"`
+	// Files are the export and its sidecars (e.g. the .sig signature);
+	// their paths are relative to the manifest's directory
+	Files []File `json:"files"`
+	// Format is the export format (json, csv, ...)
+	Format string `json:"format"`
+	// RecordCount is the number of records in the source table
+	RecordCount int `json:"record_count"`
+	// Schema fingerprints the source table's field names, types and sizes
+	Schema string `json:"schema_fingerprint"`
+	// ExportedAt is when the export was written
+	ExportedAt time.Time `json:"exported_at"`
+	// Generator names the program that wrote the export
+	Generator string `json:"generator,omitempty"`
+}
+
+// Manifest lists the exports in a directory, keyed by export file name
+type Manifest struct {
+	Exports map[string]*Entry `json:"exports"`
+}
+
+// Load reads a manifest; a missing file gives an empty manifest
+func Load(path string) (*Manifest, error) {
+	m := &Manifest{Exports: make(map[string]*Entry)}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return m, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifest: %w", err)
+	}
+
+	if err := json.Unmarshal(data, m); err != nil {
+		return nil, fmt.Errorf("failed to parse manifest: %w", err)
+	}
+	if m.Exports == nil {
+		m.Exports = make(map[string]*Entry)
+	}
+
+	return m, nil
+}
+
+// Save writes the manifest, replacing the previous file atomically
+func (m *Manifest) Save(path string) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode manifest: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp*")
+	if err != nil {
+		return fmt.Errorf("failed to write manifest: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write manifest: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write manifest: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to write manifest: %w", err)
+	}
+	return nil
+}
+
+// Names returns the export names in sorted order
+func (m *Manifest) Names() []string {
+	names := make([]string, 0, len(m.Exports))
+	for name := range m.Exports {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// NewEntry describes an export of a source table. The first file is the
+// export itself; the others are its sidecars. All files must be in dir.
+func NewEntry(source, dir, format string, files ...string) (*Entry, error) {
+	header, err := paradox.ReadHeader(source)
+	if err != nil {
+		return nil, err
+	}
+
+	absSource, err := filepath.Abs(source)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve source path: %w", err)
+	}
+	sourceFile, err := describe(absSource)
+	if err != nil {
+		return nil, err
+	}
+
+	entry := &Entry{
+		Source:      sourceFile,
+		Format:      format,
+		RecordCount: header.NumRecords,
+		Schema:      SchemaFingerprint(header.Fields),
+		ExportedAt:  time.Now().UTC(),
+	}
+
+	for _, path := range files {
+		file, err := describe(path)
+		if err != nil {
+			return nil, err
+		}
+		if file.Path, err = filepath.Rel(dir, path); err != nil {
+			return nil, fmt.Errorf("failed to resolve export path: %w", err)
+		}
+		file.Path = filepath.ToSlash(file.Path)
+		entry.Files = append(entry.Files, file)
+	}
+
+	return entry, nil
+}
+
+// Name returns the export's name in the manifest: its first file's path
+func (e *Entry) Name() string {
+	if len(e.Files) == 0 {
+		return ""
+	}
+	return e.Files[0].Path
+}
+
+// Update adds or replaces an entry in the manifest at path
+func Update(path string, entry *Entry) error {
+	m, err := Load(path)
+	if err != nil {
+		return err
+	}
+	m.Exports[entry.Name()] = entry
+	return m.Save(path)
+}
+
+// VerifySignature checks that a manifest is unchanged since it was signed
+// with its exports (convert --sign-key), against its signature sidecar
+func VerifySignature(path string, key ed25519.PublicKey) error {
+	if _, err := signing.VerifyFile(path, key); err != nil {
+		return fmt.Errorf("manifest signature: %w", err)
+	}
+	return nil
+}
+
+// Verify re-checks an export listed in a manifest of directory dir: every
+// export file must be unchanged, and the source table must still have the
+// recorded content. The returned error wraps ErrExportChanged,
+// ErrSchemaChanged or ErrSourceChanged; several problems are joined.
+func (e *Entry) Verify(dir string) error {
+	var problems []error
+
+	for _, recorded := range e.Files {
+		path := filepath.Join(dir, filepath.FromSlash(recorded.Path))
+		current, err := describe(path)
+		switch {
+		case err != nil:
+			problems = append(problems, fmt.Errorf("%w: %s: %v", ErrExportChanged, recorded.Path, err))
+		case current.Size != recorded.Size:
+			problems = append(problems, fmt.Errorf("%w: %s has %d bytes, manifest lists %d", ErrExportChanged, recorded.Path, current.Size, recorded.Size))
+		case current.SHA256 != recorded.SHA256:
+			problems = append(problems, fmt.Errorf("%w: %s has different content", ErrExportChanged, recorded.Path))
+		}
+	}
+
+	if err := e.verifySource(); err != nil {
+		problems = append(problems, err)
+	}
+
+	return errors.Join(problems...)
+}
+
+// verifySource checks that the source table still matches the entry
+func (e *Entry) verifySource() error {
+	current, err := describe(e.Source.Path)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrSourceChanged, err)
+	}
+	if current.SHA256 == e.Source.SHA256 {
+		return nil
+	}
+
+	// Explain what changed
+	header, err := paradox.ReadHeader(e.Source.Path)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrSourceChanged, err)
+	}
+	if SchemaFingerprint(header.Fields) != e.Schema {
+		return fmt.Errorf("%w: %s", ErrSchemaChanged, filepath.Base(e.Source.Path))
+	}
+	if header.NumRecords != e.RecordCount {
+		return fmt.Errorf("%w: %s has %d records, the export has %d", ErrSourceChanged, filepath.Base(e.Source.Path), header.NumRecords, e.RecordCount)
+	}
+	return fmt.Errorf("%w: %s was modified at %s", ErrSourceChanged, filepath.Base(e.Source.Path), current.Modified.Format(time.RFC3339))
+}
+
+// SchemaFingerprint returns a SHA-256 digest of the field names, types and sizes
+func SchemaFingerprint(fields []paradox.Field) string {
+	var b strings.Builder
+	for _, field := range fields {
+		fmt.Fprintf(&b, "%s:%s:%d\n", field.Name, field.Type, field.Size)
+	}
+	sum := sha256.Sum256([]byte(b.String()))
+	return hex.EncodeToString(sum[:])
+}
+
+// describe hashes a file
+func describe(path string) (File, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return File{}, fmt.Errorf("failed to open file: %w", err)
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return File{}, fmt.Errorf("failed to stat file: %w", err)
+	}
+
+	hash := sha256.New()
+	size, err := io.Copy(hash, file)
+	if err != nil {
+		return File{}, fmt.Errorf("failed to read file: %w", err)
+	}
+
+	return File{
+		Path:     path,
+		Size:     size,
+		SHA256:   hex.EncodeToString(hash.Sum(nil)),
+		Modified: info.ModTime().UTC(),
+	}, nil
+}
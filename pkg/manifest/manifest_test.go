@@ -0,0 +1,185 @@
+package manifest
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/atomicdeploy/patris-export/pkg/signing"
+)
+
+// setupExport copies the test table to a temp dir, writes a fake export next
+// to it and records it in a manifest
+func setupExport(t *testing.T) (string, string, string) {
+	t.Helper()
+
+	data, err := os.ReadFile("../../testdata/kala.db")
+	if err != nil {
+		t.Skipf("Test file not available: %v", err)
+	}
+
+	tmpDir := t.TempDir()
+	source := filepath.Join(tmpDir, "kala.db")
+	if err := os.WriteFile(source, data, 0644); err != nil {
+		t.Fatalf("Failed to copy test table: %v", err)
+	}
+
+	outDir := filepath.Join(tmpDir, "out")
+	if err := os.Mkdir(outDir, 0755); err != nil {
+		t.Fatalf("Failed to create output dir: %v", err)
+	}
+	export := filepath.Join(outDir, "kala.json")
+	if err := os.WriteFile(export, []byte(`{"1001": {"Code": 1001}}`), 0644); err != nil {
+		t.Fatalf("Failed to write export: %v", err)
+	}
+
+	entry, err := NewEntry(source, outDir, "json", export)
+	if err != nil {
+		t.Fatalf("Failed to describe export: %v", err)
+	}
+	manifestPath := filepath.Join(outDir, FileName)
+	if err := Update(manifestPath, entry); err != nil {
+		t.Fatalf("Failed to update manifest: %v", err)
+	}
+
+	return source, export, manifestPath
+}
+
+// loadEntry loads the kala.json entry from the manifest
+func loadEntry(t *testing.T, manifestPath string) *Entry {
+	t.Helper()
+
+	m, err := Load(manifestPath)
+	if err != nil {
+		t.Fatalf("Failed to load manifest: %v", err)
+	}
+	entry, ok := m.Exports["kala.json"]
+	if !ok {
+		t.Fatalf("Expected kala.json in the manifest, got %v", m.Names())
+	}
+	return entry
+}
+
+func TestManifestRoundTrip(t *testing.T) {
+	_, _, manifestPath := setupExport(t)
+	entry := loadEntry(t, manifestPath)
+
+	if entry.RecordCount != 354 {
+		t.Errorf("Expected 354 records, got %d", entry.RecordCount)
+	}
+	if entry.Schema == "" || entry.Source.SHA256 == "" {
+		t.Error("Expected schema fingerprint and source hash")
+	}
+	if len(entry.Files) != 1 || entry.Files[0].Path != "kala.json" {
+		t.Errorf("Expected export path relative to the manifest, got %+v", entry.Files)
+	}
+
+	if err := entry.Verify(filepath.Dir(manifestPath)); err != nil {
+		t.Errorf("Expected unchanged export to verify, got: %v", err)
+	}
+}
+
+func TestVerifyDetectsModifiedExport(t *testing.T) {
+	_, export, manifestPath := setupExport(t)
+
+	// Same size, different content
+	if err := os.WriteFile(export, []byte(`{"1001": {"Code": 1002}}`), 0644); err != nil {
+		t.Fatalf("Failed to modify export: %v", err)
+	}
+
+	err := loadEntry(t, manifestPath).Verify(filepath.Dir(manifestPath))
+	if !errors.Is(err, ErrExportChanged) {
+		t.Errorf("Expected ErrExportChanged, got: %v", err)
+	}
+	if errors.Is(err, ErrSourceChanged) {
+		t.Errorf("Source was not modified, got: %v", err)
+	}
+}
+
+func TestVerifyDetectsMissingExport(t *testing.T) {
+	_, export, manifestPath := setupExport(t)
+	os.Remove(export)
+
+	err := loadEntry(t, manifestPath).Verify(filepath.Dir(manifestPath))
+	if !errors.Is(err, ErrExportChanged) {
+		t.Errorf("Expected ErrExportChanged, got: %v", err)
+	}
+}
+
+func TestVerifyDetectsModifiedSource(t *testing.T) {
+	source, _, manifestPath := setupExport(t)
+
+	data, err := os.ReadFile(source)
+	if err != nil {
+		t.Fatalf("Failed to read source: %v", err)
+	}
+	// Change a byte in the data blocks, keeping the header intact
+	data[len(data)-1] ^= 0xff
+	if err := os.WriteFile(source, data, 0644); err != nil {
+		t.Fatalf("Failed to modify source: %v", err)
+	}
+
+	err = loadEntry(t, manifestPath).Verify(filepath.Dir(manifestPath))
+	if !errors.Is(err, ErrSourceChanged) {
+		t.Errorf("Expected ErrSourceChanged, got: %v", err)
+	}
+	if errors.Is(err, ErrExportChanged) {
+		t.Errorf("Export was not modified, got: %v", err)
+	}
+}
+
+func TestVerifySignature(t *testing.T) {
+	_, _, manifestPath := setupExport(t)
+
+	keyDir := t.TempDir()
+	privPath, pubPath := filepath.Join(keyDir, "signing.key"), filepath.Join(keyDir, "signing.pub")
+	if err := signing.GenerateKey(privPath, pubPath); err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	priv, _ := signing.LoadPrivateKey(privPath)
+	pub, _ := signing.LoadPublicKey(pubPath)
+
+	if err := VerifySignature(manifestPath, pub); err == nil {
+		t.Error("Expected an unsigned manifest to fail verification")
+	}
+
+	if _, err := signing.SignFile(manifestPath, priv); err != nil {
+		t.Fatalf("Failed to sign manifest: %v", err)
+	}
+	if err := VerifySignature(manifestPath, pub); err != nil {
+		t.Errorf("Expected the signed manifest to verify, got: %v", err)
+	}
+
+	// An entry edited to match a tampered export breaks the signature
+	m, _ := Load(manifestPath)
+	m.Exports["kala.json"].RecordCount = 1
+	if err := m.Save(manifestPath); err != nil {
+		t.Fatalf("Failed to save manifest: %v", err)
+	}
+	if err := VerifySignature(manifestPath, pub); !errors.Is(err, signing.ErrSizeMismatch) && !errors.Is(err, signing.ErrDigestMismatch) {
+		t.Errorf("Expected the edited manifest to fail verification, got: %v", err)
+	}
+}
+
+func TestSchemaFingerprintChangesWithFields(t *testing.T) {
+	source, _, _ := setupExport(t)
+	entry, err := NewEntry(source, filepath.Dir(source), "json")
+	if err != nil {
+		t.Fatalf("Failed to describe source: %v", err)
+	}
+
+	if SchemaFingerprint(nil) == entry.Schema {
+		t.Error("Expected different fingerprints for different schemas")
+	}
+}
+
+func TestLoadMissingManifest(t *testing.T) {
+	m, err := Load(filepath.Join(t.TempDir(), FileName))
+	if err != nil {
+		t.Fatalf("Expected empty manifest, got: %v", err)
+	}
+	if len(m.Names()) != 0 {
+		t.Errorf("Expected no exports, got %v", m.Names())
+	}
+}
@@ -0,0 +1,239 @@
+package paradox
+
+import (
+	"crypto/sha256"
+	"encoding/gob"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/atomicdeploy/patris-export/pkg/resilient"
+)
+
+// cacheFileVersion is bumped whenever the cached record format changes
+const cacheFileVersion = 1
+
+// BlockCache keeps decoded data blocks keyed by the SHA-256 of their contents,
+// persisted in a directory between runs. Converting a mostly-unchanged table
+// only decodes the blocks that changed since the last run.
+type BlockCache struct {
+	dir    string
+	mu     sync.Mutex
+	tables map[string]*cachedTable
+}
+
+// cachedTable is the on-disk cache of one table
+type cachedTable struct {
+	Version int
+	// Schema identifies the field layout; a schema change invalidates all blocks
+	Schema string
+	Blocks map[string][]Record
+}
+
+// CacheStats reports block reuse for the last read of a table
+type CacheStats struct {
+	Blocks int
+	Reused int
+}
+
+var (
+	blockCacheMu sync.RWMutex
+	blockCache   *BlockCache
+)
+
+// SetBlockCache enables the block cache for Database.GetRecords (nil disables it)
+func SetBlockCache(cache *BlockCache) {
+	blockCacheMu.Lock()
+	defer blockCacheMu.Unlock()
+	blockCache = cache
+}
+
+// GetBlockCache returns the block cache used by Database.GetRecords, if any
+func GetBlockCache() *BlockCache {
+	blockCacheMu.RLock()
+	defer blockCacheMu.RUnlock()
+	return blockCache
+}
+
+// NewBlockCache creates a block cache stored in dir
+func NewBlockCache(dir string) (*BlockCache, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create cache directory: %w", err)
+	}
+
+	return &BlockCache{
+		dir:    dir,
+		tables: make(map[string]*cachedTable),
+	}, nil
+}
+
+// ReadRecords reads a table, reusing cached records for unchanged blocks
+func (c *BlockCache) ReadRecords(path string) ([]Record, error) {
+	return c.ReadCopy(path, path)
+}
+
+// ReadCopy reads a copy of a table at path, such as a shadow copy, reusing
+// the blocks cached for the table itself
+func (c *BlockCache) ReadCopy(path, table string) ([]Record, error) {
+	records, stats, err := c.readCopy(path, table)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("♻️  Block cache: reused %d of %d blocks for %s", stats.Reused, stats.Blocks, filepath.Base(table))
+	return records, nil
+}
+
+// readRecords implements ReadRecords and returns the reuse statistics
+func (c *BlockCache) readRecords(path string) ([]Record, CacheStats, error) {
+	return c.readCopy(path, path)
+}
+
+// readCopy implements ReadCopy and returns the reuse statistics
+func (c *BlockCache) readCopy(path, table string) ([]Record, CacheStats, error) {
+	var stats CacheStats
+
+	data, err := resilient.ReadFile(path)
+	if err != nil {
+		return nil, stats, fmt.Errorf("failed to read Paradox file: %w", err)
+	}
+
+	h, err := parseFileHeader(data)
+	if err != nil {
+		return nil, stats, err
+	}
+
+	offsets, err := fieldOffsets(h)
+	if err != nil {
+		return nil, stats, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	cacheFile := c.cacheFile(table)
+	previous := c.load(table, cacheFile)
+
+	current := &cachedTable{
+		Version: cacheFileVersion,
+		Schema:  schemaKey(h),
+		Blocks:  make(map[string][]Record),
+	}
+	if previous.Schema != current.Schema {
+		previous.Blocks = nil
+	}
+
+	records := make([]Record, 0, h.NumRecords)
+	err = walkBlocks(h, data, func(block int, raw []byte) error {
+		sum := sha256.Sum256(raw)
+		key := hex.EncodeToString(sum[:16])
+
+		decoded, ok := previous.Blocks[key]
+		if ok {
+			stats.Reused++
+		} else {
+			decoded = decodeBlock(h, offsets, raw)
+		}
+		stats.Blocks++
+
+		current.Blocks[key] = decoded
+		records = append(records, copyRecords(decoded)...)
+		return nil
+	})
+	if err != nil {
+		return nil, stats, err
+	}
+
+	// Only blocks seen in this run are kept, so the cache never outgrows the table
+	c.tables[table] = current
+	if stats.Reused < stats.Blocks || len(previous.Blocks) != len(current.Blocks) {
+		if err := current.save(cacheFile); err != nil {
+			log.Printf("⚠️  Failed to save block cache: %v", err)
+		}
+	}
+
+	return records, stats, nil
+}
+
+// cacheFile returns the cache file path for a table
+func (c *BlockCache) cacheFile(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	sum := sha256.Sum256([]byte(path))
+	name := filepath.Base(path) + "-" + hex.EncodeToString(sum[:8]) + ".cache"
+	return filepath.Join(c.dir, name)
+}
+
+// load returns the cached table from memory or disk; a missing or unreadable
+// cache yields an empty table
+func (c *BlockCache) load(path, cacheFile string) *cachedTable {
+	if table, ok := c.tables[path]; ok {
+		return table
+	}
+
+	table := &cachedTable{}
+
+	file, err := os.Open(cacheFile)
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			log.Printf("⚠️  Failed to open block cache: %v", err)
+		}
+		return table
+	}
+	defer file.Close()
+
+	if err := gob.NewDecoder(file).Decode(table); err != nil || table.Version != cacheFileVersion {
+		log.Printf("⚠️  Ignoring unreadable block cache %s", filepath.Base(cacheFile))
+		return &cachedTable{}
+	}
+
+	return table
+}
+
+// save writes the cached table atomically
+func (t *cachedTable) save(cacheFile string) error {
+	tmp, err := os.CreateTemp(filepath.Dir(cacheFile), filepath.Base(cacheFile)+".tmp*")
+	if err != nil {
+		return fmt.Errorf("failed to create cache file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := gob.NewEncoder(tmp).Encode(t); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to encode cache: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write cache file: %w", err)
+	}
+
+	return os.Rename(tmp.Name(), cacheFile)
+}
+
+// schemaKey identifies the record layout described by a header
+func schemaKey(h *Header) string {
+	sum := sha256.New()
+	fmt.Fprintf(sum, "%d/%d/%s", h.RecordSize, h.BlockSize, h.Version)
+	for _, field := range h.Fields {
+		fmt.Fprintf(sum, "/%s:%s:%d", field.Name, field.Type, field.Size)
+	}
+	return hex.EncodeToString(sum.Sum(nil))
+}
+
+// copyRecords returns shallow copies so callers cannot modify cached records
+func copyRecords(records []Record) []Record {
+	copies := make([]Record, len(records))
+	for i, record := range records {
+		copied := make(Record, len(record))
+		for key, value := range record {
+			copied[key] = value
+		}
+		copies[i] = copied
+	}
+	return copies
+}
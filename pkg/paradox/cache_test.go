@@ -0,0 +1,128 @@
+package paradox
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestBlockCache(t *testing.T) {
+	data, err := os.ReadFile("../../testdata/kala.db")
+	if err != nil {
+		t.Fatalf("Failed to read test table: %v", err)
+	}
+
+	dir := t.TempDir()
+	table := filepath.Join(dir, "kala.db")
+	if err := os.WriteFile(table, data, 0644); err != nil {
+		t.Fatalf("Failed to copy test table: %v", err)
+	}
+
+	h, err := parseFileHeader(data)
+	if err != nil {
+		t.Fatalf("Failed to parse header: %v", err)
+	}
+	expected, err := DecodeRecords(h, data)
+	if err != nil {
+		t.Fatalf("Failed to decode records: %v", err)
+	}
+
+	cacheDir := filepath.Join(dir, "cache")
+	cache, err := NewBlockCache(cacheDir)
+	if err != nil {
+		t.Fatalf("Failed to create cache: %v", err)
+	}
+
+	records, stats, err := cache.readRecords(table)
+	if err != nil {
+		t.Fatalf("Cold read failed: %v", err)
+	}
+	if stats.Reused != 0 || stats.Blocks == 0 {
+		t.Errorf("Expected a cold cache, got %+v", stats)
+	}
+	if !reflect.DeepEqual(records, expected) {
+		t.Error("Cached read differs from a direct decode")
+	}
+
+	// A new cache instance warm-starts from disk
+	cache, err = NewBlockCache(cacheDir)
+	if err != nil {
+		t.Fatalf("Failed to reopen cache: %v", err)
+	}
+	records, stats, err = cache.readRecords(table)
+	if err != nil {
+		t.Fatalf("Warm read failed: %v", err)
+	}
+	if stats.Reused != stats.Blocks {
+		t.Errorf("Expected all blocks reused, got %+v", stats)
+	}
+	if !reflect.DeepEqual(records, expected) {
+		t.Error("Warm read differs from a direct decode")
+	}
+
+	// Changing one record only re-decodes its block
+	pos := h.HeaderSize + (h.FirstBlock-1)*h.BlockSize + dataBlockHeaderSize + 4
+	data[pos] ^= 0x01
+	if err := os.WriteFile(table, data, 0644); err != nil {
+		t.Fatalf("Failed to modify test table: %v", err)
+	}
+
+	records, stats, err = cache.readRecords(table)
+	if err != nil {
+		t.Fatalf("Read after change failed: %v", err)
+	}
+	if stats.Reused != stats.Blocks-1 {
+		t.Errorf("Expected one changed block, got %+v", stats)
+	}
+	if reflect.DeepEqual(records[0], expected[0]) {
+		t.Error("Expected the changed record to be decoded again")
+	}
+
+	// Callers must not be able to modify cached records
+	records[1]["Name"] = "changed"
+	records, _, _ = cache.readRecords(table)
+	if records[1]["Name"] == "changed" {
+		t.Error("Cached records were modified through a returned record")
+	}
+}
+
+func TestBlockCacheCopy(t *testing.T) {
+	data, err := os.ReadFile("../../testdata/kala.db")
+	if err != nil {
+		t.Fatalf("Failed to read test table: %v", err)
+	}
+
+	dir := t.TempDir()
+	table := filepath.Join(dir, "kala.db")
+	copied := filepath.Join(dir, "copy", "kala.db")
+	if err := os.MkdirAll(filepath.Dir(copied), 0755); err != nil {
+		t.Fatalf("Failed to create copy directory: %v", err)
+	}
+	for _, path := range []string{table, copied} {
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			t.Fatalf("Failed to copy test table: %v", err)
+		}
+	}
+
+	cache, err := NewBlockCache(filepath.Join(dir, "cache"))
+	if err != nil {
+		t.Fatalf("Failed to create cache: %v", err)
+	}
+	if _, _, err := cache.readRecords(table); err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+
+	// A copy of the table reuses the table's blocks
+	_, stats, err := cache.readCopy(copied, table)
+	if err != nil {
+		t.Fatalf("Read of the copy failed: %v", err)
+	}
+	if stats.Reused != stats.Blocks {
+		t.Errorf("Expected all blocks reused, got %+v", stats)
+	}
+	entries, _ := os.ReadDir(filepath.Join(dir, "cache"))
+	if len(entries) != 1 {
+		t.Errorf("Expected one cache file for the table and its copy, got %d", len(entries))
+	}
+}
@@ -3,8 +3,9 @@ package paradox
 import (
 	"bufio"
 	"fmt"
-	"os"
 	"strings"
+
+	"github.com/atomicdeploy/patris-export/pkg/resilient"
 )
 
 // CompanyInfo represents the company information from company.inf
@@ -12,11 +13,14 @@ type CompanyInfo struct {
 	Name      string `json:"name"`
 	StartDate string `json:"start_date"`
 	EndDate   string `json:"end_date"`
+	// Extra holds the lines after the end date (written by newer Patris
+	// versions) as read, undecoded; JSON encodes them in base64
+	Extra [][]byte `json:"extra,omitempty"`
 }
 
 // ReadCompanyInfo reads and parses a company.inf file
 func ReadCompanyInfo(path string, converter func(string) string) (*CompanyInfo, error) {
-	file, err := os.Open(path)
+	file, err := resilient.Open(path)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open company.inf: %w", err)
 	}
@@ -38,6 +42,11 @@ func ReadCompanyInfo(path string, converter func(string) string) (*CompanyInfo,
 		return nil, fmt.Errorf("company.inf has insufficient lines")
 	}
 
+	// Trailing blank lines carry no information
+	for len(lines) > 3 && strings.TrimSpace(lines[len(lines)-1]) == "" {
+		lines = lines[:len(lines)-1]
+	}
+
 	info := &CompanyInfo{}
 
 	// First line is the company name (encoded)
@@ -53,5 +62,10 @@ func ReadCompanyInfo(path string, converter func(string) string) (*CompanyInfo,
 	// Third line is the end date
 	info.EndDate = strings.TrimSpace(lines[2])
 
+	// Keep the lines we don't know about yet instead of dropping them
+	for _, line := range lines[3:] {
+		info.Extra = append(info.Extra, []byte(line))
+	}
+
 	return info, nil
 }
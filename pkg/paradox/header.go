@@ -0,0 +1,274 @@
+package paradox
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/atomicdeploy/patris-export/pkg/resilient"
+)
+
+// Header offsets shared by all Paradox table versions
+const (
+	offRecordSize    = 0x00
+	offHeaderSize    = 0x02
+	offFileType      = 0x04
+	offMaxTableSize  = 0x05
+	offNumRecords    = 0x06
+	offFileBlocks    = 0x0C
+	offFirstBlock    = 0x0E
+	offLastBlock     = 0x10
+	offNumFields     = 0x21
+	offPrimaryKeys   = 0x23
+	offFileVersionID = 0x39
+	offCodePage      = 0x6A
+
+	// Field descriptors start after the base header in 3.x files and after
+	// the extended data header in 4.x and later
+	fieldInfoOffsetV3 = 0x58
+	fieldInfoOffsetV4 = 0x78
+
+	// The table name stored after the field name pointers grew in 7.x
+	tableNameLenV3 = 79
+	tableNameLenV7 = 261
+)
+
+// File types stored at offset 0x04
+const (
+	FileTypeIndexedDB    = 0
+	FileTypePrimaryIndex = 1
+	FileTypeNonIndexedDB = 2
+)
+
+var (
+	// ErrUnsupportedVersion is returned for files with an unknown fileVersionID
+	ErrUnsupportedVersion = errors.New("unsupported Paradox file version")
+	// ErrNotTable is returned for Paradox files that are not .db tables (e.g. indexes)
+	ErrNotTable = errors.New("not a Paradox table file")
+)
+
+// Version identifies a Paradox file format generation
+type Version string
+
+const (
+	Version30      Version = "3.0"
+	Version35      Version = "3.5"
+	Version4x      Version = "4.x"
+	Version5x      Version = "5.x"
+	Version7x      Version = "7.x"
+	VersionUnknown Version = "unknown"
+)
+
+// VersionFromID maps a fileVersionID header byte to its format generation
+func VersionFromID(id byte) Version {
+	switch {
+	case id == 0x03:
+		return Version30
+	case id == 0x04:
+		return Version35
+	case id >= 0x05 && id <= 0x09:
+		return Version4x
+	case id == 0x0a || id == 0x0b:
+		return Version5x
+	case id == 0x0c:
+		return Version7x
+	default:
+		return VersionUnknown
+	}
+}
+
+// Supported reports whether the version can be read
+func (v Version) Supported() bool {
+	return v != VersionUnknown
+}
+
+// hasExtendedHeader reports whether the 0x58-0x77 data header extension is present
+func (v Version) hasExtendedHeader() bool {
+	return v == Version4x || v == Version5x || v == Version7x
+}
+
+// Header holds the table header fields needed to describe and parse a Paradox file
+type Header struct {
+	RecordSize    int
+	HeaderSize    int
+	FileType      int
+	BlockSize     int
+	NumRecords    int
+	FileBlocks    int
+	FirstBlock    int
+	LastBlock     int
+	NumFields     int
+	PrimaryKeys   int
+	FileVersionID byte
+	Version       Version
+	CodePage      int
+	Fields        []Field
+}
+
+// ReadHeader reads and parses the header of a Paradox table file without pxlib
+func ReadHeader(path string) (*Header, error) {
+	file, err := resilient.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open Paradox file: %w", err)
+	}
+	defer file.Close()
+
+	return readHeader(file, path)
+}
+
+// readHeader reads and parses a table header from the start of r
+func readHeader(r io.Reader, path string) (*Header, error) {
+	// The header size lives in the first bytes; read those, then the rest
+	prefix := make([]byte, fieldInfoOffsetV3)
+	if _, err := io.ReadFull(r, prefix); err != nil {
+		return nil, fmt.Errorf("file is too small to be a Paradox table: %s", path)
+	}
+
+	headerSize := int(binary.LittleEndian.Uint16(prefix[offHeaderSize:]))
+	if headerSize < len(prefix) {
+		return nil, fmt.Errorf("invalid Paradox header size %d in %s", headerSize, path)
+	}
+
+	data := make([]byte, headerSize)
+	copy(data, prefix)
+	if _, err := io.ReadFull(r, data[len(prefix):]); err != nil {
+		return nil, fmt.Errorf("Paradox header is truncated in %s", path)
+	}
+
+	return ParseHeader(data)
+}
+
+// ParseHeader parses a raw Paradox table header
+func ParseHeader(data []byte) (*Header, error) {
+	if len(data) < fieldInfoOffsetV3 {
+		return nil, fmt.Errorf("header is too small (%d bytes)", len(data))
+	}
+
+	h := &Header{
+		RecordSize:    int(binary.LittleEndian.Uint16(data[offRecordSize:])),
+		HeaderSize:    int(binary.LittleEndian.Uint16(data[offHeaderSize:])),
+		FileType:      int(data[offFileType]),
+		BlockSize:     int(data[offMaxTableSize]) * 1024,
+		NumRecords:    int(binary.LittleEndian.Uint32(data[offNumRecords:])),
+		FileBlocks:    int(binary.LittleEndian.Uint16(data[offFileBlocks:])),
+		FirstBlock:    int(binary.LittleEndian.Uint16(data[offFirstBlock:])),
+		LastBlock:     int(binary.LittleEndian.Uint16(data[offLastBlock:])),
+		NumFields:     int(binary.LittleEndian.Uint16(data[offNumFields:])),
+		PrimaryKeys:   int(binary.LittleEndian.Uint16(data[offPrimaryKeys:])),
+		FileVersionID: data[offFileVersionID],
+	}
+	h.Version = VersionFromID(h.FileVersionID)
+
+	if !h.Version.Supported() {
+		return h, fmt.Errorf("%w (fileVersionID 0x%02x); supported versions are 3.0, 3.5, 4.x, 5.x and 7.x", ErrUnsupportedVersion, h.FileVersionID)
+	}
+
+	if h.FileType != FileTypeIndexedDB && h.FileType != FileTypeNonIndexedDB {
+		return h, fmt.Errorf("%w (file type %d)", ErrNotTable, h.FileType)
+	}
+
+	if h.Version.hasExtendedHeader() && len(data) > offCodePage+1 {
+		h.CodePage = int(binary.LittleEndian.Uint16(data[offCodePage:]))
+	}
+
+	fields, err := h.parseFields(data)
+	if err != nil {
+		return h, err
+	}
+	h.Fields = fields
+
+	return h, nil
+}
+
+// FieldInfoOffset returns where the field type/size descriptors start
+func (h *Header) FieldInfoOffset() int {
+	if h.Version.hasExtendedHeader() {
+		return fieldInfoOffsetV4
+	}
+	return fieldInfoOffsetV3
+}
+
+// FieldNamesOffset returns where the NUL-terminated field names start. They
+// follow the field descriptors, the table name pointer, one pointer per field
+// and the fixed-size table name, which is longer in 7.x than in all older
+// versions, as in pxlib.
+func (h *Header) FieldNamesOffset() int {
+	tableNameLen := tableNameLenV3
+	if h.Version == Version7x {
+		tableNameLen = tableNameLenV7
+	}
+	return h.FieldInfoOffset() + h.NumFields*2 + 4 + h.NumFields*4 + tableNameLen
+}
+
+// parseFields reads the field descriptors and names from the header
+func (h *Header) parseFields(data []byte) ([]Field, error) {
+	infoOffset := h.FieldInfoOffset()
+	if infoOffset+h.NumFields*2 > len(data) {
+		return nil, fmt.Errorf("field descriptors exceed header size (%d fields)", h.NumFields)
+	}
+
+	fields := make([]Field, h.NumFields)
+	for i := range fields {
+		fields[i].Type = FieldTypeName(data[infoOffset+i*2])
+		fields[i].Size = int(data[infoOffset+i*2+1])
+	}
+
+	pos := h.FieldNamesOffset()
+	for i := range fields {
+		if pos >= len(data) {
+			return nil, fmt.Errorf("field names exceed header size (version %s)", h.Version)
+		}
+		end := bytes.IndexByte(data[pos:], 0)
+		if end < 0 {
+			return nil, fmt.Errorf("unterminated field name %d (version %s)", i+1, h.Version)
+		}
+		fields[i].Name = string(data[pos : pos+end])
+		pos += end + 1
+	}
+
+	return fields, nil
+}
+
+// FieldTypeName returns the name used for a Paradox field type code
+func FieldTypeName(code byte) string {
+	switch code {
+	case 0x01:
+		return "alpha"
+	case 0x02:
+		return "date"
+	case 0x03:
+		return "short"
+	case 0x04:
+		return "long"
+	case 0x05:
+		return "currency"
+	case 0x06:
+		return "number"
+	case 0x09:
+		return "logical"
+	case 0x0C:
+		return "memo"
+	case 0x0D:
+		return "blob"
+	case 0x0E:
+		return "fmtmemo"
+	case 0x0F:
+		return "ole"
+	case 0x10:
+		return "graphic"
+	case 0x14:
+		return "time"
+	case 0x15:
+		return "timestamp"
+	case 0x16:
+		return "autoinc"
+	case 0x17:
+		return "bcd"
+	case 0x18:
+		return "bytes"
+	default:
+		return "unknown"
+	}
+}
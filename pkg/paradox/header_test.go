@@ -0,0 +1,145 @@
+package paradox
+
+import (
+	"encoding/binary"
+	"errors"
+	"testing"
+)
+
+// buildHeader creates a minimal table header for the given version ID and fields
+func buildHeader(versionID byte, names []string, types []byte) []byte {
+	h := &Header{Version: VersionFromID(versionID), NumFields: len(names)}
+	return buildHeaderAt(versionID, h.FieldNamesOffset(), names, types)
+}
+
+// buildHeaderAt creates a minimal table header with the field names written
+// at namesAt
+func buildHeaderAt(versionID byte, namesAt int, names []string, types []byte) []byte {
+	h := &Header{Version: VersionFromID(versionID), NumFields: len(names)}
+
+	data := make([]byte, 2048)
+	binary.LittleEndian.PutUint16(data[offRecordSize:], 20)
+	binary.LittleEndian.PutUint16(data[offHeaderSize:], uint16(len(data)))
+	data[offMaxTableSize] = 2
+	binary.LittleEndian.PutUint32(data[offNumRecords:], 7)
+	binary.LittleEndian.PutUint16(data[offNumFields:], uint16(len(names)))
+	data[offFileVersionID] = versionID
+
+	for i := range names {
+		data[h.FieldInfoOffset()+i*2] = types[i]
+		data[h.FieldInfoOffset()+i*2+1] = 10
+	}
+
+	pos := namesAt
+	for _, name := range names {
+		pos += copy(data[pos:], name) + 1
+	}
+
+	return data
+}
+
+func TestReadHeaderKala(t *testing.T) {
+	h, err := ReadHeader("../../testdata/kala.db")
+	if err != nil {
+		t.Fatalf("Failed to read header: %v", err)
+	}
+
+	if h.Version != Version7x {
+		t.Errorf("Expected version 7.x, got %s (0x%02x)", h.Version, h.FileVersionID)
+	}
+
+	if h.FieldNamesOffset() != 0x229 {
+		t.Errorf("Expected field names at 0x229, got 0x%x", h.FieldNamesOffset())
+	}
+
+	if len(h.Fields) != h.NumFields || h.NumFields == 0 {
+		t.Fatalf("Expected %d fields, got %d", h.NumFields, len(h.Fields))
+	}
+
+	if h.Fields[0].Name != "Code" {
+		t.Errorf("Expected first field Code, got %q", h.Fields[0].Name)
+	}
+
+	if h.NumRecords == 0 {
+		t.Error("Expected non-zero record count")
+	}
+}
+
+func TestParseHeaderVersions(t *testing.T) {
+	tests := []struct {
+		id      byte
+		version Version
+	}{
+		{0x03, Version30},
+		{0x04, Version35},
+		{0x05, Version4x},
+		{0x09, Version4x},
+		{0x0a, Version5x},
+		{0x0c, Version7x},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.version), func(t *testing.T) {
+			data := buildHeader(tt.id, []string{"Code", "Name"}, []byte{0x04, 0x01})
+
+			h, err := ParseHeader(data)
+			if err != nil {
+				t.Fatalf("Failed to parse header: %v", err)
+			}
+
+			if h.Version != tt.version {
+				t.Errorf("Expected version %s, got %s", tt.version, h.Version)
+			}
+
+			if len(h.Fields) != 2 || h.Fields[0].Name != "Code" || h.Fields[1].Name != "Name" {
+				t.Errorf("Unexpected fields: %+v", h.Fields)
+			}
+
+			if h.Fields[0].Type != "long" || h.Fields[1].Type != "alpha" {
+				t.Errorf("Unexpected field types: %+v", h.Fields)
+			}
+		})
+	}
+}
+
+func TestParseHeaderFieldNamesOffset(t *testing.T) {
+	// Where pxlib reads the names of two fields: after the descriptors, the
+	// table name pointer, the field name pointers and a table name of 261
+	// bytes in 7.x and 79 bytes in older versions
+	tests := []struct {
+		id      byte
+		namesAt int
+	}{
+		{0x03, 0x58 + 2*2 + 4 + 2*4 + 79},
+		{0x04, 0x58 + 2*2 + 4 + 2*4 + 79},
+		{0x05, 0x78 + 2*2 + 4 + 2*4 + 79},
+		{0x09, 0x78 + 2*2 + 4 + 2*4 + 79},
+		{0x0a, 0x78 + 2*2 + 4 + 2*4 + 79},
+		{0x0b, 0x78 + 2*2 + 4 + 2*4 + 79},
+		{0x0c, 0x78 + 2*2 + 4 + 2*4 + 261},
+	}
+
+	for _, tt := range tests {
+		data := buildHeaderAt(tt.id, tt.namesAt, []string{"Code", "Name"}, []byte{0x04, 0x01})
+
+		h, err := ParseHeader(data)
+		if err != nil {
+			t.Fatalf("0x%02x: failed to parse header: %v", tt.id, err)
+		}
+		if h.FieldNamesOffset() != tt.namesAt {
+			t.Errorf("0x%02x (%s): expected field names at 0x%x, got 0x%x", tt.id, h.Version, tt.namesAt, h.FieldNamesOffset())
+		}
+		if len(h.Fields) != 2 || h.Fields[0].Name != "Code" || h.Fields[1].Name != "Name" {
+			t.Errorf("0x%02x (%s): unexpected fields: %+v", tt.id, h.Version, h.Fields)
+		}
+	}
+}
+
+func TestParseHeaderUnsupportedVersion(t *testing.T) {
+	data := buildHeader(0x0c, []string{"Code"}, []byte{0x04})
+	data[offFileVersionID] = 0x0f
+
+	if _, err := ParseHeader(data); !errors.Is(err, ErrUnsupportedVersion) {
+		t.Errorf("Expected ErrUnsupportedVersion, got: %v", err)
+	}
+}
@@ -0,0 +1,204 @@
+package paradox
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/atomicdeploy/patris-export/pkg/resilient"
+)
+
+// RecordIterator reads the records of a table one at a time:
+//
+//	for it.Next() {
+//		record := it.Record()
+//	}
+//	if err := it.Err(); err != nil {
+//		...
+//	}
+type RecordIterator interface {
+	// Next advances to the next record and reports whether there is one
+	Next() bool
+	// Record returns the current record
+	Record() Record
+	// Err returns the error that stopped the iteration, if any
+	Err() error
+	// Close releases the file held by the iterator
+	Close() error
+}
+
+// blockIterator decodes the records of one data block at a time, so its
+// memory use does not depend on the table size
+type blockIterator struct {
+	h       *Header
+	offsets []int
+	r       io.ReaderAt
+	closer  io.Closer
+
+	next    int
+	visited [1 << 16 / 8]byte
+	block   []byte
+	pending []byte
+	record  Record
+	err     error
+}
+
+// NewRecordIterator returns an iterator decoding the records of a table
+// read from r, following the block chain like DecodeRecords
+func NewRecordIterator(h *Header, r io.ReaderAt) (RecordIterator, error) {
+	if h.RecordSize <= 0 || h.BlockSize <= 0 {
+		return nil, fmt.Errorf("invalid record size %d or block size %d", h.RecordSize, h.BlockSize)
+	}
+
+	offsets, err := fieldOffsets(h)
+	if err != nil {
+		return nil, err
+	}
+
+	return &blockIterator{
+		h:       h,
+		offsets: offsets,
+		r:       r,
+		next:    h.FirstBlock,
+		block:   make([]byte, h.BlockSize),
+	}, nil
+}
+
+// OpenRecordIterator opens a table file and returns an iterator over its
+// records; the iterator closes the file
+func OpenRecordIterator(path string) (RecordIterator, error) {
+	file, err := resilient.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open Paradox file: %w", err)
+	}
+
+	header, err := readHeader(file, path)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	it, err := NewRecordIterator(header, file)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	it.(*blockIterator).closer = file
+
+	return it, nil
+}
+
+// Next decodes the next record, reading the next block when needed
+func (it *blockIterator) Next() bool {
+	it.record = nil
+
+	for len(it.pending) < it.h.RecordSize {
+		if it.err != nil || it.next == 0 {
+			return false
+		}
+		if err := it.readBlock(); err != nil {
+			it.err = err
+			return false
+		}
+	}
+
+	it.record = decodeRecord(it.h.Fields, it.offsets, it.pending[:it.h.RecordSize])
+	it.pending = it.pending[it.h.RecordSize:]
+	return true
+}
+
+// readBlock reads the next block of the chain into the block buffer
+func (it *blockIterator) readBlock() error {
+	block := it.next
+	if block < 1 || block >= 1<<16 {
+		return fmt.Errorf("invalid data block number %d", block)
+	}
+	if it.visited[block/8]&(1<<(block%8)) != 0 {
+		return fmt.Errorf("data block chain loops at block %d", block)
+	}
+	it.visited[block/8] |= 1 << (block % 8)
+
+	start := int64(it.h.HeaderSize) + int64(block-1)*int64(it.h.BlockSize)
+	n, err := it.r.ReadAt(it.block, start)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("failed to read data block %d: %w", block, err)
+	}
+	if n < dataBlockHeaderSize {
+		return fmt.Errorf("data block %d is beyond the end of the file", block)
+	}
+
+	it.next = int(binary.LittleEndian.Uint16(it.block))
+	it.pending = nil
+
+	// A negative offset marks an empty block
+	lastOffset := int(int16(binary.LittleEndian.Uint16(it.block[4:])))
+	if lastOffset >= 0 {
+		end := dataBlockHeaderSize + (lastOffset/it.h.RecordSize+1)*it.h.RecordSize
+		if end > n {
+			return fmt.Errorf("records of block %d are truncated", block)
+		}
+		it.pending = it.block[dataBlockHeaderSize:end]
+	}
+
+	return nil
+}
+
+// Record returns the current record
+func (it *blockIterator) Record() Record {
+	return it.record
+}
+
+// Err returns the error that stopped the iteration
+func (it *blockIterator) Err() error {
+	return it.err
+}
+
+// Close closes the table file opened by OpenRecordIterator
+func (it *blockIterator) Close() error {
+	if it.closer == nil {
+		return nil
+	}
+	closer := it.closer
+	it.closer = nil
+	return closer.Close()
+}
+
+// sliceIterator iterates over records already in memory
+type sliceIterator struct {
+	records []Record
+	pos     int
+}
+
+// NewSliceIterator returns an iterator over records already in memory
+func NewSliceIterator(records []Record) RecordIterator {
+	return &sliceIterator{records: records, pos: -1}
+}
+
+// Next advances to the next record
+func (it *sliceIterator) Next() bool {
+	if it.pos+1 >= len(it.records) {
+		it.pos = len(it.records)
+		return false
+	}
+	it.pos++
+	return true
+}
+
+// Record returns the current record
+func (it *sliceIterator) Record() Record {
+	if it.pos < 0 || it.pos >= len(it.records) {
+		return nil
+	}
+	return it.records[it.pos]
+}
+
+// Err always returns nil
+func (it *sliceIterator) Err() error {
+	return nil
+}
+
+// Close does nothing
+func (it *sliceIterator) Close() error {
+	return nil
+}
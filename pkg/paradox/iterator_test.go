@@ -0,0 +1,92 @@
+package paradox
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestOpenRecordIteratorKala(t *testing.T) {
+	h, err := ReadHeader("../../testdata/kala.db")
+	if err != nil {
+		t.Fatalf("Failed to read header: %v", err)
+	}
+	data, err := os.ReadFile("../../testdata/kala.db")
+	if err != nil {
+		t.Fatalf("Failed to read file: %v", err)
+	}
+	expected, err := DecodeRecords(h, data)
+	if err != nil {
+		t.Fatalf("Failed to decode records: %v", err)
+	}
+
+	it, err := OpenRecordIterator("../../testdata/kala.db")
+	if err != nil {
+		t.Fatalf("Failed to open iterator: %v", err)
+	}
+	defer it.Close()
+
+	var records []Record
+	for it.Next() {
+		records = append(records, it.Record())
+	}
+	if err := it.Err(); err != nil {
+		t.Fatalf("Iteration failed: %v", err)
+	}
+
+	if !reflect.DeepEqual(records, expected) {
+		t.Errorf("Iterator returned %d records that differ from DecodeRecords (%d records)", len(records), len(expected))
+	}
+}
+
+func TestRecordIteratorBlockLoop(t *testing.T) {
+	data := buildHeader(0x04, []string{"Code"}, []byte{0x04})
+	data[fieldInfoOffsetV3+1] = 4
+	binary.LittleEndian.PutUint16(data[offRecordSize:], 4)
+	binary.LittleEndian.PutUint16(data[offFirstBlock:], 1)
+
+	h, err := ParseHeader(data)
+	if err != nil {
+		t.Fatalf("Failed to parse header: %v", err)
+	}
+
+	// Block 1 points to itself
+	block := make([]byte, h.BlockSize)
+	binary.LittleEndian.PutUint16(block[0:], 1)
+	binary.BigEndian.PutUint32(block[dataBlockHeaderSize:], 5^0x80000000)
+	data = append(data, block...)
+
+	it, err := NewRecordIterator(h, bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Failed to create iterator: %v", err)
+	}
+
+	count := 0
+	for it.Next() {
+		count++
+	}
+	if count != 1 {
+		t.Errorf("Expected 1 record before the loop, got %d", count)
+	}
+	if it.Err() == nil || !strings.Contains(it.Err().Error(), "loops") {
+		t.Errorf("Expected a block loop error, got %v", it.Err())
+	}
+}
+
+func TestSliceIterator(t *testing.T) {
+	it := NewSliceIterator([]Record{{"Code": 1}, {"Code": 2}})
+
+	var codes []interface{}
+	for it.Next() {
+		codes = append(codes, it.Record()["Code"])
+	}
+	if !reflect.DeepEqual(codes, []interface{}{1, 2}) || it.Err() != nil {
+		t.Errorf("Unexpected iteration: %v, %v", codes, it.Err())
+	}
+	if it.Record() != nil {
+		t.Error("Expected no record after the end")
+	}
+}
@@ -1,6 +1,10 @@
 package paradox
 
 import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -117,3 +121,38 @@ func TestReadCompanyInfo(t *testing.T) {
 
 	t.Logf("Company: %s, Start: %s, End: %s", info.Name, info.StartDate, info.EndDate)
 }
+
+func TestReadCompanyInfoExtended(t *testing.T) {
+	tmpFile := filepath.Join(t.TempDir(), "company.inf")
+	content := "Name\r\n99.01.01\r\n99.12.29\r\n\xcf\xe0 1399 \r\n\r\n0110\r\n\r\n"
+	if err := os.WriteFile(tmpFile, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write company.inf: %v", err)
+	}
+
+	info, err := ReadCompanyInfo(tmpFile, strings.ToUpper)
+	if err != nil {
+		t.Fatalf("Failed to read company info: %v", err)
+	}
+
+	if info.Name != "NAME" {
+		t.Errorf("Expected converted name, got %q", info.Name)
+	}
+
+	if info.StartDate != "99.01.01" || info.EndDate != "99.12.29" {
+		t.Errorf("Unexpected dates: %q - %q", info.StartDate, info.EndDate)
+	}
+
+	// Later lines are kept as read, without the trailing blank line
+	expected := [][]byte{[]byte("\xcf\xe0 1399 "), {}, []byte("0110")}
+	if !reflect.DeepEqual(info.Extra, expected) {
+		t.Errorf("Expected the raw extra lines %q, got %q", expected, info.Extra)
+	}
+
+	info, err = ReadCompanyInfo("../../testdata/company.inf", nil)
+	if err != nil {
+		t.Fatalf("Failed to read company info: %v", err)
+	}
+	if info.Extra != nil {
+		t.Errorf("Expected no extra lines in a three-line company.inf, got %q", info.Extra)
+	}
+}
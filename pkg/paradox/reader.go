@@ -1,3 +1,5 @@
+//go:build cgo && !purego
+
 package paradox
 
 /*
@@ -7,42 +9,87 @@ package paradox
 */
 import "C"
 import (
+	"errors"
 	"fmt"
+	"io/fs"
 	"unsafe"
+
+	"github.com/atomicdeploy/patris-export/pkg/filecopy"
+	"github.com/atomicdeploy/patris-export/pkg/resilient"
 )
 
 // Database represents a Paradox database file
 type Database struct {
-	pxdoc *C.pxdoc_t
-	path  string
+	pxdoc  *C.pxdoc_t
+	path   string
+	header *Header
+	// shadow is the temporary copy opened by OpenShadow
+	shadow *filecopy.Copy
 }
 
-// Open opens a Paradox database file
+// Open opens a Paradox database file.
+// Transient failures (e.g. a dropped network share) are retried according to
+// the resilient package's default policy.
 func Open(path string) (*Database, error) {
 	// Initialize pxlib
 	C.PX_boot()
 
-	// Create pxdoc structure
-	pxdoc := C.PX_new()
-	if pxdoc == nil {
-		return nil, fmt.Errorf("failed to create pxdoc structure")
-	}
-
-	// Open the file
 	cPath := C.CString(path)
 	defer C.free(unsafe.Pointer(cPath))
 
-	if C.PX_open_file(pxdoc, cPath) < 0 {
-		C.PX_delete(pxdoc)
-		return nil, fmt.Errorf("failed to open Paradox file: %s", path)
+	type opened struct {
+		pxdoc  *C.pxdoc_t
+		header *Header
+	}
+
+	result, err := resilient.DoValue("open "+path, func() (opened, error) {
+		// Detect the file version first so unsupported files fail with a clear message
+		header, err := ReadHeader(path)
+		if errors.Is(err, ErrUnsupportedVersion) || errors.Is(err, ErrNotTable) {
+			return opened{}, resilient.Permanent(fmt.Errorf("cannot open %s: %w", path, err))
+		}
+		if errors.Is(err, fs.ErrNotExist) {
+			return opened{}, err
+		}
+
+		// Create pxdoc structure
+		pxdoc := C.PX_new()
+		if pxdoc == nil {
+			return opened{}, fmt.Errorf("failed to create pxdoc structure")
+		}
+
+		// Open the file
+		if C.PX_open_file(pxdoc, cPath) < 0 {
+			C.PX_delete(pxdoc)
+			return opened{}, fmt.Errorf("failed to open Paradox file: %s", path)
+		}
+
+		return opened{pxdoc: pxdoc, header: header}, nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
 	return &Database{
-		pxdoc: pxdoc,
-		path:  path,
+		pxdoc:  result.pxdoc,
+		path:   path,
+		header: result.header,
 	}, nil
 }
 
+// Version returns the detected Paradox file format version
+func (db *Database) Version() Version {
+	if db.header == nil {
+		return VersionUnknown
+	}
+	return db.header.Version
+}
+
+// Header returns the parsed table header, or nil if it could not be parsed
+func (db *Database) Header() *Header {
+	return db.header
+}
+
 // Close closes the database
 func (db *Database) Close() error {
 	if db.pxdoc != nil {
@@ -50,7 +97,7 @@ func (db *Database) Close() error {
 		C.PX_delete(db.pxdoc)
 		db.pxdoc = nil
 	}
-	return nil
+	return db.removeShadow()
 }
 
 // GetFields returns the list of fields in the database
@@ -124,46 +171,121 @@ func (db *Database) GetRecords() ([]Record, error) {
 		return nil, fmt.Errorf("database is not open")
 	}
 
+	// The block cache decodes only changed blocks with the pure-Go decoder
+	if cache := GetBlockCache(); cache != nil {
+		return cache.ReadCopy(db.path, db.Source().Path)
+	}
+
 	numRecords := int(C.PX_get_num_records(db.pxdoc))
-	numFields := int(C.PX_get_num_fields(db.pxdoc))
 
 	records := make([]Record, 0, numRecords)
 
 	for i := 0; i < numRecords; i++ {
-		pxvals := C.PX_retrieve_record(db.pxdoc, C.int(i))
-		if pxvals == nil {
+		if record, ok := db.retrieveRecord(i); ok {
+			records = append(records, record)
+		}
+	}
+
+	return records, nil
+}
+
+// Records returns an iterator retrieving the records one at a time, so that
+// large tables can be exported without loading them into memory. The caller
+// must close the iterator.
+func (db *Database) Records() (RecordIterator, error) {
+	if db.pxdoc == nil {
+		return nil, fmt.Errorf("database is not open")
+	}
+
+	if cache := GetBlockCache(); cache != nil {
+		records, err := cache.ReadCopy(db.path, db.Source().Path)
+		if err != nil {
+			return nil, err
+		}
+		return NewSliceIterator(records), nil
+	}
+
+	return &pxIterator{db: db, count: int(C.PX_get_num_records(db.pxdoc)), pos: -1}, nil
+}
+
+// pxIterator retrieves records through pxlib one at a time
+type pxIterator struct {
+	db     *Database
+	count  int
+	pos    int
+	record Record
+}
+
+// Next retrieves the next record, skipping records pxlib cannot read
+func (it *pxIterator) Next() bool {
+	it.record = nil
+	for it.pos+1 < it.count {
+		it.pos++
+		if it.db.pxdoc == nil {
+			return false
+		}
+		if record, ok := it.db.retrieveRecord(it.pos); ok {
+			it.record = record
+			return true
+		}
+	}
+	return false
+}
+
+// Record returns the current record
+func (it *pxIterator) Record() Record {
+	return it.record
+}
+
+// Err reports a database closed before the iteration finished; pxlib does
+// not report errors for single records
+func (it *pxIterator) Err() error {
+	if it.db.pxdoc == nil && it.pos+1 < it.count {
+		return fmt.Errorf("database was closed during iteration")
+	}
+	return nil
+}
+
+// Close does nothing; the database stays open
+func (it *pxIterator) Close() error {
+	return nil
+}
+
+// retrieveRecord reads record i, returning false if pxlib cannot read it
+func (db *Database) retrieveRecord(i int) (Record, bool) {
+	numFields := int(C.PX_get_num_fields(db.pxdoc))
+
+	pxvals := C.PX_retrieve_record(db.pxdoc, C.int(i))
+	if pxvals == nil {
+		return nil, false
+	}
+
+	record := make(Record)
+
+	for j := 0; j < numFields; j++ {
+		field := C.PX_get_field(db.pxdoc, C.int(j))
+		if field == nil {
 			continue
 		}
 
-		record := make(Record)
-		
-		for j := 0; j < numFields; j++ {
-			field := C.PX_get_field(db.pxdoc, C.int(j))
-			if field == nil {
-				continue
-			}
+		fieldName := C.GoString(field.px_fname)
+
+		// Get the pxval_t pointer for this field
+		pxvalPtr := (**C.pxval_t)(unsafe.Pointer(uintptr(unsafe.Pointer(pxvals)) + uintptr(j)*unsafe.Sizeof(*pxvals)))
+		pxval := *pxvalPtr
 
-			fieldName := C.GoString(field.px_fname)
-			
-			// Get the pxval_t pointer for this field
-			pxvalPtr := (**C.pxval_t)(unsafe.Pointer(uintptr(unsafe.Pointer(pxvals)) + uintptr(j)*unsafe.Sizeof(*pxvals)))
-			pxval := *pxvalPtr
-			
-			if pxval == nil {
-				continue
-			}
-			
-			value := db.getFieldValue(pxval, field.px_ftype)
-			
-			if value != nil {
-				record[fieldName] = value
-			}
+		if pxval == nil {
+			continue
 		}
 
-		records = append(records, record)
+		value := db.getFieldValue(pxval, field.px_ftype)
+
+		if value != nil {
+			record[fieldName] = value
+		}
 	}
 
-	return records, nil
+	return record, true
 }
 
 // getFieldValue extracts a field value from a pxval_t
@@ -0,0 +1,137 @@
+//go:build !cgo || purego
+
+package paradox
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+
+	"github.com/atomicdeploy/patris-export/pkg/filecopy"
+	"github.com/atomicdeploy/patris-export/pkg/resilient"
+)
+
+// Database represents a Paradox database file read without pxlib.
+// This implementation is used when cgo is disabled or with the purego build tag.
+type Database struct {
+	path   string
+	header *Header
+	// shadow is the temporary copy opened by OpenShadow
+	shadow *filecopy.Copy
+}
+
+// Open opens a Paradox database file.
+// Transient failures (e.g. a dropped network share) are retried according to
+// the resilient package's default policy.
+func Open(path string) (*Database, error) {
+	header, err := resilient.DoValue("open "+path, func() (*Header, error) {
+		header, err := ReadHeader(path)
+		if errors.Is(err, ErrUnsupportedVersion) || errors.Is(err, ErrNotTable) {
+			return nil, resilient.Permanent(fmt.Errorf("cannot open %s: %w", path, err))
+		}
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("failed to open Paradox file: %w", err)
+		}
+		return header, err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &Database{
+		path:   path,
+		header: header,
+	}, nil
+}
+
+// Version returns the detected Paradox file format version
+func (db *Database) Version() Version {
+	if db.header == nil {
+		return VersionUnknown
+	}
+	return db.header.Version
+}
+
+// Header returns the parsed table header
+func (db *Database) Header() *Header {
+	return db.header
+}
+
+// Close closes the database
+func (db *Database) Close() error {
+	db.header = nil
+	return db.removeShadow()
+}
+
+// GetFields returns the list of fields in the database
+func (db *Database) GetFields() ([]Field, error) {
+	if db.header == nil {
+		return nil, fmt.Errorf("database is not open")
+	}
+
+	fields := make([]Field, len(db.header.Fields))
+	copy(fields, db.header.Fields)
+	return fields, nil
+}
+
+// GetRecords returns all records from the database
+func (db *Database) GetRecords() ([]Record, error) {
+	if db.header == nil {
+		return nil, fmt.Errorf("database is not open")
+	}
+
+	if cache := GetBlockCache(); cache != nil {
+		return cache.ReadCopy(db.path, db.Source().Path)
+	}
+
+	data, err := resilient.ReadFile(db.path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read Paradox file: %w", err)
+	}
+
+	// Re-read the header in case the table changed since it was opened
+	header, err := parseFileHeader(data)
+	if err != nil {
+		return nil, err
+	}
+
+	return DecodeRecords(header, data)
+}
+
+// Records returns an iterator reading the records one data block at a time,
+// so that large tables can be exported without loading them into memory.
+// The caller must close the iterator.
+func (db *Database) Records() (RecordIterator, error) {
+	if db.header == nil {
+		return nil, fmt.Errorf("database is not open")
+	}
+
+	if cache := GetBlockCache(); cache != nil {
+		records, err := cache.ReadCopy(db.path, db.Source().Path)
+		if err != nil {
+			return nil, err
+		}
+		return NewSliceIterator(records), nil
+	}
+
+	return OpenRecordIterator(db.path)
+}
+
+// GetNumRecords returns the number of records in the database
+func (db *Database) GetNumRecords() int {
+	if db.header == nil {
+		return 0
+	}
+	return db.header.NumRecords
+}
+
+// GetNumFields returns the number of fields in the database
+func (db *Database) GetNumFields() int {
+	if db.header == nil {
+		return 0
+	}
+	return db.header.NumFields
+}
+
+// Shutdown releases global reader resources; the pure-Go reader has none
+func Shutdown() {}
@@ -0,0 +1,85 @@
+//go:build !cgo || purego
+
+package paradox
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeTable writes a table of the given version with Code (long) and Name
+// (alpha, 16 bytes) fields, its names where pxlib reads them, and one data
+// block of records
+func writeTable(t *testing.T, versionID byte, namesAt int, codes ...int) string {
+	t.Helper()
+
+	data := buildHeaderAt(versionID, namesAt, []string{"Code", "Name"}, []byte{0x04, 0x01})
+	h := &Header{Version: VersionFromID(versionID)}
+	data[h.FieldInfoOffset()+1] = 4
+	data[h.FieldInfoOffset()+3] = 16
+	binary.LittleEndian.PutUint16(data[offRecordSize:], 20)
+	binary.LittleEndian.PutUint32(data[offNumRecords:], uint32(len(codes)))
+	binary.LittleEndian.PutUint16(data[offFileBlocks:], 1)
+	binary.LittleEndian.PutUint16(data[offFirstBlock:], 1)
+	binary.LittleEndian.PutUint16(data[offLastBlock:], 1)
+
+	block := make([]byte, int(data[offMaxTableSize])*1024)
+	binary.LittleEndian.PutUint16(block[4:], uint16((len(codes)-1)*20))
+	for i, code := range codes {
+		record := block[dataBlockHeaderSize+i*20:]
+		binary.BigEndian.PutUint32(record, uint32(code)^0x80000000)
+		copy(record[4:], "item")
+	}
+
+	path := filepath.Join(t.TempDir(), "kala.db")
+	if err := os.WriteFile(path, append(data, block...), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestOpenVersions(t *testing.T) {
+	// Field names follow a 79-byte table name before 7.x
+	tests := []struct {
+		id      byte
+		version Version
+		namesAt int
+	}{
+		{0x05, Version4x, 0x78 + 2*2 + 4 + 2*4 + 79},
+		{0x09, Version4x, 0x78 + 2*2 + 4 + 2*4 + 79},
+		{0x0a, Version5x, 0x78 + 2*2 + 4 + 2*4 + 79},
+		{0x0b, Version5x, 0x78 + 2*2 + 4 + 2*4 + 79},
+	}
+
+	for _, tt := range tests {
+		db, err := Open(writeTable(t, tt.id, tt.namesAt, 101, 102))
+		if err != nil {
+			t.Fatalf("0x%02x: failed to open table: %v", tt.id, err)
+		}
+		defer db.Close()
+
+		if db.Version() != tt.version {
+			t.Errorf("0x%02x: expected version %s, got %s", tt.id, tt.version, db.Version())
+		}
+
+		fields, err := db.GetFields()
+		if err != nil || len(fields) != 2 || fields[0].Name != "Code" || fields[1].Name != "Name" {
+			t.Errorf("0x%02x: unexpected fields %+v: %v", tt.id, fields, err)
+		}
+
+		records, err := db.GetRecords()
+		if err != nil {
+			t.Fatalf("0x%02x: failed to read records: %v", tt.id, err)
+		}
+		if len(records) != 2 {
+			t.Fatalf("0x%02x: expected 2 records, got %d", tt.id, len(records))
+		}
+		for i, record := range records {
+			if record["Code"] != 101+i || record["Name"] != "item" {
+				t.Errorf("0x%02x: unexpected record %d: %v", tt.id, i, record)
+			}
+		}
+	}
+}
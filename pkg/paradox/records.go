@@ -0,0 +1,181 @@
+package paradox
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+)
+
+// Data block header: next block, previous block, offset of the last record
+const dataBlockHeaderSize = 6
+
+// DecodeRecords decodes all records from the data blocks of a Paradox table.
+// data holds the whole file; blocks are read in table order by following the
+// block chain from the header's first block.
+func DecodeRecords(h *Header, data []byte) ([]Record, error) {
+	offsets, err := fieldOffsets(h)
+	if err != nil {
+		return nil, err
+	}
+
+	records := make([]Record, 0, h.NumRecords)
+	err = walkBlocks(h, data, func(block int, raw []byte) error {
+		records = append(records, decodeBlock(h, offsets, raw)...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return records, nil
+}
+
+// walkBlocks calls fn with the record area of every data block in chain order
+func walkBlocks(h *Header, data []byte, fn func(block int, raw []byte) error) error {
+	if h.RecordSize <= 0 || h.BlockSize <= 0 {
+		return fmt.Errorf("invalid record size %d or block size %d", h.RecordSize, h.BlockSize)
+	}
+
+	visited := make(map[int]bool)
+
+	for block := h.FirstBlock; block != 0; {
+		if visited[block] {
+			return fmt.Errorf("data block chain loops at block %d", block)
+		}
+		visited[block] = true
+
+		start := h.HeaderSize + (block-1)*h.BlockSize
+		if start < h.HeaderSize || start+dataBlockHeaderSize > len(data) {
+			return fmt.Errorf("data block %d is beyond the end of the file", block)
+		}
+
+		next := int(binary.LittleEndian.Uint16(data[start:]))
+		lastOffset := int(int16(binary.LittleEndian.Uint16(data[start+4:])))
+
+		// A negative offset marks an empty block
+		if lastOffset >= 0 {
+			count := lastOffset/h.RecordSize + 1
+			end := start + dataBlockHeaderSize + count*h.RecordSize
+			if end > len(data) {
+				return fmt.Errorf("records of block %d are truncated", block)
+			}
+			if err := fn(block, data[start+dataBlockHeaderSize:end]); err != nil {
+				return err
+			}
+		}
+
+		block = next
+	}
+
+	return nil
+}
+
+// decodeBlock decodes the records stored in the record area of one block
+func decodeBlock(h *Header, offsets []int, raw []byte) []Record {
+	records := make([]Record, 0, len(raw)/h.RecordSize)
+	for pos := 0; pos+h.RecordSize <= len(raw); pos += h.RecordSize {
+		records = append(records, decodeRecord(h.Fields, offsets, raw[pos:pos+h.RecordSize]))
+	}
+	return records
+}
+
+// parseFileHeader parses the header at the start of a whole table file
+func parseFileHeader(data []byte) (*Header, error) {
+	if len(data) < offHeaderSize+2 {
+		return nil, fmt.Errorf("file is too small to be a Paradox table")
+	}
+	headerSize := int(binary.LittleEndian.Uint16(data[offHeaderSize:]))
+	if headerSize > len(data) {
+		return nil, fmt.Errorf("Paradox header is truncated")
+	}
+	return ParseHeader(data[:headerSize])
+}
+
+// fieldOffsets returns the byte offset of each field within a record
+func fieldOffsets(h *Header) ([]int, error) {
+	offsets := make([]int, len(h.Fields))
+	pos := 0
+	for i, field := range h.Fields {
+		offsets[i] = pos
+		pos += field.Size
+	}
+	if pos > h.RecordSize {
+		return nil, fmt.Errorf("field sizes (%d bytes) exceed the record size (%d bytes)", pos, h.RecordSize)
+	}
+	return offsets, nil
+}
+
+// decodeRecord decodes one record; null values are omitted like in the pxlib reader
+func decodeRecord(fields []Field, offsets []int, raw []byte) Record {
+	record := make(Record, len(fields))
+	for i, field := range fields {
+		if value := DecodeValue(field, raw[offsets[i]:offsets[i]+field.Size]); value != nil {
+			record[field.Name] = value
+		}
+	}
+	return record
+}
+
+// DecodeValue decodes a raw field value. It returns nil for null values and
+// for field types stored outside the record (memos, blobs).
+//
+// Numbers are stored big-endian with the sign bit flipped so that they sort
+// bytewise; negative floating point values additionally have all bits inverted.
+func DecodeValue(field Field, raw []byte) interface{} {
+	if isZero(raw) {
+		return nil
+	}
+
+	switch field.Type {
+	case "alpha":
+		// Text is NUL-padded; raw bytes are kept for the Patris converter
+		if end := bytes.IndexByte(raw, 0); end >= 0 {
+			raw = raw[:end]
+		}
+		return string(raw)
+
+	case "short":
+		if len(raw) < 2 {
+			return nil
+		}
+		return int(int16(binary.BigEndian.Uint16(raw) ^ 0x8000))
+
+	case "long", "autoinc", "date", "time":
+		if len(raw) < 4 {
+			return nil
+		}
+		return int(int32(binary.BigEndian.Uint32(raw) ^ 0x80000000))
+
+	case "number", "currency", "timestamp":
+		if len(raw) < 8 {
+			return nil
+		}
+		bits := binary.BigEndian.Uint64(raw)
+		if bits&(1<<63) != 0 {
+			bits &^= 1 << 63
+		} else {
+			bits = ^bits
+		}
+		return math.Float64frombits(bits)
+
+	case "logical":
+		return raw[0]&0x7f != 0
+
+	case "bytes":
+		return string(raw)
+
+	default:
+		return nil
+	}
+}
+
+// isZero reports whether all bytes are zero, which Paradox uses for null values
+func isZero(raw []byte) bool {
+	for _, b := range raw {
+		if b != 0 {
+			return false
+		}
+	}
+	return true
+}
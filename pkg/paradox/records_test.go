@@ -0,0 +1,118 @@
+package paradox
+
+import (
+	"encoding/binary"
+	"math"
+	"os"
+	"testing"
+)
+
+func TestDecodeValue(t *testing.T) {
+	float := func(v float64) []byte {
+		bits := math.Float64bits(v)
+		if v >= 0 {
+			bits |= 1 << 63
+		} else {
+			bits = ^bits
+		}
+		raw := make([]byte, 8)
+		binary.BigEndian.PutUint64(raw, bits)
+		return raw
+	}
+
+	tests := []struct {
+		name     string
+		field    Field
+		raw      []byte
+		expected interface{}
+	}{
+		{"alpha", Field{Type: "alpha"}, []byte("abc\x00\x00"), "abc"},
+		{"null", Field{Type: "alpha"}, []byte{0, 0, 0}, nil},
+		{"short", Field{Type: "short"}, []byte{0x80, 0x05}, 5},
+		{"negative short", Field{Type: "short"}, []byte{0x7f, 0xfb}, -5},
+		{"long", Field{Type: "long"}, []byte{0x80, 0x00, 0x01, 0x00}, 256},
+		{"zero long", Field{Type: "long"}, []byte{0x80, 0x00, 0x00, 0x00}, 0},
+		{"negative long", Field{Type: "long"}, []byte{0x7f, 0xff, 0xff, 0xff}, -1},
+		{"number", Field{Type: "number"}, float(37.5), 37.5},
+		{"negative number", Field{Type: "currency"}, float(-1250.25), -1250.25},
+		{"true", Field{Type: "logical"}, []byte{0x81}, true},
+		{"false", Field{Type: "logical"}, []byte{0x80}, false},
+		{"memo", Field{Type: "memo"}, []byte{1, 2, 3}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := DecodeValue(tt.field, tt.raw); got != tt.expected {
+				t.Errorf("DecodeValue = %#v, want %#v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestDecodeRecordsLegacyVersion(t *testing.T) {
+	// Paradox 3.5 table with Code (long, 4 bytes) and Name (alpha, 16 bytes)
+	data := buildHeader(0x04, []string{"Code", "Name"}, []byte{0x04, 0x01})
+	data[fieldInfoOffsetV3+1] = 4
+	data[fieldInfoOffsetV3+3] = 16
+	binary.LittleEndian.PutUint16(data[offRecordSize:], 20)
+	binary.LittleEndian.PutUint32(data[offNumRecords:], 3)
+	binary.LittleEndian.PutUint16(data[offFirstBlock:], 2)
+
+	h, err := ParseHeader(data)
+	if err != nil {
+		t.Fatalf("Failed to parse header: %v", err)
+	}
+
+	// Two blocks chained 2 -> 1, holding two records and one record
+	block := func(next, count int, codes ...int) []byte {
+		b := make([]byte, h.BlockSize)
+		binary.LittleEndian.PutUint16(b[0:], uint16(next))
+		binary.LittleEndian.PutUint16(b[4:], uint16((count-1)*h.RecordSize))
+		for i, code := range codes {
+			rec := b[dataBlockHeaderSize+i*h.RecordSize:]
+			binary.BigEndian.PutUint32(rec, uint32(code)^0x80000000)
+			copy(rec[4:], "item")
+		}
+		return b
+	}
+	data = append(data, block(0, 1, 3)...)
+	data = append(data, block(1, 2, 1, 2)...)
+
+	records, err := DecodeRecords(h, data)
+	if err != nil {
+		t.Fatalf("Failed to decode records: %v", err)
+	}
+
+	if len(records) != 3 {
+		t.Fatalf("Expected 3 records, got %d", len(records))
+	}
+	for i, record := range records {
+		if record["Code"] != i+1 || record["Name"] != "item" {
+			t.Errorf("Unexpected record %d: %v", i, record)
+		}
+	}
+}
+
+func TestDecodeRecordsKala(t *testing.T) {
+	h, err := ReadHeader("../../testdata/kala.db")
+	if err != nil {
+		t.Fatalf("Failed to read header: %v", err)
+	}
+
+	data, err := os.ReadFile("../../testdata/kala.db")
+	if err != nil {
+		t.Fatalf("Failed to read file: %v", err)
+	}
+
+	records, err := DecodeRecords(h, data)
+	if err != nil {
+		t.Fatalf("Failed to decode records: %v", err)
+	}
+
+	if len(records) != h.NumRecords {
+		t.Errorf("Expected %d records, got %d", h.NumRecords, len(records))
+	}
+	if _, ok := records[0]["Code"].(int); !ok {
+		t.Errorf("Expected integer Code, got %#v", records[0]["Code"])
+	}
+}
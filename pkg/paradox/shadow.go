@@ -0,0 +1,53 @@
+package paradox
+
+import (
+	"fmt"
+
+	"github.com/atomicdeploy/patris-export/pkg/filecopy"
+)
+
+// OpenShadow opens a temporary copy of a table instead of the table itself,
+// so the original is released as soon as it is copied and a writer such as
+// BDE never finds it held open. The copy is reused while the table is
+// unchanged; closing the database releases it.
+func OpenShadow(path string) (*Database, error) {
+	shadow, err := filecopy.CopyToTemp(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to copy table: %w", err)
+	}
+
+	db, err := Open(shadow.Path)
+	if err != nil {
+		shadow.Remove()
+		return nil, err
+	}
+	db.shadow = shadow
+	return db, nil
+}
+
+// OpenTable opens a table, through a temporary copy if shadow is set
+func OpenTable(path string, shadow bool) (*Database, error) {
+	if shadow {
+		return OpenShadow(path)
+	}
+	return Open(path)
+}
+
+// Source describes the table file the database was opened from: for a
+// shadow copy the original as it was copied, otherwise the file itself
+func (db *Database) Source() filecopy.FileInfo {
+	if db.shadow != nil {
+		return db.shadow.Source
+	}
+	return filecopy.FileInfo{Path: db.path}
+}
+
+// removeShadow releases the temporary copy the database was opened from
+func (db *Database) removeShadow() error {
+	if db.shadow == nil {
+		return nil
+	}
+	err := db.shadow.Remove()
+	db.shadow = nil
+	return err
+}
@@ -0,0 +1,354 @@
+package pipeline
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/atomicdeploy/patris-export/pkg/converter"
+	"github.com/atomicdeploy/patris-export/pkg/resilient"
+	"github.com/atomicdeploy/patris-export/pkg/sink"
+	"github.com/atomicdeploy/patris-export/pkg/watcher"
+	"gopkg.in/yaml.v3"
+)
+
+// Formats are the export formats of pipeline outputs
+var Formats = []string{"json", "csv", "yaml", "xlsx", "sqlite"}
+
+// Config maps the tables of Patris data directories to pipelines
+type Config struct {
+	// Dir is the data directory of pipelines not giving their own; a
+	// relative path is relative to the config file
+	Dir string `yaml:"dir" json:"dir"`
+	// Health is the address of the daemon's health endpoint (e.g.
+	// 127.0.0.1:9190); empty disables it
+	Health string `yaml:"health,omitempty" json:"health,omitempty"`
+
+	Watching `yaml:",inline"`
+
+	Pipelines []*Pipeline `yaml:"pipelines" json:"pipelines"`
+}
+
+// Watching configures the watcher of a config
+type Watching struct {
+	// Debounce, MaxWait, WatchMode, PollInterval and Settle configure the
+	// watcher as the flags of convert -w do
+	Debounce     time.Duration `yaml:"debounce,omitempty" json:"debounce,omitempty"`
+	MaxWait      time.Duration `yaml:"max_wait,omitempty" json:"max_wait,omitempty"`
+	WatchMode    string        `yaml:"watch_mode,omitempty" json:"watch_mode,omitempty"`
+	PollInterval time.Duration `yaml:"poll_interval,omitempty" json:"poll_interval,omitempty"`
+	Settle       time.Duration `yaml:"settle,omitempty" json:"settle,omitempty"`
+	// ChangeDetection is sha256 (default), crc32 or stat, as the
+	// --change-detection flag
+	ChangeDetection string `yaml:"change_detection,omitempty" json:"change_detection,omitempty"`
+	// Retries and Backoff retry tables that cannot be read (e.g. while
+	// locked), by default 3 times after 1s; Backoff doubles with each retry
+	Retries *int          `yaml:"retries,omitempty" json:"retries,omitempty"`
+	Backoff time.Duration `yaml:"backoff,omitempty" json:"backoff,omitempty"`
+}
+
+// Pipeline exports the tables it matches, syncs them to databases and
+// notifies others of the exports
+type Pipeline struct {
+	Name string `yaml:"name" json:"name"`
+	// Dir is the data directory of the pipeline's tables (default: the
+	// config's dir); a relative path is relative to the config file
+	Dir string `yaml:"dir,omitempty" json:"dir,omitempty"`
+	// Tables are the table file names or globs (e.g. kala.db, *.db) of the
+	// pipeline, matched case-insensitively
+	Tables []string `yaml:"tables" json:"tables"`
+	// Profile is a built-in profile name or profile file (default: selected
+	// by file name)
+	Profile string   `yaml:"profile,omitempty" json:"profile,omitempty"`
+	Outputs []Output `yaml:"outputs" json:"outputs"`
+	Sinks   []Sink   `yaml:"sinks,omitempty" json:"sinks,omitempty"`
+	Notify  []Notify `yaml:"notify,omitempty" json:"notify,omitempty"`
+}
+
+// Output is an export of a table: <dir>/<table>.<format>
+type Output struct {
+	Format string `yaml:"format" json:"format"`
+	// Dir is the output directory; a relative path is relative to the
+	// config file
+	Dir string `yaml:"dir" json:"dir"`
+}
+
+// Sink keeps a database table in sync with each table of the pipeline, as
+// sync postgres and sync mssql do; the mapping is given inline. Tables of
+// the same pipeline are written to the same database table.
+type Sink struct {
+	// Database is a kind of sink.Databases: postgres or mssql
+	Database string `yaml:"database" json:"database"`
+	// DSN is the connection string, or DSNEnv the environment variable
+	// holding it, keeping passwords out of the config file
+	DSN    string `yaml:"dsn,omitempty" json:"dsn,omitempty"`
+	DSNEnv string `yaml:"dsn_env,omitempty" json:"dsn_env,omitempty"`
+
+	sink.Mapping `yaml:",inline"`
+}
+
+// Notify is told about each export: a URL receives a POST of the export's
+// description as JSON, a command is run with it in its environment
+type Notify struct {
+	URL     string   `yaml:"url,omitempty" json:"url,omitempty"`
+	Command []string `yaml:"command,omitempty" json:"command,omitempty"`
+}
+
+// LoadConfig loads a pipeline config from a YAML (or JSON) file
+func LoadConfig(path string) (*Config, error) {
+	data, err := resilient.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read pipeline config: %w", err)
+	}
+
+	c := &Config{}
+	if err := yaml.Unmarshal(data, c); err != nil {
+		return nil, fmt.Errorf("failed to parse pipeline config %s: %w", path, err)
+	}
+
+	base := filepath.Dir(path)
+	c.Dir = resolve(base, c.Dir)
+	for _, p := range c.Pipelines {
+		if p == nil {
+			continue
+		}
+		p.Dir = resolve(base, p.Dir)
+		if _, builtin := converter.LookupProfile(p.Profile); !builtin && p.Profile != converter.DefaultProfile.Name {
+			p.Profile = resolve(base, p.Profile)
+		}
+		for i := range p.Outputs {
+			p.Outputs[i].Dir = resolve(base, p.Outputs[i].Dir)
+		}
+	}
+
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// resolve makes a path relative to base absolute
+func resolve(base, path string) string {
+	if path == "" || filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(base, path)
+}
+
+// Validate checks that the config can be run
+func (c *Config) Validate() error {
+	if err := c.Watching.validate(); err != nil {
+		return fmt.Errorf("pipeline config: %w", err)
+	}
+	if len(c.Pipelines) == 0 {
+		return fmt.Errorf("pipeline config: no pipelines")
+	}
+
+	names := make(map[string]bool)
+	for i, p := range c.Pipelines {
+		if p == nil {
+			return fmt.Errorf("pipeline config: pipeline %d is empty", i+1)
+		}
+		if p.Name == "" {
+			p.Name = fmt.Sprintf("pipeline-%d", i+1)
+		}
+		if p.Dir == "" && c.Dir == "" {
+			return fmt.Errorf("pipeline %s: dir is required", p.Name)
+		}
+		if names[p.Name] {
+			return fmt.Errorf("pipeline config: duplicate pipeline %q", p.Name)
+		}
+		names[p.Name] = true
+
+		if err := p.validate(); err != nil {
+			return fmt.Errorf("pipeline %s: %w", p.Name, err)
+		}
+	}
+	return nil
+}
+
+// validate checks a pipeline's tables, profile, outputs and notifications
+func (p *Pipeline) validate() error {
+	if len(p.Tables) == 0 {
+		return fmt.Errorf("no tables")
+	}
+	for _, table := range p.Tables {
+		if strings.ContainsAny(table, `/\`) {
+			return fmt.Errorf("table %q: only file names of the data directory may be given", table)
+		}
+		if _, err := filepath.Match(strings.ToLower(table), ""); err != nil {
+			return fmt.Errorf("table %q: %w", table, err)
+		}
+	}
+	profile, err := converter.ResolveProfile(p.Profile, "")
+	if err != nil {
+		return err
+	}
+
+	if len(p.Outputs) == 0 && len(p.Sinks) == 0 {
+		return fmt.Errorf("no outputs or sinks")
+	}
+	for _, output := range p.Outputs {
+		if !validFormat(output.Format) {
+			return fmt.Errorf("unknown output format %q (use %s)", output.Format, strings.Join(Formats, ", "))
+		}
+		if output.Dir == "" {
+			return fmt.Errorf("output %s: dir is required", output.Format)
+		}
+	}
+
+	for i := range p.Sinks {
+		if err := p.Sinks[i].validate(profile.KeyField); err != nil {
+			return fmt.Errorf("sink %d: %w", i+1, err)
+		}
+	}
+
+	for _, notify := range p.Notify {
+		if err := notify.validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validate checks that a notification has either an http(s) URL or a
+// command
+func (n Notify) validate() error {
+	if (n.URL == "") == (len(n.Command) == 0) {
+		return fmt.Errorf("each notification needs either a url or a command")
+	}
+	if n.URL != "" && !strings.HasPrefix(n.URL, "http://") && !strings.HasPrefix(n.URL, "https://") {
+		return fmt.Errorf("notification url %q is not an http(s) URL", n.URL)
+	}
+	return nil
+}
+
+// validate checks a sink; keyField is the key of a mapping not giving one
+func (s *Sink) validate(keyField string) error {
+	known := false
+	for _, database := range sink.Databases {
+		known = known || s.Database == database
+	}
+	if !known {
+		return fmt.Errorf("unknown database %q (use %s)", s.Database, strings.Join(sink.Databases, " or "))
+	}
+	if (s.DSN == "") == (s.DSNEnv == "") {
+		return fmt.Errorf("either dsn or dsn_env is required")
+	}
+	if s.Key == "" {
+		s.Key = keyField
+	}
+	return s.Mapping.Validate()
+}
+
+// ConnectionString returns the DSN of a sink, read from its environment
+// variable with DSNEnv
+func (s *Sink) ConnectionString() (string, error) {
+	if s.DSNEnv == "" {
+		return s.DSN, nil
+	}
+	dsn := os.Getenv(s.DSNEnv)
+	if dsn == "" {
+		return "", fmt.Errorf("environment variable %s is not set", s.DSNEnv)
+	}
+	return dsn, nil
+}
+
+// String names a sink in the logs: postgres:public.kala
+func (s *Sink) String() string {
+	return s.Database + ":" + s.Table
+}
+
+// validFormat reports whether a format is one of Formats
+func validFormat(format string) bool {
+	for _, f := range Formats {
+		if f == format {
+			return true
+		}
+	}
+	return false
+}
+
+// DataDir returns the data directory of a pipeline
+func (c *Config) DataDir(p *Pipeline) string {
+	if p.Dir != "" {
+		return p.Dir
+	}
+	return c.Dir
+}
+
+// Dirs returns the data directories of the pipelines in order
+func (c *Config) Dirs() []string {
+	var dirs []string
+	seen := make(map[string]bool)
+	for _, p := range c.Pipelines {
+		dir := filepath.Clean(c.DataDir(p))
+		if !seen[dir] {
+			seen[dir] = true
+			dirs = append(dirs, dir)
+		}
+	}
+	return dirs
+}
+
+// Match returns the pipeline of a table file, the first of its directory
+// whose tables match its name
+func (c *Config) Match(path string) *Pipeline {
+	dir := filepath.Clean(filepath.Dir(path))
+	name := strings.ToLower(filepath.Base(path))
+	for _, p := range c.Pipelines {
+		if filepath.Clean(c.DataDir(p)) != dir {
+			continue
+		}
+		for _, table := range p.Tables {
+			if ok, _ := filepath.Match(strings.ToLower(table), name); ok {
+				return p
+			}
+		}
+	}
+	return nil
+}
+
+// validate checks the watcher settings
+func (w *Watching) validate() error {
+	if _, err := watcher.ParseMode(w.WatchMode); err != nil {
+		return err
+	}
+	if _, err := watcher.ParseStrategy(w.ChangeDetection); err != nil {
+		return err
+	}
+	if w.Debounce < 0 || w.MaxWait < 0 || w.PollInterval < 0 || w.Settle < 0 || w.Backoff < 0 || (w.Retries != nil && *w.Retries < 0) {
+		return fmt.Errorf("durations and retries must not be negative")
+	}
+	return nil
+}
+
+// WatchOptions returns the watcher options of the settings
+func (w *Watching) WatchOptions() watcher.Options {
+	mode, _ := watcher.ParseMode(w.WatchMode)
+	strategy, _ := watcher.ParseStrategy(w.ChangeDetection)
+	retry := resilient.Policy{Retries: defaultRetries, InitialBackoff: w.Backoff, MaxBackoff: maxBackoff}
+	if w.Retries != nil {
+		retry.Retries = *w.Retries
+	}
+	if retry.InitialBackoff == 0 {
+		retry.InitialBackoff = defaultBackoff
+	}
+	return watcher.Options{
+		Mode:         mode,
+		PollInterval: w.PollInterval,
+		Settle:       w.Settle,
+		Retry:        retry,
+		Strategy:     strategy,
+		MaxWait:      w.MaxWait,
+	}
+}
+
+// Retries of tables that cannot be read
+const (
+	defaultRetries = 3
+	defaultBackoff = time.Second
+	maxBackoff     = 30 * time.Second
+)
@@ -0,0 +1,33 @@
+package pipeline
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// Health is the state of a watcher's tables as /status serves it
+type Health struct {
+	Healthy bool          `json:"healthy"`
+	Tables  []TableStatus `json:"tables"`
+}
+
+// HealthHandler serves the state of the watcher's tables: /healthz answers
+// 200 while the last run of every table succeeded and 503 otherwise, for
+// load balancers and monitoring; /status returns the Health as JSON
+func (d *DirectoryWatcher) HealthHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		if !d.Healthy() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte("failing\n"))
+			return
+		}
+		w.Write([]byte("ok\n"))
+	})
+	mux.HandleFunc("/status", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(Health{Healthy: d.Healthy(), Tables: d.Status()})
+	})
+	return mux
+}
@@ -0,0 +1,464 @@
+package pipeline
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/atomicdeploy/patris-export/pkg/converter"
+	"github.com/atomicdeploy/patris-export/pkg/datasource"
+	"github.com/atomicdeploy/patris-export/pkg/paradox"
+	"github.com/atomicdeploy/patris-export/pkg/simulate"
+	"github.com/atomicdeploy/patris-export/pkg/sink"
+	"github.com/atomicdeploy/patris-export/pkg/watcher"
+)
+
+// notifyTimeout bounds a notification request or command
+const notifyTimeout = 30 * time.Second
+
+// Export describes a run of a pipeline; it is the body of URL
+// notifications
+type Export struct {
+	Pipeline string    `json:"pipeline"`
+	Table    string    `json:"table"`
+	Hash     string    `json:"sha256,omitempty"`
+	Records  int       `json:"records"`
+	Files    []string  `json:"files"`
+	Sinks    []string  `json:"sinks,omitempty"`
+	Time     time.Time `json:"time"`
+}
+
+// TableStatus is the state of a table's pipeline as of its last run
+type TableStatus struct {
+	Pipeline    string     `json:"pipeline"`
+	Table       string     `json:"table"`
+	Hash        string     `json:"sha256,omitempty"`
+	Records     int        `json:"records"`
+	LastRun     time.Time  `json:"last_run"`
+	LastSuccess *time.Time `json:"last_success,omitempty"`
+	// Failures counts the runs failed since the last success
+	Failures int    `json:"failures"`
+	Error    string `json:"error,omitempty"`
+}
+
+// DirectoryWatcher keeps the tables of data directories exported: each
+// table whose file name a pipeline matches is exported to the pipeline's
+// outputs and synced to its sinks when it changes, and the pipeline's
+// notifications are sent. Tables no pipeline matches are ignored.
+type DirectoryWatcher struct {
+	config *Config
+	fw     *watcher.FileWatcher
+	client *http.Client
+	// simulation records the writes of sinks and notifications instead of
+	// running them when set
+	simulation *simulate.Recorder
+
+	tables
+	// Sinks of each table by pipeline and sink, opened at its first run
+	sinks map[string]*sink.Sink
+	// State of each table's runs by path
+	status map[string]*TableStatus
+}
+
+// NewDirectoryWatcher creates a watcher running the pipelines of config
+func NewDirectoryWatcher(config *Config) (*DirectoryWatcher, error) {
+	fw, err := watcher.New(config.WatchOptions(), config.Dirs()...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create file watcher: %w", err)
+	}
+	return &DirectoryWatcher{
+		config: config,
+		fw:     fw,
+		client: &http.Client{Timeout: notifyTimeout},
+		sinks:  make(map[string]*sink.Sink),
+		status: make(map[string]*TableStatus),
+	}, nil
+}
+
+// Polling reports whether the directories are polled instead of watched
+// through notifications
+func (d *DirectoryWatcher) Polling() bool {
+	return d.fw.Polling()
+}
+
+// SetSimulation records the statements of the sinks and the requests and
+// commands of the notifications with r instead of running them; the
+// outputs are still written. Call it before Start.
+func (d *DirectoryWatcher) SetSimulation(r *simulate.Recorder) {
+	d.simulation = r
+}
+
+// Start exports the matched tables of the directories, then watches them
+// until ctx is done or Close is called. Tables that fail to export are
+// reported and exported again when they change.
+func (d *DirectoryWatcher) Start(ctx context.Context) error {
+	for _, dir := range d.config.Dirs() {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return fmt.Errorf("failed to read data directory: %w", err)
+		}
+		for _, entry := range entries {
+			if !entry.Type().IsRegular() {
+				continue
+			}
+			path := filepath.Join(dir, entry.Name())
+			if d.config.Match(path) == nil {
+				continue
+			}
+			if err := d.Run(path, ""); err != nil {
+				log.Printf("❌ Failed to export %s: %v", entry.Name(), err)
+			}
+		}
+	}
+
+	d.fw.SetRetry(d.config.WatchOptions().Retry, func(event watcher.Event, err error) {
+		log.Printf("❌ Giving up on the change of %s: %v", filepath.Base(event.Path), err)
+	})
+	for _, dir := range d.config.Dirs() {
+		if err := d.fw.WatchEvents(dir, func(event watcher.Event) error {
+			if d.config.Match(event.Path) == nil {
+				return nil
+			}
+			return d.Run(event.Path, event.NewHash)
+		}, d.config.Debounce); err != nil {
+			return fmt.Errorf("failed to watch data directory: %w", err)
+		}
+	}
+	d.fw.Start(ctx)
+	return nil
+}
+
+// Close stops watching, waiting for running exports, and closes the
+// database connections of the sinks
+func (d *DirectoryWatcher) Close() error {
+	err := d.fw.Close()
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for key, target := range d.sinks {
+		target.Close()
+		delete(d.sinks, key)
+	}
+	return err
+}
+
+// Status returns the state of the tables run so far, by path
+func (d *DirectoryWatcher) Status() []TableStatus {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	status := make([]TableStatus, 0, len(d.status))
+	for _, table := range d.status {
+		status = append(status, *table)
+	}
+	sort.Slice(status, func(i, j int) bool { return status[i].Table < status[j].Table })
+	return status
+}
+
+// Healthy reports whether the last run of every table succeeded
+func (d *DirectoryWatcher) Healthy() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, table := range d.status {
+		if table.Failures > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// report records the result of a table's run
+func (d *DirectoryWatcher) report(p *Pipeline, path string, export *Export, err error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	status := d.status[path]
+	if status == nil {
+		status = &TableStatus{Table: path}
+		d.status[path] = status
+	}
+	status.Pipeline = p.Name
+	status.LastRun = time.Now().UTC()
+	if err != nil {
+		status.Failures++
+		status.Error = err.Error()
+		return
+	}
+	status.Hash = export.Hash
+	status.Records = export.Records
+	status.LastSuccess = &status.LastRun
+	status.Failures = 0
+	status.Error = ""
+}
+
+// tables holds the state of a watcher's tables by path; mu also guards the
+// state the watcher keeps besides it
+type tables struct {
+	mu sync.Mutex
+	// Runs of the same table do not overlap
+	locks map[string]*sync.Mutex
+	// Records of each table, read again only when its content changed
+	sources map[string]*datasource.Cached
+}
+
+// lock returns the lock of a table's runs
+func (t *tables) lock(path string) *sync.Mutex {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.locks == nil {
+		t.locks = make(map[string]*sync.Mutex)
+	}
+	if t.locks[path] == nil {
+		t.locks[path] = &sync.Mutex{}
+	}
+	return t.locks[path]
+}
+
+// source returns the cached records of a table
+func (t *tables) source(path string) *datasource.Cached {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.sources == nil {
+		t.sources = make(map[string]*datasource.Cached)
+	}
+	if t.sources[path] == nil {
+		t.sources[path] = datasource.NewCached(path, datasource.Options{}, 0)
+	}
+	return t.sources[path]
+}
+
+// Run exports a table with its pipeline and sends the notifications; hash
+// is the table's SHA-256 when known. It returns the errors of reading the
+// table or writing its sinks, which may succeed later; failed notifications
+// are only logged.
+func (d *DirectoryWatcher) Run(path, hash string) error {
+	p := d.config.Match(path)
+	if p == nil {
+		return fmt.Errorf("no pipeline matches %s", filepath.Base(path))
+	}
+
+	lock := d.lock(path)
+	lock.Lock()
+	defer lock.Unlock()
+
+	source := d.source(path)
+	export, err := d.export(p, path, source)
+	if err == nil {
+		export.Hash = hash
+		if export.Hash == "" {
+			export.Hash = source.Version()
+		}
+	}
+	d.report(p, path, export, err)
+	if err != nil {
+		return err
+	}
+	targets := append(append([]string(nil), export.Files...), export.Sinks...)
+	log.Printf("✅ %s: exported %s (%d records) to %s", p.Name, export.Table, export.Records, strings.Join(targets, ", "))
+
+	for _, notify := range p.Notify {
+		if err := notify.send(d.client, d.simulation, export); err != nil {
+			log.Printf("⚠️  %s: failed to notify %s: %v", p.Name, notify, err)
+		}
+	}
+	return nil
+}
+
+// export writes a table, read through its cached records, to each of the
+// pipeline's outputs and sinks
+func (d *DirectoryWatcher) export(p *Pipeline, path string, db *datasource.Cached) (*Export, error) {
+	records, err := db.GetRecords()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read records: %w", err)
+	}
+	fields, err := db.GetFields()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get fields: %w", err)
+	}
+
+	exp, err := newExporter(p.Profile, path, db)
+	if err != nil {
+		return nil, err
+	}
+
+	export := &Export{
+		Pipeline: p.Name,
+		Table:    filepath.Base(path),
+		Records:  len(records),
+		Time:     time.Now().UTC(),
+	}
+	baseName := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	for _, output := range p.Outputs {
+		file := filepath.Join(output.Dir, baseName+"."+output.Format)
+		if err := writeOutput(exp, records, fields, output.Format, file); err != nil {
+			return nil, err
+		}
+		export.Files = append(export.Files, file)
+	}
+
+	if len(p.Sinks) == 0 {
+		return export, nil
+	}
+	prepared, err := exp.PrepareRecords(records)
+	if err != nil {
+		return nil, err
+	}
+	for i := range p.Sinks {
+		target, err := d.sink(p, i, path)
+		if err != nil {
+			return nil, fmt.Errorf("sink %s: %w", &p.Sinks[i], err)
+		}
+		if _, err := target.Sync(context.Background(), prepared); err != nil {
+			return nil, fmt.Errorf("sink %s: %w", &p.Sinks[i], err)
+		}
+		export.Sinks = append(export.Sinks, p.Sinks[i].String())
+	}
+	return export, nil
+}
+
+// newExporter returns the exporter of a table with a profile, by name or
+// file (empty selects it by file name)
+func newExporter(profileName, path string, db *datasource.Cached) (*converter.Exporter, error) {
+	profile, err := converter.ResolveProfile(profileName, path)
+	if err != nil {
+		return nil, err
+	}
+	convert := converter.Patris2Fa
+	if !db.Encoded() {
+		convert = nil
+	}
+	exp := converter.NewExporter(convert)
+	exp.SetProfile(profile)
+	exp.SetJSONOptions(converter.JSONOptions{Source: path})
+	return exp, nil
+}
+
+// writeOutput exports records to a file in one of Formats, creating its
+// directory
+func writeOutput(exp *converter.Exporter, records []paradox.Record, fields []paradox.Field, format, file string) error {
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return fmt.Errorf("failed to create output directory: %w", err)
+	}
+
+	var err error
+	switch format {
+	case "json":
+		err = exp.ExportToJSON(records, file)
+	case "csv":
+		err = exp.ExportToCSV(records, fields, file)
+	case "yaml":
+		err = exp.ExportToYAML(records, file)
+	case "xlsx":
+		err = exp.ExportToXLSX(records, fields, file)
+	case "sqlite":
+		err = exp.ExportToSQLite(records, fields, file)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to export to %s: %w", format, err)
+	}
+	return nil
+}
+
+// sink returns the i-th sink of a pipeline for a table, connecting to its
+// database at the first call
+func (d *DirectoryWatcher) sink(p *Pipeline, i int, path string) (*sink.Sink, error) {
+	key := fmt.Sprintf("%s\x00%d\x00%s", p.Name, i, path)
+	d.mu.Lock()
+	target := d.sinks[key]
+	d.mu.Unlock()
+	if target != nil {
+		return target, nil
+	}
+
+	config := p.Sinks[i]
+	dsn, err := config.ConnectionString()
+	if err != nil {
+		return nil, err
+	}
+	// Each table's sink holds its own copy of the mapping
+	mapping := config.Mapping
+	target, err = sink.Open(config.Database, dsn, &mapping)
+	if err != nil {
+		return nil, err
+	}
+	if d.simulation != nil {
+		target.SetSimulation(d.simulation)
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.sinks[key] = target
+	return target, nil
+}
+
+// send posts an export to the URL of a notification or runs its command
+// for it; with a simulation, the request or command is recorded instead
+func (notify Notify) send(client *http.Client, simulation *simulate.Recorder, export *Export) error {
+	if notify.URL != "" {
+		body, err := json.Marshal(export)
+		if err != nil {
+			return fmt.Errorf("failed to encode export: %w", err)
+		}
+		if simulation != nil {
+			return simulation.Record(simulate.Operation{
+				Target: notify.String(),
+				Kind:   simulate.KindHTTP,
+				Method: http.MethodPost,
+				URL:    notify.URL,
+				Body:   body,
+			})
+		}
+		resp, err := client.Post(notify.URL, "application/json", bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= 300 {
+			return fmt.Errorf("unexpected status %s", resp.Status)
+		}
+		return nil
+	}
+
+	env := []string{
+		"PATRIS_PIPELINE=" + export.Pipeline,
+		"PATRIS_TABLE=" + export.Table,
+		"PATRIS_SHA256=" + export.Hash,
+		fmt.Sprintf("PATRIS_RECORDS=%d", export.Records),
+		"PATRIS_FILES=" + strings.Join(export.Files, string(os.PathListSeparator)),
+	}
+	if simulation != nil {
+		return simulation.Record(simulate.Operation{
+			Target:  notify.String(),
+			Kind:    simulate.KindCommand,
+			Command: notify.Command,
+			Env:     env,
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), notifyTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, notify.Command[0], notify.Command[1:]...)
+	cmd.Env = append(os.Environ(), env...)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%w: %s", err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// String names a notification in the logs
+func (n Notify) String() string {
+	if n.URL != "" {
+		return n.URL
+	}
+	return strings.Join(n.Command, " ")
+}
@@ -0,0 +1,458 @@
+package pipeline
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/atomicdeploy/patris-export/pkg/simulate"
+)
+
+// writeConfig writes a pipeline config file and returns its path
+func writeConfig(t *testing.T, dir, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, "pipelines.yaml")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+	return path
+}
+
+func TestLoadConfig(t *testing.T) {
+	dir := t.TempDir()
+	path := writeConfig(t, dir, `
+dir: data
+debounce: 500ms
+pipelines:
+  - tables: [kala.db, "moshtari*.db"]
+    outputs:
+      - {format: json, dir: out}
+      - {format: csv, dir: /srv/exports}
+    notify:
+      - url: http://localhost:9000/hook
+`)
+
+	c, err := LoadConfig(path)
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if c.Dir != filepath.Join(dir, "data") {
+		t.Errorf("Expected dir relative to the config file, got %s", c.Dir)
+	}
+	if c.Debounce != 500*time.Millisecond {
+		t.Errorf("Expected a 500ms debounce, got %v", c.Debounce)
+	}
+	p := c.Pipelines[0]
+	if p.Name != "pipeline-1" {
+		t.Errorf("Expected a default name, got %q", p.Name)
+	}
+	if p.Outputs[0].Dir != filepath.Join(dir, "out") || p.Outputs[1].Dir != "/srv/exports" {
+		t.Errorf("Unexpected output dirs %+v", p.Outputs)
+	}
+
+	retry := c.WatchOptions().Retry
+	if retry.Retries != defaultRetries || retry.InitialBackoff != defaultBackoff {
+		t.Errorf("Expected the default retries, got %+v", retry)
+	}
+
+	// Table names match case-insensitively
+	for name, want := range map[string]bool{"KALA.DB": true, "moshtari2.db": true, "anbar.db": false} {
+		if got := c.Match(filepath.Join(c.Dir, name)) != nil; got != want {
+			t.Errorf("Match(%s) = %v, want %v", name, got, want)
+		}
+	}
+}
+
+func TestLoadConfigSinks(t *testing.T) {
+	dir := t.TempDir()
+	c, err := LoadConfig(writeConfig(t, dir, `
+health: 127.0.0.1:9190
+pipelines:
+  - name: stock
+    dir: data
+    tables: [kala.db]
+    sinks:
+      - database: postgres
+        dsn_env: KALA_DSN
+        table: public.kala
+        columns: {Code: code, Name: name}
+        delete: soft
+        soft_delete_column: deleted_at
+  - name: archive
+    dir: /srv/archive
+    tables: ["*.db"]
+    outputs:
+      - {format: json, dir: out}
+`))
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if c.Health != "127.0.0.1:9190" {
+		t.Errorf("Expected the health address, got %q", c.Health)
+	}
+	if dirs := c.Dirs(); len(dirs) != 2 || dirs[0] != filepath.Join(dir, "data") || dirs[1] != filepath.Clean("/srv/archive") {
+		t.Errorf("Expected the pipelines' data directories, got %v", dirs)
+	}
+
+	s := c.Pipelines[0].Sinks[0]
+	if s.Table != "public.kala" || s.Key != "Code" || s.Delete != "soft" || s.BatchSize == 0 {
+		t.Errorf("Expected the inline mapping with defaults, got %+v", s.Mapping)
+	}
+	if s.String() != "postgres:public.kala" {
+		t.Errorf("Unexpected sink name %s", s.String())
+	}
+	if _, err := s.ConnectionString(); err == nil {
+		t.Error("Expected an error without the DSN variable")
+	}
+	t.Setenv("KALA_DSN", "postgres://localhost/erp")
+	if dsn, err := s.ConnectionString(); err != nil || dsn != "postgres://localhost/erp" {
+		t.Errorf("Expected the DSN of the variable, got %q, %v", dsn, err)
+	}
+
+	// Tables match the pipeline of their directory
+	if p := c.Match(filepath.Join(dir, "data", "kala.db")); p == nil || p.Name != "stock" {
+		t.Errorf("Expected kala.db of data to match stock, got %v", p)
+	}
+	if p := c.Match(filepath.Join("/srv/archive", "kala.db")); p == nil || p.Name != "archive" {
+		t.Errorf("Expected kala.db of the archive to match archive, got %v", p)
+	}
+	if p := c.Match(filepath.Join(dir, "data", "anbar.db")); p != nil {
+		t.Errorf("Expected no pipeline for anbar.db, got %s", p.Name)
+	}
+}
+
+func TestLoadConfigInvalid(t *testing.T) {
+	for name, content := range map[string]string{
+		"no dir":       "pipelines: [{tables: [kala.db], outputs: [{format: json, dir: out}]}]",
+		"no pipelines": "dir: data",
+		"no outputs":   "dir: data\npipelines: [{tables: [kala.db]}]",
+		"format":       "dir: data\npipelines: [{tables: [kala.db], outputs: [{format: pdf, dir: out}]}]",
+		"table path":   "dir: data\npipelines: [{tables: [sub/kala.db], outputs: [{format: json, dir: out}]}]",
+		"notify":       "dir: data\npipelines: [{tables: [kala.db], outputs: [{format: json, dir: out}], notify: [{}]}]",
+		"duplicate":    "dir: data\npipelines: [{name: a, tables: [kala.db], outputs: [{format: json, dir: out}]}, {name: a, tables: [x.db], outputs: [{format: json, dir: out}]}]",
+		"watch mode":   "dir: data\nwatch_mode: inotify\npipelines: [{tables: [kala.db], outputs: [{format: json, dir: out}]}]",
+		"database":     "dir: data\npipelines: [{tables: [kala.db], sinks: [{database: mysql, dsn: x, table: kala, columns: {Code: code}}]}]",
+		"dsn":          "dir: data\npipelines: [{tables: [kala.db], sinks: [{database: postgres, table: kala, columns: {Code: code}}]}]",
+		"mapping":      "dir: data\npipelines: [{tables: [kala.db], sinks: [{database: postgres, dsn: x, table: kala, columns: {Name: name}}]}]",
+	} {
+		if _, err := LoadConfig(writeConfig(t, t.TempDir(), content)); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestRun(t *testing.T) {
+	data, err := os.ReadFile("../../testdata/kala.db")
+	if err != nil {
+		t.Fatalf("Failed to read test table: %v", err)
+	}
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "data"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	table := filepath.Join(dir, "data", "kala.db")
+	if err := os.WriteFile(table, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	exports := make(chan Export, 1)
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var export Export
+		if err := json.NewDecoder(r.Body).Decode(&export); err != nil {
+			t.Errorf("Invalid notification: %v", err)
+		}
+		exports <- export
+	}))
+	defer hook.Close()
+
+	c, err := LoadConfig(writeConfig(t, dir, `
+dir: data
+pipelines:
+  - name: stock
+    tables: ["*.db"]
+    outputs:
+      - {format: json, dir: out}
+      - {format: csv, dir: out}
+    notify:
+      - url: `+hook.URL+`
+`))
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	dw, err := NewDirectoryWatcher(c)
+	if err != nil {
+		t.Fatalf("NewDirectoryWatcher failed: %v", err)
+	}
+	defer dw.Close()
+
+	if err := dw.Run(table, "abc"); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+
+	for _, name := range []string{"kala.json", "kala.csv"} {
+		if _, err := os.Stat(filepath.Join(dir, "out", name)); err != nil {
+			t.Errorf("Expected %s to be exported: %v", name, err)
+		}
+	}
+	select {
+	case export := <-exports:
+		if export.Pipeline != "stock" || export.Table != "kala.db" || export.Hash != "abc" || export.Records == 0 || len(export.Files) != 2 {
+			t.Errorf("Unexpected notification %+v", export)
+		}
+	default:
+		t.Error("Expected a notification")
+	}
+
+	health := httptest.NewServer(dw.HealthHandler())
+	defer health.Close()
+	if resp, err := http.Get(health.URL + "/healthz"); err != nil || resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected a healthy watcher, got %v, %v", resp, err)
+	}
+
+	// A table that cannot be read fails
+	if err := os.WriteFile(table, []byte("not a table"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := dw.Run(table, ""); err == nil || !strings.Contains(err.Error(), "failed to open database") {
+		t.Errorf("Expected an error reading the table, got %v", err)
+	}
+
+	if resp, err := http.Get(health.URL + "/healthz"); err != nil || resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("Expected an unhealthy watcher, got %v, %v", resp, err)
+	}
+	resp, err := http.Get(health.URL + "/status")
+	if err != nil {
+		t.Fatalf("Failed to get status: %v", err)
+	}
+	defer resp.Body.Close()
+	var status Health
+	if err := json.NewDecoder(resp.Body).Decode(&status); err != nil {
+		t.Fatalf("Invalid status: %v", err)
+	}
+	if status.Healthy || len(status.Tables) != 1 {
+		t.Fatalf("Expected one failing table, got %+v", status)
+	}
+	got := status.Tables[0]
+	if got.Pipeline != "stock" || got.Failures != 1 || got.Error == "" || got.LastSuccess == nil || got.Hash != "abc" || got.Records == 0 {
+		t.Errorf("Unexpected table status %+v", got)
+	}
+}
+
+func TestLoadWatchConfig(t *testing.T) {
+	dir := t.TempDir()
+	c, err := LoadWatchConfig(writeConfig(t, dir, `
+debounce: 1s
+files:
+  - path: data/kala.db
+    actions:
+      - convert: out/kala.yml
+      - url: http://localhost:9000/hook
+  - name: customers
+    path: /srv/patris/moshtari*.db
+    profile: moshtari
+    actions:
+      - {convert: "exports/{table}.txt", format: csv}
+`))
+	if err != nil {
+		t.Fatalf("LoadWatchConfig failed: %v", err)
+	}
+	if c.Debounce != time.Second {
+		t.Errorf("Expected a 1s debounce, got %v", c.Debounce)
+	}
+
+	kala := c.Files[0]
+	if kala.Name != "kala.db" || kala.Path != filepath.Join(dir, "data", "kala.db") || kala.Glob() {
+		t.Errorf("Unexpected file %+v", kala)
+	}
+	if action := kala.Actions[0]; action.Convert != filepath.Join(dir, "out", "kala.yml") || action.Format != "yaml" {
+		t.Errorf("Expected a YAML conversion relative to the config file, got %+v", action)
+	}
+
+	customers := c.Files[1]
+	if !customers.Glob() || customers.Actions[0].Format != "csv" {
+		t.Errorf("Unexpected file %+v", customers)
+	}
+	if out := customers.Actions[0].Output("/srv/patris/moshtari2.db"); out != filepath.Join(dir, "exports", "moshtari2.txt") {
+		t.Errorf("Expected the table in the output path, got %s", out)
+	}
+}
+
+func TestLoadWatchConfigInvalid(t *testing.T) {
+	for name, content := range map[string]string{
+		"no files":     "debounce: 1s",
+		"no path":      "files: [{actions: [{convert: kala.json}]}]",
+		"no actions":   "files: [{path: kala.db}]",
+		"empty action": "files: [{path: kala.db, actions: [{}]}]",
+		"two actions":  "files: [{path: kala.db, actions: [{convert: kala.json, url: 'http://localhost/hook'}]}]",
+		"format":       "files: [{path: kala.db, actions: [{convert: kala.pdf}]}]",
+		"url":          "files: [{path: kala.db, actions: [{url: 'ftp://localhost/hook'}]}]",
+		"glob output":  "files: [{path: '*.db', actions: [{convert: out.json}]}]",
+		"glob dir":     "files: [{path: '*/kala.db', actions: [{convert: out.json}]}]",
+		"watch mode":   "watch_mode: inotify\nfiles: [{path: kala.db, actions: [{convert: kala.json}]}]",
+		"profile":      "files: [{path: kala.db, profile: missing.yaml, actions: [{convert: kala.json}]}]",
+	} {
+		if _, err := LoadWatchConfig(writeConfig(t, t.TempDir(), content)); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestWatcherRun(t *testing.T) {
+	data, err := os.ReadFile("../../testdata/kala.db")
+	if err != nil {
+		t.Fatalf("Failed to read test table: %v", err)
+	}
+	dir := t.TempDir()
+	table := filepath.Join(dir, "kala.db")
+	if err := os.WriteFile(table, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	exports := make(chan Export, 1)
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var export Export
+		if err := json.NewDecoder(r.Body).Decode(&export); err != nil {
+			t.Errorf("Invalid notification: %v", err)
+		}
+		exports <- export
+	}))
+	defer hook.Close()
+
+	c, err := LoadWatchConfig(writeConfig(t, dir, `
+files:
+  - name: stock
+    path: "*.db"
+    actions:
+      - convert: "out/{table}.json"
+      - url: `+hook.URL+`
+      - convert: "out/{table}.csv"
+`))
+	if err != nil {
+		t.Fatalf("LoadWatchConfig failed: %v", err)
+	}
+	w, err := NewWatcher(c)
+	if err != nil {
+		t.Fatalf("NewWatcher failed: %v", err)
+	}
+	defer w.Close()
+
+	if err := w.Run(c.Files[0], table, "abc"); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	for _, name := range []string{"kala.json", "kala.csv"} {
+		if _, err := os.Stat(filepath.Join(dir, "out", name)); err != nil {
+			t.Errorf("Expected %s to be converted: %v", name, err)
+		}
+	}
+	// The notification tells of the files converted before it
+	select {
+	case export := <-exports:
+		if export.Pipeline != "stock" || export.Table != "kala.db" || export.Hash != "abc" || export.Records == 0 || len(export.Files) != 1 {
+			t.Errorf("Unexpected notification %+v", export)
+		}
+	default:
+		t.Error("Expected a notification")
+	}
+
+	if err := os.WriteFile(table, []byte("not a table"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Run(c.Files[0], table, ""); err == nil {
+		t.Error("Expected an error reading the table")
+	}
+	select {
+	case export := <-exports:
+		t.Errorf("Expected no notification for a failed run, got %+v", export)
+	default:
+	}
+}
+
+func TestWatcherRunSimulation(t *testing.T) {
+	data, err := os.ReadFile("../../testdata/kala.db")
+	if err != nil {
+		t.Fatalf("Failed to read test table: %v", err)
+	}
+	dir := t.TempDir()
+	table := filepath.Join(dir, "kala.db")
+	if err := os.WriteFile(table, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("Expected no request in a simulation")
+	}))
+	defer hook.Close()
+
+	marker := filepath.Join(dir, "notified")
+	c, err := LoadWatchConfig(writeConfig(t, dir, `
+files:
+  - name: stock
+    path: kala.db
+    actions:
+      - convert: out/kala.json
+      - url: `+hook.URL+`
+      - command: [touch, `+marker+`]
+`))
+	if err != nil {
+		t.Fatalf("LoadWatchConfig failed: %v", err)
+	}
+	w, err := NewWatcher(c)
+	if err != nil {
+		t.Fatalf("NewWatcher failed: %v", err)
+	}
+	defer w.Close()
+
+	path := filepath.Join(dir, "simulation.jsonl")
+	recorder, err := simulate.Open(path)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	w.SetSimulation(recorder)
+	if err := w.Run(c.Files[0], table, "abc"); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	recorder.Close()
+
+	// Conversions are still written, notifications only recorded
+	if _, err := os.Stat(filepath.Join(dir, "out", "kala.json")); err != nil {
+		t.Errorf("Expected kala.json to be converted: %v", err)
+	}
+	if _, err := os.Stat(marker); !os.IsNotExist(err) {
+		t.Errorf("Expected the command not to run, got %v", err)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("Failed to open simulation file: %v", err)
+	}
+	defer file.Close()
+	var ops []simulate.Operation
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var op simulate.Operation
+		if err := json.Unmarshal(scanner.Bytes(), &op); err != nil {
+			t.Fatalf("Invalid JSON line %q: %v", scanner.Text(), err)
+		}
+		ops = append(ops, op)
+	}
+	if len(ops) != 2 {
+		t.Fatalf("Expected 2 operations, got %+v", ops)
+	}
+
+	var export Export
+	if err := json.Unmarshal(ops[0].Body, &export); err != nil {
+		t.Fatalf("Invalid request body: %v", err)
+	}
+	if ops[0].Kind != simulate.KindHTTP || ops[0].Method != http.MethodPost || ops[0].URL != hook.URL || export.Hash != "abc" || len(export.Files) != 1 {
+		t.Errorf("Unexpected request %+v", ops[0])
+	}
+	if ops[1].Kind != simulate.KindCommand || strings.Join(ops[1].Command, " ") != "touch "+marker || !strings.Contains(strings.Join(ops[1].Env, " "), "PATRIS_SHA256=abc") {
+		t.Errorf("Unexpected command %+v", ops[1])
+	}
+}
@@ -0,0 +1,307 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/atomicdeploy/patris-export/pkg/converter"
+	"github.com/atomicdeploy/patris-export/pkg/resilient"
+	"github.com/atomicdeploy/patris-export/pkg/simulate"
+	"github.com/atomicdeploy/patris-export/pkg/watcher"
+	"gopkg.in/yaml.v3"
+)
+
+// tablePlaceholder is replaced in convert paths by the table's file name
+// without extension
+const tablePlaceholder = "{table}"
+
+// WatchConfig lists database files to watch and the actions run each time
+// one of them changes
+type WatchConfig struct {
+	Watching `yaml:",inline"`
+
+	Files []*WatchedFile `yaml:"files" json:"files"`
+}
+
+// WatchedFile is a database file, or a glob of them, and its actions
+type WatchedFile struct {
+	// Name names the file in the logs and notifications (default: the
+	// file name of Path)
+	Name string `yaml:"name,omitempty" json:"name,omitempty"`
+	// Path is the file or a glob of file names (e.g. data/*.db); a relative
+	// path is relative to the config file
+	Path string `yaml:"path" json:"path"`
+	// Profile is a built-in profile name or profile file (default: selected
+	// by file name)
+	Profile string   `yaml:"profile,omitempty" json:"profile,omitempty"`
+	Actions []Action `yaml:"actions" json:"actions"`
+}
+
+// Action is run when a watched file changes: a conversion of the table to a
+// file, or a notification of the files converted by the actions before it
+type Action struct {
+	// Convert is the file to export the table to; {table} is replaced by
+	// the table's file name without extension, and a relative path is
+	// relative to the config file
+	Convert string `yaml:"convert,omitempty" json:"convert,omitempty"`
+	// Format is one of Formats (default: given by the extension of Convert)
+	Format string `yaml:"format,omitempty" json:"format,omitempty"`
+
+	Notify `yaml:",inline"`
+}
+
+// LoadWatchConfig loads a watch config from a YAML (or JSON) file
+func LoadWatchConfig(path string) (*WatchConfig, error) {
+	data, err := resilient.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read watch config: %w", err)
+	}
+
+	c := &WatchConfig{}
+	if err := yaml.Unmarshal(data, c); err != nil {
+		return nil, fmt.Errorf("failed to parse watch config %s: %w", path, err)
+	}
+
+	base := filepath.Dir(path)
+	for _, f := range c.Files {
+		if f == nil {
+			continue
+		}
+		f.Path = resolve(base, f.Path)
+		if _, builtin := converter.LookupProfile(f.Profile); !builtin && f.Profile != converter.DefaultProfile.Name {
+			f.Profile = resolve(base, f.Profile)
+		}
+		for i := range f.Actions {
+			f.Actions[i].Convert = resolve(base, f.Actions[i].Convert)
+		}
+	}
+
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Validate checks that the config can be run
+func (c *WatchConfig) Validate() error {
+	if err := c.Watching.validate(); err != nil {
+		return fmt.Errorf("watch config: %w", err)
+	}
+	if len(c.Files) == 0 {
+		return fmt.Errorf("watch config: no files")
+	}
+
+	for i, f := range c.Files {
+		if f == nil || f.Path == "" {
+			return fmt.Errorf("watch config: file %d has no path", i+1)
+		}
+		if f.Name == "" {
+			f.Name = filepath.Base(f.Path)
+		}
+		if err := f.validate(); err != nil {
+			return fmt.Errorf("file %s: %w", f.Name, err)
+		}
+	}
+	return nil
+}
+
+// Glob reports whether the file is a glob of file names
+func (f *WatchedFile) Glob() bool {
+	return strings.ContainsAny(f.Path, "*?[")
+}
+
+// validate checks a watched file's path, profile and actions
+func (f *WatchedFile) validate() error {
+	if f.Glob() {
+		if strings.ContainsAny(filepath.Dir(f.Path), "*?[") {
+			return fmt.Errorf("only file names may contain wildcards")
+		}
+		if _, err := filepath.Match(filepath.Base(f.Path), ""); err != nil {
+			return err
+		}
+	}
+	if _, err := converter.ResolveProfile(f.Profile, ""); err != nil {
+		return err
+	}
+
+	if len(f.Actions) == 0 {
+		return fmt.Errorf("no actions")
+	}
+	for i := range f.Actions {
+		action := &f.Actions[i]
+		given := 0
+		for _, set := range []bool{action.Convert != "", action.URL != "", len(action.Command) > 0} {
+			if set {
+				given++
+			}
+		}
+		if given != 1 {
+			return fmt.Errorf("action %d: give one of convert, url or command", i+1)
+		}
+		if action.Convert == "" {
+			if err := action.Notify.validate(); err != nil {
+				return fmt.Errorf("action %d: %w", i+1, err)
+			}
+			continue
+		}
+
+		if action.Format == "" {
+			action.Format = strings.ToLower(strings.TrimPrefix(filepath.Ext(action.Convert), "."))
+			if action.Format == "yml" {
+				action.Format = "yaml"
+			}
+		}
+		if !validFormat(action.Format) {
+			return fmt.Errorf("action %d: unknown format %q (use %s)", i+1, action.Format, strings.Join(Formats, ", "))
+		}
+		if f.Glob() && !strings.Contains(action.Convert, tablePlaceholder) {
+			return fmt.Errorf("action %d: the convert path of a glob must contain %s", i+1, tablePlaceholder)
+		}
+	}
+	return nil
+}
+
+// Output returns the file an action converts a table to
+func (a *Action) Output(path string) string {
+	table := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	return strings.ReplaceAll(a.Convert, tablePlaceholder, table)
+}
+
+// Paths returns the watched files and globs in order
+func (c *WatchConfig) Paths() []string {
+	paths := make([]string, len(c.Files))
+	for i, f := range c.Files {
+		paths[i] = f.Path
+	}
+	return paths
+}
+
+// Watcher runs the actions of watched database files: each file is
+// converted and its notifications are sent at start and whenever it
+// changes
+type Watcher struct {
+	config *WatchConfig
+	fw     *watcher.FileWatcher
+	client *http.Client
+	// simulation records the notifications instead of sending them when set
+	simulation *simulate.Recorder
+
+	tables
+}
+
+// NewWatcher creates a watcher running the actions of config
+func NewWatcher(config *WatchConfig) (*Watcher, error) {
+	fw, err := watcher.New(config.WatchOptions(), config.Paths()...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create file watcher: %w", err)
+	}
+	return &Watcher{
+		config: config,
+		fw:     fw,
+		client: &http.Client{Timeout: notifyTimeout},
+	}, nil
+}
+
+// Polling reports whether the files are polled instead of watched through
+// notifications
+func (w *Watcher) Polling() bool {
+	return w.fw.Polling()
+}
+
+// SetSimulation records the requests and commands of the notifications
+// with r instead of running them; the conversions are still written. Call
+// it before Start.
+func (w *Watcher) SetSimulation(r *simulate.Recorder) {
+	w.simulation = r
+}
+
+// Start runs the actions of the existing files, then watches them until
+// ctx is done or Close is called. Files that fail to convert are reported
+// and converted again when they change.
+func (w *Watcher) Start(ctx context.Context) error {
+	for _, f := range w.config.Files {
+		paths := []string{f.Path}
+		if f.Glob() {
+			paths, _ = filepath.Glob(f.Path)
+		}
+		for _, path := range paths {
+			if err := w.Run(f, path, ""); err != nil {
+				log.Printf("❌ %s: failed to convert %s: %v", f.Name, filepath.Base(path), err)
+			}
+		}
+	}
+
+	w.fw.SetRetry(w.config.WatchOptions().Retry, func(event watcher.Event, err error) {
+		log.Printf("❌ Giving up on the change of %s: %v", filepath.Base(event.Path), err)
+	})
+	for _, f := range w.config.Files {
+		if err := w.fw.WatchEvents(f.Path, func(event watcher.Event) error {
+			return w.Run(f, event.Path, event.NewHash)
+		}, w.config.Debounce); err != nil {
+			return fmt.Errorf("failed to watch %s: %w", f.Path, err)
+		}
+	}
+	w.fw.Start(ctx)
+	return nil
+}
+
+// Close stops watching, waiting for running actions
+func (w *Watcher) Close() error {
+	return w.fw.Close()
+}
+
+// Run runs the actions of a watched file for one of its tables in order;
+// hash is the table's SHA-256 when known. It returns the errors of reading
+// the table or converting it, which stop its actions and may succeed later;
+// failed notifications are only logged.
+func (w *Watcher) Run(f *WatchedFile, path, hash string) error {
+	lock := w.lock(path)
+	lock.Lock()
+	defer lock.Unlock()
+
+	db := w.source(path)
+	records, err := db.GetRecords()
+	if err != nil {
+		return fmt.Errorf("failed to read records: %w", err)
+	}
+	fields, err := db.GetFields()
+	if err != nil {
+		return fmt.Errorf("failed to get fields: %w", err)
+	}
+	exp, err := newExporter(f.Profile, path, db)
+	if err != nil {
+		return err
+	}
+
+	export := &Export{
+		Pipeline: f.Name,
+		Table:    filepath.Base(path),
+		Hash:     hash,
+		Records:  len(records),
+		Time:     time.Now().UTC(),
+	}
+	if export.Hash == "" {
+		export.Hash = db.Version()
+	}
+	for _, action := range f.Actions {
+		if action.Convert == "" {
+			if err := action.Notify.send(w.client, w.simulation, export); err != nil {
+				log.Printf("⚠️  %s: failed to notify %s: %v", f.Name, action.Notify, err)
+			}
+			continue
+		}
+
+		file := action.Output(path)
+		if err := writeOutput(exp, records, fields, action.Format, file); err != nil {
+			return err
+		}
+		export.Files = append(export.Files, file)
+		log.Printf("✅ %s: converted %s (%d records) to %s", f.Name, export.Table, export.Records, file)
+	}
+	return nil
+}
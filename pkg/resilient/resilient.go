@@ -0,0 +1,231 @@
+package resilient
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Policy configures how filesystem operations are retried
+type Policy struct {
+	// Retries is the number of additional attempts after the first failure
+	Retries int
+	// InitialBackoff is the delay before the first retry; it doubles on each retry
+	InitialBackoff time.Duration
+	// MaxBackoff caps the delay between retries
+	MaxBackoff time.Duration
+	// Timeout bounds a single attempt (0 disables). Operations that hang on a
+	// dead network share are abandoned and retried instead of blocking forever.
+	Timeout time.Duration
+}
+
+// DefaultPolicy is tuned for SMB shares that drop connections for a few seconds
+var DefaultPolicy = Policy{
+	Retries:        3,
+	InitialBackoff: 200 * time.Millisecond,
+	MaxBackoff:     5 * time.Second,
+	Timeout:        0,
+}
+
+// ErrTimeout is returned when an attempt exceeds the policy timeout
+var ErrTimeout = errors.New("operation timed out")
+
+var (
+	policyMu      sync.RWMutex
+	defaultPolicy = DefaultPolicy
+)
+
+// SetDefaultPolicy sets the policy used by Do, Open and ReadFile
+func SetDefaultPolicy(p Policy) {
+	policyMu.Lock()
+	defer policyMu.Unlock()
+	defaultPolicy = p
+}
+
+// GetDefaultPolicy returns the policy used by Do, Open and ReadFile
+func GetDefaultPolicy() Policy {
+	policyMu.RLock()
+	defer policyMu.RUnlock()
+	return defaultPolicy
+}
+
+// Metrics counts filesystem operations performed through this package
+type Metrics struct {
+	Operations int64 `json:"operations"`
+	Attempts   int64 `json:"attempts"`
+	Retries    int64 `json:"retries"`
+	Timeouts   int64 `json:"timeouts"`
+	Failures   int64 `json:"failures"`
+}
+
+var metrics struct {
+	operations, attempts, retries, timeouts, failures atomic.Int64
+}
+
+// Stats returns a snapshot of the operation counters
+func Stats() Metrics {
+	return Metrics{
+		Operations: metrics.operations.Load(),
+		Attempts:   metrics.attempts.Load(),
+		Retries:    metrics.retries.Load(),
+		Timeouts:   metrics.timeouts.Load(),
+		Failures:   metrics.failures.Load(),
+	}
+}
+
+// permanentError marks an error that must not be retried
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Permanent wraps an error so Do returns it immediately without retrying
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+// Retryable reports whether an error may succeed on a later attempt.
+// Missing files and permission errors are not transient.
+func Retryable(err error) bool {
+	var perm *permanentError
+	if errors.As(err, &perm) {
+		return false
+	}
+	return !errors.Is(err, fs.ErrNotExist) && !errors.Is(err, fs.ErrPermission)
+}
+
+// Do runs fn with the default policy
+func Do(op string, fn func() error) error {
+	_, err := DoValue(op, func() (struct{}, error) {
+		return struct{}{}, fn()
+	})
+	return err
+}
+
+// DoValue runs fn with the default policy and returns its result
+func DoValue[T any](op string, fn func() (T, error)) (T, error) {
+	return DoValueWithPolicy(GetDefaultPolicy(), op, fn)
+}
+
+// DoValueWithPolicy runs fn, retrying transient failures with exponential backoff
+func DoValueWithPolicy[T any](p Policy, op string, fn func() (T, error)) (T, error) {
+	metrics.operations.Add(1)
+
+	backoff := p.InitialBackoff
+	var result T
+	var err error
+
+	for attempt := 0; ; attempt++ {
+		metrics.attempts.Add(1)
+
+		result, err = runAttempt(p.Timeout, fn)
+		if err == nil {
+			return result, nil
+		}
+
+		if attempt >= p.Retries || !Retryable(err) {
+			break
+		}
+
+		metrics.retries.Add(1)
+		log.Printf("⚠️  %s failed (attempt %d/%d): %v; retrying in %v", op, attempt+1, p.Retries+1, err, backoff)
+		time.Sleep(backoff)
+
+		backoff *= 2
+		if p.MaxBackoff > 0 && backoff > p.MaxBackoff {
+			backoff = p.MaxBackoff
+		}
+	}
+
+	metrics.failures.Add(1)
+
+	var perm *permanentError
+	if errors.As(err, &perm) {
+		return result, perm.err
+	}
+	return result, err
+}
+
+// runAttempt runs fn once, giving up after timeout if one is set.
+// A result that arrives after the timeout is closed if it is an io.Closer.
+func runAttempt[T any](timeout time.Duration, fn func() (T, error)) (T, error) {
+	if timeout <= 0 {
+		return fn()
+	}
+
+	type outcome struct {
+		value T
+		err   error
+	}
+
+	done := make(chan outcome, 1)
+	go func() {
+		value, err := fn()
+		done <- outcome{value, err}
+	}()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case out := <-done:
+		return out.value, out.err
+	case <-timer.C:
+		metrics.timeouts.Add(1)
+		go func() {
+			if out := <-done; out.err == nil {
+				if closer, ok := any(out.value).(io.Closer); ok {
+					closer.Close()
+				}
+			}
+		}()
+		var zero T
+		return zero, fmt.Errorf("%w after %v", ErrTimeout, timeout)
+	}
+}
+
+// Open opens a file for reading with the default retry policy
+func Open(path string) (*os.File, error) {
+	return DoValue("open "+path, func() (*os.File, error) {
+		return os.Open(path)
+	})
+}
+
+// HashFile returns the hex digest of a file with a hash from newHash,
+// reading the whole file again with the default retry policy when opening
+// or reading it fails
+func HashFile(path string, newHash func() hash.Hash) (string, error) {
+	return DoValue("hash "+path, func() (string, error) {
+		file, err := os.Open(path)
+		if err != nil {
+			return "", err
+		}
+		defer file.Close()
+
+		h := newHash()
+		if _, err := io.Copy(h, file); err != nil {
+			return "", err
+		}
+		return hex.EncodeToString(h.Sum(nil)), nil
+	})
+}
+
+// ReadFile reads a whole file with the default retry policy
+func ReadFile(path string) ([]byte, error) {
+	return DoValue("read "+path, func() ([]byte, error) {
+		return os.ReadFile(path)
+	})
+}
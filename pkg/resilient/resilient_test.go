@@ -0,0 +1,105 @@
+package resilient
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+var testPolicy = Policy{
+	Retries:        3,
+	InitialBackoff: time.Millisecond,
+	MaxBackoff:     5 * time.Millisecond,
+}
+
+func TestRetriesTransientFailures(t *testing.T) {
+	calls := 0
+	value, err := DoValueWithPolicy(testPolicy, "flaky read", func() (int, error) {
+		calls++
+		if calls < 3 {
+			return 0, errors.New("network name is no longer available")
+		}
+		return 42, nil
+	})
+
+	if err != nil {
+		t.Fatalf("Expected success after retries, got: %v", err)
+	}
+	if value != 42 || calls != 3 {
+		t.Errorf("Expected value 42 after 3 calls, got %d after %d calls", value, calls)
+	}
+}
+
+func TestGivesUpAfterRetries(t *testing.T) {
+	calls := 0
+	_, err := DoValueWithPolicy(testPolicy, "broken read", func() (int, error) {
+		calls++
+		return 0, errors.New("still broken")
+	})
+
+	if err == nil {
+		t.Fatal("Expected error after exhausting retries")
+	}
+	if calls != testPolicy.Retries+1 {
+		t.Errorf("Expected %d attempts, got %d", testPolicy.Retries+1, calls)
+	}
+}
+
+func TestDoesNotRetryPermanentErrors(t *testing.T) {
+	sentinel := errors.New("unsupported format")
+
+	calls := 0
+	_, err := DoValueWithPolicy(testPolicy, "parse", func() (int, error) {
+		calls++
+		return 0, Permanent(sentinel)
+	})
+
+	if !errors.Is(err, sentinel) || calls != 1 {
+		t.Errorf("Expected one attempt returning the sentinel, got %d attempts: %v", calls, err)
+	}
+
+	missing := filepath.Join(t.TempDir(), "missing.db")
+	calls = 0
+	_, err = DoValueWithPolicy(testPolicy, "open", func() (*os.File, error) {
+		calls++
+		return os.Open(missing)
+	})
+
+	if !errors.Is(err, os.ErrNotExist) || calls != 1 {
+		t.Errorf("Expected a single attempt for a missing file, got %d attempts: %v", calls, err)
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	policy := testPolicy
+	policy.Retries = 0
+	policy.Timeout = 10 * time.Millisecond
+
+	_, err := DoValueWithPolicy(policy, "hanging read", func() (int, error) {
+		time.Sleep(200 * time.Millisecond)
+		return 1, nil
+	})
+
+	if !errors.Is(err, ErrTimeout) {
+		t.Errorf("Expected ErrTimeout, got: %v", err)
+	}
+}
+
+func TestHashFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "kala.db")
+	os.WriteFile(path, []byte("records"), 0644)
+
+	sum := sha256.Sum256([]byte("records"))
+	hash, err := HashFile(path, sha256.New)
+	if err != nil || hash != hex.EncodeToString(sum[:]) {
+		t.Errorf("Expected the SHA-256 of the file, got %q, %v", hash, err)
+	}
+
+	if _, err := HashFile(filepath.Join(t.TempDir(), "missing.db"), sha256.New); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Expected a missing file error, got: %v", err)
+	}
+}
@@ -0,0 +1,45 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAllowedNetworks(t *testing.T) {
+	s := newTestServer(t)
+	if err := s.SetAllowedNetworks([]string{"192.168.1.0/24", " 10.0.0.7 ", "fd00::/8"}); err != nil {
+		t.Fatalf("SetAllowedNetworks failed: %v", err)
+	}
+
+	tests := []struct {
+		remote string
+		status int
+	}{
+		{"192.168.1.20:5000", http.StatusOK},
+		{"[::ffff:192.168.1.20]:5000", http.StatusOK},
+		{"10.0.0.7:5000", http.StatusOK},
+		{"[fd00::1%eth0]:5000", http.StatusOK},
+		{"10.0.0.8:5000", http.StatusForbidden},
+		{"192.168.2.1:5000", http.StatusForbidden},
+		{"[2001:db8::1]:5000", http.StatusForbidden},
+		{"not-an-address", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/api/records/101", nil)
+		r.RemoteAddr = tt.remote
+		if w := serve(s, r); w.Code != tt.status {
+			t.Errorf("Client %s: expected %d, got %d", tt.remote, tt.status, w.Code)
+		}
+	}
+
+	if err := s.SetAllowedNetworks([]string{"192.168.1.0/33"}); err == nil {
+		t.Error("Expected an error for an invalid network")
+	}
+	if err := s.SetAllowedNetworks(nil); err != nil {
+		t.Fatalf("SetAllowedNetworks failed: %v", err)
+	}
+	if w := serve(s, httptest.NewRequest("GET", "/api/records/101", nil)); w.Code != http.StatusOK {
+		t.Errorf("Expected any client allowed without networks, got %d", w.Code)
+	}
+}
@@ -0,0 +1,181 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/atomicdeploy/patris-export/pkg/annotations"
+	"github.com/atomicdeploy/patris-export/pkg/converter"
+	"github.com/gorilla/mux"
+)
+
+// annotationField is the record field carrying a record's annotation. The
+// underscore keeps it apart from the table's own fields.
+const annotationField = "_annotation"
+
+// maxAnnotationBody limits the size of annotation requests
+const maxAnnotationBody = 64 << 10
+
+// SetAnnotations stores record annotations in the JSON file at path and
+// merges them into the served records. The database is never written.
+func (s *Server) SetAnnotations(path string) error {
+	store, err := annotations.Open(path)
+	if err != nil {
+		return err
+	}
+	s.notes = store
+	return nil
+}
+
+// annotate returns the records with the annotations added to the records
+// they belong to. Annotated records are copied, as the records may be
+// shared with the cache.
+func (s *Server) annotate(records map[string]interface{}) map[string]interface{} {
+	if s.notes == nil || s.notes.Len() == 0 {
+		return records
+	}
+
+	annotated := make(map[string]interface{}, len(records))
+	for code, record := range records {
+		annotated[code] = record
+	}
+	for code, a := range s.notes.All() {
+		record, ok := records[code].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		copied := make(map[string]interface{}, len(record)+1)
+		for key, value := range record {
+			copied[key] = value
+		}
+		copied[annotationField] = a
+		annotated[code] = copied
+	}
+	return annotated
+}
+
+// annotationsEnabled writes 404 Not Found if annotations are not enabled
+func (s *Server) annotationsEnabled(w http.ResponseWriter) bool {
+	if s.notes == nil {
+		http.Error(w, "Annotations are not enabled", http.StatusNotFound)
+		return false
+	}
+	return true
+}
+
+// handleListAnnotations returns all annotations keyed by record code
+func (s *Server) handleListAnnotations(w http.ResponseWriter, r *http.Request) {
+	if !s.annotationsEnabled(w) {
+		return
+	}
+
+	all := s.notes.All()
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":     true,
+		"count":       len(all),
+		"annotations": all,
+	})
+}
+
+// handleSetAnnotation stores the note and tags of a record, replacing its
+// previous annotation, and broadcasts the annotated record
+func (s *Server) handleSetAnnotation(w http.ResponseWriter, r *http.Request) {
+	if !s.annotationsEnabled(w) {
+		return
+	}
+
+	var a annotations.Annotation
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxAnnotationBody))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&a); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid annotation: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	code, ok, err := s.recordCode(mux.Vars(r)["code"])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		http.Error(w, fmt.Sprintf("Record not found: %s", code), http.StatusNotFound)
+		return
+	}
+
+	stored, err := s.notes.Set(code, a)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, annotations.ErrInvalid) {
+			status = http.StatusBadRequest
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+	s.log().Info("annotation set", "request_id", RequestID(r.Context()), "code", code, "tags", stored.Tags)
+	s.handleChange("annotation")
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":    true,
+		"code":       code,
+		"annotation": stored,
+	})
+}
+
+// handleDeleteAnnotation removes the annotation of a record and broadcasts
+// the record without it
+func (s *Server) handleDeleteAnnotation(w http.ResponseWriter, r *http.Request) {
+	if !s.annotationsEnabled(w) {
+		return
+	}
+
+	code := mux.Vars(r)["code"]
+	if _, ok := s.notes.Get(code); !ok {
+		// Accept codes typed with Persian digits
+		code = converter.ConvertDigits(code, converter.DigitsLatin)
+	}
+
+	deleted, err := s.notes.Delete(code)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !deleted {
+		http.Error(w, fmt.Sprintf("No annotation for record: %s", code), http.StatusNotFound)
+		return
+	}
+	s.log().Info("annotation deleted", "request_id", RequestID(r.Context()), "code", code)
+	s.handleChange("annotation")
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"code":    code,
+	})
+}
+
+// recordCode resolves a code from a request to the code of a record, as
+// findRecord does. ok is false if there is no such record.
+func (s *Server) recordCode(code string) (string, bool, error) {
+	records, err := s.readRecords()
+	if err != nil {
+		return "", false, err
+	}
+	code, _, ok := findRecord(records, code)
+	return code, ok, nil
+}
+
+// findRecord looks up a record by a code from a request, accepting codes
+// typed with Persian or Arabic-Indic digits, and returns the code the
+// record is kept under
+func findRecord(records map[string]interface{}, code string) (string, interface{}, bool) {
+	if record, ok := records[code]; ok {
+		return code, record, true
+	}
+	code = converter.ConvertDigits(code, converter.DigitsLatin)
+	record, ok := records[code]
+	return code, record, ok
+}
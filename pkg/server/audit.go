@@ -0,0 +1,76 @@
+package server
+
+import (
+	"path/filepath"
+	"time"
+
+	"github.com/atomicdeploy/patris-export/pkg/audit"
+	"github.com/atomicdeploy/patris-export/pkg/diff"
+)
+
+// auditEntry is a line of the audit log: the records a change added,
+// modified and deleted, and the versions they replaced
+type auditEntry struct {
+	Time     time.Time              `json:"time"`
+	Database string                 `json:"database"`
+	Seq      uint64                 `json:"seq"`
+	Trigger  string                 `json:"trigger"`
+	Reset    bool                   `json:"reset,omitempty"`
+	Added    map[string]interface{} `json:"added"`
+	Modified map[string]interface{} `json:"modified"`
+	Deleted  []string               `json:"deleted"`
+	// Previous holds the earlier versions of the modified and deleted records
+	Previous map[string]interface{} `json:"previous"`
+}
+
+// SetAuditLog appends every change to the records to an audit log of JSON
+// lines at path, whether or not clients are connected. The file is rotated
+// at maxSize bytes (0 never rotates), keeping maxFiles rotated files (0
+// keeps all).
+func (s *Server) SetAuditLog(path string, maxSize int64, maxFiles int) error {
+	log, err := audit.Open(path, maxSize, maxFiles)
+	if err != nil {
+		return err
+	}
+	s.auditLog = log
+	return nil
+}
+
+// audit writes a published change to the audit log. A reset is written
+// with the differences to the records before it, which clients are not
+// sent. The first records read have nothing to compare with.
+func (s *Server) audit(entry changeEntry, previous, records map[string]interface{}, trigger string) {
+	if s.auditLog == nil || previous == nil {
+		return
+	}
+
+	changes := entry.Changes
+	if changes == nil {
+		if changes = diff.Records(previous, records, s.diffOptions); changes.Empty() {
+			return
+		}
+	}
+
+	before := make(map[string]interface{}, len(changes.Modified)+len(changes.Deleted))
+	for code := range changes.Modified {
+		before[code] = previous[code]
+	}
+	for _, code := range changes.Deleted {
+		before[code] = previous[code]
+	}
+
+	err := s.auditLog.Write(auditEntry{
+		Time:     entry.Timestamp,
+		Database: filepath.Base(s.dbPath),
+		Seq:      entry.Seq,
+		Trigger:  trigger,
+		Reset:    entry.Reset,
+		Added:    changes.Added,
+		Modified: changes.Modified,
+		Deleted:  changes.Deleted,
+		Previous: before,
+	})
+	if err != nil {
+		s.log().Error("failed to write audit log", "file", filepath.Base(s.auditLog.Path()), "seq", entry.Seq, "error", err)
+	}
+}
@@ -0,0 +1,69 @@
+package server
+
+import (
+	"fmt"
+
+	"github.com/atomicdeploy/patris-export/pkg/paradox"
+)
+
+// tableData is the content of the database file at one version. It is
+// shared between requests and must not be modified.
+type tableData struct {
+	version     string
+	fields      []paradox.Field
+	records     []paradox.Record
+	transformed map[string]interface{}
+}
+
+// table returns the fields, records and transformed records of the
+// database, reading the file only when its hash changed since the last read
+// or the records were resynced (e.g. after a character mapping reload)
+func (s *Server) table() (*tableData, error) {
+	hash, _, err := s.sourceVersion()
+	if err != nil {
+		return nil, err
+	}
+	s.stateMu.Lock()
+	version := fmt.Sprintf("%s-%d", hash, s.resyncs)
+	s.stateMu.Unlock()
+
+	// Concurrent misses wait for one read instead of each parsing the file
+	s.cacheMu.Lock()
+	defer s.cacheMu.Unlock()
+
+	if s.cache != nil && s.cache.version == version {
+		s.cacheHits++
+		return s.cache, nil
+	}
+	s.cacheMisses++
+
+	db := s.cachedSource()
+	fields, err := db.GetFields()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read fields: %w", err)
+	}
+	records, err := db.GetRecords()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read records: %w", err)
+	}
+	s.plainText.Store(!db.Encoded())
+
+	s.cache = &tableData{
+		version: version,
+		fields:  fields,
+		records: records,
+		// Convert and transform records to match the format used by the convert command
+		transformed: s.convertAndTransformRecords(records),
+	}
+	return s.cache, nil
+}
+
+// cacheStats reports how often the cached records were reused
+func (s *Server) cacheStats() map[string]interface{} {
+	s.cacheMu.Lock()
+	defer s.cacheMu.Unlock()
+	return map[string]interface{}{
+		"hits":   s.cacheHits,
+		"misses": s.cacheMisses,
+	}
+}
@@ -0,0 +1,453 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/atomicdeploy/patris-export/pkg/diff"
+)
+
+// defaultChangeHistory is the number of change sets kept for replay
+const defaultChangeHistory = 256
+
+// changeEntry is a published change: a change set, or a full update after
+// which earlier changes cannot be replayed (e.g. a character map reload)
+type changeEntry struct {
+	Seq       uint64     `json:"seq"`
+	Timestamp time.Time  `json:"timestamp"`
+	Changes   *ChangeSet `json:"changes,omitempty"`
+	Reset     bool       `json:"reset,omitempty"`
+}
+
+// changeLog numbers published changes and keeps the most recent ones,
+// optionally appending them to a file so the history survives restarts
+type changeLog struct {
+	mu       sync.Mutex
+	entries  []changeEntry
+	capacity int
+	seq      uint64
+	// dropped is the newest entry no longer kept
+	dropped changeEntry
+
+	path    string
+	file    *os.File
+	written int
+	logger  *slog.Logger
+}
+
+// newChangeLog creates a change log keeping up to capacity entries in memory
+func newChangeLog(capacity int) *changeLog {
+	return &changeLog{capacity: capacity}
+}
+
+// openChangeLog creates a change log kept in a file of JSON lines, resuming
+// the history and sequence numbers stored there. The server records what
+// changed while it was stopped when it resumes.
+func openChangeLog(capacity int, path string, logger *slog.Logger) (*changeLog, error) {
+	l := newChangeLog(capacity)
+	l.path = path
+	l.logger = logger
+
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read change log: %w", err)
+	}
+	for i, line := range bytes.Split(data, []byte("\n")) {
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		var entry changeEntry
+		if err := json.Unmarshal(line, &entry); err != nil {
+			// A crash may leave a partial last line
+			logger.Warn("skipping unreadable change log line", "file", filepath.Base(path), "line", i+1, "error", err)
+			continue
+		}
+		l.keep(entry)
+		l.written++
+	}
+	if len(l.entries) > 0 && l.entries[0].Seq > 1 && l.dropped.Seq == 0 {
+		// A rewritten file starts after the entries it no longer keeps
+		l.dropped = changeEntry{Seq: l.entries[0].Seq - 1, Timestamp: l.entries[0].Timestamp}
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create change log directory: %w", err)
+	}
+	if l.file, err = os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644); err != nil {
+		return nil, fmt.Errorf("failed to open change log: %w", err)
+	}
+
+	return l, nil
+}
+
+// resumeAt reports whether the history continues from sequence seq, saved
+// by an earlier run. An empty history starts at seq: earlier sequence
+// numbers are then reported as no longer kept.
+func (l *changeLog) resumeAt(seq uint64) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.seq == 0 && len(l.entries) == 0 && seq > 0 {
+		l.seq = seq
+		l.dropped = changeEntry{Seq: seq, Timestamp: time.Now().UTC()}
+		return true
+	}
+	return l.seq == seq
+}
+
+// keep appends an entry to the kept history, dropping the oldest beyond
+// capacity. The caller holds mu, unless the log is being opened.
+func (l *changeLog) keep(entry changeEntry) {
+	l.seq = entry.Seq
+	l.entries = append(l.entries, entry)
+	if len(l.entries) > l.capacity {
+		excess := len(l.entries) - l.capacity
+		l.dropped = l.entries[excess-1]
+		l.entries = append(l.entries[:0:0], l.entries[excess:]...)
+	}
+}
+
+// add records a change set, or a reset if changes is nil, under the next
+// sequence number
+func (l *changeLog) add(changes *ChangeSet) changeEntry {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	entry := changeEntry{Seq: l.seq + 1, Timestamp: time.Now().UTC(), Changes: changes, Reset: changes == nil}
+	l.keep(entry)
+	if l.file != nil {
+		if err := l.persist(entry); err != nil {
+			l.logger.Error("failed to write change log", "file", filepath.Base(l.path), "error", err)
+		}
+	}
+	return entry
+}
+
+// persist appends an entry to the file, rewriting the file with only the
+// kept entries once it holds twice as many. The caller holds mu.
+func (l *changeLog) persist(entry changeEntry) error {
+	if l.written >= 2*l.capacity {
+		return l.rewrite()
+	}
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	if _, err := l.file.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	l.written++
+	return nil
+}
+
+// rewrite replaces the file with the kept entries. The caller holds mu.
+func (l *changeLog) rewrite() error {
+	var buf bytes.Buffer
+	for _, entry := range l.entries {
+		line, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		buf.Write(append(line, '\n'))
+	}
+
+	tmp := l.path + ".tmp"
+	if err := os.WriteFile(tmp, buf.Bytes(), 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, l.path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	l.file.Close()
+	file, err := os.OpenFile(l.path, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		l.file = nil
+		return err
+	}
+	l.file = file
+	l.written = len(l.entries)
+	return nil
+}
+
+// Close closes the change log's file, if any
+func (l *changeLog) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.file == nil {
+		return nil
+	}
+	err := l.file.Close()
+	l.file = nil
+	return err
+}
+
+// latest returns the sequence number of the last published change
+func (l *changeLog) latest() uint64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.seq
+}
+
+// history returns the entries published after sequence seq or, if after is
+// not zero, after that time. complete reports whether they are all the
+// changes since then: none were dropped from the history, and no reset
+// breaks them up.
+func (l *changeLog) history(seq uint64, after time.Time) (entries []changeEntry, complete bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	newer := func(entry changeEntry) bool {
+		if after.IsZero() {
+			return entry.Seq > seq
+		}
+		return entry.Timestamp.After(after)
+	}
+
+	// A sequence number from the future is from another history
+	if after.IsZero() && seq > l.seq {
+		return nil, false
+	}
+
+	complete = l.dropped.Seq == 0 || !newer(l.dropped)
+	for _, entry := range l.entries {
+		if !newer(entry) {
+			continue
+		}
+		if entry.Reset {
+			complete = false
+		}
+		entries = append(entries, entry)
+	}
+	return entries, complete
+}
+
+// since returns the change sets published after seq. It reports false if
+// they cannot be replayed: seq is unknown (e.g. from another history), older
+// than the kept history, or followed by a reset.
+func (l *changeLog) since(seq uint64) ([]changeEntry, bool) {
+	entries, complete := l.history(seq, time.Time{})
+	if !complete {
+		return nil, false
+	}
+	return entries, true
+}
+
+// updateMessage encodes the full update sent to WebSocket and SSE clients
+func updateMessage(records map[string]interface{}, seq uint64) ([]byte, error) {
+	return json.Marshal(map[string]interface{}{
+		"type":      "update",
+		"seq":       seq,
+		"timestamp": time.Now().Format(time.RFC3339),
+		"count":     len(records),
+		"records":   records,
+	})
+}
+
+// changesMessage encodes a change set sent to clients receiving deltas
+func changesMessage(entry changeEntry) ([]byte, error) {
+	return json.Marshal(map[string]interface{}{
+		"type":      "changes",
+		"seq":       entry.Seq,
+		"timestamp": entry.Timestamp.Format(time.RFC3339),
+		"changes":   entry.Changes,
+	})
+}
+
+// currentRecords returns the last published records, reading them if
+// nothing was published yet. The caller holds publishMu.
+func (s *Server) currentRecords() (map[string]interface{}, error) {
+	if s.current != nil {
+		return s.current, nil
+	}
+	return s.loadRecords()
+}
+
+// replay returns what brings a new client up to date: the change sets
+// published after sequence since, if the client receives deltas and they can
+// be replayed, or else all records. The caller holds publishMu.
+func (s *Server) replay(delta bool, since uint64) ([]changeEntry, map[string]interface{}, error) {
+	// Sequence 0 is the state before any change, which the client may not have
+	if delta && since > 0 {
+		if missed, ok := s.changes.since(since); ok {
+			return missed, nil, nil
+		}
+	}
+
+	records, err := s.currentRecords()
+	if err != nil {
+		return nil, nil, err
+	}
+	return nil, records, nil
+}
+
+// catchUp returns the messages bringing a new WebSocket or SSE client up to
+// date. The caller holds publishMu.
+func (s *Server) catchUp(delta bool, since uint64) ([][]byte, error) {
+	missed, records, err := s.replay(delta, since)
+	if err != nil {
+		return nil, err
+	}
+
+	if records != nil {
+		message, err := updateMessage(records, s.changes.latest())
+		if err != nil {
+			return nil, err
+		}
+		return [][]byte{message}, nil
+	}
+
+	messages := make([][]byte, 0, len(missed))
+	for _, entry := range missed {
+		message, err := changesMessage(entry)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, message)
+	}
+	return messages, nil
+}
+
+// publish reads the records, records the changes since the last publish,
+// and sends them to the connected clients: a full update to clients that
+// asked for full updates, and the change set to clients receiving deltas.
+// reset publishes a full update to every client (e.g. after a character map
+// reload, when all converted values may differ). trigger names the cause in
+// the logs. It returns the error of reading the records.
+func (s *Server) publish(reset bool, trigger string) error {
+	s.publishMu.Lock()
+	defer s.publishMu.Unlock()
+
+	records, err := s.loadRecords()
+	if err != nil {
+		s.log().Error("failed to read records", "trigger", trigger, "error", err)
+		return err
+	}
+
+	previous := s.current
+	s.current = records
+
+	var entry *changeEntry
+	switch {
+	case previous == nil || reset:
+		e := s.changes.add(nil)
+		entry = &e
+	default:
+		if changes := diff.Records(previous, records, s.diffOptions); !changes.Empty() {
+			e := s.changes.add(changes)
+			entry = &e
+		}
+	}
+
+	if entry != nil {
+		s.countChanges(*entry)
+		s.audit(*entry, previous, records, trigger)
+	}
+
+	full, err := updateMessage(records, s.changes.latest())
+	if err != nil {
+		s.log().Error("failed to encode update", "error", err)
+		return nil
+	}
+	var delta []byte
+	if entry != nil && !entry.Reset {
+		if delta, err = changesMessage(*entry); err != nil {
+			s.log().Error("failed to encode changes", "error", err)
+			return nil
+		}
+	} else if entry != nil {
+		delta = full
+	}
+
+	// The request IDs of the receiving connections correlate the broadcast
+	// with their access logs
+	clients := append(s.broadcastWS(full, delta), s.broadcastEvents(full, delta)...)
+	if entry != nil {
+		clients = append(clients, s.broadcastGRPC(*entry, records)...)
+	}
+	if len(clients) == 0 {
+		return nil
+	}
+	s.log().Info("broadcast",
+		"seq", s.changes.latest(),
+		"trigger", trigger,
+		"changed", entry != nil,
+		"clients", len(clients),
+		"request_ids", clients,
+	)
+
+	s.stateMu.Lock()
+	s.broadcasts++
+	s.lastBroadcast = time.Now()
+	s.stateMu.Unlock()
+	return nil
+}
+
+// SetChangeHistory sets how many change sets are kept for replay and for
+// /api/changes. With a path the history is also appended to that file and
+// resumed from it on start, so sequence numbers stay valid across restarts.
+// Call it before StartWatching.
+func (s *Server) SetChangeHistory(capacity int, path string) error {
+	if capacity < 1 {
+		return fmt.Errorf("change history must keep at least one change, got %d", capacity)
+	}
+
+	changes := newChangeLog(capacity)
+	if path != "" {
+		var err error
+		if changes, err = openChangeLog(capacity, path, s.log()); err != nil {
+			return err
+		}
+	}
+
+	s.publishMu.Lock()
+	previous := s.changes
+	s.changes = changes
+	s.publishMu.Unlock()
+	return previous.Close()
+}
+
+// handleGetChanges returns the change sets published after ?since, a
+// sequence number or an RFC 3339 time, so clients can poll for updates
+// without a WebSocket. complete is false if changes are missing (they are
+// older than the kept history, or the records were reloaded in between);
+// the client should then fetch /api/records again.
+func (s *Server) handleGetChanges(w http.ResponseWriter, r *http.Request) {
+	var seq uint64
+	var after time.Time
+	if since := r.URL.Query().Get("since"); since != "" {
+		var err error
+		if seq, err = strconv.ParseUint(since, 10, 64); err != nil {
+			if after, err = time.Parse(time.RFC3339, since); err != nil {
+				http.Error(w, fmt.Sprintf("Invalid since %q: expected a sequence number or an RFC 3339 time", since), http.StatusBadRequest)
+				return
+			}
+		}
+	}
+
+	entries, complete := s.changes.history(seq, after)
+	if entries == nil {
+		entries = []changeEntry{}
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":  true,
+		"seq":      s.changes.latest(),
+		"complete": complete,
+		"count":    len(entries),
+		"changes":  entries,
+	})
+}
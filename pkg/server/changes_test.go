@@ -0,0 +1,144 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// changesResponse is the body of /api/changes
+type changesResponse struct {
+	Seq      uint64        `json:"seq"`
+	Complete bool          `json:"complete"`
+	Changes  []changeEntry `json:"changes"`
+}
+
+// getChanges requests /api/changes with a since parameter
+func getChanges(t *testing.T, s *Server, since string) changesResponse {
+	t.Helper()
+	w := serve(s, httptest.NewRequest("GET", "/api/changes?since="+url.QueryEscape(since), nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("since=%s: expected 200, got %d: %s", since, w.Code, w.Body)
+	}
+	var resp changesResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("since=%s: invalid JSON: %v", since, err)
+	}
+	return resp
+}
+
+// seqs returns the sequence numbers of entries
+func seqs(entries []changeEntry) []uint64 {
+	list := []uint64{}
+	for _, entry := range entries {
+		list = append(list, entry.Seq)
+	}
+	return list
+}
+
+// modified returns a change set modifying one record
+func modified(code string) *ChangeSet {
+	return &ChangeSet{Modified: map[string]interface{}{code: map[string]interface{}{"Code": code}}}
+}
+
+func TestGetChangesSince(t *testing.T) {
+	s := newTestServer(t)
+	if err := s.SetChangeHistory(3, ""); err != nil {
+		t.Fatalf("SetChangeHistory failed: %v", err)
+	}
+
+	// 1 2 3: the first three are kept
+	for _, code := range []string{"101", "102", "103"} {
+		s.changes.add(modified(code))
+	}
+	beforeFourth := time.Now().UTC()
+	time.Sleep(10 * time.Millisecond)
+	// 4 drops 1
+	s.changes.add(modified("104"))
+
+	tests := []struct {
+		since    string
+		seqs     []uint64
+		complete bool
+	}{
+		// Everything kept; sequence 1 is gone
+		{"", []uint64{2, 3, 4}, false},
+		{"0", []uint64{2, 3, 4}, false},
+		{"1", []uint64{2, 3, 4}, true},
+		{"3", []uint64{4}, true},
+		{"4", []uint64{}, true},
+		// From another history
+		{"9", []uint64{}, false},
+		{beforeFourth.Format(time.RFC3339Nano), []uint64{4}, true},
+	}
+	for _, tt := range tests {
+		resp := getChanges(t, s, tt.since)
+		if resp.Seq != 4 || resp.Complete != tt.complete || !equalSeqs(seqs(resp.Changes), tt.seqs) {
+			t.Errorf("since=%q: expected %v complete=%v, got seq %d %v complete=%v", tt.since, tt.seqs, tt.complete, resp.Seq, seqs(resp.Changes), resp.Complete)
+		}
+	}
+
+	// A reset breaks up the changes before it
+	s.changes.add(nil)
+	s.changes.add(modified("105"))
+	if resp := getChanges(t, s, "4"); resp.Complete || !equalSeqs(seqs(resp.Changes), []uint64{5, 6}) || !resp.Changes[0].Reset {
+		t.Errorf("Expected the reset reported incomplete, got %v complete=%v", seqs(resp.Changes), resp.Complete)
+	}
+	if resp := getChanges(t, s, "5"); !resp.Complete || !equalSeqs(seqs(resp.Changes), []uint64{6}) {
+		t.Errorf("Expected the changes after the reset complete, got %v complete=%v", seqs(resp.Changes), resp.Complete)
+	}
+
+	for _, since := range []string{"-1", "yesterday"} {
+		if w := serve(s, httptest.NewRequest("GET", "/api/changes?since="+since, nil)); w.Code != http.StatusBadRequest {
+			t.Errorf("since=%s: expected 400, got %d", since, w.Code)
+		}
+	}
+}
+
+func TestChangeHistoryFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "changes.jsonl")
+
+	s := newTestServer(t)
+	if err := s.SetChangeHistory(2, path); err != nil {
+		t.Fatalf("SetChangeHistory failed: %v", err)
+	}
+	// More than twice the capacity, so the file is rewritten
+	for _, code := range []string{"101", "102", "103", "104", "105"} {
+		s.changes.add(modified(code))
+	}
+	if err := s.changes.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	// A restarted server resumes the sequence numbers and the kept history
+	s = newTestServer(t)
+	if err := s.SetChangeHistory(2, path); err != nil {
+		t.Fatalf("SetChangeHistory failed: %v", err)
+	}
+	if resp := getChanges(t, s, "3"); resp.Seq != 5 || !resp.Complete || !equalSeqs(seqs(resp.Changes), []uint64{4, 5}) {
+		t.Errorf("Expected 4 and 5 resumed, got seq %d %v complete=%v", resp.Seq, seqs(resp.Changes), resp.Complete)
+	}
+	if resp := getChanges(t, s, "2"); resp.Complete {
+		t.Errorf("Expected changes before the kept history incomplete, got %v", seqs(resp.Changes))
+	}
+	if entry := s.changes.add(modified("106")); entry.Seq != 6 {
+		t.Errorf("Expected the next change numbered 6, got %d", entry.Seq)
+	}
+}
+
+// equalSeqs reports whether two lists of sequence numbers are equal
+func equalSeqs(a, b []uint64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,269 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/atomicdeploy/patris-export/pkg/diff"
+	"github.com/atomicdeploy/patris-export/pkg/resilient"
+)
+
+// CurrentSnapshot names the live database in compare requests
+const CurrentSnapshot = "current"
+
+// ChangeSet describes the differences between two sets of transformed records
+type ChangeSet = diff.ChangeSet
+
+// SetDiffTolerance sets the largest difference between two numbers that
+// does not count as a change, for broadcasts and comparisons (default: 0,
+// numbers compare exactly)
+func (s *Server) SetDiffTolerance(tolerance float64) {
+	s.diffOptions.Tolerance = tolerance
+}
+
+// SetSnapshotDir sets the directory holding JSON exports that can be compared
+func (s *Server) SetSnapshotDir(dir string) {
+	s.snapshotDir = dir
+}
+
+// listSnapshots returns the snapshot names available for comparison, oldest first
+func (s *Server) listSnapshots() ([]string, error) {
+	if s.snapshotDir == "" {
+		return nil, nil
+	}
+
+	entries, err := os.ReadDir(s.snapshotDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read snapshot directory: %w", err)
+	}
+
+	names := []string{}
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.EqualFold(filepath.Ext(entry.Name()), ".json") {
+			names = append(names, strings.TrimSuffix(entry.Name(), filepath.Ext(entry.Name())))
+		}
+	}
+	sort.Strings(names)
+
+	return names, nil
+}
+
+// loadSnapshot loads a snapshot by name, or the live database for CurrentSnapshot.
+// Both are normalized through JSON so numbers compare equal regardless of source.
+// The live records leave out annotations, which exports do not have.
+func (s *Server) loadSnapshot(name string) (map[string]interface{}, error) {
+	var data []byte
+
+	if name == CurrentSnapshot {
+		records, err := s.readRecords()
+		if err != nil {
+			return nil, err
+		}
+		if data, err = json.Marshal(records); err != nil {
+			return nil, fmt.Errorf("failed to encode records: %w", err)
+		}
+	} else {
+		if s.snapshotDir == "" {
+			return nil, fmt.Errorf("no snapshot directory configured")
+		}
+		if name == "" || name != filepath.Base(name) || strings.HasPrefix(name, ".") {
+			return nil, fmt.Errorf("invalid snapshot name %q", name)
+		}
+
+		var err error
+		data, err = resilient.ReadFile(filepath.Join(s.snapshotDir, name+".json"))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read snapshot %s: %w", name, err)
+		}
+	}
+
+	var records map[string]interface{}
+	if err := json.Unmarshal(data, &records); err != nil {
+		return nil, fmt.Errorf("snapshot %s is not a JSON export: %w", name, err)
+	}
+
+	return records, nil
+}
+
+// handleListSnapshots returns the snapshots available for comparison
+func (s *Server) handleListSnapshots(w http.ResponseWriter, r *http.Request) {
+	names, err := s.listSnapshots()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":   true,
+		"current":   CurrentSnapshot,
+		"snapshots": names,
+	})
+}
+
+// handleCompare returns the changes from snapshot a to snapshot b, with the
+// previous version of every modified record so clients can highlight fields
+func (s *Server) handleCompare(w http.ResponseWriter, r *http.Request) {
+	a := r.URL.Query().Get("a")
+	b := r.URL.Query().Get("b")
+	if b == "" {
+		b = CurrentSnapshot
+	}
+	if a == "" {
+		http.Error(w, "query parameter a is required", http.StatusBadRequest)
+		return
+	}
+
+	before, err := s.loadSnapshot(a)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	after, err := s.loadSnapshot(b)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	changes := diff.Records(before, after, s.diffOptions)
+
+	previous := make(map[string]interface{}, len(changes.Modified)+len(changes.Deleted))
+	for code := range changes.Modified {
+		previous[code] = before[code]
+	}
+	for _, code := range changes.Deleted {
+		previous[code] = before[code]
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":  true,
+		"a":        a,
+		"b":        b,
+		"changes":  changes,
+		"previous": previous,
+	})
+}
+
+// handleComparePage serves the visual compare page
+func (s *Server) handleComparePage(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	fmt.Fprint(w, comparePage)
+}
+
+const comparePage = `<!DOCTYPE html>
+<html>
+<head>
+    <meta charset="utf-8">
+    <title>Compare Snapshots - Patris Export</title>
+    <style>
+        body { font-family: 'Segoe UI', Tahoma, Geneva, Verdana, sans-serif; margin: 30px; background: #f5f5f5; }
+        .container { background: white; padding: 20px 30px; border-radius: 10px; box-shadow: 0 2px 10px rgba(0,0,0,0.1); }
+        h1 { color: #2c3e50; }
+        select, button, input { padding: 6px 10px; margin-right: 8px; }
+        table { border-collapse: collapse; width: 100%; margin-top: 20px; }
+        th, td { border: 1px solid #ddd; padding: 6px 10px; vertical-align: top; }
+        td { unicode-bidi: plaintext; }
+        th { background: #ecf0f1; text-align: left; }
+        .added td.status { color: #27ae60; }
+        .deleted td.status { color: #c0392b; }
+        .modified td.status { color: #d35400; }
+        .old { background: #fdecea; text-decoration: line-through; }
+        .new { background: #e9f7ef; }
+        .summary { margin-top: 15px; color: #7f8c8d; }
+    </style>
+</head>
+<body>
+<div class="container">
+    <h1>🔍 Compare Snapshots</h1>
+    <label>From <select id="a"></select></label>
+    <label>To <select id="b"></select></label>
+    <button onclick="compare()">Compare</button>
+    <input id="filter" placeholder="Filter by code" oninput="render()">
+    <div class="summary" id="summary"></div>
+    <table>
+        <thead><tr><th>Code</th><th>Change</th><th>Fields</th></tr></thead>
+        <tbody id="rows"></tbody>
+    </table>
+</div>
+<script>
+let result = null;
+
+// Pass the page's credentials (?api_key= or ?access_token=) on to the API
+const page = new URLSearchParams(location.search);
+const credentials = ['api_key', 'access_token']
+    .filter(k => page.has(k)).map(k => '&' + k + '=' + encodeURIComponent(page.get(k))).join('');
+
+function esc(v) {
+    return String(v === null || v === undefined ? '' : (typeof v === 'object' ? JSON.stringify(v) : v))
+        .replace(/&/g, '&amp;').replace(/</g, '&lt;').replace(/>/g, '&gt;');
+}
+
+async function load() {
+    const res = await fetch('api/snapshots?' + credentials);
+    const data = await res.json();
+    const names = data.snapshots.concat([data.current]);
+    for (const id of ['a', 'b']) {
+        const select = document.getElementById(id);
+        select.innerHTML = names.map(n => '<option>' + esc(n) + '</option>').join('');
+    }
+    document.getElementById('a').selectedIndex = Math.max(0, names.length - 2);
+    document.getElementById('b').selectedIndex = names.length - 1;
+}
+
+async function compare() {
+    const a = document.getElementById('a').value;
+    const b = document.getElementById('b').value;
+    const res = await fetch('api/compare?a=' + encodeURIComponent(a) + '&b=' + encodeURIComponent(b) + credentials);
+    if (!res.ok) {
+        document.getElementById('summary').textContent = await res.text();
+        return;
+    }
+    result = await res.json();
+    render();
+}
+
+function render() {
+    if (!result) return;
+    const filter = document.getElementById('filter').value;
+    const c = result.changes;
+    const rows = [];
+
+    const fields = (record) => Object.keys(record || {}).sort()
+        .map(k => '<b>' + esc(k) + '</b>: ' + esc(record[k])).join('<br>');
+
+    for (const code of Object.keys(c.modified).sort()) {
+        const before = result.previous[code] || {};
+        const after = c.modified[code];
+        const keys = Array.from(new Set(Object.keys(before).concat(Object.keys(after)))).sort();
+        const diffs = keys.filter(k => JSON.stringify(before[k]) !== JSON.stringify(after[k]))
+            .map(k => '<b>' + esc(k) + '</b>: <span class="old">' + esc(before[k]) + '</span> → <span class="new">' + esc(after[k]) + '</span>');
+        rows.push([code, 'modified', diffs.join('<br>')]);
+    }
+    for (const code of Object.keys(c.added).sort()) {
+        rows.push([code, 'added', fields(c.added[code])]);
+    }
+    for (const code of c.deleted) {
+        rows.push([code, 'deleted', fields(result.previous[code])]);
+    }
+
+    document.getElementById('summary').textContent =
+        Object.keys(c.added).length + ' added, ' + Object.keys(c.modified).length + ' modified, ' +
+        c.deleted.length + ' deleted (' + result.a + ' → ' + result.b + ')';
+
+    document.getElementById('rows').innerHTML = rows
+        .filter(r => !filter || r[0].includes(filter))
+        .map(r => '<tr class="' + r[1] + '"><td>' + esc(r[0]) + '</td><td class="status">' + r[1] + '</td><td>' + r[2] + '</td></tr>')
+        .join('');
+}
+
+load();
+</script>
+</body>
+</html>
+`
@@ -0,0 +1,225 @@
+package server
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// minCompressSize is the smallest response with a known length that is
+// compressed; smaller ones would not get shorter
+const minCompressSize = 1024
+
+var (
+	gzipWriters = sync.Pool{New: func() interface{} { return gzip.NewWriter(io.Discard) }}
+	zlibWriters = sync.Pool{New: func() interface{} { return zlib.NewWriter(io.Discard) }}
+)
+
+// compress compresses responses with gzip or deflate when the client accepts
+// it. Text and JSON responses are compressed; images, event streams and
+// WebSocket upgrades are passed through.
+func compress(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Upgrade") != "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Add("Vary", "Accept-Encoding")
+		encoding := acceptedEncoding(r.Header.Get("Accept-Encoding"))
+		if encoding == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		cw := &compressWriter{ResponseWriter: w, encoding: encoding, status: http.StatusOK}
+		defer cw.Close()
+		next.ServeHTTP(cw, r)
+	})
+}
+
+// acceptedEncoding picks gzip or deflate from an Accept-Encoding header,
+// preferring gzip; it returns "" if neither is acceptable
+func acceptedEncoding(header string) string {
+	quality := make(map[string]float64)
+	for _, part := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		q := 1.0
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if parsed, err := strconv.ParseFloat(value, 64); err == nil {
+				q = parsed
+			}
+		}
+		quality[strings.ToLower(strings.TrimSpace(name))] = q
+	}
+
+	for _, encoding := range []string{"gzip", "deflate"} {
+		q, ok := quality[encoding]
+		if !ok {
+			q, ok = quality["*"]
+		}
+		if ok && q > 0 {
+			return encoding
+		}
+	}
+	return ""
+}
+
+// compressible reports whether responses of a content type are worth
+// compressing
+func compressible(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	switch {
+	case mediaType == "text/event-stream":
+		// Events must reach clients as soon as they are written
+		return false
+	case strings.HasPrefix(mediaType, "text/"):
+		return true
+	case strings.HasSuffix(mediaType, "json"), strings.HasSuffix(mediaType, "xml"):
+		return true
+	case mediaType == "application/javascript", mediaType == "application/x-ndjson", mediaType == "application/yaml":
+		return true
+	}
+	return false
+}
+
+// compressWriter compresses a response once its headers show it is worth it
+type compressWriter struct {
+	http.ResponseWriter
+	encoding string
+	status   int
+	// headerSet is set once WriteHeader was called by the handler
+	headerSet bool
+	// started is set once the headers were sent
+	started bool
+	writer  io.WriteCloser
+}
+
+// WriteHeader records the status; headers are sent with the first write
+func (cw *compressWriter) WriteHeader(status int) {
+	if cw.started || cw.headerSet {
+		return
+	}
+	cw.status = status
+	cw.headerSet = true
+	if status == http.StatusNotModified || status == http.StatusNoContent || status < 200 {
+		cw.start(nil)
+	}
+}
+
+// Write compresses the body if the response is compressible
+func (cw *compressWriter) Write(data []byte) (int, error) {
+	if !cw.started {
+		cw.start(data)
+	}
+	if cw.writer != nil {
+		return cw.writer.Write(data)
+	}
+	return cw.ResponseWriter.Write(data)
+}
+
+// start decides whether to compress and sends the headers
+func (cw *compressWriter) start(data []byte) {
+	cw.started = true
+	header := cw.Header()
+	if header.Get("Content-Type") == "" && len(data) > 0 {
+		header.Set("Content-Type", http.DetectContentType(data))
+	}
+
+	if cw.status == http.StatusNotModified {
+		// Match the tag of the compressed body the client holds
+		weakenETag(header)
+	}
+
+	if cw.shouldCompress() {
+		header.Set("Content-Encoding", cw.encoding)
+		header.Del("Content-Length")
+		weakenETag(header)
+
+		switch cw.encoding {
+		case "gzip":
+			w := gzipWriters.Get().(*gzip.Writer)
+			w.Reset(cw.ResponseWriter)
+			cw.writer = w
+		case "deflate":
+			w := zlibWriters.Get().(*zlib.Writer)
+			w.Reset(cw.ResponseWriter)
+			cw.writer = w
+		}
+	}
+
+	cw.ResponseWriter.WriteHeader(cw.status)
+}
+
+// weakenETag marks a strong entity tag as weak: a compressed body is another
+// representation of the same content, not the same bytes
+func weakenETag(header http.Header) {
+	if etag := header.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+		header.Set("ETag", "W/"+etag)
+	}
+}
+
+// shouldCompress reports whether the response is worth compressing
+func (cw *compressWriter) shouldCompress() bool {
+	header := cw.Header()
+	if cw.status < 200 || cw.status == http.StatusNoContent || cw.status == http.StatusNotModified {
+		return false
+	}
+	if header.Get("Content-Encoding") != "" || !compressible(header.Get("Content-Type")) {
+		return false
+	}
+	if length, err := strconv.Atoi(header.Get("Content-Length")); err == nil && length < minCompressSize {
+		return false
+	}
+	return true
+}
+
+// Flush sends the data compressed so far to the client
+func (cw *compressWriter) Flush() {
+	if !cw.started {
+		cw.start(nil)
+	}
+	switch w := cw.writer.(type) {
+	case *gzip.Writer:
+		w.Flush()
+	case *zlib.Writer:
+		w.Flush()
+	}
+	if f, ok := cw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Close finishes the compressed body and returns the compressor to its pool
+func (cw *compressWriter) Close() error {
+	if !cw.started {
+		// Headers only, e.g. an empty 200 response
+		cw.start(nil)
+	}
+	if cw.writer == nil {
+		return nil
+	}
+
+	err := cw.writer.Close()
+	switch w := cw.writer.(type) {
+	case *gzip.Writer:
+		gzipWriters.Put(w)
+	case *zlib.Writer:
+		zlibWriters.Put(w)
+	}
+	cw.writer = nil
+	return err
+}
+
+// Unwrap returns the underlying ResponseWriter for http.ResponseController
+func (cw *compressWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
@@ -0,0 +1,64 @@
+package server
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCompressWeakensETag(t *testing.T) {
+	s := newTestServer(t)
+
+	r := httptest.NewRequest("GET", "/api/records", nil)
+	r.Header.Set("Accept-Encoding", "gzip")
+	w := serve(s, r)
+	etag := w.Header().Get("ETag")
+	if w.Code != http.StatusOK || w.Header().Get("Content-Encoding") != "gzip" || !strings.HasPrefix(etag, `W/"`) {
+		t.Fatalf("Expected a gzipped response with a weak ETag, got %d %q %q", w.Code, w.Header().Get("Content-Encoding"), etag)
+	}
+	zr, err := gzip.NewReader(w.Body)
+	if err != nil {
+		t.Fatalf("Invalid gzip body: %v", err)
+	}
+	var body struct {
+		Count int `json:"count"`
+	}
+	if err := json.NewDecoder(zr).Decode(&body); err != nil || body.Count == 0 {
+		t.Errorf("Expected the records in the gzipped body, got %+v (%v)", body, err)
+	}
+
+	// The client revalidates with the weak tag it holds
+	r = httptest.NewRequest("GET", "/api/records", nil)
+	r.Header.Set("Accept-Encoding", "gzip")
+	r.Header.Set("If-None-Match", etag)
+	w = serve(s, r)
+	if w.Code != http.StatusNotModified || w.Header().Get("ETag") != etag || w.Header().Get("Content-Encoding") != "" || w.Body.Len() != 0 {
+		t.Errorf("Expected an empty 304 with %s, got %d %q %q", etag, w.Code, w.Header().Get("ETag"), w.Header().Get("Content-Encoding"))
+	}
+
+	// The same tag matches the uncompressed representation too
+	r = httptest.NewRequest("GET", "/api/records", nil)
+	r.Header.Set("If-None-Match", etag)
+	if w := serve(s, r); w.Code != http.StatusNotModified || w.Header().Get("ETag") != strings.TrimPrefix(etag, "W/") {
+		t.Errorf("Expected 304 with the strong tag, got %d %q", w.Code, w.Header().Get("ETag"))
+	}
+}
+
+func TestCompressEncodings(t *testing.T) {
+	s := newTestServer(t)
+
+	r := httptest.NewRequest("GET", "/api/records/101/qr", nil)
+	r.Header.Set("Accept-Encoding", "gzip, deflate")
+	if w := serve(s, r); w.Code != http.StatusOK || w.Header().Get("Content-Encoding") != "" {
+		t.Errorf("Expected an uncompressed image, got %d %q", w.Code, w.Header().Get("Content-Encoding"))
+	}
+
+	r = httptest.NewRequest("GET", "/api/records", nil)
+	r.Header.Set("Accept-Encoding", "gzip;q=0, deflate")
+	if w := serve(s, r); w.Header().Get("Content-Encoding") != "deflate" {
+		t.Errorf("Expected deflate when gzip is refused, got %q", w.Header().Get("Content-Encoding"))
+	}
+}
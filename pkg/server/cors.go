@@ -0,0 +1,105 @@
+package server
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// corsAllowedHeaders are the request headers cross-origin clients may send
+const corsAllowedHeaders = "Authorization, Content-Type, If-None-Match, X-API-Key"
+
+// originPolicy lists the origins allowed besides the server's own
+type originPolicy []string
+
+// SetAllowedOrigins sets the origins allowed to call the REST API from a
+// browser and to open WebSocket connections. An origin is a scheme and host
+// (https://pos.example.com), may use a wildcard subdomain
+// (https://*.example.com), or is "*" to allow any origin. Pages served by
+// the server itself are always allowed.
+func (o *httpOptions) SetAllowedOrigins(origins []string) {
+	o.origins = nil
+	for _, origin := range origins {
+		if origin = strings.TrimRight(strings.TrimSpace(origin), "/"); origin != "" {
+			o.origins = append(o.origins, strings.ToLower(origin))
+		}
+	}
+}
+
+// allows reports whether a request's Origin may use the API. Requests
+// without an Origin (curl, native clients) and same-origin requests are
+// allowed.
+func (p originPolicy) allows(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+
+	u, err := url.Parse(origin)
+	if err != nil || u.Host == "" {
+		return false
+	}
+	if strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+
+	origin = strings.ToLower(origin)
+	for _, allowed := range p {
+		if allowed == "*" || allowed == origin {
+			return true
+		}
+		// https://*.example.com matches https://pos.example.com
+		if prefix, domain, ok := strings.Cut(allowed, "*."); ok && strings.HasPrefix(origin, prefix) {
+			host := strings.TrimPrefix(origin, prefix)
+			if strings.HasSuffix(host, "."+domain) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// checkWebSocketOrigin rejects WebSocket connections from other sites that
+// are not allowed
+func (s *Server) checkWebSocketOrigin(r *http.Request) bool {
+	if s.origins.allows(r) {
+		return true
+	}
+	s.log().Warn("WebSocket origin rejected",
+		"request_id", RequestID(r.Context()),
+		"origin", r.Header.Get("Origin"),
+		"hint", "allow it with --allowed-origins")
+	return false
+}
+
+// cors adds CORS headers for allowed origins and answers preflight requests
+func cors(origins originPolicy, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		if origin == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Add("Vary", "Origin")
+		allowed := origins.allows(r)
+		if allowed {
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+			w.Header().Set("Access-Control-Expose-Headers", "ETag")
+		}
+
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			if !allowed {
+				http.Error(w, "Origin not allowed", http.StatusForbidden)
+				return
+			}
+			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, DELETE, OPTIONS")
+			w.Header().Set("Access-Control-Allow-Headers", corsAllowedHeaders)
+			w.Header().Set("Access-Control-Max-Age", "600")
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,52 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCORSPreflight(t *testing.T) {
+	s := newTestServer(t)
+	s.SetAllowedOrigins([]string{"https://pos.example.com/", "https://*.shop.example"})
+
+	tests := []struct {
+		origin string
+		status int
+	}{
+		{"https://pos.example.com", http.StatusNoContent},
+		{"https://a.shop.example", http.StatusNoContent},
+		// The server's own origin (httptest requests are for example.com)
+		{"http://example.com", http.StatusNoContent},
+		{"https://shop.example", http.StatusForbidden},
+		{"https://evil.example", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("OPTIONS", "/api/records", nil)
+		r.Header.Set("Origin", tt.origin)
+		r.Header.Set("Access-Control-Request-Method", "GET")
+		r.Header.Set("Access-Control-Request-Headers", "X-API-Key")
+		w := serve(s, r)
+		if w.Code != tt.status {
+			t.Errorf("Preflight from %s: expected %d, got %d", tt.origin, tt.status, w.Code)
+			continue
+		}
+
+		allowOrigin := w.Header().Get("Access-Control-Allow-Origin")
+		if tt.status == http.StatusNoContent {
+			if allowOrigin != tt.origin || w.Header().Get("Access-Control-Allow-Headers") != corsAllowedHeaders {
+				t.Errorf("Preflight from %s: unexpected headers %v", tt.origin, w.Header())
+			}
+		} else if allowOrigin != "" {
+			t.Errorf("Preflight from %s: expected no Access-Control-Allow-Origin, got %q", tt.origin, allowOrigin)
+		}
+	}
+
+	// A simple request from an allowed origin can read the ETag
+	r := httptest.NewRequest("GET", "/api/records/101", nil)
+	r.Header.Set("Origin", "https://pos.example.com")
+	w := serve(s, r)
+	if w.Code != http.StatusOK || w.Header().Get("Access-Control-Allow-Origin") != "https://pos.example.com" || w.Header().Get("Access-Control-Expose-Headers") != "ETag" {
+		t.Errorf("Expected CORS headers on an allowed request, got %d %v", w.Code, w.Header())
+	}
+}
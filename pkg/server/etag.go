@@ -0,0 +1,121 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/atomicdeploy/patris-export/pkg/datasource"
+)
+
+// etagFor returns a strong entity tag for a response body
+func etagFor(body []byte) string {
+	sum := sha256.Sum256(body)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// etagMatches reports whether an If-None-Match header lists the entity tag.
+// Weak comparison is used, as RFC 9110 requires for If-None-Match.
+func etagMatches(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
+
+// notModified sets the validators of a response and writes 304 Not Modified
+// if the client's copy is current, checking If-None-Match or, without it,
+// If-Modified-Since. A zero modified time sends no Last-Modified.
+func notModified(w http.ResponseWriter, r *http.Request, etag string, modified time.Time) bool {
+	w.Header().Set("ETag", etag)
+	// Clients may cache the response but must revalidate it
+	w.Header().Set("Cache-Control", "no-cache")
+	if !modified.IsZero() {
+		w.Header().Set("Last-Modified", modified.UTC().Format(http.TimeFormat))
+	}
+
+	current := false
+	if header := r.Header.Get("If-None-Match"); header != "" {
+		current = etagMatches(header, etag)
+	} else if header := r.Header.Get("If-Modified-Since"); header != "" && !modified.IsZero() {
+		// HTTP dates have whole seconds
+		since, err := http.ParseTime(header)
+		current = err == nil && !modified.Truncate(time.Second).After(since)
+	}
+
+	if current {
+		w.WriteHeader(http.StatusNotModified)
+	}
+	return current
+}
+
+// writeWithETag writes a body with its entity tag, or 304 Not Modified if
+// the client already has it
+func writeWithETag(w http.ResponseWriter, r *http.Request, contentType string, body []byte) {
+	if notModified(w, r, etagFor(body), time.Time{}) {
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Write(body)
+}
+
+// sourceVersion returns the SHA-256 of the database file and when its
+// content last changed. The watcher's hash is used when the file is watched;
+// otherwise the cached table hashes the file again only when its size or
+// modification time changed. A remote table reports its own version.
+func (s *Server) sourceVersion() (string, time.Time, error) {
+	if s.watcher != nil && !datasource.IsRemote(s.dbPath) {
+		info, err := os.Stat(s.dbPath)
+		if err != nil {
+			return "", time.Time{}, fmt.Errorf("failed to stat database: %w", err)
+		}
+		if hash, ok := s.watcher.Hash(s.dbPath); ok {
+			// The size and time cover changes the watcher has not hashed yet
+			return fmt.Sprintf("%s-%d-%d", hash, info.Size(), info.ModTime().UnixNano()), info.ModTime(), nil
+		}
+	}
+
+	source := s.cachedSource()
+	if err := source.Refresh(); err != nil {
+		return "", time.Time{}, err
+	}
+	return source.Version(), source.Modified(), nil
+}
+
+// recordsValidators returns the entity tag and modification time of a
+// response derived from the records. They change with the database content,
+// with the path and query (e.g. the filter), with reloads of the character
+// mapping and with the annotations.
+func (s *Server) recordsValidators(r *http.Request) (string, time.Time, error) {
+	hash, modified, err := s.sourceVersion()
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	s.stateMu.Lock()
+	resyncs, lastResync := s.resyncs, s.lastResync
+	s.stateMu.Unlock()
+	if lastResync.After(modified) {
+		modified = lastResync
+	}
+
+	var annotated int64
+	if s.notes != nil {
+		notesModified := s.notes.Modified()
+		if notesModified.After(modified) {
+			modified = notesModified
+		}
+		annotated = notesModified.UnixNano()
+	}
+
+	etag := etagFor([]byte(fmt.Sprintf("%s\n%s\n%s\n%d\n%d", hash, r.URL.Path, r.URL.RawQuery, resyncs, annotated)))
+	return etag, modified, nil
+}
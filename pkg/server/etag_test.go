@@ -0,0 +1,83 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestGetRecordETag(t *testing.T) {
+	s := newTestServer(t)
+
+	w := serve(s, httptest.NewRequest("GET", "/api/records/101", nil))
+	etag := w.Header().Get("ETag")
+	if w.Code != http.StatusOK || etag == "" {
+		t.Fatalf("Expected 200 with an ETag, got %d %q", w.Code, etag)
+	}
+
+	tests := []struct {
+		ifNoneMatch string
+		status      int
+	}{
+		{etag, http.StatusNotModified},
+		{"W/" + etag, http.StatusNotModified},
+		{`"other", ` + etag, http.StatusNotModified},
+		{"*", http.StatusNotModified},
+		{`"other"`, http.StatusOK},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/api/records/101", nil)
+		r.Header.Set("If-None-Match", tt.ifNoneMatch)
+		w := serve(s, r)
+		if w.Code != tt.status {
+			t.Errorf("If-None-Match %s: expected %d, got %d", tt.ifNoneMatch, tt.status, w.Code)
+		}
+		if tt.status == http.StatusNotModified && (w.Body.Len() != 0 || w.Header().Get("ETag") != etag) {
+			t.Errorf("If-None-Match %s: expected an empty 304 with the ETag, got %q %q", tt.ifNoneMatch, w.Header().Get("ETag"), w.Body)
+		}
+	}
+
+	// Another record has another tag
+	r := httptest.NewRequest("GET", "/api/records/102", nil)
+	r.Header.Set("If-None-Match", etag)
+	if w := serve(s, r); w.Code != http.StatusOK || w.Header().Get("ETag") == etag {
+		t.Errorf("Expected another record to be sent with its own ETag, got %d %q", w.Code, w.Header().Get("ETag"))
+	}
+}
+
+func TestGetRecordsValidators(t *testing.T) {
+	s := newTestServer(t)
+
+	w := serve(s, httptest.NewRequest("GET", "/api/records", nil))
+	etag, lastModified := w.Header().Get("ETag"), w.Header().Get("Last-Modified")
+	if w.Code != http.StatusOK || etag == "" || lastModified == "" {
+		t.Fatalf("Expected 200 with validators, got %d %q %q", w.Code, etag, lastModified)
+	}
+
+	r := httptest.NewRequest("GET", "/api/records", nil)
+	r.Header.Set("If-None-Match", etag)
+	if w := serve(s, r); w.Code != http.StatusNotModified || w.Body.Len() != 0 {
+		t.Errorf("If-None-Match: expected an empty 304, got %d", w.Code)
+	}
+
+	r = httptest.NewRequest("GET", "/api/records", nil)
+	r.Header.Set("If-Modified-Since", lastModified)
+	if w := serve(s, r); w.Code != http.StatusNotModified {
+		t.Errorf("If-Modified-Since: expected 304, got %d", w.Code)
+	}
+
+	// If-None-Match takes precedence over If-Modified-Since
+	r = httptest.NewRequest("GET", "/api/records", nil)
+	r.Header.Set("If-None-Match", `"other"`)
+	r.Header.Set("If-Modified-Since", lastModified)
+	if w := serve(s, r); w.Code != http.StatusOK {
+		t.Errorf("Expected a mismatched If-None-Match to win, got %d", w.Code)
+	}
+
+	// A filter selects another response
+	r = httptest.NewRequest("GET", "/api/records?filter=Code+%3D%3D+101", nil)
+	r.Header.Set("If-None-Match", etag)
+	if w := serve(s, r); w.Code != http.StatusOK || w.Header().Get("ETag") == etag {
+		t.Errorf("Expected a filtered response with its own ETag, got %d %q", w.Code, w.Header().Get("ETag"))
+	}
+}
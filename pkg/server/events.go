@@ -0,0 +1,180 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// sseHeartbeat is how often an idle event stream gets a comment, so proxies
+// do not close it
+const sseHeartbeat = 15 * time.Second
+
+// sseQueueSize is the number of events a client receiving deltas may fall
+// behind before it is disconnected to reconnect and replay
+const sseQueueSize = 64
+
+// sseClient is a connected Server-Sent Events client
+type sseClient struct {
+	events chan []byte
+	// delta is set for clients receiving change sets instead of full updates
+	delta bool
+	// dropped is closed when a delta client falls behind
+	dropped   chan struct{}
+	dropOnce  sync.Once
+	requestID string
+}
+
+// handleEvents streams the WebSocket messages as Server-Sent Events, for
+// clients behind proxies that do not pass WebSockets. Full updates are
+// "update" events and change sets "changes" events; each event's id is its
+// sequence number. A client reconnecting with Last-Event-ID (sent by
+// EventSource automatically) or ?since=<seq> receives change sets like a
+// WebSocket client connecting with ?since.
+func (s *Server) handleEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+
+	lastID := r.Header.Get("Last-Event-ID")
+	if lastID == "" {
+		lastID = r.URL.Query().Get("since")
+	}
+	since, delta, err := parseSince(lastID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	// Ask nginx not to buffer the stream
+	w.Header().Set("X-Accel-Buffering", "no")
+
+	client := &sseClient{
+		events:    make(chan []byte, sseQueueSize),
+		delta:     delta,
+		dropped:   make(chan struct{}),
+		requestID: RequestID(r.Context()),
+	}
+
+	// Register and catch up without a publish in between, so no change is
+	// missed or sent twice
+	s.publishMu.Lock()
+	s.sseMu.Lock()
+	s.sseClients[client] = true
+	total := len(s.sseClients)
+	s.sseMu.Unlock()
+	messages, err := s.catchUp(delta, since)
+	s.publishMu.Unlock()
+
+	s.log().Info("SSE connected", "request_id", client.requestID, "delta", delta, "clients", total)
+
+	defer func() {
+		s.sseMu.Lock()
+		delete(s.sseClients, client)
+		remaining := len(s.sseClients)
+		s.sseMu.Unlock()
+		s.log().Info("SSE disconnected", "request_id", client.requestID, "clients", remaining)
+	}()
+
+	// Reconnect after 3 seconds if the connection drops
+	fmt.Fprint(w, "retry: 3000\n\n")
+
+	if err != nil {
+		s.log().Error("failed to read records", "request_id", client.requestID, "error", err)
+		fmt.Fprintf(w, "event: error\ndata: %s\n\n", err)
+		flusher.Flush()
+		return
+	}
+	for _, message := range messages {
+		w.Write(encodeEvent(message))
+	}
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(sseHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-client.dropped:
+			s.log().Warn("SSE client fell behind, closing the stream so it reconnects", "request_id", client.requestID)
+			return
+		case event := <-client.events:
+			w.Write(event)
+			flusher.Flush()
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": ping\n\n")
+			flusher.Flush()
+		}
+	}
+}
+
+// encodeEvent formats a message as an event named by its type, with its
+// sequence number as the event id
+func encodeEvent(message []byte) []byte {
+	var header struct {
+		Type string `json:"type"`
+		Seq  uint64 `json:"seq"`
+	}
+	json.Unmarshal(message, &header)
+	return []byte(fmt.Sprintf("id: %d\nevent: %s\ndata: %s\n\n", header.Seq, header.Type, message))
+}
+
+// broadcastEvents queues the full update, or the change set for clients
+// receiving deltas, for all SSE clients and returns the request IDs of the
+// clients sent to.
+// delta is nil if the records did not change. A client still sending a
+// previous full update gets only the latest one; a delta client that falls
+// behind is disconnected and replays on reconnect.
+func (s *Server) broadcastEvents(full, delta []byte) []string {
+	s.sseMu.Lock()
+	defer s.sseMu.Unlock()
+
+	if len(s.sseClients) == 0 {
+		return nil
+	}
+	fullEvent := encodeEvent(full)
+	var deltaEvent []byte
+	if delta != nil {
+		deltaEvent = encodeEvent(delta)
+	}
+
+	var sent []string
+	for client := range s.sseClients {
+		if !client.delta {
+			select {
+			case <-client.events:
+				// Drop the stale update
+			default:
+			}
+			client.events <- fullEvent
+			sent = append(sent, client.requestID)
+			continue
+		}
+
+		if deltaEvent == nil {
+			continue
+		}
+		select {
+		case client.events <- deltaEvent:
+			sent = append(sent, client.requestID)
+		default:
+			client.dropOnce.Do(func() { close(client.dropped) })
+		}
+	}
+	return sent
+}
+
+// sseClientCount returns the number of connected SSE clients
+func (s *Server) sseClientCount() int {
+	s.sseMu.Lock()
+	defer s.sseMu.Unlock()
+	return len(s.sseClients)
+}
@@ -0,0 +1,64 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// eventHeaders matches the id and name of each event of a stream
+var eventHeaders = regexp.MustCompile(`id: (\d+)\nevent: (\w+)\n`)
+
+// streamEvents requests /events and returns "id:name" for each event sent
+// before the stream ends. The request is canceled up front, so only the
+// catch-up events are sent.
+func streamEvents(s *Server, query, lastEventID string) []string {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	r := httptest.NewRequest("GET", "/events"+query, nil).WithContext(ctx)
+	if lastEventID != "" {
+		r.Header.Set("Last-Event-ID", lastEventID)
+	}
+
+	var events []string
+	for _, match := range eventHeaders.FindAllStringSubmatch(serve(s, r).Body.String(), -1) {
+		events = append(events, match[1]+":"+match[2])
+	}
+	return events
+}
+
+func TestEventsReplay(t *testing.T) {
+	s := newTestServer(t)
+	if err := s.SetChangeHistory(2, ""); err != nil {
+		t.Fatalf("SetChangeHistory failed: %v", err)
+	}
+	for _, code := range []string{"101", "102", "103"} {
+		s.changes.add(modified(code))
+	}
+
+	tests := []struct {
+		query, lastEventID string
+		events             string
+	}{
+		{"", "", "3:update"},
+		{"?since=1", "", "2:changes 3:changes"},
+		{"", "2", "3:changes"},
+		{"?since=0", "2", "3:changes"},
+		{"?since=3", "", ""},
+		// Older than the kept history, or from another history
+		{"?since=0", "", "3:update"},
+		{"", "9", "3:update"},
+	}
+	for _, tt := range tests {
+		if events := strings.Join(streamEvents(s, tt.query, tt.lastEventID), " "); events != tt.events {
+			t.Errorf("%q Last-Event-ID %q: expected %q, got %q", tt.query, tt.lastEventID, tt.events, events)
+		}
+	}
+
+	if w := serve(s, httptest.NewRequest("GET", "/events?since=x", nil)); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an invalid since, got %d", w.Code)
+	}
+}
@@ -0,0 +1,91 @@
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"github.com/atomicdeploy/patris-export/pkg/converter"
+	"github.com/atomicdeploy/patris-export/pkg/paradox"
+	"github.com/gorilla/mux"
+)
+
+// exportContentTypes are the media types of the export formats
+var exportContentTypes = map[string]string{
+	"csv":  "text/csv; charset=utf-8",
+	"json": "application/json; charset=utf-8",
+	"xlsx": "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+}
+
+// tableName returns the name of the served table: the database file name
+// without extension
+func (s *Server) tableName() string {
+	return strings.TrimSuffix(filepath.Base(s.dbPath), filepath.Ext(s.dbPath))
+}
+
+// handleExport downloads the current records as CSV, XLSX or JSON, exported
+// like the convert command does with the server's profile. ?filter exports
+// only the matching records. CSV and JSON are streamed as they are encoded.
+func (s *Server) handleExport(w http.ResponseWriter, r *http.Request) {
+	format := mux.Vars(r)["format"]
+
+	etag, modified, err := s.recordsValidators(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if notModified(w, r, etag, modified) {
+		return
+	}
+
+	t, err := s.table()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	exp := s.newExporter()
+	if expr := r.URL.Query().Get("filter"); expr != "" {
+		filter, err := converter.ParseFilter(expr)
+		if err == nil {
+			err = filter.Bind(t.fields)
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		exp.SetFilter(filter)
+	}
+
+	filename := fmt.Sprintf("%s-%s.%s", s.tableName(), modified.Format("20060102-150405"), format)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+
+	// The workbook is built before anything is sent, so failures are errors
+	if format == "xlsx" {
+		var buf bytes.Buffer
+		if err := exp.ExportToXLSXWriter(&buf, t.records, t.fields, s.tableName()); err != nil {
+			w.Header().Del("Content-Disposition")
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", exportContentTypes[format])
+		w.Header().Set("Content-Length", fmt.Sprint(buf.Len()))
+		w.Write(buf.Bytes())
+		return
+	}
+
+	w.Header().Set("Content-Type", exportContentTypes[format])
+	it := paradox.NewSliceIterator(t.records)
+	if format == "csv" {
+		err = exp.ExportToCSVWriter(w, t.fields, it)
+	} else {
+		err = exp.ExportToJSONWriter(w, it)
+	}
+	if err != nil {
+		// The response has started; the client gets a truncated file
+		s.log().Error("export failed", "request_id", RequestID(r.Context()), "format", format, "error", err)
+	}
+}
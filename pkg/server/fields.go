@@ -0,0 +1,67 @@
+package server
+
+import (
+	"fmt"
+	"strings"
+)
+
+// parseFields parses a comma-separated ?fields= list; nil means all fields
+func parseFields(value string) []string {
+	var fields []string
+	for _, field := range strings.Split(value, ",") {
+		if field = strings.TrimSpace(field); field != "" {
+			fields = append(fields, field)
+		}
+	}
+	return fields
+}
+
+// checkFields returns an error naming the first field that no record has,
+// so a misspelled field is not answered with empty records. The annotation
+// field is always accepted.
+func checkFields(records map[string]interface{}, fields []string) error {
+	if len(records) == 0 {
+		return nil
+	}
+
+	known := map[string]bool{annotationField: true}
+	for _, record := range records {
+		if record, ok := record.(map[string]interface{}); ok {
+			for field := range record {
+				known[field] = true
+			}
+		}
+	}
+	for _, field := range fields {
+		if !known[field] {
+			return fmt.Errorf("unknown field %q", field)
+		}
+	}
+	return nil
+}
+
+// projectRecords returns the records with only the given fields
+func projectRecords(records map[string]interface{}, fields []string) map[string]interface{} {
+	projected := make(map[string]interface{}, len(records))
+	for code, record := range records {
+		projected[code] = projectRecord(record, fields)
+	}
+	return projected
+}
+
+// projectRecord returns a copy of a record with only the given fields it
+// has. The record itself is not modified, as it may be shared with the
+// cache.
+func projectRecord(record interface{}, fields []string) interface{} {
+	values, ok := record.(map[string]interface{})
+	if !ok {
+		return record
+	}
+	projected := make(map[string]interface{}, len(fields))
+	for _, field := range fields {
+		if value, ok := values[field]; ok {
+			projected[field] = value
+		}
+	}
+	return projected
+}
@@ -0,0 +1,53 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestFieldsProjection(t *testing.T) {
+	s := newTestServer(t)
+
+	w := serve(s, httptest.NewRequest("GET", "/api/records?fields=Code,%20Name,", nil))
+	var list struct {
+		Count   int                               `json:"count"`
+		Records map[string]map[string]interface{} `json:"records"`
+	}
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body)
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &list); err != nil {
+		t.Fatalf("Invalid JSON: %v", err)
+	}
+	if list.Count == 0 || list.Count != len(list.Records) {
+		t.Fatalf("Expected every record, got count %d of %d", list.Count, len(list.Records))
+	}
+	for code, record := range list.Records {
+		if len(record) != 2 || record["Name"] == nil || record["Code"] == nil {
+			t.Errorf("Record %s: expected only Code and Name, got %v", code, record)
+		}
+	}
+
+	w = serve(s, httptest.NewRequest("GET", "/api/records/101?fields=Name", nil))
+	var single struct {
+		Record map[string]interface{} `json:"record"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &single); err != nil || !reflect.DeepEqual(single.Record, map[string]interface{}{"Name": list.Records["101"]["Name"]}) {
+		t.Errorf("Expected only the name of 101, got %s (%v)", w.Body, err)
+	}
+
+	// The projection does not change the cached records
+	w = serve(s, httptest.NewRequest("GET", "/api/records/101", nil))
+	if err := json.Unmarshal(w.Body.Bytes(), &single); err != nil || len(single.Record) <= 2 {
+		t.Errorf("Expected the full record after a projection, got %s (%v)", w.Body, err)
+	}
+
+	for _, path := range []string{"/api/records?fields=Code,Nmae", "/api/records/101?fields=Nmae"} {
+		if w := serve(s, httptest.NewRequest("GET", path, nil)); w.Code != http.StatusBadRequest {
+			t.Errorf("GET %s: expected 400 for an unknown field, got %d", path, w.Code)
+		}
+	}
+}
@@ -0,0 +1,434 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/atomicdeploy/patris-export/pkg/converter"
+	"github.com/atomicdeploy/patris-export/pkg/grpcapi"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// grpcQueueSize is the number of change events a WatchChanges stream may
+// fall behind before it is ended, for the client to resume with since
+const grpcQueueSize = 64
+
+// grpcStream is a WatchChanges stream of a table
+type grpcStream struct {
+	events chan *grpcapi.ChangeEvent
+	// dropped is closed when the stream falls behind
+	dropped   chan struct{}
+	dropOnce  sync.Once
+	requestID string
+}
+
+// grpcService implements the Records gRPC service over one or more tables
+type grpcService struct {
+	grpcapi.UnimplementedRecordsServer
+	// table returns the server of a table by name
+	table func(name string) (*Server, error)
+}
+
+// ServeGRPC serves the Records gRPC service on addr, with the server's TLS
+// and authentication settings. The request's table name may be empty or the
+// name of the database file without extension.
+func (s *Server) ServeGRPC(addr string) error {
+	name := s.tableName()
+	return s.serveGRPC(addr, func(table string) (*Server, error) {
+		if table != "" && !strings.EqualFold(table, name) {
+			return nil, status.Errorf(codes.NotFound, "table not found: %s", table)
+		}
+		return s, nil
+	})
+}
+
+// ServeGRPC serves the Records gRPC service for all tables on addr; requests
+// name their table
+func (m *Multi) ServeGRPC(addr string) error {
+	return m.serveGRPC(addr, func(table string) (*Server, error) {
+		srv, ok := m.tables[table]
+		if !ok {
+			return nil, status.Errorf(codes.NotFound, "table not found: %q", table)
+		}
+		return srv, nil
+	})
+}
+
+// serveGRPC serves the Records service, looking tables up with lookup
+func (o *httpOptions) serveGRPC(addr string, lookup func(string) (*Server, error)) error {
+	opts := []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(o.grpcUnaryLog, o.grpcUnaryNetworks, o.grpcUnaryAuth),
+		grpc.ChainStreamInterceptor(o.grpcStreamLog, o.grpcStreamNetworks, o.grpcStreamAuth),
+	}
+	if o.tls.enabled() {
+		config, err := o.tlsConfig()
+		if err != nil {
+			return err
+		}
+		opts = append(opts, grpc.Creds(credentials.NewTLS(config)))
+	}
+
+	srv := grpc.NewServer(opts...)
+	grpcapi.RegisterRecordsServer(srv, &grpcService{table: lookup})
+
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen for gRPC: %w", err)
+	}
+	o.log().Info("starting gRPC server", "addr", addr)
+	return srv.Serve(listener)
+}
+
+// grpcRequestID returns a context carrying the correlation ID of a call,
+// taken from its "x-request-id" metadata or generated, and sends the ID back
+// in the response header
+func grpcRequestID(ctx context.Context) context.Context {
+	md, _ := metadata.FromIncomingContext(ctx)
+	id := ""
+	if ids := md.Get("x-request-id"); len(ids) > 0 && validRequestID(ids[0]) {
+		id = ids[0]
+	} else {
+		id = newRequestID()
+	}
+	grpc.SetHeader(ctx, metadata.Pairs("x-request-id", id))
+	return withRequestID(ctx, id)
+}
+
+// logRPC writes the access log of a call
+func (o *httpOptions) logRPC(ctx context.Context, method string, start time.Time, err error) {
+	o.log().Info("rpc",
+		"request_id", RequestID(ctx),
+		"method", method,
+		"code", status.Code(err).String(),
+		"duration_ms", float64(time.Since(start).Microseconds())/1000,
+	)
+}
+
+// grpcUnaryLog assigns unary calls a correlation ID and logs them
+func (o *httpOptions) grpcUnaryLog(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	start := time.Now()
+	ctx = grpcRequestID(ctx)
+	resp, err := handler(ctx, req)
+	o.logRPC(ctx, info.FullMethod, start, err)
+	return resp, err
+}
+
+// grpcStreamLog assigns streams a correlation ID and logs them when they end
+func (o *httpOptions) grpcStreamLog(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	start := time.Now()
+	ctx := grpcRequestID(ss.Context())
+	err := handler(srv, &contextStream{ServerStream: ss, ctx: ctx})
+	o.logRPC(ctx, info.FullMethod, start, err)
+	return err
+}
+
+// contextStream is a server stream with a replaced context
+type contextStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+// Context returns the replaced context
+func (cs *contextStream) Context() context.Context {
+	return cs.ctx
+}
+
+// grpcAuthenticate checks the credentials in a call's metadata: an
+// "authorization: Bearer ..." or an "x-api-key" entry
+func (o *httpOptions) grpcAuthenticate(ctx context.Context) error {
+	if o.authenticator == nil {
+		return nil
+	}
+
+	md, _ := metadata.FromIncomingContext(ctx)
+	credential := ""
+	for _, value := range md.Get("authorization") {
+		if scheme, token, _ := strings.Cut(value, " "); strings.EqualFold(scheme, "Bearer") {
+			credential = strings.TrimSpace(token)
+		}
+	}
+	if keys := md.Get("x-api-key"); credential == "" && len(keys) > 0 {
+		credential = strings.TrimSpace(keys[0])
+	}
+
+	if err := o.authenticator.AuthenticateCredential(credential); err != nil {
+		return status.Error(codes.Unauthenticated, err.Error())
+	}
+	return nil
+}
+
+// grpcUnaryAuth rejects unary calls without valid credentials
+func (o *httpOptions) grpcUnaryAuth(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if err := o.grpcAuthenticate(ctx); err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+// grpcStreamAuth rejects streams without valid credentials
+func (o *httpOptions) grpcStreamAuth(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if err := o.grpcAuthenticate(ss.Context()); err != nil {
+		return err
+	}
+	return handler(srv, ss)
+}
+
+// GetRecords returns the records of a table, optionally filtered
+func (g *grpcService) GetRecords(ctx context.Context, req *grpcapi.GetRecordsRequest) (*grpcapi.GetRecordsResponse, error) {
+	s, err := g.table(req.GetTable())
+	if err != nil {
+		return nil, err
+	}
+
+	var filter *converter.Filter
+	if req.GetFilter() != "" {
+		if filter, err = converter.ParseFilter(req.GetFilter()); err != nil {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+	}
+
+	// The records and sequence number match, so WatchChanges can continue
+	// from seq
+	s.publishMu.Lock()
+	var records map[string]interface{}
+	if filter != nil {
+		records, err = s.loadMatchingRecords(filter)
+	} else {
+		records, err = s.currentRecords()
+	}
+	seq := s.changes.latest()
+	s.publishMu.Unlock()
+
+	if err != nil {
+		var ferr *filterError
+		if errors.As(err, &ferr) {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	list, err := recordList(records)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return &grpcapi.GetRecordsResponse{Records: list, Seq: seq}, nil
+}
+
+// GetRecord returns one record of a table by code
+func (g *grpcService) GetRecord(ctx context.Context, req *grpcapi.GetRecordRequest) (*grpcapi.Record, error) {
+	s, err := g.table(req.GetTable())
+	if err != nil {
+		return nil, err
+	}
+
+	s.publishMu.Lock()
+	records, err := s.currentRecords()
+	s.publishMu.Unlock()
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	code := req.GetCode()
+	record, ok := records[code]
+	if !ok {
+		// Accept codes typed with Persian digits
+		code = converter.ConvertDigits(code, converter.DigitsLatin)
+		record, ok = records[code]
+	}
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "record not found: %s", code)
+	}
+
+	result, err := recordMessage(code, record)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return result, nil
+}
+
+// WatchChanges streams a table's changes: first the ones the client missed
+// (or all records), then each one as it is published
+func (g *grpcService) WatchChanges(req *grpcapi.WatchChangesRequest, stream grpcapi.Records_WatchChangesServer) error {
+	s, err := g.table(req.GetTable())
+	if err != nil {
+		return err
+	}
+
+	sub := &grpcStream{
+		events:    make(chan *grpcapi.ChangeEvent, grpcQueueSize),
+		dropped:   make(chan struct{}),
+		requestID: RequestID(stream.Context()),
+	}
+
+	// Register and catch up without a publish in between, so no change is
+	// missed or sent twice
+	s.publishMu.Lock()
+	s.grpcMu.Lock()
+	s.grpcStreams[sub] = true
+	total := len(s.grpcStreams)
+	s.grpcMu.Unlock()
+	missed, records, err := s.replay(req.Since != nil, req.GetSince())
+	seq := s.changes.latest()
+	s.publishMu.Unlock()
+
+	s.log().Info("gRPC stream opened", "request_id", sub.requestID, "streams", total)
+
+	defer func() {
+		s.grpcMu.Lock()
+		delete(s.grpcStreams, sub)
+		remaining := len(s.grpcStreams)
+		s.grpcMu.Unlock()
+		s.log().Info("gRPC stream closed", "request_id", sub.requestID, "streams", remaining)
+	}()
+
+	if err != nil {
+		return status.Error(codes.Internal, err.Error())
+	}
+
+	var first []*grpcapi.ChangeEvent
+	if records != nil {
+		event, err := resetEvent(changeEntry{Seq: seq, Reset: true}, records)
+		if err != nil {
+			return status.Error(codes.Internal, err.Error())
+		}
+		first = append(first, event)
+	}
+	for _, entry := range missed {
+		event, err := changeEvent(entry, nil)
+		if err != nil {
+			return status.Error(codes.Internal, err.Error())
+		}
+		first = append(first, event)
+	}
+	for _, event := range first {
+		if err := stream.Send(event); err != nil {
+			return err
+		}
+	}
+
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case <-sub.dropped:
+			return status.Error(codes.Unavailable, "client fell behind; resume with since")
+		case event := <-sub.events:
+			if err := stream.Send(event); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// broadcastGRPC queues a published change for all WatchChanges streams and
+// returns the request IDs of the streams it was queued for. A stream that
+// falls behind is ended and resumes on reconnect.
+func (s *Server) broadcastGRPC(entry changeEntry, records map[string]interface{}) []string {
+	s.grpcMu.Lock()
+	defer s.grpcMu.Unlock()
+
+	if len(s.grpcStreams) == 0 {
+		return nil
+	}
+	event, err := changeEvent(entry, records)
+	if err != nil {
+		s.log().Error("failed to encode gRPC change event", "error", err)
+		return nil
+	}
+
+	var sent []string
+	for sub := range s.grpcStreams {
+		select {
+		case sub.events <- event:
+			sent = append(sent, sub.requestID)
+		default:
+			sub.dropOnce.Do(func() { close(sub.dropped) })
+		}
+	}
+	return sent
+}
+
+// grpcStreamCount returns the number of open WatchChanges streams
+func (s *Server) grpcStreamCount() int {
+	s.grpcMu.Lock()
+	defer s.grpcMu.Unlock()
+	return len(s.grpcStreams)
+}
+
+// changeEvent converts a change log entry to a ChangeEvent; a reset carries
+// all records
+func changeEvent(entry changeEntry, records map[string]interface{}) (*grpcapi.ChangeEvent, error) {
+	if entry.Reset {
+		return resetEvent(entry, records)
+	}
+
+	event := &grpcapi.ChangeEvent{Seq: entry.Seq, Timestamp: timestamppb.New(entry.Timestamp)}
+	var err error
+	if event.Added, err = recordList(entry.Changes.Added); err != nil {
+		return nil, err
+	}
+	if event.Modified, err = recordList(entry.Changes.Modified); err != nil {
+		return nil, err
+	}
+	event.Deleted = entry.Changes.Deleted
+	return event, nil
+}
+
+// resetEvent returns a ChangeEvent replacing the client's copy with records
+func resetEvent(entry changeEntry, records map[string]interface{}) (*grpcapi.ChangeEvent, error) {
+	list, err := recordList(records)
+	if err != nil {
+		return nil, err
+	}
+	event := &grpcapi.ChangeEvent{Seq: entry.Seq, Snapshot: true, Records: list}
+	if !entry.Timestamp.IsZero() {
+		event.Timestamp = timestamppb.New(entry.Timestamp)
+	}
+	return event, nil
+}
+
+// recordList converts records keyed by code to messages ordered by code
+func recordList(records map[string]interface{}) ([]*grpcapi.Record, error) {
+	keys := make([]string, 0, len(records))
+	for code := range records {
+		keys = append(keys, code)
+	}
+	sort.Strings(keys)
+
+	list := make([]*grpcapi.Record, 0, len(keys))
+	for _, code := range keys {
+		record, err := recordMessage(code, records[code])
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, record)
+	}
+	return list, nil
+}
+
+// recordMessage converts a record to a message. The record goes through
+// JSON, so its fields have the same form as in the REST API.
+func recordMessage(code string, record interface{}) (*grpcapi.Record, error) {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode record %s: %w", code, err)
+	}
+	fields := &structpb.Struct{}
+	if err := fields.UnmarshalJSON(data); err != nil {
+		return nil, fmt.Errorf("failed to encode record %s: %w", code, err)
+	}
+	return &grpcapi.Record{Code: code, Fields: fields}, nil
+}
@@ -0,0 +1,215 @@
+package server
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// wsWriteTimeout bounds a write to a WebSocket client; a client that takes
+// longer is disconnected
+const wsWriteTimeout = 10 * time.Second
+
+// wsQueueSize is the number of messages a WebSocket client receiving deltas
+// may fall behind before it is disconnected to reconnect and replay
+const wsQueueSize = 64
+
+// wsClient is a connected WebSocket client
+type wsClient struct {
+	conn *websocket.Conn
+	// send queues the messages for the client's writer. The hub closes it
+	// to disconnect the client.
+	send chan []byte
+	// delta is set for clients receiving change sets instead of full updates
+	delta     bool
+	requestID string
+	// evicted is set by the hub before closing send when the client fell
+	// behind
+	evicted bool
+}
+
+// wsBroadcast is a message for all WebSocket clients
+type wsBroadcast struct {
+	full, delta []byte
+	// sent receives the request IDs of the clients the message was queued for
+	sent chan []string
+}
+
+// wsHub owns the connected WebSocket clients. Only its goroutine touches
+// them, and it never waits for a client: messages are queued per client,
+// and each client's writer sends them at the client's pace.
+type wsHub struct {
+	register   chan *wsClient
+	unregister chan *wsClient
+	broadcast  chan wsBroadcast
+	done       chan struct{}
+	closeOnce  sync.Once
+
+	clients atomic.Int64
+	evicted atomic.Int64
+	dropped atomic.Int64
+}
+
+// newWSHub creates a hub; runHub starts it
+func newWSHub() *wsHub {
+	return &wsHub{
+		register:   make(chan *wsClient),
+		unregister: make(chan *wsClient),
+		broadcast:  make(chan wsBroadcast),
+		done:       make(chan struct{}),
+	}
+}
+
+// runHub registers, unregisters and broadcasts to WebSocket clients until
+// the hub is closed, then disconnects the remaining clients
+func (s *Server) runHub() {
+	h := s.hub
+	clients := make(map[*wsClient]bool)
+
+	remove := func(client *wsClient) {
+		delete(clients, client)
+		close(client.send)
+		h.clients.Store(int64(len(clients)))
+	}
+
+	for {
+		select {
+		case client := <-h.register:
+			clients[client] = true
+			h.clients.Store(int64(len(clients)))
+			s.log().Info("WebSocket connected", "request_id", client.requestID, "delta", client.delta, "clients", len(clients))
+
+		case client := <-h.unregister:
+			if clients[client] {
+				remove(client)
+			}
+			s.log().Info("WebSocket disconnected", "request_id", client.requestID, "clients", len(clients))
+
+		case b := <-h.broadcast:
+			var sent []string
+			for client := range clients {
+				if !client.delta {
+					// Only the latest full update matters: replace the
+					// ones the client has not been sent yet
+					h.dropped.Add(int64(drain(client.send)))
+					client.send <- b.full
+					sent = append(sent, client.requestID)
+					continue
+				}
+
+				if b.delta == nil {
+					continue
+				}
+				select {
+				case client.send <- b.delta:
+					sent = append(sent, client.requestID)
+				default:
+					// A delta client cannot skip a change set
+					client.evicted = true
+					remove(client)
+					h.evicted.Add(1)
+					s.log().Warn("WebSocket client fell behind, disconnecting it so it reconnects", "request_id", client.requestID, "queued", wsQueueSize)
+				}
+			}
+			b.sent <- sent
+
+		case <-h.done:
+			for client := range clients {
+				remove(client)
+			}
+			return
+		}
+	}
+}
+
+// drain removes the queued messages from a channel and returns how many
+// there were
+func drain(queue chan []byte) int {
+	for n := 0; ; n++ {
+		select {
+		case <-queue:
+		default:
+			return n
+		}
+	}
+}
+
+// closeHub disconnects all WebSocket clients and stops the hub
+func (s *Server) closeHub() {
+	s.hub.closeOnce.Do(func() { close(s.hub.done) })
+}
+
+// registerWS adds a client to the hub; it returns false if the hub is closed
+func (s *Server) registerWS(client *wsClient) bool {
+	select {
+	case s.hub.register <- client:
+		return true
+	case <-s.hub.done:
+		return false
+	}
+}
+
+// unregisterWS removes a client from the hub, if it is still registered
+func (s *Server) unregisterWS(client *wsClient) {
+	select {
+	case s.hub.unregister <- client:
+	case <-s.hub.done:
+	}
+}
+
+// broadcastWS queues the full update, or the change set for clients
+// receiving deltas, for all WebSocket clients and returns the request IDs
+// of the clients sent to. delta is nil if the records did not change.
+func (s *Server) broadcastWS(full, delta []byte) []string {
+	b := wsBroadcast{full: full, delta: delta, sent: make(chan []string, 1)}
+	select {
+	case s.hub.broadcast <- b:
+		return <-b.sent
+	case <-s.hub.done:
+		return nil
+	}
+}
+
+// writeWS sends a client its catch-up messages, then its queued messages,
+// until the hub closes the queue or a write fails
+func (s *Server) writeWS(client *wsClient, backlog [][]byte) {
+	// The reader then fails and unregisters the client
+	defer client.conn.Close()
+
+	for _, message := range backlog {
+		if !s.writeMessage(client, message) {
+			return
+		}
+	}
+	for message := range client.send {
+		if !s.writeMessage(client, message) {
+			return
+		}
+	}
+
+	code, reason := websocket.CloseGoingAway, "server shutting down"
+	if client.evicted {
+		code, reason = websocket.CloseTryAgainLater, "client fell behind"
+	}
+	client.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason), time.Now().Add(time.Second))
+}
+
+// writeMessage writes a message to a WebSocket client and reports whether
+// it was sent
+func (s *Server) writeMessage(client *wsClient, message []byte) bool {
+	client.conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+	if err := client.conn.WriteMessage(websocket.TextMessage, message); err != nil {
+		s.log().Warn("failed to send to WebSocket", "request_id", client.requestID, "error", err)
+		return false
+	}
+	return true
+}
+
+// wsStats reports the connected WebSocket clients, the clients disconnected
+// for falling behind, and the stale full updates replaced before they were
+// sent
+func (s *Server) wsStats() (clients, evicted, dropped int) {
+	return int(s.hub.clients.Load()), int(s.hub.evicted.Load()), int(s.hub.dropped.Load())
+}
@@ -0,0 +1,77 @@
+package server
+
+import (
+	"testing"
+)
+
+func TestHubEvictsSlowDeltaClient(t *testing.T) {
+	s := newTestServer(t)
+
+	slow := &wsClient{send: make(chan []byte, wsQueueSize), delta: true, requestID: "slow"}
+	fast := &wsClient{send: make(chan []byte, wsQueueSize), delta: true, requestID: "fast"}
+	full := &wsClient{send: make(chan []byte, wsQueueSize), requestID: "full"}
+	for _, client := range []*wsClient{slow, fast, full} {
+		if !s.registerWS(client) {
+			t.Fatal("registerWS failed")
+		}
+	}
+
+	// The slow client reads nothing; the fast one keeps up
+	for i := 0; i < wsQueueSize; i++ {
+		if sent := s.broadcastWS([]byte("full"), []byte("delta")); len(sent) != 3 {
+			t.Fatalf("Broadcast %d: expected 3 clients sent to, got %v", i, sent)
+		}
+		<-fast.send
+	}
+	if clients, evicted, _ := s.wsStats(); clients != 3 || evicted != 0 {
+		t.Fatalf("Expected 3 clients and none evicted with full queues, got %d and %d", clients, evicted)
+	}
+
+	sent := s.broadcastWS([]byte("full"), []byte("delta"))
+	if len(sent) != 2 || contains(sent, "slow") {
+		t.Errorf("Expected the slow client skipped, got %v", sent)
+	}
+	// The writer sends what was queued, then closes the connection
+	queued := 0
+	for range slow.send {
+		queued++
+	}
+	if !slow.evicted || queued != wsQueueSize {
+		t.Errorf("Expected the slow client evicted with %d messages queued, got evicted=%v and %d", wsQueueSize, slow.evicted, queued)
+	}
+	if <-fast.send == nil || fast.evicted {
+		t.Error("Expected the fast client to keep receiving")
+	}
+
+	// A full-update client only gets the latest update
+	if n := drain(full.send); n != 1 {
+		t.Errorf("Expected one queued full update, got %d", n)
+	}
+	clients, evicted, dropped := s.wsStats()
+	if clients != 2 || evicted != 1 || dropped != wsQueueSize {
+		t.Errorf("Expected 2 clients, 1 evicted and %d dropped, got %d, %d and %d", wsQueueSize, clients, evicted, dropped)
+	}
+
+	// Unchanged records send nothing to delta clients
+	if sent := s.broadcastWS([]byte("full"), nil); len(sent) != 1 || sent[0] != "full" {
+		t.Errorf("Expected only the full-update client sent to, got %v", sent)
+	}
+
+	s.closeHub()
+	if _, ok := <-fast.send; ok {
+		t.Error("Expected the queues closed with the hub")
+	}
+	if s.registerWS(&wsClient{send: make(chan []byte, 1)}) || s.broadcastWS([]byte("full"), nil) != nil {
+		t.Error("Expected a closed hub to refuse clients and broadcasts")
+	}
+}
+
+// contains reports whether list holds value
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
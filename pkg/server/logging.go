@@ -0,0 +1,158 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"time"
+)
+
+// requestIDHeader carries a request's correlation ID. A client or proxy may
+// set it; otherwise the server generates one. Responses echo it.
+const requestIDHeader = "X-Request-ID"
+
+// contextKey keys the values the server stores in request contexts
+type contextKey int
+
+const requestIDKey contextKey = iota
+
+// RequestID returns the correlation ID of a request's context, or "" if it
+// has none
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey).(string)
+	return id
+}
+
+// withRequestID returns a context carrying a correlation ID
+func withRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey, id)
+}
+
+// newRequestID generates a random correlation ID
+func newRequestID() string {
+	var b [8]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// validRequestID reports whether a client-supplied ID is safe to log: up to
+// 128 letters, digits and "-_.:"
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '-', c == '_', c == '.', c == ':':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// SetLogger sets the logger of access logs and server events (default:
+// slog.Default())
+func (o *httpOptions) SetLogger(logger *slog.Logger) {
+	o.logger = logger
+}
+
+// log returns the logger of the server
+func (o *httpOptions) log() *slog.Logger {
+	if o.logger == nil {
+		return slog.Default()
+	}
+	return o.logger
+}
+
+// accessLog assigns each request a correlation ID and logs it when done,
+// with its status, size and duration
+func (o *httpOptions) accessLog(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		id := r.Header.Get(requestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		w.Header().Set(requestIDHeader, id)
+		r = r.WithContext(withRequestID(r.Context(), id))
+
+		aw := &accessWriter{ResponseWriter: w}
+		next.ServeHTTP(aw, r)
+
+		status := aw.status
+		if status == 0 {
+			// Hijacked connections (WebSockets) have no status of their own
+			status = http.StatusOK
+			if aw.hijacked {
+				status = http.StatusSwitchingProtocols
+			}
+		}
+		o.log().Info("request",
+			"request_id", id,
+			"method", r.Method,
+			"path", r.URL.Path,
+			"query", r.URL.RawQuery,
+			"status", status,
+			"bytes", aw.bytes,
+			"duration_ms", float64(time.Since(start).Microseconds())/1000,
+			"remote", r.RemoteAddr,
+			"user_agent", r.UserAgent(),
+		)
+	})
+}
+
+// accessWriter records the status and size of a response
+type accessWriter struct {
+	http.ResponseWriter
+	status   int
+	bytes    int64
+	hijacked bool
+}
+
+// WriteHeader records the status code
+func (aw *accessWriter) WriteHeader(code int) {
+	if aw.status == 0 {
+		aw.status = code
+	}
+	aw.ResponseWriter.WriteHeader(code)
+}
+
+// Write counts the bytes written
+func (aw *accessWriter) Write(b []byte) (int, error) {
+	if aw.status == 0 {
+		aw.status = http.StatusOK
+	}
+	n, err := aw.ResponseWriter.Write(b)
+	aw.bytes += int64(n)
+	return n, err
+}
+
+// Flush passes flushes through, for event streams
+func (aw *accessWriter) Flush() {
+	if f, ok := aw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack passes hijacking through, for WebSocket upgrades
+func (aw *accessWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := aw.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("response does not support hijacking")
+	}
+	aw.hijacked = true
+	return h.Hijack()
+}
+
+// Unwrap returns the underlying writer, for http.ResponseController
+func (aw *accessWriter) Unwrap() http.ResponseWriter {
+	return aw.ResponseWriter
+}
@@ -0,0 +1,299 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/atomicdeploy/patris-export/pkg/datasource"
+	"github.com/atomicdeploy/patris-export/pkg/watcher"
+	"github.com/gorilla/mux"
+)
+
+// tableNamePattern matches names usable as a path segment
+var tableNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// reservedTableNames are path segments used by Multi's own routes
+var reservedTableNames = map[string]bool{"api": true, "ws": true, "events": true, "stats": true}
+
+// Multi serves several tables from one process. Each table is a Server with
+// its own watcher and WebSocket clients. A table's API is routed as
+// /api/{table}/... (e.g. /api/kala/records), its WebSocket as /ws/{table},
+// its event stream as /events/{table}, and its pages under /{table}/.
+type Multi struct {
+	router *mux.Router
+	tables map[string]*Server
+	httpOptions
+}
+
+// NewMulti creates a server for several tables; add them with AddTable
+func NewMulti() *Multi {
+	m := &Multi{
+		router: mux.NewRouter(),
+		tables: make(map[string]*Server),
+	}
+
+	m.router.HandleFunc("/", m.handleIndex).Methods("GET")
+	m.router.HandleFunc("/api/tables", m.handleListTables).Methods("GET")
+	m.router.HandleFunc("/api/stats", m.handleGetStats).Methods("GET")
+	m.router.HandleFunc("/stats", handleStatsPage).Methods("GET")
+	m.router.PathPrefix("/api/{table}/").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		m.forward(w, r, "/api/"+strings.SplitN(r.URL.Path, "/", 4)[3])
+	})
+	m.router.HandleFunc("/ws/{table}", func(w http.ResponseWriter, r *http.Request) {
+		m.forward(w, r, "/ws")
+	})
+	m.router.HandleFunc("/events/{table}", func(w http.ResponseWriter, r *http.Request) {
+		m.forward(w, r, "/events")
+	}).Methods("GET")
+	m.router.HandleFunc("/{table}", func(w http.ResponseWriter, r *http.Request) {
+		// Relative links in the table's pages need the trailing slash
+		if _, ok := m.tables[mux.Vars(r)["table"]]; !ok {
+			http.NotFound(w, r)
+			return
+		}
+		target := url.URL{Path: r.URL.Path + "/", RawQuery: r.URL.RawQuery}
+		http.Redirect(w, r, target.String(), http.StatusMovedPermanently)
+	})
+	m.router.PathPrefix("/{table}/").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		m.forward(w, r, "/"+strings.SplitN(r.URL.Path, "/", 3)[2])
+	})
+	m.router.Use(m.requireAuth)
+
+	return m
+}
+
+// AddTable serves a table's server under name. Names are lower case letters,
+// digits, '-' and '_'.
+func (m *Multi) AddTable(name string, srv *Server) error {
+	if !tableNamePattern.MatchString(name) || reservedTableNames[name] {
+		return fmt.Errorf("invalid table name %q", name)
+	}
+	if _, ok := m.tables[name]; ok {
+		return fmt.Errorf("table %s is served twice", name)
+	}
+
+	srv.SetBasePath("/" + name)
+	srv.origins = m.origins
+	srv.logger = m.log().With("table", name)
+	m.tables[name] = srv
+	return nil
+}
+
+// SetAllowedOrigins sets the origins allowed to use the API of all tables
+func (m *Multi) SetAllowedOrigins(origins []string) {
+	m.httpOptions.SetAllowedOrigins(origins)
+	for _, srv := range m.tables {
+		srv.origins = m.origins
+	}
+}
+
+// SetLogger sets the logger of all tables; their events are logged with
+// the table name
+func (m *Multi) SetLogger(logger *slog.Logger) {
+	m.httpOptions.SetLogger(logger)
+	for name, srv := range m.tables {
+		srv.logger = m.log().With("table", name)
+	}
+}
+
+// Names returns the table names in sorted order
+func (m *Multi) Names() []string {
+	names := make([]string, 0, len(m.tables))
+	for name := range m.tables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// forward serves a request with a table's server, as if it had been made to
+// path on that server
+func (m *Multi) forward(w http.ResponseWriter, r *http.Request, path string) {
+	srv, ok := m.tables[mux.Vars(r)["table"]]
+	if !ok {
+		http.Error(w, fmt.Sprintf("Table not found: %s", mux.Vars(r)["table"]), http.StatusNotFound)
+		return
+	}
+
+	routed := r.Clone(r.Context())
+	routed.URL.Path = path
+	routed.URL.RawPath = ""
+	srv.router.ServeHTTP(w, routed)
+}
+
+// handleListTables lists the served tables and their endpoints
+func (m *Multi) handleListTables(w http.ResponseWriter, r *http.Request) {
+	tables := make([]map[string]interface{}, 0, len(m.tables))
+	for _, name := range m.Names() {
+		tables = append(tables, map[string]interface{}{
+			"name":      name,
+			"database":  filepath.Base(m.tables[name].dbPath),
+			"records":   "/api/" + name + "/records",
+			"info":      "/api/" + name + "/info",
+			"changes":   "/api/" + name + "/changes",
+			"websocket": "/ws/" + name,
+			"events":    "/events/" + name,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"count":   len(tables),
+		"tables":  tables,
+	})
+}
+
+// handleIndex lists the served tables
+func (m *Multi) handleIndex(w http.ResponseWriter, r *http.Request) {
+	var items strings.Builder
+	for _, name := range m.Names() {
+		n := html.EscapeString(name)
+		fmt.Fprintf(&items, `
+        <div class="endpoint">
+            <strong>%s</strong> (%s)<br>
+            <a href="/api/%s/records">Records</a> ·
+            <a href="/api/%s/info">Info</a> ·
+            <a href="/%s/">Table page</a> ·
+            WebSocket <code>/ws/%s</code> ·
+            Events <code>/events/%s</code>
+        </div>`, n, html.EscapeString(filepath.Base(m.tables[name].dbPath)), n, n, n, n, n)
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	fmt.Fprintf(w, `<!DOCTYPE html>
+<html>
+<head>
+    <meta charset="utf-8">
+    <title>Patris Export API</title>
+    <style>
+        body { font-family: 'Segoe UI', Tahoma, Geneva, Verdana, sans-serif; max-width: 800px; margin: 50px auto; padding: 20px; background: #f5f5f5; }
+        .container { background: white; padding: 30px; border-radius: 10px; box-shadow: 0 2px 10px rgba(0,0,0,0.1); }
+        h1 { color: #2c3e50; }
+        .endpoint { background: #ecf0f1; padding: 15px; margin: 10px 0; border-radius: 5px; border-left: 4px solid #3498db; }
+        .endpoint code { color: #e74c3c; font-weight: bold; }
+        a { color: #3498db; text-decoration: none; }
+        a:hover { text-decoration: underline; }
+    </style>
+</head>
+<body>
+    <div class="container">
+        <h1>📊 Patris Export API</h1>
+        <p>Serving %d tables. <a href="/api/tables">List as JSON →</a> · <a href="/stats">Stats →</a></p>
+        %s
+    </div>
+</body>
+</html>
+`, len(m.tables), items.String())
+}
+
+// SetWatchOptions selects how the tables' database files are watched
+func (m *Multi) SetWatchOptions(opts watcher.Options) {
+	for _, srv := range m.tables {
+		srv.SetWatchOptions(opts)
+	}
+}
+
+// StartWatching watches each table's database file with its own watcher
+func (m *Multi) StartWatching(debounceDuration time.Duration) error {
+	for _, name := range m.Names() {
+		if err := m.tables[name].StartWatching(debounceDuration); err != nil {
+			return fmt.Errorf("table %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// WatchCharMap reloads the character mapping when the file changes and then
+// sends a full update to the clients of every table
+func (m *Multi) WatchCharMap(path string, debounceDuration time.Duration) error {
+	names := m.Names()
+	if len(names) == 0 {
+		return fmt.Errorf("no tables to serve")
+	}
+	return m.watchCharMap(m.tables[names[0]].watcher, path, debounceDuration, m.Resync)
+}
+
+// Pause stops broadcasting updates for all tables
+func (m *Multi) Pause() {
+	for _, srv := range m.tables {
+		srv.Pause()
+	}
+}
+
+// Resume restarts broadcasting for all tables and sends queued updates
+func (m *Multi) Resume() {
+	for _, srv := range m.tables {
+		srv.Resume()
+	}
+}
+
+// Resync sends a full update to the clients of every table
+func (m *Multi) Resync() {
+	for _, srv := range m.tables {
+		srv.Resync()
+	}
+}
+
+// FlushQueues sends the queued updates of all tables, reporting whether
+// there were any
+func (m *Multi) FlushQueues() bool {
+	flushed := false
+	for _, srv := range m.tables {
+		if srv.FlushQueues() {
+			flushed = true
+		}
+	}
+	return flushed
+}
+
+// Status reports the runtime state of each table
+func (m *Multi) Status() map[string]interface{} {
+	tables := make(map[string]interface{}, len(m.tables))
+	for name, srv := range m.tables {
+		tables[name] = srv.Status()
+	}
+	return map[string]interface{}{"tables": tables}
+}
+
+// Start starts the HTTP server for all tables
+func (m *Multi) Start(addr string) error {
+	if len(m.tables) == 0 {
+		return fmt.Errorf("no tables to serve")
+	}
+
+	m.log().Info("starting server", "addr", addr)
+	for _, name := range m.Names() {
+		dbPath := m.tables[name].dbPath
+		if _, err := os.Stat(dbPath); os.IsNotExist(err) && !datasource.IsRemote(dbPath) {
+			return fmt.Errorf("database file does not exist: %s", dbPath)
+		}
+		m.log().Info("serving table", "table", name, "database", filepath.Base(dbPath))
+		m.tables[name].checkKeyField()
+		m.tables[name].resume()
+	}
+
+	return m.listenAndServe(addr, m.router)
+}
+
+// Close cleans up the resources of all tables
+func (m *Multi) Close() error {
+	var errs []error
+	for _, srv := range m.tables {
+		if err := srv.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,62 @@
+package server
+
+import (
+	"log/slog"
+	"net/http"
+	"sync"
+
+	"github.com/atomicdeploy/patris-export/pkg/auth"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// httpOptions holds the HTTP settings shared by a single-table Server and a
+// Multi serving several tables
+type httpOptions struct {
+	// authMiddleware checks credentials; nil leaves the API open
+	authMiddleware func(http.Handler) http.Handler
+	authenticator  *auth.Authenticator
+	logger         *slog.Logger
+	tls            *TLSConfig
+	origins        originPolicy
+	networks       networkPolicy
+	noCompression  bool
+	webDir         string
+
+	autocertOnce    sync.Once
+	autocertManager *autocert.Manager
+}
+
+// SetAuthenticator requires API keys or JWTs on the REST, WebSocket and
+// gRPC endpoints
+func (o *httpOptions) SetAuthenticator(a *auth.Authenticator) {
+	o.authenticator = a
+	o.authMiddleware = a.Middleware("/")
+}
+
+// requireAuth rejects requests without valid credentials when an
+// authenticator is set. The index page stays public.
+func (o *httpOptions) requireAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if o.authMiddleware == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		o.authMiddleware(next).ServeHTTP(w, r)
+	})
+}
+
+// SetCompression enables or disables gzip/deflate compression of responses
+// (enabled by default)
+func (o *httpOptions) SetCompression(enabled bool) {
+	o.noCompression = !enabled
+}
+
+// handler wraps a router with access logging, the network allowlist, CORS,
+// compression and the files of the web directory
+func (o *httpOptions) handler(router http.Handler) http.Handler {
+	router = o.webAssets(router)
+	if !o.noCompression {
+		router = compress(router)
+	}
+	return o.accessLog(o.restrictNetworks(cors(o.origins, router)))
+}
@@ -0,0 +1,94 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/jmespath/go-jmespath"
+)
+
+// maxQueryLength limits the length of query expressions
+const maxQueryLength = 4096
+
+// maxQueryError limits the length of query errors, which quote the values
+// the expression failed on
+const maxQueryError = 200
+
+// handleQuery evaluates the JMESPath expression in ?q= against the records,
+// keyed by record code as in /api/records, and returns only its result, so
+// clients computing a count or a few fields need not fetch every record
+func (s *Server) handleQuery(w http.ResponseWriter, r *http.Request) {
+	expr := r.URL.Query().Get("q")
+	if expr == "" {
+		http.Error(w, "Missing query: pass a JMESPath expression as ?q=", http.StatusBadRequest)
+		return
+	}
+	if len(expr) > maxQueryLength {
+		http.Error(w, fmt.Sprintf("Query too long: at most %d bytes", maxQueryLength), http.StatusBadRequest)
+		return
+	}
+	query, err := jmespath.Compile(expr)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid query: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	etag, modified, err := s.recordsValidators(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if notModified(w, r, etag, modified) {
+		return
+	}
+
+	records, err := s.loadRecords()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	data, err := jsonValue(records)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	result, err := query.Search(data)
+	if err != nil {
+		// e.g. a function applied to a value of the wrong type
+		http.Error(w, fmt.Sprintf("Query failed: %s", truncate(err.Error(), maxQueryError)), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"query":   expr,
+		"result":  result,
+	})
+}
+
+// jsonValue converts records to the values they encode to in JSON (numbers
+// as float64, arrays as []interface{}), the only types JMESPath functions
+// such as sum and max_by accept
+func jsonValue(records map[string]interface{}) (interface{}, error) {
+	data, err := json.Marshal(records)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode records: %w", err)
+	}
+	var value interface{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		return nil, fmt.Errorf("failed to decode records: %w", err)
+	}
+	return value, nil
+}
+
+// truncate shortens a string to at most n runes
+func truncate(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return string(runes[:n]) + "…"
+}
@@ -1,61 +1,111 @@
 package server
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"html"
 	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/atomicdeploy/patris-export/pkg/annotations"
+	"github.com/atomicdeploy/patris-export/pkg/audit"
 	"github.com/atomicdeploy/patris-export/pkg/converter"
+	"github.com/atomicdeploy/patris-export/pkg/datasource"
+	"github.com/atomicdeploy/patris-export/pkg/diff"
+	"github.com/atomicdeploy/patris-export/pkg/filecopy"
 	"github.com/atomicdeploy/patris-export/pkg/paradox"
+	"github.com/atomicdeploy/patris-export/pkg/resilient"
 	"github.com/atomicdeploy/patris-export/pkg/watcher"
 	"github.com/gorilla/mux"
 	"github.com/gorilla/websocket"
+	qrcode "github.com/skip2/go-qrcode"
 )
 
 // Server represents the HTTP/WebSocket server
 type Server struct {
-	router      *mux.Router
-	dbPath      string
-	charMap     converter.CharMapping
-	watcher     *watcher.FileWatcher
-	wsClients   map[*websocket.Conn]bool
-	wsClientsMu sync.RWMutex
-	upgrader    websocket.Upgrader
+	router       *mux.Router
+	dbPath       string
+	charMap      converter.CharMapping
+	watcher      *watcher.FileWatcher
+	hub          *wsHub
+	sseClients   map[*sseClient]bool
+	sseMu        sync.Mutex
+	grpcStreams  map[*grpcStream]bool
+	grpcMu       sync.Mutex
+	upgrader     websocket.Upgrader
+	publicURL    string
+	snapshotDir  string
+	profile      *converter.Profile
+	numbers      *converter.NumberFormat
+	basePath     string
+	notes        *annotations.Store
+	diffOptions  diff.Options
+	watchOptions watcher.Options
+	shadowCopy   bool
+	remoteHeader http.Header
+	remoteMaxAge time.Duration
+	// stopPolling stops polling a remote table for changes
+	stopPolling context.CancelFunc
+	httpOptions
+
+	// Records of the database file, read again when its hash changes
+	sourceOnce sync.Once
+	source     *datasource.Cached
+
+	// Last published records and the numbered changes between publishes
+	publishMu sync.Mutex
+	current   map[string]interface{}
+	changes   *changeLog
+	statePath string
+	auditLog  *audit.Log
+	resumed   bool
+
+	// Runtime state exposed through Status and the control socket
+	startTime     time.Time
+	stateMu       sync.Mutex
+	paused        bool
+	pendingUpdate bool
+	broadcasts    int
+	lastBroadcast time.Time
+	lastChange    time.Time
+	resyncs       int
+	lastResync    time.Time
+	changeCounts  changeCounts
+
+	// Records of the last read of the database file
+	cacheMu     sync.Mutex
+	cache       *tableData
+	cacheHits   int
+	cacheMisses int
+	// plainText is set when the source holds Unicode text, as a CSV dump
+	// does, which is not converted with the character map
+	plainText atomic.Bool
 }
 
 // NewServer creates a new server instance
 func NewServer(dbPath string, charMap converter.CharMapping) (*Server, error) {
 	s := &Server{
-		router:    mux.NewRouter(),
-		dbPath:    dbPath,
-		charMap:   charMap,
-		wsClients: make(map[*websocket.Conn]bool),
-		upgrader: websocket.Upgrader{
-			// Security: Configure origin checking for production use
-			// Default allows localhost only
-			CheckOrigin: func(r *http.Request) bool {
-				origin := r.Header.Get("Origin")
-				// Allow empty origin (direct connections, testing)
-				if origin == "" {
-					return true
-				}
-				// Allow localhost for development
-				if origin == "http://localhost:8080" || origin == "http://127.0.0.1:8080" {
-					return true
-				}
-				// For production: Add your domain(s) here and remove the default true below
-				// Example: return origin == "https://yourdomain.com"
-				// Currently allowing all origins for initial deployment - CHANGE THIS IN PRODUCTION!
-				log.Printf("⚠️  WebSocket connection from origin: %s (origin check bypassed - configure for production!)", origin)
-				return true
-			},
-		},
+		router:      mux.NewRouter(),
+		dbPath:      dbPath,
+		charMap:     charMap,
+		hub:         newWSHub(),
+		sseClients:  make(map[*sseClient]bool),
+		grpcStreams: make(map[*grpcStream]bool),
+		changes:     newChangeLog(defaultChangeHistory),
+		startTime:   time.Now(),
 	}
+	s.upgrader.CheckOrigin = s.checkWebSocketOrigin
+	go s.runHub()
 
 	// Set up routes
 	s.setupRoutes()
@@ -68,7 +118,23 @@ func (s *Server) setupRoutes() {
 	s.router.HandleFunc("/", s.handleIndex).Methods("GET")
 	s.router.HandleFunc("/api/records", s.handleGetRecords).Methods("GET")
 	s.router.HandleFunc("/api/info", s.handleGetInfo).Methods("GET")
+	s.router.HandleFunc("/api/changes", s.handleGetChanges).Methods("GET")
+	s.router.HandleFunc("/api/stats", s.handleGetStats).Methods("GET")
+	s.router.HandleFunc("/api/query", s.handleQuery).Methods("GET")
+	s.router.HandleFunc("/api/export.{format:csv|xlsx|json}", s.handleExport).Methods("GET")
+	s.router.HandleFunc("/api/records/{code}", s.handleGetRecord).Methods("GET")
+	s.router.HandleFunc("/api/records/{code}/qr", s.handleRecordQR).Methods("GET")
+	s.router.HandleFunc("/api/annotations", s.handleListAnnotations).Methods("GET")
+	s.router.HandleFunc("/api/annotations/{code}", s.handleSetAnnotation).Methods("POST")
+	s.router.HandleFunc("/api/annotations/{code}", s.handleDeleteAnnotation).Methods("DELETE")
+	s.router.HandleFunc("/r/{code}", s.handleShareRecord).Methods("GET")
+	s.router.HandleFunc("/api/snapshots", s.handleListSnapshots).Methods("GET")
+	s.router.HandleFunc("/api/compare", s.handleCompare).Methods("GET")
+	s.router.HandleFunc("/compare", s.handleComparePage).Methods("GET")
+	s.router.HandleFunc("/stats", handleStatsPage).Methods("GET")
 	s.router.HandleFunc("/ws", s.handleWebSocket)
+	s.router.HandleFunc("/events", s.handleEvents).Methods("GET")
+	s.router.Use(s.requireAuth)
 }
 
 // handleIndex serves a simple welcome page
@@ -124,13 +190,41 @@ func (s *Server) handleIndex(w http.ResponseWriter, r *http.Request) {
         <div class="endpoint">
             <strong>GET</strong> <code>/api/records</code><br>
             Get all database records in JSON format<br>
-            <a href="/api/records">Try it →</a>
+            <a href="api/records">Try it →</a>
         </div>
         
         <div class="endpoint">
             <strong>GET</strong> <code>/api/info</code><br>
             Get database schema information<br>
-            <a href="/api/info">Try it →</a>
+            <a href="api/info">Try it →</a>
+        </div>
+        
+        <div class="endpoint">
+            <strong>GET</strong> <code>/api/export.csv</code>, <code>/api/export.xlsx</code>, <code>/api/export.json</code><br>
+            Download a fresh export of the table<br>
+            <a href="api/export.csv">CSV</a> · <a href="api/export.xlsx">Excel</a> · <a href="api/export.json">JSON</a>
+        </div>
+        
+        <div class="endpoint">
+            <strong>GET</strong> <code>/api/records/{code}/qr</code><br>
+            QR code (PNG) with a share link for a single record
+        </div>
+        
+        <div class="endpoint">
+            <strong>GET</strong> <code>/api/compare?a=snap1&amp;b=snap2</code><br>
+            Changes between two snapshots (or <code>current</code>)<br>
+            <a href="compare">Open compare view →</a>
+        </div>
+        
+        <div class="endpoint">
+            <strong>GET</strong> <code>/api/query?q=length(values(@))</code><br>
+            Result of a JMESPath expression evaluated against the records
+        </div>
+        
+        <div class="endpoint">
+            <strong>GET</strong> <code>/api/stats</code><br>
+            Uptime, clients, database file, broadcasts, changes and memory use<br>
+            <a href="stats">Open stats dashboard →</a>
         </div>
         
         <div class="endpoint">
@@ -138,6 +232,18 @@ func (s *Server) handleIndex(w http.ResponseWriter, r *http.Request) {
             Connect via WebSocket for real-time updates
         </div>
         
+        <div class="endpoint">
+            <strong>GET</strong> <code>/events</code><br>
+            The same updates as Server-Sent Events, for proxies without WebSocket support
+        </div>
+        
+        <h2>Share a Record:</h2>
+        <form onsubmit="document.getElementById('qr').src='api/records/'+encodeURIComponent(this.code.value)+'/qr'; document.getElementById('qr').style.display='block'; return false;">
+            <input name="code" placeholder="Record code" style="padding: 8px; width: 200px;">
+            <button type="submit" style="padding: 8px 16px;">Show QR</button>
+        </form>
+        <img id="qr" alt="QR code" style="display: none; margin-top: 15px;">
+        
         <p style="margin-top: 30px; color: #7f8c8d; font-size: 14px;">
             🔄 The server watches the database file and broadcasts changes via WebSocket.
         </p>
@@ -147,23 +253,98 @@ func (s *Server) handleIndex(w http.ResponseWriter, r *http.Request) {
 `)
 }
 
-// handleGetRecords returns all database records as JSON
+// loadRecords reads the database and returns the converted, transformed
+// records keyed by Code, with their annotations
+func (s *Server) loadRecords() (map[string]interface{}, error) {
+	records, err := s.readRecords()
+	if err != nil {
+		return nil, err
+	}
+	return s.annotate(records), nil
+}
+
+// readRecords is like loadRecords but leaves out the annotations, giving
+// the records as the convert command exports them. The records are shared
+// with the cache and must not be modified.
+func (s *Server) readRecords() (map[string]interface{}, error) {
+	t, err := s.table()
+	if err != nil {
+		return nil, err
+	}
+	return t.transformed, nil
+}
+
+// loadMatchingRecords is like loadRecords but only keeps the records matching filter
+func (s *Server) loadMatchingRecords(filter *converter.Filter) (map[string]interface{}, error) {
+	t, err := s.table()
+	if err != nil {
+		return nil, err
+	}
+	if err := filter.Bind(t.fields); err != nil {
+		return nil, &filterError{err}
+	}
+
+	exp := s.newExporter()
+	exp.SetFilter(filter)
+	transformed, err := exp.ConvertFilterAndTransformRecords(t.records)
+	if err != nil {
+		return nil, &filterError{err}
+	}
+
+	return s.annotate(transformed), nil
+}
+
+// filterError is returned for filters that cannot be applied to the table
+type filterError struct {
+	err error
+}
+
+func (e *filterError) Error() string { return e.err.Error() }
+
+func (e *filterError) Unwrap() error { return e.err }
+
+// handleGetRecords returns all database records as JSON, or only those
+// matching the ?filter= expression
 func (s *Server) handleGetRecords(w http.ResponseWriter, r *http.Request) {
-	db, err := paradox.Open(s.dbPath)
+	// Polling clients get 304 without the database being read
+	etag, modified, err := s.recordsValidators(r)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed to open database: %v", err), http.StatusInternalServerError)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if notModified(w, r, etag, modified) {
 		return
 	}
-	defer db.Close()
 
-	records, err := db.GetRecords()
+	var transformed map[string]interface{}
+
+	if expr := r.URL.Query().Get("filter"); expr != "" {
+		filter, perr := converter.ParseFilter(expr)
+		if perr != nil {
+			http.Error(w, perr.Error(), http.StatusBadRequest)
+			return
+		}
+		transformed, err = s.loadMatchingRecords(filter)
+	} else {
+		transformed, err = s.loadRecords()
+	}
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed to read records: %v", err), http.StatusInternalServerError)
+		var ferr *filterError
+		if errors.As(err, &ferr) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	// Convert and transform records to match the format used by the convert command
-	transformed := s.convertAndTransformRecords(records)
+	if fields := parseFields(r.URL.Query().Get("fields")); fields != nil {
+		if err := checkFields(transformed, fields); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		transformed = projectRecords(transformed, fields)
+	}
 
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
 	json.NewEncoder(w).Encode(map[string]interface{}{
@@ -173,56 +354,256 @@ func (s *Server) handleGetRecords(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-// handleGetInfo returns database schema information
-func (s *Server) handleGetInfo(w http.ResponseWriter, r *http.Request) {
-	db, err := paradox.Open(s.dbPath)
+// handleGetRecord returns a single record by code. Responses carry an ETag,
+// so clients polling an item with If-None-Match get 304 Not Modified until
+// the record changes.
+func (s *Server) handleGetRecord(w http.ResponseWriter, r *http.Request) {
+	code := mux.Vars(r)["code"]
+
+	transformed, err := s.loadRecords()
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed to open database: %v", err), http.StatusInternalServerError)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	defer db.Close()
 
-	fields, err := db.GetFields()
+	code, record, ok := findRecord(transformed, code)
+	if !ok {
+		http.Error(w, fmt.Sprintf("Record not found: %s", code), http.StatusNotFound)
+		return
+	}
+
+	if fields := parseFields(r.URL.Query().Get("fields")); fields != nil {
+		if err := checkFields(transformed, fields); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		record = projectRecord(record, fields)
+	}
+
+	body, err := json.Marshal(map[string]interface{}{
+		"success": true,
+		"code":    code,
+		"record":  record,
+	})
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed to get fields: %v", err), http.StatusInternalServerError)
+		http.Error(w, fmt.Sprintf("Failed to encode record: %v", err), http.StatusInternalServerError)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json; charset=utf-8")
-	json.NewEncoder(w).Encode(map[string]interface{}{
+	writeWithETag(w, r, "application/json; charset=utf-8", append(body, '\n'))
+}
+
+// SetProfile sets the table profile used to transform records
+func (s *Server) SetProfile(profile *converter.Profile) {
+	s.profile = profile
+}
+
+// SetNumberFormat sets how number and currency values are rounded in API
+// responses and updates
+func (s *Server) SetNumberFormat(format converter.NumberFormat) {
+	s.numbers = &format
+}
+
+// SetPublicURL sets the base URL used in record share links (e.g. http://192.168.1.10:8080).
+// When empty, the base is derived from each request's Host header.
+func (s *Server) SetPublicURL(publicURL string) {
+	s.publicURL = strings.TrimSuffix(publicURL, "/")
+}
+
+// SetBasePath sets the path the server's pages are served under when it is
+// one table of a Multi (e.g. /kala)
+func (s *Server) SetBasePath(basePath string) {
+	s.basePath = strings.TrimSuffix(basePath, "/")
+}
+
+// shareURL returns the compact share link for a record
+func (s *Server) shareURL(r *http.Request, code string) string {
+	base := s.publicURL
+	if base == "" {
+		scheme := "http"
+		if r.TLS != nil {
+			scheme = "https"
+		}
+		base = scheme + "://" + r.Host
+	}
+	return base + s.basePath + "/r/" + url.PathEscape(code)
+}
+
+// handleRecordQR renders a QR code containing the share link of a single record.
+// Use ?size=N to set the image size in pixels and ?format=json to get the link instead.
+func (s *Server) handleRecordQR(w http.ResponseWriter, r *http.Request) {
+	code := mux.Vars(r)["code"]
+
+	transformed, err := s.loadRecords()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	code, _, ok := findRecord(transformed, code)
+	if !ok {
+		http.Error(w, fmt.Sprintf("Record not found: %s", code), http.StatusNotFound)
+		return
+	}
+
+	link := s.shareURL(r, code)
+
+	if r.URL.Query().Get("format") == "json" {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": true,
+			"code":    code,
+			"url":     link,
+		})
+		return
+	}
+
+	size := 256
+	if sizeStr := r.URL.Query().Get("size"); sizeStr != "" {
+		size, err = strconv.Atoi(sizeStr)
+		if err != nil || size < 64 || size > 2048 {
+			http.Error(w, "size must be between 64 and 2048", http.StatusBadRequest)
+			return
+		}
+	}
+
+	png, err := qrcode.Encode(link, qrcode.Medium, size)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to generate QR code: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Write(png)
+}
+
+// handleShareRecord renders a compact, phone-friendly page for a shared record link
+func (s *Server) handleShareRecord(w http.ResponseWriter, r *http.Request) {
+	code := mux.Vars(r)["code"]
+
+	transformed, err := s.loadRecords()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	code, found, _ := findRecord(transformed, code)
+	record, ok := found.(map[string]interface{})
+	if !ok {
+		http.Error(w, fmt.Sprintf("Record not found: %s", code), http.StatusNotFound)
+		return
+	}
+
+	fields := make([]string, 0, len(record))
+	for field := range record {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	var rows strings.Builder
+	for _, field := range fields {
+		fmt.Fprintf(&rows, "<tr><th>%s</th><td>%s</td></tr>\n",
+			html.EscapeString(field), html.EscapeString(fmt.Sprintf("%v", record[field])))
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	fmt.Fprintf(w, `<!DOCTYPE html>
+<html>
+<head>
+    <meta charset="utf-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1">
+    <title>%s</title>
+    <style>
+        body { font-family: Tahoma, sans-serif; margin: 20px; }
+        table { border-collapse: collapse; width: 100%%; }
+        th, td { border-bottom: 1px solid #ddd; padding: 8px; text-align: start; }
+        td { direction: auto; unicode-bidi: plaintext; }
+    </style>
+</head>
+<body>
+    <h2>📦 %s</h2>
+    <table>
+%s    </table>
+</body>
+</html>
+`, html.EscapeString(code), html.EscapeString(code), rows.String())
+}
+
+// handleGetInfo returns database schema information
+func (s *Server) handleGetInfo(w http.ResponseWriter, r *http.Request) {
+	data, err := s.table()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to read database: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	info := map[string]interface{}{
 		"success":     true,
 		"file":        filepath.Base(s.dbPath),
-		"num_records": db.GetNumRecords(),
-		"num_fields":  db.GetNumFields(),
-		"fields":      fields,
-	})
+		"num_records": len(data.records),
+		"num_fields":  len(data.fields),
+		"fields":      data.fields,
+		"io":          resilient.Stats(),
+	}
+	// Only Paradox tables, which hold encoded text, have a format version
+	if !s.plainText.Load() {
+		if source, err := s.openSource(); err == nil {
+			if db, ok := source.(*datasource.Paradox); ok {
+				info["version"] = db.Version()
+			}
+			source.Close()
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(w).Encode(info)
 }
 
-// handleWebSocket handles WebSocket connections
+// handleWebSocket handles WebSocket connections. A client connecting with
+// ?since=<seq> receives change sets: first the ones it missed since seq (or
+// a full update if they are no longer known), then each new one. Other
+// clients receive a full update on connect and on every change.
 func (s *Server) handleWebSocket(w http.ResponseWriter, r *http.Request) {
-	conn, err := s.upgrader.Upgrade(w, r, nil)
+	since, delta, err := parseSince(r.URL.Query().Get("since"))
 	if err != nil {
-		log.Printf("Failed to upgrade to WebSocket: %v", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	s.wsClientsMu.Lock()
-	s.wsClients[conn] = true
-	s.wsClientsMu.Unlock()
-
-	log.Printf("🔌 New WebSocket connection (total: %d)", len(s.wsClients))
+	conn, err := s.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		s.log().Warn("WebSocket upgrade failed", "request_id", RequestID(r.Context()), "error", err)
+		return
+	}
+	client := &wsClient{
+		conn:      conn,
+		send:      make(chan []byte, wsQueueSize),
+		delta:     delta,
+		requestID: RequestID(r.Context()),
+	}
 
-	// Send initial data
-	s.sendRecordsToClient(conn)
+	// Register and catch up without a publish in between, so no change is
+	// missed or sent twice: the writer sends the catch-up messages before
+	// the ones queued by later publishes
+	s.publishMu.Lock()
+	if !s.registerWS(client) {
+		s.publishMu.Unlock()
+		conn.Close()
+		return
+	}
+	messages, err := s.catchUp(delta, since)
+	s.publishMu.Unlock()
+	if err != nil {
+		s.log().Error("failed to read records", "request_id", client.requestID, "error", err)
+	}
+	go s.writeWS(client, messages)
 
 	// Handle disconnection
 	go func() {
 		defer func() {
-			s.wsClientsMu.Lock()
-			delete(s.wsClients, conn)
-			s.wsClientsMu.Unlock()
+			s.unregisterWS(client)
 			conn.Close()
-			log.Printf("🔌 WebSocket disconnected (remaining: %d)", len(s.wsClients))
 		}()
 
 		for {
@@ -233,98 +614,382 @@ func (s *Server) handleWebSocket(w http.ResponseWriter, r *http.Request) {
 	}()
 }
 
-// sendRecordsToClient sends current database records to a WebSocket client
-func (s *Server) sendRecordsToClient(conn *websocket.Conn) {
-	db, err := paradox.Open(s.dbPath)
-	if err != nil {
-		log.Printf("Failed to open database: %v", err)
-		return
+// parseSince parses the sequence number a reconnecting client last received;
+// ok is false if none was given
+func parseSince(value string) (seq uint64, ok bool, err error) {
+	if value == "" {
+		return 0, false, nil
 	}
-	defer db.Close()
-
-	records, err := db.GetRecords()
+	seq, err = strconv.ParseUint(value, 10, 64)
 	if err != nil {
-		log.Printf("Failed to read records: %v", err)
-		return
+		return 0, false, fmt.Errorf("invalid sequence number %q", value)
 	}
+	return seq, true, nil
+}
 
-	// Convert and transform records to match the format used by the convert command
-	transformed := s.convertAndTransformRecords(records)
+// broadcastUpdate broadcasts database changes to all connected clients;
+// trigger names the cause in the logs. It returns the error of reading the
+// records.
+func (s *Server) broadcastUpdate(trigger string) error {
+	return s.publish(false, trigger)
+}
 
-	message := map[string]interface{}{
-		"type":      "update",
-		"timestamp": time.Now().Format(time.RFC3339),
-		"count":     len(transformed),
-		"records":   transformed,
-	}
+// SetShadowCopy reads the database through a temporary copy, releasing the
+// file as soon as it is copied so BDE never finds it held open
+func (s *Server) SetShadowCopy(enabled bool) {
+	s.shadowCopy = enabled
+}
 
-	if err := conn.WriteJSON(message); err != nil {
-		log.Printf("Failed to send to WebSocket: %v", err)
-	}
+// SetRemote sets the header sent with the requests for a remote table (e.g.
+// X-API-Key) and how long its records are reused without a request
+func (s *Server) SetRemote(header http.Header, maxAge time.Duration) {
+	s.remoteHeader = header
+	s.remoteMaxAge = maxAge
 }
 
-// broadcastUpdate broadcasts database changes to all connected WebSocket clients
-func (s *Server) broadcastUpdate() {
-	s.wsClientsMu.RLock()
-	defer s.wsClientsMu.RUnlock()
+// openSource opens the table served: a Paradox table, or a copy of it (see
+// SetShadowCopy), a dump of one, or a remote table (see SetRemote)
+func (s *Server) openSource() (datasource.DataSource, error) {
+	return datasource.NewDataSource(s.dbPath, s.sourceOptions())
+}
 
-	if len(s.wsClients) == 0 {
-		return
+// cachedSource returns the table served with its records kept between
+// reads (see datasource.Cached). It is created on first use, after the
+// options have been set.
+func (s *Server) cachedSource() *datasource.Cached {
+	s.sourceOnce.Do(func() {
+		s.source = datasource.NewCached(s.dbPath, s.sourceOptions(), 0)
+	})
+	return s.source
+}
+
+// sourceOptions returns the options the table served is opened with
+func (s *Server) sourceOptions() datasource.Options {
+	return datasource.Options{
+		Shadow: s.shadowCopy,
+		Header: s.remoteHeader,
+		MaxAge: s.remoteMaxAge,
 	}
+}
 
-	log.Printf("📡 Broadcasting update to %d clients", len(s.wsClients))
+// SetWatchOptions selects how StartWatching detects changes of the
+// database file: notifications, polling (for network shares, which deliver
+// no notifications), or polling only for files on network file systems
+func (s *Server) SetWatchOptions(opts watcher.Options) {
+	s.watchOptions = opts
+}
 
-	for conn := range s.wsClients {
-		go s.sendRecordsToClient(conn)
+// pollInterval returns the interval at which a polling watcher checks the
+// file
+func (s *Server) pollInterval() time.Duration {
+	if s.watchOptions.PollInterval > 0 {
+		return s.watchOptions.PollInterval
 	}
+	return watcher.DefaultPollInterval
 }
 
 // StartWatching starts watching the database file for changes with the specified debounce duration
 func (s *Server) StartWatching(debounceDuration time.Duration) error {
-	fw, err := watcher.NewFileWatcher()
+	if datasource.IsRemote(s.dbPath) {
+		return s.pollRemote()
+	}
+
+	fw, err := watcher.New(s.watchOptions, s.dbPath)
 	if err != nil {
 		return fmt.Errorf("failed to create file watcher: %w", err)
 	}
 
 	s.watcher = fw
 
-	if err := fw.Watch(s.dbPath, func(path string) {
-		log.Printf("🔄 File changed: %s", filepath.Base(path))
-		s.broadcastUpdate()
+	// Changes are computed against the records at start-up
+	s.resume()
+
+	fw.SetRetry(s.watchOptions.Retry, func(event watcher.Event, err error) {
+		s.log().Error("giving up on file change", "file", filepath.Base(event.Path), "hash", shortHash(event.NewHash), "error", err)
+	})
+	if err := fw.WatchEvents(s.dbPath, func(event watcher.Event) error {
+		s.log().Info("file changed",
+			"file", filepath.Base(event.Path),
+			"kind", string(event.Kind),
+			"size", event.Size,
+			"modified", event.ModTime.UTC().Format(time.RFC3339Nano),
+			"hash", shortHash(event.NewHash),
+			"previous_hash", shortHash(event.OldHash))
+		if event.Size == 0 {
+			// Truncated by a writer that has not written the table yet
+			s.log().Warn("database file is empty; waiting for the next change", "file", filepath.Base(event.Path))
+			return nil
+		}
+		return s.handleChange("file_change")
 	}, debounceDuration); err != nil {
 		return fmt.Errorf("failed to watch file: %w", err)
 	}
 
-	fw.Start()
-	log.Printf("👀 Watching database file: %s", filepath.Base(s.dbPath))
+	fw.Start(context.Background())
+	if fw.Polling() {
+		s.log().Info("polling database file", "file", filepath.Base(s.dbPath), "interval", s.pollInterval().String())
+	} else {
+		s.log().Info("watching database file", "file", filepath.Base(s.dbPath))
+	}
+
+	return nil
+}
+
+// pollRemote fetches a remote table every poll interval and broadcasts
+// its changes. A watcher without files is still created, so the character
+// mapping file can be watched.
+func (s *Server) pollRemote() error {
+	fw, err := watcher.New(watcher.Options{Mode: watcher.ModeNotify})
+	if err != nil {
+		return fmt.Errorf("failed to create file watcher: %w", err)
+	}
+	s.watcher = fw
+	fw.Start(context.Background())
+
+	// Changes are computed against the records at start-up
+	s.resume()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s.stopPolling = cancel
+	go func() {
+		version, _, _ := s.sourceVersion()
+		ticker := time.NewTicker(s.pollInterval())
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			current, _, err := s.sourceVersion()
+			if err != nil {
+				s.log().Warn("failed to fetch remote table", "url", s.dbPath, "error", err)
+				continue
+			}
+			if current == version {
+				continue
+			}
+			s.log().Info("remote table changed", "url", s.dbPath, "hash", shortHash(current), "previous_hash", shortHash(version))
+			version = current
+			if err := s.handleChange("remote_change"); err != nil {
+				s.log().Error("failed to publish remote change", "url", s.dbPath, "error", err)
+			}
+		}
+	}()
+
+	s.log().Info("polling remote table", "url", s.dbPath, "interval", s.pollInterval().String())
+	return nil
+}
+
+// shortHash abbreviates a file hash for the logs
+func shortHash(hash string) string {
+	if len(hash) > 12 {
+		return hash[:12]
+	}
+	return hash
+}
+
+// WatchCharMap reloads the character mapping when the mapping file changes
+// and sends the records converted with the new mapping to all clients. It
+// must be called after StartWatching.
+func (s *Server) WatchCharMap(path string, debounceDuration time.Duration) error {
+	return s.watchCharMap(s.watcher, path, debounceDuration, s.Resync)
+}
+
+// watchCharMap reloads the character mapping when the file changes and then
+// calls resync
+func (o *httpOptions) watchCharMap(fw *watcher.FileWatcher, path string, debounceDuration time.Duration, resync func()) error {
+	if fw == nil {
+		return fmt.Errorf("file watching is not started")
+	}
+
+	if err := fw.Watch(path, func(path string) {
+		if err := converter.ReloadCharMapping(path); err != nil {
+			o.log().Warn("keeping the current character mapping", "error", err)
+			return
+		}
+		o.log().Info("character mapping reloaded", "file", filepath.Base(path))
+		resync()
+	}, debounceDuration); err != nil {
+		return fmt.Errorf("failed to watch character mapping: %w", err)
+	}
 
+	o.log().Info("watching character mapping", "file", filepath.Base(path))
 	return nil
 }
 
+// handleChange broadcasts a change, or queues it while broadcasting is
+// paused; trigger names the cause in the logs. It returns the error of
+// reading the records.
+func (s *Server) handleChange(trigger string) error {
+	s.stateMu.Lock()
+	s.lastChange = time.Now()
+	if s.paused {
+		s.pendingUpdate = true
+		s.stateMu.Unlock()
+		s.log().Info("broadcasting paused, update queued")
+		return nil
+	}
+	s.stateMu.Unlock()
+
+	return s.broadcastUpdate(trigger)
+}
+
+// Pause stops broadcasting file changes; changes are queued until Resume or FlushQueues
+func (s *Server) Pause() {
+	s.stateMu.Lock()
+	defer s.stateMu.Unlock()
+	s.paused = true
+}
+
+// Resume re-enables broadcasting and sends any update queued while paused
+func (s *Server) Resume() {
+	s.stateMu.Lock()
+	s.paused = false
+	s.stateMu.Unlock()
+
+	s.FlushQueues()
+}
+
+// FlushQueues sends a queued update immediately, even while paused.
+// It reports whether an update was pending.
+func (s *Server) FlushQueues() bool {
+	s.stateMu.Lock()
+	pending := s.pendingUpdate
+	s.pendingUpdate = false
+	s.stateMu.Unlock()
+
+	if pending {
+		s.broadcastUpdate("flush")
+	}
+	return pending
+}
+
+// Resync re-reads the database and sends the full record set to all clients
+func (s *Server) Resync() {
+	s.stateMu.Lock()
+	s.pendingUpdate = false
+	// Cached responses may have been converted with the previous settings
+	s.resyncs++
+	s.lastResync = time.Now()
+	s.stateMu.Unlock()
+
+	s.publish(true, "resync")
+}
+
+// Status returns a snapshot of the server's runtime state
+func (s *Server) Status() map[string]interface{} {
+	clients, evicted, _ := s.wsStats()
+
+	s.stateMu.Lock()
+	defer s.stateMu.Unlock()
+
+	status := map[string]interface{}{
+		"database":        s.dbPath,
+		"uptime":          time.Since(s.startTime).Round(time.Second).String(),
+		"watching":        s.watcher != nil,
+		"paused":          s.paused,
+		"pending_update":  s.pendingUpdate,
+		"clients":         clients,
+		"evicted_clients": evicted,
+		"sse_clients":     s.sseClientCount(),
+		"grpc_streams":    s.grpcStreamCount(),
+		"seq":             s.changes.latest(),
+		"broadcasts":      s.broadcasts,
+		"io":              resilient.Stats(),
+	}
+	if s.watcher != nil {
+		status["watch_mode"] = string(watcher.ModeNotify)
+		if s.watcher.Polling() || s.stopPolling != nil {
+			status["watch_mode"] = string(watcher.ModePoll)
+		}
+	}
+	if busy, ok := filecopy.Retrying(s.dbPath); ok {
+		status["busy"] = busy
+	}
+	if !s.lastBroadcast.IsZero() {
+		status["last_broadcast"] = s.lastBroadcast.Format(time.RFC3339)
+	}
+	if !s.lastChange.IsZero() {
+		status["last_change"] = s.lastChange.Format(time.RFC3339)
+	}
+	if s.notes != nil {
+		status["annotations"] = s.notes.Len()
+	}
+
+	return status
+}
+
 // convertAndTransformRecords converts record text encoding and transforms them
 // to match the format used by the convert command (combines ANBAR fields, removes Sort fields, etc.)
 func (s *Server) convertAndTransformRecords(records []paradox.Record) map[string]interface{} {
-	// Create exporter with Patris2Fa converter and use it to convert and transform records
-	exp := converter.NewExporter(converter.Patris2Fa)
-	return exp.ConvertAndTransformRecords(records)
+	return s.newExporter().ConvertAndTransformRecords(records)
+}
+
+// checkKeyField warns when the table has no field named like the profile's
+// key field: its records would all be skipped, and no change detected
+func (s *Server) checkKeyField() {
+	keyField := s.newExporter().Profile().KeyField
+
+	t, err := s.table()
+	if err != nil {
+		return
+	}
+	for _, field := range t.fields {
+		if field.Name == keyField {
+			return
+		}
+	}
+	s.log().Warn("key field not found in the table; no records will be served",
+		"key_field", keyField,
+		"database", filepath.Base(s.dbPath),
+		"hint", "choose another --profile or --key-field")
+}
+
+// newExporter creates an exporter with the Patris2Fa converter and the
+// server's profile and number format
+func (s *Server) newExporter() *converter.Exporter {
+	convert := converter.Patris2Fa
+	if s.plainText.Load() {
+		convert = nil
+	}
+	exp := converter.NewExporter(convert)
+	exp.SetProfile(s.profile)
+	if s.numbers != nil {
+		exp.SetNumberFormat(*s.numbers)
+	}
+	return exp
 }
 
 // Start starts the HTTP server
 func (s *Server) Start(addr string) error {
-	log.Printf("🚀 Starting server on %s", addr)
-	log.Printf("📊 Serving database: %s", filepath.Base(s.dbPath))
+	s.log().Info("starting server", "addr", addr, "database", filepath.Base(s.dbPath))
 
-	if _, err := os.Stat(s.dbPath); os.IsNotExist(err) {
+	if _, err := os.Stat(s.dbPath); os.IsNotExist(err) && !datasource.IsRemote(s.dbPath) {
 		return fmt.Errorf("database file does not exist: %s", s.dbPath)
 	}
+	s.checkKeyField()
+	s.resume()
 
-	return http.ListenAndServe(addr, s.router)
+	return s.listenAndServe(addr, s.router)
 }
 
 // Close cleans up server resources
 func (s *Server) Close() error {
+	var errs []error
+	// Saved before the change log closes, so both end at the same sequence
+	errs = append(errs, s.saveState())
+	s.closeHub()
+	if s.stopPolling != nil {
+		s.stopPolling()
+	}
 	if s.watcher != nil {
-		return s.watcher.Close()
+		errs = append(errs, s.watcher.Close())
 	}
-	return nil
+	errs = append(errs, s.changes.Close())
+	if s.auditLog != nil {
+		errs = append(errs, s.auditLog.Close())
+	}
+	return errors.Join(errs...)
 }
@@ -0,0 +1,140 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/atomicdeploy/patris-export/pkg/converter"
+	"github.com/gorilla/websocket"
+)
+
+// newTestServer serves testdata/kala.db (codes 101 to 110, 999 and more)
+func newTestServer(t *testing.T) *Server {
+	t.Helper()
+	s, err := NewServer("../../testdata/kala.db", converter.CharMapping{})
+	if err != nil {
+		t.Fatalf("NewServer failed: %v", err)
+	}
+	s.SetProfile(converter.ProfileForFile("kala.db"))
+	s.SetLogger(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+// serve sends a request through the same handler chain as Start, built with
+// the server's current options, and returns the response recorded
+func serve(s *Server, r *http.Request) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	s.handler(s.router).ServeHTTP(w, r)
+	return w
+}
+
+func TestRecordLinksPersianDigits(t *testing.T) {
+	s := newTestServer(t)
+
+	for _, code := range []string{"107", "۱۰۷", "١٠٧"} {
+		path := "/api/records/" + url.PathEscape(code)
+		if w := serve(s, httptest.NewRequest("GET", path, nil)); w.Code != http.StatusOK {
+			t.Errorf("GET %s: expected 200, got %d", path, w.Code)
+		}
+
+		w := serve(s, httptest.NewRequest("GET", path+"/qr?format=json", nil))
+		var link struct {
+			Code string `json:"code"`
+			URL  string `json:"url"`
+		}
+		if w.Code != http.StatusOK {
+			t.Errorf("GET %s/qr: expected 200, got %d", path, w.Code)
+		} else if err := json.Unmarshal(w.Body.Bytes(), &link); err != nil || link.Code != "107" || !strings.HasSuffix(link.URL, "/r/107") {
+			t.Errorf("GET %s/qr: expected the link of 107, got %s (%v)", path, w.Body, err)
+		}
+
+		share := "/r/" + url.PathEscape(code)
+		if w := serve(s, httptest.NewRequest("GET", share, nil)); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "📦 107") {
+			t.Errorf("GET %s: expected the page of 107, got %d", share, w.Code)
+		}
+	}
+
+	if w := serve(s, httptest.NewRequest("GET", "/r/12345", nil)); w.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for an unknown code, got %d", w.Code)
+	}
+}
+
+// readMessages reads n WebSocket messages and returns "seq:type" for each
+func readMessages(t *testing.T, conn *websocket.Conn, n int) []string {
+	t.Helper()
+	var messages []string
+	for i := 0; i < n; i++ {
+		var message struct {
+			Type string `json:"type"`
+			Seq  uint64 `json:"seq"`
+		}
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		if err := conn.ReadJSON(&message); err != nil {
+			t.Fatalf("Failed to read message %d: %v", i+1, err)
+		}
+		messages = append(messages, fmt.Sprintf("%d:%s", message.Seq, message.Type))
+	}
+	return messages
+}
+
+func TestWebSocketReplay(t *testing.T) {
+	s := newTestServer(t)
+	if err := s.SetChangeHistory(2, ""); err != nil {
+		t.Fatalf("SetChangeHistory failed: %v", err)
+	}
+	for _, code := range []string{"101", "102", "103"} {
+		s.changes.add(modified(code))
+	}
+	ts := httptest.NewServer(s.handler(s.router))
+	defer ts.Close()
+
+	tests := []struct {
+		query    string
+		messages string
+	}{
+		{"", "3:update"},
+		{"?since=1", "2:changes 3:changes"},
+		{"?since=2", "3:changes"},
+		// Older than the kept history, or from another history
+		{"?since=0", "3:update"},
+		{"?since=9", "3:update"},
+	}
+	for _, tt := range tests {
+		conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(ts.URL, "http")+"/ws"+tt.query, nil)
+		if err != nil {
+			t.Fatalf("Dial %q failed: %v", tt.query, err)
+		}
+		if messages := strings.Join(readMessages(t, conn, len(strings.Fields(tt.messages))), " "); messages != tt.messages {
+			t.Errorf("%q: expected %q, got %q", tt.query, tt.messages, messages)
+		}
+		conn.Close()
+	}
+
+	// A client that is up to date receives the next publish only
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(ts.URL, "http")+"/ws?since=3", nil)
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	defer conn.Close()
+	// The first publish has no records to compare with, so it is a reset.
+	// The client gets it queued, or replayed if it registers after it.
+	if err := s.publish(false, "test"); err != nil {
+		t.Fatalf("publish failed: %v", err)
+	}
+	if messages := readMessages(t, conn, 1); messages[0] != "4:update" {
+		t.Errorf("Expected the reset as a full update, got %v", messages)
+	}
+
+	if w := serve(s, httptest.NewRequest("GET", "/ws?since=x", nil)); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an invalid since, got %d", w.Code)
+	}
+}
@@ -0,0 +1,148 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/atomicdeploy/patris-export/pkg/diff"
+)
+
+// savedState is the last published state of a table, saved on Close
+type savedState struct {
+	Seq     uint64                 `json:"seq"`
+	SavedAt time.Time              `json:"saved_at"`
+	Records map[string]interface{} `json:"records"`
+}
+
+// SetStateFile saves the last published records and sequence number to a
+// file on Close and resumes from it on start: changes made while the server
+// was stopped are then published as one change set, so clients get a delta
+// instead of a full reload. Call it before StartWatching.
+func (s *Server) SetStateFile(path string) {
+	s.statePath = path
+}
+
+// resume loads the records on start and brings the change history up to
+// date with them. Against a saved state the changes since are recorded as
+// a change set; a resumed history without one gets a reset, as its changes
+// cannot be continued. Only the first call does anything.
+func (s *Server) resume() {
+	s.publishMu.Lock()
+	defer s.publishMu.Unlock()
+
+	if s.resumed {
+		return
+	}
+	s.resumed = true
+
+	records, err := s.loadRecords()
+	if err != nil {
+		// The first publish records a reset instead
+		s.log().Error("failed to read records", "trigger", "start", "error", err)
+		return
+	}
+	s.current = records
+
+	state, err := s.loadState()
+	if err != nil {
+		s.log().Warn("ignoring saved state", "file", filepath.Base(s.statePath), "error", err)
+	}
+
+	switch {
+	case state != nil && s.changes.resumeAt(state.Seq):
+		changes := diff.Records(state.Records, records, s.diffOptions)
+		if !changes.Empty() {
+			entry := s.changes.add(changes)
+			s.countChanges(entry)
+			s.audit(entry, state.Records, records, "start")
+		}
+		s.log().Info("resumed from saved state",
+			"file", filepath.Base(s.statePath),
+			"saved_seq", state.Seq,
+			"seq", s.changes.latest(),
+			"added", len(changes.Added),
+			"modified", len(changes.Modified),
+			"deleted", len(changes.Deleted),
+		)
+	case s.changes.latest() > 0:
+		// Changes made while the server was stopped were not recorded
+		s.countChanges(s.changes.add(nil))
+	}
+}
+
+// loadState reads the saved state, if any, and removes the file: after a
+// crash the state of an older run must not be resumed
+func (s *Server) loadState() (*savedState, error) {
+	if s.statePath == "" {
+		return nil, nil
+	}
+
+	data, err := os.ReadFile(s.statePath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read state: %w", err)
+	}
+	if err := os.Remove(s.statePath); err != nil {
+		return nil, fmt.Errorf("failed to remove state: %w", err)
+	}
+
+	var state savedState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("failed to parse state: %w", err)
+	}
+	if state.Records == nil {
+		return nil, fmt.Errorf("state has no records")
+	}
+	return &state, nil
+}
+
+// saveState writes the last published records and sequence number to the
+// state file, through a temporary file so a partial write is never resumed
+func (s *Server) saveState() error {
+	if s.statePath == "" {
+		return nil
+	}
+
+	s.publishMu.Lock()
+	state := savedState{Seq: s.changes.latest(), SavedAt: time.Now().UTC(), Records: s.current}
+	s.publishMu.Unlock()
+	if state.Records == nil {
+		return nil
+	}
+
+	data, err := json.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("failed to encode state: %w", err)
+	}
+
+	dir := filepath.Dir(s.statePath)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create state directory: %w", err)
+	}
+	tmp, err := os.CreateTemp(dir, filepath.Base(s.statePath)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create state file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write state: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write state: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), s.statePath); err != nil {
+		return fmt.Errorf("failed to replace state: %w", err)
+	}
+
+	s.log().Info("saved state", "file", filepath.Base(s.statePath), "seq", state.Seq, "records", len(state.Records))
+	return nil
+}
@@ -0,0 +1,283 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"runtime"
+	"time"
+
+	"github.com/atomicdeploy/patris-export/pkg/datasource"
+)
+
+// changeCounts totals the published changes since the server started
+type changeCounts struct {
+	ChangeSets int `json:"change_sets"`
+	Resets     int `json:"resets"`
+	Added      int `json:"added"`
+	Modified   int `json:"modified"`
+	Deleted    int `json:"deleted"`
+}
+
+// countChanges adds a published change to the totals
+func (s *Server) countChanges(entry changeEntry) {
+	s.stateMu.Lock()
+	defer s.stateMu.Unlock()
+
+	if entry.Reset {
+		s.changeCounts.Resets++
+		return
+	}
+	s.changeCounts.ChangeSets++
+	s.changeCounts.Added += len(entry.Changes.Added)
+	s.changeCounts.Modified += len(entry.Changes.Modified)
+	s.changeCounts.Deleted += len(entry.Changes.Deleted)
+}
+
+// stats reports the table's uptime, connected clients, database file,
+// broadcasts and change totals
+func (s *Server) stats() map[string]interface{} {
+	wsClients, evicted, dropped := s.wsStats()
+
+	database := s.databaseStats()
+	cache := s.cacheStats()
+	seq := s.changes.latest()
+
+	s.stateMu.Lock()
+	defer s.stateMu.Unlock()
+
+	stats := map[string]interface{}{
+		"started":        s.startTime.UTC().Format(time.RFC3339),
+		"uptime":         time.Since(s.startTime).Round(time.Second).String(),
+		"uptime_seconds": int64(time.Since(s.startTime).Seconds()),
+		"clients": map[string]int{
+			"websocket": wsClients,
+			"sse":       s.sseClientCount(),
+			"grpc":      s.grpcStreamCount(),
+		},
+		// WebSocket clients disconnected for falling behind, and full
+		// updates replaced by a newer one before they were sent
+		"websocket": map[string]int{
+			"evicted":         evicted,
+			"dropped_updates": dropped,
+		},
+		"database":   database,
+		"key_field":  s.newExporter().Profile().KeyField,
+		"watching":   s.watcher != nil,
+		"paused":     s.paused,
+		"broadcasts": s.broadcasts,
+		"resyncs":    s.resyncs,
+		"seq":        seq,
+		"changes":    s.changeCounts,
+		"cache":      cache,
+	}
+	if !s.lastBroadcast.IsZero() {
+		stats["last_broadcast"] = s.lastBroadcast.UTC().Format(time.RFC3339)
+	}
+	if !s.lastChange.IsZero() {
+		stats["last_change"] = s.lastChange.UTC().Format(time.RFC3339)
+	}
+	if s.notes != nil {
+		stats["annotations"] = s.notes.Len()
+	}
+
+	return stats
+}
+
+// databaseStats reports the size, modification time and SHA-256 of the
+// database file
+func (s *Server) databaseStats() map[string]interface{} {
+	database := map[string]interface{}{"path": s.dbPath}
+
+	if datasource.IsRemote(s.dbPath) {
+		hash, modified, err := s.sourceVersion()
+		if err != nil {
+			database["error"] = err.Error()
+			return database
+		}
+		database["modified"] = modified.UTC().Format(time.RFC3339)
+		database["sha256"] = hash
+		return database
+	}
+
+	info, err := os.Stat(s.dbPath)
+	if err != nil {
+		database["error"] = err.Error()
+		return database
+	}
+	database["size"] = info.Size()
+	database["modified"] = info.ModTime().UTC().Format(time.RFC3339)
+
+	hash, ok := "", false
+	if s.watcher != nil {
+		hash, ok = s.watcher.Hash(s.dbPath)
+	}
+	if !ok {
+		// Not hashed by the watcher: sourceVersion hashes the file itself
+		if h, _, err := s.sourceVersion(); err == nil {
+			hash = h
+		}
+	}
+	if hash != "" {
+		database["sha256"] = hash
+	}
+
+	return database
+}
+
+// memoryStats reports the memory use of the process
+func memoryStats() map[string]interface{} {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	return map[string]interface{}{
+		"alloc_bytes":      m.Alloc,
+		"heap_inuse_bytes": m.HeapInuse,
+		"sys_bytes":        m.Sys,
+		"heap_objects":     m.HeapObjects,
+		"num_gc":           m.NumGC,
+		"goroutines":       runtime.NumGoroutine(),
+	}
+}
+
+// handleGetStats returns the server's statistics and memory use
+func (s *Server) handleGetStats(w http.ResponseWriter, r *http.Request) {
+	stats := s.stats()
+	stats["success"] = true
+	stats["memory"] = memoryStats()
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(stats)
+}
+
+// handleGetStats returns the statistics of every table and the memory use
+// of the process
+func (m *Multi) handleGetStats(w http.ResponseWriter, r *http.Request) {
+	tables := make(map[string]interface{}, len(m.tables))
+	var started time.Time
+	for name, srv := range m.tables {
+		tables[name] = srv.stats()
+		if started.IsZero() || srv.startTime.Before(started) {
+			started = srv.startTime
+		}
+	}
+
+	stats := map[string]interface{}{
+		"success": true,
+		"tables":  tables,
+		"memory":  memoryStats(),
+	}
+	if !started.IsZero() {
+		stats["started"] = started.UTC().Format(time.RFC3339)
+		stats["uptime"] = time.Since(started).Round(time.Second).String()
+		stats["uptime_seconds"] = int64(time.Since(started).Seconds())
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(stats)
+}
+
+// handleStatsPage serves the stats dashboard, which polls api/stats
+func handleStatsPage(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	fmt.Fprint(w, statsPage)
+}
+
+const statsPage = `<!DOCTYPE html>
+<html>
+<head>
+    <meta charset="utf-8">
+    <title>Stats - Patris Export</title>
+    <style>
+        body { font-family: 'Segoe UI', Tahoma, Geneva, Verdana, sans-serif; max-width: 900px; margin: 30px auto; padding: 0 20px; background: #f5f5f5; }
+        .container { background: white; padding: 20px 30px; border-radius: 10px; box-shadow: 0 2px 10px rgba(0,0,0,0.1); margin-bottom: 20px; }
+        h1, h2 { color: #2c3e50; }
+        .cards { display: flex; flex-wrap: wrap; gap: 10px; }
+        .card { background: #ecf0f1; border-left: 4px solid #3498db; border-radius: 5px; padding: 10px 15px; min-width: 140px; }
+        .card .value { font-size: 22px; font-weight: bold; color: #2c3e50; }
+        .card .label { color: #7f8c8d; font-size: 13px; }
+        table { border-collapse: collapse; width: 100%; margin-top: 15px; }
+        th, td { border: 1px solid #ddd; padding: 5px 10px; text-align: left; font-size: 14px; }
+        th { background: #ecf0f1; width: 35%; }
+        td { word-break: break-all; }
+        .updated { color: #7f8c8d; font-size: 13px; }
+    </style>
+</head>
+<body>
+<div class="container">
+    <h1>📈 Server Stats</h1>
+    <div class="updated" id="updated">Loading…</div>
+    <div class="cards" id="summary"></div>
+</div>
+<div id="tables"></div>
+<script>
+// Pass the page's credentials (?api_key= or ?access_token=) on to the API
+const page = new URLSearchParams(location.search);
+const credentials = ['api_key', 'access_token']
+    .filter(k => page.has(k)).map(k => k + '=' + encodeURIComponent(page.get(k))).join('&');
+
+function esc(v) {
+    return String(v === null || v === undefined ? '' : v)
+        .replace(/&/g, '&amp;').replace(/</g, '&lt;').replace(/>/g, '&gt;');
+}
+
+function bytes(n) {
+    const units = ['B', 'KiB', 'MiB', 'GiB'];
+    let i = 0;
+    while (n >= 1024 && i < units.length - 1) { n /= 1024; i++; }
+    return n.toFixed(i ? 1 : 0) + ' ' + units[i];
+}
+
+function card(label, value) {
+    return '<div class="card"><div class="value">' + esc(value) + '</div><div class="label">' + esc(label) + '</div></div>';
+}
+
+// rows flattens nested values into "clients.websocket" style rows
+function rows(obj, prefix) {
+    return Object.keys(obj).sort().map(k => {
+        const v = obj[k];
+        if (v !== null && typeof v === 'object' && !Array.isArray(v)) return rows(v, prefix + k + '.');
+        return '<tr><th>' + esc(prefix + k) + '</th><td>' + esc(v) + '</td></tr>';
+    }).join('');
+}
+
+function table(name, t) {
+    const clients = t.clients.websocket + t.clients.sse + t.clients.grpc;
+    return '<div class="container">' + (name ? '<h2>🗂️ ' + esc(name) + '</h2>' : '') +
+        '<div class="cards">' +
+        card('Clients', clients) +
+        card('Broadcasts', t.broadcasts) +
+        card('Records changed', t.changes.added + t.changes.modified + t.changes.deleted) +
+        card('Database size', t.database.size !== undefined ? bytes(t.database.size) : '-') +
+        '</div><table>' + rows(t, '') + '</table></div>';
+}
+
+async function refresh() {
+    try {
+        const res = await fetch('api/stats' + (credentials ? '?' + credentials : ''));
+        if (!res.ok) throw new Error(await res.text());
+        const data = await res.json();
+
+        document.getElementById('summary').innerHTML =
+            card('Uptime', data.uptime || '-') +
+            card('Memory in use', bytes(data.memory.heap_inuse_bytes)) +
+            card('Memory from OS', bytes(data.memory.sys_bytes)) +
+            card('Goroutines', data.memory.goroutines);
+
+        document.getElementById('tables').innerHTML = data.tables
+            ? Object.keys(data.tables).sort().map(n => table(n, data.tables[n])).join('')
+            : table('', data);
+        document.getElementById('updated').textContent = 'Updated ' + new Date().toLocaleTimeString();
+    } catch (e) {
+        document.getElementById('updated').textContent = 'Failed to load stats: ' + e.message;
+    }
+}
+
+refresh();
+setInterval(refresh, 5000);
+</script>
+</body>
+</html>
+`
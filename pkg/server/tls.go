@@ -0,0 +1,148 @@
+package server
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// TLSConfig configures HTTPS (and WSS) for the server, with a certificate
+// and key file or with certificates obtained from Let's Encrypt
+type TLSConfig struct {
+	CertFile string
+	KeyFile  string
+
+	// AutocertDomains are the host names to obtain certificates for
+	AutocertDomains []string
+	// AutocertCacheDir stores the obtained certificates and account key
+	AutocertCacheDir string
+	// AutocertEmail is the contact address of the ACME account (optional)
+	AutocertEmail string
+	// AutocertHTTPAddr serves the ACME HTTP challenges and redirects other
+	// HTTP requests to HTTPS (default: :80)
+	AutocertHTTPAddr string
+}
+
+// enabled reports whether HTTPS is configured
+func (c *TLSConfig) enabled() bool {
+	return c != nil && (c.CertFile != "" || c.KeyFile != "" || len(c.AutocertDomains) > 0)
+}
+
+// validate checks that the configuration is complete and consistent
+func (c *TLSConfig) validate() error {
+	if c.CertFile != "" || c.KeyFile != "" {
+		if c.CertFile == "" || c.KeyFile == "" {
+			return errors.New("a TLS certificate needs both a certificate and a key file")
+		}
+		if len(c.AutocertDomains) > 0 {
+			return errors.New("a TLS certificate file cannot be combined with autocert")
+		}
+		// Fail on start-up rather than on the first connection
+		if _, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile); err != nil {
+			return fmt.Errorf("failed to load TLS certificate: %w", err)
+		}
+	}
+	if len(c.AutocertDomains) > 0 && c.AutocertCacheDir == "" {
+		return errors.New("autocert needs a cache directory")
+	}
+	return nil
+}
+
+// SetTLS serves the API over HTTPS; the WebSocket endpoint is then wss://
+func (o *httpOptions) SetTLS(config TLSConfig) error {
+	if !config.enabled() {
+		o.tls = nil
+		return nil
+	}
+	if err := config.validate(); err != nil {
+		return err
+	}
+	o.tls = &config
+	return nil
+}
+
+// TLSEnabled reports whether the server is served over HTTPS
+func (o *httpOptions) TLSEnabled() bool {
+	return o.tls.enabled()
+}
+
+// autocert returns the Let's Encrypt certificate manager, shared by the
+// HTTP and gRPC listeners
+func (o *httpOptions) autocert() (*autocert.Manager, error) {
+	var err error
+	o.autocertOnce.Do(func() {
+		if err = os.MkdirAll(o.tls.AutocertCacheDir, 0700); err != nil {
+			err = fmt.Errorf("failed to create autocert cache directory: %w", err)
+			return
+		}
+		o.autocertManager = &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: autocert.HostWhitelist(o.tls.AutocertDomains...),
+			Cache:      autocert.DirCache(o.tls.AutocertCacheDir),
+			Email:      o.tls.AutocertEmail,
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return o.autocertManager, nil
+}
+
+// tlsConfig returns the TLS configuration of a listener
+func (o *httpOptions) tlsConfig() (*tls.Config, error) {
+	if len(o.tls.AutocertDomains) == 0 {
+		cert, err := tls.LoadX509KeyPair(o.tls.CertFile, o.tls.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load TLS certificate: %w", err)
+		}
+		return &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}, nil
+	}
+
+	manager, err := o.autocert()
+	if err != nil {
+		return nil, err
+	}
+	config := manager.TLSConfig()
+	config.MinVersion = tls.VersionTLS12
+	return config, nil
+}
+
+// listenAndServe serves a router on addr, over HTTPS if configured
+func (o *httpOptions) listenAndServe(addr string, router http.Handler) error {
+	srv := &http.Server{Addr: addr, Handler: o.handler(router)}
+	if !o.tls.enabled() {
+		return srv.ListenAndServe()
+	}
+
+	if len(o.tls.AutocertDomains) == 0 {
+		srv.TLSConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+		o.log().Info("serving HTTPS", "certificate", o.tls.CertFile)
+		return srv.ListenAndServeTLS(o.tls.CertFile, o.tls.KeyFile)
+	}
+
+	manager, err := o.autocert()
+	if err != nil {
+		return err
+	}
+	if srv.TLSConfig, err = o.tlsConfig(); err != nil {
+		return err
+	}
+
+	httpAddr := o.tls.AutocertHTTPAddr
+	if httpAddr == "" {
+		httpAddr = ":80"
+	}
+	go func() {
+		o.log().Info("serving ACME challenges", "addr", httpAddr)
+		if err := http.ListenAndServe(httpAddr, manager.HTTPHandler(nil)); err != nil {
+			o.log().Warn("ACME challenge listener stopped", "error", err)
+		}
+	}()
+
+	o.log().Info("serving HTTPS with Let's Encrypt certificates", "domains", o.tls.AutocertDomains)
+	return srv.ListenAndServeTLS("", "")
+}
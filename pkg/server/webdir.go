@@ -0,0 +1,73 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// webReservedSegments are path segments never served from the web
+// directory, so files cannot shadow the API, WebSocket and event streams
+var webReservedSegments = map[string]bool{"api": true, "ws": true, "events": true}
+
+// SetWebDir serves the viewer's pages and assets from a directory. A file
+// there overrides the built-in page at the same path: index.html replaces
+// the index page, compare/index.html the /compare view. Files are served
+// without authentication, like the index page; the data endpoints still
+// require it.
+func (o *httpOptions) SetWebDir(dir string) error {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return fmt.Errorf("failed to open web directory: %w", err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("web directory is not a directory: %s", dir)
+	}
+	o.webDir = dir
+	return nil
+}
+
+// webAssets serves GET and HEAD requests for files of the web directory and
+// passes the others to next
+func (o *httpOptions) webAssets(next http.Handler) http.Handler {
+	if o.webDir == "" {
+		return next
+	}
+
+	files := http.FileServer(http.Dir(o.webDir))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if (r.Method == http.MethodGet || r.Method == http.MethodHead) && o.hasWebFile(r.URL.Path) {
+			files.ServeHTTP(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// hasWebFile reports whether the web directory has a file for a URL path: a
+// regular file, or a directory with an index.html. Hidden files and reserved
+// paths are never served.
+func (o *httpOptions) hasWebFile(urlPath string) bool {
+	name := path.Clean("/" + urlPath)
+	for _, segment := range strings.Split(name, "/") {
+		if strings.HasPrefix(segment, ".") || webReservedSegments[segment] {
+			return false
+		}
+	}
+
+	file := filepath.Join(o.webDir, filepath.FromSlash(name))
+	info, err := os.Stat(file)
+	if err != nil {
+		return false
+	}
+	if info.IsDir() {
+		info, err = os.Stat(filepath.Join(file, "index.html"))
+		if err != nil {
+			return false
+		}
+	}
+	return info.Mode().IsRegular()
+}
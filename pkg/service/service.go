@@ -0,0 +1,213 @@
+package service
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// DefaultName is the name of the unit of an install not giving one
+const DefaultName = "patris-export"
+
+// systemdDir is the directory of system units
+const systemdDir = "/etc/systemd/system"
+
+// namePattern matches the names systemd accepts for units
+var namePattern = regexp.MustCompile(`^[A-Za-z0-9:_.@\-]+$`)
+
+// systemctl runs systemctl with args, with --user for user units; tests
+// replace it
+var systemctl = func(user bool, stdout io.Writer, args ...string) error {
+	if user {
+		args = append([]string{"--user"}, args...)
+	}
+	cmd := exec.Command("systemctl", args...)
+	cmd.Stdout = stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("systemctl %s: %w", strings.Join(args, " "), err)
+	}
+	return nil
+}
+
+// Unit is a systemd service running a patris-export command, restarted
+// when it fails
+type Unit struct {
+	// Name is the unit name without .service
+	Name        string
+	Description string
+	// User installs a unit of the user's service manager instead of the
+	// system's
+	User bool
+	// Exec is the command line: the executable and its arguments
+	Exec []string
+	// WorkingDir is the directory relative paths of the command are
+	// resolved in
+	WorkingDir string
+	// Env holds KEY=VALUE variables of the service, EnvFile a file of them
+	// (e.g. keeping a DSN out of the unit)
+	Env     []string
+	EnvFile string
+}
+
+// Validate checks that the unit can be written. A line break in any of
+// its values would start another directive of the unit.
+func (u *Unit) Validate() error {
+	if !namePattern.MatchString(u.Name) {
+		return fmt.Errorf("invalid service name %q", u.Name)
+	}
+	values := map[string][]string{
+		"description":          {u.Description},
+		"command":              u.Exec,
+		"working directory":    {u.WorkingDir},
+		"environment variable": u.Env,
+		"environment file":     {u.EnvFile},
+	}
+	for what, values := range values {
+		for _, value := range values {
+			if strings.ContainsAny(value, "\r\n") {
+				return fmt.Errorf("the %s %q contains a line break", what, value)
+			}
+		}
+	}
+	if len(u.Exec) == 0 || !filepath.IsAbs(u.Exec[0]) {
+		return fmt.Errorf("the command needs an absolute executable path")
+	}
+	for _, env := range u.Env {
+		if name, _, ok := strings.Cut(env, "="); !ok || name == "" {
+			return fmt.Errorf("invalid environment variable %q: use KEY=VALUE", env)
+		}
+	}
+	if u.WorkingDir != "" && !filepath.IsAbs(u.WorkingDir) {
+		return fmt.Errorf("the working directory must be an absolute path")
+	}
+	if u.EnvFile != "" && !filepath.IsAbs(u.EnvFile) {
+		return fmt.Errorf("the environment file must be an absolute path")
+	}
+	return nil
+}
+
+// Render returns the unit file
+func (u *Unit) Render() string {
+	var b strings.Builder
+	b.WriteString("[Unit]\n")
+	fmt.Fprintf(&b, "Description=%s\n", u.Description)
+	b.WriteString("After=network-online.target\n")
+	b.WriteString("Wants=network-online.target\n")
+
+	b.WriteString("\n[Service]\n")
+	b.WriteString("Type=simple\n")
+	args := make([]string, len(u.Exec))
+	for i, arg := range u.Exec {
+		args[i] = quoteExec(arg)
+	}
+	fmt.Fprintf(&b, "ExecStart=%s\n", strings.Join(args, " "))
+	if u.WorkingDir != "" {
+		fmt.Fprintf(&b, "WorkingDirectory=%s\n", quote(u.WorkingDir))
+	}
+	for _, env := range u.Env {
+		fmt.Fprintf(&b, "Environment=%s\n", quote(env))
+	}
+	if u.EnvFile != "" {
+		fmt.Fprintf(&b, "EnvironmentFile=%s\n", u.EnvFile)
+	}
+	b.WriteString("Restart=on-failure\n")
+	b.WriteString("RestartSec=5s\n")
+
+	b.WriteString("\n[Install]\n")
+	if u.User {
+		b.WriteString("WantedBy=default.target\n")
+	} else {
+		b.WriteString("WantedBy=multi-user.target\n")
+	}
+	return b.String()
+}
+
+// quoteExec quotes a word of a command line, where systemd also expands
+// variables: $ is escaped besides what quote escapes
+func quoteExec(word string) string {
+	return quote(strings.ReplaceAll(word, "$", "$$"))
+}
+
+// quote quotes a word of a unit file as systemd parses it: specifiers (%)
+// are escaped, and words with spaces, quotes or backslashes are
+// double-quoted. Variables are expanded in command lines only (quoteExec).
+func quote(word string) string {
+	word = strings.ReplaceAll(word, "%", "%%")
+	if word != "" && !strings.ContainsAny(word, " \t\"'\\;") {
+		return word
+	}
+	word = strings.ReplaceAll(word, `\`, `\\`)
+	word = strings.ReplaceAll(word, `"`, `\"`)
+	return `"` + word + `"`
+}
+
+// Path returns the unit file of a service: in /etc/systemd/system, or in
+// the user's systemd/user configuration directory for a user service
+func Path(name string, user bool) (string, error) {
+	if !user {
+		return filepath.Join(systemdDir, name+".service"), nil
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to find the user configuration directory: %w", err)
+	}
+	return filepath.Join(dir, "systemd", "user", name+".service"), nil
+}
+
+// Install writes the unit file, then enables and starts the service
+func Install(u *Unit) (string, error) {
+	if err := u.Validate(); err != nil {
+		return "", err
+	}
+	path, err := Path(u.Name, u.User)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", fmt.Errorf("failed to create unit directory: %w", err)
+	}
+	if err := os.WriteFile(path, []byte(u.Render()), 0644); err != nil {
+		return "", fmt.Errorf("failed to write unit file: %w", err)
+	}
+
+	if err := systemctl(u.User, nil, "daemon-reload"); err != nil {
+		return path, err
+	}
+	return path, systemctl(u.User, nil, "enable", "--now", u.Name+".service")
+}
+
+// Uninstall stops and disables a service and removes its unit file
+func Uninstall(name string, user bool) (string, error) {
+	if !namePattern.MatchString(name) {
+		return "", fmt.Errorf("invalid service name %q", name)
+	}
+	path, err := Path(name, user)
+	if err != nil {
+		return "", err
+	}
+	if _, err := os.Stat(path); err != nil {
+		return path, fmt.Errorf("service %s is not installed: %w", name, err)
+	}
+
+	if err := systemctl(user, nil, "disable", "--now", name+".service"); err != nil {
+		return path, err
+	}
+	if err := os.Remove(path); err != nil {
+		return path, fmt.Errorf("failed to remove unit file: %w", err)
+	}
+	return path, systemctl(user, nil, "daemon-reload")
+}
+
+// Status writes the status of a service, as systemctl status prints it, to
+// w; it fails if the service is not running
+func Status(w io.Writer, name string, user bool) error {
+	if !namePattern.MatchString(name) {
+		return fmt.Errorf("invalid service name %q", name)
+	}
+	return systemctl(user, w, "status", "--no-pager", name+".service")
+}
@@ -0,0 +1,109 @@
+package service
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRender(t *testing.T) {
+	u := &Unit{
+		Name:        "patris-kala",
+		Description: "Patris Export: kala",
+		Exec:        []string{"/usr/local/bin/patris-export", "serve", "/srv/Patris 81/kala.db", "--filter", "Name =~ '^پیچ'", "--digits", "latin,csv=persian", "--api-key", "k$y"},
+		WorkingDir:  "/srv/patris",
+		Env:         []string{"PATRIS_JWT_SECRET=a$b%c"},
+		EnvFile:     "/etc/patris/env",
+	}
+	if err := u.Validate(); err != nil {
+		t.Fatalf("Validate failed: %v", err)
+	}
+
+	unit := u.Render()
+	for _, line := range []string{
+		`ExecStart=/usr/local/bin/patris-export serve "/srv/Patris 81/kala.db" --filter "Name =~ '^پیچ'" --digits latin,csv=persian --api-key k$$y`,
+		"WorkingDirectory=/srv/patris",
+		// Environment= expands specifiers but not variables
+		"Environment=PATRIS_JWT_SECRET=a$b%%c",
+		"EnvironmentFile=/etc/patris/env",
+		"Restart=on-failure",
+		"WantedBy=multi-user.target",
+	} {
+		if !strings.Contains(unit, line+"\n") {
+			t.Errorf("Expected the line %q in:\n%s", line, unit)
+		}
+	}
+
+	u.User = true
+	if unit := u.Render(); !strings.Contains(unit, "WantedBy=default.target\n") {
+		t.Errorf("Expected a user unit wanted by default.target:\n%s", unit)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	for name, u := range map[string]*Unit{
+		"name":        {Name: "patris export", Exec: []string{"/usr/bin/patris-export"}},
+		"relative":    {Name: "patris", Exec: []string{"patris-export"}},
+		"no command":  {Name: "patris"},
+		"environment": {Name: "patris", Exec: []string{"/usr/bin/patris-export"}, Env: []string{"PATRIS_ADDR"}},
+		"working dir": {Name: "patris", Exec: []string{"/usr/bin/patris-export"}, WorkingDir: "data"},
+		"env newline": {Name: "patris", Exec: []string{"/usr/bin/patris-export"}, Env: []string{"A=b\nExecStartPre=/bin/sh"}},
+		"arg newline": {Name: "patris", Exec: []string{"/usr/bin/patris-export", "serve\r\nUser=root"}},
+		"dir newline": {Name: "patris", Exec: []string{"/usr/bin/patris-export"}, WorkingDir: "/srv\nUser=root"},
+		"description": {Name: "patris", Exec: []string{"/usr/bin/patris-export"}, Description: "Patris\n[Service]"},
+		"env file":    {Name: "patris", Exec: []string{"/usr/bin/patris-export"}, EnvFile: "/etc/env\nUser=root"},
+	} {
+		if err := u.Validate(); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestInstall(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	var calls [][]string
+	original := systemctl
+	defer func() { systemctl = original }()
+	systemctl = func(user bool, _ io.Writer, args ...string) error {
+		if !user {
+			t.Errorf("Expected user systemctl calls, got %v", args)
+		}
+		calls = append(calls, args)
+		return nil
+	}
+
+	u := &Unit{Name: "patris", Description: "Patris Export", User: true, Exec: []string{"/usr/bin/patris-export", "daemon"}}
+	path, err := Install(u)
+	if err != nil {
+		t.Fatalf("Install failed: %v", err)
+	}
+	if path != filepath.Join(os.Getenv("XDG_CONFIG_HOME"), "systemd", "user", "patris.service") {
+		t.Errorf("Unexpected unit path %s", path)
+	}
+	if data, err := os.ReadFile(path); err != nil || string(data) != u.Render() {
+		t.Errorf("Expected the unit file to be written, got %q, %v", data, err)
+	}
+
+	if _, err := Uninstall("patris", true); err != nil {
+		t.Fatalf("Uninstall failed: %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("Expected the unit file to be removed, got %v", err)
+	}
+	expected := [][]string{
+		{"daemon-reload"},
+		{"enable", "--now", "patris.service"},
+		{"disable", "--now", "patris.service"},
+		{"daemon-reload"},
+	}
+	if !reflect.DeepEqual(calls, expected) {
+		t.Errorf("Expected systemctl calls %v, got %v", expected, calls)
+	}
+
+	if _, err := Uninstall("patris", true); err == nil {
+		t.Error("Expected an error uninstalling a missing service")
+	}
+}
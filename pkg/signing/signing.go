@@ -0,0 +1,236 @@
+package signing
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// SignatureExt is the extension of the signature sidecar written next to a signed file
+const SignatureExt = ".sig"
+
+// Algorithm is the signature algorithm recorded in signature files
+const Algorithm = "ed25519"
+
+// signatureDomain separates export signatures from any other use of the same key
+const signatureDomain = "patris-export/signature/v1"
+
+var (
+	// ErrSizeMismatch is returned when a signed file has a different size than when it was signed
+	ErrSizeMismatch = errors.New("file size does not match signature (truncated or extended)")
+	// ErrDigestMismatch is returned when a signed file's content has changed since it was signed
+	ErrDigestMismatch = errors.New("file content does not match signature (tampered)")
+	// ErrBadSignature is returned when the signature was not produced by the given key
+	ErrBadSignature = errors.New("signature is not valid for this public key")
+)
+
+// Signature represents the contents of a .sig sidecar file
+type Signature struct {
+	Algorithm string `json:"algorithm"`
+	File      string `json:"file"`
+	Size      int64  `json:"size"`
+	SHA256    string `json:"sha256"`
+	Signature string `json:"signature"`
+}
+
+// GenerateKey creates a new ed25519 key pair and writes it as PEM files
+func GenerateKey(privatePath, publicPath string) error {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return fmt.Errorf("failed to generate key: %w", err)
+	}
+
+	privDER, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		return fmt.Errorf("failed to encode private key: %w", err)
+	}
+	pubDER, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return fmt.Errorf("failed to encode public key: %w", err)
+	}
+
+	privPEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privDER})
+	if err := os.WriteFile(privatePath, privPEM, 0600); err != nil {
+		return fmt.Errorf("failed to write private key: %w", err)
+	}
+
+	pubPEM := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubDER})
+	if err := os.WriteFile(publicPath, pubPEM, 0644); err != nil {
+		return fmt.Errorf("failed to write public key: %w", err)
+	}
+
+	return nil
+}
+
+// LoadPrivateKey reads a PEM-encoded ed25519 private key
+func LoadPrivateKey(path string) (ed25519.PrivateKey, error) {
+	block, err := readPEM(path, "PRIVATE KEY")
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse private key: %w", err)
+	}
+
+	priv, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("private key in %s is not an ed25519 key", path)
+	}
+
+	return priv, nil
+}
+
+// LoadPublicKey reads a PEM-encoded ed25519 public key
+func LoadPublicKey(path string) (ed25519.PublicKey, error) {
+	block, err := readPEM(path, "PUBLIC KEY")
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse public key: %w", err)
+	}
+
+	pub, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("public key in %s is not an ed25519 key", path)
+	}
+
+	return pub, nil
+}
+
+// readPEM reads the first PEM block of the expected type from a file
+func readPEM(path, blockType string) (*pem.Block, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key file: %w", err)
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != blockType {
+		return nil, fmt.Errorf("%s does not contain a PEM %s", path, blockType)
+	}
+
+	return block, nil
+}
+
+// SignFile signs a file and writes the signature to path + SignatureExt.
+// The signature covers the file size and SHA-256 digest, so truncation is
+// reported separately from content tampering on verification.
+func SignFile(path string, key ed25519.PrivateKey) (string, error) {
+	size, digest, err := digestFile(path)
+	if err != nil {
+		return "", err
+	}
+
+	sig := Signature{
+		Algorithm: Algorithm,
+		File:      filepath.Base(path),
+		Size:      size,
+		SHA256:    hex.EncodeToString(digest),
+		Signature: base64.StdEncoding.EncodeToString(ed25519.Sign(key, signedMessage(size, digest))),
+	}
+
+	data, err := json.MarshalIndent(sig, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to encode signature: %w", err)
+	}
+
+	sigPath := path + SignatureExt
+	if err := os.WriteFile(sigPath, append(data, '\n'), 0644); err != nil {
+		return "", fmt.Errorf("failed to write signature: %w", err)
+	}
+
+	return sigPath, nil
+}
+
+// VerifyFile checks a file against its signature sidecar (path + SignatureExt)
+func VerifyFile(path string, key ed25519.PublicKey) (*Signature, error) {
+	return VerifyFileWithSignature(path, path+SignatureExt, key)
+}
+
+// VerifyFileWithSignature checks a file against an explicit signature file
+func VerifyFileWithSignature(path, sigPath string, key ed25519.PublicKey) (*Signature, error) {
+	data, err := os.ReadFile(sigPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read signature: %w", err)
+	}
+
+	var sig Signature
+	if err := json.Unmarshal(data, &sig); err != nil {
+		return nil, fmt.Errorf("failed to parse signature: %w", err)
+	}
+
+	if sig.Algorithm != Algorithm {
+		return nil, fmt.Errorf("unsupported signature algorithm: %q", sig.Algorithm)
+	}
+
+	rawSig, err := base64.StdEncoding.DecodeString(sig.Signature)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode signature: %w", err)
+	}
+
+	expectedDigest, err := hex.DecodeString(sig.SHA256)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode signed digest: %w", err)
+	}
+
+	// The recorded size and digest must be authentic before they are compared
+	if !ed25519.Verify(key, signedMessage(sig.Size, expectedDigest), rawSig) {
+		return &sig, ErrBadSignature
+	}
+
+	size, digest, err := digestFile(path)
+	if err != nil {
+		return &sig, err
+	}
+
+	if size != sig.Size {
+		return &sig, fmt.Errorf("%w: signed %d bytes, found %d", ErrSizeMismatch, sig.Size, size)
+	}
+
+	if hex.EncodeToString(digest) != sig.SHA256 {
+		return &sig, ErrDigestMismatch
+	}
+
+	return &sig, nil
+}
+
+// digestFile returns the size and SHA-256 digest of a file
+func digestFile(path string) (int64, []byte, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to open file: %w", err)
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	size, err := io.Copy(hash, file)
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to read file: %w", err)
+	}
+
+	return size, hash.Sum(nil), nil
+}
+
+// signedMessage builds the byte string that is actually signed
+func signedMessage(size int64, digest []byte) []byte {
+	msg := make([]byte, 0, len(signatureDomain)+8+len(digest))
+	msg = append(msg, signatureDomain...)
+	msg = binary.BigEndian.AppendUint64(msg, uint64(size))
+	return append(msg, digest...)
+}
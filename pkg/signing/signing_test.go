@@ -0,0 +1,96 @@
+package signing
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func setupSignedFile(t *testing.T) (string, string, string) {
+	t.Helper()
+
+	tmpDir := t.TempDir()
+	privPath := filepath.Join(tmpDir, "signing.key")
+	pubPath := filepath.Join(tmpDir, "signing.pub")
+	dataPath := filepath.Join(tmpDir, "kala.json")
+
+	if err := GenerateKey(privPath, pubPath); err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+
+	if err := os.WriteFile(dataPath, []byte(`{"1001": {"Code": 1001}}`), 0644); err != nil {
+		t.Fatalf("Failed to write data file: %v", err)
+	}
+
+	priv, err := LoadPrivateKey(privPath)
+	if err != nil {
+		t.Fatalf("Failed to load private key: %v", err)
+	}
+
+	if _, err := SignFile(dataPath, priv); err != nil {
+		t.Fatalf("Failed to sign file: %v", err)
+	}
+
+	return dataPath, pubPath, tmpDir
+}
+
+func TestSignAndVerify(t *testing.T) {
+	dataPath, pubPath, _ := setupSignedFile(t)
+
+	pub, err := LoadPublicKey(pubPath)
+	if err != nil {
+		t.Fatalf("Failed to load public key: %v", err)
+	}
+
+	sig, err := VerifyFile(dataPath, pub)
+	if err != nil {
+		t.Fatalf("Expected valid signature, got: %v", err)
+	}
+
+	if sig.File != "kala.json" {
+		t.Errorf("Expected signed file name kala.json, got %s", sig.File)
+	}
+}
+
+func TestVerifyDetectsTampering(t *testing.T) {
+	dataPath, pubPath, _ := setupSignedFile(t)
+	pub, _ := LoadPublicKey(pubPath)
+
+	// Same size, different content
+	if err := os.WriteFile(dataPath, []byte(`{"1001": {"Code": 1002}}`), 0644); err != nil {
+		t.Fatalf("Failed to modify data file: %v", err)
+	}
+
+	if _, err := VerifyFile(dataPath, pub); !errors.Is(err, ErrDigestMismatch) {
+		t.Errorf("Expected ErrDigestMismatch, got: %v", err)
+	}
+}
+
+func TestVerifyDetectsTruncation(t *testing.T) {
+	dataPath, pubPath, _ := setupSignedFile(t)
+	pub, _ := LoadPublicKey(pubPath)
+
+	if err := os.Truncate(dataPath, 10); err != nil {
+		t.Fatalf("Failed to truncate data file: %v", err)
+	}
+
+	if _, err := VerifyFile(dataPath, pub); !errors.Is(err, ErrSizeMismatch) {
+		t.Errorf("Expected ErrSizeMismatch, got: %v", err)
+	}
+}
+
+func TestVerifyRejectsOtherKey(t *testing.T) {
+	dataPath, _, tmpDir := setupSignedFile(t)
+
+	otherPriv := filepath.Join(tmpDir, "other.key")
+	otherPub := filepath.Join(tmpDir, "other.pub")
+	if err := GenerateKey(otherPriv, otherPub); err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+
+	pub, _ := LoadPublicKey(otherPub)
+	if _, err := VerifyFile(dataPath, pub); !errors.Is(err, ErrBadSignature) {
+		t.Errorf("Expected ErrBadSignature, got: %v", err)
+	}
+}
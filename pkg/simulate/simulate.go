@@ -0,0 +1,103 @@
+package simulate
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Kinds of Operation
+const (
+	KindSQL     = "sql"
+	KindHTTP    = "http"
+	KindCommand = "command"
+)
+
+// Operation is a write to a sync or notify target that a simulation
+// records instead of running
+type Operation struct {
+	Time time.Time `json:"time"`
+	// Target names the sink or notification, as in the logs
+	Target string `json:"target"`
+	Kind   string `json:"kind"`
+
+	// Statement and Args are an SQL statement and its parameters
+	Statement string        `json:"statement,omitempty"`
+	Args      []interface{} `json:"args,omitempty"`
+
+	// Method, URL and Body are an HTTP request
+	Method string          `json:"method,omitempty"`
+	URL    string          `json:"url,omitempty"`
+	Body   json.RawMessage `json:"body,omitempty"`
+
+	// Command and Env are a command and the variables added to its
+	// environment
+	Command []string `json:"command,omitempty"`
+	Env     []string `json:"env,omitempty"`
+}
+
+// Recorder appends the operations of a simulation as JSON lines to a file
+// for review. It is safe for concurrent use.
+type Recorder struct {
+	mu   sync.Mutex
+	path string
+	file *os.File
+}
+
+// Open opens the file at path, appending to an existing file so that the
+// operations of several runs can be reviewed together
+func Open(path string) (*Recorder, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create simulation directory: %w", err)
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open simulation file: %w", err)
+	}
+	return &Recorder{path: path, file: file}, nil
+}
+
+// Record appends an operation as one JSON line, stamped with the current
+// time if it has none
+func (r *Recorder) Record(op Operation) error {
+	if op.Time.IsZero() {
+		op.Time = time.Now().UTC()
+	}
+	line, err := json.Marshal(op)
+	if err != nil {
+		return fmt.Errorf("failed to encode simulated operation: %w", err)
+	}
+	line = append(line, '\n')
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.file == nil {
+		return fmt.Errorf("simulation file is closed")
+	}
+	if _, err := r.file.Write(line); err != nil {
+		return fmt.Errorf("failed to write simulation file: %w", err)
+	}
+	return nil
+}
+
+// Path returns the path of the file
+func (r *Recorder) Path() string {
+	return r.path
+}
+
+// Close closes the file; later records fail
+func (r *Recorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.file == nil {
+		return nil
+	}
+	err := r.file.Close()
+	r.file = nil
+	return err
+}
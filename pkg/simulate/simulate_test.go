@@ -0,0 +1,45 @@
+package simulate
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRecordAppends(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sim", "simulation.jsonl")
+
+	for _, statement := range []string{"DELETE FROM kala", "DELETE FROM anbar"} {
+		r, err := Open(path)
+		if err != nil {
+			t.Fatalf("Open failed: %v", err)
+		}
+		if err := r.Record(Operation{Target: "kala", Kind: KindSQL, Statement: statement}); err != nil {
+			t.Fatalf("Record failed: %v", err)
+		}
+		r.Close()
+		if err := r.Record(Operation{Kind: KindSQL}); err == nil {
+			t.Error("Expected an error recording to a closed file")
+		}
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("Failed to open %s: %v", path, err)
+	}
+	defer file.Close()
+	var ops []Operation
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var op Operation
+		if err := json.Unmarshal(scanner.Bytes(), &op); err != nil {
+			t.Fatalf("Invalid JSON line %q: %v", scanner.Text(), err)
+		}
+		ops = append(ops, op)
+	}
+	if len(ops) != 2 || ops[0].Statement != "DELETE FROM kala" || ops[1].Statement != "DELETE FROM anbar" || ops[0].Time.IsZero() {
+		t.Errorf("Expected both operations stamped in order, got %+v", ops)
+	}
+}
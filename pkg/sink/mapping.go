@@ -0,0 +1,138 @@
+package sink
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/atomicdeploy/patris-export/pkg/resilient"
+	"gopkg.in/yaml.v3"
+)
+
+// How records deleted from a table are removed from the database table
+const (
+	// DeleteRows deletes their rows
+	DeleteRows = "delete"
+	// DeleteSoft sets the soft-delete column of their rows to the time of
+	// the deletion and keeps them
+	DeleteSoft = "soft"
+)
+
+// DefaultBatchSize is the number of rows written by one statement
+const DefaultBatchSize = 500
+
+// Mapping maps the fields of a table to the columns of a database table:
+//
+//	table: public.kala
+//	columns:
+//	  Code: code
+//	  Name: name
+//	  FOROSH: price
+//	delete: soft
+//	soft_delete_column: deleted_at
+//
+// The database table must exist, with a unique constraint on the column of
+// the key field. Fields not mapped are not written.
+type Mapping struct {
+	// Table is the database table, optionally qualified by its schema
+	Table string `yaml:"table" json:"table"`
+	// Key is the field identifying records (default: the profile's key
+	// field, Code); it must be mapped
+	Key string `yaml:"key,omitempty" json:"key,omitempty"`
+	// Columns maps field names to column names
+	Columns map[string]string `yaml:"columns" json:"columns"`
+	// Delete is DeleteRows (default) or DeleteSoft
+	Delete string `yaml:"delete,omitempty" json:"delete,omitempty"`
+	// SoftDeleteColumn is the nullable timestamp column set on deletion
+	// with DeleteSoft and cleared when the record appears again
+	SoftDeleteColumn string `yaml:"soft_delete_column,omitempty" json:"soft_delete_column,omitempty"`
+	// BatchSize is the number of rows written by one statement (default:
+	// DefaultBatchSize, lowered to the database's parameter limit)
+	BatchSize int `yaml:"batch_size,omitempty" json:"batch_size,omitempty"`
+}
+
+// LoadMapping loads a mapping from a YAML (or JSON) file; keyField is the
+// key of a mapping not giving one
+func LoadMapping(path, keyField string) (*Mapping, error) {
+	data, err := resilient.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read mapping: %w", err)
+	}
+
+	m := &Mapping{}
+	if err := yaml.Unmarshal(data, m); err != nil {
+		return nil, fmt.Errorf("failed to parse mapping %s: %w", path, err)
+	}
+	if m.Key == "" {
+		m.Key = keyField
+	}
+	if err := m.Validate(); err != nil {
+		return nil, fmt.Errorf("mapping %s: %w", path, err)
+	}
+	return m, nil
+}
+
+// Validate checks the mapping and sets its defaults
+func (m *Mapping) Validate() error {
+	if m.Table == "" {
+		return fmt.Errorf("table is required")
+	}
+	if len(m.Columns) == 0 {
+		return fmt.Errorf("no columns")
+	}
+	if m.Key == "" {
+		return fmt.Errorf("key is required")
+	}
+	if m.Columns[m.Key] == "" {
+		return fmt.Errorf("key field %s is not mapped to a column", m.Key)
+	}
+
+	fields := make(map[string]string, len(m.Columns))
+	for field, column := range m.Columns {
+		if column == "" {
+			return fmt.Errorf("field %s is mapped to an empty column", field)
+		}
+		if other, ok := fields[column]; ok {
+			return fmt.Errorf("fields %s and %s are mapped to the same column %s", other, field, column)
+		}
+		fields[column] = field
+	}
+
+	switch m.Delete {
+	case "":
+		m.Delete = DeleteRows
+	case DeleteRows:
+	case DeleteSoft:
+		if m.SoftDeleteColumn == "" {
+			return fmt.Errorf("delete: soft requires soft_delete_column")
+		}
+		if field, ok := fields[m.SoftDeleteColumn]; ok {
+			return fmt.Errorf("soft_delete_column %s is also the column of field %s", m.SoftDeleteColumn, field)
+		}
+	default:
+		return fmt.Errorf("unknown delete mode %q (use %s or %s)", m.Delete, DeleteRows, DeleteSoft)
+	}
+	if m.Delete != DeleteSoft && m.SoftDeleteColumn != "" {
+		return fmt.Errorf("soft_delete_column requires delete: soft")
+	}
+
+	if m.BatchSize < 0 {
+		return fmt.Errorf("batch_size must not be negative")
+	}
+	if m.BatchSize == 0 {
+		m.BatchSize = DefaultBatchSize
+	}
+	return nil
+}
+
+// Fields returns the mapped fields: the key first, then the others in
+// name order
+func (m *Mapping) Fields() []string {
+	fields := []string{m.Key}
+	for field := range m.Columns {
+		if field != m.Key {
+			fields = append(fields, field)
+		}
+	}
+	sort.Strings(fields[1:])
+	return fields
+}
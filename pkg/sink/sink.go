@@ -0,0 +1,330 @@
+package sink
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/atomicdeploy/patris-export/pkg/diff"
+	"github.com/atomicdeploy/patris-export/pkg/paradox"
+	"github.com/atomicdeploy/patris-export/pkg/simulate"
+)
+
+// Databases are the kinds of database a Sink writes to, as given to Open
+var Databases = []string{"postgres", "mssql"}
+
+// Open returns a Sink writing the table of mapping in a database of a kind
+// of Databases
+func Open(database, dsn string, mapping *Mapping) (*Sink, error) {
+	switch database {
+	case "postgres":
+		return OpenPostgres(dsn, mapping)
+	case "mssql":
+		return OpenMSSQL(dsn, mapping)
+	}
+	return nil, fmt.Errorf("unknown database %q (use %s)", database, strings.Join(Databases, " or "))
+}
+
+// dialect builds the statements of a database
+type dialect interface {
+	// quote quotes an identifier
+	quote(name string) string
+	// placeholder returns the n-th (1-based) parameter of a statement
+	placeholder(n int) string
+	// upsert returns the statement inserting rows of columns, or updating
+	// the row with the same key, the first column; a non-empty softDelete
+	// column is cleared
+	upsert(table string, columns []string, rows int, softDelete string) string
+	// maxParams is the largest number of parameters of a statement
+	maxParams() int
+}
+
+// Result counts the rows a sync wrote
+type Result struct {
+	Records  int
+	Upserted int
+	Deleted  int
+}
+
+// Sink keeps a database table in sync with the records of a table: each
+// Sync writes the records added or changed since the previous one and
+// deletes the rows of records that are gone, in one transaction.
+type Sink struct {
+	db      *sql.DB
+	dialect dialect
+	mapping *Mapping
+	fields  []string
+
+	// synced holds the mapped values of the records by key as of the last
+	// Sync; nil before the first
+	synced map[string]map[string]interface{}
+
+	// simulation records the writes instead of running them when set
+	simulation *simulate.Recorder
+}
+
+// open connects to a database and checks that it is reachable
+func open(driver, dsn string, d dialect, mapping *Mapping) (*Sink, error) {
+	if err := mapping.Validate(); err != nil {
+		return nil, err
+	}
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
+	}
+	return &Sink{db: db, dialect: d, mapping: mapping, fields: mapping.Fields()}, nil
+}
+
+// SetSimulation records the statements of later syncs with r instead of
+// running them. The keys are still read from the database, and each Sync
+// records the changes since the previous one as if it had been written.
+func (s *Sink) SetSimulation(r *simulate.Recorder) {
+	s.simulation = r
+}
+
+// Close closes the database connection
+func (s *Sink) Close() error {
+	return s.db.Close()
+}
+
+// Sync writes the changes of records since the previous Sync. The first
+// Sync writes all records and deletes the rows whose key is not among
+// them. Records without the key field are skipped; of records sharing a
+// key, the last is written. After a failed Sync the next one writes the
+// changes since the last successful one.
+func (s *Sink) Sync(ctx context.Context, records []paradox.Record) (*Result, error) {
+	rows := s.rows(records)
+
+	before := s.synced
+	if before == nil {
+		keys, err := s.keys(ctx)
+		if err != nil {
+			return nil, err
+		}
+		// Rows of unknown content are written again
+		before = make(map[string]map[string]interface{}, len(keys))
+		for key, value := range keys {
+			before[key] = map[string]interface{}{s.mapping.Key: value}
+		}
+	}
+	upserts, deletes := changes(before, rows, s.mapping.Key)
+
+	if s.simulation != nil {
+		if err := s.upsert(ctx, nil, upserts); err != nil {
+			return nil, err
+		}
+		if err := s.delete(ctx, nil, deletes); err != nil {
+			return nil, err
+		}
+		s.synced = rows
+		return &Result{Records: len(rows), Upserted: len(upserts), Deleted: len(deletes)}, nil
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := s.upsert(ctx, tx, upserts); err != nil {
+		return nil, err
+	}
+	if err := s.delete(ctx, tx, deletes); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit changes: %w", err)
+	}
+
+	s.synced = rows
+	return &Result{Records: len(rows), Upserted: len(upserts), Deleted: len(deletes)}, nil
+}
+
+// rows returns the mapped values of records by key
+func (s *Sink) rows(records []paradox.Record) map[string]map[string]interface{} {
+	rows := make(map[string]map[string]interface{}, len(records))
+	for _, record := range records {
+		key, ok := record[s.mapping.Key]
+		if !ok || key == nil {
+			continue
+		}
+		row := make(map[string]interface{}, len(s.fields))
+		for _, field := range s.fields {
+			row[field] = record[field]
+		}
+		rows[fmt.Sprintf("%v", key)] = row
+	}
+	return rows
+}
+
+// changes returns the rows of after that are new or differ from before, and
+// the values of the key field of the rows of before not in after, both in
+// key order
+func changes(before, after map[string]map[string]interface{}, keyField string) ([]map[string]interface{}, []interface{}) {
+	var upserts []map[string]interface{}
+	for _, key := range sortedKeys(after) {
+		if old, ok := before[key]; !ok || !diff.Equal(old, after[key], diff.Options{}) {
+			upserts = append(upserts, after[key])
+		}
+	}
+
+	var deletes []interface{}
+	for _, key := range sortedKeys(before) {
+		if _, ok := after[key]; !ok {
+			deletes = append(deletes, before[key][keyField])
+		}
+	}
+	return upserts, deletes
+}
+
+// sortedKeys returns the keys of rows in order
+func sortedKeys(rows map[string]map[string]interface{}) []string {
+	keys := make([]string, 0, len(rows))
+	for key := range rows {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// keys reads the key values of the table's rows, except those soft-deleted
+func (s *Sink) keys(ctx context.Context) (map[string]interface{}, error) {
+	query := fmt.Sprintf("SELECT %s FROM %s", s.dialect.quote(s.mapping.Columns[s.mapping.Key]), s.table())
+	if s.mapping.Delete == DeleteSoft {
+		query += fmt.Sprintf(" WHERE %s IS NULL", s.dialect.quote(s.mapping.SoftDeleteColumn))
+	}
+
+	result, err := s.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read keys of %s: %w", s.mapping.Table, err)
+	}
+	defer result.Close()
+
+	keys := make(map[string]interface{})
+	for result.Next() {
+		var value interface{}
+		if err := result.Scan(&value); err != nil {
+			return nil, fmt.Errorf("failed to read keys of %s: %w", s.mapping.Table, err)
+		}
+		if b, ok := value.([]byte); ok {
+			value = string(b)
+		}
+		keys[fmt.Sprintf("%v", value)] = value
+	}
+	if err := result.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read keys of %s: %w", s.mapping.Table, err)
+	}
+	return keys, nil
+}
+
+// upsert writes rows in batches of the same prepared statement
+func (s *Sink) upsert(ctx context.Context, tx *sql.Tx, rows []map[string]interface{}) error {
+	columns := make([]string, len(s.fields))
+	for i, field := range s.fields {
+		columns[i] = s.mapping.Columns[field]
+	}
+
+	return s.batches(ctx, tx, len(rows), len(columns), func(n int) string {
+		return s.dialect.upsert(s.table(), columns, n, s.mapping.SoftDeleteColumn)
+	}, func(i int, args []interface{}) []interface{} {
+		for _, field := range s.fields {
+			args = append(args, rows[i][field])
+		}
+		return args
+	})
+}
+
+// delete deletes or soft-deletes the rows of keys in batches
+func (s *Sink) delete(ctx context.Context, tx *sql.Tx, keys []interface{}) error {
+	key := s.dialect.quote(s.mapping.Columns[s.mapping.Key])
+	return s.batches(ctx, tx, len(keys), 1, func(n int) string {
+		placeholders := make([]string, n)
+		for i := range placeholders {
+			placeholders[i] = s.dialect.placeholder(i + 1)
+		}
+		where := fmt.Sprintf("%s IN (%s)", key, strings.Join(placeholders, ", "))
+
+		if s.mapping.Delete == DeleteSoft {
+			column := s.dialect.quote(s.mapping.SoftDeleteColumn)
+			return fmt.Sprintf("UPDATE %s SET %s = CURRENT_TIMESTAMP WHERE %s AND %s IS NULL", s.table(), column, where, column)
+		}
+		return fmt.Sprintf("DELETE FROM %s WHERE %s", s.table(), where)
+	}, func(i int, args []interface{}) []interface{} {
+		return append(args, keys[i])
+	})
+}
+
+// batches runs the statement of n items in batches: statement returns the
+// statement of a batch of rows, prepared once for the full batches and once
+// for the rest; args appends the params of the i-th item. A simulation
+// records each batch instead, without tx.
+func (s *Sink) batches(ctx context.Context, tx *sql.Tx, n, params int, statement func(rows int) string, args func(i int, args []interface{}) []interface{}) error {
+	size := s.mapping.BatchSize
+	if limit := s.dialect.maxParams() / params; size > limit {
+		size = limit
+	}
+
+	var stmt *sql.Stmt
+	defer func() {
+		if stmt != nil {
+			stmt.Close()
+		}
+	}()
+	prepared := 0
+	for start := 0; start < n; start += size {
+		end := start + size
+		if end > n {
+			end = n
+		}
+		if s.simulation != nil {
+			values := make([]interface{}, 0, (end-start)*params)
+			for i := start; i < end; i++ {
+				values = args(i, values)
+			}
+			if err := s.simulation.Record(simulate.Operation{
+				Target:    s.mapping.Table,
+				Kind:      simulate.KindSQL,
+				Statement: statement(end - start),
+				Args:      values,
+			}); err != nil {
+				return err
+			}
+			continue
+		}
+		if end-start != prepared {
+			if stmt != nil {
+				stmt.Close()
+			}
+			var err error
+			if stmt, err = tx.PrepareContext(ctx, statement(end-start)); err != nil {
+				return fmt.Errorf("failed to prepare statement: %w", err)
+			}
+			prepared = end - start
+		}
+
+		values := make([]interface{}, 0, (end-start)*params)
+		for i := start; i < end; i++ {
+			values = args(i, values)
+		}
+		if _, err := stmt.ExecContext(ctx, values...); err != nil {
+			return fmt.Errorf("failed to write %s: %w", s.mapping.Table, err)
+		}
+	}
+	return nil
+}
+
+// table returns the quoted table name, each part of a schema-qualified name
+// quoted
+func (s *Sink) table() string {
+	parts := strings.Split(s.mapping.Table, ".")
+	for i, part := range parts {
+		parts[i] = s.dialect.quote(part)
+	}
+	return strings.Join(parts, ".")
+}
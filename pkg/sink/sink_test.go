@@ -0,0 +1,253 @@
+package sink
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/atomicdeploy/patris-export/pkg/paradox"
+	"github.com/atomicdeploy/patris-export/pkg/simulate"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func TestLoadMapping(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "kala.yaml")
+	if err := os.WriteFile(path, []byte("table: public.kala\ncolumns:\n  Code: code\n  Name: name\n  FOROSH: price\n"), 0644); err != nil {
+		t.Fatalf("Failed to write mapping: %v", err)
+	}
+
+	m, err := LoadMapping(path, "Code")
+	if err != nil {
+		t.Fatalf("LoadMapping failed: %v", err)
+	}
+	if m.Key != "Code" || m.Delete != DeleteRows || m.BatchSize != DefaultBatchSize {
+		t.Errorf("Expected the default key, delete mode and batch size, got %+v", m)
+	}
+	if fields := m.Fields(); !reflect.DeepEqual(fields, []string{"Code", "FOROSH", "Name"}) {
+		t.Errorf("Expected the key first, got %v", fields)
+	}
+
+	for name, m := range map[string]*Mapping{
+		"no table":        {Key: "Code", Columns: map[string]string{"Code": "code"}},
+		"unmapped key":    {Table: "kala", Key: "Code", Columns: map[string]string{"Name": "name"}},
+		"shared column":   {Table: "kala", Key: "Code", Columns: map[string]string{"Code": "code", "Name": "code"}},
+		"soft, no column": {Table: "kala", Key: "Code", Columns: map[string]string{"Code": "code"}, Delete: DeleteSoft},
+		"mapped column":   {Table: "kala", Key: "Code", Columns: map[string]string{"Code": "code"}, Delete: DeleteSoft, SoftDeleteColumn: "code"},
+		"unknown delete":  {Table: "kala", Key: "Code", Columns: map[string]string{"Code": "code"}, Delete: "truncate"},
+	} {
+		if err := m.Validate(); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestPostgresUpsert(t *testing.T) {
+	stmt := postgres{}.upsert(`"public"."kala"`, []string{"code", "name"}, 2, "deleted_at")
+	expected := `INSERT INTO "public"."kala" ("code", "name") VALUES ($1, $2), ($3, $4) ON CONFLICT ("code") DO UPDATE SET "name" = EXCLUDED."name", "deleted_at" = NULL`
+	if stmt != expected {
+		t.Errorf("Unexpected statement:\n%s\nexpected:\n%s", stmt, expected)
+	}
+
+	stmt = postgres{}.upsert(`"kala"`, []string{"code"}, 1, "")
+	if expected := `INSERT INTO "kala" ("code") VALUES ($1) ON CONFLICT ("code") DO NOTHING`; stmt != expected {
+		t.Errorf("Unexpected statement for the key alone: %s", stmt)
+	}
+}
+
+func TestMSSQLUpsert(t *testing.T) {
+	stmt := mssql{}.upsert(`[dbo].[kala]`, []string{"code", "name"}, 2, "deleted_at")
+	expected := `MERGE INTO [dbo].[kala] WITH (HOLDLOCK) AS target USING (VALUES (@p1, @p2), (@p3, @p4)) AS source ([code], [name]) ON target.[code] = source.[code]` +
+		` WHEN MATCHED THEN UPDATE SET target.[name] = source.[name], target.[deleted_at] = NULL` +
+		` WHEN NOT MATCHED THEN INSERT ([code], [name]) VALUES (source.[code], source.[name]);`
+	if stmt != expected {
+		t.Errorf("Unexpected statement:\n%s\nexpected:\n%s", stmt, expected)
+	}
+
+	stmt = mssql{}.upsert(`[kala]`, []string{"code"}, 1, "")
+	if expected := `MERGE INTO [kala] WITH (HOLDLOCK) AS target USING (VALUES (@p1)) AS source ([code]) ON target.[code] = source.[code] WHEN NOT MATCHED THEN INSERT ([code]) VALUES (source.[code]);`; stmt != expected {
+		t.Errorf("Unexpected statement for the key alone: %s", stmt)
+	}
+	if q := (mssql{}).quote("a]b"); q != "[a]]b]" {
+		t.Errorf("Expected the bracket doubled, got %s", q)
+	}
+}
+
+// openTestSink returns a sink writing a SQLite table through the PostgreSQL
+// statements, which SQLite accepts
+func openTestSink(t *testing.T, mapping *Mapping) *Sink {
+	t.Helper()
+	if err := mapping.Validate(); err != nil {
+		t.Fatalf("Invalid mapping: %v", err)
+	}
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "sink.sqlite"))
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	if _, err := db.Exec(`CREATE TABLE kala (code INTEGER PRIMARY KEY, name TEXT, price REAL, deleted_at TIMESTAMP);
+		INSERT INTO kala (code, name) VALUES (999, 'stale')`); err != nil {
+		t.Fatalf("Failed to create table: %v", err)
+	}
+	return &Sink{db: db, dialect: postgres{}, mapping: mapping, fields: mapping.Fields()}
+}
+
+// tableRows reads the rows of the test table as "code name price deleted"
+func tableRows(t *testing.T, s *Sink) map[int64][]interface{} {
+	t.Helper()
+	result, err := s.db.Query("SELECT code, name, price, deleted_at IS NOT NULL FROM kala")
+	if err != nil {
+		t.Fatalf("Failed to read table: %v", err)
+	}
+	defer result.Close()
+
+	rows := make(map[int64][]interface{})
+	for result.Next() {
+		var code int64
+		var name sql.NullString
+		var price sql.NullFloat64
+		var deleted bool
+		if err := result.Scan(&code, &name, &price, &deleted); err != nil {
+			t.Fatalf("Failed to read row: %v", err)
+		}
+		rows[code] = []interface{}{name.String, price.Float64, deleted}
+	}
+	return rows
+}
+
+func TestSync(t *testing.T) {
+	ctx := context.Background()
+	s := openTestSink(t, &Mapping{
+		Table:            "kala",
+		Key:              "Code",
+		Columns:          map[string]string{"Code": "code", "Name": "name", "FOROSH": "price"},
+		Delete:           DeleteSoft,
+		SoftDeleteColumn: "deleted_at",
+		BatchSize:        2,
+	})
+
+	records := []paradox.Record{
+		{"Code": 101, "Name": "آی سی", "FOROSH": 1500.0, "ANBAR1": 3},
+		{"Code": 102, "Name": "سنسور", "FOROSH": 200.0},
+		{"Code": 103, "Name": "کانکتور", "FOROSH": 50.0},
+		{"Name": "no key"},
+	}
+	result, err := s.Sync(ctx, records)
+	if err != nil {
+		t.Fatalf("First sync failed: %v", err)
+	}
+	if *result != (Result{Records: 3, Upserted: 3, Deleted: 1}) {
+		t.Errorf("Expected all records written and the stale row deleted, got %+v", result)
+	}
+	rows := tableRows(t, s)
+	if len(rows) != 4 || rows[101][0] != "آی سی" || rows[101][1] != 1500.0 || rows[999][2] != true || rows[101][2] != false {
+		t.Errorf("Unexpected rows after the first sync: %v", rows)
+	}
+
+	// A change of an unmapped field is not written
+	records = []paradox.Record{
+		{"Code": 101, "Name": "آی سی", "FOROSH": 1500.0, "ANBAR1": 4},
+		{"Code": 102, "Name": "سنسور", "FOROSH": 250.0},
+	}
+	if result, err = s.Sync(ctx, records); err != nil {
+		t.Fatalf("Second sync failed: %v", err)
+	}
+	if *result != (Result{Records: 2, Upserted: 1, Deleted: 1}) {
+		t.Errorf("Expected one update and one deletion, got %+v", result)
+	}
+	rows = tableRows(t, s)
+	if rows[102][1] != 250.0 || rows[103][2] != true {
+		t.Errorf("Unexpected rows after the second sync: %v", rows)
+	}
+
+	// A record appearing again is restored
+	records = append(records, paradox.Record{"Code": 103, "Name": "کانکتور", "FOROSH": 55.0})
+	if result, err = s.Sync(ctx, records); err != nil {
+		t.Fatalf("Third sync failed: %v", err)
+	}
+	if *result != (Result{Records: 3, Upserted: 1}) {
+		t.Errorf("Expected one upsert, got %+v", result)
+	}
+	if rows = tableRows(t, s); rows[103][1] != 55.0 || rows[103][2] != false {
+		t.Errorf("Expected the restored record, got %v", rows[103])
+	}
+}
+
+func TestSyncDelete(t *testing.T) {
+	s := openTestSink(t, &Mapping{Table: "kala", Key: "Code", Columns: map[string]string{"Code": "code", "Name": "name"}})
+
+	if _, err := s.Sync(context.Background(), []paradox.Record{{"Code": 101, "Name": "آی سی"}}); err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	rows := tableRows(t, s)
+	if len(rows) != 1 || rows[101] == nil {
+		t.Errorf("Expected only record 101, got %v", rows)
+	}
+}
+
+func TestSyncSimulation(t *testing.T) {
+	ctx := context.Background()
+	s := openTestSink(t, &Mapping{Table: "kala", Key: "Code", Columns: map[string]string{"Code": "code", "Name": "name"}, BatchSize: 2})
+	path := filepath.Join(t.TempDir(), "simulation.jsonl")
+	recorder, err := simulate.Open(path)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	s.SetSimulation(recorder)
+
+	records := []paradox.Record{{"Code": 101, "Name": "آی سی"}, {"Code": 102, "Name": "سنسور"}, {"Code": 103, "Name": "کانکتور"}}
+	result, err := s.Sync(ctx, records)
+	if err != nil {
+		t.Fatalf("Simulated sync failed: %v", err)
+	}
+	if *result != (Result{Records: 3, Upserted: 3, Deleted: 1}) {
+		t.Errorf("Expected the changes of a real sync, got %+v", result)
+	}
+	// A later sync records the changes since the simulated one
+	if result, err = s.Sync(ctx, records[:2]); err != nil {
+		t.Fatalf("Second simulated sync failed: %v", err)
+	}
+	if *result != (Result{Records: 2, Deleted: 1}) {
+		t.Errorf("Expected one deletion, got %+v", result)
+	}
+	recorder.Close()
+
+	if rows := tableRows(t, s); len(rows) != 1 || rows[999] == nil {
+		t.Errorf("Expected the table unchanged, got %v", rows)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("Failed to open simulation file: %v", err)
+	}
+	defer file.Close()
+	var ops []simulate.Operation
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var op simulate.Operation
+		if err := json.Unmarshal(scanner.Bytes(), &op); err != nil {
+			t.Fatalf("Invalid JSON line %q: %v", scanner.Text(), err)
+		}
+		ops = append(ops, op)
+	}
+
+	// Two batches of upserts and a deletion, then the second deletion
+	if len(ops) != 4 {
+		t.Fatalf("Expected 4 statements, got %d: %+v", len(ops), ops)
+	}
+	if ops[0].Kind != simulate.KindSQL || ops[0].Target != "kala" || len(ops[0].Args) != 4 || ops[0].Args[0] != 101.0 || ops[0].Args[1] != "آی سی" {
+		t.Errorf("Unexpected first batch: %+v", ops[0])
+	}
+	if expected := `DELETE FROM "kala" WHERE "code" IN ($1)`; ops[2].Statement != expected || ops[2].Args[0] != 999.0 {
+		t.Errorf("Expected the stale row deleted, got %+v", ops[2])
+	}
+	if ops[3].Statement != ops[2].Statement || ops[3].Args[0] != 103.0 {
+		t.Errorf("Expected record 103 deleted, got %+v", ops[3])
+	}
+}
@@ -0,0 +1,39 @@
+package watcher
+
+import "time"
+
+// EventKind is what happened to a watched file
+type EventKind string
+
+const (
+	// EventCreate is a file of a watched directory or glob that appeared
+	// after watching started
+	EventCreate EventKind = "create"
+	// EventWrite is a file whose content changed in place
+	EventWrite EventKind = "write"
+	// EventReplace is a file that was replaced by renaming another file over
+	// it, as editors and atomic writers do
+	EventReplace EventKind = "replace"
+)
+
+// Event describes a change of a watched file. The hashes are those of the
+// watch's strategy (see WatchStrategy); OldHash is empty for a created
+// file. Size and ModTime are those of the file when NewHash was computed.
+type Event struct {
+	Path    string
+	Kind    EventKind
+	OldHash string
+	NewHash string
+	Size    int64
+	ModTime time.Time
+}
+
+// WatchEvents is Watch with a callback that receives the details of each
+// change. A callback that fails returns an error, and is called again as
+// set by SetRetry.
+func (fw *FileWatcher) WatchEvents(path string, callback func(Event) error, debounceDuration time.Duration) error {
+	fw.mu.RLock()
+	strategy := fw.strategy
+	fw.mu.RUnlock()
+	return fw.WatchStrategy(path, strategy, callback, debounceDuration)
+}
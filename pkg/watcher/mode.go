@@ -0,0 +1,101 @@
+package watcher
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/atomicdeploy/patris-export/pkg/resilient"
+)
+
+// Mode selects how a watcher detects changes
+type Mode string
+
+const (
+	// ModeAuto polls files on network file systems and uses notifications
+	// otherwise
+	ModeAuto Mode = "auto"
+	// ModeNotify uses file system notifications
+	ModeNotify Mode = "notify"
+	// ModePoll checks the files periodically
+	ModePoll Mode = "poll"
+)
+
+// ParseMode parses a watch mode name; an empty name is ModeAuto
+func ParseMode(name string) (Mode, error) {
+	switch mode := Mode(strings.ToLower(strings.TrimSpace(name))); mode {
+	case "":
+		return ModeAuto, nil
+	case ModeAuto, ModeNotify, ModePoll:
+		return mode, nil
+	}
+	return "", fmt.Errorf("invalid watch mode %q: expected auto, notify or poll", name)
+}
+
+// Options configure a watcher created by New
+type Options struct {
+	Mode Mode
+	// PollInterval is how often files are checked when polling; zero is
+	// DefaultPollInterval
+	PollInterval time.Duration
+	// Settle is how long a changed file must stay unchanged before its
+	// callback is called (see SetSettle)
+	Settle time.Duration
+	// Retry is how failed WatchEvents callbacks are retried (see SetRetry)
+	Retry resilient.Policy
+	// Strategy decides which files changed; empty is StrategySHA256
+	Strategy Strategy
+	// MaxWait bounds how long continuous changes postpone handling (see
+	// SetMaxWait)
+	MaxWait time.Duration
+}
+
+// New creates a watcher for paths in the mode of the options. ModeAuto polls
+// if any of the paths is on a network file system.
+func New(opts Options, paths ...string) (*FileWatcher, error) {
+	mode := opts.Mode
+	if mode == "" || mode == ModeAuto {
+		mode = ModeNotify
+		for _, path := range paths {
+			if IsNetworkPath(path) {
+				mode = ModePoll
+				break
+			}
+		}
+	}
+
+	var fw *FileWatcher
+	if mode == ModePoll {
+		fw = NewPollingWatcher(opts.PollInterval)
+	} else {
+		var err error
+		if fw, err = NewFileWatcher(); err != nil {
+			return nil, err
+		}
+	}
+	fw.SetSettle(opts.Settle)
+	fw.SetRetry(opts.Retry, nil)
+	fw.SetMaxWait(opts.MaxWait)
+	if opts.Strategy != "" {
+		fw.SetStrategy(opts.Strategy)
+	}
+	return fw, nil
+}
+
+// IsNetworkPath reports whether a file, or the directory of a glob, is on a
+// network file system: a UNC path (\\server\share) or a mount of a network
+// file system such as SMB/CIFS or NFS
+func IsNetworkPath(path string) bool {
+	if strings.HasPrefix(path, `\\`) || strings.HasPrefix(path, "//") {
+		return true
+	}
+	if strings.ContainsAny(path, "*?[") {
+		path = filepath.Dir(path)
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return false
+	}
+	return isNetworkFileSystem(abs)
+}
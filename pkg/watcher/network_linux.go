@@ -0,0 +1,26 @@
+package watcher
+
+import "syscall"
+
+// networkFileSystems are the statfs magic numbers of network file systems.
+// Type is signed and 32 bits wide on some architectures.
+var networkFileSystems = map[uint32]bool{
+	0x6969:     true, // NFS
+	0x517B:     true, // SMB
+	0xFF534D42: true, // CIFS
+	0xFE534D42: true, // SMB2
+	0x01021997: true, // 9P, e.g. Windows drives in WSL
+	0x564C:     true, // NCP
+	0x73757245: true, // Coda
+	0x5346414F: true, // AFS
+}
+
+// isNetworkFileSystem reports whether a path is on a mounted network file
+// system
+func isNetworkFileSystem(path string) bool {
+	var fs syscall.Statfs_t
+	if err := syscall.Statfs(path, &fs); err != nil {
+		return false
+	}
+	return networkFileSystems[uint32(fs.Type)]
+}
@@ -0,0 +1,9 @@
+//go:build !linux && !windows
+
+package watcher
+
+// isNetworkFileSystem reports whether a path is on a network file system;
+// only UNC paths are detected on this platform
+func isNetworkFileSystem(path string) bool {
+	return false
+}
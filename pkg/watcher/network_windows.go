@@ -0,0 +1,16 @@
+package watcher
+
+import (
+	"path/filepath"
+
+	"golang.org/x/sys/windows"
+)
+
+// isNetworkFileSystem reports whether a path is on a mapped network drive
+func isNetworkFileSystem(path string) bool {
+	root, err := windows.UTF16PtrFromString(filepath.VolumeName(path) + `\`)
+	if err != nil {
+		return false
+	}
+	return windows.GetDriveType(root) == windows.DRIVE_REMOTE
+}
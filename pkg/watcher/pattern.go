@@ -0,0 +1,178 @@
+package watcher
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// pattern is a watched directory or glob: the files in dir whose names
+// match glob, including files created after watching started
+type pattern struct {
+	dir      string
+	glob     string
+	strategy Strategy
+	callback func(Event) error
+	debounce time.Duration
+}
+
+// matches reports whether a path is a file of the pattern
+func (p *pattern) matches(path string) bool {
+	if filepath.Dir(path) != p.dir {
+		return false
+	}
+	ok, _ := filepath.Match(p.glob, filepath.Base(path))
+	return ok
+}
+
+// isPattern reports whether a watched path is a directory or a glob rather
+// than a single file
+func isPattern(path string) bool {
+	if strings.ContainsAny(path, "*?[") {
+		return true
+	}
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
+
+// parsePattern splits a directory (all files in it) or a glob such as
+// data/*.db into the directory to watch and the pattern of file names.
+// Only the last element may contain wildcards.
+func parsePattern(path string) (*pattern, error) {
+	dir, glob := filepath.Clean(path), "*"
+	if strings.ContainsAny(path, "*?[") {
+		dir, glob = filepath.Dir(dir), filepath.Base(dir)
+		if strings.ContainsAny(dir, "*?[") {
+			return nil, fmt.Errorf("invalid pattern %q: only file names may contain wildcards", path)
+		}
+		if _, err := filepath.Match(glob, ""); err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %w", path, err)
+		}
+	}
+
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat directory: %w", err)
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("%s is not a directory", dir)
+	}
+	return &pattern{dir: dir, glob: glob}, nil
+}
+
+// watchPattern watches the files of a directory or glob. The caller holds
+// mu.
+func (fw *FileWatcher) watchPattern(path string, strategy Strategy, callback func(Event) error, debounceDuration time.Duration) error {
+	p, err := parsePattern(path)
+	if err != nil {
+		return err
+	}
+	p.strategy = strategy
+	p.callback = callback
+	p.debounce = debounceDuration
+
+	entries, err := os.ReadDir(p.dir)
+	if err != nil {
+		return fmt.Errorf("failed to read directory: %w", err)
+	}
+	hashes := make(map[string]string)
+	for _, entry := range entries {
+		file := filepath.Join(p.dir, entry.Name())
+		if !entry.Type().IsRegular() || !p.matches(file) {
+			continue
+		}
+		hash, err := fw.fingerprint(file, strategy)
+		if err != nil {
+			return fmt.Errorf("failed to get initial hash: %w", err)
+		}
+		hashes[file] = hash
+	}
+
+	if fw.watcher != nil {
+		if err := fw.watcher.Add(p.dir); err != nil {
+			return fmt.Errorf("failed to watch directory: %w", err)
+		}
+	}
+
+	fw.patterns[path] = p
+	for file, hash := range hashes {
+		fw.addMatch(file, hash, p)
+	}
+	return nil
+}
+
+// addMatch watches a file of a pattern under the pattern's callback, unless
+// the file is already watched. The caller holds mu.
+func (fw *FileWatcher) addMatch(path, hash string, p *pattern) {
+	if _, watched := fw.callbacks[path]; watched {
+		return
+	}
+	fw.fileHashes[path] = hash
+	fw.callbacks[path] = p.callback
+	fw.debounce[path] = p.debounce
+	fw.strategies[path] = p.strategy
+	fw.matched[path] = p
+	if fw.watcher == nil {
+		fw.stats[path] = statFile(path)
+	}
+}
+
+// matchNew watches a file that appeared in a watched directory if it
+// matches a pattern, and reports whether it did. Its hash is unknown, so
+// its first change calls the callback.
+func (fw *FileWatcher) matchNew(path string) bool {
+	fw.mu.RLock()
+	_, watched := fw.callbacks[path]
+	fw.mu.RUnlock()
+	if watched {
+		return false
+	}
+
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+
+	if _, watched := fw.callbacks[path]; watched {
+		return false
+	}
+	for _, p := range fw.patterns {
+		if !p.matches(path) {
+			continue
+		}
+		if info, err := os.Stat(path); err != nil || !info.Mode().IsRegular() {
+			return false
+		}
+		fw.addMatch(path, "", p)
+		return true
+	}
+	return false
+}
+
+// unwatchPattern stops watching a pattern and the files it matched. The
+// directory stays watched while other patterns use it. The caller holds mu.
+func (fw *FileWatcher) unwatchPattern(path string) error {
+	p := fw.patterns[path]
+	delete(fw.patterns, path)
+
+	for file, matchedBy := range fw.matched {
+		if matchedBy == p {
+			delete(fw.matched, file)
+			delete(fw.fileHashes, file)
+			delete(fw.callbacks, file)
+			delete(fw.debounce, file)
+			delete(fw.strategies, file)
+			delete(fw.stats, file)
+		}
+	}
+
+	if fw.watcher == nil {
+		return nil
+	}
+	for _, other := range fw.patterns {
+		if other.dir == p.dir {
+			return nil
+		}
+	}
+	return fw.watcher.Remove(p.dir)
+}
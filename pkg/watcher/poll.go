@@ -0,0 +1,120 @@
+package watcher
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// DefaultPollInterval is how often a polling watcher checks the files
+const DefaultPollInterval = 2 * time.Second
+
+// pollHashEvery is the number of polls after which files are hashed even
+// if their size and modification time did not change, as some SMB servers
+// update them only when the writer closes the file
+const pollHashEvery = 10
+
+// fileStat is the size and modification time of a file at a check
+type fileStat struct {
+	exists  bool
+	size    int64
+	modTime time.Time
+}
+
+// differs reports whether a file changed between two checks
+func (s fileStat) differs(other fileStat) bool {
+	return s.exists != other.exists || s.size != other.size || !s.modTime.Equal(other.modTime)
+}
+
+// statFile returns the size and modification time of a file; a missing or
+// unreadable file does not exist
+func statFile(path string) fileStat {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fileStat{}
+	}
+	return fileStat{exists: true, size: info.Size(), modTime: info.ModTime()}
+}
+
+// NewPollingWatcher creates a watcher that checks the watched files every
+// interval instead of relying on file system notifications, which network
+// file systems such as SMB/CIFS shares do not deliver. A file is hashed when
+// its size or modification time changes, and every few polls regardless;
+// only a changed hash calls the callback. A zero interval polls every
+// DefaultPollInterval.
+func NewPollingWatcher(interval time.Duration) *FileWatcher {
+	if interval <= 0 {
+		interval = DefaultPollInterval
+	}
+	fw := newFileWatcher()
+	fw.pollInterval = interval
+	return fw
+}
+
+// Polling reports whether the watcher polls instead of receiving
+// notifications
+func (fw *FileWatcher) Polling() bool {
+	return fw.watcher == nil
+}
+
+// pollLoop checks the files every poll interval until the watcher is closed
+func (fw *FileWatcher) pollLoop() {
+	defer fw.running.Done()
+
+	ticker := time.NewTicker(fw.pollInterval)
+	defer ticker.Stop()
+
+	for polls := 1; ; polls++ {
+		select {
+		case <-fw.done:
+			return
+		case <-ticker.C:
+			fw.poll(polls%pollHashEvery == 0)
+		}
+	}
+}
+
+// poll looks for new files in the watched directories and dispatches the
+// files whose size or modification time changed, or all existing files if
+// hashAll is set
+func (fw *FileWatcher) poll(hashAll bool) {
+	fw.mu.RLock()
+	dirs := make(map[string]bool)
+	for _, p := range fw.patterns {
+		dirs[p.dir] = true
+	}
+	paths := make([]string, 0, len(fw.stats))
+	for path := range fw.stats {
+		paths = append(paths, path)
+	}
+	fw.mu.RUnlock()
+
+	for dir := range dirs {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			log.Printf("⚠️  Failed to read %s: %v", dir, err)
+			continue
+		}
+		for _, entry := range entries {
+			if path := filepath.Join(dir, entry.Name()); fw.matchNew(path) {
+				fw.dispatch(path, EventCreate)
+			}
+		}
+	}
+
+	for _, path := range paths {
+		current := statFile(path)
+
+		fw.mu.Lock()
+		previous, watched := fw.stats[path]
+		if watched {
+			fw.stats[path] = current
+		}
+		fw.mu.Unlock()
+
+		if watched && current.exists && (hashAll || current.differs(previous)) {
+			fw.dispatch(path, EventWrite)
+		}
+	}
+}
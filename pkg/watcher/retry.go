@@ -0,0 +1,85 @@
+package watcher
+
+import (
+	"log"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/atomicdeploy/patris-export/pkg/resilient"
+)
+
+// SetRetry retries WatchEvents callbacks that return an error with the
+// policy's exponential backoff (its Timeout is not used), e.g. while BDE
+// briefly locks the table. Errors wrapped with resilient.Permanent, missing
+// files and permission errors are not retried. Once the retries are
+// exhausted giveUp is called with the change and the last error; a nil
+// giveUp logs them. The zero policy does not retry.
+func (fw *FileWatcher) SetRetry(policy resilient.Policy, giveUp func(Event, error)) {
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+	fw.retry = policy
+	fw.giveUp = giveUp
+}
+
+// call calls a callback with a change, retrying failures with the retry
+// policy. Retrying ends early when the watcher is stopped or the file
+// changed again, as the newer change is handled on its own.
+func (fw *FileWatcher) call(callback func(Event) error, event Event) {
+	fw.mu.RLock()
+	policy, giveUp := fw.retry, fw.giveUp
+	fw.mu.RUnlock()
+
+	id := goroutineID()
+	fw.timersMu.Lock()
+	fw.calling[id] = true
+	fw.timersMu.Unlock()
+	defer func() {
+		fw.timersMu.Lock()
+		delete(fw.calling, id)
+		fw.timersMu.Unlock()
+	}()
+
+	backoff := policy.InitialBackoff
+	for attempt := 0; ; attempt++ {
+		err := callback(event)
+		if err == nil {
+			return
+		}
+
+		if attempt >= policy.Retries || !resilient.Retryable(err) {
+			if giveUp != nil {
+				giveUp(event, err)
+			} else {
+				log.Printf("⚠️  Failed to handle the change of %s after %d attempts: %v", filepath.Base(event.Path), attempt+1, err)
+			}
+			return
+		}
+
+		log.Printf("⚠️  Handling the change of %s failed (attempt %d/%d): %v; retrying in %v", filepath.Base(event.Path), attempt+1, policy.Retries+1, err, backoff)
+		select {
+		case <-time.After(backoff):
+		case <-fw.done:
+			return
+		}
+		if fw.fingerprintOf(event.Path) != event.NewHash {
+			return
+		}
+
+		backoff *= 2
+		if policy.MaxBackoff > 0 && backoff > policy.MaxBackoff {
+			backoff = policy.MaxBackoff
+		}
+	}
+}
+
+// goroutineID returns the id of the calling goroutine, as runtime.Stack
+// prints it ("goroutine 42 [running]:")
+func goroutineID() uint64 {
+	var buf [64]byte
+	stack := strings.TrimPrefix(string(buf[:runtime.Stack(buf[:], false)]), "goroutine ")
+	id, _ := strconv.ParseUint(stack[:strings.IndexByte(stack, ' ')], 10, 64)
+	return id
+}
@@ -0,0 +1,83 @@
+package watcher
+
+import (
+	"errors"
+	"log"
+	"path/filepath"
+	"time"
+)
+
+// maxSettle bounds the wait for a file to settle, so a file that keeps
+// changing still calls its callback
+const maxSettle = 30 * time.Second
+
+// errClosed is returned by waits cut short by Close
+var errClosed = errors.New("watcher closed")
+
+// SetSettle makes the watcher wait after a change until a file's size and
+// hash have stayed the same for the duration before calling its callback,
+// so a table written in several bursts is not read half-written. Unlike the
+// debounce, which delays handling events, the settle time is measured on
+// the file itself. Zero calls back as soon as the hash changes.
+func (fw *FileWatcher) SetSettle(duration time.Duration) {
+	fw.settleMu.Lock()
+	defer fw.settleMu.Unlock()
+	fw.settle = duration
+}
+
+// settleDuration returns the settle time
+func (fw *FileWatcher) settleDuration() time.Duration {
+	fw.settleMu.Lock()
+	defer fw.settleMu.Unlock()
+	return fw.settle
+}
+
+// beginSettle marks a file as waiting to settle; it returns false if it
+// already is
+func (fw *FileWatcher) beginSettle(path string) bool {
+	fw.settleMu.Lock()
+	defer fw.settleMu.Unlock()
+	if fw.settling[path] {
+		return false
+	}
+	fw.settling[path] = true
+	return true
+}
+
+// endSettle clears the mark set by beginSettle
+func (fw *FileWatcher) endSettle(path string) {
+	fw.settleMu.Lock()
+	defer fw.settleMu.Unlock()
+	delete(fw.settling, path)
+}
+
+// waitStable waits until a file's size and hash are the same at the start
+// and end of a settle period, starting from hash and stat, and returns the
+// final hash and stat. After maxSettle it returns the current ones.
+func (fw *FileWatcher) waitStable(path string, strategy Strategy, hash string, stat fileStat) (string, fileStat, error) {
+	settle := fw.settleDuration()
+	start := time.Now()
+
+	for {
+		select {
+		case <-time.After(settle):
+		case <-fw.done:
+			return "", fileStat{}, errClosed
+		}
+
+		current := statFile(path)
+		newHash, err := fw.fingerprint(path, strategy)
+		if err != nil {
+			return "", fileStat{}, err
+		}
+		if newHash == hash && !current.differs(stat) {
+			return newHash, current, nil
+		}
+		hash, stat = newHash, current
+
+		if time.Since(start) >= maxSettle {
+			log.Printf("⚠️  %s is still changing after %s; handling it anyway", filepath.Base(path), maxSettle)
+			return hash, stat, nil
+		}
+	}
+}
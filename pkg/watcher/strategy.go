@@ -0,0 +1,79 @@
+package watcher
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/atomicdeploy/patris-export/pkg/resilient"
+)
+
+// Strategy selects how a watcher decides that a file's content changed
+type Strategy string
+
+const (
+	// StrategySHA256 hashes the whole file with SHA-256 (default)
+	StrategySHA256 Strategy = "sha256"
+	// StrategyCRC32 hashes the whole file with the much cheaper CRC-32
+	StrategyCRC32 Strategy = "crc32"
+	// StrategyStat compares the size and modification time without reading
+	// the file, for very large tables; a rewrite with the same content is
+	// reported as a change
+	StrategyStat Strategy = "stat"
+)
+
+// ParseStrategy validates a change detection strategy name; empty is
+// StrategySHA256
+func ParseStrategy(name string) (Strategy, error) {
+	switch s := Strategy(strings.ToLower(strings.TrimSpace(name))); s {
+	case "":
+		return StrategySHA256, nil
+	case StrategySHA256, StrategyCRC32, StrategyStat:
+		return s, nil
+	}
+	return "", fmt.Errorf("invalid change detection %q: expected sha256, crc32 or stat", name)
+}
+
+// SetStrategy sets the strategy of the files, directories and globs
+// watched later with Watch or WatchEvents
+func (fw *FileWatcher) SetStrategy(strategy Strategy) {
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+	fw.strategy = strategy
+}
+
+// WatchStrategy is WatchEvents with the strategy deciding whether the
+// file changed. The hashes of its events are the fingerprints the strategy
+// compares: hexadecimal SHA-256 or CRC-32, or "<size>-<mtime>" for
+// StrategyStat.
+func (fw *FileWatcher) WatchStrategy(path string, strategy Strategy, callback func(Event) error, debounceDuration time.Duration) error {
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+
+	if isPattern(path) {
+		return fw.watchPattern(path, strategy, callback, debounceDuration)
+	}
+	return fw.watchFile(path, strategy, callback, debounceDuration)
+}
+
+// fingerprint computes what the strategy compares of a file, retrying
+// transient read failures
+func (fw *FileWatcher) fingerprint(path string, strategy Strategy) (string, error) {
+	switch strategy {
+	case StrategyStat:
+		return resilient.DoValue("stat "+path, func() (string, error) {
+			info, err := os.Stat(path)
+			if err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("%d-%d", info.Size(), info.ModTime().UnixNano()), nil
+		})
+	case StrategyCRC32:
+		return resilient.HashFile(path, func() hash.Hash { return crc32.NewIEEE() })
+	}
+	return resilient.HashFile(path, sha256.New)
+}
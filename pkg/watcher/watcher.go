@@ -1,24 +1,69 @@
 package watcher
 
 import (
-	"crypto/sha256"
+	"context"
 	"fmt"
-	"io"
 	"log"
-	"os"
 	"sync"
 	"time"
 
+	"github.com/atomicdeploy/patris-export/pkg/resilient"
 	"github.com/fsnotify/fsnotify"
 )
 
-// FileWatcher watches database files for changes
+// FileWatcher watches database files for changes, through file system
+// notifications or by polling
 type FileWatcher struct {
+	// watcher delivers notifications; it is nil when polling
 	watcher    *fsnotify.Watcher
 	fileHashes map[string]string
 	mu         sync.RWMutex
-	callbacks  map[string]func(string)
+	callbacks  map[string]func(Event) error
 	debounce   map[string]time.Duration
+	// strategies decide which files changed; strategy is the one of later
+	// watches
+	strategies map[string]Strategy
+	strategy   Strategy
+	// patterns are the watched directories and globs by the path given to
+	// Watch; matched maps the files they matched to them
+	patterns map[string]*pattern
+	matched  map[string]*pattern
+
+	// Pending debounced changes and their kinds. Once stopped no more are
+	// scheduled; running counts the event loop and the pending and running
+	// changes, which Stop waits for.
+	timersMu sync.Mutex
+	timers   map[string]*time.Timer
+	kinds    map[string]EventKind
+	started  bool
+	stopped  bool
+	running  sync.WaitGroup
+	// calling holds the goroutines running callbacks by id, which Stop
+	// must not wait for when called from one of them
+	calling map[uint64]bool
+	// maxWait bounds how long changes arriving within the debounce
+	// duration postpone handling; waiting holds when each wait began
+	maxWait time.Duration
+	waiting map[string]time.Time
+
+	// settle is how long a changed file must stay unchanged before its
+	// callback is called; settling holds the files being waited for
+	settle   time.Duration
+	settleMu sync.Mutex
+	settling map[string]bool
+
+	// How failed callbacks are retried
+	retry  resilient.Policy
+	giveUp func(Event, error)
+
+	// Polling: the interval, and the size and modification time of each
+	// file at the last check
+	pollInterval time.Duration
+	stats        map[string]fileStat
+
+	// done is closed by Stop
+	done      chan struct{}
+	closeOnce sync.Once
 }
 
 // NewFileWatcher creates a new file watcher
@@ -28,21 +73,46 @@ func NewFileWatcher() (*FileWatcher, error) {
 		return nil, fmt.Errorf("failed to create file watcher: %w", err)
 	}
 
+	fw := newFileWatcher()
+	fw.watcher = watcher
+	return fw, nil
+}
+
+// newFileWatcher creates a watcher without a means of detecting changes
+func newFileWatcher() *FileWatcher {
 	return &FileWatcher{
-		watcher:    watcher,
 		fileHashes: make(map[string]string),
-		callbacks:  make(map[string]func(string)),
+		callbacks:  make(map[string]func(Event) error),
 		debounce:   make(map[string]time.Duration),
-	}, nil
+		strategies: make(map[string]Strategy),
+		strategy:   StrategySHA256,
+		patterns:   make(map[string]*pattern),
+		matched:    make(map[string]*pattern),
+		timers:     make(map[string]*time.Timer),
+		kinds:      make(map[string]EventKind),
+		waiting:    make(map[string]time.Time),
+		settling:   make(map[string]bool),
+		calling:    make(map[uint64]bool),
+		stats:      make(map[string]fileStat),
+		done:       make(chan struct{}),
+	}
 }
 
-// Watch starts watching a file or directory with a configurable debounce duration
+// Watch starts watching a file, a directory or a glob of file names (e.g.
+// data/*.db) with a configurable debounce duration. The callback is called
+// with the path of each changed file, including files of a directory or
+// glob created after watching started.
 func (fw *FileWatcher) Watch(path string, callback func(string), debounceDuration time.Duration) error {
-	fw.mu.Lock()
-	defer fw.mu.Unlock()
+	return fw.WatchEvents(path, func(event Event) error {
+		callback(event.Path)
+		return nil
+	}, debounceDuration)
+}
 
+// watchFile starts watching a single file. The caller holds mu.
+func (fw *FileWatcher) watchFile(path string, strategy Strategy, callback func(Event) error, debounceDuration time.Duration) error {
 	// Get initial hash
-	hash, err := fw.getFileHash(path)
+	hash, err := fw.fingerprint(path, strategy)
 	if err != nil {
 		return fmt.Errorf("failed to get initial hash: %w", err)
 	}
@@ -50,6 +120,14 @@ func (fw *FileWatcher) Watch(path string, callback func(string), debounceDuratio
 	fw.fileHashes[path] = hash
 	fw.callbacks[path] = callback
 	fw.debounce[path] = debounceDuration
+	fw.strategies[path] = strategy
+	// A file of a watched directory gets its own watch and callback
+	delete(fw.matched, path)
+
+	if fw.watcher == nil {
+		fw.stats[path] = statFile(path)
+		return nil
+	}
 
 	// Add to watcher
 	if err := fw.watcher.Add(path); err != nil {
@@ -59,45 +137,114 @@ func (fw *FileWatcher) Watch(path string, callback func(string), debounceDuratio
 	return nil
 }
 
-// Start begins watching for file changes
-func (fw *FileWatcher) Start() {
-	go fw.watchLoop()
+// Start begins watching for file changes until ctx is done or Stop is
+// called; later calls do nothing
+func (fw *FileWatcher) Start(ctx context.Context) {
+	fw.timersMu.Lock()
+	defer fw.timersMu.Unlock()
+	if fw.stopped || fw.started {
+		return
+	}
+	fw.started = true
+
+	fw.running.Add(1)
+	if fw.watcher == nil {
+		go fw.pollLoop()
+	} else {
+		go fw.watchLoop()
+	}
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			fw.Stop()
+		case <-fw.done:
+		}
+	}()
+}
+
+// Stop stops watching: it ends the event loop, cancels the pending
+// debounced changes and waits for the callbacks already running. Later
+// changes are ignored; a stopped watcher cannot be started again. Called
+// from a callback, Stop returns without waiting, as the callback is among
+// those it would wait for.
+func (fw *FileWatcher) Stop() {
+	fw.closeOnce.Do(func() { close(fw.done) })
+
+	fw.timersMu.Lock()
+	inCallback := fw.calling[goroutineID()]
+	fw.stopped = true
+	for path, timer := range fw.timers {
+		if timer.Stop() {
+			fw.running.Done()
+		}
+		delete(fw.timers, path)
+		delete(fw.kinds, path)
+		delete(fw.waiting, path)
+	}
+	fw.timersMu.Unlock()
+
+	if !inCallback {
+		fw.running.Wait()
+	}
+}
+
+// goRunning runs a change in a goroutine that Stop waits for, unless the
+// watcher is stopped. The caller holds timersMu.
+func (fw *FileWatcher) goRunning(change func()) {
+	if fw.stopped {
+		return
+	}
+	fw.running.Add(1)
+	go func() {
+		defer fw.running.Done()
+		change()
+	}()
 }
 
 // watchLoop is the main event loop for file watching
 func (fw *FileWatcher) watchLoop() {
-	// Debounce timer to avoid multiple rapid events
-	debounceTimers := make(map[string]*time.Timer)
+	defer fw.running.Done()
 
 	for {
 		select {
+		case <-fw.done:
+			return
+
 		case event, ok := <-fw.watcher.Events:
 			if !ok {
 				return
 			}
 
-			// Only process write and create events
+			// Only process write and create events. A watched file created
+			// in a watched directory was renamed over.
 			if event.Op&fsnotify.Write == fsnotify.Write || event.Op&fsnotify.Create == fsnotify.Create {
-				path := event.Name
+				kind := EventWrite
+				if !fw.matchNew(event.Name) && event.Op&fsnotify.Create == fsnotify.Create {
+					kind = EventReplace
+				}
+				fw.dispatch(event.Name, kind)
+			}
 
-				// Get debounce duration for this path
+			// Editors and atomic writers replace a file by renaming a new one
+			// over it, which ends the watch on the old file. Files of a
+			// watched directory reappear through its create event.
+			if event.Op&(fsnotify.Remove|fsnotify.Rename) != 0 {
 				fw.mu.RLock()
-				debounceDuration := fw.debounce[path]
+				_, watched := fw.callbacks[event.Name]
+				_, inDir := fw.matched[event.Name]
+				watched = watched && !inDir
 				fw.mu.RUnlock()
 
-				// If debounce is 0, process immediately
-				if debounceDuration == 0 {
-					go fw.handleFileChange(path)
-				} else {
-					// Debounce: wait specified duration before processing
-					if timer, exists := debounceTimers[path]; exists {
-						timer.Stop()
-					}
-
-					debounceTimers[path] = time.AfterFunc(debounceDuration, func() {
-						fw.handleFileChange(path)
-						delete(debounceTimers, path)
+				if watched {
+					path := event.Name
+					fw.timersMu.Lock()
+					fw.goRunning(func() {
+						if fw.rewatch(path) {
+							fw.handleFileChange(path, EventReplace)
+						}
 					})
+					fw.timersMu.Unlock()
 				}
 			}
 
@@ -110,11 +257,102 @@ func (fw *FileWatcher) watchLoop() {
 	}
 }
 
-// handleFileChange checks if file has actually changed and calls callback
-func (fw *FileWatcher) handleFileChange(path string) {
+// dispatch handles a change of a file after its debounce duration; a
+// change within that time restarts the wait, up to the maximum wait. A
+// replacement during the wait is not reported as a mere write.
+func (fw *FileWatcher) dispatch(path string, kind EventKind) {
+	fw.mu.RLock()
+	debounceDuration := fw.debounce[path]
+	fw.mu.RUnlock()
+
+	fw.timersMu.Lock()
+	defer fw.timersMu.Unlock()
+
+	// If debounce is 0, process immediately
+	if debounceDuration == 0 {
+		fw.goRunning(func() { fw.handleFileChange(path, kind) })
+		return
+	}
+	if fw.stopped {
+		return
+	}
+
+	delay := debounceDuration
+	if timer, exists := fw.timers[path]; exists {
+		if timer.Stop() {
+			fw.running.Done()
+		}
+		if kind == EventWrite {
+			kind = fw.kinds[path]
+		}
+		if fw.maxWait > 0 {
+			if remaining := time.Until(fw.waiting[path].Add(fw.maxWait)); remaining < delay {
+				delay = max(remaining, 0)
+			}
+		}
+	} else {
+		fw.waiting[path] = time.Now()
+	}
+	fw.kinds[path] = kind
+	fw.running.Add(1)
+	var timer *time.Timer
+	timer = time.AfterFunc(delay, func() {
+		defer fw.running.Done()
+		fw.timersMu.Lock()
+		if fw.timers[path] == timer {
+			delete(fw.timers, path)
+			delete(fw.kinds, path)
+			delete(fw.waiting, path)
+		}
+		fw.timersMu.Unlock()
+		fw.handleFileChange(path, kind)
+	})
+	fw.timers[path] = timer
+}
+
+// SetMaxWait bounds how long a burst of changes, each arriving within the
+// debounce duration of the previous one, postpones handling: the file is
+// handled at least every maxWait while the changes continue. Zero waits
+// for a pause in the changes however long the burst lasts.
+func (fw *FileWatcher) SetMaxWait(maxWait time.Duration) {
+	fw.timersMu.Lock()
+	defer fw.timersMu.Unlock()
+	fw.maxWait = maxWait
+}
+
+// rewatch watches a replaced file again once it exists; it gives up if the
+// file does not reappear within a second
+func (fw *FileWatcher) rewatch(path string) bool {
+	for i := 0; i < 10; i++ {
+		select {
+		case <-time.After(100 * time.Millisecond):
+		case <-fw.done:
+			return false
+		}
+
+		fw.mu.RLock()
+		_, watched := fw.callbacks[path]
+		fw.mu.RUnlock()
+		if !watched {
+			return false
+		}
+
+		if err := fw.watcher.Add(path); err == nil {
+			return true
+		}
+	}
+
+	log.Printf("⚠️  %s was removed; no longer watching it", path)
+	return false
+}
+
+// handleFileChange checks if file has actually changed and calls callback.
+// A write to a file whose hash is not known yet is reported as its creation.
+func (fw *FileWatcher) handleFileChange(path string, kind EventKind) {
 	fw.mu.RLock()
 	callback, hasCallback := fw.callbacks[path]
 	oldHash := fw.fileHashes[path]
+	strategy := fw.strategies[path]
 	fw.mu.RUnlock()
 
 	if !hasCallback {
@@ -122,11 +360,35 @@ func (fw *FileWatcher) handleFileChange(path string) {
 	}
 
 	// Calculate new hash
-	newHash, err := fw.getFileHash(path)
+	stat := statFile(path)
+	newHash, err := fw.fingerprint(path, strategy)
 	if err != nil {
 		log.Printf("⚠️  Failed to get hash for %s: %v", path, err)
 		return
 	}
+	if newHash == oldHash {
+		return
+	}
+
+	if fw.settleDuration() > 0 {
+		// A change while the file settles is picked up by the wait
+		if !fw.beginSettle(path) {
+			return
+		}
+		newHash, stat, err = fw.waitStable(path, strategy, newHash, stat)
+		fw.endSettle(path)
+		if err == errClosed {
+			return
+		}
+		if err != nil {
+			log.Printf("⚠️  Failed to get hash for %s: %v", path, err)
+			return
+		}
+
+		fw.mu.RLock()
+		oldHash = fw.fileHashes[path]
+		fw.mu.RUnlock()
+	}
 
 	// Only trigger callback if hash changed
 	if newHash != oldHash {
@@ -134,39 +396,69 @@ func (fw *FileWatcher) handleFileChange(path string) {
 		fw.fileHashes[path] = newHash
 		fw.mu.Unlock()
 
-		callback(path)
+		if oldHash == "" && kind == EventWrite {
+			kind = EventCreate
+		}
+		fw.call(callback, Event{
+			Path:    path,
+			Kind:    kind,
+			OldHash: oldHash,
+			NewHash: newHash,
+			Size:    stat.size,
+			ModTime: stat.modTime,
+		})
 	}
 }
 
-// getFileHash calculates SHA-256 hash of a file
-func (fw *FileWatcher) getFileHash(path string) (string, error) {
-	file, err := os.Open(path)
-	if err != nil {
-		return "", err
-	}
-	defer file.Close()
+// Hash returns the SHA-256 of a watched file as of its last detected
+// change; files watched with another strategy have none
+func (fw *FileWatcher) Hash(path string) (string, bool) {
+	fw.mu.RLock()
+	defer fw.mu.RUnlock()
 
-	hash := sha256.New()
-	if _, err := io.Copy(hash, file); err != nil {
-		return "", err
+	if fw.strategies[path] != StrategySHA256 {
+		return "", false
 	}
+	hash, ok := fw.fileHashes[path]
+	return hash, ok
+}
 
-	return fmt.Sprintf("%x", hash.Sum(nil)), nil
+// fingerprintOf returns what the strategy of a watched file compares as of
+// its last detected change, as given in the NewHash of its events
+func (fw *FileWatcher) fingerprintOf(path string) string {
+	fw.mu.RLock()
+	defer fw.mu.RUnlock()
+	return fw.fileHashes[path]
 }
 
-// Close stops the file watcher
+// Close stops the file watcher (see Stop) and releases its resources
 func (fw *FileWatcher) Close() error {
+	fw.Stop()
+	if fw.watcher == nil {
+		return nil
+	}
 	return fw.watcher.Close()
 }
 
-// Unwatch stops watching a specific file
+// Unwatch stops watching a specific file, or a directory or glob and the
+// files it matched
 func (fw *FileWatcher) Unwatch(path string) error {
 	fw.mu.Lock()
 	defer fw.mu.Unlock()
 
+	if _, ok := fw.patterns[path]; ok {
+		return fw.unwatchPattern(path)
+	}
+
 	delete(fw.fileHashes, path)
 	delete(fw.callbacks, path)
 	delete(fw.debounce, path)
+	delete(fw.strategies, path)
+	delete(fw.matched, path)
+	delete(fw.stats, path)
 
+	if fw.watcher == nil {
+		return nil
+	}
 	return fw.watcher.Remove(path)
 }
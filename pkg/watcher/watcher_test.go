@@ -1,12 +1,19 @@
 package watcher
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
+
+	"github.com/atomicdeploy/patris-export/pkg/resilient"
 )
 
 func TestFileWatcher_DebounceZero(t *testing.T) {
@@ -41,7 +48,7 @@ func TestFileWatcher_DebounceZero(t *testing.T) {
 		t.Fatalf("Failed to watch file: %v", err)
 	}
 
-	fw.Start()
+	fw.Start(t.Context())
 
 	// Wait for watcher to start
 	time.Sleep(100 * time.Millisecond)
@@ -106,7 +113,7 @@ func TestFileWatcher_DebounceOneSecond(t *testing.T) {
 		t.Fatalf("Failed to watch file: %v", err)
 	}
 
-	fw.Start()
+	fw.Start(t.Context())
 
 	// Wait for watcher to start
 	time.Sleep(100 * time.Millisecond)
@@ -184,7 +191,7 @@ func TestFileWatcher_MultipleFiles(t *testing.T) {
 		t.Fatalf("Failed to watch file2: %v", err)
 	}
 
-	fw.Start()
+	fw.Start(t.Context())
 
 	// Wait for watcher to start
 	time.Sleep(100 * time.Millisecond)
@@ -244,7 +251,7 @@ func TestFileWatcher_Unwatch(t *testing.T) {
 		t.Fatalf("Failed to watch file: %v", err)
 	}
 
-	fw.Start()
+	fw.Start(t.Context())
 
 	// Wait for watcher to start
 	time.Sleep(100 * time.Millisecond)
@@ -287,3 +294,867 @@ func TestFileWatcher_Unwatch(t *testing.T) {
 		t.Errorf("Expected no callbacks after unwatch, but got %d total calls (was %d before unwatch)", callsAfterUnwatch, callsBeforeUnwatch)
 	}
 }
+
+func TestFileWatcher_ReplacedByRename(t *testing.T) {
+	tmpDir := t.TempDir()
+	tmpFile := filepath.Join(tmpDir, "map.txt")
+
+	if err := os.WriteFile(tmpFile, []byte("initial"), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	fw, err := NewFileWatcher()
+	if err != nil {
+		t.Fatalf("Failed to create file watcher: %v", err)
+	}
+	defer fw.Close()
+
+	var mu sync.Mutex
+	callCount := 0
+	err = fw.Watch(tmpFile, func(path string) {
+		mu.Lock()
+		defer mu.Unlock()
+		callCount++
+	}, 0)
+	if err != nil {
+		t.Fatalf("Failed to watch file: %v", err)
+	}
+
+	fw.Start(t.Context())
+	time.Sleep(100 * time.Millisecond)
+
+	// Replace the file the way editors save it, twice
+	for i := 0; i < 2; i++ {
+		replacement := filepath.Join(tmpDir, "map.txt.tmp")
+		if err := os.WriteFile(replacement, []byte("saved "+strconv.Itoa(i)), 0644); err != nil {
+			t.Fatalf("Failed to write replacement: %v", err)
+		}
+		if err := os.Rename(replacement, tmpFile); err != nil {
+			t.Fatalf("Failed to replace file: %v", err)
+		}
+		time.Sleep(500 * time.Millisecond)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if callCount != 2 {
+		t.Errorf("Expected 2 callbacks for 2 replacements, got %d", callCount)
+	}
+}
+
+func TestFileWatcher_Hash(t *testing.T) {
+	tmpDir := t.TempDir()
+	tmpFile := filepath.Join(tmpDir, "test.db")
+
+	if err := os.WriteFile(tmpFile, []byte("initial"), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	fw, err := NewFileWatcher()
+	if err != nil {
+		t.Fatalf("Failed to create file watcher: %v", err)
+	}
+	defer fw.Close()
+
+	if _, ok := fw.Hash(tmpFile); ok {
+		t.Error("Expected no hash for an unwatched file")
+	}
+
+	changed := make(chan struct{}, 1)
+	if err := fw.Watch(tmpFile, func(string) { changed <- struct{}{} }, 0); err != nil {
+		t.Fatalf("Failed to watch file: %v", err)
+	}
+	fw.Start(t.Context())
+
+	initial, ok := fw.Hash(tmpFile)
+	if !ok || initial == "" {
+		t.Fatal("Expected a hash for the watched file")
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	if err := os.WriteFile(tmpFile, []byte("modified"), 0644); err != nil {
+		t.Fatalf("Failed to modify test file: %v", err)
+	}
+
+	select {
+	case <-changed:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected a callback for the modification")
+	}
+
+	if current, _ := fw.Hash(tmpFile); current == initial {
+		t.Error("Expected the hash to change with the file's content")
+	}
+}
+
+func TestFileWatcher_Directory(t *testing.T) {
+	tmpDir := t.TempDir()
+	existing := filepath.Join(tmpDir, "kala.db")
+	if err := os.WriteFile(existing, []byte("initial"), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	fw, err := NewFileWatcher()
+	if err != nil {
+		t.Fatalf("Failed to create file watcher: %v", err)
+	}
+	defer fw.Close()
+
+	changed := make(chan string, 10)
+	if err := fw.Watch(tmpDir, func(path string) { changed <- path }, 0); err != nil {
+		t.Fatalf("Failed to watch directory: %v", err)
+	}
+	fw.Start(t.Context())
+	time.Sleep(100 * time.Millisecond)
+
+	if _, ok := fw.Hash(existing); !ok {
+		t.Error("Expected a hash for the file in the directory")
+	}
+
+	// A file created after Start is watched too
+	created := filepath.Join(tmpDir, "moshtari.db")
+	for _, path := range []string{existing, created} {
+		if err := os.WriteFile(path, []byte("changed"), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", path, err)
+		}
+		select {
+		case got := <-changed:
+			if got != path {
+				t.Errorf("Expected a callback for %s, got %s", path, got)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("Expected a callback for %s", path)
+		}
+		// Let the events of the write settle
+		time.Sleep(200 * time.Millisecond)
+		for len(changed) > 0 {
+			<-changed
+		}
+	}
+
+	if err := fw.Unwatch(tmpDir); err != nil {
+		t.Fatalf("Failed to unwatch directory: %v", err)
+	}
+	if _, ok := fw.Hash(created); ok {
+		t.Error("Expected no hash after unwatching the directory")
+	}
+}
+
+func TestFileWatcher_Glob(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	fw, err := NewFileWatcher()
+	if err != nil {
+		t.Fatalf("Failed to create file watcher: %v", err)
+	}
+	defer fw.Close()
+
+	// The debounce joins the create and write events of each file
+	var mu sync.Mutex
+	var calls []string
+	if err := fw.Watch(filepath.Join(tmpDir, "*.db"), func(path string) {
+		mu.Lock()
+		defer mu.Unlock()
+		calls = append(calls, filepath.Base(path))
+	}, 50*time.Millisecond); err != nil {
+		t.Fatalf("Failed to watch glob: %v", err)
+	}
+	fw.Start(t.Context())
+	time.Sleep(100 * time.Millisecond)
+
+	for _, name := range []string{"kala.db", "kala.px", "notes.txt"} {
+		if err := os.WriteFile(filepath.Join(tmpDir, name), []byte(name), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+	time.Sleep(500 * time.Millisecond)
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(calls) != 1 || calls[0] != "kala.db" {
+		t.Errorf("Expected one callback for kala.db, got %v", calls)
+	}
+}
+
+func TestFileWatcher_InvalidPattern(t *testing.T) {
+	fw, err := NewFileWatcher()
+	if err != nil {
+		t.Fatalf("Failed to create file watcher: %v", err)
+	}
+	defer fw.Close()
+
+	tmpDir := t.TempDir()
+	for _, pattern := range []string{
+		filepath.Join(tmpDir, "*", "kala.db"),
+		filepath.Join(tmpDir, "[.db"),
+		filepath.Join(tmpDir, "missing", "*.db"),
+	} {
+		if err := fw.Watch(pattern, func(string) {}, 0); err == nil {
+			t.Errorf("Expected an error watching %s", pattern)
+		}
+	}
+}
+
+func TestPollingWatcher(t *testing.T) {
+	tmpDir := t.TempDir()
+	tmpFile := filepath.Join(tmpDir, "kala.db")
+	if err := os.WriteFile(tmpFile, []byte("initial"), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	fw := NewPollingWatcher(50 * time.Millisecond)
+	defer fw.Close()
+	if !fw.Polling() {
+		t.Fatal("Expected a polling watcher")
+	}
+
+	changed := make(chan string, 10)
+	if err := fw.Watch(tmpFile, func(path string) { changed <- path }, 0); err != nil {
+		t.Fatalf("Failed to watch file: %v", err)
+	}
+	if err := fw.Watch(filepath.Join(tmpDir, "*.db"), func(path string) { changed <- path }, 0); err != nil {
+		t.Fatalf("Failed to watch glob: %v", err)
+	}
+	fw.Start(t.Context())
+
+	// Unchanged files do not call back
+	time.Sleep(200 * time.Millisecond)
+	if len(changed) != 0 {
+		t.Fatalf("Expected no callback before a change, got %d", len(changed))
+	}
+
+	// A modified file, and a file created after Start. They are written by
+	// rename so a poll cannot see them half-written.
+	created := filepath.Join(tmpDir, "moshtari.db")
+	for _, path := range []string{tmpFile, created} {
+		tmp := filepath.Join(t.TempDir(), "new")
+		if err := os.WriteFile(tmp, []byte("changed content"), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", tmp, err)
+		}
+		if err := os.Rename(tmp, path); err != nil {
+			t.Fatalf("Failed to write %s: %v", path, err)
+		}
+		select {
+		case got := <-changed:
+			if got != path {
+				t.Errorf("Expected a callback for %s, got %s", path, got)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("Expected a callback for %s", path)
+		}
+	}
+}
+
+func TestParseMode(t *testing.T) {
+	for name, want := range map[string]Mode{"": ModeAuto, "auto": ModeAuto, "Poll": ModePoll, "notify": ModeNotify} {
+		if got, err := ParseMode(name); err != nil || got != want {
+			t.Errorf("ParseMode(%q) = %q, %v; want %q", name, got, err, want)
+		}
+	}
+	if _, err := ParseMode("inotify"); err == nil {
+		t.Error("Expected an error for an unknown mode")
+	}
+}
+
+func TestNew(t *testing.T) {
+	tmpFile := filepath.Join(t.TempDir(), "kala.db")
+
+	tests := []struct {
+		opts    Options
+		polling bool
+	}{
+		{Options{Mode: ModeAuto}, false},
+		{Options{Mode: ModeNotify}, false},
+		{Options{Mode: ModePoll, PollInterval: time.Second}, true},
+	}
+	for _, tt := range tests {
+		fw, err := New(tt.opts, tmpFile)
+		if err != nil {
+			t.Fatalf("New(%v) failed: %v", tt.opts, err)
+		}
+		if fw.Polling() != tt.polling {
+			t.Errorf("New(%v): expected polling %v", tt.opts, tt.polling)
+		}
+		fw.Close()
+	}
+
+	if !IsNetworkPath(`\\server\share\kala.db`) || !IsNetworkPath("//server/share/kala.db") {
+		t.Error("Expected UNC paths to be network paths")
+	}
+	if IsNetworkPath(tmpFile) {
+		t.Error("Expected a temporary file not to be on a network file system")
+	}
+}
+
+func TestFileWatcher_Settle(t *testing.T) {
+	tmpDir := t.TempDir()
+	tmpFile := filepath.Join(tmpDir, "kala.db")
+	if err := os.WriteFile(tmpFile, []byte("initial"), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	fw, err := New(Options{Mode: ModeNotify, Settle: 300 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("Failed to create watcher: %v", err)
+	}
+	defer fw.Close()
+
+	contents := make(chan string, 10)
+	callback := func(path string) {
+		data, _ := os.ReadFile(path)
+		contents <- string(data)
+	}
+	if err := fw.Watch(tmpFile, callback, 10*time.Millisecond); err != nil {
+		t.Fatalf("Failed to watch file: %v", err)
+	}
+	fw.Start(t.Context())
+
+	// Bursts further apart than the debounce but closer than the settle time
+	file, err := os.OpenFile(tmpFile, os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		t.Fatalf("Failed to open test file: %v", err)
+	}
+	for i := 0; i < 5; i++ {
+		if _, err := file.WriteString("burst "); err != nil {
+			t.Fatalf("Failed to write test file: %v", err)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	file.Close()
+
+	select {
+	case got := <-contents:
+		if want := strings.Repeat("burst ", 5); got != want {
+			t.Errorf("Expected the callback after the last burst, read %q", got)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("Expected a callback")
+	}
+
+	time.Sleep(500 * time.Millisecond)
+	if len(contents) != 0 {
+		t.Errorf("Expected one callback, got %d more", len(contents))
+	}
+}
+
+func TestWatchEvents(t *testing.T) {
+	tmpDir := t.TempDir()
+	tmpFile := filepath.Join(tmpDir, "kala.db")
+	if err := os.WriteFile(tmpFile, []byte("initial"), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	fw, err := NewFileWatcher()
+	if err != nil {
+		t.Fatalf("Failed to create watcher: %v", err)
+	}
+	defer fw.Close()
+
+	events := make(chan Event, 10)
+	if err := fw.WatchEvents(tmpFile, func(event Event) error {
+		events <- event
+		return nil
+	}, 50*time.Millisecond); err != nil {
+		t.Fatalf("Failed to watch file: %v", err)
+	}
+	if err := fw.WatchEvents(filepath.Join(tmpDir, "*.tmp"), func(event Event) error {
+		events <- event
+		return nil
+	}, 50*time.Millisecond); err != nil {
+		t.Fatalf("Failed to watch glob: %v", err)
+	}
+	initial, _ := fw.Hash(tmpFile)
+	fw.Start(t.Context())
+
+	next := func() Event {
+		t.Helper()
+		select {
+		case event := <-events:
+			return event
+		case <-time.After(2 * time.Second):
+			t.Fatal("Expected an event")
+			return Event{}
+		}
+	}
+
+	// A write in place
+	if err := os.WriteFile(tmpFile, []byte("changed"), 0644); err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+	event := next()
+	if event.Path != tmpFile || event.Kind != EventWrite || event.OldHash != initial || event.Size != 7 {
+		t.Errorf("Unexpected write event %+v", event)
+	}
+	if hash, _ := fw.Hash(tmpFile); event.NewHash != hash || event.NewHash == initial {
+		t.Errorf("Expected the new hash %s, got %s", hash, event.NewHash)
+	}
+	if info, err := os.Stat(tmpFile); err != nil || !event.ModTime.Equal(info.ModTime()) {
+		t.Errorf("Expected the file's modification time, got %v", event.ModTime)
+	}
+
+	// A file renamed over the watched one; the temporary file it was written
+	// to is created in the glob
+	tmp := filepath.Join(tmpDir, "kala.tmp")
+	if err := os.WriteFile(tmp, []byte("replaced!"), 0644); err != nil {
+		t.Fatalf("Failed to write %s: %v", tmp, err)
+	}
+	event = next()
+	if event.Path != tmp || event.Kind != EventCreate || event.OldHash != "" || event.Size != 9 {
+		t.Errorf("Unexpected create event %+v", event)
+	}
+	previous := event.NewHash
+	if err := os.Rename(tmp, tmpFile); err != nil {
+		t.Fatalf("Failed to replace test file: %v", err)
+	}
+	event = next()
+	if event.Path != tmpFile || event.Kind != EventReplace || event.NewHash != previous || event.Size != 9 {
+		t.Errorf("Unexpected replace event %+v", event)
+	}
+}
+
+func TestFileWatcher_Stop(t *testing.T) {
+	tmpDir := t.TempDir()
+	tmpFile := filepath.Join(tmpDir, "kala.db")
+	if err := os.WriteFile(tmpFile, []byte("initial"), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	fw, err := NewFileWatcher()
+	if err != nil {
+		t.Fatalf("Failed to create watcher: %v", err)
+	}
+	defer fw.Close()
+
+	var mu sync.Mutex
+	started, finished := 0, 0
+	if err := fw.Watch(tmpFile, func(path string) {
+		mu.Lock()
+		started++
+		mu.Unlock()
+		time.Sleep(300 * time.Millisecond)
+		mu.Lock()
+		finished++
+		mu.Unlock()
+	}, 100*time.Millisecond); err != nil {
+		t.Fatalf("Failed to watch file: %v", err)
+	}
+	fw.Start(t.Context())
+
+	// Wait for a callback to start, then schedule another debounced change
+	if err := os.WriteFile(tmpFile, []byte("first"), 0644); err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+	time.Sleep(200 * time.Millisecond)
+	if err := os.WriteFile(tmpFile, []byte("second"), 0644); err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+	time.Sleep(20 * time.Millisecond)
+
+	// Stop waits for the running callback and cancels the pending change
+	fw.Stop()
+	mu.Lock()
+	if started != 1 || finished != 1 {
+		t.Errorf("Expected the running callback to finish, got %d started and %d finished", started, finished)
+	}
+	mu.Unlock()
+
+	if err := os.WriteFile(tmpFile, []byte("third"), 0644); err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+	time.Sleep(300 * time.Millisecond)
+	mu.Lock()
+	defer mu.Unlock()
+	if started != 1 {
+		t.Errorf("Expected no callbacks after Stop, got %d", started-1)
+	}
+}
+
+func TestFileWatcher_StopFromCallback(t *testing.T) {
+	tmpDir := t.TempDir()
+	tmpFile := filepath.Join(tmpDir, "kala.db")
+	if err := os.WriteFile(tmpFile, []byte("initial"), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	fw := NewPollingWatcher(20 * time.Millisecond)
+	defer fw.Close()
+
+	stopped := make(chan struct{})
+	if err := fw.Watch(tmpFile, func(path string) {
+		fw.Stop()
+		close(stopped)
+	}, 0); err != nil {
+		t.Fatalf("Failed to watch file: %v", err)
+	}
+	// Starting again does not start a second loop
+	fw.Start(t.Context())
+	fw.Start(t.Context())
+	fw.timersMu.Lock()
+	if !fw.started {
+		t.Error("Expected the watcher to be started")
+	}
+	fw.timersMu.Unlock()
+
+	if err := os.WriteFile(tmpFile, []byte("changed"), 0644); err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+	select {
+	case <-stopped:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected Stop called from a callback to return")
+	}
+
+	// Stop from elsewhere still waits for the callback
+	done := make(chan struct{})
+	go func() {
+		fw.Stop()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected Stop to return once the callback finished")
+	}
+}
+
+func TestFileWatcher_StartContext(t *testing.T) {
+	tmpDir := t.TempDir()
+	tmpFile := filepath.Join(tmpDir, "kala.db")
+	if err := os.WriteFile(tmpFile, []byte("initial"), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	fw := NewPollingWatcher(20 * time.Millisecond)
+	defer fw.Close()
+
+	changed := make(chan string, 10)
+	if err := fw.Watch(tmpFile, func(path string) { changed <- path }, 0); err != nil {
+		t.Fatalf("Failed to watch file: %v", err)
+	}
+	ctx, cancel := context.WithCancel(t.Context())
+	fw.Start(ctx)
+	cancel()
+
+	select {
+	case <-fw.done:
+	case <-time.After(time.Second):
+		t.Fatal("Expected the watcher to stop when the context is done")
+	}
+
+	if err := os.WriteFile(tmpFile, []byte("changed"), 0644); err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+	time.Sleep(200 * time.Millisecond)
+	if len(changed) != 0 {
+		t.Errorf("Expected no callbacks after the context is done, got %d", len(changed))
+	}
+}
+
+func TestFileWatcher_Retry(t *testing.T) {
+	tmpDir := t.TempDir()
+	tmpFile := filepath.Join(tmpDir, "kala.db")
+	if err := os.WriteFile(tmpFile, []byte("initial"), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	fw := NewPollingWatcher(20 * time.Millisecond)
+	defer fw.Close()
+
+	gaveUp := make(chan error, 10)
+	fw.SetRetry(resilient.Policy{Retries: 2, InitialBackoff: 10 * time.Millisecond}, func(event Event, err error) {
+		gaveUp <- err
+	})
+
+	// Attempts are counted by the change they handle, so that a change
+	// seen in between is not counted with the one of the test
+	var mu sync.Mutex
+	attempts := map[string]int{}
+	failures := 0
+	done := make(chan string, 10)
+	if err := fw.WatchEvents(tmpFile, func(event Event) error {
+		mu.Lock()
+		defer mu.Unlock()
+		attempts[event.NewHash]++
+		if attempts[event.NewHash] <= failures {
+			return errors.New("table is locked")
+		}
+		done <- event.NewHash
+		return nil
+	}, 0); err != nil {
+		t.Fatalf("Failed to watch file: %v", err)
+	}
+	fw.Start(t.Context())
+
+	// The file is replaced at once, so that the poll never sees it
+	// truncated
+	change := func(content string, fail int) {
+		t.Helper()
+		mu.Lock()
+		failures = fail
+		mu.Unlock()
+		next := filepath.Join(tmpDir, "kala.db.tmp")
+		if err := os.WriteFile(next, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write test file: %v", err)
+		}
+		if err := os.Rename(next, tmpFile); err != nil {
+			t.Fatalf("Failed to replace test file: %v", err)
+		}
+	}
+
+	// Two failures are retried
+	change("first", 2)
+	select {
+	case hash := <-done:
+		mu.Lock()
+		if attempts[hash] != 3 {
+			t.Errorf("Expected 3 attempts, got %d", attempts[hash])
+		}
+		mu.Unlock()
+	case err := <-gaveUp:
+		t.Fatalf("Expected the change to succeed on the third attempt, gave up: %v", err)
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected the change to be handled")
+	}
+
+	// Three are not
+	change("second", 3)
+	select {
+	case err := <-gaveUp:
+		if err == nil || err.Error() != "table is locked" {
+			t.Errorf("Expected the last error, got %v", err)
+		}
+	case <-done:
+		t.Fatal("Expected the change to be given up")
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected the change to be given up")
+	}
+}
+
+func TestFileWatcher_RetryStrategies(t *testing.T) {
+	for _, strategy := range []Strategy{StrategySHA256, StrategyCRC32, StrategyStat} {
+		t.Run(string(strategy), func(t *testing.T) {
+			tmpDir := t.TempDir()
+			tmpFile := filepath.Join(tmpDir, "kala.db")
+			if err := os.WriteFile(tmpFile, []byte("initial"), 0644); err != nil {
+				t.Fatalf("Failed to create test file: %v", err)
+			}
+
+			fw := NewPollingWatcher(20 * time.Millisecond)
+			defer fw.Close()
+
+			gaveUp := make(chan Event, 10)
+			fw.SetRetry(resilient.Policy{Retries: 2, InitialBackoff: 10 * time.Millisecond}, func(event Event, err error) {
+				gaveUp <- event
+			})
+
+			// Attempts by the change they handle
+			var mu sync.Mutex
+			attempts := map[string]int{}
+			if err := fw.WatchStrategy(tmpFile, strategy, func(event Event) error {
+				mu.Lock()
+				defer mu.Unlock()
+				attempts[event.NewHash]++
+				return errors.New("table is locked")
+			}, 0); err != nil {
+				t.Fatalf("Failed to watch file: %v", err)
+			}
+			fw.Start(t.Context())
+
+			// Replace the file at once so that no partial write is seen
+			next := filepath.Join(tmpDir, "kala.db.tmp")
+			if err := os.WriteFile(next, []byte("changed"), 0644); err != nil {
+				t.Fatalf("Failed to write test file: %v", err)
+			}
+			// Of the same size, it differs in time even on coarse clocks
+			later := time.Now().Add(time.Minute)
+			if err := os.Chtimes(next, later, later); err != nil {
+				t.Fatalf("Failed to touch test file: %v", err)
+			}
+			if err := os.Rename(next, tmpFile); err != nil {
+				t.Fatalf("Failed to replace test file: %v", err)
+			}
+
+			select {
+			case event := <-gaveUp:
+				mu.Lock()
+				defer mu.Unlock()
+				if n := attempts[event.NewHash]; n != 3 {
+					t.Errorf("Expected 3 attempts before giving up, got %d", n)
+				}
+			case <-time.After(2 * time.Second):
+				t.Fatal("Expected the change to be retried and given up")
+			}
+		})
+	}
+}
+
+func TestFileWatcher_RetryPermanent(t *testing.T) {
+	tmpDir := t.TempDir()
+	tmpFile := filepath.Join(tmpDir, "kala.db")
+	if err := os.WriteFile(tmpFile, []byte("initial"), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	fw := NewPollingWatcher(20 * time.Millisecond)
+	defer fw.Close()
+
+	gaveUp := make(chan error, 10)
+	fw.SetRetry(resilient.Policy{Retries: 5, InitialBackoff: 10 * time.Millisecond}, func(event Event, err error) {
+		gaveUp <- err
+	})
+
+	var attempts atomic.Int32
+	if err := fw.WatchEvents(tmpFile, func(event Event) error {
+		attempts.Add(1)
+		return resilient.Permanent(errors.New("not a Paradox table"))
+	}, 0); err != nil {
+		t.Fatalf("Failed to watch file: %v", err)
+	}
+	fw.Start(t.Context())
+
+	if err := os.WriteFile(tmpFile, []byte("changed"), 0644); err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+	select {
+	case <-gaveUp:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected the change to be given up")
+	}
+	if n := attempts.Load(); n != 1 {
+		t.Errorf("Expected a permanent error not to be retried, got %d attempts", n)
+	}
+}
+
+func TestParseStrategy(t *testing.T) {
+	for name, want := range map[string]Strategy{"": StrategySHA256, "sha256": StrategySHA256, "CRC32": StrategyCRC32, "stat": StrategyStat} {
+		if got, err := ParseStrategy(name); err != nil || got != want {
+			t.Errorf("ParseStrategy(%q) = %q, %v; want %q", name, got, err, want)
+		}
+	}
+	if _, err := ParseStrategy("md5"); err == nil {
+		t.Error("Expected an error for an unknown strategy")
+	}
+}
+
+func TestWatchStrategy(t *testing.T) {
+	tmpDir := t.TempDir()
+	files := map[Strategy]string{}
+	for _, strategy := range []Strategy{StrategySHA256, StrategyCRC32, StrategyStat} {
+		files[strategy] = filepath.Join(tmpDir, string(strategy)+".db")
+		if err := os.WriteFile(files[strategy], []byte("initial"), 0644); err != nil {
+			t.Fatalf("Failed to create test file: %v", err)
+		}
+	}
+
+	fw := NewPollingWatcher(20 * time.Millisecond)
+	defer fw.Close()
+
+	events := make(chan Event, 10)
+	for strategy, path := range files {
+		if err := fw.WatchStrategy(path, strategy, func(event Event) error {
+			events <- event
+			return nil
+		}, 0); err != nil {
+			t.Fatalf("Failed to watch %s: %v", path, err)
+		}
+	}
+	fw.Start(t.Context())
+
+	// Only the SHA-256 is the file's hash
+	if _, ok := fw.Hash(files[StrategySHA256]); !ok {
+		t.Error("Expected the SHA-256 of the file")
+	}
+	if _, ok := fw.Hash(files[StrategyStat]); ok {
+		t.Error("Expected no SHA-256 of a file watched by size and time")
+	}
+
+	// Touching a file changes only its modification time
+	later := time.Now().Add(time.Minute)
+	for _, path := range files {
+		if err := os.Chtimes(path, later, later); err != nil {
+			t.Fatalf("Failed to touch %s: %v", path, err)
+		}
+	}
+	select {
+	case event := <-events:
+		if event.Path != files[StrategyStat] {
+			t.Errorf("Expected only the file watched by size and time to change, got %s", event.Path)
+		}
+		if want := fmt.Sprintf("7-%d", later.UnixNano()); event.NewHash != want {
+			t.Errorf("Expected fingerprint %s, got %s", want, event.NewHash)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected a change of the file watched by size and time")
+	}
+
+	// New content changes all of them
+	for _, path := range files {
+		if err := os.WriteFile(path, []byte("changed"), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", path, err)
+		}
+	}
+	seen := map[string]Event{}
+	for len(seen) < len(files) {
+		select {
+		case event := <-events:
+			seen[event.Path] = event
+		case <-time.After(2 * time.Second):
+			t.Fatalf("Expected a change of every file, got %v", seen)
+		}
+	}
+	if n := len(seen[files[StrategyCRC32]].NewHash); n != 8 {
+		t.Errorf("Expected a CRC-32 of 8 hex digits, got %q", seen[files[StrategyCRC32]].NewHash)
+	}
+	if n := len(seen[files[StrategySHA256]].NewHash); n != 64 {
+		t.Errorf("Expected a SHA-256 of 64 hex digits, got %q", seen[files[StrategySHA256]].NewHash)
+	}
+}
+
+func TestFileWatcher_MaxWait(t *testing.T) {
+	for _, tc := range []struct {
+		maxWait time.Duration
+		min     int
+		max     int
+	}{
+		{0, 1, 1},
+		{400 * time.Millisecond, 3, 5},
+	} {
+		tmpDir := t.TempDir()
+		tmpFile := filepath.Join(tmpDir, "kala.db")
+		if err := os.WriteFile(tmpFile, []byte("initial"), 0644); err != nil {
+			t.Fatalf("Failed to create test file: %v", err)
+		}
+
+		fw, err := New(Options{Mode: ModeNotify, MaxWait: tc.maxWait})
+		if err != nil {
+			t.Fatalf("Failed to create watcher: %v", err)
+		}
+
+		var mu sync.Mutex
+		calls := 0
+		if err := fw.Watch(tmpFile, func(path string) {
+			mu.Lock()
+			defer mu.Unlock()
+			calls++
+		}, 200*time.Millisecond); err != nil {
+			t.Fatalf("Failed to watch file: %v", err)
+		}
+		fw.Start(t.Context())
+
+		// Changes every 50ms for 1.6s never pause for the debounce
+		for i := 0; i < 32; i++ {
+			if err := os.WriteFile(tmpFile, []byte("burst "+strconv.Itoa(i)), 0644); err != nil {
+				t.Fatalf("Failed to write test file: %v", err)
+			}
+			time.Sleep(50 * time.Millisecond)
+		}
+		time.Sleep(400 * time.Millisecond)
+		fw.Close()
+
+		mu.Lock()
+		if calls < tc.min || calls > tc.max {
+			t.Errorf("Max wait %v: expected %d to %d callbacks, got %d", tc.maxWait, tc.min, tc.max, calls)
+		}
+		mu.Unlock()
+	}
+}